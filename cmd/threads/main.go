@@ -0,0 +1,322 @@
+// Command threads inspects and edits a logstore, either in memory or
+// persisted in a datastore at the given path.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	ipfslite "github.com/hsanjuan/ipfs-lite"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/namsral/flag"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	"github.com/textileio/go-threads/logstore/lstoreds"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+)
+
+const usage = `Usage: threads [flags] <command> [args]
+
+Commands:
+  list                                   List threads
+  info <thread>                          Show logs of a thread
+  add-addr <thread> <log> <addr>         Add an address to a log
+  add-key <thread> <service|read> <key>  Add a key to a thread
+  export <thread> [file]                 Export a thread to a file or stdout
+  import [file]                          Import a thread from a file or stdin
+  watch <thread>                         Print address changes of a thread
+  inspect <thread> [encoding]            Describe a thread ID, re-encoded if given
+  new-id [raw|access_controlled]         Print a new random thread ID
+
+Flags:
+`
+
+func main() {
+	fs := flag.NewFlagSetWithEnvPrefix(os.Args[0], "THRDS", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	repo := fs.String("repo", "", "Logstore datastore location (in memory if empty)")
+	ttl := fs.Duration("ttl", time.Hour*24, "TTL of added addresses")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		fatal(err)
+	}
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, closeStore, err := openLogstore(ctx, *repo)
+	if err != nil {
+		fatal(err)
+	}
+	err = run(ctx, store, args[0], args[1:], *ttl)
+	if cerr := closeStore(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if errors.Is(err, errUsage) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+var errUsage = errors.New("usage")
+
+func openLogstore(ctx context.Context, repo string) (core.Logstore, func() error, error) {
+	if repo == "" {
+		store := lstoremem.NewLogstore()
+		return store, store.Close, nil
+	}
+	if err := os.MkdirAll(repo, os.ModePerm); err != nil {
+		return nil, nil, err
+	}
+	dstore, err := ipfslite.BadgerDatastore(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := lstoreds.NewLogstore(ctx, dstore, lstoreds.DefaultOpts())
+	if err != nil {
+		_ = dstore.Close()
+		return nil, nil, err
+	}
+	return store, func() error {
+		if err := store.Close(); err != nil {
+			return err
+		}
+		return dstore.Close()
+	}, nil
+}
+
+func run(ctx context.Context, store core.Logstore, cmd string, args []string, ttl time.Duration) error {
+	switch cmd {
+	case "list":
+		return list(store)
+	case "info":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return info(store, args[0])
+	case "add-addr":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return addAddr(store, args[0], args[1], args[2], ttl)
+	case "add-key":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return addKey(store, args[0], args[1], args[2])
+	case "export":
+		if len(args) < 1 || len(args) > 2 {
+			return errUsage
+		}
+		return export(store, args[0], args[1:])
+	case "import":
+		if len(args) > 1 {
+			return errUsage
+		}
+		return importThread(store, args)
+	case "watch":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return watch(ctx, store, args[0])
+	case "inspect":
+		if len(args) < 1 || len(args) > 2 {
+			return errUsage
+		}
+		return inspect(args[0], args[1:])
+	case "new-id":
+		if len(args) > 1 {
+			return errUsage
+		}
+		return newID(args)
+	default:
+		return errUsage
+	}
+}
+
+func list(store core.Logstore) error {
+	ids, err := store.Threads()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func info(store core.Logstore, tid string) error {
+	id, err := thread.ParseID(tid)
+	if err != nil {
+		return err
+	}
+	info, err := store.GetThread(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("thread %s\n", info.ID)
+	fmt.Printf("  service-key: %t\n", info.Key.Service() != nil)
+	fmt.Printf("  read-key: %t\n", info.Key.CanRead())
+	for _, lg := range info.Logs {
+		fmt.Printf("log %s\n", lg.ID)
+		fmt.Printf("  own: %t\n", lg.PrivKey != nil)
+		if lg.Head.Defined() {
+			fmt.Printf("  head: %s\n", lg.Head)
+		}
+		for _, addr := range lg.Addrs {
+			fmt.Printf("  addr: %s\n", addr)
+		}
+	}
+	return nil
+}
+
+func addAddr(store core.Logstore, tid, lid, maddr string, ttl time.Duration) error {
+	id, err := thread.ParseID(tid)
+	if err != nil {
+		return err
+	}
+	pid, err := thread.DecodeLogID(lid)
+	if err != nil {
+		return err
+	}
+	addr, err := ma.NewMultiaddr(maddr)
+	if err != nil {
+		return err
+	}
+	return store.AddAddr(id, pid, addr, ttl)
+}
+
+func addKey(store core.Logstore, tid, kind, key string) error {
+	id, err := thread.ParseID(tid)
+	if err != nil {
+		return err
+	}
+	k, err := sym.FromString(key)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(kind) {
+	case "service":
+		return store.AddServiceKey(id, k)
+	case "read":
+		return store.AddReadKey(id, k)
+	default:
+		return errUsage
+	}
+}
+
+func export(store core.Logstore, tid string, file []string) error {
+	id, err := thread.ParseID(tid)
+	if err != nil {
+		return err
+	}
+	blob, err := store.ExportThread(id)
+	if err != nil {
+		return err
+	}
+	if len(file) == 0 {
+		_, err = os.Stdout.Write(blob)
+		return err
+	}
+	return ioutil.WriteFile(file[0], blob, 0600)
+}
+
+func importThread(store core.Logstore, file []string) error {
+	var r io.Reader = os.Stdin
+	if len(file) > 0 {
+		f, err := os.Open(file[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return store.ImportThread(blob)
+}
+
+func watch(ctx context.Context, store core.Logstore, tid string) error {
+	id, err := thread.ParseID(tid)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	stream, err := store.ThreadAddrStream(ctx, id)
+	if err != nil {
+		return err
+	}
+	for la := range stream {
+		fmt.Printf("%s %s\n", la.Log, la.Addr)
+	}
+	return nil
+}
+
+func inspect(tid string, encoding []string) error {
+	desc, err := thread.Describe(tid)
+	if err != nil {
+		return err
+	}
+	fmt.Println(desc)
+	if len(encoding) == 0 {
+		return nil
+	}
+	base, err := thread.ParseEncoding(encoding[0])
+	if err != nil {
+		return err
+	}
+	s, err := desc.ID.StringOfBase(base)
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
+
+func newID(variant []string) error {
+	v := thread.Raw
+	if len(variant) > 0 {
+		var err error
+		if v, err = thread.ParseVariant(variant[0]); err != nil {
+			return err
+		}
+	}
+	fmt.Println(thread.NewRandomID(v))
+	return nil
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "threads: %v\n", err)
+	os.Exit(1)
+}
@@ -101,6 +101,7 @@ func DefaultNetwork(repoPath string, opts ...NetOption) (NetBoostrapper, error)
 	api, err := net.NewNetwork(ctx, h, lite.BlockStore(), lite, tstore, net.Config{
 		Debug:  config.Debug,
 		PubSub: config.PubSub,
+		Queue:  litestore,
 	}, config.GRPCServerOptions, config.GRPCDialOptions)
 	if err != nil {
 		return nil, fin.Cleanup(err)
@@ -108,6 +108,10 @@ type Net interface {
 	// If token is present and was issued the net host (is valid), the embedded public key is returned.
 	// If token is not present, both the returned public key and error will be nil.
 	Validate(id thread.ID, token thread.Token, readOnly bool) (thread.PubKey, error)
+
+	// QueueDepth returns the number of records of the thread still to be
+	// pushed to peers that were unreachable.
+	QueueDepth(id thread.ID) (int, error)
 }
 
 // Connector connects an app to a thread.
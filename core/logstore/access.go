@@ -0,0 +1,54 @@
+package logstore
+
+import (
+	"fmt"
+
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// MetaThreadAccess namespaces roles of identities in the thread metadata.
+const MetaThreadAccess = "_access"
+
+// ErrInvalidRole indicates an attempt to grant an unknown role.
+var ErrInvalidRole = fmt.Errorf("invalid role")
+
+// Role is the access level of an identity to a thread. Higher roles include
+// the permissions of lower ones.
+type Role int
+
+const (
+	// NoRole denies any access to the thread.
+	NoRole Role = iota
+	// Reader may follow the thread and pull its records.
+	Reader
+	// Writer may additionally add logs and push records to the thread.
+	Writer
+	// Owner may additionally manage roles of other identities.
+	Owner
+)
+
+func (r Role) String() string {
+	switch r {
+	case NoRole:
+		return "NoRole"
+	case Reader:
+		return "Reader"
+	case Writer:
+		return "Writer"
+	case Owner:
+		return "Owner"
+	default:
+		return "Unknown"
+	}
+}
+
+// Valid returns whether the role is known.
+func (r Role) Valid() bool {
+	return r >= NoRole && r <= Owner
+}
+
+// Member is an identity having a role in a thread.
+type Member struct {
+	Identity thread.PubKey
+	Role     Role
+}
@@ -0,0 +1,6 @@
+package logstore
+
+// MetaThreadArchived holds the time a thread was archived with Archive in
+// unix nanoseconds. It's the stub kept in the thread metadata in place of
+// the thread.
+const MetaThreadArchived = "_archived"
@@ -0,0 +1,27 @@
+package logstore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// ErrInvalidCapability indicates a malformed capability token or one not
+// signed by a log of its thread.
+var ErrInvalidCapability = errors.New("invalid capability")
+
+// ErrCapabilityExpired indicates a capability token used after its expiration.
+var ErrCapabilityExpired = errors.New("capability expired")
+
+// Capability delegates a role in a thread to a peer until expiration. It is
+// issued by a log of the thread and signed with the log's private key, so
+// that peers can be invited without sharing the thread keys.
+type Capability struct {
+	Thread  thread.ID
+	Issuer  thread.LogID
+	Subject peer.ID
+	Role    Role
+	Expires time.Time
+}
@@ -0,0 +1,40 @@
+package logstore
+
+import (
+	"context"
+
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// ContextLogstore is a Logstore with variants of thread and log operations
+// honoring cancellation and deadlines of the given context.
+type ContextLogstore interface {
+	Logstore
+
+	// WithContext returns a view of the logstore whose operations,
+	// including the ones of the key, address, head and metadata books,
+	// honor cancellation and deadlines of ctx. The view shares the state of
+	// the logstore, closing it closes the logstore.
+	WithContext(ctx context.Context) Logstore
+
+	// ThreadsContext returns all threads in the store.
+	ThreadsContext(context.Context) (thread.IDSlice, error)
+
+	// AddThreadContext adds a thread.
+	AddThreadContext(context.Context, thread.Info) error
+
+	// GetThreadContext returns info about a thread.
+	GetThreadContext(context.Context, thread.ID) (thread.Info, error)
+
+	// DeleteThreadContext deletes a thread.
+	DeleteThreadContext(context.Context, thread.ID) error
+
+	// AddLogContext adds a log to a thread.
+	AddLogContext(context.Context, thread.ID, thread.LogInfo) error
+
+	// GetLogContext returns info about a log.
+	GetLogContext(context.Context, thread.ID, thread.LogID) (thread.LogInfo, error)
+
+	// DeleteLogContext deletes a log.
+	DeleteLogContext(context.Context, thread.ID, thread.LogID) error
+}
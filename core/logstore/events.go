@@ -0,0 +1,73 @@
+package logstore
+
+import (
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// EventType is the kind of change happened to a thread.
+type EventType int
+
+const (
+	// LogAdded is emitted when a log is added to a thread.
+	LogAdded EventType = iota
+	// AddrAdded is emitted when log addresses are added or set.
+	AddrAdded
+	// HeadUpdated is emitted when log heads are added or set.
+	HeadUpdated
+	// MetaChanged is emitted when thread metadata is stored.
+	MetaChanged
+	// ThreadDeleted is emitted when a thread is deleted.
+	ThreadDeleted
+	// ThreadCreated is emitted when a new thread is created, added or imported.
+	ThreadCreated
+	// LogDeleted is emitted when a log is deleted from a thread.
+	LogDeleted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case LogAdded:
+		return "LogAdded"
+	case AddrAdded:
+		return "AddrAdded"
+	case HeadUpdated:
+		return "HeadUpdated"
+	case MetaChanged:
+		return "MetaChanged"
+	case ThreadDeleted:
+		return "ThreadDeleted"
+	case ThreadCreated:
+		return "ThreadCreated"
+	case LogDeleted:
+		return "LogDeleted"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event describes a change in a thread.
+type Event struct {
+	Type   EventType
+	Thread thread.ID
+	// Log is set for log-level events.
+	Log thread.LogID
+	// Key is set for MetaChanged events.
+	Key string
+}
+
+// Hook receives changes of a logstore once they are stored, e.g. to mirror
+// them into another database. Unlike subscriptions, hooks don't miss
+// changes. Handlers left nil are skipped.
+type Hook struct {
+	// OnPut is called when a thread is created, or logs, addresses, heads
+	// or metadata of a thread are stored.
+	OnPut func(Event)
+
+	// OnDelete is called when a thread or a log is deleted.
+	OnDelete func(Event)
+
+	// Async calls handlers in order of the changes on a goroutine of the
+	// hook, instead of blocking the write until they return. Changes are
+	// queued meanwhile. Synchronous handlers must not use the logstore.
+	Async bool
+}
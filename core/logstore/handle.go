@@ -0,0 +1,79 @@
+package logstore
+
+import (
+	"sync"
+
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// ThreadHandle refers to a thread of a store without loading it, e.g. to
+// enumerate threads of huge stores. Keys and logs are read from the store
+// on first access and kept afterwards.
+type ThreadHandle struct {
+	ID thread.ID
+
+	ls   Logstore
+	lock sync.Mutex
+	key  *thread.Key
+	info *thread.Info
+}
+
+// NewThreadHandle returns a handle of the thread loading it from the store.
+func NewThreadHandle(ls Logstore, id thread.ID) *ThreadHandle {
+	return &ThreadHandle{ID: id, ls: ls}
+}
+
+// Key returns keys of the thread without loading its logs.
+func (h *ThreadHandle) Key() (thread.Key, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.key != nil {
+		return *h.key, nil
+	}
+	sk, err := h.ls.ServiceKey(h.ID)
+	if err != nil {
+		return thread.Key{}, err
+	}
+	if sk == nil {
+		return thread.Key{}, ErrThreadNotFound
+	}
+	rk, err := h.ls.ReadKey(h.ID)
+	if err != nil {
+		return thread.Key{}, err
+	}
+	key := thread.NewKey(sk, rk)
+	h.key = &key
+	return key, nil
+}
+
+// Info returns info about the thread, loading its logs.
+func (h *ThreadHandle) Info() (thread.Info, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.info != nil {
+		return *h.info, nil
+	}
+	info, err := h.ls.GetThread(h.ID)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	h.info, h.key = &info, &info.Key
+	return info, nil
+}
+
+// Loaded reports whether info about the thread was loaded.
+func (h *ThreadHandle) Loaded() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.info != nil
+}
+
+// Reset drops loaded keys and logs, so that they're read from the store
+// again on next access.
+func (h *ThreadHandle) Reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.key, h.info = nil, nil
+}
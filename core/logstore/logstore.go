@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/textileio/go-threads/core/thread"
 	sym "github.com/textileio/go-threads/crypto/symmetric"
@@ -29,11 +32,62 @@ var ErrLogExists = fmt.Errorf("log already exists")
 // ErrEmptyDump indicates an attempt to restore from empty dump.
 var ErrEmptyDump = errors.New("empty dump")
 
+// ErrNotSupported indicates an operation is not supported by the store.
+var ErrNotSupported = errors.New("operation not supported")
+
+// ErrThreadNameTaken indicates a thread name is already used by another thread.
+var ErrThreadNameTaken = errors.New("thread name already taken")
+
+// ErrReservedKey indicates a write of a metadata key reserved for the
+// logstore, see IsReservedKey.
+var ErrReservedKey = errors.New("metadata key is reserved")
+
+// ErrTxnReadOnly indicates a write attempt within a read-only transaction.
+var ErrTxnReadOnly = errors.New("transaction is read-only")
+
+// ErrClosed indicates use of a closed logstore.
+var ErrClosed = errors.New("logstore is closed")
+
+// ErrReadOnly indicates a write attempt through a read-only view of a store.
+var ErrReadOnly = errors.New("logstore is read-only")
+
+// ErrInvalidThreadID indicates a malformed thread ID.
+var ErrInvalidThreadID = errors.New("invalid thread ID")
+
+// ErrInvalidLogID indicates a malformed log ID.
+var ErrInvalidLogID = errors.New("invalid log ID")
+
+// ErrInvalidAddr indicates a malformed log address.
+var ErrInvalidAddr = errors.New("invalid address")
+
+// ErrInvalidKey indicates a malformed key, or one not matching its log.
+var ErrInvalidKey = errors.New("invalid key")
+
+// ErrInvalidHead indicates an undefined head.
+var ErrInvalidHead = errors.New("invalid head")
+
+// ErrInvalidMetaKey indicates an empty metadata key.
+var ErrInvalidMetaKey = errors.New("invalid metadata key")
+
+// ErrInvalidTTL indicates a non-positive TTL of a metadata value.
+var ErrInvalidTTL = errors.New("invalid TTL")
+
+// ErrTxnDone indicates use of a committed or rolled back transaction.
+var ErrTxnDone = errors.New("transaction is already done")
+
+// ErrLogRevoked indicates the public key of a log was revoked.
+var ErrLogRevoked = errors.New("log key is revoked")
+
 // Logstore stores log keys, addresses, heads and thread meta data.
+// Optional capabilities, e.g. NameBook or Inviter, are looked up with
+// helpers like Names.
 type Logstore interface {
+	// Close closes streams and subscriptions of the store and releases its
+	// resources. Subsequent operations fail with ErrClosed.
 	Close() error
 
 	ThreadMetadata
+	LogMetadata
 	KeyBook
 	AddrBook
 	HeadBook
@@ -41,12 +95,45 @@ type Logstore interface {
 	// Threads returns all threads in the store.
 	Threads() (thread.IDSlice, error)
 
+	// ThreadsPaged returns at most limit threads in ID order, skipping
+	// the first offset ones. A zero limit means no limit.
+	ThreadsPaged(offset, limit int) (thread.IDSlice, error)
+
+	// ThreadsFilter returns threads accepted by the filter. The filter may
+	// be called more than once with the same thread.
+	ThreadsFilter(filter func(thread.ID) bool) (thread.IDSlice, error)
+
+	// LogsToThreads returns threads the log writes to, i.e. the ones
+	// having keys or addresses of the log.
+	LogsToThreads(thread.LogID) (thread.IDSlice, error)
+
+	// ReplaceAddr replaces the address in all logs having it with a new
+	// one valid for the ttl, e.g. when a peer changes its address, and
+	// returns the updated logs.
+	ReplaceAddr(old, repl ma.Multiaddr, ttl time.Duration) ([]ThreadLog, error)
+
+	// CreateThread explicitly registers a thread, recording its creation
+	// time and options. Returns ErrThreadExists if the thread is present.
+	CreateThread(thread.ID, ...ThreadOption) error
+
 	// AddThread adds a thread.
 	AddThread(thread.Info) error
 
 	// GetThread returns info about a thread.
 	GetThread(thread.ID) (thread.Info, error)
 
+	// GetThreadFull returns info about a thread along with all log heads
+	// and thread metadata.
+	GetThreadFull(thread.ID) (ThreadInfoFull, error)
+
+	// GetThreadHandle returns a handle of a thread without loading its
+	// keys and logs.
+	GetThreadHandle(thread.ID) (*ThreadHandle, error)
+
+	// ThreadHandles returns handles of all threads in the store, without
+	// loading their keys and logs.
+	ThreadHandles() ([]*ThreadHandle, error)
+
 	// DeleteThread deletes a thread.
 	DeleteThread(thread.ID) error
 
@@ -54,13 +141,197 @@ type Logstore interface {
 	AddLog(thread.ID, thread.LogInfo) error
 
 	// GetLog returns info about a log.
-	GetLog(thread.ID, peer.ID) (thread.LogInfo, error)
+	GetLog(thread.ID, thread.LogID) (thread.LogInfo, error)
 
 	// GetManagedLogs returns info about locally managed logs.
 	GetManagedLogs(thread.ID) ([]thread.LogInfo, error)
 
+	// LogsForPeer returns logs of the thread owned by the peer, as set by
+	// LogInfo.Peer when adding them.
+	LogsForPeer(thread.ID, peer.ID) (thread.LogIDSlice, error)
+
 	// DeleteLog deletes a log.
-	DeleteLog(thread.ID, peer.ID) error
+	DeleteLog(thread.ID, thread.LogID) error
+
+	// ThreadDiskUsage returns the approximate number of bytes a thread
+	// occupies on disk. Stores not backed by a datastore may return
+	// ErrNotSupported.
+	ThreadDiskUsage(thread.ID) (int64, error)
+
+	// Stats returns counts of entries per thread and across the store.
+	Stats() (Stats, error)
+
+	// ExportThread serializes the full state of a thread into a portable blob.
+	ExportThread(thread.ID) ([]byte, error)
+
+	// ImportThread restores a thread from a blob created by ExportThread.
+	// Returns ErrThreadExists if the thread is present.
+	ImportThread([]byte) error
+
+	// ExportKeys packs all keys of a thread into a bundle encrypted with
+	// the passphrase.
+	ExportKeys(thread.ID, string) ([]byte, error)
+
+	// ImportKeys adds keys from a bundle created by ExportKeys.
+	ImportKeys([]byte, string) error
+
+	// IssueCapability signs a token granting the subject a role in the thread
+	// until the TTL passes, using the private key of the issuing log.
+	IssueCapability(t thread.ID, issuer thread.LogID, subject peer.ID, role Role, ttl time.Duration) ([]byte, error)
+
+	// VerifyCapability returns the capability of a token issued by a
+	// non-revoked log known to the keybook. Expired tokens are rejected
+	// with ErrCapabilityExpired.
+	VerifyCapability([]byte) (Capability, error)
+
+	// DumpCanonical writes contents of the entire store as sorted text, so
+	// that stores can be diffed to debug divergence.
+	DumpCanonical(io.Writer) error
+
+	// ArchiveThread moves the full state of a thread into a cold datastore
+	// and removes it from the store. Pinned threads are rejected with
+	// ErrThreadPinned.
+	ArchiveThread(thread.ID, ds.Datastore) error
+
+	// UnarchiveThread restores a thread previously moved into a cold
+	// datastore and removes it from there.
+	UnarchiveThread(thread.ID, ds.Datastore) error
+
+	// ArchivedThreads returns all threads archived in a cold datastore.
+	ArchivedThreads(ds.Datastore) (thread.IDSlice, error)
+
+	// Archive writes the full state of a thread into w as a compressed blob
+	// and removes it from the store, keeping only a stub recording when it
+	// was archived. Pinned threads are rejected with ErrThreadPinned.
+	Archive(thread.ID, io.Writer) error
+
+	// Unarchive restores a thread from a blob written by Archive, dropping
+	// its stub, and returns its ID.
+	Unarchive(io.Reader) (thread.ID, error)
+
+	// IsArchived reports whether a thread was archived with Archive and not
+	// restored since.
+	IsArchived(thread.ID) (bool, error)
+
+	// Batch returns a writer for committing multiple writes at once.
+	Batch() Batch
+
+	// Subscribe returns a channel that delivers changes of a thread.
+	Subscribe(context.Context, thread.ID) (<-chan Event, error)
+
+	// Events returns a channel that delivers creation and deletion of
+	// threads across the store.
+	Events(context.Context) <-chan Event
+
+	// RegisterHook calls the hook with subsequent changes until the
+	// returned function is called or the logstore is closed.
+	RegisterHook(Hook) (unregister func())
+}
+
+// Inviter shares threads with other peers through invites.
+type Inviter interface {
+	// CreateInvite packs what a peer needs to follow a thread, i.e. its
+	// service key and log addresses, into an invite. The read key is
+	// included only if requested. A non-empty password encrypts the invite.
+	CreateInvite(t thread.ID, withReadKey bool, password string) ([]byte, error)
+
+	// AcceptInvite adds the thread and its logs from an invite created by
+	// CreateInvite. Either the whole invite is applied or the thread is
+	// left as it was.
+	AcceptInvite(invite []byte, password string) (thread.Info, error)
+}
+
+// Snapshotter backs up and restores the entire store.
+type Snapshotter interface {
+	// Snapshot writes contents of the entire store in a versioned format.
+	Snapshot(io.Writer) error
+
+	// Restore imports all threads from a snapshot.
+	Restore(io.Reader) error
+}
+
+// Transactor runs transactions over the store.
+type Transactor interface {
+	// BeginTxn starts a transaction. Other thread reads and writes are
+	// blocked until the transaction is committed or rolled back. Writes
+	// are buffered until commit, which applies all or none of them, and
+	// their events are only delivered on commit. Reads of the books, e.g.
+	// Addrs or Heads, aren't blocked and may observe a commit in progress.
+	BeginTxn(readonly bool) (Txn, error)
+}
+
+// Batch accumulates logstore writes until they are committed.
+type Batch interface {
+	// AddThread adds a thread along with its logs.
+	AddThread(thread.Info)
+
+	// AddLog adds a log to a thread.
+	AddLog(thread.ID, thread.LogInfo)
+
+	// PutInt64 stores an int value under key.
+	PutInt64(t thread.ID, key string, val int64)
+
+	// PutString stores a string value under key.
+	PutString(t thread.ID, key string, val string)
+
+	// PutBool stores a boolean value under key.
+	PutBool(t thread.ID, key string, val bool)
+
+	// PutBytes stores a byte value under key.
+	PutBytes(t thread.ID, key string, val []byte)
+
+	// Commit applies all accumulated writes. If any of them fails, threads
+	// and logs created by the batch are removed again.
+	Commit() error
+}
+
+// Txn is a view over the logstore, isolating its changes until committed.
+type Txn interface {
+	// Threads returns all threads in the store.
+	Threads() (thread.IDSlice, error)
+
+	// GetThread returns info about a thread.
+	GetThread(thread.ID) (thread.Info, error)
+
+	// GetLog returns info about a log.
+	GetLog(thread.ID, thread.LogID) (thread.LogInfo, error)
+
+	// AddThread adds a thread.
+	AddThread(thread.Info) error
+
+	// AddLog adds a log to a thread.
+	AddLog(thread.ID, thread.LogInfo) error
+
+	// DeleteThread deletes a thread.
+	DeleteThread(thread.ID) error
+
+	// ImportThread restores a thread from a blob created by ExportThread.
+	ImportThread([]byte) error
+
+	// AddAddrs gives the store addresses for a log, with a given TTL.
+	AddAddrs(thread.ID, thread.LogID, []ma.Multiaddr, time.Duration) error
+
+	// SetHeads sets a list of heads for a log.
+	SetHeads(thread.ID, thread.LogID, []cid.Cid) error
+
+	// PutInt64 stores an int value under key.
+	PutInt64(t thread.ID, key string, val int64) error
+
+	// PutString stores a string value under key.
+	PutString(t thread.ID, key string, val string) error
+
+	// PutBool stores a boolean value under key.
+	PutBool(t thread.ID, key string, val bool) error
+
+	// PutBytes stores a byte value under key.
+	PutBytes(t thread.ID, key string, val []byte) error
+
+	// Commit ends the transaction applying its writes. If one of them
+	// fails, the changed threads are reverted and the error is returned.
+	Commit() error
+
+	// Rollback ends the transaction discarding its writes.
+	Rollback() error
 }
 
 // ThreadMetadata stores local thread metadata like name.
@@ -89,6 +360,20 @@ type ThreadMetadata interface {
 	// PutBytes stores a byte value under key.
 	PutBytes(t thread.ID, key string, val []byte) error
 
+	// PutMetaWithTTL stores an int64, string, bool or byte value under key,
+	// which expires after the given TTL. Storing the key again without a
+	// TTL makes it permanent. A non-positive TTL results in ErrInvalidTTL.
+	PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error
+
+	// MetaKeys returns sorted keys of all metadata under a thread.
+	MetaKeys(t thread.ID) ([]string, error)
+
+	// DeleteMetaPrefix deletes a key along with all keys namespaced under
+	// it, i.e. "app/ui" removes "app/ui/theme", but keeps "app/uix".
+	// Prefixes of every key, e.g. "" or "/", fail with ErrInvalidMetaKey,
+	// use ClearMetadata instead.
+	DeleteMetaPrefix(t thread.ID, prefix string) error
+
 	// ClearMetadata clears all metadata under a thread.
 	ClearMetadata(t thread.ID) error
 
@@ -99,19 +384,87 @@ type ThreadMetadata interface {
 	RestoreMeta(book DumpMetadata) error
 }
 
-// KeyBook stores log keys.
+// NameBook maps unique human-readable names to threads.
+type NameBook interface {
+	// SetThreadName names a thread. An empty name unnames the thread.
+	// Names used by other threads are rejected with ErrThreadNameTaken.
+	SetThreadName(thread.ID, string) error
+
+	// ThreadByName returns the thread having the name.
+	ThreadByName(string) (thread.ID, error)
+
+	// ThreadNames returns all named threads by name.
+	ThreadNames() (map[string]thread.ID, error)
+}
+
+// AccessBook stores roles of identities in threads, so that services can
+// decide who may follow a thread, add logs or push records to it.
+type AccessBook interface {
+	// SetRole grants the role to the identity. NoRole revokes its access.
+	SetRole(thread.ID, thread.PubKey, Role) error
+
+	// Role returns the role of the identity, NoRole if it has none.
+	Role(thread.ID, thread.PubKey) (Role, error)
+
+	// HasRole returns whether the identity has at least the given role.
+	HasRole(thread.ID, thread.PubKey, Role) (bool, error)
+
+	// Members returns identities having a role in the thread.
+	Members(thread.ID) ([]Member, error)
+}
+
+// LogMetadata stores local log metadata like display name.
+type LogMetadata interface {
+	// GetLogInt64 retrieves an int value under log's key.
+	GetLogInt64(t thread.ID, l thread.LogID, key string) (*int64, error)
+
+	// PutLogInt64 stores an int value under log's key.
+	PutLogInt64(t thread.ID, l thread.LogID, key string, val int64) error
+
+	// GetLogString retrieves a string value under log's key.
+	GetLogString(t thread.ID, l thread.LogID, key string) (*string, error)
+
+	// PutLogString stores a string value under log's key.
+	PutLogString(t thread.ID, l thread.LogID, key string, val string) error
+
+	// GetLogBool retrieves a boolean value under log's key.
+	GetLogBool(t thread.ID, l thread.LogID, key string) (*bool, error)
+
+	// PutLogBool stores a boolean value under log's key.
+	PutLogBool(t thread.ID, l thread.LogID, key string, val bool) error
+
+	// GetLogBytes retrieves a byte value under log's key.
+	GetLogBytes(t thread.ID, l thread.LogID, key string) (*[]byte, error)
+
+	// PutLogBytes stores a byte value under log's key.
+	PutLogBytes(t thread.ID, l thread.LogID, key string, val []byte) error
+}
+
+// KeyBook stores log keys. Read and service keys are scoped to a thread,
+// while public and private keys belong to a log of a thread.
 type KeyBook interface {
 	// PubKey retrieves the public key of a log.
-	PubKey(thread.ID, peer.ID) (crypto.PubKey, error)
+	PubKey(thread.ID, thread.LogID) (crypto.PubKey, error)
 
 	// AddPubKey adds a public key under a log.
-	AddPubKey(thread.ID, peer.ID, crypto.PubKey) error
+	AddPubKey(thread.ID, thread.LogID, crypto.PubKey) error
+
+	// RevokePubKey flags the public key of a log as compromised. The key is
+	// kept to verify existing records.
+	RevokePubKey(thread.ID, thread.LogID) error
+
+	// IsRevoked returns whether the public key of a log was revoked.
+	IsRevoked(thread.ID, thread.LogID) (bool, error)
 
 	// PrivKey retrieves the private key of a log.
-	PrivKey(thread.ID, peer.ID) (crypto.PrivKey, error)
+	PrivKey(thread.ID, thread.LogID) (crypto.PrivKey, error)
 
 	// AddPrivKey adds a private key under a log.
-	AddPrivKey(thread.ID, peer.ID, crypto.PrivKey) error
+	AddPrivKey(thread.ID, thread.LogID, crypto.PrivKey) error
+
+	// HasPrivKey returns whether a log has a private key, without
+	// retrieving it.
+	HasPrivKey(thread.ID, thread.LogID) (bool, error)
 
 	// ReadKey retrieves the read key of a thread.
 	ReadKey(thread.ID) (*sym.Key, error)
@@ -119,24 +472,55 @@ type KeyBook interface {
 	// AddReadKey adds a read key under a thread.
 	AddReadKey(thread.ID, *sym.Key) error
 
+	// HasReadKey returns whether a thread has a read key, without
+	// retrieving it.
+	HasReadKey(thread.ID) (bool, error)
+
 	// ServiceKey retrieves the service key of a thread.
 	ServiceKey(thread.ID) (*sym.Key, error)
 
 	// AddServiceKey adds a service key under a thread.
 	AddServiceKey(thread.ID, *sym.Key) error
 
+	// HasServiceKey returns whether a thread has a service key, without
+	// retrieving it.
+	HasServiceKey(thread.ID) (bool, error)
+
+	// RotateReadKey replaces the read key of a thread, retaining the previous
+	// one. The version of the new key is returned.
+	RotateReadKey(thread.ID, *sym.Key) (int, error)
+
+	// ReadKeyVersion retrieves a read key of a thread by version.
+	ReadKeyVersion(thread.ID, int) (*sym.Key, error)
+
+	// ReadKeyVersions retrieves all read keys of a thread ordered by version.
+	ReadKeyVersions(thread.ID) ([]KeyVersion, error)
+
+	// RotateServiceKey replaces the service key of a thread, retaining the
+	// previous one. The version of the new key is returned.
+	RotateServiceKey(thread.ID, *sym.Key) (int, error)
+
+	// ServiceKeyVersion retrieves a service key of a thread by version.
+	ServiceKeyVersion(thread.ID, int) (*sym.Key, error)
+
+	// ServiceKeyVersions retrieves all service keys of a thread ordered by version.
+	ServiceKeyVersions(thread.ID) ([]KeyVersion, error)
+
 	// ClearKeys deletes all keys under a thread.
 	ClearKeys(thread.ID) error
 
 	// ClearLogKeys deletes all keys under a log.
-	ClearLogKeys(thread.ID, peer.ID) error
+	ClearLogKeys(thread.ID, thread.LogID) error
 
 	// LogsWithKeys returns a list of log IDs for a service.
-	LogsWithKeys(thread.ID) (peer.IDSlice, error)
+	LogsWithKeys(thread.ID) (thread.LogIDSlice, error)
 
 	// ThreadsFromKeys returns a list of threads referenced in the book.
 	ThreadsFromKeys() (thread.IDSlice, error)
 
+	// ThreadsWithLogKeys returns threads having keys of the log.
+	ThreadsWithLogKeys(thread.LogID) (thread.IDSlice, error)
+
 	// DumpKeys packs all stored keys.
 	DumpKeys() (DumpKeyBook, error)
 
@@ -144,38 +528,115 @@ type KeyBook interface {
 	RestoreKeys(book DumpKeyBook) error
 }
 
+// KeyVersion is a version of a rotated thread key.
+type KeyVersion struct {
+	Version int
+	Key     *sym.Key
+	// Created is the time the key was stored, or zero if unknown.
+	Created time.Time
+}
+
+// KeyStorage persists log private keys outside of the keybook, e.g. in an
+// OS keychain, an HSM or a remote KMS.
+type KeyStorage interface {
+	// GetPrivKey retrieves the private key of a log, or nil if there is none.
+	GetPrivKey(thread.ID, thread.LogID) (crypto.PrivKey, error)
+
+	// PutPrivKey stores the private key of a log.
+	PutPrivKey(thread.ID, thread.LogID, crypto.PrivKey) error
+
+	// DeletePrivKey deletes the private key of a log.
+	DeletePrivKey(thread.ID, thread.LogID) error
+
+	// ListPrivKeys returns logs with a stored private key by thread.
+	ListPrivKeys() (map[thread.ID]thread.LogIDSlice, error)
+}
+
 // AddrBook stores log addresses.
 type AddrBook interface {
 	// AddAddr adds an address under a log with a given TTL.
-	AddAddr(thread.ID, peer.ID, ma.Multiaddr, time.Duration) error
+	AddAddr(thread.ID, thread.LogID, ma.Multiaddr, time.Duration) error
 
 	// AddAddrs adds addresses under a log with a given TTL.
-	AddAddrs(thread.ID, peer.ID, []ma.Multiaddr, time.Duration) error
+	AddAddrs(thread.ID, thread.LogID, []ma.Multiaddr, time.Duration) error
 
 	// SetAddr sets a log's address with a given TTL.
-	SetAddr(thread.ID, peer.ID, ma.Multiaddr, time.Duration) error
+	SetAddr(thread.ID, thread.LogID, ma.Multiaddr, time.Duration) error
 
 	// SetAddrs sets a log's addresses with a given TTL.
-	SetAddrs(thread.ID, peer.ID, []ma.Multiaddr, time.Duration) error
-
-	// UpdateAddrs updates the TTL of a log address.
-	UpdateAddrs(t thread.ID, id peer.ID, oldTTL time.Duration, newTTL time.Duration) error
+	SetAddrs(thread.ID, thread.LogID, []ma.Multiaddr, time.Duration) error
+
+	// AddAddrsFromSource works like AddAddrs, but also records where the
+	// addresses were learned from. Re-adding a known address with
+	// AddrSourceUnknown keeps its recorded source.
+	AddAddrsFromSource(thread.ID, thread.LogID, []ma.Multiaddr, time.Duration, AddrSource) error
+
+	// AddLogAddrsBulk adds addresses of logs of many threads with a given
+	// TTL at once, e.g. when importing announces of a peer.
+	AddLogAddrsBulk([]ThreadLogAddrs, time.Duration) error
+
+	// ConsumeLogRecord replaces addresses of a log with the ones of a signed
+	// peer record, expiring after the given TTL. Records not newer than the
+	// stored one are ignored and reported as not accepted. The record stays
+	// valid as long as any of its addresses, during which addresses added
+	// without a record are ignored and SetAddrs only updates certified ones.
+	ConsumeLogRecord(thread.ID, *record.Envelope, time.Duration) (accepted bool, err error)
+
+	// LogRecord returns the signed peer record of a log, or nil if the log
+	// has no valid certified record.
+	LogRecord(thread.ID, thread.LogID) (*record.Envelope, error)
+
+	// RecordDial records a successful dial of a log address along with the
+	// measured round-trip time. Unknown addresses are ignored.
+	RecordDial(thread.ID, thread.LogID, ma.Multiaddr, time.Duration) error
+
+	// UpdateAddrs sets the TTL of log addresses stored with oldTTL to newTTL,
+	// restarting their expiration, like the libp2p peerstore does. Connection
+	// managers may use it to extend addresses of active connections, and a
+	// non-positive newTTL expires the addresses.
+	UpdateAddrs(t thread.ID, id thread.LogID, oldTTL time.Duration, newTTL time.Duration) error
 
 	// Addrs returns all addresses for a log.
-	Addrs(thread.ID, peer.ID) ([]ma.Multiaddr, error)
+	Addrs(thread.ID, thread.LogID) ([]ma.Multiaddr, error)
+
+	// ForEachLogAddr calls fn with each address of a log until it returns
+	// false, without copying them. fn must not call into the book.
+	ForEachLogAddr(t thread.ID, id thread.LogID, fn func(ma.Multiaddr) bool) error
+
+	// AddrsWithSource returns all addresses for a log along with their
+	// expiration, source and dial quality.
+	AddrsWithSource(thread.ID, thread.LogID) ([]ExpiredAddress, error)
+
+	// SortedAddrs returns all addresses for a log, best first as ordered by
+	// SortAddrs.
+	SortedAddrs(thread.ID, thread.LogID) ([]ma.Multiaddr, error)
 
 	// AddrStream returns a channel that delivers address changes for a log.
-	AddrStream(context.Context, thread.ID, peer.ID) (<-chan ma.Multiaddr, error)
+	AddrStream(context.Context, thread.ID, thread.LogID) (<-chan ma.Multiaddr, error)
 
-	// ClearAddrs deletes all addresses for a log.
-	ClearAddrs(thread.ID, peer.ID) error
+	// ControlledAddrStream works like AddrStream, but also returns a handle
+	// able to pause and resume delivery without cancelling the subscription.
+	ControlledAddrStream(context.Context, thread.ID, thread.LogID) (<-chan ma.Multiaddr, AddrStreamControl, error)
+
+	// ThreadAddrStream returns a channel that delivers address changes for
+	// all logs of a thread.
+	ThreadAddrStream(context.Context, thread.ID) (<-chan LogAddr, error)
+
+	// ClearAddrs deletes all addresses for a log, along with its signed record.
+	ClearAddrs(thread.ID, thread.LogID) error
 
 	// LogsWithAddrs returns a list of log IDs for a thread.
-	LogsWithAddrs(thread.ID) (peer.IDSlice, error)
+	LogsWithAddrs(thread.ID) (thread.LogIDSlice, error)
 
 	// ThreadsFromAddrs returns a list of threads referenced in the book.
 	ThreadsFromAddrs() (thread.IDSlice, error)
 
+	// ThreadsWithLogAddrs returns threads having addresses of the log.
+	ThreadsWithLogAddrs(thread.LogID) (thread.IDSlice, error)
+
+	// LogsWithAddr returns logs of all threads having the address.
+	LogsWithAddr(ma.Multiaddr) ([]ThreadLog, error)
+
 	// DumpHeads packs all stored addresses.
 	DumpAddrs() (DumpAddrBook, error)
 
@@ -183,25 +644,72 @@ type AddrBook interface {
 	RestoreAddrs(book DumpAddrBook) error
 }
 
+// LogAddr is an address of a log.
+type LogAddr struct {
+	Log  thread.LogID
+	Addr ma.Multiaddr
+}
+
+// ThreadLog refers to a log of a thread.
+type ThreadLog struct {
+	Thread thread.ID
+	Log    thread.LogID
+}
+
+// ThreadLogAddrs holds addresses of a log of a thread.
+type ThreadLogAddrs struct {
+	Thread thread.ID
+	Log    thread.LogID
+	Addrs  []ma.Multiaddr
+}
+
+// AddrSource describes where a log address was learned from.
+type AddrSource string
+
+const (
+	// AddrSourceUnknown is used for addresses added without a source.
+	AddrSourceUnknown AddrSource = ""
+	// AddrSourceManual is used for addresses added explicitly by the user.
+	AddrSourceManual AddrSource = "manual"
+	// AddrSourceDHT is used for addresses found in the DHT.
+	AddrSourceDHT AddrSource = "dht"
+	// AddrSourcePubsub is used for addresses gossiped over pubsub.
+	AddrSourcePubsub AddrSource = "pubsub"
+	// AddrSourceDial is used for addresses received from a directly dialed peer.
+	AddrSourceDial AddrSource = "dial"
+	// AddrSourceMDNS is used for addresses of peers found on the local network.
+	AddrSourceMDNS AddrSource = "mdns"
+)
+
+// AddrStreamControl controls delivery of an address stream.
+type AddrStreamControl interface {
+	// Pause stops delivering addresses. Addresses arriving while paused
+	// are queued, up to an implementation defined limit.
+	Pause()
+
+	// Resume delivers queued addresses in order and continues streaming.
+	Resume()
+}
+
 // HeadBook stores log heads.
 type HeadBook interface {
 	// AddHead stores cid in a log's head.
-	AddHead(thread.ID, peer.ID, cid.Cid) error
+	AddHead(thread.ID, thread.LogID, cid.Cid) error
 
 	// AddHeads stores cids in a log's head.
-	AddHeads(thread.ID, peer.ID, []cid.Cid) error
+	AddHeads(thread.ID, thread.LogID, []cid.Cid) error
 
 	// SetHead sets a log's head as cid.
-	SetHead(thread.ID, peer.ID, cid.Cid) error
+	SetHead(thread.ID, thread.LogID, cid.Cid) error
 
 	// SetHeads sets a log's head as cids.
-	SetHeads(thread.ID, peer.ID, []cid.Cid) error
+	SetHeads(thread.ID, thread.LogID, []cid.Cid) error
 
 	// Heads retrieves head values for a log.
-	Heads(thread.ID, peer.ID) ([]cid.Cid, error)
+	Heads(thread.ID, thread.LogID) ([]cid.Cid, error)
 
 	// ClearHeads deletes the head entry for a log.
-	ClearHeads(thread.ID, peer.ID) error
+	ClearHeads(thread.ID, thread.LogID) error
 
 	// DumpHeads packs entire headbook into the tree.
 	DumpHeads() (DumpHeadBook, error)
@@ -210,26 +718,84 @@ type HeadBook interface {
 	RestoreHeads(DumpHeadBook) error
 }
 
+// ThreadStats holds counts of entries stored for a thread.
+type ThreadStats struct {
+	Logs  int
+	Addrs int
+	Keys  int
+	Meta  int
+	// Size is the approximate number of bytes on disk, zero for stores
+	// not backed by a datastore.
+	Size int64
+}
+
+// Stats holds counts of entries stored in a logstore.
+type Stats struct {
+	// Threads is the number of threads.
+	Threads int
+	// Total sums up stats of all threads.
+	Total ThreadStats
+	// PerThread holds stats of every thread.
+	PerThread map[thread.ID]ThreadStats
+}
+
+// ThreadInfoFull is a detailed view of a thread.
+type ThreadInfoFull struct {
+	thread.Info
+
+	// Heads holds all current heads of every log.
+	Heads map[thread.LogID][]cid.Cid
+
+	// Metadata holds all thread metadata.
+	Metadata MetadataValues
+}
+
+// MetadataValues holds typed metadata values by key.
+type MetadataValues struct {
+	Int64  map[string]int64
+	Bool   map[string]bool
+	String map[string]string
+	Bytes  map[string][]byte
+	// Expires holds expiration times of values stored with a TTL.
+	Expires map[string]time.Time
+}
+
 type (
 	DumpHeadBook struct {
-		Data map[thread.ID]map[peer.ID][]cid.Cid
+		Data map[thread.ID]map[thread.LogID][]cid.Cid
 	}
 
 	ExpiredAddress struct {
 		Addr    ma.Multiaddr
 		Expires time.Time
+		Source  AddrSource
+		// LastDial is the time of the last successful dial, zero if never dialed.
+		LastDial time.Time
+		// RTT is the round-trip time measured on the last successful dial.
+		RTT time.Duration
 	}
 
 	DumpAddrBook struct {
-		Data map[thread.ID]map[peer.ID][]ExpiredAddress
+		Data map[thread.ID]map[thread.LogID][]ExpiredAddress
+		// Records holds serialized signed records of logs with certified addresses.
+		Records map[thread.ID]map[thread.LogID][]byte
 	}
 
 	DumpKeyBook struct {
 		Data struct {
-			Public  map[thread.ID]map[peer.ID]crypto.PubKey
-			Private map[thread.ID]map[peer.ID]crypto.PrivKey
+			Public  map[thread.ID]map[thread.LogID]crypto.PubKey
+			Private map[thread.ID]map[thread.LogID]crypto.PrivKey
 			Read    map[thread.ID][]byte
 			Service map[thread.ID][]byte
+			// Previous keys of rotated read and service keys, ordered by version.
+			ReadHistory    map[thread.ID][][]byte
+			ServiceHistory map[thread.ID][][]byte
+			// Creation times of read and service key versions in unix
+			// nanoseconds, ordered by version. Zero if unknown.
+			ReadCreated    map[thread.ID][]int64
+			ServiceCreated map[thread.ID][]int64
+			// Logs with revoked public keys.
+			Revoked map[thread.ID]thread.LogIDSlice
 		}
 	}
 
@@ -245,5 +811,7 @@ type (
 			String map[MetadataKey]string
 			Bytes  map[MetadataKey][]byte
 		}
+		// Expires holds expiration times of values stored with a TTL.
+		Expires map[MetadataKey]time.Time
 	}
 )
@@ -0,0 +1,79 @@
+package logstore
+
+// Wrapper is implemented by logstores decorating another one. Optional
+// capabilities not implemented by a wrapper are looked up in the logstore
+// it wraps, so wrappers only implement the ones they change.
+type Wrapper interface {
+	// Unwrap returns the wrapped logstore.
+	Unwrap() Logstore
+}
+
+// Names returns the name book of the logstore, or ErrNotSupported.
+func Names(ls Logstore) (NameBook, error) {
+	s, err := lookup(ls, func(s Logstore) bool { _, ok := s.(NameBook); return ok })
+	if err != nil {
+		return nil, err
+	}
+	return s.(NameBook), nil
+}
+
+// Pins returns the pin book of the logstore, or ErrNotSupported.
+func Pins(ls Logstore) (PinBook, error) {
+	s, err := lookup(ls, func(s Logstore) bool { _, ok := s.(PinBook); return ok })
+	if err != nil {
+		return nil, err
+	}
+	return s.(PinBook), nil
+}
+
+// Access returns the access book of the logstore, or ErrNotSupported.
+func Access(ls Logstore) (AccessBook, error) {
+	s, err := lookup(ls, func(s Logstore) bool { _, ok := s.(AccessBook); return ok })
+	if err != nil {
+		return nil, err
+	}
+	return s.(AccessBook), nil
+}
+
+// Invites returns the inviter of the logstore, or ErrNotSupported.
+func Invites(ls Logstore) (Inviter, error) {
+	s, err := lookup(ls, func(s Logstore) bool { _, ok := s.(Inviter); return ok })
+	if err != nil {
+		return nil, err
+	}
+	return s.(Inviter), nil
+}
+
+// Snapshots returns the snapshotter of the logstore, or ErrNotSupported.
+func Snapshots(ls Logstore) (Snapshotter, error) {
+	s, err := lookup(ls, func(s Logstore) bool { _, ok := s.(Snapshotter); return ok })
+	if err != nil {
+		return nil, err
+	}
+	return s.(Snapshotter), nil
+}
+
+// Transactions returns the transactor of the logstore, or ErrNotSupported.
+func Transactions(ls Logstore) (Transactor, error) {
+	s, err := lookup(ls, func(s Logstore) bool { _, ok := s.(Transactor); return ok })
+	if err != nil {
+		return nil, err
+	}
+	return s.(Transactor), nil
+}
+
+// lookup returns the outermost logstore accepted by has, unwrapping
+// wrappers until one is found.
+func lookup(ls Logstore, has func(Logstore) bool) (Logstore, error) {
+	for ls != nil {
+		if has(ls) {
+			return ls, nil
+		}
+		w, ok := ls.(Wrapper)
+		if !ok {
+			break
+		}
+		ls = w.Unwrap()
+	}
+	return nil, ErrNotSupported
+}
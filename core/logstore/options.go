@@ -0,0 +1,68 @@
+package logstore
+
+import (
+	"path"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// MetaReservedPrefix starts metadata keys holding state of the logstore,
+// such as the keys below, which its metadata setters and deleters reject.
+const MetaReservedPrefix = "_"
+
+// IsReservedKey returns whether the metadata key is reserved for the
+// logstore.
+func IsReservedKey(key string) bool {
+	return strings.HasPrefix(key, MetaReservedPrefix)
+}
+
+// CleanMetaKey returns the metadata key the way books match it, i.e. with
+// dot segments resolved and without leading, trailing or repeated slashes.
+// Keys cleaning to "" address every key of a thread.
+func CleanMetaKey(key string) string {
+	return strings.Trim(path.Clean("/"+key), "/")
+}
+
+// Metadata keys reserved for explicitly created threads.
+const (
+	// MetaThreadCreated holds the thread creation time in unix nanoseconds.
+	MetaThreadCreated = "_created"
+	// MetaThreadName holds the optional thread name.
+	MetaThreadName = "_name"
+	// MetaThreadTags holds the optional comma-separated thread tags.
+	MetaThreadTags = "_tags"
+	// MetaThreadProtocol holds the optional thread protocol.
+	MetaThreadProtocol = "_protocol"
+)
+
+// ThreadOptions defines options to be used when creating a thread.
+type ThreadOptions struct {
+	Name     string
+	Tags     []string
+	Protocol protocol.ID
+}
+
+// ThreadOption specifies thread creation options.
+type ThreadOption func(*ThreadOptions)
+
+// WithThreadName sets a human-readable name for the thread.
+func WithThreadName(name string) ThreadOption {
+	return func(args *ThreadOptions) {
+		args.Name = name
+	}
+}
+
+// WithThreadTags attaches tags to the thread. Tags must not contain commas.
+func WithThreadTags(tags ...string) ThreadOption {
+	return func(args *ThreadOptions) {
+		args.Tags = append(args.Tags, tags...)
+	}
+}
+
+// WithThreadProtocol records the protocol spoken by the thread.
+func WithThreadProtocol(p protocol.ID) ThreadOption {
+	return func(args *ThreadOptions) {
+		args.Protocol = p
+	}
+}
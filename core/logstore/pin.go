@@ -0,0 +1,33 @@
+package logstore
+
+import (
+	"errors"
+
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// MetaThreadPinned holds the priority of a pinned thread in the thread metadata.
+const MetaThreadPinned = "_pinned"
+
+// ErrThreadPinned indicates an attempt to evict a pinned thread.
+var ErrThreadPinned = errors.New("thread is pinned")
+
+// Pin is a pinned thread along with its priority.
+type Pin struct {
+	Thread   thread.ID
+	Priority int
+}
+
+// PinBook marks threads which are exempt from eviction and synced ahead
+// of others, e.g. threads holding user data as opposed to transient ones.
+type PinBook interface {
+	// Pin pins a thread with the priority. Pinning a pinned thread
+	// changes its priority.
+	Pin(thread.ID, int) error
+
+	// Unpin unpins a thread.
+	Unpin(thread.ID) error
+
+	// PinnedThreads returns pinned threads, highest priority first.
+	PinnedThreads() ([]Pin, error)
+}
@@ -0,0 +1,36 @@
+package logstore
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultAddrDialFreshness is the period a successful dial of an address is
+// considered fresh, unless configured otherwise by an address book.
+const DefaultAddrDialFreshness = time.Hour
+
+// SortAddrs orders addresses from the best to the worst. Addresses dialed
+// within freshness come first by ascending round-trip time, then addresses
+// dialed longer ago from the most recent, then the ones never dialed.
+func SortAddrs(addrs []ExpiredAddress, now time.Time, freshness time.Duration) {
+	rank := func(a ExpiredAddress) int {
+		switch {
+		case a.LastDial.IsZero():
+			return 2
+		case now.Sub(a.LastDial) > freshness:
+			return 1
+		default:
+			return 0
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		ri, rj := rank(addrs[i]), rank(addrs[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if ri == 0 && addrs[i].RTT != addrs[j].RTT {
+			return addrs[i].RTT < addrs[j].RTT
+		}
+		return addrs[i].LastDial.After(addrs[j].LastDial)
+	})
+}
@@ -0,0 +1,61 @@
+package logstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// ErrQuotaExceeded is matched by errors.Is for any QuotaError.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaLimit names a resource limited per thread.
+type QuotaLimit string
+
+const (
+	// QuotaLogs limits the number of logs of a thread.
+	QuotaLogs QuotaLimit = "logs"
+	// QuotaAddrs limits the number of addresses of a log.
+	QuotaAddrs QuotaLimit = "addrs"
+	// QuotaMetaBytes limits the size of the metadata of a thread as
+	// computed by MetaEntrySize.
+	QuotaMetaBytes QuotaLimit = "meta bytes"
+)
+
+// QuotaError indicates a write rejected because it would exceed a limit
+// of a thread.
+type QuotaError struct {
+	Thread thread.ID
+	Limit  QuotaLimit
+	// Max is the configured limit.
+	Max int64
+	// Requested is the usage the write would have resulted in.
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota of %s exceeded for thread %s: %d > %d", e.Limit, e.Thread, e.Requested, e.Max)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// MetaEntrySize returns the size of a metadata entry counted against
+// quotas, i.e. the length of the key and of a string or bytes value, or
+// the size of an int64 or bool value.
+func MetaEntrySize(key string, val interface{}) int64 {
+	size := int64(len(key))
+	switch v := val.(type) {
+	case int64:
+		size += 8
+	case bool:
+		size++
+	case string:
+		size += int64(len(v))
+	case []byte:
+		size += int64(len(v))
+	}
+	return size
+}
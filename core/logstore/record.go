@@ -0,0 +1,44 @@
+package logstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
+)
+
+// ErrInvalidLogRecord indicates a signed log record that cannot be accepted.
+var ErrInvalidLogRecord = errors.New("invalid log record")
+
+// OpenLogRecord validates the envelope and returns the peer record it holds
+// along with the envelope in serialized form. The record must be signed by
+// the key of the log it describes.
+func OpenLogRecord(env *record.Envelope) (*peer.PeerRecord, []byte, error) {
+	if env == nil {
+		return nil, nil, fmt.Errorf("%w: missing envelope", ErrInvalidLogRecord)
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidLogRecord, err)
+	}
+	_, rec, err := DecodeLogRecord(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rec, data, nil
+}
+
+// DecodeLogRecord verifies a serialized envelope and returns it along with
+// the peer record it holds.
+func DecodeLogRecord(data []byte) (*record.Envelope, *peer.PeerRecord, error) {
+	var rec peer.PeerRecord
+	env, err := record.ConsumeTypedEnvelope(data, &rec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidLogRecord, err)
+	}
+	if !rec.PeerID.MatchesPublicKey(env.PublicKey) {
+		return nil, nil, fmt.Errorf("%w: record of %s is not signed by its log", ErrInvalidLogRecord, rec.PeerID)
+	}
+	return env, &rec, nil
+}
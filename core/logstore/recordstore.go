@@ -0,0 +1,106 @@
+package logstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/textileio/go-threads/core/net"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// ErrRecordNotFound indicates a requested record was not found in a log.
+var ErrRecordNotFound = errors.New("record not found")
+
+// ErrNoSnapshot indicates a log has no snapshot.
+var ErrNoSnapshot = errors.New("log has no snapshot")
+
+// RecordStore persists records of thread logs, while the logstore books
+// only keep track of logs. Records are kept in a block storage and belong
+// to the log whose key signed them.
+type RecordStore interface {
+	// Put verifies the record against the log key and stores it along with
+	// its block and the given nodes, e.g. the event header and body.
+	// Records of revoked logs are rejected with ErrLogRevoked.
+	Put(context.Context, thread.ID, thread.LogID, net.Record, ...format.Node) error
+
+	// Get loads a record of the log.
+	Get(context.Context, thread.ID, thread.LogID, cid.Cid) (net.Record, error)
+
+	// GetRange walks the log back from the record with cid from and returns
+	// records following the record with cid to, oldest first. At most limit
+	// records closest to from are returned if limit is positive. An
+	// undefined cid to walks to the start of the log.
+	GetRange(ctx context.Context, t thread.ID, l thread.LogID, from, to cid.Cid, limit int) ([]net.Record, error)
+
+	// Iterate walks the log back within the bounds of the query.
+	Iterate(context.Context, thread.ID, thread.LogID, RecordQuery) (RecordIterator, error)
+
+	// PutSnapshot stores the state of the log summarized up to a record of
+	// it, replacing the previous snapshot.
+	PutSnapshot(ctx context.Context, t thread.ID, l thread.LogID, upto cid.Cid, state format.Node) error
+
+	// Snapshot returns the latest snapshot of the log.
+	Snapshot(context.Context, thread.ID, thread.LogID) (LogSnapshot, error)
+
+	// Compact removes records older than the snapshot of the log and
+	// returns their number. Walks over a compacted log end at the snapshot.
+	Compact(context.Context, thread.ID, thread.LogID) (int, error)
+
+	// Merge reconciles diverged heads of a log, e.g. left by a device
+	// restoring a stale backup, into a single head stored in the headbook.
+	// The longest branch is kept, the one with the lowest head cid among
+	// branches of equal length, and records missing from it are appended
+	// ordered by their height in their branch, then by cid. The order is
+	// deterministic only for identical inputs: it doesn't follow causal
+	// order across branches, and peers merging different sets of heads may
+	// end up with different chains. Appended records are signed anew, so
+	// every merge creates new records with new cids, even of heads merged
+	// before. Appending records requires the private key of the log, which
+	// must not be revoked. The heads of the log are merged if none are given.
+	Merge(ctx context.Context, t thread.ID, l thread.LogID, heads ...cid.Cid) (cid.Cid, error)
+
+	// WalkHeads calls fn for records of the log walking back from each of
+	// its heads in turn, visiting every record once. The walk stops early if
+	// fn returns false.
+	WalkHeads(context.Context, thread.ID, thread.LogID, func(net.Record) bool) error
+}
+
+// LogSnapshot summarizes the state of a log up to a record, so that old
+// records can be pruned while new followers bootstrap from the state.
+type LogSnapshot struct {
+	// Upto is the newest record included in the state.
+	Upto cid.Cid
+	// State is the node holding the summarized state.
+	State format.Node
+	// Pruned tells whether records older than Upto were removed.
+	Pruned bool
+}
+
+// RecordQuery bounds a walk over records of a log, from the newest to the
+// oldest. The walk ends at whichever bound is reached first.
+type RecordQuery struct {
+	// From is the record the walk starts at. The first head of the log is
+	// used if undefined.
+	From cid.Cid
+	// Until ends the walk before the record with the cid.
+	Until cid.Cid
+	// Since ends the walk before the first record created before the time.
+	// Records carry no time themselves, so Time must be set along with it.
+	Since time.Time
+	// Time returns the creation time of a record, e.g. from its event body.
+	Time func(context.Context, net.Record) (time.Time, error)
+	// Limit is the maximum number of records returned if positive.
+	Limit int
+}
+
+// RecordIterator streams records of a walk.
+type RecordIterator interface {
+	// Next returns the next record, or false once the walk is over or failed.
+	Next() (net.Record, bool)
+
+	// Err returns the error which ended the walk, if any.
+	Err() error
+}
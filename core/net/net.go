@@ -60,7 +60,7 @@ type API interface {
 	CreateRecord(ctx context.Context, id thread.ID, body format.Node, opts ...ThreadOption) (ThreadRecord, error)
 
 	// AddRecord add an existing record to a thread by id and lid.
-	AddRecord(ctx context.Context, id thread.ID, lid peer.ID, rec Record, opts ...ThreadOption) error
+	AddRecord(ctx context.Context, id thread.ID, lid thread.LogID, rec Record, opts ...ThreadOption) error
 
 	// GetRecord returns a record by thread id and cid.
 	GetRecord(ctx context.Context, id thread.ID, rid cid.Cid, opts ...ThreadOption) (Record, error)
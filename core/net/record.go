@@ -6,7 +6,6 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipld-format"
 	"github.com/libp2p/go-libp2p-core/crypto"
-	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/textileio/go-threads/core/thread"
 )
 
@@ -42,5 +41,5 @@ type ThreadRecord interface {
 	ThreadID() thread.ID
 
 	// LogID returns the record's log ID.
-	LogID() peer.ID
+	LogID() thread.LogID
 }
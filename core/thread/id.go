@@ -367,12 +367,15 @@ func (i Info) GetFirstPrivKeyLog() *LogInfo {
 
 // LogInfo holds log keys, addresses, and heads.
 type LogInfo struct {
-	// ID is the log's identifier.
-	ID peer.ID
+	// ID is the log's identifier, derived from its public key.
+	ID LogID
 	// PubKey is the log's public key.
 	PubKey crypto.PubKey
 	// PrivKey is the log's private key.
 	PrivKey crypto.PrivKey
+	// Peer is the peer owning the log, if known. A peer may own several
+	// logs of a thread, e.g. one per device or app.
+	Peer peer.ID
 	// Addrs are the addresses associated with the given log.
 	Addrs []ma.Multiaddr
 	// Head is the log's current head.
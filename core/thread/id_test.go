@@ -3,6 +3,7 @@ package thread
 import (
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"testing"
 
 	mbase "github.com/multiformats/go-multibase"
@@ -116,3 +117,85 @@ func makeID(t *testing.T, version uint64, variant int64, size uint8) ID {
 
 	return ID(buf[:n+numlen])
 }
+
+func TestParseID(t *testing.T) {
+	i := NewRandomID(AccessControlled)
+	s, err := i.StringOfBase(mbase.Base58BTC)
+	if err != nil {
+		t.Fatalf("failed to encode ID %s: %s", i, err)
+	}
+	j, err := ParseID(" " + s + "\n")
+	if err != nil {
+		t.Fatalf("failed to parse ID %s: %s", s, err)
+	}
+	if i != j {
+		t.Errorf("id %v not equal to id %v", i, j)
+	}
+	if _, err := ParseID(s, Raw, AccessControlled); err != nil {
+		t.Errorf("failed to parse ID %s of expected variants: %s", s, err)
+	}
+	if _, err := ParseID(s, Raw); !errors.Is(err, ErrUnexpectedVariant) {
+		t.Errorf("expected unexpected variant error, got %v", err)
+	}
+	badVariant, err := mbase.Encode(mbase.Base32, makeID(t, V1, 50, 16).Bytes())
+	if err != nil {
+		t.Fatalf("failed to encode ID: %s", err)
+	}
+	for _, invalid := range []string{"", "b", "invalid", badVariant} {
+		if _, err := ParseID(invalid); err == nil {
+			t.Errorf("parsed invalid ID %q", invalid)
+		}
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	for _, v := range []Variant{Raw, AccessControlled} {
+		p, err := ParseVariant(v.String())
+		if err != nil {
+			t.Fatalf("failed to parse variant %s: %s", v, err)
+		}
+		if p != v {
+			t.Errorf("got variant %s, expected %s", p, v)
+		}
+	}
+	if _, err := ParseVariant("other"); err == nil {
+		t.Errorf("parsed unknown variant")
+	}
+}
+
+func TestReencode(t *testing.T) {
+	i := NewRandomID(Raw)
+	base, err := ParseEncoding("base58btc")
+	if err != nil {
+		t.Fatalf("failed to parse encoding: %s", err)
+	}
+	s, err := Reencode(i.String(), base)
+	if err != nil {
+		t.Fatalf("failed to re-encode ID %s: %s", i, err)
+	}
+	if e, _ := ExtractEncoding(s); e != mbase.Base58BTC {
+		t.Errorf("got encoding %s, expected base58btc", mbase.EncodingToStr[e])
+	}
+	if s, err = Reencode(s, mbase.Base32); err != nil || s != i.String() {
+		t.Errorf("got %s (%v) re-encoding back, expected %s", s, err, i)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	i := NewIDV1(AccessControlled, 16)
+	s, err := i.StringOfBase(mbase.Base16)
+	if err != nil {
+		t.Fatalf("failed to encode ID %s: %s", i, err)
+	}
+	d, err := Describe(s)
+	if err != nil {
+		t.Fatalf("failed to describe ID %s: %s", s, err)
+	}
+	if d.ID != i || d.Encoding != mbase.Base16 || d.Version != V1 || d.Variant != AccessControlled || d.Size != 16 {
+		t.Errorf("got bad description %+v", d)
+	}
+	expected := i.String() + " (base16, v1, access_controlled, 16 bytes)"
+	if d.String() != expected {
+		t.Errorf("got %q, expected %q", d, expected)
+	}
+}
@@ -0,0 +1,153 @@
+package thread
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// LogID identifies a log of a thread. It is derived from the public key of
+// the log, not from the identity of the peer hosting it, so that a peer may
+// host any number of logs.
+//
+// LogID shares the encoding of peer.ID, but is a distinct type, so that log
+// and peer IDs aren't mixed up. Use LogIDFromPeer and Peer to convert
+// between them, e.g. for logs of older threads named after their peer.
+type LogID peer.ID
+
+// LogIDFromPeer returns the log ID with the encoding of the peer ID.
+func LogIDFromPeer(p peer.ID) LogID {
+	return LogID(p)
+}
+
+// Peer returns the peer ID with the encoding of the log ID, e.g. to verify
+// records signed with the log key.
+func (id LogID) Peer() peer.ID {
+	return peer.ID(id)
+}
+
+// Pretty returns the base58 encoding of the log ID.
+func (id LogID) Pretty() string {
+	return peer.ID(id).Pretty()
+}
+
+// String returns the base58 encoding of the log ID.
+func (id LogID) String() string {
+	return peer.ID(id).String()
+}
+
+// ShortString returns a shortened form of the log ID for logging.
+func (id LogID) ShortString() string {
+	return peer.ID(id).ShortString()
+}
+
+// Validate checks the log ID is not empty.
+func (id LogID) Validate() error {
+	return peer.ID(id).Validate()
+}
+
+// MatchesPublicKey tests whether the log ID was derived from the public key.
+func (id LogID) MatchesPublicKey(pk crypto.PubKey) bool {
+	return peer.ID(id).MatchesPublicKey(pk)
+}
+
+// MatchesPrivateKey tests whether the log ID was derived from the private
+// key.
+func (id LogID) MatchesPrivateKey(sk crypto.PrivKey) bool {
+	return peer.ID(id).MatchesPrivateKey(sk)
+}
+
+// ExtractPublicKey returns the public key inlined in the log ID, if any.
+func (id LogID) ExtractPublicKey() (crypto.PubKey, error) {
+	return peer.ID(id).ExtractPublicKey()
+}
+
+// MarshalBinary returns the byte representation of the log ID.
+func (id LogID) MarshalBinary() ([]byte, error) {
+	return []byte(id), nil
+}
+
+// UnmarshalBinary sets the log ID from its byte representation.
+func (id *LogID) UnmarshalBinary(data []byte) error {
+	lid, err := LogIDFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*id = lid
+	return nil
+}
+
+// MarshalText returns the string representation of the log ID.
+func (id LogID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText sets the log ID from its string representation.
+func (id *LogID) UnmarshalText(data []byte) error {
+	lid, err := DecodeLogID(string(data))
+	if err != nil {
+		return err
+	}
+	*id = lid
+	return nil
+}
+
+// LogIDSlice for sorting logs.
+type LogIDSlice []LogID
+
+func (s LogIDSlice) Len() int           { return len(s) }
+func (s LogIDSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s LogIDSlice) Less(i, j int) bool { return string(s[i]) < string(s[j]) }
+
+// NewLogID returns the ID of the log with the public key.
+func NewLogID(pk crypto.PubKey) (LogID, error) {
+	if pk == nil {
+		return "", fmt.Errorf("log public key is nil")
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	return LogID(id), err
+}
+
+// LogIDFromPrivKey returns the ID of the log with the private key.
+func LogIDFromPrivKey(sk crypto.PrivKey) (LogID, error) {
+	if sk == nil {
+		return "", fmt.Errorf("log private key is nil")
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	return LogID(id), err
+}
+
+// LogIDFromBytes casts bytes to a log ID, checking they are a valid
+// multihash.
+func LogIDFromBytes(b []byte) (LogID, error) {
+	id, err := peer.IDFromBytes(b)
+	if err != nil {
+		return "", fmt.Errorf("invalid log id: %w", err)
+	}
+	return LogID(id), nil
+}
+
+// DecodeLogID parses a log ID from its string representation, as returned
+// by String.
+func DecodeLogID(s string) (LogID, error) {
+	id, err := peer.Decode(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid log id: %w", err)
+	}
+	return LogID(id), nil
+}
+
+// NewLogKeys generates an Ed25519 key pair for a new log, and returns it
+// along with the log ID.
+func NewLogKeys() (LogID, crypto.PrivKey, crypto.PubKey, error) {
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	id, err := NewLogID(pk)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return id, sk, pk, nil
+}
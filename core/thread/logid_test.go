@@ -0,0 +1,68 @@
+package thread
+
+import "testing"
+
+func TestNewLogID(t *testing.T) {
+	id, sk, pk, err := NewLogKeys()
+	if err != nil {
+		t.Fatalf("failed to generate log keys: %s", err)
+	}
+	if !id.MatchesPublicKey(pk) || !id.MatchesPrivateKey(sk) {
+		t.Errorf("log id %s does not match its keys", id)
+	}
+	fromPriv, err := LogIDFromPrivKey(sk)
+	if err != nil {
+		t.Fatalf("failed to derive log id from private key: %s", err)
+	}
+	if fromPriv != id {
+		t.Errorf("got log id %s from private key, expected %s", fromPriv, id)
+	}
+	if _, err := NewLogID(nil); err == nil {
+		t.Errorf("derived log id from nil public key")
+	}
+}
+
+func TestDecodeLogID(t *testing.T) {
+	id, _, _, err := NewLogKeys()
+	if err != nil {
+		t.Fatalf("failed to generate log keys: %s", err)
+	}
+	decoded, err := DecodeLogID(id.String())
+	if err != nil {
+		t.Fatalf("failed to decode log id %s: %s", id, err)
+	}
+	if decoded != id {
+		t.Errorf("got log id %s, expected %s", decoded, id)
+	}
+	if _, err := DecodeLogID("invalid"); err == nil {
+		t.Errorf("decoded invalid log id")
+	}
+}
+
+func TestLogIDEncoding(t *testing.T) {
+	id, _, _, err := NewLogKeys()
+	if err != nil {
+		t.Fatalf("failed to generate log keys: %s", err)
+	}
+	if LogIDFromPeer(id.Peer()) != id || id.Peer().String() != id.String() {
+		t.Errorf("log id %s changed converting to a peer id", id)
+	}
+	text, err := id.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal log id %s: %s", id, err)
+	}
+	var decoded LogID
+	if err := decoded.UnmarshalText(text); err != nil {
+		t.Fatalf("failed to unmarshal log id %s: %s", text, err)
+	}
+	if decoded != id {
+		t.Errorf("got log id %s, expected %s", decoded, id)
+	}
+	b, _ := id.MarshalBinary()
+	if err := decoded.UnmarshalBinary(b); err != nil || decoded != id {
+		t.Errorf("got log id %s from bytes, expected %s (%v)", decoded, id, err)
+	}
+	if err := decoded.UnmarshalBinary([]byte("invalid")); err == nil {
+		t.Errorf("unmarshaled invalid log id bytes")
+	}
+}
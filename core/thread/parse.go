@@ -0,0 +1,111 @@
+package thread
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	mbase "github.com/multiformats/go-multibase"
+)
+
+// ErrUnexpectedVariant means that a parsed ID has none of the expected
+// variants.
+var ErrUnexpectedVariant = errors.New("unexpected thread id variant")
+
+// ParseVariant returns the variant named by s, as returned by
+// Variant.String.
+func ParseVariant(s string) (Variant, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case Raw.String():
+		return Raw, nil
+	case AccessControlled.String():
+		return AccessControlled, nil
+	default:
+		return 0, fmt.Errorf("unknown thread id variant %q", s)
+	}
+}
+
+// NewRandomID returns a new random V1 ID of the variant, with 32 random
+// bytes.
+func NewRandomID(variant Variant) ID {
+	return NewIDV1(variant, 32)
+}
+
+// ParseID decodes and validates an ID from a multibase string of any
+// supported encoding, ignoring surrounding whitespace. If variants are
+// given, the ID must have one of them.
+func ParseID(s string, variants ...Variant) (ID, error) {
+	id, err := Decode(strings.TrimSpace(s))
+	if err != nil {
+		return Undef, fmt.Errorf("invalid thread id: %w", err)
+	}
+	if len(variants) == 0 {
+		return id, nil
+	}
+	v := id.Variant()
+	for _, expected := range variants {
+		if v == expected {
+			return id, nil
+		}
+	}
+	return Undef, fmt.Errorf("%w: %s", ErrUnexpectedVariant, v)
+}
+
+// ParseEncoding returns the multibase encoding by name, e.g. "base32", or
+// by its prefix character, e.g. "b".
+func ParseEncoding(name string) (mbase.Encoding, error) {
+	enc, err := mbase.EncoderByName(name)
+	if err != nil {
+		return -1, err
+	}
+	return enc.Encoding(), nil
+}
+
+// Reencode parses an ID from s and returns it in the given base.
+func Reencode(s string, base mbase.Encoding) (string, error) {
+	id, err := ParseID(s)
+	if err != nil {
+		return "", err
+	}
+	return id.StringOfBase(base)
+}
+
+// Description details an ID parsed from a string.
+type Description struct {
+	ID       ID
+	Encoding mbase.Encoding
+	Version  uint64
+	Variant  Variant
+	// Size is the number of random bytes.
+	Size int
+}
+
+// Describe parses an ID from s and details it.
+func Describe(s string) (Description, error) {
+	s = strings.TrimSpace(s)
+	id, err := ParseID(s)
+	if err != nil {
+		return Description{}, err
+	}
+	enc, err := ExtractEncoding(s)
+	if err != nil {
+		return Description{}, err
+	}
+	_, vn := uvarint(string(id))
+	_, cn := uvarint(string(id)[vn:])
+	return Description{
+		ID:       id,
+		Encoding: enc,
+		Version:  id.Version(),
+		Variant:  id.Variant(),
+		Size:     len(id) - vn - cn,
+	}, nil
+}
+
+// String returns the description on one line, e.g.:
+//
+//	bafk... (base32, v1, raw, 32 bytes)
+func (d Description) String() string {
+	return fmt.Sprintf("%s (%s, v%d, %s, %d bytes)",
+		d.ID, mbase.EncodingToStr[d.Encoding], d.Version, d.Variant, d.Size)
+}
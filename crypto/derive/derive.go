@@ -0,0 +1,87 @@
+// Package derive deterministically derives thread and log keys from a
+// master secret, so all keys of a user can be recovered from one backup.
+package derive
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	"golang.org/x/crypto/hkdf"
+)
+
+// MinSecretBytes is the minimal length of a master secret.
+const MinSecretBytes = 16
+
+// Key purposes, used as HKDF info together with the thread ID.
+const (
+	purposeService = "threads/service"
+	purposeRead    = "threads/read"
+	purposeLog     = "threads/log"
+)
+
+// Deriver derives keys from a master secret with HKDF-SHA256.
+type Deriver struct {
+	secret []byte
+}
+
+// New returns a Deriver for the master secret. Secrets derived from a
+// backup phrase should be stretched with a password hashing function first.
+func New(secret []byte) (*Deriver, error) {
+	if len(secret) < MinSecretBytes {
+		return nil, fmt.Errorf("master secret must be at least %d bytes", MinSecretBytes)
+	}
+	return &Deriver{secret: append([]byte(nil), secret...)}, nil
+}
+
+// ThreadKey derives the service and read keys of a thread.
+func (d *Deriver) ThreadKey(id thread.ID) (thread.Key, error) {
+	sk, err := d.symKey(purposeService, id)
+	if err != nil {
+		return thread.Key{}, err
+	}
+	rk, err := d.symKey(purposeRead, id)
+	if err != nil {
+		return thread.Key{}, err
+	}
+	return thread.NewKey(sk, rk), nil
+}
+
+// LogKey derives the Ed25519 key pair of the index-th own log of a thread.
+func (d *Deriver) LogKey(id thread.ID, index uint64) (crypto.PrivKey, error) {
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], index)
+	seed, err := d.read(ed25519.SeedSize, purposeLog, id, idx[:])
+	if err != nil {
+		return nil, err
+	}
+	sk, err := crypto.UnmarshalEd25519PrivateKey(ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		return nil, err
+	}
+	return sk, nil
+}
+
+func (d *Deriver) symKey(purpose string, id thread.ID) (*sym.Key, error) {
+	raw, err := d.read(sym.KeyBytes, purpose, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sym.FromBytes(raw)
+}
+
+// read returns n bytes derived for the purpose, thread and extra info.
+func (d *Deriver) read(n int, purpose string, id thread.ID, extra []byte) ([]byte, error) {
+	info := append([]byte(purpose+"/"), id.Bytes()...)
+	info = append(info, extra...)
+	out := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, d.secret, nil, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package derive_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/textileio/go-threads/core/thread"
+	. "github.com/textileio/go-threads/crypto/derive"
+)
+
+var secret = []byte("correct horse battery staple")
+
+func TestNew(t *testing.T) {
+	if _, err := New([]byte("short")); err == nil {
+		t.Fatal("expected short secrets to be rejected")
+	}
+}
+
+func TestThreadKey(t *testing.T) {
+	d, err := New(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := thread.NewIDV1(thread.Raw, 32)
+	k1, err := d.ThreadKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k1.CanRead() {
+		t.Fatal("expected derived key to include a read key")
+	}
+	if bytes.Equal(k1.Service().Bytes(), k1.Read().Bytes()) {
+		t.Fatal("expected service and read keys to differ")
+	}
+
+	// the same keys are recovered from the secret
+	d2, _ := New(secret)
+	k2, err := d2.ThreadKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k1.Bytes(), k2.Bytes()) {
+		t.Fatal("expected derived keys to be deterministic")
+	}
+
+	k3, err := d.ThreadKey(thread.NewIDV1(thread.Raw, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(k1.Bytes(), k3.Bytes()) {
+		t.Fatal("expected keys of other threads to differ")
+	}
+}
+
+func TestLogKey(t *testing.T) {
+	d, err := New(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := thread.NewIDV1(thread.Raw, 32)
+	sk1, err := d.LogKey(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk2, err := d.LogKey(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sk1.Equals(sk2) {
+		t.Fatal("expected derived log keys to be deterministic")
+	}
+	sk3, err := d.LogKey(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk1.Equals(sk3) {
+		t.Fatal("expected log keys of other indexes to differ")
+	}
+	if _, err := peer.IDFromPrivateKey(sk1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -78,6 +78,13 @@ func (k *Key) String() string {
 
 // Encrypt performs AES-256 GCM encryption on plaintext.
 func (k *Key) Encrypt(plaintext []byte) ([]byte, error) {
+	return k.EncryptWithAD(plaintext, nil)
+}
+
+// EncryptWithAD performs AES-256 GCM encryption on plaintext, authenticating
+// the additional data along with it. The ciphertext can only be decrypted
+// with the same additional data.
+func (k *Key) EncryptWithAD(plaintext, ad []byte) ([]byte, error) {
 	block, err := aes.NewCipher(k.raw[:KeyBytes])
 	if err != nil {
 		return nil, err
@@ -90,13 +97,19 @@ func (k *Key) Encrypt(plaintext []byte) ([]byte, error) {
 	if _, err := rand.Read(nonce); err != nil {
 		return nil, err
 	}
-	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
+	ciphertext := aesgcm.Seal(nil, nonce, plaintext, ad)
 	ciphertext = append(nonce[:], ciphertext...)
 	return ciphertext, nil
 }
 
 // Decrypt uses key to perform AES-256 GCM decryption on ciphertext.
 func (k *Key) Decrypt(ciphertext []byte) ([]byte, error) {
+	return k.DecryptWithAD(ciphertext, nil)
+}
+
+// DecryptWithAD uses key to perform AES-256 GCM decryption on ciphertext
+// encrypted with the additional data.
+func (k *Key) DecryptWithAD(ciphertext, ad []byte) ([]byte, error) {
 	block, err := aes.NewCipher(k.raw[:KeyBytes])
 	if err != nil {
 		return nil, err
@@ -106,7 +119,7 @@ func (k *Key) Decrypt(ciphertext []byte) ([]byte, error) {
 		return nil, err
 	}
 	nonce := ciphertext[:NonceBytes]
-	plain, err := aesgcm.Open(nil, nonce, ciphertext[NonceBytes:], nil)
+	plain, err := aesgcm.Open(nil, nonce, ciphertext[NonceBytes:], ad)
 	if err != nil {
 		return nil, err
 	}
@@ -47,3 +47,24 @@ func TestDecrypt(t *testing.T) {
 		t.Error("decrypt AES with bad key succeeded")
 	}
 }
+
+func TestDecryptWithAD(t *testing.T) {
+	key := New()
+	ciphertext, err := key.EncryptWithAD(symmetricTestData.plaintext, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := key.DecryptWithAD(ciphertext, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(symmetricTestData.plaintext) != string(plaintext) {
+		t.Error("decrypt AES with additional data failed")
+	}
+	if _, err := key.DecryptWithAD(ciphertext, []byte("b")); err == nil {
+		t.Error("decrypt AES with other additional data succeeded")
+	}
+	if _, err := key.Decrypt(ciphertext); err == nil {
+		t.Error("decrypt AES without additional data succeeded")
+	}
+}
@@ -0,0 +1,98 @@
+package logstore
+
+import (
+	"strings"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Roles are kept in the thread metadata as int64 values under keys namespaced
+// with MetaThreadAccess and the string encoding of the identity.
+func accessKey(pk thread.PubKey) string {
+	return core.MetaThreadAccess + "/" + pk.String()
+}
+
+// SetRole grants the role to the identity. NoRole revokes its access.
+func (ls *logstore) SetRole(id thread.ID, pk thread.PubKey, role core.Role) error {
+	if !role.Valid() {
+		return core.ErrInvalidRole
+	}
+
+	ls.Lock()
+	defer ls.Unlock()
+
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return core.ErrThreadNotFound
+	}
+	if role == core.NoRole {
+		return ls.ThreadMetadata.DeleteMetaPrefix(id, accessKey(pk))
+	}
+	return ls.putInt64(id, accessKey(pk), int64(role))
+}
+
+// Role returns the role of the identity, NoRole if it has none.
+func (ls *logstore) Role(id thread.ID, pk thread.PubKey) (core.Role, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	return ls.role(id, pk)
+}
+
+// HasRole returns whether the identity has at least the given role.
+func (ls *logstore) HasRole(id thread.ID, pk thread.PubKey, role core.Role) (bool, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	r, err := ls.role(id, pk)
+	if err != nil {
+		return false, err
+	}
+	return r >= role, nil
+}
+
+// Members returns identities having a role in the thread, ordered by
+// their string encoding.
+func (ls *logstore) Members(id thread.ID) ([]core.Member, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	keys, err := ls.MetaKeys(id)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		prefix  = core.MetaThreadAccess + "/"
+		members []core.Member
+	)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		pk := &thread.Libp2pPubKey{}
+		if err := pk.UnmarshalString(strings.TrimPrefix(k, prefix)); err != nil {
+			log.Warnf("skipping malformed access key %s of thread %s: %v", k, id, err)
+			continue
+		}
+		r, err := ls.role(id, pk)
+		if err != nil {
+			return nil, err
+		}
+		if r != core.NoRole {
+			members = append(members, core.Member{Identity: pk, Role: r})
+		}
+	}
+	return members, nil
+}
+
+func (ls *logstore) role(id thread.ID, pk thread.PubKey) (core.Role, error) {
+	v, err := ls.GetInt64(id, accessKey(pk))
+	if err != nil || v == nil {
+		return core.NoRole, err
+	}
+	return core.Role(*v), nil
+}
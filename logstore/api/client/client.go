@@ -0,0 +1,266 @@
+package client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	pb "github.com/textileio/go-threads/logstore/api/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var log = logging.Logger("logstore/client")
+
+// Client provides the client api of a remote logstore.
+type Client struct {
+	c    pb.APIClient
+	conn *grpc.ClientConn
+}
+
+// NewClient starts the client.
+func NewClient(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		c:    pb.NewAPIClient(conn),
+		conn: conn,
+	}, nil
+}
+
+// Close closes the client's grpc connection and cancels any active requests.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Threads returns all threads in the logstore.
+func (c *Client) Threads(ctx context.Context) (thread.IDSlice, error) {
+	resp, err := c.c.ListThreads(ctx, &pb.ListThreadsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(thread.IDSlice, len(resp.ThreadIDs))
+	for i, id := range resp.ThreadIDs {
+		if ids[i], err = thread.Cast(id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// GetThread returns info about a thread. Private keys of logs are not included.
+func (c *Client) GetThread(ctx context.Context, id thread.ID) (info thread.Info, err error) {
+	resp, err := c.c.GetThread(ctx, &pb.GetThreadRequest{
+		ThreadID: id.Bytes(),
+	})
+	if status.Code(err) == codes.NotFound {
+		return info, core.ErrThreadNotFound
+	} else if err != nil {
+		return
+	}
+	return threadInfoFromProto(resp)
+}
+
+// AddThread adds a thread with keys.
+func (c *Client) AddThread(ctx context.Context, info thread.Info) error {
+	_, err := c.c.AddThread(ctx, &pb.AddThreadRequest{
+		ThreadID:  info.ID.Bytes(),
+		ThreadKey: info.Key.Bytes(),
+	})
+	return err
+}
+
+// AddLog adds a log to a thread, along with its private key if present.
+func (c *Client) AddLog(ctx context.Context, id thread.ID, lg thread.LogInfo) error {
+	plg, err := logToProto(lg)
+	if err != nil {
+		return err
+	}
+	var sk []byte
+	if lg.PrivKey != nil {
+		if sk, err = crypto.MarshalPrivateKey(lg.PrivKey); err != nil {
+			return err
+		}
+	}
+	_, err = c.c.AddLog(ctx, &pb.AddLogRequest{
+		ThreadID: id.Bytes(),
+		Log:      plg,
+		PrivKey:  sk,
+	})
+	return err
+}
+
+// AddServiceKey adds a service key to a thread.
+func (c *Client) AddServiceKey(ctx context.Context, id thread.ID, key *sym.Key) error {
+	_, err := c.c.AddKeys(ctx, &pb.AddKeysRequest{
+		ThreadID:   id.Bytes(),
+		ServiceKey: key.Bytes(),
+	})
+	return err
+}
+
+// AddReadKey adds a read key to a thread.
+func (c *Client) AddReadKey(ctx context.Context, id thread.ID, key *sym.Key) error {
+	_, err := c.c.AddKeys(ctx, &pb.AddKeysRequest{
+		ThreadID: id.Bytes(),
+		ReadKey:  key.Bytes(),
+	})
+	return err
+}
+
+// AddPubKey adds a public key to a log.
+func (c *Client) AddPubKey(ctx context.Context, id thread.ID, lid thread.LogID, key crypto.PubKey) error {
+	pk, err := crypto.MarshalPublicKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = c.c.AddKeys(ctx, &pb.AddKeysRequest{
+		ThreadID: id.Bytes(),
+		LogID:    marshalLogID(lid),
+		PubKey:   pk,
+	})
+	return err
+}
+
+// AddPrivKey adds a private key to a log.
+func (c *Client) AddPrivKey(ctx context.Context, id thread.ID, lid thread.LogID, key crypto.PrivKey) error {
+	sk, err := crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = c.c.AddKeys(ctx, &pb.AddKeysRequest{
+		ThreadID: id.Bytes(),
+		LogID:    marshalLogID(lid),
+		PrivKey:  sk,
+	})
+	return err
+}
+
+// AddAddrs adds addresses to a log with a TTL.
+func (c *Client) AddAddrs(ctx context.Context, id thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	_, err := c.c.AddAddrs(ctx, &pb.AddAddrsRequest{
+		ThreadID: id.Bytes(),
+		LogID:    marshalLogID(lid),
+		Addrs:    addrsToProto(addrs),
+		Ttl:      int64(ttl),
+	})
+	return err
+}
+
+// ThreadAddrStream returns a channel that delivers address changes for all
+// logs of a thread. The channel is closed when the context is done.
+func (c *Client) ThreadAddrStream(ctx context.Context, id thread.ID) (<-chan core.LogAddr, error) {
+	stream, err := c.c.AddrStream(ctx, &pb.AddrStreamRequest{
+		ThreadID: id.Bytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	channel := make(chan core.LogAddr)
+	go func() {
+		defer close(channel)
+		for {
+			rep, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Errorf("error receiving address: %v", err)
+				}
+				return
+			}
+			lid, err := thread.LogIDFromBytes(rep.LogID)
+			if err != nil {
+				log.Errorf("error decoding log ID: %v", err)
+				continue
+			}
+			addr, err := ma.NewMultiaddrBytes(rep.Addr)
+			if err != nil {
+				log.Errorf("error decoding address: %v", err)
+				continue
+			}
+			select {
+			case channel <- core.LogAddr{Log: lid, Addr: addr}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return channel, nil
+}
+
+func marshalLogID(id thread.LogID) []byte {
+	b, _ := id.MarshalBinary() // This will never return an error
+	return b
+}
+
+func threadInfoFromProto(reply *pb.ThreadInfoReply) (info thread.Info, err error) {
+	if info.ID, err = thread.Cast(reply.ThreadID); err != nil {
+		return
+	}
+	if info.Key, err = thread.KeyFromBytes(reply.ThreadKey); err != nil {
+		return
+	}
+	info.Logs = make([]thread.LogInfo, len(reply.Logs))
+	for i, lg := range reply.Logs {
+		if info.Logs[i], err = logFromProto(lg); err != nil {
+			return
+		}
+	}
+	return info, nil
+}
+
+func logToProto(lg thread.LogInfo) (*pb.LogInfo, error) {
+	pk, err := crypto.MarshalPublicKey(lg.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	var head []byte
+	if lg.Head.Defined() {
+		head = lg.Head.Bytes()
+	}
+	return &pb.LogInfo{
+		ID:     marshalLogID(lg.ID),
+		PubKey: pk,
+		Addrs:  addrsToProto(lg.Addrs),
+		Head:   head,
+	}, nil
+}
+
+func logFromProto(l *pb.LogInfo) (lg thread.LogInfo, err error) {
+	if lg.ID, err = thread.LogIDFromBytes(l.ID); err != nil {
+		return
+	}
+	if lg.PubKey, err = crypto.UnmarshalPublicKey(l.PubKey); err != nil {
+		return
+	}
+	lg.Addrs = make([]ma.Multiaddr, len(l.Addrs))
+	for i, addr := range l.Addrs {
+		if lg.Addrs[i], err = ma.NewMultiaddrBytes(addr); err != nil {
+			return
+		}
+	}
+	if len(l.Head) > 0 {
+		lg.Head, err = cid.Cast(l.Head)
+	}
+	return
+}
+
+func addrsToProto(addrs []ma.Multiaddr) [][]byte {
+	pas := make([][]byte, len(addrs))
+	for i, addr := range addrs {
+		pas[i] = addr.Bytes()
+	}
+	return pas
+}
@@ -0,0 +1,220 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/phayes/freeport"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	lstore "github.com/textileio/go-threads/logstore"
+	"github.com/textileio/go-threads/logstore/api"
+	. "github.com/textileio/go-threads/logstore/api/client"
+	pb "github.com/textileio/go-threads/logstore/api/pb"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+	"github.com/textileio/go-threads/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient_Threads(t *testing.T) {
+	t.Parallel()
+	store, client, done := setup(t)
+	defer done()
+	ctx := context.Background()
+
+	info := createThread(t, client)
+	// threads are listed once they have logs
+	createLog(t, client, info.ID)
+	ids, err := client.Threads(ctx)
+	checkErr(t, err)
+	if len(ids) != 1 || !ids[0].Equals(info.ID) {
+		t.Fatalf("expected thread %s, got %v", info.ID, ids)
+	}
+
+	key, err := store.ServiceKey(info.ID)
+	checkErr(t, err)
+	if key == nil || string(key.Bytes()) != string(info.Key.Service().Bytes()) {
+		t.Fatal("expected the service key to be added")
+	}
+	got, err := client.GetThread(ctx, info.ID)
+	checkErr(t, err)
+	if !got.ID.Equals(info.ID) || got.Key.Read() == nil {
+		t.Fatal("got bad thread info")
+	}
+
+	if _, err := client.GetThread(ctx, thread.NewIDV1(thread.Raw, 32)); !errors.Is(err, core.ErrThreadNotFound) {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+}
+
+func TestClient_AddLog(t *testing.T) {
+	t.Parallel()
+	store, client, done := setup(t)
+	defer done()
+	ctx := context.Background()
+
+	info := createThread(t, client)
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	lid, err := thread.LogIDFromPrivKey(sk)
+	checkErr(t, err)
+	addr := util.MustParseAddr("/ip4/127.0.0.1/tcp/4006")
+	checkErr(t, client.AddLog(ctx, info.ID, thread.LogInfo{
+		ID:      lid,
+		PubKey:  pk,
+		PrivKey: sk,
+		Addrs:   []ma.Multiaddr{addr},
+	}))
+
+	got, err := client.GetThread(ctx, info.ID)
+	checkErr(t, err)
+	if len(got.Logs) != 1 || got.Logs[0].ID != lid || len(got.Logs[0].Addrs) != 1 {
+		t.Fatalf("expected log %s with an address, got %v", lid, got.Logs)
+	}
+	if got.Logs[0].PrivKey != nil {
+		t.Fatal("expected private keys not to be returned")
+	}
+	stored, err := store.PrivKey(info.ID, lid)
+	checkErr(t, err)
+	if stored == nil || !stored.Equals(sk) {
+		t.Fatal("expected the private key to be added")
+	}
+
+	osk, opk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	other, err := thread.LogIDFromPrivKey(osk)
+	checkErr(t, err)
+	checkErr(t, client.AddPubKey(ctx, info.ID, other, opk))
+	checkErr(t, client.AddPrivKey(ctx, info.ID, other, osk))
+	if stored, err := store.PubKey(info.ID, other); err != nil || stored == nil || !stored.Equals(opk) {
+		t.Fatalf("expected the public key to be added: %v", err)
+	}
+}
+
+func TestClient_ThreadAddrStream(t *testing.T) {
+	t.Parallel()
+	_, client, done := setup(t)
+	defer done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := createThread(t, client)
+	lid := createLog(t, client, info.ID)
+
+	stream, err := client.ThreadAddrStream(ctx, info.ID)
+	checkErr(t, err)
+	addr := util.MustParseAddr("/ip4/127.0.0.1/tcp/4006")
+	checkErr(t, client.AddAddrs(ctx, info.ID, lid, []ma.Multiaddr{addr}, time.Hour))
+
+	select {
+	case la := <-stream:
+		if la.Log != lid || !la.Addr.Equal(addr) {
+			t.Fatalf("expected address %s of %s, got %v", addr, lid, la)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for an address")
+	}
+
+	cancel()
+	for range stream {
+	}
+}
+
+func TestClient_ErrorCodes(t *testing.T) {
+	t.Parallel()
+	store := lstore.Validate(lstoremem.NewLogstore(lstore.WithQuota(lstore.Quota{MaxAddrs: 1})))
+	client, done := serve(t, store)
+	defer done()
+	ctx := context.Background()
+
+	info := createThread(t, client)
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	lid, err := thread.LogIDFromPrivKey(sk)
+	checkErr(t, err)
+	lg := thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk}
+	checkErr(t, client.AddLog(ctx, info.ID, lg))
+	if err := client.AddLog(ctx, info.ID, lg); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists, got %v", err)
+	}
+
+	_, other, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	if err := client.AddPubKey(ctx, info.ID, lid, other); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+
+	addrs := []ma.Multiaddr{
+		util.MustParseAddr("/ip4/127.0.0.1/tcp/4006"),
+		util.MustParseAddr("/ip4/127.0.0.1/tcp/4007"),
+	}
+	checkErr(t, client.AddAddrs(ctx, info.ID, lid, addrs[:1], time.Hour))
+	if err := client.AddAddrs(ctx, info.ID, lid, addrs[1:], time.Hour); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+}
+
+func setup(t *testing.T) (core.Logstore, *Client, func()) {
+	store := lstoremem.NewLogstore()
+	client, done := serve(t, store)
+	return store, client, done
+}
+
+func serve(t *testing.T, store core.Logstore) (*Client, func()) {
+	service, err := api.NewService(store, api.Config{
+		Debug: true,
+	})
+	checkErr(t, err)
+	port, err := freeport.GetFreePort()
+	checkErr(t, err)
+	target := fmt.Sprintf("127.0.0.1:%d", port)
+	server := grpc.NewServer()
+	listener, err := net.Listen("tcp", target)
+	checkErr(t, err)
+	go func() {
+		pb.RegisterAPIServer(server, service)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Fatalf("serve error: %v", err)
+		}
+	}()
+
+	client, err := NewClient(target, grpc.WithInsecure())
+	checkErr(t, err)
+	return client, func() {
+		if err := client.Close(); err != nil {
+			t.Fatal(err)
+		}
+		server.GracefulStop()
+	}
+}
+
+func createThread(t *testing.T, client *Client) thread.Info {
+	info := thread.Info{ID: thread.NewIDV1(thread.Raw, 32), Key: thread.NewRandomKey()}
+	checkErr(t, client.AddThread(context.Background(), info))
+	return info
+}
+
+func createLog(t *testing.T, client *Client, id thread.ID) thread.LogID {
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	lid, err := thread.LogIDFromPrivKey(sk)
+	checkErr(t, err)
+	checkErr(t, client.AddLog(context.Background(), id, thread.LogInfo{ID: lid, PubKey: pk}))
+	return lid
+}
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	pb "github.com/textileio/go-threads/logstore/api/pb"
+	tutil "github.com/textileio/go-threads/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	log = logging.Logger("logstoreapi")
+)
+
+// Service is a gRPC service for a logstore. Private keys of logs can be
+// added but are never returned.
+type Service struct {
+	store core.Logstore
+}
+
+// Config specifies server settings.
+type Config struct {
+	Debug bool
+}
+
+// NewService returns a new service.
+func NewService(store core.Logstore, conf Config) (*Service, error) {
+	var err error
+	if conf.Debug {
+		err = tutil.SetLogLevels(map[string]logging.LogLevel{
+			"logstoreapi": logging.LevelDebug,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Service{store: store}, nil
+}
+
+func (s *Service) ListThreads(_ context.Context, _ *pb.ListThreadsRequest) (*pb.ListThreadsReply, error) {
+	log.Debugf("received list threads request")
+
+	ids, err := s.store.Threads()
+	if err != nil {
+		return nil, storeError(err)
+	}
+	pids := make([][]byte, len(ids))
+	for i, id := range ids {
+		pids[i] = id.Bytes()
+	}
+	return &pb.ListThreadsReply{ThreadIDs: pids}, nil
+}
+
+func (s *Service) GetThread(_ context.Context, req *pb.GetThreadRequest) (*pb.ThreadInfoReply, error) {
+	log.Debugf("received get thread request")
+
+	id, err := thread.Cast(req.ThreadID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	info, err := s.store.GetThread(id)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return threadInfoToProto(info)
+}
+
+func (s *Service) AddThread(_ context.Context, req *pb.AddThreadRequest) (*pb.AddThreadReply, error) {
+	log.Debugf("received add thread request")
+
+	id, err := thread.Cast(req.ThreadID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	key, err := thread.KeyFromBytes(req.ThreadKey)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid thread-key: %v", err))
+	}
+	if err = s.store.AddThread(thread.Info{ID: id, Key: key}); err != nil {
+		return nil, storeError(err)
+	}
+	return &pb.AddThreadReply{}, nil
+}
+
+func (s *Service) AddLog(_ context.Context, req *pb.AddLogRequest) (*pb.AddLogReply, error) {
+	log.Debugf("received add log request")
+
+	id, err := thread.Cast(req.ThreadID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Log == nil {
+		return nil, status.Error(codes.InvalidArgument, "log is required")
+	}
+	lg, err := logFromProto(req.Log)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.PrivKey != nil {
+		if lg.PrivKey, err = crypto.UnmarshalPrivateKey(req.PrivKey); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid log private-key: %v", err))
+		}
+	}
+	if err = s.store.AddLog(id, lg); err != nil {
+		return nil, storeError(err)
+	}
+	return &pb.AddLogReply{}, nil
+}
+
+func (s *Service) AddKeys(_ context.Context, req *pb.AddKeysRequest) (*pb.AddKeysReply, error) {
+	log.Debugf("received add keys request")
+
+	id, err := thread.Cast(req.ThreadID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.ServiceKey != nil {
+		sk, err := sym.FromBytes(req.ServiceKey)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid service-key: %v", err))
+		}
+		if err = s.store.AddServiceKey(id, sk); err != nil {
+			return nil, storeError(err)
+		}
+	}
+	if req.ReadKey != nil {
+		rk, err := sym.FromBytes(req.ReadKey)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid read-key: %v", err))
+		}
+		if err = s.store.AddReadKey(id, rk); err != nil {
+			return nil, storeError(err)
+		}
+	}
+	if req.PubKey == nil && req.PrivKey == nil {
+		return &pb.AddKeysReply{}, nil
+	}
+	lid, err := thread.LogIDFromBytes(req.LogID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.PubKey != nil {
+		pk, err := crypto.UnmarshalPublicKey(req.PubKey)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid log public-key: %v", err))
+		}
+		if err = s.store.AddPubKey(id, lid, pk); err != nil {
+			return nil, storeError(err)
+		}
+	}
+	if req.PrivKey != nil {
+		sk, err := crypto.UnmarshalPrivateKey(req.PrivKey)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid log private-key: %v", err))
+		}
+		if err = s.store.AddPrivKey(id, lid, sk); err != nil {
+			return nil, storeError(err)
+		}
+	}
+	return &pb.AddKeysReply{}, nil
+}
+
+func (s *Service) AddAddrs(_ context.Context, req *pb.AddAddrsRequest) (*pb.AddAddrsReply, error) {
+	log.Debugf("received add addrs request")
+
+	id, err := thread.Cast(req.ThreadID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	lid, err := thread.LogIDFromBytes(req.LogID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	addrs, err := addrsFromProto(req.Addrs)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// the TTL is given in nanoseconds, see AddAddrsRequest
+	if err = s.store.AddAddrs(id, lid, addrs, time.Duration(req.Ttl)); err != nil {
+		return nil, storeError(err)
+	}
+	return &pb.AddAddrsReply{}, nil
+}
+
+func (s *Service) AddrStream(req *pb.AddrStreamRequest, server pb.API_AddrStreamServer) error {
+	log.Debugf("received addr stream request")
+
+	id, err := thread.Cast(req.ThreadID)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	stream, err := s.store.ThreadAddrStream(server.Context(), id)
+	if err != nil {
+		return storeError(err)
+	}
+	for la := range stream {
+		if err := server.Send(&pb.AddrStreamReply{
+			LogID: marshalLogID(la.Log),
+			Addr:  la.Addr.Bytes(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeError maps errors of the store to statuses with matching codes, so
+// that clients can tell them apart.
+func storeError(err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, core.ErrThreadNotFound), errors.Is(err, core.ErrLogNotFound):
+		code = codes.NotFound
+	case errors.Is(err, core.ErrThreadExists), errors.Is(err, core.ErrLogExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, core.ErrInvalidMetaKey), errors.Is(err, core.ErrReservedKey),
+		errors.Is(err, core.ErrInvalidThreadID), errors.Is(err, core.ErrInvalidLogID),
+		errors.Is(err, core.ErrInvalidAddr), errors.Is(err, core.ErrInvalidKey),
+		errors.Is(err, core.ErrInvalidHead), errors.Is(err, core.ErrInvalidTTL):
+		code = codes.InvalidArgument
+	case errors.Is(err, core.ErrQuotaExceeded):
+		code = codes.ResourceExhausted
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	default:
+		return err
+	}
+	return status.Error(code, err.Error())
+}
+
+func marshalLogID(id thread.LogID) []byte {
+	b, _ := id.MarshalBinary() // This will never return an error
+	return b
+}
+
+func threadInfoToProto(info thread.Info) (*pb.ThreadInfoReply, error) {
+	logs := make([]*pb.LogInfo, len(info.Logs))
+	for i, lg := range info.Logs {
+		pk, err := crypto.MarshalPublicKey(lg.PubKey)
+		if err != nil {
+			return nil, err
+		}
+		addrs := make([][]byte, len(lg.Addrs))
+		for j, addr := range lg.Addrs {
+			addrs[j] = addr.Bytes()
+		}
+		logs[i] = &pb.LogInfo{
+			ID:     marshalLogID(lg.ID),
+			PubKey: pk,
+			Addrs:  addrs,
+			Head:   lg.Head.Bytes(),
+		}
+	}
+	return &pb.ThreadInfoReply{
+		ThreadID:  info.ID.Bytes(),
+		ThreadKey: info.Key.Bytes(),
+		Logs:      logs,
+	}, nil
+}
+
+func logFromProto(l *pb.LogInfo) (lg thread.LogInfo, err error) {
+	if lg.ID, err = thread.LogIDFromBytes(l.ID); err != nil {
+		return
+	}
+	if lg.PubKey, err = crypto.UnmarshalPublicKey(l.PubKey); err != nil {
+		return lg, fmt.Errorf("invalid log public-key: %v", err)
+	}
+	if lg.Addrs, err = addrsFromProto(l.Addrs); err != nil {
+		return
+	}
+	if len(l.Head) > 0 {
+		lg.Head, err = cid.Cast(l.Head)
+	}
+	return
+}
+
+func addrsFromProto(pas [][]byte) ([]ma.Multiaddr, error) {
+	addrs := make([]ma.Multiaddr, len(pas))
+	for i, pa := range pas {
+		addr, err := ma.NewMultiaddrBytes(pa)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addr
+	}
+	return addrs, nil
+}
@@ -0,0 +1,178 @@
+package logstore
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	"github.com/whyrusleeping/base32"
+)
+
+// Archived threads are stored in the cold datastore under key pattern:
+// /thread/archive/<base32 thread id no padding>
+var archiveBase = ds.NewKey("/thread/archive")
+
+func archiveKey(id thread.ID) ds.Key {
+	return archiveBase.ChildString(base32.RawStdEncoding.EncodeToString(id.Bytes()))
+}
+
+// ArchiveThread serializes the thread into the cold datastore and deletes it
+// from the logstore. Pinned threads are never archived.
+func (ls *logstore) ArchiveThread(id thread.ID, cold ds.Datastore) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	data, err := ls.archivable(id)
+	if err != nil {
+		return err
+	}
+	if err := cold.Put(archiveKey(id), data); err != nil {
+		return fmt.Errorf("storing archive of thread %s: %w", id, err)
+	}
+	return ls.deleteThread(id)
+}
+
+// Archive writes the thread into w compressed with gzip and deletes it from
+// the logstore, keeping the archival time as a stub in the thread metadata.
+// Pinned threads are never archived.
+func (ls *logstore) Archive(id thread.ID, w io.Writer) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	data, err := ls.archivable(id)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("writing archive of thread %s: %w", id, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("writing archive of thread %s: %w", id, err)
+	}
+	if err := ls.deleteThread(id); err != nil {
+		return err
+	}
+	return ls.putInt64(id, core.MetaThreadArchived, time.Now().UnixNano())
+}
+
+// archivable returns the exported thread if it exists and isn't pinned.
+func (ls *logstore) archivable(id thread.ID) ([]byte, error) {
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, core.ErrThreadNotFound
+	}
+	pinned, err := ls.isPinned(id)
+	if err != nil {
+		return nil, err
+	}
+	if pinned {
+		return nil, core.ErrThreadPinned
+	}
+	data, err := ls.exportThread(id)
+	if err != nil {
+		return nil, fmt.Errorf("exporting thread %s: %w", id, err)
+	}
+	return data, nil
+}
+
+// Unarchive restores the thread from an archive written by Archive and
+// drops its stub.
+func (ls *logstore) Unarchive(r io.Reader) (thread.ID, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return thread.Undef, fmt.Errorf("reading archive: %w", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return thread.Undef, fmt.Errorf("reading archive: %w", err)
+	}
+	te, id, err := decodeThread(data)
+	if err != nil {
+		return thread.Undef, fmt.Errorf("decoding archive: %w", err)
+	}
+
+	ls.Lock()
+	defer ls.Unlock()
+
+	if err := ls.importThread(id, te); err != nil {
+		return thread.Undef, err
+	}
+	if err := ls.ThreadMetadata.DeleteMetaPrefix(id, core.MetaThreadArchived); err != nil {
+		return thread.Undef, err
+	}
+	return id, nil
+}
+
+// IsArchived reports whether the thread has an archival stub.
+func (ls *logstore) IsArchived(id thread.ID) (bool, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	archived, err := ls.GetInt64(id, core.MetaThreadArchived)
+	if err != nil {
+		return false, err
+	}
+	return archived != nil, nil
+}
+
+// UnarchiveThread restores the thread from the cold datastore and deletes
+// the archived copy.
+func (ls *logstore) UnarchiveThread(id thread.ID, cold ds.Datastore) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	data, err := cold.Get(archiveKey(id))
+	if err == ds.ErrNotFound {
+		return core.ErrThreadNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("loading archive of thread %s: %w", id, err)
+	}
+	te, tid, err := decodeThread(data)
+	if err != nil {
+		return fmt.Errorf("decoding archive of thread %s: %w", id, err)
+	}
+	if !tid.Equals(id) {
+		return fmt.Errorf("archive of thread %s holds thread %s", id, tid)
+	}
+	if err := ls.importThread(tid, te); err != nil {
+		return err
+	}
+	return cold.Delete(archiveKey(id))
+}
+
+// ArchivedThreads returns the threads archived in the cold datastore.
+func (ls *logstore) ArchivedThreads(cold ds.Datastore) (thread.IDSlice, error) {
+	results, err := cold.Query(query.Query{Prefix: archiveBase.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var ids thread.IDSlice
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+		b, err := base32.RawStdEncoding.DecodeString(ds.RawKey(entry.Key).BaseNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("bad archive key detected: %s", entry.Key)
+		}
+		id, err := thread.Cast(b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse thread ID from key %s: %w", entry.Key, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
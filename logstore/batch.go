@@ -0,0 +1,136 @@
+package logstore
+
+import (
+	"fmt"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+var _ core.Batch = (*batch)(nil)
+
+// batch accumulates writes and applies them under the logstore lock, so
+// readers never observe a partially committed batch.
+type batch struct {
+	ls   *logstore
+	ops  []func() error
+	logs map[thread.ID][]thread.LogID
+}
+
+// Batch returns a new batch writer for the logstore.
+func (ls *logstore) Batch() core.Batch {
+	return &batch{
+		ls:   ls,
+		logs: make(map[thread.ID][]thread.LogID),
+	}
+}
+
+func (b *batch) AddThread(info thread.Info) {
+	b.touch(info.ID)
+	b.ops = append(b.ops, func() error {
+		return b.ls.addThread(info)
+	})
+	for _, lg := range info.Logs {
+		b.AddLog(info.ID, lg)
+	}
+}
+
+func (b *batch) AddLog(id thread.ID, lg thread.LogInfo) {
+	b.touch(id)
+	b.logs[id] = append(b.logs[id], lg.ID)
+	b.ops = append(b.ops, func() error {
+		return b.ls.addLog(id, lg)
+	})
+}
+
+func (b *batch) PutInt64(id thread.ID, key string, val int64) {
+	b.touch(id)
+	b.ops = append(b.ops, func() error {
+		return b.ls.PutInt64(id, key, val)
+	})
+}
+
+func (b *batch) PutString(id thread.ID, key string, val string) {
+	b.touch(id)
+	b.ops = append(b.ops, func() error {
+		return b.ls.PutString(id, key, val)
+	})
+}
+
+func (b *batch) PutBool(id thread.ID, key string, val bool) {
+	b.touch(id)
+	b.ops = append(b.ops, func() error {
+		return b.ls.PutBool(id, key, val)
+	})
+}
+
+func (b *batch) PutBytes(id thread.ID, key string, val []byte) {
+	b.touch(id)
+	b.ops = append(b.ops, func() error {
+		return b.ls.PutBytes(id, key, val)
+	})
+}
+
+// Commit applies the batch. On failure, threads and logs created by the
+// batch are removed, while values written to existing keys are kept.
+func (b *batch) Commit() error {
+	b.ls.Lock()
+	defer b.ls.Unlock()
+
+	// remember what existed beforehand to be able to roll back
+	var (
+		newThreads []thread.ID
+		newLogs    = make(map[thread.ID][]thread.LogID)
+	)
+	for id, logs := range b.logs {
+		exists, err := b.ls.threadExists(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			newThreads = append(newThreads, id)
+			continue
+		}
+		for _, lid := range logs {
+			pk, err := b.ls.PubKey(id, lid)
+			if err != nil {
+				return err
+			}
+			if pk == nil {
+				newLogs[id] = append(newLogs[id], lid)
+			}
+		}
+	}
+
+	for _, op := range b.ops {
+		if err := op(); err != nil {
+			if rerr := b.rollback(newThreads, newLogs); rerr != nil {
+				return fmt.Errorf("%w, rolling back: %s", err, rerr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *batch) rollback(threads []thread.ID, logs map[thread.ID][]thread.LogID) error {
+	for _, id := range threads {
+		if err := b.ls.deleteThread(id); err != nil {
+			return err
+		}
+	}
+	for id, lids := range logs {
+		for _, lid := range lids {
+			if err := b.ls.deleteLog(id, lid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *batch) touch(id thread.ID) {
+	if _, ok := b.logs[id]; !ok {
+		b.logs[id] = nil
+	}
+}
@@ -0,0 +1,142 @@
+package logstore
+
+import (
+	"fmt"
+	"time"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+func init() {
+	cbornode.RegisterCborType(capabilityToken{})
+	cbornode.RegisterCborType(capabilityPayload{})
+}
+
+// capabilityDomain separates capability signatures from other data signed
+// with log keys.
+const capabilityDomain = "/threads/capability/"
+
+// capabilityToken holds the encoded capabilityPayload along with the issuer
+// signature over it, encoded with CBOR.
+type capabilityToken struct {
+	Payload []byte
+	Sig     []byte
+}
+
+type capabilityPayload struct {
+	Thread  []byte
+	Issuer  []byte
+	Subject []byte
+	Role    int
+	// Expires holds the expiration time in unix nanoseconds.
+	Expires int64
+}
+
+// IssueCapability signs a token granting the subject a role in the thread
+// until the TTL passes, using the private key of the issuing log. The log's
+// identity must hold at least the granted role itself.
+func (ls *logstore) IssueCapability(id thread.ID, issuer thread.LogID, subject peer.ID, role core.Role, ttl time.Duration) ([]byte, error) {
+	if !role.Valid() || role == core.NoRole {
+		return nil, core.ErrInvalidRole
+	}
+	sk, err := ls.PrivKey(id, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if sk == nil {
+		return nil, fmt.Errorf("log %s has no private key", issuer)
+	}
+	if err := ls.checkIssuerRole(id, issuer, sk.GetPublic(), role); err != nil {
+		return nil, err
+	}
+	payload, err := cbornode.DumpObject(capabilityPayload{
+		Thread:  id.Bytes(),
+		Issuer:  []byte(issuer),
+		Subject: []byte(subject),
+		Role:    int(role),
+		Expires: time.Now().Add(ttl).UnixNano(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sk.Sign(append([]byte(capabilityDomain), payload...))
+	if err != nil {
+		return nil, err
+	}
+	return cbornode.DumpObject(capabilityToken{Payload: payload, Sig: sig})
+}
+
+// VerifyCapability returns the capability of a token issued by a
+// non-revoked log known to the keybook, whose identity holds at least the
+// granted role.
+func (ls *logstore) VerifyCapability(token []byte) (core.Capability, error) {
+	var (
+		tok capabilityToken
+		cp  capabilityPayload
+		c   core.Capability
+	)
+	if err := cbornode.DecodeInto(token, &tok); err != nil {
+		return c, fmt.Errorf("%w: %v", core.ErrInvalidCapability, err)
+	}
+	if err := cbornode.DecodeInto(tok.Payload, &cp); err != nil {
+		return c, fmt.Errorf("%w: %v", core.ErrInvalidCapability, err)
+	}
+	var err error
+	if c.Thread, err = thread.Cast(cp.Thread); err != nil {
+		return c, fmt.Errorf("%w: %v", core.ErrInvalidCapability, err)
+	}
+	if c.Issuer, err = thread.LogIDFromBytes(cp.Issuer); err != nil {
+		return c, fmt.Errorf("%w: %v", core.ErrInvalidCapability, err)
+	}
+	if c.Subject, err = peer.IDFromBytes(cp.Subject); err != nil {
+		return c, fmt.Errorf("%w: %v", core.ErrInvalidCapability, err)
+	}
+	c.Role = core.Role(cp.Role)
+	if !c.Role.Valid() || c.Role == core.NoRole {
+		return c, fmt.Errorf("%w: %v", core.ErrInvalidCapability, core.ErrInvalidRole)
+	}
+	c.Expires = time.Unix(0, cp.Expires)
+
+	pk, err := ls.PubKey(c.Thread, c.Issuer)
+	if err != nil {
+		return c, err
+	}
+	if pk == nil {
+		return c, fmt.Errorf("%w: unknown issuer %s", core.ErrInvalidCapability, c.Issuer)
+	}
+	revoked, err := ls.IsRevoked(c.Thread, c.Issuer)
+	if err != nil {
+		return c, err
+	}
+	if revoked {
+		return c, core.ErrLogRevoked
+	}
+	ok, err := pk.Verify(append([]byte(capabilityDomain), tok.Payload...), tok.Sig)
+	if err != nil || !ok {
+		return c, fmt.Errorf("%w: bad signature", core.ErrInvalidCapability)
+	}
+	if time.Now().After(c.Expires) {
+		return c, core.ErrCapabilityExpired
+	}
+	if err := ls.checkIssuerRole(c.Thread, c.Issuer, pk, c.Role); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// checkIssuerRole prevents logs from delegating more access than their
+// identity holds in the thread.
+func (ls *logstore) checkIssuerRole(id thread.ID, issuer thread.LogID, pk crypto.PubKey, role core.Role) error {
+	ok, err := ls.HasRole(id, thread.NewLibp2pPubKey(pk), role)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: issuer %s lacks role %s", core.ErrInvalidCapability, issuer, role)
+	}
+	return nil
+}
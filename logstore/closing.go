@@ -0,0 +1,704 @@
+package logstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// lifecycle tracks whether the logstore is closed. Operations on the books
+// hold a read lock, so that closing waits for the ones in flight.
+type lifecycle struct {
+	sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{done: make(chan struct{})}
+}
+
+// enter starts an operation, or fails with core.ErrClosed. Started
+// operations must be finished with exit.
+func (lc *lifecycle) enter() error {
+	lc.RLock()
+	if lc.closed {
+		lc.RUnlock()
+		return core.ErrClosed
+	}
+	return nil
+}
+
+func (lc *lifecycle) exit() {
+	lc.RUnlock()
+}
+
+// close waits for operations in flight and marks the logstore closed.
+// Returns false if it was closed already.
+func (lc *lifecycle) close() bool {
+	lc.Lock()
+	defer lc.Unlock()
+	if lc.closed {
+		return false
+	}
+	lc.closed = true
+	close(lc.done)
+	return true
+}
+
+func (lc *lifecycle) isClosed() bool {
+	lc.RLock()
+	defer lc.RUnlock()
+	return lc.closed
+}
+
+// bind returns a context cancelled once the logstore is closed, so that
+// streams started with it are closed too.
+func (lc *lifecycle) bind(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		select {
+		case <-lc.done:
+		case <-ctx.Done():
+		}
+	}()
+	return ctx
+}
+
+// guardBooks wraps the books of the logstore to fail operations once the
+// logstore is closed.
+func (ls *logstore) guardBooks() {
+	ls.KeyBook = &closingKeyBook{KeyBook: ls.KeyBook, lc: ls.lc}
+	ls.AddrBook = &closingAddrBook{AddrBook: ls.AddrBook, lc: ls.lc}
+	ls.HeadBook = &closingHeadBook{HeadBook: ls.HeadBook, lc: ls.lc}
+	ls.ThreadMetadata = &closingThreadMetadata{ThreadMetadata: ls.ThreadMetadata, lc: ls.lc}
+}
+
+func (b *closingKeyBook) Close() error        { return closeBook(b.KeyBook) }
+func (b *closingAddrBook) Close() error       { return closeBook(b.AddrBook) }
+func (b *closingHeadBook) Close() error       { return closeBook(b.HeadBook) }
+func (b *closingThreadMetadata) Close() error { return closeBook(b.ThreadMetadata) }
+
+func (b *closingKeyBook) ThreadDiskUsage(t thread.ID) (int64, error) { return diskUsage(b.KeyBook, t) }
+func (b *closingAddrBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.AddrBook, t)
+}
+func (b *closingHeadBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.HeadBook, t)
+}
+func (b *closingThreadMetadata) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.ThreadMetadata, t)
+}
+
+// closingKeyBook fails operations on a key book with core.ErrClosed once the
+// logstore is closed.
+type closingKeyBook struct {
+	core.KeyBook
+	lc *lifecycle
+}
+
+func (b *closingKeyBook) PubKey(t thread.ID, l thread.LogID) (v crypto.PubKey, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.PubKey(t, l)
+}
+
+func (b *closingKeyBook) AddPubKey(t thread.ID, l thread.LogID, pk crypto.PubKey) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.AddPubKey(t, l, pk)
+}
+
+func (b *closingKeyBook) RevokePubKey(t thread.ID, l thread.LogID) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.RevokePubKey(t, l)
+}
+
+func (b *closingKeyBook) IsRevoked(t thread.ID, l thread.LogID) (v bool, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.IsRevoked(t, l)
+}
+
+func (b *closingKeyBook) PrivKey(t thread.ID, l thread.LogID) (v crypto.PrivKey, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.PrivKey(t, l)
+}
+
+func (b *closingKeyBook) AddPrivKey(t thread.ID, l thread.LogID, sk crypto.PrivKey) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.AddPrivKey(t, l, sk)
+}
+
+func (b *closingKeyBook) HasPrivKey(t thread.ID, l thread.LogID) (v bool, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.HasPrivKey(t, l)
+}
+
+func (b *closingKeyBook) ReadKey(t thread.ID) (v *sym.Key, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ReadKey(t)
+}
+
+func (b *closingKeyBook) AddReadKey(t thread.ID, key *sym.Key) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.AddReadKey(t, key)
+}
+
+func (b *closingKeyBook) HasReadKey(t thread.ID) (v bool, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.HasReadKey(t)
+}
+
+func (b *closingKeyBook) ServiceKey(t thread.ID) (v *sym.Key, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ServiceKey(t)
+}
+
+func (b *closingKeyBook) AddServiceKey(t thread.ID, key *sym.Key) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.AddServiceKey(t, key)
+}
+
+func (b *closingKeyBook) HasServiceKey(t thread.ID) (v bool, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.HasServiceKey(t)
+}
+
+func (b *closingKeyBook) RotateReadKey(t thread.ID, key *sym.Key) (v int, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.RotateReadKey(t, key)
+}
+
+func (b *closingKeyBook) ReadKeyVersion(t thread.ID, version int) (v *sym.Key, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ReadKeyVersion(t, version)
+}
+
+func (b *closingKeyBook) ReadKeyVersions(t thread.ID) (v []core.KeyVersion, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ReadKeyVersions(t)
+}
+
+func (b *closingKeyBook) RotateServiceKey(t thread.ID, key *sym.Key) (v int, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.RotateServiceKey(t, key)
+}
+
+func (b *closingKeyBook) ServiceKeyVersion(t thread.ID, version int) (v *sym.Key, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ServiceKeyVersion(t, version)
+}
+
+func (b *closingKeyBook) ServiceKeyVersions(t thread.ID) (v []core.KeyVersion, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ServiceKeyVersions(t)
+}
+
+func (b *closingKeyBook) ClearKeys(t thread.ID) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ClearKeys(t)
+}
+
+func (b *closingKeyBook) ClearLogKeys(t thread.ID, l thread.LogID) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ClearLogKeys(t, l)
+}
+
+func (b *closingKeyBook) LogsWithKeys(t thread.ID) (v thread.LogIDSlice, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.LogsWithKeys(t)
+}
+
+func (b *closingKeyBook) ThreadsFromKeys() (v thread.IDSlice, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ThreadsFromKeys()
+}
+
+func (b *closingKeyBook) ThreadsWithLogKeys(l thread.LogID) (v thread.IDSlice, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.ThreadsWithLogKeys(l)
+}
+
+func (b *closingKeyBook) DumpKeys() (v core.DumpKeyBook, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.DumpKeys()
+}
+
+func (b *closingKeyBook) RestoreKeys(dump core.DumpKeyBook) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.KeyBook.RestoreKeys(dump)
+}
+
+// closingAddrBook fails operations on an addr book with core.ErrClosed once the
+// logstore is closed.
+type closingAddrBook struct {
+	core.AddrBook
+	lc *lifecycle
+}
+
+func (b *closingAddrBook) AddAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.AddAddr(t, l, addr, ttl)
+}
+
+func (b *closingAddrBook) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.AddAddrs(t, l, addrs, ttl)
+}
+
+func (b *closingAddrBook) SetAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.SetAddr(t, l, addr, ttl)
+}
+
+func (b *closingAddrBook) SetAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.SetAddrs(t, l, addrs, ttl)
+}
+
+func (b *closingAddrBook) AddAddrsFromSource(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.AddAddrsFromSource(t, l, addrs, ttl, src)
+}
+
+func (b *closingAddrBook) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.AddLogAddrsBulk(entries, ttl)
+}
+
+func (b *closingAddrBook) ConsumeLogRecord(t thread.ID, rec *record.Envelope, ttl time.Duration) (v bool, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.ConsumeLogRecord(t, rec, ttl)
+}
+
+func (b *closingAddrBook) LogRecord(t thread.ID, l thread.LogID) (v *record.Envelope, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.LogRecord(t, l)
+}
+
+func (b *closingAddrBook) RecordDial(t thread.ID, l thread.LogID, addr ma.Multiaddr, latency time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.RecordDial(t, l, addr, latency)
+}
+
+func (b *closingAddrBook) UpdateAddrs(t thread.ID, l thread.LogID, oldTTL time.Duration, newTTL time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.UpdateAddrs(t, l, oldTTL, newTTL)
+}
+
+func (b *closingAddrBook) Addrs(t thread.ID, l thread.LogID) (v []ma.Multiaddr, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.Addrs(t, l)
+}
+
+func (b *closingAddrBook) ForEachLogAddr(t thread.ID, l thread.LogID, fn func(ma.Multiaddr) bool) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.ForEachLogAddr(t, l, fn)
+}
+
+func (b *closingAddrBook) AddrsWithSource(t thread.ID, l thread.LogID) (v []core.ExpiredAddress, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.AddrsWithSource(t, l)
+}
+
+func (b *closingAddrBook) SortedAddrs(t thread.ID, l thread.LogID) (v []ma.Multiaddr, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.SortedAddrs(t, l)
+}
+
+func (b *closingAddrBook) AddrStream(ctx context.Context, t thread.ID, l thread.LogID) (v <-chan ma.Multiaddr, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.AddrStream(b.lc.bind(ctx), t, l)
+}
+
+func (b *closingAddrBook) ControlledAddrStream(ctx context.Context, t thread.ID, l thread.LogID) (v <-chan ma.Multiaddr, w core.AddrStreamControl, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.ControlledAddrStream(b.lc.bind(ctx), t, l)
+}
+
+func (b *closingAddrBook) ThreadAddrStream(ctx context.Context, t thread.ID) (v <-chan core.LogAddr, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.ThreadAddrStream(b.lc.bind(ctx), t)
+}
+
+func (b *closingAddrBook) ClearAddrs(t thread.ID, l thread.LogID) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.ClearAddrs(t, l)
+}
+
+func (b *closingAddrBook) LogsWithAddrs(t thread.ID) (v thread.LogIDSlice, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.LogsWithAddrs(t)
+}
+
+func (b *closingAddrBook) ThreadsFromAddrs() (v thread.IDSlice, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.ThreadsFromAddrs()
+}
+
+func (b *closingAddrBook) ThreadsWithLogAddrs(l thread.LogID) (v thread.IDSlice, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.ThreadsWithLogAddrs(l)
+}
+
+func (b *closingAddrBook) LogsWithAddr(addr ma.Multiaddr) (v []core.ThreadLog, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.LogsWithAddr(addr)
+}
+
+func (b *closingAddrBook) DumpAddrs() (v core.DumpAddrBook, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.DumpAddrs()
+}
+
+func (b *closingAddrBook) RestoreAddrs(dump core.DumpAddrBook) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.AddrBook.RestoreAddrs(dump)
+}
+
+// closingHeadBook fails operations on a head book with core.ErrClosed once the
+// logstore is closed.
+type closingHeadBook struct {
+	core.HeadBook
+	lc *lifecycle
+}
+
+func (b *closingHeadBook) AddHead(t thread.ID, l thread.LogID, head cid.Cid) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.AddHead(t, l, head)
+}
+
+func (b *closingHeadBook) AddHeads(t thread.ID, l thread.LogID, heads []cid.Cid) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.AddHeads(t, l, heads)
+}
+
+func (b *closingHeadBook) SetHead(t thread.ID, l thread.LogID, head cid.Cid) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.SetHead(t, l, head)
+}
+
+func (b *closingHeadBook) SetHeads(t thread.ID, l thread.LogID, heads []cid.Cid) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.SetHeads(t, l, heads)
+}
+
+func (b *closingHeadBook) Heads(t thread.ID, l thread.LogID) (v []cid.Cid, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.Heads(t, l)
+}
+
+func (b *closingHeadBook) ClearHeads(t thread.ID, l thread.LogID) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.ClearHeads(t, l)
+}
+
+func (b *closingHeadBook) DumpHeads() (v core.DumpHeadBook, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.DumpHeads()
+}
+
+func (b *closingHeadBook) RestoreHeads(dump core.DumpHeadBook) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.HeadBook.RestoreHeads(dump)
+}
+
+// closingThreadMetadata fails operations on a metadata book with core.ErrClosed once the
+// logstore is closed.
+type closingThreadMetadata struct {
+	core.ThreadMetadata
+	lc *lifecycle
+}
+
+func (b *closingThreadMetadata) GetInt64(t thread.ID, key string) (v *int64, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.GetInt64(t, key)
+}
+
+func (b *closingThreadMetadata) PutInt64(t thread.ID, key string, val int64) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.PutInt64(t, key, val)
+}
+
+func (b *closingThreadMetadata) GetString(t thread.ID, key string) (v *string, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.GetString(t, key)
+}
+
+func (b *closingThreadMetadata) PutString(t thread.ID, key string, val string) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.PutString(t, key, val)
+}
+
+func (b *closingThreadMetadata) GetBool(t thread.ID, key string) (v *bool, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.GetBool(t, key)
+}
+
+func (b *closingThreadMetadata) PutBool(t thread.ID, key string, val bool) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.PutBool(t, key, val)
+}
+
+func (b *closingThreadMetadata) GetBytes(t thread.ID, key string) (v *[]byte, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.GetBytes(t, key)
+}
+
+func (b *closingThreadMetadata) PutBytes(t thread.ID, key string, val []byte) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.PutBytes(t, key, val)
+}
+
+func (b *closingThreadMetadata) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.PutMetaWithTTL(t, key, val, ttl)
+}
+
+func (b *closingThreadMetadata) MetaKeys(t thread.ID) (v []string, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.MetaKeys(t)
+}
+
+func (b *closingThreadMetadata) DeleteMetaPrefix(t thread.ID, prefix string) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.DeleteMetaPrefix(t, prefix)
+}
+
+func (b *closingThreadMetadata) ClearMetadata(t thread.ID) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.ClearMetadata(t)
+}
+
+func (b *closingThreadMetadata) DumpMeta() (v core.DumpMetadata, err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.DumpMeta()
+}
+
+func (b *closingThreadMetadata) RestoreMeta(dump core.DumpMetadata) (err error) {
+	if err = b.lc.enter(); err != nil {
+		return
+	}
+	defer b.lc.exit()
+	return b.ThreadMetadata.RestoreMeta(dump)
+}
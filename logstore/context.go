@@ -0,0 +1,151 @@
+package logstore
+
+import (
+	"context"
+	"time"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+var _ core.ContextLogstore = (*logstore)(nil)
+
+// Context is checked before and after acquiring the lock, so an operation
+// never starts with an expired context. Operations run on a view bound to
+// the context, so that context observers can trace them and every step
+// reading or writing the books fails once the context is done. Writes
+// stopped this way are partial, they're ordered so that retrying them
+// completes them, and cleanups run to completion.
+
+// WithContext returns a view of the logstore bound to ctx, see bind.
+func (ls *logstore) WithContext(ctx context.Context) core.Logstore {
+	return ls.bind(ctx)
+}
+
+func (ls *logstore) ThreadsContext(ctx context.Context) (ids thread.IDSlice, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, done := ls.withContext(ctx, "Threads", thread.Undef)
+	defer done(&err)
+	ls.RLock()
+	defer ls.RUnlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return v.threads()
+}
+
+func (ls *logstore) AddThreadContext(ctx context.Context, info thread.Info) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, done := ls.withContext(ctx, "AddThread", info.ID)
+	defer done(&err)
+	ls.Lock()
+	defer ls.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return v.addThread(info)
+}
+
+func (ls *logstore) GetThreadContext(ctx context.Context, id thread.ID) (info thread.Info, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, done := ls.withContext(ctx, "GetThread", id)
+	defer done(&err)
+	ls.RLock()
+	defer ls.RUnlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	info, err = v.getThread(id)
+	if err == nil {
+		// the thread may hold many logs, don't return a result gathered
+		// past the deadline
+		err = ctx.Err()
+	}
+	return
+}
+
+func (ls *logstore) DeleteThreadContext(ctx context.Context, id thread.ID) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, done := ls.withContext(ctx, "DeleteThread", id)
+	defer done(&err)
+	ls.Lock()
+	defer ls.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return v.deleteThread(id)
+}
+
+func (ls *logstore) AddLogContext(ctx context.Context, id thread.ID, lg thread.LogInfo) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, done := ls.withContext(ctx, "AddLog", id)
+	defer done(&err)
+	ls.Lock()
+	defer ls.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return v.addLog(id, lg)
+}
+
+func (ls *logstore) GetLogContext(ctx context.Context, id thread.ID, lid thread.LogID) (info thread.LogInfo, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, done := ls.withContext(ctx, "GetLog", id)
+	defer done(&err)
+	ls.RLock()
+	defer ls.RUnlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return v.getLog(id, lid)
+}
+
+func (ls *logstore) DeleteLogContext(ctx context.Context, id thread.ID, lid thread.LogID) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v, done := ls.withContext(ctx, "DeleteLog", id)
+	defer done(&err)
+	ls.Lock()
+	defer ls.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return v.deleteLog(id, lid)
+}
+
+// ctxErr returns the error of a done context, nil for a nil context.
+func ctxErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// detachedContext keeps the values of a context, but is never done.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
@@ -0,0 +1,27 @@
+package logstore
+
+import (
+	"fmt"
+
+	core "github.com/textileio/go-threads/core/logstore"
+)
+
+// Copy writes all threads of src into dst, e.g. to migrate between logstore
+// implementations. Threads already present in dst are rejected with
+// ErrThreadExists.
+func Copy(dst, src core.Logstore) error {
+	ids, err := src.Threads()
+	if err != nil {
+		return fmt.Errorf("listing source threads: %w", err)
+	}
+	for _, id := range ids {
+		data, err := src.ExportThread(id)
+		if err != nil {
+			return fmt.Errorf("exporting thread %s: %w", id, err)
+		}
+		if err := dst.ImportThread(data); err != nil {
+			return fmt.Errorf("importing thread %s: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package logstore
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// canonicalHeader starts canonical dumps, followed by the format version.
+const canonicalHeader = "lstore canonical dump v1"
+
+// DumpCanonical writes contents of the entire store to w as sorted lines
+// of text, so that dumps of stores holding the same threads are equal and
+// diff well. Every line starts with the thread, followed by the kind of the
+// entry and its fields:
+//
+//	<thread> addr <log> <multiaddr>
+//	<thread> head <log> <cid>
+//	<thread> meta <quoted key> <type> <value>
+//	<thread> privkey <log>
+//	<thread> pubkey <log> <hex key>
+//	<thread> readkey <version> <fingerprint>
+//	<thread> record <log> <fingerprint>
+//	<thread> revoked <log>
+//	<thread> servicekey <version> <fingerprint>
+//
+// Secrets are left out or fingerprinted with a truncated SHA-256. So are
+// values expected to differ between nodes: address expirations, sources
+// and dial statistics, and creation times of keys.
+func (ls *logstore) DumpCanonical(w io.Writer) error {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	keys, err := ls.DumpKeys()
+	if err != nil {
+		return fmt.Errorf("dumping keys: %w", err)
+	}
+	for t, logs := range keys.Data.Public {
+		for l, pk := range logs {
+			data, err := crypto.MarshalPublicKey(pk)
+			if err != nil {
+				return fmt.Errorf("marshaling public key of log %s: %w", l, err)
+			}
+			add("%s pubkey %s %x", t, l, data)
+		}
+	}
+	for t, logs := range keys.Data.Private {
+		for l := range logs {
+			add("%s privkey %s", t, l)
+		}
+	}
+	symKeys := func(kind string, current map[thread.ID][]byte, history map[thread.ID][][]byte) {
+		for t, key := range current {
+			// the current key follows previous versions
+			for v, prev := range history[t] {
+				add("%s %s %d %s", t, kind, v, fingerprint(prev))
+			}
+			add("%s %s %d %s", t, kind, len(history[t]), fingerprint(key))
+		}
+	}
+	symKeys("readkey", keys.Data.Read, keys.Data.ReadHistory)
+	symKeys("servicekey", keys.Data.Service, keys.Data.ServiceHistory)
+	for t, logs := range keys.Data.Revoked {
+		for _, l := range logs {
+			add("%s revoked %s", t, l)
+		}
+	}
+
+	addrs, err := ls.DumpAddrs()
+	if err != nil {
+		return fmt.Errorf("dumping addresses: %w", err)
+	}
+	for t, logs := range addrs.Data {
+		for l, as := range logs {
+			for _, a := range as {
+				add("%s addr %s %s", t, l, a.Addr)
+			}
+		}
+	}
+	for t, logs := range addrs.Records {
+		for l, rec := range logs {
+			add("%s record %s %s", t, l, fingerprint(rec))
+		}
+	}
+
+	heads, err := ls.DumpHeads()
+	if err != nil {
+		return fmt.Errorf("dumping heads: %w", err)
+	}
+	for t, logs := range heads.Data {
+		for l, hs := range logs {
+			for _, h := range hs {
+				add("%s head %s %s", t, l, h)
+			}
+		}
+	}
+
+	meta, err := ls.DumpMeta()
+	if err != nil {
+		return fmt.Errorf("dumping metadata: %w", err)
+	}
+	for k, v := range meta.Data.Int64 {
+		add("%s meta %q int64 %d", k.T, k.K, v)
+	}
+	for k, v := range meta.Data.Bool {
+		add("%s meta %q bool %t", k.T, k.K, v)
+	}
+	for k, v := range meta.Data.String {
+		add("%s meta %q string %q", k.T, k.K, v)
+	}
+	for k, v := range meta.Data.Bytes {
+		add("%s meta %q bytes %x", k.T, k.K, v)
+	}
+
+	sort.Strings(lines)
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintln(bw, canonicalHeader); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// fingerprint identifies secret or large values in canonical dumps.
+func fingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,218 @@
+package logstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// EventBusCapacity is the buffer size of logstore event listeners. Events
+// are dropped for listeners lagging behind by more than that.
+var EventBusCapacity = 64
+
+// notifyTimeout is the duration to wait for a lagging listener to free up its buffer.
+const notifyTimeout = time.Millisecond * 100
+
+// Subscribe returns a channel delivering changes of a thread. The channel is
+// closed when the context is cancelled or the logstore is closed.
+func (ls *logstore) Subscribe(ctx context.Context, id thread.ID) (<-chan core.Event, error) {
+	if ls.lc.isClosed() {
+		return nil, core.ErrClosed
+	}
+	return ls.listen(ctx, func(ev core.Event) bool {
+		return ev.Thread.Equals(id)
+	}), nil
+}
+
+// Events returns a channel delivering creation and deletion of threads.
+func (ls *logstore) Events(ctx context.Context) <-chan core.Event {
+	return ls.listen(ctx, func(ev core.Event) bool {
+		return ev.Type == core.ThreadCreated || ev.Type == core.ThreadDeleted
+	})
+}
+
+func (ls *logstore) listen(ctx context.Context, filter func(core.Event) bool) <-chan core.Event {
+	channel := make(chan core.Event)
+	listener := ls.bus.Listen()
+	go func() {
+		defer close(channel)
+		defer listener.Discard()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case i, ok := <-listener.Channel():
+				if !ok {
+					return
+				}
+				ev, ok := i.(core.Event)
+				if !ok || !filter(ev) {
+					continue
+				}
+				select {
+				case channel <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return channel
+}
+
+func (ls *logstore) emit(ev core.Event) {
+	if ls.pending != nil {
+		// held back by a transaction until it's committed
+		*ls.pending = append(*ls.pending, ev)
+		return
+	}
+	ls.dispatch(ev)
+}
+
+// dispatch notifies hooks and listeners of the event.
+func (ls *logstore) dispatch(ev core.Event) {
+	ls.hooks.notify(ev)
+	if err := ls.bus.SendWithTimeout(ev, notifyTimeout); err != nil {
+		log.Warnf("dropped %s event of thread %s: %v", ev.Type, ev.Thread, err)
+	}
+}
+
+func (ls *logstore) AddAddr(id thread.ID, lid thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	if err := ls.AddrBook.AddAddr(id, lid, addr, ttl); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.AddrAdded, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) AddAddrs(id thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if err := ls.AddrBook.AddAddrs(id, lid, addrs, ttl); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.AddrAdded, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) AddAddrsFromSource(id thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) error {
+	if err := ls.AddrBook.AddAddrsFromSource(id, lid, addrs, ttl, src); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.AddrAdded, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	if err := ls.AddrBook.AddLogAddrsBulk(entries, ttl); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		ls.emit(core.Event{Type: core.AddrAdded, Thread: e.Thread, Log: e.Log})
+	}
+	return nil
+}
+
+func (ls *logstore) ConsumeLogRecord(id thread.ID, env *record.Envelope, ttl time.Duration) (bool, error) {
+	accepted, err := ls.AddrBook.ConsumeLogRecord(id, env, ttl)
+	if err != nil || !accepted {
+		return accepted, err
+	}
+	rec, _, err := core.OpenLogRecord(env)
+	if err != nil {
+		return accepted, err
+	}
+	ls.emit(core.Event{Type: core.AddrAdded, Thread: id, Log: thread.LogIDFromPeer(rec.PeerID)})
+	return true, nil
+}
+
+func (ls *logstore) SetAddr(id thread.ID, lid thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	if err := ls.AddrBook.SetAddr(id, lid, addr, ttl); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.AddrAdded, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) SetAddrs(id thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if err := ls.AddrBook.SetAddrs(id, lid, addrs, ttl); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.AddrAdded, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) AddHead(id thread.ID, lid thread.LogID, head cid.Cid) error {
+	if err := ls.HeadBook.AddHead(id, lid, head); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.HeadUpdated, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) AddHeads(id thread.ID, lid thread.LogID, heads []cid.Cid) error {
+	if err := ls.HeadBook.AddHeads(id, lid, heads); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.HeadUpdated, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) SetHead(id thread.ID, lid thread.LogID, head cid.Cid) error {
+	if err := ls.HeadBook.SetHead(id, lid, head); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.HeadUpdated, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) SetHeads(id thread.ID, lid thread.LogID, heads []cid.Cid) error {
+	if err := ls.HeadBook.SetHeads(id, lid, heads); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.HeadUpdated, Thread: id, Log: lid})
+	return nil
+}
+
+func (ls *logstore) putInt64(id thread.ID, key string, val int64) error {
+	if err := ls.ThreadMetadata.PutInt64(id, key, val); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.MetaChanged, Thread: id, Key: key})
+	return nil
+}
+
+func (ls *logstore) putString(id thread.ID, key string, val string) error {
+	if err := ls.ThreadMetadata.PutString(id, key, val); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.MetaChanged, Thread: id, Key: key})
+	return nil
+}
+
+func (ls *logstore) putBool(id thread.ID, key string, val bool) error {
+	if err := ls.ThreadMetadata.PutBool(id, key, val); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.MetaChanged, Thread: id, Key: key})
+	return nil
+}
+
+func (ls *logstore) putBytes(id thread.ID, key string, val []byte) error {
+	if err := ls.ThreadMetadata.PutBytes(id, key, val); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.MetaChanged, Thread: id, Key: key})
+	return nil
+}
+
+func (ls *logstore) putMetaWithTTL(id thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if err := ls.ThreadMetadata.PutMetaWithTTL(id, key, val, ttl); err != nil {
+		return err
+	}
+	ls.emit(core.Event{Type: core.MetaChanged, Thread: id, Key: key})
+	return nil
+}
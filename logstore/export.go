@@ -0,0 +1,401 @@
+package logstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+func init() {
+	cbornode.RegisterCborType(threadExport{})
+	cbornode.RegisterCborType(logExport{})
+}
+
+// threadExport is the full state of a thread, encoded with CBOR.
+type threadExport struct {
+	ID         []byte
+	ServiceKey []byte
+	ReadKey    []byte
+	// Previous keys of rotated service and read keys, ordered by version.
+	ServiceHistory [][]byte
+	ReadHistory    [][]byte
+	Logs           []logExport
+	Int64          map[string]int64
+	Bool           map[string]bool
+	String         map[string]string
+	Bytes          map[string][]byte
+	// Expires holds expiration times of metadata values stored with a TTL
+	// in unix nanoseconds.
+	Expires map[string]int64
+}
+
+type logExport struct {
+	ID      []byte
+	PubKey  []byte
+	PrivKey []byte
+	Addrs   [][]byte
+	// Expires holds address expiration times in unix seconds.
+	Expires []int64
+	// Sources holds address sources, absent in exports of older versions.
+	Sources []string
+	Heads   [][]byte
+	Revoked bool
+}
+
+// ExportThread serializes all keys, logs, addresses, heads and metadata of
+// a thread into a portable blob.
+func (ls *logstore) ExportThread(id thread.ID) ([]byte, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, core.ErrThreadNotFound
+	}
+	return ls.exportThread(id)
+}
+
+// ImportThread restores a thread from a blob created by ExportThread.
+func (ls *logstore) ImportThread(data []byte) error {
+	te, id, err := decodeThread(data)
+	if err != nil {
+		return fmt.Errorf("decoding thread: %w", err)
+	}
+
+	ls.Lock()
+	defer ls.Unlock()
+
+	return ls.importThread(id, te)
+}
+
+// RedactExport removes the secrets, private keys of logs and read keys of
+// the thread, from a blob created by ExportThread. Importing the result
+// leaves the thread unable to sign records or decrypt their bodies.
+func RedactExport(data []byte) ([]byte, error) {
+	te, _, err := decodeThread(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding thread: %w", err)
+	}
+	te.ReadKey, te.ReadHistory = nil, nil
+	for i := range te.Logs {
+		te.Logs[i].PrivKey = nil
+	}
+	return cbornode.DumpObject(te)
+}
+
+func (ls *logstore) exportThread(id thread.ID) ([]byte, error) {
+	te, err := ls.threadState(id)
+	if err != nil {
+		return nil, err
+	}
+	return cbornode.DumpObject(te)
+}
+
+// threadState collects the full state of the thread.
+func (ls *logstore) threadState(id thread.ID) (*threadExport, error) {
+	te := &threadExport{ID: id.Bytes()}
+	sk, err := ls.ServiceKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if sk != nil {
+		te.ServiceKey = sk.Bytes()
+	}
+	rk, err := ls.ReadKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if rk != nil {
+		te.ReadKey = rk.Bytes()
+	}
+	if te.ServiceHistory, err = keyHistory(id, ls.ServiceKeyVersion); err != nil {
+		return nil, err
+	}
+	if te.ReadHistory, err = keyHistory(id, ls.ReadKeyVersion); err != nil {
+		return nil, err
+	}
+
+	set, err := ls.getLogIDs(id)
+	if err != nil {
+		return nil, err
+	}
+	for lid := range set {
+		le := logExport{ID: []byte(lid)}
+		pk, err := ls.PubKey(id, lid)
+		if err != nil {
+			return nil, err
+		}
+		if pk != nil {
+			if le.PubKey, err = crypto.MarshalPublicKey(pk); err != nil {
+				return nil, err
+			}
+		}
+		sk, err := ls.PrivKey(id, lid)
+		if err != nil {
+			return nil, err
+		}
+		if sk != nil {
+			if le.PrivKey, err = crypto.MarshalPrivateKey(sk); err != nil {
+				return nil, err
+			}
+		}
+		if le.Revoked, err = ls.IsRevoked(id, lid); err != nil {
+			return nil, err
+		}
+		addrs, err := ls.AddrsWithSource(id, lid)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			le.Addrs = append(le.Addrs, a.Addr.Bytes())
+			le.Expires = append(le.Expires, a.Expires.Unix())
+			le.Sources = append(le.Sources, string(a.Source))
+		}
+		heads, err := ls.Heads(id, lid)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range heads {
+			le.Heads = append(le.Heads, h.Bytes())
+		}
+		te.Logs = append(te.Logs, le)
+	}
+
+	meta, err := ls.threadMetadata(id)
+	if err != nil {
+		return nil, err
+	}
+	te.Int64 = meta.Int64
+	te.Bool = meta.Bool
+	te.String = meta.String
+	te.Bytes = meta.Bytes
+	for k, exp := range meta.Expires {
+		if te.Expires == nil {
+			te.Expires = make(map[string]int64)
+		}
+		te.Expires[k] = exp.UnixNano()
+	}
+	return te, nil
+}
+
+// currentState returns the full state of the thread, nil if it's missing.
+func (ls *logstore) currentState(id thread.ID) (*threadExport, error) {
+	exists, err := ls.threadExists(id)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return ls.threadState(id)
+}
+
+// revertThread replaces the thread with its previous state, removing it if
+// the state is nil.
+func (ls *logstore) revertThread(id thread.ID, prev *threadExport) error {
+	ls = ls.withoutCancel()
+	if err := ls.clearThread(id); err != nil {
+		return fmt.Errorf("reverting thread %s: %w", id, err)
+	}
+	if prev == nil {
+		return nil
+	}
+	if err := ls.restoreThread(id, *prev); err != nil {
+		return fmt.Errorf("reverting thread %s: %w", id, err)
+	}
+	return nil
+}
+
+// keyHistory returns all key versions but the current one.
+func keyHistory(id thread.ID, version func(thread.ID, int) (*sym.Key, error)) ([][]byte, error) {
+	var keys [][]byte
+	for v := 0; ; v++ {
+		k, err := version(id, v)
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			break
+		}
+		keys = append(keys, k.Bytes())
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys[:len(keys)-1], nil
+}
+
+func decodeThread(data []byte) (te threadExport, id thread.ID, err error) {
+	if err = cbornode.DecodeInto(data, &te); err != nil {
+		return
+	}
+	id, err = thread.Cast(te.ID)
+	return
+}
+
+// importThread restores the thread, removing partially imported state on failure.
+func (ls *logstore) importThread(id thread.ID, te threadExport) error {
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return core.ErrThreadExists
+	}
+	if err := ls.restoreThread(id, te); err != nil {
+		if derr := ls.withoutCancel().clearThread(id); derr != nil {
+			return fmt.Errorf("importing thread %s: %w, cleaning up: %s", id, err, derr)
+		}
+		return fmt.Errorf("importing thread %s: %w", id, err)
+	}
+	ls.emit(core.Event{Type: core.ThreadCreated, Thread: id})
+	return nil
+}
+
+// restoreKey stores previous keys and the current one by rotating through them.
+func restoreKey(id thread.ID, history [][]byte, current []byte, rotate func(thread.ID, *sym.Key) (int, error)) error {
+	keys := append(append([][]byte(nil), history...), current)
+	for _, b := range keys {
+		k, err := sym.FromBytes(b)
+		if err != nil {
+			return err
+		}
+		if _, err := rotate(id, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ls *logstore) restoreThread(id thread.ID, te threadExport) error {
+	// the creation time comes first to register the thread in strict mode
+	if created, ok := te.Int64[core.MetaThreadCreated]; ok {
+		if err := ls.putInt64(id, core.MetaThreadCreated, created); err != nil {
+			return err
+		}
+	} else if ls.opts.Strict {
+		if err := ls.putInt64(id, core.MetaThreadCreated, time.Now().UnixNano()); err != nil {
+			return err
+		}
+	}
+	if te.ServiceKey != nil {
+		if err := restoreKey(id, te.ServiceHistory, te.ServiceKey, ls.RotateServiceKey); err != nil {
+			return err
+		}
+	}
+	if te.ReadKey != nil {
+		if err := restoreKey(id, te.ReadHistory, te.ReadKey, ls.RotateReadKey); err != nil {
+			return err
+		}
+	}
+
+	var now = time.Now()
+	for _, le := range te.Logs {
+		lid, err := thread.LogIDFromBytes(le.ID)
+		if err != nil {
+			return err
+		}
+		if le.PubKey != nil {
+			pk, err := crypto.UnmarshalPublicKey(le.PubKey)
+			if err != nil {
+				return err
+			}
+			if err := ls.AddPubKey(id, lid, pk); err != nil {
+				return err
+			}
+		}
+		if le.PrivKey != nil {
+			sk, err := crypto.UnmarshalPrivateKey(le.PrivKey)
+			if err != nil {
+				return err
+			}
+			if err := ls.AddPrivKey(id, lid, sk); err != nil {
+				return err
+			}
+		}
+		if le.Revoked {
+			if err := ls.RevokePubKey(id, lid); err != nil {
+				return err
+			}
+		}
+		if len(le.Addrs) != len(le.Expires) {
+			return fmt.Errorf("log %s has %d addresses but %d expiration times", lid, len(le.Addrs), len(le.Expires))
+		}
+		if le.Sources != nil && len(le.Sources) != len(le.Addrs) {
+			return fmt.Errorf("log %s has %d addresses but %d sources", lid, len(le.Addrs), len(le.Sources))
+		}
+		for i, b := range le.Addrs {
+			ttl := time.Unix(le.Expires[i], 0).Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+			addr, err := ma.NewMultiaddrBytes(b)
+			if err != nil {
+				return err
+			}
+			var src core.AddrSource
+			if le.Sources != nil {
+				src = core.AddrSource(le.Sources[i])
+			}
+			if err := ls.AddAddrsFromSource(id, lid, []ma.Multiaddr{addr}, ttl, src); err != nil {
+				return err
+			}
+		}
+		if len(le.Heads) > 0 {
+			heads := make([]cid.Cid, len(le.Heads))
+			for i, b := range le.Heads {
+				h, err := cid.Cast(b)
+				if err != nil {
+					return err
+				}
+				heads[i] = h
+			}
+			if err := ls.SetHeads(id, lid, heads); err != nil {
+				return err
+			}
+		}
+	}
+
+	for k, v := range te.Int64 {
+		if err := ls.restoreMeta(id, te, k, v, now, func() error { return ls.putInt64(id, k, v) }); err != nil {
+			return err
+		}
+	}
+	for k, v := range te.Bool {
+		if err := ls.restoreMeta(id, te, k, v, now, func() error { return ls.putBool(id, k, v) }); err != nil {
+			return err
+		}
+	}
+	for k, v := range te.String {
+		if err := ls.restoreMeta(id, te, k, v, now, func() error { return ls.putString(id, k, v) }); err != nil {
+			return err
+		}
+	}
+	for k, v := range te.Bytes {
+		if err := ls.restoreMeta(id, te, k, v, now, func() error { return ls.putBytes(id, k, v) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreMeta stores the metadata value with put, or with the remaining TTL
+// if it was stored with one. Expired values are skipped.
+func (ls *logstore) restoreMeta(id thread.ID, te threadExport, key string, val interface{}, now time.Time, put func() error) error {
+	exp, ok := te.Expires[key]
+	if !ok {
+		return put()
+	}
+	ttl := time.Unix(0, exp).Sub(now)
+	if ttl <= 0 {
+		return nil
+	}
+	return ls.putMetaWithTTL(id, key, val, ttl)
+}
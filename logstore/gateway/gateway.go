@@ -0,0 +1,188 @@
+// Package gateway serves a read-only HTTP view of a logstore with JSON
+// output, meant for dashboards and debugging. Keys of threads and logs are
+// never exposed, except for public keys of logs.
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	logging "github.com/ipfs/go-log"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	lstore "github.com/textileio/go-threads/logstore"
+)
+
+var log = logging.Logger("gateway")
+
+// Config specifies gateway settings.
+type Config struct {
+	// Token is the bearer token required with every request. Requests are
+	// not authenticated if empty.
+	Token string
+}
+
+// Gateway is an http.Handler serving the endpoints:
+//
+//	GET /threads                            IDs of all threads
+//	GET /threads/{id}                       logs of a thread
+//	GET /threads/{id}/logs/{pid}/addrs      addresses of a log
+type Gateway struct {
+	store core.Logstore
+	token string
+}
+
+var _ http.Handler = (*Gateway)(nil)
+
+// NewGateway returns a gateway to a read-only view of the logstore.
+func NewGateway(store core.Logstore, conf Config) *Gateway {
+	return &Gateway{store: lstore.ReadOnly(store), token: conf.Token}
+}
+
+// LogJSON is the JSON form of a log.
+type LogJSON struct {
+	ID     string   `json:"id"`
+	PubKey string   `json:"pubKey"`
+	Addrs  []string `json:"addrs"`
+	Head   string   `json:"head,omitempty"`
+}
+
+// ThreadJSON is the JSON form of a thread.
+type ThreadJSON struct {
+	ID   string    `json:"id"`
+	Logs []LogJSON `json:"logs"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !g.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "threads":
+		g.listThreads(w)
+	case len(parts) == 2 && parts[0] == "threads":
+		g.getThread(w, parts[1])
+	case len(parts) == 5 && parts[0] == "threads" && parts[2] == "logs" && parts[4] == "addrs":
+		g.getAddrs(w, parts[1], parts[3])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (g *Gateway) authorized(r *http.Request) bool {
+	if g.token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1
+}
+
+func (g *Gateway) listThreads(w http.ResponseWriter) {
+	ids, err := g.store.Threads()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	res := make([]string, len(ids))
+	for i, id := range ids {
+		res[i] = id.String()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (g *Gateway) getThread(w http.ResponseWriter, tid string) {
+	id, err := thread.ParseID(tid)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid thread ID")
+		return
+	}
+	info, err := g.store.GetThread(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	res := ThreadJSON{ID: info.ID.String(), Logs: make([]LogJSON, len(info.Logs))}
+	for i, lg := range info.Logs {
+		res.Logs[i] = LogJSON{
+			ID:     lg.ID.String(),
+			PubKey: thread.NewLibp2pPubKey(lg.PubKey).String(),
+			Addrs:  make([]string, len(lg.Addrs)),
+		}
+		for j, addr := range lg.Addrs {
+			res.Logs[i].Addrs[j] = addr.String()
+		}
+		if lg.Head.Defined() {
+			res.Logs[i].Head = lg.Head.String()
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (g *Gateway) getAddrs(w http.ResponseWriter, tid, lid string) {
+	id, err := thread.ParseID(tid)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid thread ID")
+		return
+	}
+	pid, err := thread.DecodeLogID(lid)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid log ID")
+		return
+	}
+	if _, err := g.store.GetLog(id, pid); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	addrs, err := g.store.Addrs(id, pid)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	res := make([]string, len(addrs))
+	for i, addr := range addrs {
+		res[i] = addr.String()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrThreadNotFound), errors.Is(err, core.ErrLogNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		log.Errorf("error reading logstore: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorJSON{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("error writing response: %v", err)
+	}
+}
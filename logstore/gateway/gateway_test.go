@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/textileio/go-threads/core/thread"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+)
+
+func TestGateway(t *testing.T) {
+	ls := lstoremem.NewLogstore()
+	tid := thread.NewIDV1(thread.Raw, 32)
+	checkErr(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	lid, err := thread.LogIDFromPrivKey(sk)
+	checkErr(t, err)
+	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4006")
+	checkErr(t, err)
+	checkErr(t, ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk, Addrs: []ma.Multiaddr{addr}}))
+
+	srv := httptest.NewServer(NewGateway(ls, Config{Token: "secret"}))
+	defer srv.Close()
+	get := func(path, token string, v interface{}) int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		checkErr(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		checkErr(t, err)
+		defer res.Body.Close()
+		if v != nil && res.StatusCode == http.StatusOK {
+			checkErr(t, json.NewDecoder(res.Body).Decode(v))
+		}
+		return res.StatusCode
+	}
+
+	if code := get("/threads", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without a token, got %d", http.StatusUnauthorized, code)
+	}
+	if code := get("/threads", "wrong", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d with a wrong token, got %d", http.StatusUnauthorized, code)
+	}
+
+	var ids []string
+	if code := get("/threads", "secret", &ids); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if len(ids) != 1 || ids[0] != tid.String() {
+		t.Fatalf("expected thread %s, got %v", tid, ids)
+	}
+
+	var info ThreadJSON
+	if code := get("/threads/"+tid.String(), "secret", &info); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if info.ID != tid.String() || len(info.Logs) != 1 || info.Logs[0].ID != lid.String() {
+		t.Fatalf("got bad thread %v", info)
+	}
+
+	var addrs []string
+	if code := get("/threads/"+tid.String()+"/logs/"+lid.String()+"/addrs", "secret", &addrs); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if len(addrs) != 1 || addrs[0] != addr.String() {
+		t.Fatalf("expected address %s, got %v", addr, addrs)
+	}
+
+	for path, expected := range map[string]int{
+		"/threads/invalid":                                    http.StatusBadRequest,
+		"/threads/" + tid.String() + "/other":                 http.StatusNotFound,
+		"/threads/" + thread.NewIDV1(thread.Raw, 32).String(): http.StatusNotFound,
+		"/threads/" + tid.String() + "/logs/invalid/addrs":    http.StatusBadRequest,
+	} {
+		if code := get(path, "secret", nil); code != expected {
+			t.Fatalf("expected status %d for %s, got %d", expected, path, code)
+		}
+	}
+}
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,141 @@
+package logstore
+
+import (
+	"sync"
+
+	core "github.com/textileio/go-threads/core/logstore"
+)
+
+// hooks holds the hooks registered with a logstore, in order of
+// registration.
+type hooks struct {
+	lock   sync.RWMutex
+	active []*hook
+	closed bool
+}
+
+type hook struct {
+	core.Hook
+
+	// changes queued for async hooks
+	lock    sync.Mutex
+	cond    *sync.Cond
+	queue   []core.Event
+	stopped bool
+	done    chan struct{}
+}
+
+// RegisterHook calls the hook with subsequent changes until the returned
+// function is called or the logstore is closed. Changes queued for an async
+// hook are still delivered then, and Close waits for them.
+func (ls *logstore) RegisterHook(h core.Hook) (unregister func()) {
+	hk := &hook{Hook: h, done: make(chan struct{})}
+	hk.cond = sync.NewCond(&hk.lock)
+
+	ls.hooks.lock.Lock()
+	defer ls.hooks.lock.Unlock()
+	if ls.hooks.closed {
+		return func() {}
+	}
+	ls.hooks.active = append(ls.hooks.active, hk)
+	if h.Async {
+		go hk.run()
+	}
+	return func() {
+		ls.hooks.remove(hk)
+		hk.stop()
+	}
+}
+
+// notify calls or queues hooks with the change.
+func (hs *hooks) notify(ev core.Event) {
+	hs.lock.RLock()
+	active := hs.active
+	hs.lock.RUnlock()
+	for _, h := range active {
+		if h.Async {
+			h.enqueue(ev)
+		} else {
+			h.call(ev)
+		}
+	}
+}
+
+func (hs *hooks) remove(h *hook) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+	for i, a := range hs.active {
+		if a == h {
+			// copied, so that notifications in flight are unaffected
+			active := make([]*hook, 0, len(hs.active)-1)
+			hs.active = append(append(active, hs.active[:i]...), hs.active[i+1:]...)
+			return
+		}
+	}
+}
+
+// close unregisters all hooks and waits for async ones to deliver queued
+// changes.
+func (hs *hooks) close() {
+	hs.lock.Lock()
+	active := hs.active
+	hs.active, hs.closed = nil, true
+	hs.lock.Unlock()
+	for _, h := range active {
+		h.stop()
+		if h.Async {
+			<-h.done
+		}
+	}
+}
+
+func (h *hook) call(ev core.Event) {
+	switch ev.Type {
+	case core.ThreadDeleted, core.LogDeleted:
+		if h.OnDelete != nil {
+			h.OnDelete(ev)
+		}
+	default:
+		if h.OnPut != nil {
+			h.OnPut(ev)
+		}
+	}
+}
+
+func (h *hook) enqueue(ev core.Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.stopped {
+		return
+	}
+	h.queue = append(h.queue, ev)
+	h.cond.Signal()
+}
+
+func (h *hook) stop() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stopped = true
+	h.cond.Signal()
+}
+
+// run delivers queued changes until the hook is stopped and the queue is
+// drained.
+func (h *hook) run() {
+	defer close(h.done)
+	for {
+		h.lock.Lock()
+		for len(h.queue) == 0 && !h.stopped {
+			h.cond.Wait()
+		}
+		if len(h.queue) == 0 {
+			h.lock.Unlock()
+			return
+		}
+		ev := h.queue[0]
+		h.queue[0] = core.Event{}
+		h.queue = h.queue[1:]
+		h.lock.Unlock()
+		h.call(ev)
+	}
+}
@@ -0,0 +1,242 @@
+package logstore
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+func init() {
+	cbornode.RegisterCborType(invite{})
+	cbornode.RegisterCborType(inviteContent{})
+	cbornode.RegisterCborType(inviteLog{})
+}
+
+// inviteVersion is the format version of thread invites.
+const inviteVersion = 1
+
+// invite holds inviteContent, encoded with CBOR. The content is encrypted
+// with a key derived from the password if Salt is set.
+type invite struct {
+	Version int
+	Salt    []byte
+	Data    []byte
+}
+
+// inviteContent is what a peer needs to follow a thread.
+type inviteContent struct {
+	ID         []byte
+	ServiceKey []byte
+	ReadKey    []byte
+	Logs       []inviteLog
+}
+
+type inviteLog struct {
+	ID     []byte
+	PubKey []byte
+	Addrs  [][]byte
+}
+
+// CreateInvite packs the thread ID, service key and public keys along with
+// addresses of non-revoked logs into an invite. The read key is included only
+// if withReadKey is set. A non-empty password encrypts the invite.
+func (ls *logstore) CreateInvite(id thread.ID, withReadKey bool, password string) ([]byte, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	info, err := ls.getThread(id)
+	if err != nil {
+		return nil, err
+	}
+	ic := inviteContent{
+		ID:         id.Bytes(),
+		ServiceKey: info.Key.Service().Bytes(),
+	}
+	if withReadKey && info.Key.CanRead() {
+		ic.ReadKey = info.Key.Read().Bytes()
+	}
+	for _, lg := range info.Logs {
+		if lg.PubKey == nil {
+			continue
+		}
+		revoked, err := ls.IsRevoked(id, lg.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			continue
+		}
+		il := inviteLog{ID: []byte(lg.ID)}
+		if il.PubKey, err = crypto.MarshalPublicKey(lg.PubKey); err != nil {
+			return nil, err
+		}
+		for _, a := range lg.Addrs {
+			il.Addrs = append(il.Addrs, a.Bytes())
+		}
+		ic.Logs = append(ic.Logs, il)
+	}
+	data, err := cbornode.DumpObject(ic)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := invite{Version: inviteVersion, Data: data}
+	if password != "" {
+		inv.Salt = make([]byte, saltLength)
+		if _, err := rand.Read(inv.Salt); err != nil {
+			return nil, err
+		}
+		key, err := bundleKey(password, inv.Salt)
+		if err != nil {
+			return nil, err
+		}
+		if inv.Data, err = key.Encrypt(data); err != nil {
+			return nil, err
+		}
+	}
+	return cbornode.DumpObject(inv)
+}
+
+// AcceptInvite adds the thread and its logs from an invite created by
+// CreateInvite. Keys of a thread already present must match the invite.
+// The invite is applied as a whole: on failure the thread is reverted to its
+// previous state, and events are emitted only once all of it is stored.
+func (ls *logstore) AcceptInvite(data []byte, password string) (thread.Info, error) {
+	info, err := openInvite(data, password)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	id, logs := info.ID, info.Logs
+
+	// validate all logs before anything is stored
+	for _, lg := range logs {
+		if !lg.ID.MatchesPublicKey(lg.PubKey) {
+			return thread.Info{}, fmt.Errorf("decoding invite: %w: log %s does not match its public key", core.ErrInvalidKey, lg.ID)
+		}
+	}
+
+	ls.Lock()
+	defer ls.Unlock()
+
+	// remember the state of the thread to revert it on failure
+	prev, err := ls.currentState(id)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	// events are held back until the whole invite is applied
+	v := *ls
+	v.pending = &[]core.Event{}
+	if err := v.acceptInvite(id, info.Key, logs); err != nil {
+		if rerr := v.revertThread(id, prev); rerr != nil {
+			return thread.Info{}, fmt.Errorf("%w, reverting: %s", err, rerr)
+		}
+		return thread.Info{}, err
+	}
+	for _, ev := range *v.pending {
+		ls.dispatch(ev)
+	}
+	return ls.getThread(id)
+}
+
+// openInvite decodes the thread ID, keys and logs of an invite.
+func openInvite(data []byte, password string) (thread.Info, error) {
+	ic, err := decodeInvite(data, password)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	id, err := thread.Cast(ic.ID)
+	if err != nil {
+		return thread.Info{}, fmt.Errorf("decoding invite: %w", err)
+	}
+	sk, err := sym.FromBytes(ic.ServiceKey)
+	if err != nil {
+		return thread.Info{}, fmt.Errorf("decoding invite: %w", err)
+	}
+	var rk *sym.Key
+	if ic.ReadKey != nil {
+		if rk, err = sym.FromBytes(ic.ReadKey); err != nil {
+			return thread.Info{}, fmt.Errorf("decoding invite: %w", err)
+		}
+	}
+	logs := make([]thread.LogInfo, len(ic.Logs))
+	for i, il := range ic.Logs {
+		lg := &logs[i]
+		if lg.ID, err = thread.LogIDFromBytes(il.ID); err != nil {
+			return thread.Info{}, fmt.Errorf("decoding invite: %w", err)
+		}
+		if lg.PubKey, err = crypto.UnmarshalPublicKey(il.PubKey); err != nil {
+			return thread.Info{}, fmt.Errorf("decoding invite: %w", err)
+		}
+		for _, b := range il.Addrs {
+			addr, err := ma.NewMultiaddrBytes(b)
+			if err != nil {
+				return thread.Info{}, fmt.Errorf("decoding invite: %w", err)
+			}
+			lg.Addrs = append(lg.Addrs, addr)
+		}
+	}
+	return thread.Info{ID: id, Key: thread.NewKey(sk, rk), Logs: logs}, nil
+}
+
+func (ls *logstore) acceptInvite(id thread.ID, key thread.Key, logs []thread.LogInfo) error {
+	// invites register threads in strict mode
+	var registered bool
+	if err := ls.checkCreated(id); errors.Is(err, core.ErrThreadNotFound) {
+		if err := ls.putInt64(id, core.MetaThreadCreated, time.Now().UnixNano()); err != nil {
+			return err
+		}
+		registered = true
+	} else if err != nil {
+		return err
+	}
+	if err := ls.addThread(thread.Info{ID: id, Key: key}); err != nil {
+		return err
+	}
+	if registered {
+		ls.emit(core.Event{Type: core.ThreadCreated, Thread: id})
+	}
+	for _, lg := range logs {
+		if err := ls.addLog(id, lg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeInvite(data []byte, password string) (ic inviteContent, err error) {
+	var inv invite
+	if err = cbornode.DecodeInto(data, &inv); err != nil {
+		return ic, fmt.Errorf("decoding invite: %w", err)
+	}
+	if inv.Version != inviteVersion {
+		return ic, fmt.Errorf("unsupported invite version %d", inv.Version)
+	}
+	content := inv.Data
+	if inv.Salt != nil {
+		if password == "" {
+			return ic, fmt.Errorf("invite is encrypted, a password is required")
+		}
+		key, err := bundleKey(password, inv.Salt)
+		if err != nil {
+			return ic, err
+		}
+		if len(inv.Data) < sym.NonceBytes {
+			return ic, fmt.Errorf("invite is too short")
+		}
+		if content, err = key.Decrypt(inv.Data); err != nil {
+			return ic, fmt.Errorf("decrypting invite: wrong password or corrupted invite")
+		}
+	}
+	if err = cbornode.DecodeInto(content, &ic); err != nil {
+		return ic, fmt.Errorf("decoding invite: %w", err)
+	}
+	return ic, nil
+}
@@ -0,0 +1,1102 @@
+package logstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// A journal is a sequence of entries, each a uvarint length followed by the
+// entry encoded with CBOR, so that journals can be appended to across
+// restarts. Entries are appended before their write is applied, and are
+// followed by an abort entry if it fails.
+
+func init() {
+	cbornode.RegisterCborType(journalRecord{})
+}
+
+// maxJournalEntry caps the size of a journal entry, so that corrupt
+// journals don't exhaust memory.
+const maxJournalEntry = 1 << 30
+
+// WithJournal records every write to the books in a journal appended to w,
+// e.g. for audit or point-in-time recovery with Replay. Writes are recorded
+// before they are applied, and are serialized meanwhile, so that the
+// journal holds them in order. Writes failing to apply are aborted in the
+// journal, and skipped by ReadJournal. Once appending to w fails, writes
+// fail without being applied.
+//
+// Secrets, i.e. private keys of logs and read and service keys of threads,
+// are only journaled if a key is given with WithJournalKey, and are left
+// out otherwise, so that replayed logstores lack them.
+func WithJournal(w io.Writer) Option {
+	return func(opts *Options) {
+		opts.Journal = w
+	}
+}
+
+// WithJournalKey journals secrets encrypted with the key, which Replay
+// needs to decrypt them.
+func WithJournalKey(key *sym.Key) Option {
+	return func(opts *Options) {
+		opts.JournalKey = key
+	}
+}
+
+// opAbort aborts the preceding entry, whose write failed.
+const opAbort = "Abort"
+
+// JournalEntry is a write recorded in a journal.
+type JournalEntry struct {
+	// Time of the write.
+	Time time.Time
+	// Op is the name of the book method, e.g. AddPubKey.
+	Op string
+	// Thread is undefined for writes spanning threads.
+	Thread thread.ID
+	// Log is set for writes of a log.
+	Log thread.LogID
+
+	rec journalRecord
+}
+
+// journalRecord is the encoding of a journal entry. Dumps of restores are
+// encoded as rows of the same type.
+type journalRecord struct {
+	Time   int64 // unix nanoseconds
+	Op     string
+	Thread []byte
+	Log    []byte
+	Key    string
+	Str    string
+	Bool   bool
+	Int    int64
+	Ints   []int64
+	Bytes  []byte
+	List   [][]byte
+	TTL    int64
+	NewTTL int64
+	Rows   []journalRecord
+	// Sealed holds secrets of the entry, see journal.seal.
+	Sealed []byte
+}
+
+// journal serializes writes and appends them to w.
+type journal struct {
+	lock sync.Mutex
+	w    io.Writer
+	key  *sym.Key
+	err  error
+}
+
+func (ls *logstore) journalBooks(w io.Writer, key *sym.Key) {
+	j := &journal{w: w, key: key}
+	ls.KeyBook = &journaledKeyBook{KeyBook: ls.KeyBook, j: j}
+	ls.AddrBook = &journaledAddrBook{AddrBook: ls.AddrBook, j: j}
+	ls.HeadBook = &journaledHeadBook{HeadBook: ls.HeadBook, j: j}
+	ls.ThreadMetadata = &journaledThreadMetadata{ThreadMetadata: ls.ThreadMetadata, j: j}
+}
+
+// record appends the record of the write to the journal, and applies the
+// write. If it fails, the record is aborted.
+func (j *journal) record(apply func() error, rec journalRecord) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.err != nil {
+		return fmt.Errorf("journal failed: %w", j.err)
+	}
+	rec.Time = time.Now().UnixNano()
+	if err := j.append(rec); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		if aerr := j.append(journalRecord{Op: opAbort, Time: rec.Time}); aerr != nil {
+			return fmt.Errorf("%w, aborting: %s", err, aerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// recordSecret is like record for writes of a secret, which is sealed in
+// the record. Without a journal key, the write is applied but not recorded.
+func (j *journal) recordSecret(apply func() error, rec, secret journalRecord) error {
+	sealed, err := j.seal(&rec, secret)
+	if err != nil {
+		return err
+	}
+	if !sealed {
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		if j.err != nil {
+			return fmt.Errorf("journal failed: %w", j.err)
+		}
+		return apply()
+	}
+	return j.record(apply, rec)
+}
+
+func (j *journal) append(rec journalRecord) error {
+	data, err := cbornode.DumpObject(rec)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", rec.Op, err)
+	}
+	var size [binary.MaxVarintLen64]byte
+	buf := append(size[:binary.PutUvarint(size[:], uint64(len(data)))], data...)
+	if _, err := j.w.Write(buf); err != nil {
+		return j.fail(rec.Op, err)
+	}
+	return nil
+}
+
+// seal encrypts the secret with the journal key into Sealed of the record,
+// bound to its op, thread and log. Without a key, the secret is dropped and
+// seal returns false.
+func (j *journal) seal(rec *journalRecord, secret journalRecord) (bool, error) {
+	if j.key == nil {
+		return false, nil
+	}
+	data, err := cbornode.DumpObject(secret)
+	if err != nil {
+		return false, err
+	}
+	ad, err := sealedData(*rec)
+	if err != nil {
+		return false, err
+	}
+	if rec.Sealed, err = j.key.EncryptWithAD(data, ad); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// unseal moves the secret sealed in the record back into its Bytes and
+// Rows.
+func unseal(rec journalRecord, key *sym.Key) (journalRecord, error) {
+	if rec.Sealed == nil {
+		return rec, nil
+	}
+	if key == nil {
+		return rec, fmt.Errorf("%s holds secrets, but no journal key was given", rec.Op)
+	}
+	ad, err := sealedData(rec)
+	if err != nil {
+		return rec, err
+	}
+	data, err := key.DecryptWithAD(rec.Sealed, ad)
+	if err != nil {
+		return rec, fmt.Errorf("decrypting secrets of %s: %w", rec.Op, err)
+	}
+	var secret journalRecord
+	if err := cbornode.DecodeInto(data, &secret); err != nil {
+		return rec, fmt.Errorf("decoding secrets of %s: %w", rec.Op, err)
+	}
+	rec.Bytes = secret.Bytes
+	rec.Rows = append(rec.Rows, secret.Rows...)
+	rec.Sealed = nil
+	return rec, nil
+}
+
+func sealedData(rec journalRecord) ([]byte, error) {
+	return cbornode.DumpObject(journalRecord{Op: rec.Op, Thread: rec.Thread, Log: rec.Log})
+}
+
+// fail makes the journal fail subsequent writes, since they could no
+// longer be replayed in order.
+func (j *journal) fail(op string, err error) error {
+	j.err = err
+	return fmt.Errorf("journaling %s: %w", op, err)
+}
+
+// ReadJournal calls fn with every entry of the journal read from r, until
+// fn fails. Aborted entries are skipped. A journal truncated within its
+// last entry, e.g. by a crash, fails with io.ErrUnexpectedEOF once all
+// complete entries are read.
+func ReadJournal(r io.Reader, fn func(JournalEntry) error) error {
+	br := bufio.NewReader(r)
+	// entries are passed on once the next one doesn't abort them
+	var pending *JournalEntry
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		e := *pending
+		pending = nil
+		return fn(e)
+	}
+	for {
+		e, err := readJournalEntry(br)
+		if err == io.EOF {
+			return flush()
+		} else if err != nil {
+			if ferr := flush(); ferr != nil {
+				return ferr
+			}
+			return err
+		}
+		if e.Op == opAbort {
+			pending = nil
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		pending = &e
+	}
+}
+
+func readJournalEntry(br *bufio.Reader) (e JournalEntry, err error) {
+	size, err := binary.ReadUvarint(br)
+	if err == io.EOF {
+		return e, err
+	} else if err != nil {
+		return e, fmt.Errorf("reading journal: %w", unexpectedEOF(err))
+	}
+	if size > maxJournalEntry {
+		return e, fmt.Errorf("journal entry of %d bytes exceeds limit", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return e, fmt.Errorf("reading journal: %w", unexpectedEOF(err))
+	}
+	var rec journalRecord
+	if err := cbornode.DecodeInto(data, &rec); err != nil {
+		return e, fmt.Errorf("decoding journal entry: %w", err)
+	}
+	e = JournalEntry{Time: time.Unix(0, rec.Time), Op: rec.Op, Log: thread.LogID(rec.Log), rec: rec}
+	if len(rec.Thread) > 0 {
+		if e.Thread, err = thread.Cast(rec.Thread); err != nil {
+			return e, fmt.Errorf("decoding thread of journal entry: %w", err)
+		}
+	}
+	return e, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Replay applies all writes recorded in the journal read from r to the
+// logstore. Secrets are decrypted with the key given to WithJournalKey,
+// which may be nil for journals without them.
+func Replay(ls core.Logstore, r io.Reader, key *sym.Key) error {
+	return ReplayUntil(ls, r, time.Time{}, key)
+}
+
+// ReplayUntil applies writes recorded in the journal read from r up to the
+// given time to the logstore, or all of them if the time is zero.
+func ReplayUntil(ls core.Logstore, r io.Reader, until time.Time, key *sym.Key) error {
+	errDone := errors.New("done")
+	err := ReadJournal(r, func(e JournalEntry) error {
+		if !until.IsZero() && e.Time.After(until) {
+			return errDone
+		}
+		if err := e.Apply(ls, key); err != nil {
+			return fmt.Errorf("replaying %s of %s: %w", e.Op, e.Time, err)
+		}
+		return nil
+	})
+	if err == errDone {
+		return nil
+	}
+	return err
+}
+
+// Apply applies the write to the logstore, decrypting its secrets with the
+// journal key if it has any. Address and metadata TTLs are shortened by the
+// time passed since the write, so that they expire as they would have.
+// Writes of reserved metadata keys only apply to logstores of this package.
+func (e JournalEntry) Apply(ls core.Logstore, key *sym.Key) error {
+	rec, err := unseal(e.rec, key)
+	if err != nil {
+		return err
+	}
+	t, l := e.Thread, e.Log
+	md := metadataOf(ls)
+	ttl := func(ttl int64) time.Duration {
+		d := time.Duration(ttl)
+		if d >= pstore.ConnectedAddrTTL {
+			// permanent TTLs don't expire
+			return d
+		}
+		return d - time.Since(e.Time)
+	}
+	switch rec.Op {
+	// keys
+	case "AddPubKey":
+		pk, err := crypto.UnmarshalPublicKey(rec.Bytes)
+		if err != nil {
+			return err
+		}
+		return ls.AddPubKey(t, l, pk)
+	case "RevokePubKey":
+		return ls.RevokePubKey(t, l)
+	case "AddPrivKey":
+		sk, err := crypto.UnmarshalPrivateKey(rec.Bytes)
+		if err != nil {
+			return err
+		}
+		return ls.AddPrivKey(t, l, sk)
+	case "AddReadKey", "AddServiceKey", "RotateReadKey", "RotateServiceKey":
+		key, err := sym.FromBytes(rec.Bytes)
+		if err != nil {
+			return err
+		}
+		switch rec.Op {
+		case "AddReadKey":
+			return ls.AddReadKey(t, key)
+		case "AddServiceKey":
+			return ls.AddServiceKey(t, key)
+		case "RotateReadKey":
+			_, err = ls.RotateReadKey(t, key)
+		default:
+			_, err = ls.RotateServiceKey(t, key)
+		}
+		return err
+	case "ClearKeys":
+		return ls.ClearKeys(t)
+	case "ClearLogKeys":
+		return ls.ClearLogKeys(t, l)
+	case "RestoreKeys":
+		dump, err := decodeKeyDump(rec.Rows)
+		if err != nil {
+			return err
+		}
+		return ls.RestoreKeys(dump)
+
+	// addresses
+	case "AddAddr", "AddAddrs", "AddAddrsFromSource":
+		addrs, err := decodeAddrs(rec.List)
+		if err != nil {
+			return err
+		}
+		return ls.AddAddrsFromSource(t, l, addrs, ttl(rec.TTL), core.AddrSource(rec.Str))
+	case "AddLogAddrsBulk":
+		entries := make([]core.ThreadLogAddrs, len(rec.Rows))
+		for i, row := range rec.Rows {
+			addrs, err := decodeAddrs(row.List)
+			if err != nil {
+				return err
+			}
+			entries[i] = core.ThreadLogAddrs{Thread: thread.ID(row.Thread), Log: thread.LogID(row.Log), Addrs: addrs}
+		}
+		return ls.AddLogAddrsBulk(entries, ttl(rec.TTL))
+	case "SetAddr", "SetAddrs":
+		addrs, err := decodeAddrs(rec.List)
+		if err != nil {
+			return err
+		}
+		return ls.SetAddrs(t, l, addrs, ttl(rec.TTL))
+	case "ConsumeLogRecord":
+		env, err := record.UnmarshalEnvelope(rec.Bytes)
+		if err != nil {
+			return err
+		}
+		_, err = ls.ConsumeLogRecord(t, env, ttl(rec.TTL))
+		return err
+	case "RecordDial":
+		addr, err := ma.NewMultiaddrBytes(rec.Bytes)
+		if err != nil {
+			return err
+		}
+		return ls.RecordDial(t, l, addr, time.Duration(rec.Int))
+	case "UpdateAddrs":
+		return ls.UpdateAddrs(t, l, time.Duration(rec.TTL), time.Duration(rec.NewTTL))
+	case "ClearAddrs":
+		return ls.ClearAddrs(t, l)
+	case "RestoreAddrs":
+		dump, err := decodeAddrDump(rec.Rows)
+		if err != nil {
+			return err
+		}
+		return ls.RestoreAddrs(dump)
+
+	// heads
+	case "AddHead", "AddHeads", "SetHead", "SetHeads":
+		heads, err := decodeCids(rec.List)
+		if err != nil {
+			return err
+		}
+		if rec.Op == "AddHead" || rec.Op == "AddHeads" {
+			return ls.AddHeads(t, l, heads)
+		}
+		return ls.SetHeads(t, l, heads)
+	case "ClearHeads":
+		return ls.ClearHeads(t, l)
+	case "RestoreHeads":
+		dump, err := decodeHeadDump(rec.Rows)
+		if err != nil {
+			return err
+		}
+		return ls.RestoreHeads(dump)
+
+	// metadata
+	case "PutInt64":
+		return md.PutInt64(t, rec.Key, rec.Int)
+	case "PutString":
+		return md.PutString(t, rec.Key, rec.Str)
+	case "PutBool":
+		return md.PutBool(t, rec.Key, rec.Bool)
+	case "PutBytes":
+		return md.PutBytes(t, rec.Key, rec.Bytes)
+	case "PutMetaWithTTL":
+		val, err := decodeMetaValue(rec)
+		if err != nil {
+			return err
+		}
+		d := ttl(rec.TTL)
+		if d <= 0 {
+			// expired meanwhile
+			d = time.Nanosecond
+		}
+		return md.PutMetaWithTTL(t, rec.Key, val, d)
+	case "DeleteMetaPrefix":
+		return md.DeleteMetaPrefix(t, rec.Key)
+	case "ClearMetadata":
+		return md.ClearMetadata(t)
+	case "RestoreMeta":
+		return md.RestoreMeta(decodeMetaDump(rec.Rows))
+	default:
+		return fmt.Errorf("unknown journal op %s", rec.Op)
+	}
+}
+
+func decodeAddrs(list [][]byte) ([]ma.Multiaddr, error) {
+	addrs := make([]ma.Multiaddr, len(list))
+	for i, b := range list {
+		addr, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addr
+	}
+	return addrs, nil
+}
+
+func encodeAddrs(addrs []ma.Multiaddr) [][]byte {
+	list := make([][]byte, len(addrs))
+	for i, addr := range addrs {
+		list[i] = addr.Bytes()
+	}
+	return list
+}
+
+func decodeCids(list [][]byte) ([]cid.Cid, error) {
+	cids := make([]cid.Cid, len(list))
+	for i, b := range list {
+		c, err := cid.Cast(b)
+		if err != nil {
+			return nil, err
+		}
+		cids[i] = c
+	}
+	return cids, nil
+}
+
+func encodeCids(cids []cid.Cid) [][]byte {
+	list := make([][]byte, len(cids))
+	for i, c := range cids {
+		list[i] = c.Bytes()
+	}
+	return list
+}
+
+// encodeMetaValue sets the value of PutMetaWithTTL in the record, with its
+// type in Key of the first row.
+func encodeMetaValue(rec *journalRecord, val interface{}) error {
+	var kind string
+	switch v := val.(type) {
+	case int64:
+		kind, rec.Int = "int64", v
+	case string:
+		kind, rec.Str = "string", v
+	case bool:
+		kind, rec.Bool = "bool", v
+	case []byte:
+		kind, rec.Bytes = "bytes", v
+	default:
+		return fmt.Errorf("unsupported metadata value of type %T", val)
+	}
+	rec.Rows = []journalRecord{{Key: kind}}
+	return nil
+}
+
+func decodeMetaValue(rec journalRecord) (interface{}, error) {
+	if len(rec.Rows) != 1 {
+		return nil, fmt.Errorf("missing type of metadata value")
+	}
+	switch rec.Rows[0].Key {
+	case "int64":
+		return rec.Int, nil
+	case "string":
+		return rec.Str, nil
+	case "bool":
+		return rec.Bool, nil
+	case "bytes":
+		return rec.Bytes, nil
+	default:
+		return nil, fmt.Errorf("unknown type of metadata value %s", rec.Rows[0].Key)
+	}
+}
+
+// Rows of key dumps are tagged with the map of the dump in Op. Rows of
+// secrets are returned apart from the others.
+func encodeKeyDump(dump core.DumpKeyBook) (rows, secrets []journalRecord, err error) {
+	for t, logs := range dump.Data.Public {
+		for l, pk := range logs {
+			b, err := crypto.MarshalPublicKey(pk)
+			if err != nil {
+				return nil, nil, err
+			}
+			rows = append(rows, journalRecord{Op: "Public", Thread: t.Bytes(), Log: []byte(l), Bytes: b})
+		}
+	}
+	for t, logs := range dump.Data.Private {
+		for l, sk := range logs {
+			b, err := crypto.MarshalPrivateKey(sk)
+			if err != nil {
+				return nil, nil, err
+			}
+			secrets = append(secrets, journalRecord{Op: "Private", Thread: t.Bytes(), Log: []byte(l), Bytes: b})
+		}
+	}
+	for t, k := range dump.Data.Read {
+		secrets = append(secrets, journalRecord{Op: "Read", Thread: t.Bytes(), Bytes: k})
+	}
+	for t, k := range dump.Data.Service {
+		secrets = append(secrets, journalRecord{Op: "Service", Thread: t.Bytes(), Bytes: k})
+	}
+	for t, ks := range dump.Data.ReadHistory {
+		secrets = append(secrets, journalRecord{Op: "ReadHistory", Thread: t.Bytes(), List: ks})
+	}
+	for t, ks := range dump.Data.ServiceHistory {
+		secrets = append(secrets, journalRecord{Op: "ServiceHistory", Thread: t.Bytes(), List: ks})
+	}
+	for t, ts := range dump.Data.ReadCreated {
+		rows = append(rows, journalRecord{Op: "ReadCreated", Thread: t.Bytes(), Ints: ts})
+	}
+	for t, ts := range dump.Data.ServiceCreated {
+		rows = append(rows, journalRecord{Op: "ServiceCreated", Thread: t.Bytes(), Ints: ts})
+	}
+	for t, logs := range dump.Data.Revoked {
+		for _, l := range logs {
+			rows = append(rows, journalRecord{Op: "Revoked", Thread: t.Bytes(), Log: []byte(l)})
+		}
+	}
+	return rows, secrets, nil
+}
+
+func decodeKeyDump(rows []journalRecord) (dump core.DumpKeyBook, err error) {
+	d := &dump.Data
+	d.Public = make(map[thread.ID]map[thread.LogID]crypto.PubKey)
+	d.Private = make(map[thread.ID]map[thread.LogID]crypto.PrivKey)
+	d.Read = make(map[thread.ID][]byte)
+	d.Service = make(map[thread.ID][]byte)
+	d.ReadHistory = make(map[thread.ID][][]byte)
+	d.ServiceHistory = make(map[thread.ID][][]byte)
+	d.ReadCreated = make(map[thread.ID][]int64)
+	d.ServiceCreated = make(map[thread.ID][]int64)
+	d.Revoked = make(map[thread.ID]thread.LogIDSlice)
+	for _, row := range rows {
+		t, l := thread.ID(row.Thread), thread.LogID(row.Log)
+		switch row.Op {
+		case "Public":
+			pk, err := crypto.UnmarshalPublicKey(row.Bytes)
+			if err != nil {
+				return dump, err
+			}
+			if d.Public[t] == nil {
+				d.Public[t] = make(map[thread.LogID]crypto.PubKey)
+			}
+			d.Public[t][l] = pk
+		case "Private":
+			sk, err := crypto.UnmarshalPrivateKey(row.Bytes)
+			if err != nil {
+				return dump, err
+			}
+			if d.Private[t] == nil {
+				d.Private[t] = make(map[thread.LogID]crypto.PrivKey)
+			}
+			d.Private[t][l] = sk
+		case "Read":
+			d.Read[t] = row.Bytes
+		case "Service":
+			d.Service[t] = row.Bytes
+		case "ReadHistory":
+			d.ReadHistory[t] = row.List
+		case "ServiceHistory":
+			d.ServiceHistory[t] = row.List
+		case "ReadCreated":
+			d.ReadCreated[t] = row.Ints
+		case "ServiceCreated":
+			d.ServiceCreated[t] = row.Ints
+		case "Revoked":
+			d.Revoked[t] = append(d.Revoked[t], l)
+		default:
+			return dump, fmt.Errorf("unknown row of key dump %s", row.Op)
+		}
+	}
+	return dump, nil
+}
+
+// Rows of address dumps hold an address each, or a signed record if Op is
+// Record. Expiration and last dial times are in Ints, as unix nanoseconds.
+func encodeAddrDump(dump core.DumpAddrBook) []journalRecord {
+	var rows []journalRecord
+	for t, logs := range dump.Data {
+		for l, addrs := range logs {
+			for _, a := range addrs {
+				rows = append(rows, journalRecord{
+					Op:     "Addr",
+					Thread: t.Bytes(),
+					Log:    []byte(l),
+					Bytes:  a.Addr.Bytes(),
+					Str:    string(a.Source),
+					Int:    int64(a.RTT),
+					Ints:   []int64{a.Expires.UnixNano(), unixNano(a.LastDial)},
+				})
+			}
+		}
+	}
+	for t, logs := range dump.Records {
+		for l, rec := range logs {
+			rows = append(rows, journalRecord{Op: "Record", Thread: t.Bytes(), Log: []byte(l), Bytes: rec})
+		}
+	}
+	return rows
+}
+
+func decodeAddrDump(rows []journalRecord) (dump core.DumpAddrBook, err error) {
+	dump.Data = make(map[thread.ID]map[thread.LogID][]core.ExpiredAddress)
+	dump.Records = make(map[thread.ID]map[thread.LogID][]byte)
+	for _, row := range rows {
+		t, l := thread.ID(row.Thread), thread.LogID(row.Log)
+		switch row.Op {
+		case "Addr":
+			addr, err := ma.NewMultiaddrBytes(row.Bytes)
+			if err != nil {
+				return dump, err
+			}
+			if len(row.Ints) != 2 {
+				return dump, fmt.Errorf("malformed row of address dump")
+			}
+			if dump.Data[t] == nil {
+				dump.Data[t] = make(map[thread.LogID][]core.ExpiredAddress)
+			}
+			dump.Data[t][l] = append(dump.Data[t][l], core.ExpiredAddress{
+				Addr:     addr,
+				Expires:  time.Unix(0, row.Ints[0]),
+				Source:   core.AddrSource(row.Str),
+				LastDial: fromUnixNano(row.Ints[1]),
+				RTT:      time.Duration(row.Int),
+			})
+		case "Record":
+			if dump.Records[t] == nil {
+				dump.Records[t] = make(map[thread.LogID][]byte)
+			}
+			dump.Records[t][l] = row.Bytes
+		default:
+			return dump, fmt.Errorf("unknown row of address dump %s", row.Op)
+		}
+	}
+	return dump, nil
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func encodeHeadDump(dump core.DumpHeadBook) []journalRecord {
+	var rows []journalRecord
+	for t, logs := range dump.Data {
+		for l, heads := range logs {
+			rows = append(rows, journalRecord{Thread: t.Bytes(), Log: []byte(l), List: encodeCids(heads)})
+		}
+	}
+	return rows
+}
+
+func decodeHeadDump(rows []journalRecord) (dump core.DumpHeadBook, err error) {
+	dump.Data = make(map[thread.ID]map[thread.LogID][]cid.Cid)
+	for _, row := range rows {
+		t, l := thread.ID(row.Thread), thread.LogID(row.Log)
+		heads, err := decodeCids(row.List)
+		if err != nil {
+			return dump, err
+		}
+		if dump.Data[t] == nil {
+			dump.Data[t] = make(map[thread.LogID][]cid.Cid)
+		}
+		dump.Data[t][l] = heads
+	}
+	return dump, nil
+}
+
+// Rows of metadata dumps are tagged with the type of their value in Op.
+func encodeMetaDump(dump core.DumpMetadata) []journalRecord {
+	var rows []journalRecord
+	for k, v := range dump.Data.Int64 {
+		rows = append(rows, journalRecord{Op: "Int64", Thread: k.T.Bytes(), Key: k.K, Int: v})
+	}
+	for k, v := range dump.Data.Bool {
+		rows = append(rows, journalRecord{Op: "Bool", Thread: k.T.Bytes(), Key: k.K, Bool: v})
+	}
+	for k, v := range dump.Data.String {
+		rows = append(rows, journalRecord{Op: "String", Thread: k.T.Bytes(), Key: k.K, Str: v})
+	}
+	for k, v := range dump.Data.Bytes {
+		rows = append(rows, journalRecord{Op: "Bytes", Thread: k.T.Bytes(), Key: k.K, Bytes: v})
+	}
+	for k, v := range dump.Expires {
+		rows = append(rows, journalRecord{Op: "Expires", Thread: k.T.Bytes(), Key: k.K, Int: v.UnixNano()})
+	}
+	return rows
+}
+
+func decodeMetaDump(rows []journalRecord) (dump core.DumpMetadata) {
+	d := &dump.Data
+	d.Int64 = make(map[core.MetadataKey]int64)
+	d.Bool = make(map[core.MetadataKey]bool)
+	d.String = make(map[core.MetadataKey]string)
+	d.Bytes = make(map[core.MetadataKey][]byte)
+	dump.Expires = make(map[core.MetadataKey]time.Time)
+	for _, row := range rows {
+		k := core.MetadataKey{T: thread.ID(row.Thread), K: row.Key}
+		switch row.Op {
+		case "Int64":
+			d.Int64[k] = row.Int
+		case "Bool":
+			d.Bool[k] = row.Bool
+		case "String":
+			d.String[k] = row.Str
+		case "Bytes":
+			d.Bytes[k] = row.Bytes
+		case "Expires":
+			dump.Expires[k] = time.Unix(0, row.Int)
+		}
+	}
+	return dump
+}
+
+func (b *journaledKeyBook) Close() error        { return closeBook(b.KeyBook) }
+func (b *journaledAddrBook) Close() error       { return closeBook(b.AddrBook) }
+func (b *journaledHeadBook) Close() error       { return closeBook(b.HeadBook) }
+func (b *journaledThreadMetadata) Close() error { return closeBook(b.ThreadMetadata) }
+
+func (b *journaledKeyBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.KeyBook, t)
+}
+func (b *journaledAddrBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.AddrBook, t)
+}
+func (b *journaledHeadBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.HeadBook, t)
+}
+func (b *journaledThreadMetadata) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.ThreadMetadata, t)
+}
+
+// journaledKeyBook records writes to a key book in the journal.
+type journaledKeyBook struct {
+	core.KeyBook
+	j *journal
+}
+
+func (b *journaledKeyBook) AddPubKey(t thread.ID, l thread.LogID, pk crypto.PubKey) error {
+	data, err := crypto.MarshalPublicKey(pk)
+	if err != nil {
+		return err
+	}
+	return b.j.record(func() error {
+		return b.KeyBook.AddPubKey(t, l, pk)
+	}, journalRecord{Op: "AddPubKey", Thread: t.Bytes(), Log: []byte(l), Bytes: data})
+}
+
+func (b *journaledKeyBook) RevokePubKey(t thread.ID, l thread.LogID) error {
+	return b.j.record(func() error {
+		return b.KeyBook.RevokePubKey(t, l)
+	}, journalRecord{Op: "RevokePubKey", Thread: t.Bytes(), Log: []byte(l)})
+}
+
+func (b *journaledKeyBook) AddPrivKey(t thread.ID, l thread.LogID, sk crypto.PrivKey) error {
+	data, err := crypto.MarshalPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+	return b.j.recordSecret(func() error {
+		return b.KeyBook.AddPrivKey(t, l, sk)
+	}, journalRecord{Op: "AddPrivKey", Thread: t.Bytes(), Log: []byte(l)}, journalRecord{Bytes: data})
+}
+
+func (b *journaledKeyBook) AddReadKey(t thread.ID, key *sym.Key) error {
+	return b.j.recordSecret(func() error {
+		return b.KeyBook.AddReadKey(t, key)
+	}, journalRecord{Op: "AddReadKey", Thread: t.Bytes()}, journalRecord{Bytes: keyBytes(key)})
+}
+
+func (b *journaledKeyBook) AddServiceKey(t thread.ID, key *sym.Key) error {
+	return b.j.recordSecret(func() error {
+		return b.KeyBook.AddServiceKey(t, key)
+	}, journalRecord{Op: "AddServiceKey", Thread: t.Bytes()}, journalRecord{Bytes: keyBytes(key)})
+}
+
+func (b *journaledKeyBook) RotateReadKey(t thread.ID, key *sym.Key) (v int, err error) {
+	err = b.j.recordSecret(func() (err error) {
+		v, err = b.KeyBook.RotateReadKey(t, key)
+		return
+	}, journalRecord{Op: "RotateReadKey", Thread: t.Bytes()}, journalRecord{Bytes: keyBytes(key)})
+	return
+}
+
+func (b *journaledKeyBook) RotateServiceKey(t thread.ID, key *sym.Key) (v int, err error) {
+	err = b.j.recordSecret(func() (err error) {
+		v, err = b.KeyBook.RotateServiceKey(t, key)
+		return
+	}, journalRecord{Op: "RotateServiceKey", Thread: t.Bytes()}, journalRecord{Bytes: keyBytes(key)})
+	return
+}
+
+func (b *journaledKeyBook) ClearKeys(t thread.ID) error {
+	return b.j.record(func() error {
+		return b.KeyBook.ClearKeys(t)
+	}, journalRecord{Op: "ClearKeys", Thread: t.Bytes()})
+}
+
+func (b *journaledKeyBook) ClearLogKeys(t thread.ID, l thread.LogID) error {
+	return b.j.record(func() error {
+		return b.KeyBook.ClearLogKeys(t, l)
+	}, journalRecord{Op: "ClearLogKeys", Thread: t.Bytes(), Log: []byte(l)})
+}
+
+// RestoreKeys is recorded without the secrets of the dump if there is no
+// journal key.
+func (b *journaledKeyBook) RestoreKeys(dump core.DumpKeyBook) error {
+	rows, secrets, err := encodeKeyDump(dump)
+	if err != nil {
+		return err
+	}
+	rec := journalRecord{Op: "RestoreKeys", Rows: rows}
+	if _, err := b.j.seal(&rec, journalRecord{Rows: secrets}); err != nil {
+		return err
+	}
+	return b.j.record(func() error {
+		return b.KeyBook.RestoreKeys(dump)
+	}, rec)
+}
+
+func keyBytes(key *sym.Key) []byte {
+	if key == nil {
+		return nil
+	}
+	return key.Bytes()
+}
+
+// journaledAddrBook records writes to an address book in the journal.
+type journaledAddrBook struct {
+	core.AddrBook
+	j *journal
+}
+
+func (b *journaledAddrBook) AddAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	return b.j.record(func() error {
+		return b.AddrBook.AddAddr(t, l, addr, ttl)
+	}, journalRecord{Op: "AddAddr", Thread: t.Bytes(), Log: []byte(l), List: encodeAddrs([]ma.Multiaddr{addr}), TTL: int64(ttl)})
+}
+
+func (b *journaledAddrBook) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	return b.j.record(func() error {
+		return b.AddrBook.AddAddrs(t, l, addrs, ttl)
+	}, journalRecord{Op: "AddAddrs", Thread: t.Bytes(), Log: []byte(l), List: encodeAddrs(addrs), TTL: int64(ttl)})
+}
+
+func (b *journaledAddrBook) SetAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	return b.j.record(func() error {
+		return b.AddrBook.SetAddr(t, l, addr, ttl)
+	}, journalRecord{Op: "SetAddr", Thread: t.Bytes(), Log: []byte(l), List: encodeAddrs([]ma.Multiaddr{addr}), TTL: int64(ttl)})
+}
+
+func (b *journaledAddrBook) SetAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	return b.j.record(func() error {
+		return b.AddrBook.SetAddrs(t, l, addrs, ttl)
+	}, journalRecord{Op: "SetAddrs", Thread: t.Bytes(), Log: []byte(l), List: encodeAddrs(addrs), TTL: int64(ttl)})
+}
+
+func (b *journaledAddrBook) AddAddrsFromSource(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) error {
+	return b.j.record(func() error {
+		return b.AddrBook.AddAddrsFromSource(t, l, addrs, ttl, src)
+	}, journalRecord{Op: "AddAddrsFromSource", Thread: t.Bytes(), Log: []byte(l), List: encodeAddrs(addrs), TTL: int64(ttl), Str: string(src)})
+}
+
+// AddLogAddrsBulk is recorded with a row of addresses of every log.
+func (b *journaledAddrBook) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	rows := make([]journalRecord, len(entries))
+	for i, e := range entries {
+		rows[i] = journalRecord{Thread: e.Thread.Bytes(), Log: []byte(e.Log), List: encodeAddrs(e.Addrs)}
+	}
+	return b.j.record(func() error {
+		return b.AddrBook.AddLogAddrsBulk(entries, ttl)
+	}, journalRecord{Op: "AddLogAddrsBulk", Rows: rows, TTL: int64(ttl)})
+}
+
+func (b *journaledAddrBook) ConsumeLogRecord(t thread.ID, env *record.Envelope, ttl time.Duration) (accepted bool, err error) {
+	data, err := env.Marshal()
+	if err != nil {
+		return false, err
+	}
+	err = b.j.record(func() (err error) {
+		accepted, err = b.AddrBook.ConsumeLogRecord(t, env, ttl)
+		return
+	}, journalRecord{Op: "ConsumeLogRecord", Thread: t.Bytes(), Bytes: data, TTL: int64(ttl)})
+	return
+}
+
+func (b *journaledAddrBook) RecordDial(t thread.ID, l thread.LogID, addr ma.Multiaddr, rtt time.Duration) error {
+	return b.j.record(func() error {
+		return b.AddrBook.RecordDial(t, l, addr, rtt)
+	}, journalRecord{Op: "RecordDial", Thread: t.Bytes(), Log: []byte(l), Bytes: addr.Bytes(), Int: int64(rtt)})
+}
+
+func (b *journaledAddrBook) UpdateAddrs(t thread.ID, l thread.LogID, oldTTL time.Duration, newTTL time.Duration) error {
+	return b.j.record(func() error {
+		return b.AddrBook.UpdateAddrs(t, l, oldTTL, newTTL)
+	}, journalRecord{Op: "UpdateAddrs", Thread: t.Bytes(), Log: []byte(l), TTL: int64(oldTTL), NewTTL: int64(newTTL)})
+}
+
+func (b *journaledAddrBook) ClearAddrs(t thread.ID, l thread.LogID) error {
+	return b.j.record(func() error {
+		return b.AddrBook.ClearAddrs(t, l)
+	}, journalRecord{Op: "ClearAddrs", Thread: t.Bytes(), Log: []byte(l)})
+}
+
+func (b *journaledAddrBook) RestoreAddrs(dump core.DumpAddrBook) error {
+	return b.j.record(func() error {
+		return b.AddrBook.RestoreAddrs(dump)
+	}, journalRecord{Op: "RestoreAddrs", Rows: encodeAddrDump(dump)})
+}
+
+// journaledHeadBook records writes to a head book in the journal.
+type journaledHeadBook struct {
+	core.HeadBook
+	j *journal
+}
+
+func (b *journaledHeadBook) AddHead(t thread.ID, l thread.LogID, head cid.Cid) error {
+	return b.j.record(func() error {
+		return b.HeadBook.AddHead(t, l, head)
+	}, journalRecord{Op: "AddHead", Thread: t.Bytes(), Log: []byte(l), List: encodeCids([]cid.Cid{head})})
+}
+
+func (b *journaledHeadBook) AddHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	return b.j.record(func() error {
+		return b.HeadBook.AddHeads(t, l, heads)
+	}, journalRecord{Op: "AddHeads", Thread: t.Bytes(), Log: []byte(l), List: encodeCids(heads)})
+}
+
+func (b *journaledHeadBook) SetHead(t thread.ID, l thread.LogID, head cid.Cid) error {
+	return b.j.record(func() error {
+		return b.HeadBook.SetHead(t, l, head)
+	}, journalRecord{Op: "SetHead", Thread: t.Bytes(), Log: []byte(l), List: encodeCids([]cid.Cid{head})})
+}
+
+func (b *journaledHeadBook) SetHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	return b.j.record(func() error {
+		return b.HeadBook.SetHeads(t, l, heads)
+	}, journalRecord{Op: "SetHeads", Thread: t.Bytes(), Log: []byte(l), List: encodeCids(heads)})
+}
+
+func (b *journaledHeadBook) ClearHeads(t thread.ID, l thread.LogID) error {
+	return b.j.record(func() error {
+		return b.HeadBook.ClearHeads(t, l)
+	}, journalRecord{Op: "ClearHeads", Thread: t.Bytes(), Log: []byte(l)})
+}
+
+func (b *journaledHeadBook) RestoreHeads(dump core.DumpHeadBook) error {
+	return b.j.record(func() error {
+		return b.HeadBook.RestoreHeads(dump)
+	}, journalRecord{Op: "RestoreHeads", Rows: encodeHeadDump(dump)})
+}
+
+// journaledThreadMetadata records writes to thread metadata in the journal.
+type journaledThreadMetadata struct {
+	core.ThreadMetadata
+	j *journal
+}
+
+func (b *journaledThreadMetadata) PutInt64(t thread.ID, key string, val int64) error {
+	return b.j.record(func() error {
+		return b.ThreadMetadata.PutInt64(t, key, val)
+	}, journalRecord{Op: "PutInt64", Thread: t.Bytes(), Key: key, Int: val})
+}
+
+func (b *journaledThreadMetadata) PutString(t thread.ID, key string, val string) error {
+	return b.j.record(func() error {
+		return b.ThreadMetadata.PutString(t, key, val)
+	}, journalRecord{Op: "PutString", Thread: t.Bytes(), Key: key, Str: val})
+}
+
+func (b *journaledThreadMetadata) PutBool(t thread.ID, key string, val bool) error {
+	return b.j.record(func() error {
+		return b.ThreadMetadata.PutBool(t, key, val)
+	}, journalRecord{Op: "PutBool", Thread: t.Bytes(), Key: key, Bool: val})
+}
+
+func (b *journaledThreadMetadata) PutBytes(t thread.ID, key string, val []byte) error {
+	return b.j.record(func() error {
+		return b.ThreadMetadata.PutBytes(t, key, val)
+	}, journalRecord{Op: "PutBytes", Thread: t.Bytes(), Key: key, Bytes: val})
+}
+
+func (b *journaledThreadMetadata) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error {
+	rec := journalRecord{Op: "PutMetaWithTTL", Thread: t.Bytes(), Key: key, TTL: int64(ttl)}
+	if err := encodeMetaValue(&rec, val); err != nil {
+		return err
+	}
+	return b.j.record(func() error {
+		return b.ThreadMetadata.PutMetaWithTTL(t, key, val, ttl)
+	}, rec)
+}
+
+func (b *journaledThreadMetadata) DeleteMetaPrefix(t thread.ID, prefix string) error {
+	return b.j.record(func() error {
+		return b.ThreadMetadata.DeleteMetaPrefix(t, prefix)
+	}, journalRecord{Op: "DeleteMetaPrefix", Thread: t.Bytes(), Key: prefix})
+}
+
+func (b *journaledThreadMetadata) ClearMetadata(t thread.ID) error {
+	return b.j.record(func() error {
+		return b.ThreadMetadata.ClearMetadata(t)
+	}, journalRecord{Op: "ClearMetadata", Thread: t.Bytes()})
+}
+
+func (b *journaledThreadMetadata) RestoreMeta(dump core.DumpMetadata) error {
+	return b.j.record(func() error {
+		return b.ThreadMetadata.RestoreMeta(dump)
+	}, journalRecord{Op: "RestoreMeta", Rows: encodeMetaDump(dump)})
+}
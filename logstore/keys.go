@@ -0,0 +1,210 @@
+package logstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	"golang.org/x/crypto/scrypt"
+)
+
+func init() {
+	cbornode.RegisterCborType(keyBundle{})
+	cbornode.RegisterCborType(keysExport{})
+	cbornode.RegisterCborType(logKeysExport{})
+}
+
+// keyBundleVersion is the format version of key bundles.
+const keyBundleVersion = 1
+
+// Parameters of scrypt deriving the bundle key from a passphrase.
+const (
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+	saltLength = 16
+)
+
+// keyBundle holds encrypted keysExport, encoded with CBOR.
+type keyBundle struct {
+	Version int
+	Salt    []byte
+	Data    []byte
+}
+
+// keysExport is the key material of a thread.
+type keysExport struct {
+	ID             []byte
+	ServiceKey     []byte
+	ReadKey        []byte
+	ServiceHistory [][]byte
+	ReadHistory    [][]byte
+	Logs           []logKeysExport
+}
+
+type logKeysExport struct {
+	ID      []byte
+	PubKey  []byte
+	PrivKey []byte
+	Revoked bool
+}
+
+// ExportKeys packs service, read and log keys of a thread into a bundle
+// encrypted with a key derived from the passphrase.
+func (ls *logstore) ExportKeys(id thread.ID, passphrase string) ([]byte, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, core.ErrThreadNotFound
+	}
+	te, err := ls.threadState(id)
+	if err != nil {
+		return nil, err
+	}
+	ke := keysExport{
+		ID:             te.ID,
+		ServiceKey:     te.ServiceKey,
+		ReadKey:        te.ReadKey,
+		ServiceHistory: te.ServiceHistory,
+		ReadHistory:    te.ReadHistory,
+	}
+	for _, le := range te.Logs {
+		ke.Logs = append(ke.Logs, logKeysExport{
+			ID:      le.ID,
+			PubKey:  le.PubKey,
+			PrivKey: le.PrivKey,
+			Revoked: le.Revoked,
+		})
+	}
+	data, err := cbornode.DumpObject(ke)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := bundleKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = key.Encrypt(data); err != nil {
+		return nil, err
+	}
+	return cbornode.DumpObject(keyBundle{Version: keyBundleVersion, Salt: salt, Data: data})
+}
+
+// ImportKeys adds keys from a bundle created by ExportKeys. Service and
+// read keys already present must match the imported ones.
+func (ls *logstore) ImportKeys(bundle []byte, passphrase string) error {
+	var kb keyBundle
+	if err := cbornode.DecodeInto(bundle, &kb); err != nil {
+		return fmt.Errorf("decoding key bundle: %w", err)
+	}
+	if kb.Version != keyBundleVersion {
+		return fmt.Errorf("unsupported key bundle version %d", kb.Version)
+	}
+	key, err := bundleKey(passphrase, kb.Salt)
+	if err != nil {
+		return err
+	}
+	if len(kb.Data) < sym.NonceBytes {
+		return fmt.Errorf("key bundle is too short")
+	}
+	data, err := key.Decrypt(kb.Data)
+	if err != nil {
+		return fmt.Errorf("decrypting key bundle: wrong passphrase or corrupted bundle")
+	}
+	var ke keysExport
+	if err := cbornode.DecodeInto(data, &ke); err != nil {
+		return fmt.Errorf("decoding key bundle: %w", err)
+	}
+	id, err := thread.Cast(ke.ID)
+	if err != nil {
+		return fmt.Errorf("decoding key bundle: %w", err)
+	}
+
+	ls.Lock()
+	defer ls.Unlock()
+
+	if err := ls.importSymKey(id, ke.ServiceHistory, ke.ServiceKey, ls.ServiceKey, ls.RotateServiceKey); err != nil {
+		return fmt.Errorf("importing service key: %w", err)
+	}
+	if err := ls.importSymKey(id, ke.ReadHistory, ke.ReadKey, ls.ReadKey, ls.RotateReadKey); err != nil {
+		return fmt.Errorf("importing read key: %w", err)
+	}
+	for _, le := range ke.Logs {
+		lid, err := thread.LogIDFromBytes(le.ID)
+		if err != nil {
+			return err
+		}
+		if le.PubKey != nil {
+			pk, err := crypto.UnmarshalPublicKey(le.PubKey)
+			if err != nil {
+				return err
+			}
+			if err := ls.AddPubKey(id, lid, pk); err != nil {
+				return err
+			}
+		}
+		if le.PrivKey != nil {
+			sk, err := crypto.UnmarshalPrivateKey(le.PrivKey)
+			if err != nil {
+				return err
+			}
+			if err := ls.AddPrivKey(id, lid, sk); err != nil {
+				return err
+			}
+		}
+		if le.Revoked {
+			if err := ls.RevokePubKey(id, lid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// importSymKey stores the key with its history unless the thread has one
+// already, in which case both must match.
+func (ls *logstore) importSymKey(
+	id thread.ID,
+	history [][]byte,
+	current []byte,
+	get func(thread.ID) (*sym.Key, error),
+	rotate func(thread.ID, *sym.Key) (int, error),
+) error {
+	if current == nil {
+		return nil
+	}
+	existing, err := get(id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return restoreKey(id, history, current, rotate)
+	}
+	if !bytes.Equal(existing.Bytes(), current) {
+		return fmt.Errorf("thread %s has another key", id)
+	}
+	return nil
+}
+
+func bundleKey(passphrase string, salt []byte) (*sym.Key, error) {
+	raw, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, sym.KeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return sym.FromBytes(raw)
+}
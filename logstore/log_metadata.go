@@ -0,0 +1,43 @@
+package logstore
+
+import (
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Log metadata is kept in the thread metadata under keys prefixed with the log ID,
+// same as the managed flag.
+func logMetaKey(lid thread.LogID, key string) string {
+	return lid.Pretty() + "/" + key
+}
+
+func (ls *logstore) GetLogInt64(id thread.ID, lid thread.LogID, key string) (*int64, error) {
+	return ls.GetInt64(id, logMetaKey(lid, key))
+}
+
+func (ls *logstore) PutLogInt64(id thread.ID, lid thread.LogID, key string, val int64) error {
+	return ls.PutInt64(id, logMetaKey(lid, key), val)
+}
+
+func (ls *logstore) GetLogString(id thread.ID, lid thread.LogID, key string) (*string, error) {
+	return ls.GetString(id, logMetaKey(lid, key))
+}
+
+func (ls *logstore) PutLogString(id thread.ID, lid thread.LogID, key string, val string) error {
+	return ls.PutString(id, logMetaKey(lid, key), val)
+}
+
+func (ls *logstore) GetLogBool(id thread.ID, lid thread.LogID, key string) (*bool, error) {
+	return ls.GetBool(id, logMetaKey(lid, key))
+}
+
+func (ls *logstore) PutLogBool(id thread.ID, lid thread.LogID, key string, val bool) error {
+	return ls.PutBool(id, logMetaKey(lid, key), val)
+}
+
+func (ls *logstore) GetLogBytes(id thread.ID, lid thread.LogID, key string) (*[]byte, error) {
+	return ls.GetBytes(id, logMetaKey(lid, key))
+}
+
+func (ls *logstore) PutLogBytes(id thread.ID, lid thread.LogID, key string, val []byte) error {
+	return ls.PutBytes(id, logMetaKey(lid, key), val)
+}
@@ -0,0 +1,81 @@
+package logstore
+
+import (
+	"time"
+
+	"github.com/textileio/go-threads/core/thread"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger receives structured events as a message with alternating keys and
+// values. It is satisfied by *zap.SugaredLogger and go-log loggers.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// EventLogger emits structured events of the books to a logger: key
+// changes at info level, address, head and metadata changes at debug level
+// and failed operations at error level.
+type EventLogger struct {
+	// Logger receives the events.
+	Logger Logger
+
+	// Levels are the minimum levels of events per book, i.e. "key", "addr",
+	// "head" or "metadata". Books without a level log at info level.
+	Levels map[string]zapcore.Level
+}
+
+var _ Observer = (*EventLogger)(nil)
+
+// WithEventLogger emits structured events of the books.
+func WithEventLogger(e *EventLogger) Option {
+	return WithObserver(e)
+}
+
+func (e *EventLogger) Start(book, op string, t thread.ID) func(error) {
+	start := time.Now()
+	return func(err error) {
+		kvs := []interface{}{"book", book, "op", op, "duration", time.Since(start)}
+		if t.Defined() {
+			kvs = append(kvs, "thread", t.String())
+		}
+		if err != nil {
+			e.Log(book, zapcore.ErrorLevel, "operation failed", append(kvs, "error", err.Error())...)
+			return
+		}
+		if IsWriteOp(op) {
+			level := zapcore.DebugLevel
+			if book == "key" {
+				level = zapcore.InfoLevel
+			}
+			e.Log(book, level, "book changed", kvs...)
+		}
+	}
+}
+
+// Log emits an event of the book if its level is enabled for the book.
+func (e *EventLogger) Log(book string, level zapcore.Level, msg string, keysAndValues ...interface{}) {
+	if e == nil || e.Logger == nil {
+		return
+	}
+	min, ok := e.Levels[book]
+	if !ok {
+		min = zapcore.InfoLevel
+	}
+	if !min.Enabled(level) {
+		return
+	}
+	switch {
+	case level >= zapcore.ErrorLevel:
+		e.Logger.Errorw(msg, keysAndValues...)
+	case level == zapcore.WarnLevel:
+		e.Logger.Warnw(msg, keysAndValues...)
+	case level == zapcore.InfoLevel:
+		e.Logger.Infow(msg, keysAndValues...)
+	default:
+		e.Logger.Debugw(msg, keysAndValues...)
+	}
+}
@@ -2,42 +2,157 @@ package logstore
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/textileio/go-threads/broadcast"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
 )
 
-var _ core.Logstore = (*logstore)(nil)
+var (
+	log = logging.Logger("logstore")
 
-var managedSuffix = "/managed"
+	_ core.Logstore    = (*logstore)(nil)
+	_ core.NameBook    = (*logstore)(nil)
+	_ core.PinBook     = (*logstore)(nil)
+	_ core.AccessBook  = (*logstore)(nil)
+	_ core.Inviter     = (*logstore)(nil)
+	_ core.Snapshotter = (*logstore)(nil)
+	_ core.Transactor  = (*logstore)(nil)
+)
+
+var (
+	managedKey = "managed"
+	// peerKey holds the owning peer of a log.
+	peerKey = "peer"
+)
 
-// logstore is a collection of books for storing thread logs.
+// logstore is a collection of books for storing thread logs. State shared
+// by views of the logstore, see withContext, is held by pointers.
 type logstore struct {
-	sync.RWMutex
+	*sync.RWMutex
 
 	core.KeyBook
 	core.AddrBook
 	core.ThreadMetadata
 	core.HeadBook
+
+	opts  Options
+	bus   *broadcast.Broadcaster
+	hooks *hooks
+	lc    *lifecycle
+
+	// pending collects events of a transaction view, see BeginTxn.
+	pending *[]core.Event
+}
+
+// Options holds the logstore configuration.
+type Options struct {
+	// Strict requires threads to be registered with CreateThread before
+	// they can be added or receive logs.
+	Strict bool
+
+	// Observers are notified of operations on the books.
+	Observers []Observer
+
+	// Registerer collects metrics of the logstore if set.
+	Registerer prometheus.Registerer
+
+	// Quota limits resources used by every thread.
+	Quota Quota
+
+	// Journal records writes to the books if set, see WithJournal.
+	Journal io.Writer
+
+	// JournalKey encrypts secrets recorded in the journal, which are left
+	// out without it, see WithJournalKey.
+	JournalKey *sym.Key
+
+	// Closers are closed along with the books, e.g. to stop their
+	// background tasks.
+	Closers []io.Closer
+}
+
+// Option configures a logstore.
+type Option func(*Options)
+
+// WithStrictMode enables or disables strict mode.
+func WithStrictMode(strict bool) Option {
+	return func(opts *Options) {
+		opts.Strict = strict
+	}
+}
+
+// WithCloser closes c along with the logstore.
+func WithCloser(c io.Closer) Option {
+	return func(opts *Options) {
+		opts.Closers = append(opts.Closers, c)
+	}
 }
 
 // NewLogstore creates a new log store from the given books.
-func NewLogstore(kb core.KeyBook, ab core.AddrBook, hb core.HeadBook, md core.ThreadMetadata) core.Logstore {
-	return &logstore{
+func NewLogstore(kb core.KeyBook, ab core.AddrBook, hb core.HeadBook, md core.ThreadMetadata, opts ...Option) core.Logstore {
+	ls := &logstore{
+		RWMutex:        &sync.RWMutex{},
 		KeyBook:        kb,
 		AddrBook:       ab,
 		HeadBook:       hb,
 		ThreadMetadata: md,
+		bus:            broadcast.NewBroadcaster(EventBusCapacity),
+		hooks:          &hooks{},
+		lc:             newLifecycle(),
+	}
+	for _, opt := range opts {
+		opt(&ls.opts)
+	}
+	if ls.opts.Quota.enabled() {
+		ls.enforceQuota(ls.opts.Quota)
+	}
+	if ls.opts.Strict {
+		ls.enforceStrict()
 	}
+	if ls.opts.Registerer != nil {
+		m, err := newMetrics(ls.opts.Registerer, ab)
+		if err != nil {
+			log.Errorf("error registering logstore metrics: %v", err)
+		} else {
+			ls.opts.Observers = append(ls.opts.Observers, m)
+		}
+	}
+	if ls.opts.Journal != nil {
+		ls.journalBooks(ls.opts.Journal, ls.opts.JournalKey)
+	}
+	ls.guardBooks()
+	if len(ls.opts.Observers) > 0 {
+		// observed books come last, so that withContext can rebind them
+		ls.observeBooks(ls.opts.Observers)
+	}
+	return ls
 }
 
-// Close the logstore.
+// Close the logstore. Operations in flight are finished first, and streams
+// and subscriptions are closed. Subsequent operations, including Close,
+// fail with core.ErrClosed.
 func (ls *logstore) Close() (err error) {
+	if !ls.lc.close() {
+		return core.ErrClosed
+	}
+	ls.bus.Discard()
+	ls.hooks.close()
+
 	var errs []error
 	weakClose := func(name string, c interface{}) {
 		if cl, ok := c.(io.Closer); ok {
@@ -51,6 +166,9 @@ func (ls *logstore) Close() (err error) {
 	weakClose("addressbook", ls.AddrBook)
 	weakClose("headbook", ls.HeadBook)
 	weakClose("threadmetadata", ls.ThreadMetadata)
+	for _, c := range ls.opts.Closers {
+		weakClose("closer", c)
+	}
 
 	if len(errs) > 0 {
 		return fmt.Errorf("failed while closing logstore; err(s): %q", errs)
@@ -63,27 +181,209 @@ func (ls *logstore) Threads() (thread.IDSlice, error) {
 	ls.RLock()
 	defer ls.RUnlock()
 
-	set := map[thread.ID]struct{}{}
-	threadsFromKeys, err := ls.ThreadsFromKeys()
+	return ls.threads()
+}
+
+func (ls *logstore) threads() (thread.IDSlice, error) {
+	var ids thread.IDSlice
+	err := ls.forEachThread(func(id thread.ID) {
+		ids = append(ids, id)
+	})
+	return ids, err
+}
+
+// ThreadsPaged returns a page of thread IDs sorted in ID order. Only the
+// threads up to the end of the page are held while listing.
+func (ls *logstore) ThreadsPaged(offset, limit int) (thread.IDSlice, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("invalid page with offset %d and limit %d", offset, limit)
+	}
+
+	ls.RLock()
+	defer ls.RUnlock()
+
+	var ids thread.IDSlice
+	if limit == 0 {
+		all, err := ls.threads()
+		if err != nil {
+			return nil, err
+		}
+		sort.Sort(all)
+		ids = all
+	} else {
+		page := newSmallestThreads(offset + limit)
+		if err := ls.walkThreads(func(id thread.ID) bool {
+			page.add(id)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		ids = page.sorted()
+	}
+	if offset >= len(ids) {
+		return thread.IDSlice{}, nil
+	}
+	return ids[offset:], nil
+}
+
+// ThreadsFilter returns thread IDs accepted by the filter. Threads are
+// streamed from the books, so that only accepted ones are held.
+func (ls *logstore) ThreadsFilter(filter func(thread.ID) bool) (thread.IDSlice, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	var ids thread.IDSlice
+	accepted := make(map[thread.ID]struct{})
+	err := ls.walkThreads(func(id thread.ID) bool {
+		if _, ok := accepted[id]; !ok && filter(id) {
+			accepted[id] = struct{}{}
+			ids = append(ids, id)
+		}
+		return true
+	})
+	return ids, err
+}
+
+// LogsToThreads returns threads the log writes to, i.e. the ones having keys
+// or addresses of the log.
+func (ls *logstore) LogsToThreads(l thread.LogID) (thread.IDSlice, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	withKeys, err := ls.ThreadsWithLogKeys(l)
 	if err != nil {
 		return nil, err
 	}
-	for _, t := range threadsFromKeys {
-		set[t] = struct{}{}
-	}
-	threadsFromAddrs, err := ls.ThreadsFromAddrs()
+	withAddrs, err := ls.ThreadsWithLogAddrs(l)
 	if err != nil {
 		return nil, err
 	}
-	for _, t := range threadsFromAddrs {
-		set[t] = struct{}{}
+	seen := make(map[thread.ID]struct{}, len(withKeys)+len(withAddrs))
+	ids := make(thread.IDSlice, 0, len(withKeys)+len(withAddrs))
+	for _, id := range append(withKeys, withAddrs...) {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
 	}
+	return ids, nil
+}
 
-	ids := make(thread.IDSlice, 0, len(set))
-	for t := range set {
-		ids = append(ids, t)
+// forEachThread calls fn once for every thread referenced by keys or
+// addresses, or registered with CreateThread.
+func (ls *logstore) forEachThread(fn func(thread.ID)) error {
+	seen := make(map[thread.ID]struct{})
+	return ls.walkThreads(func(t thread.ID) bool {
+		if _, ok := seen[t]; !ok {
+			seen[t] = struct{}{}
+			fn(t)
+		}
+		return true
+	})
+}
+
+// walkThreads streams threads referenced by keys or addresses, or
+// registered with CreateThread, until fn returns false. Threads may be
+// passed more than once.
+func (ls *logstore) walkThreads(fn func(thread.ID) bool) error {
+	stopped := false
+	visit := func(t thread.ID) bool {
+		if !fn(t) {
+			stopped = true
+		}
+		return !stopped
 	}
-	return ids, nil
+	if err := forEachThreadFromKeys(ls.KeyBook, visit); err != nil || stopped {
+		return err
+	}
+	if err := forEachThreadFromAddrs(ls.AddrBook, visit); err != nil || stopped {
+		return err
+	}
+	return forEachThreadWithMeta(ls.ThreadMetadata, core.MetaThreadCreated, visit)
+}
+
+// CreateThread registers a new thread along with its creation time.
+func (ls *logstore) CreateThread(id thread.ID, opts ...core.ThreadOption) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	args := &core.ThreadOptions{}
+	for _, opt := range opts {
+		opt(args)
+	}
+	for _, tag := range args.Tags {
+		if strings.Contains(tag, ",") {
+			return fmt.Errorf("thread tag %q contains a comma", tag)
+		}
+	}
+
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return core.ErrThreadExists
+	}
+	if args.Name != "" {
+		if _, found, err := ls.threadByName(args.Name); err != nil {
+			return err
+		} else if found {
+			return core.ErrThreadNameTaken
+		}
+	}
+
+	if err := ls.putInt64(id, core.MetaThreadCreated, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	if args.Name != "" {
+		if err := ls.putString(id, core.MetaThreadName, args.Name); err != nil {
+			return err
+		}
+	}
+	if len(args.Tags) > 0 {
+		if err := ls.putString(id, core.MetaThreadTags, strings.Join(args.Tags, ",")); err != nil {
+			return err
+		}
+	}
+	if args.Protocol != "" {
+		if err := ls.putString(id, core.MetaThreadProtocol, string(args.Protocol)); err != nil {
+			return err
+		}
+	}
+	ls.emit(core.Event{Type: core.ThreadCreated, Thread: id})
+	return nil
+}
+
+// threadExists reports whether a thread was created or holds any keys or logs.
+func (ls *logstore) threadExists(id thread.ID) (bool, error) {
+	created, err := ls.GetInt64(id, core.MetaThreadCreated)
+	if err != nil {
+		return false, err
+	}
+	if created != nil {
+		return true, nil
+	}
+	sk, err := ls.ServiceKey(id)
+	if err != nil {
+		return false, err
+	}
+	if sk != nil {
+		return true, nil
+	}
+	set, err := ls.getLogIDs(id)
+	if err != nil {
+		return false, err
+	}
+	return len(set) > 0, nil
+}
+
+// checkCreated ensures the thread was registered with CreateThread when
+// running in strict mode.
+func (ls *logstore) checkCreated(id thread.ID) error {
+	if !ls.opts.Strict {
+		return nil
+	}
+	return checkCreated(ls.ThreadMetadata, id)
 }
 
 // AddThread adds a thread with keys.
@@ -91,9 +391,20 @@ func (ls *logstore) AddThread(info thread.Info) error {
 	ls.Lock()
 	defer ls.Unlock()
 
+	return ls.addThread(info)
+}
+
+func (ls *logstore) addThread(info thread.Info) error {
+	if err := ls.checkCreated(info.ID); err != nil {
+		return err
+	}
 	if info.Key.Service() == nil {
 		return fmt.Errorf("a service-key is required to add a thread")
 	}
+	exists, err := ls.threadExists(info.ID)
+	if err != nil {
+		return err
+	}
 	sk, err := ls.ServiceKey(info.ID)
 	if err != nil {
 		return err
@@ -124,6 +435,9 @@ func (ls *logstore) AddThread(info thread.Info) error {
 			}
 		}
 	}
+	if !exists {
+		ls.emit(core.Event{Type: core.ThreadCreated, Thread: info.ID})
+	}
 	return nil
 }
 
@@ -132,6 +446,10 @@ func (ls *logstore) GetThread(id thread.ID) (info thread.Info, err error) {
 	ls.RLock()
 	defer ls.RUnlock()
 
+	return ls.getThread(id)
+}
+
+func (ls *logstore) getThread(id thread.ID) (info thread.Info, err error) {
 	sk, err := ls.ServiceKey(id)
 	if err != nil {
 		return
@@ -165,8 +483,62 @@ func (ls *logstore) GetThread(id thread.ID) (info thread.Info, err error) {
 	}, nil
 }
 
-func (ls *logstore) getLogIDs(id thread.ID) (map[peer.ID]struct{}, error) {
-	set := map[peer.ID]struct{}{}
+// GetThreadHandle returns a handle of the thread loading its keys and logs
+// on access.
+func (ls *logstore) GetThreadHandle(id thread.ID) (*core.ThreadHandle, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, core.ErrThreadNotFound
+	}
+	return core.NewThreadHandle(ls, id), nil
+}
+
+// ThreadHandles returns handles of all threads. Only thread IDs are read
+// from the books.
+func (ls *logstore) ThreadHandles() ([]*core.ThreadHandle, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	var handles []*core.ThreadHandle
+	err := ls.forEachThread(func(id thread.ID) {
+		handles = append(handles, core.NewThreadHandle(ls, id))
+	})
+	return handles, err
+}
+
+// GetThreadFull returns thread info of the given id along with all heads and metadata.
+func (ls *logstore) GetThreadFull(id thread.ID) (info core.ThreadInfoFull, err error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	if info.Info, err = ls.getThread(id); err != nil {
+		return
+	}
+	info.Heads = make(map[thread.LogID][]cid.Cid, len(info.Logs))
+	for _, lg := range info.Logs {
+		heads, err := ls.Heads(id, lg.ID)
+		if err != nil {
+			return info, err
+		}
+		info.Heads[lg.ID] = heads
+	}
+	info.Metadata, err = ls.threadMetadata(id)
+	return
+}
+
+// threadMetadata collects all metadata values of the thread.
+func (ls *logstore) threadMetadata(id thread.ID) (core.MetadataValues, error) {
+	return threadMeta(ls.ThreadMetadata, id)
+}
+
+func (ls *logstore) getLogIDs(id thread.ID) (map[thread.LogID]struct{}, error) {
+	set := map[thread.LogID]struct{}{}
 	logsWithKeys, err := ls.LogsWithKeys(id)
 	if err != nil {
 		return nil, err
@@ -189,18 +561,34 @@ func (ls *logstore) DeleteThread(id thread.ID) error {
 	ls.Lock()
 	defer ls.Unlock()
 
-	if err := ls.ClearKeys(id); err != nil {
+	return ls.deleteThread(id)
+}
+
+func (ls *logstore) deleteThread(id thread.ID) error {
+	exists, err := ls.threadExists(id)
+	if err != nil {
 		return err
 	}
-
-	if err := ls.ClearMetadata(id); err != nil {
+	if err := ls.clearThread(id); err != nil {
 		return err
 	}
+	if exists {
+		ls.emit(core.Event{Type: core.ThreadDeleted, Thread: id})
+	}
+	return nil
+}
 
+// clearThread removes all entries of the thread without emitting events,
+// e.g. to revert a thread to a state never reported.
+func (ls *logstore) clearThread(id thread.ID) error {
+	// collect logs before their keys are gone
 	set, err := ls.getLogIDs(id)
 	if err != nil {
-		return nil
+		return err
 	}
+
+	// keys go last, so that logs of a stopped deletion are still found by
+	// the next one
 	for l := range set {
 		if err := ls.ClearAddrs(id, l); err != nil {
 			return err
@@ -209,7 +597,12 @@ func (ls *logstore) DeleteThread(id thread.ID) error {
 			return err
 		}
 	}
-	return nil
+
+	if err := ls.ThreadMetadata.ClearMetadata(id); err != nil {
+		return err
+	}
+
+	return ls.ClearKeys(id)
 }
 
 // AddLog adds a log under the given thread.
@@ -217,13 +610,17 @@ func (ls *logstore) AddLog(id thread.ID, lg thread.LogInfo) error {
 	ls.Lock()
 	defer ls.Unlock()
 
+	return ls.addLog(id, lg)
+}
+
+func (ls *logstore) addLog(id thread.ID, lg thread.LogInfo) error {
+	if err := ls.checkCreated(id); err != nil {
+		return err
+	}
 	if lg.PrivKey != nil {
 		if pk, _ := ls.PrivKey(id, lg.ID); pk != nil {
 			return core.ErrLogExists
 		}
-		if err := ls.AddPrivKey(id, lg.ID, lg.PrivKey); err != nil {
-			return err
-		}
 	}
 	err := ls.AddPubKey(id, lg.ID, lg.PubKey)
 	if err != nil {
@@ -239,22 +636,34 @@ func (ls *logstore) AddLog(id thread.ID, lg thread.LogInfo) error {
 	}
 	// By definition 'owned' logs are also 'managed' logs.
 	if lg.Managed || lg.PrivKey != nil {
-		if err = ls.PutBool(id, lg.ID.Pretty()+managedSuffix, true); err != nil {
+		if err = ls.PutLogBool(id, lg.ID, managedKey, true); err != nil {
+			return err
+		}
+	}
+	if lg.Peer != "" {
+		if err = ls.PutLogBytes(id, lg.ID, peerKey, []byte(lg.Peer)); err != nil {
 			return err
 		}
 	}
+	// the private key goes last, so that a stopped addition can be retried
+	if lg.PrivKey != nil {
+		if err = ls.AddPrivKey(id, lg.ID, lg.PrivKey); err != nil {
+			return err
+		}
+	}
+	ls.emit(core.Event{Type: core.LogAdded, Thread: id, Log: lg.ID})
 	return nil
 }
 
 // GetLog returns info about the given thread.
-func (ls *logstore) GetLog(id thread.ID, lid peer.ID) (info thread.LogInfo, err error) {
+func (ls *logstore) GetLog(id thread.ID, lid thread.LogID) (info thread.LogInfo, err error) {
 	ls.RLock()
 	defer ls.RUnlock()
 
 	return ls.getLog(id, lid)
 }
 
-func (ls *logstore) getLog(id thread.ID, lid peer.ID) (info thread.LogInfo, err error) {
+func (ls *logstore) getLog(id thread.ID, lid thread.LogID) (info thread.LogInfo, err error) {
 	pk, err := ls.PubKey(id, lid)
 	if err != nil {
 		return
@@ -274,13 +683,16 @@ func (ls *logstore) getLog(id thread.ID, lid peer.ID) (info thread.LogInfo, err
 	if err != nil {
 		return
 	}
-	managed, err := ls.GetBool(id, lid.Pretty()+managedSuffix)
+	managed, err := ls.GetLogBool(id, lid, managedKey)
 	if err != nil {
 		return
 	}
 	if managed != nil {
 		info.Managed = *managed
 	}
+	if info.Peer, err = ls.logPeer(id, lid); err != nil {
+		return
+	}
 	info.ID = lid
 	info.PubKey = pk
 	info.PrivKey = sk
@@ -311,11 +723,46 @@ func (ls *logstore) GetManagedLogs(id thread.ID) ([]thread.LogInfo, error) {
 	return managed, nil
 }
 
+// LogsForPeer returns logs of the thread owned by the peer.
+func (ls *logstore) LogsForPeer(id thread.ID, p peer.ID) (thread.LogIDSlice, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	logs, err := ls.LogsWithKeys(id)
+	if err != nil {
+		return nil, err
+	}
+	var owned thread.LogIDSlice
+	for _, lid := range logs {
+		owner, err := ls.logPeer(id, lid)
+		if err != nil {
+			return nil, err
+		}
+		if owner != "" && owner == p {
+			owned = append(owned, lid)
+		}
+	}
+	return owned, nil
+}
+
+// logPeer returns the owning peer of the log, if known.
+func (ls *logstore) logPeer(id thread.ID, lid thread.LogID) (peer.ID, error) {
+	owner, err := ls.GetLogBytes(id, lid, peerKey)
+	if err != nil || owner == nil {
+		return "", err
+	}
+	return peer.ID(*owner), nil
+}
+
 // DeleteLog deletes a log.
-func (ls *logstore) DeleteLog(id thread.ID, lid peer.ID) (err error) {
+func (ls *logstore) DeleteLog(id thread.ID, lid thread.LogID) (err error) {
 	ls.Lock()
 	defer ls.Unlock()
 
+	return ls.deleteLog(id, lid)
+}
+
+func (ls *logstore) deleteLog(id thread.ID, lid thread.LogID) (err error) {
 	if err = ls.ClearLogKeys(id, lid); err != nil {
 		return
 	}
@@ -325,5 +772,85 @@ func (ls *logstore) DeleteLog(id thread.ID, lid peer.ID) (err error) {
 	if err = ls.ClearHeads(id, lid); err != nil {
 		return
 	}
+	if err = ls.DeleteMetaPrefix(id, lid.Pretty()); err != nil {
+		return
+	}
+	ls.emit(core.Event{Type: core.LogDeleted, Thread: id, Log: lid})
 	return nil
 }
+
+// ReplaceAddr replaces the address in all logs having it with a new one
+// valid for the ttl and returns the updated logs. Logs with certified
+// addresses are left to their signed records.
+func (ls *logstore) ReplaceAddr(old, repl ma.Multiaddr, ttl time.Duration) ([]core.ThreadLog, error) {
+	ls.Lock()
+	defer ls.Unlock()
+
+	logs, err := ls.LogsWithAddr(old)
+	if err != nil {
+		return nil, err
+	}
+	updated := make([]core.ThreadLog, 0, len(logs))
+	for _, tl := range logs {
+		rec, err := ls.LogRecord(tl.Thread, tl.Log)
+		if err != nil {
+			return nil, err
+		}
+		if rec != nil {
+			continue
+		}
+		// remove first, so that the log doesn't exceed its quota
+		if err := ls.AddrBook.SetAddr(tl.Thread, tl.Log, old, 0); err != nil {
+			return nil, fmt.Errorf("removing address of log %s: %w", tl.Log, err)
+		}
+		if err := ls.AddAddr(tl.Thread, tl.Log, repl, ttl); err != nil {
+			return nil, fmt.Errorf("adding address of log %s: %w", tl.Log, err)
+		}
+		updated = append(updated, tl)
+	}
+	return updated, nil
+}
+
+// ThreadDiskUsage returns the approximate size of a thread on disk, summed
+// over all books that are able to report it.
+func (ls *logstore) ThreadDiskUsage(id thread.ID) (int64, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	return ls.threadDiskUsage(id)
+}
+
+type diskUsager interface {
+	ThreadDiskUsage(thread.ID) (int64, error)
+}
+
+// diskUsage returns disk usage of the thread in the book, or
+// core.ErrNotSupported if the book does not report it.
+func diskUsage(b interface{}, id thread.ID) (int64, error) {
+	du, ok := b.(diskUsager)
+	if !ok {
+		return 0, core.ErrNotSupported
+	}
+	return du.ThreadDiskUsage(id)
+}
+
+func (ls *logstore) threadDiskUsage(id thread.ID) (int64, error) {
+	var (
+		total     int64
+		supported bool
+	)
+	for _, b := range []interface{}{ls.KeyBook, ls.AddrBook, ls.HeadBook, ls.ThreadMetadata} {
+		size, err := diskUsage(b, id)
+		if errors.Is(err, core.ErrNotSupported) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		total += size
+		supported = true
+	}
+	if !supported {
+		return 0, core.ErrNotSupported
+	}
+	return total, nil
+}
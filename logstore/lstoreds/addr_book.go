@@ -12,10 +12,11 @@ import (
 	"github.com/ipfs/go-datastore/query"
 	logging "github.com/ipfs/go-log"
 	"github.com/libp2p/go-libp2p-core/peer"
-	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	"github.com/libp2p/go-libp2p-core/record"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
+	"github.com/textileio/go-threads/logstore/lstoremem"
 	pb "github.com/textileio/go-threads/net/pb"
 	"github.com/whyrusleeping/base32"
 )
@@ -33,6 +34,10 @@ var (
 	// Thread addresses are stored db key pattern:
 	// /thread/addrs/<b32 thread id no padding>/<b32 log id no padding>
 	logBookBase = ds.NewKey("/thread/addrs")
+
+	// Signed log records are stored db key pattern:
+	// /thread/addrrec/<b32 thread id no padding>/<b32 log id no padding>
+	logRecordBase = ds.NewKey("/thread/addrrec")
 )
 
 type DsAddrBook struct {
@@ -41,7 +46,7 @@ type DsAddrBook struct {
 	ds          ds.Batching
 	cache       cache
 	gc          *dsAddrBookGc
-	subsManager *pstoremem.AddrSubManager
+	subsManager *lstoremem.AddrSubManager
 
 	// controls children goroutine lifetime.
 	childrenDone sync.WaitGroup
@@ -60,7 +65,7 @@ type addrsRecord struct {
 // cacheKey is a comparable struct used as a key in the book cache
 type cacheKey struct {
 	threadID thread.ID
-	peerID   peer.ID
+	peerID   thread.LogID
 }
 
 // NewAddrBook initializes a new datastore-backed address book. It serves as a drop-in replacement for pstoremem
@@ -81,7 +86,7 @@ func NewAddrBook(ctx context.Context, ds ds.Batching, opts Options) (*DsAddrBook
 		ctx:         ctx,
 		ds:          ds,
 		opts:        opts,
-		subsManager: pstoremem.NewAddrSubManager(),
+		subsManager: lstoremem.NewAddrSubManager(),
 		cancelFn:    cancelFn,
 	}
 
@@ -102,39 +107,71 @@ func NewAddrBook(ctx context.Context, ds ds.Batching, opts Options) (*DsAddrBook
 }
 
 // AddAddr will add a new address if it's not already in the AddrBook.
-func (ab *DsAddrBook) AddAddr(t thread.ID, p peer.ID, addr ma.Multiaddr, ttl time.Duration) error {
+func (ab *DsAddrBook) AddAddr(t thread.ID, p thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
 	return ab.AddAddrs(t, p, []ma.Multiaddr{addr}, ttl)
 }
 
 // AddAddrs will add many multiple addresses if they aren't already in the AddrBook.
-func (ab *DsAddrBook) AddAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) error {
+func (ab *DsAddrBook) AddAddrs(t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	return ab.AddAddrsFromSource(t, p, addrs, ttl, logstore.AddrSourceUnknown)
+}
+
+// AddAddrsFromSource works like AddAddrs, additionally recording the source of addresses.
+func (ab *DsAddrBook) AddAddrsFromSource(t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src logstore.AddrSource) error {
 	if ttl <= 0 {
 		return nil
 	}
 	addrs = cleanAddrs(addrs)
-	if err := ab.setAddrs(t, p, addrs, ttl, ttlExtend); err != nil {
+	if err := ab.setAddrs(ab.ds, t, p, addrs, ttl, src, ttlExtend); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (ab *DsAddrBook) SetAddr(t thread.ID, p peer.ID, addr ma.Multiaddr, ttl time.Duration) error {
+// AddLogAddrsBulk adds addresses of many logs, committing them in a single batch.
+func (ab *DsAddrBook) AddLogAddrsBulk(entries []logstore.ThreadLogAddrs, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	batch, err := ab.ds.Batch()
+	if err != nil {
+		return fmt.Errorf("creating batch: %w", err)
+	}
+	for _, e := range entries {
+		if err = ab.setAddrs(batch, e.Thread, e.Log, cleanAddrs(e.Addrs), ttl, logstore.AddrSourceUnknown, ttlExtend); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = batch.Commit()
+	}
+	if err != nil {
+		// cached records may hold uncommitted addresses
+		for _, e := range entries {
+			ab.cache.Remove(genCacheKey(e.Thread, e.Log))
+		}
+		return fmt.Errorf("adding addrs in bulk: %w", err)
+	}
+	return nil
+}
+
+func (ab *DsAddrBook) SetAddr(t thread.ID, p thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
 	return ab.SetAddrs(t, p, []ma.Multiaddr{addr}, ttl)
 }
 
-func (ab *DsAddrBook) SetAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) error {
+func (ab *DsAddrBook) SetAddrs(t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
 	addrs = cleanAddrs(addrs)
 	if ttl <= 0 {
 		err := ab.deleteAddrs(t, p, addrs)
 		return err
 	}
-	if err := ab.setAddrs(t, p, addrs, ttl, ttlOverride); err != nil {
+	if err := ab.setAddrs(ab.ds, t, p, addrs, ttl, logstore.AddrSourceUnknown, ttlOverride); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (ab *DsAddrBook) UpdateAddrs(t thread.ID, p peer.ID, oldTTL time.Duration, newTTL time.Duration) error {
+func (ab *DsAddrBook) UpdateAddrs(t thread.ID, p thread.LogID, oldTTL time.Duration, newTTL time.Duration) error {
 	pr, err := ab.loadRecord(t, p, true, false)
 	if err != nil {
 		return fmt.Errorf("failed to update ttls for log %s: %w", p.Pretty(), err)
@@ -154,14 +191,12 @@ func (ab *DsAddrBook) UpdateAddrs(t thread.ID, p peer.ID, oldTTL time.Duration,
 	}
 
 	if pr.clean() {
-		if err := pr.flush(ab.ds); err != nil {
-			return err
-		}
+		return ab.flushRecord(ab.ds, pr)
 	}
 	return nil
 }
 
-func (ab *DsAddrBook) Addrs(t thread.ID, p peer.ID) ([]ma.Multiaddr, error) {
+func (ab *DsAddrBook) Addrs(t thread.ID, p thread.LogID) ([]ma.Multiaddr, error) {
 	pr, err := ab.loadRecord(t, p, true, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load peerstore entry for log %s while querying addrs: %w", p.Pretty(), err)
@@ -176,25 +211,244 @@ func (ab *DsAddrBook) Addrs(t thread.ID, p peer.ID) ([]ma.Multiaddr, error) {
 	return addrs, nil
 }
 
-func (ab *DsAddrBook) AddrStream(ctx context.Context, t thread.ID, p peer.ID) (<-chan ma.Multiaddr, error) {
+func (ab *DsAddrBook) ForEachLogAddr(t thread.ID, p thread.LogID, fn func(ma.Multiaddr) bool) error {
+	pr, err := ab.loadRecord(t, p, true, true)
+	if err != nil {
+		return fmt.Errorf("failed to load peerstore entry for log %s while querying addrs: %w", p.Pretty(), err)
+	}
+
+	pr.RLock()
+	defer pr.RUnlock()
+	for _, a := range pr.Addrs {
+		if !fn(a.Addr) {
+			break
+		}
+	}
+	return nil
+}
+
+func (ab *DsAddrBook) AddrsWithSource(t thread.ID, p thread.LogID) ([]logstore.ExpiredAddress, error) {
+	pr, err := ab.loadRecord(t, p, true, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load peerstore entry for log %s while querying addrs: %w", p.Pretty(), err)
+	}
+
+	pr.RLock()
+	defer pr.RUnlock()
+	addrs := make([]logstore.ExpiredAddress, 0, len(pr.Addrs))
+	for _, a := range pr.Addrs {
+		addrs = append(addrs, expiredAddress(a))
+	}
+	return addrs, nil
+}
+
+func (ab *DsAddrBook) SortedAddrs(t thread.ID, p thread.LogID) ([]ma.Multiaddr, error) {
+	addrs, err := ab.AddrsWithSource(t, p)
+	if err != nil {
+		return nil, err
+	}
+	logstore.SortAddrs(addrs, time.Now(), ab.dialFreshness())
+	sorted := make([]ma.Multiaddr, len(addrs))
+	for i, a := range addrs {
+		sorted[i] = a.Addr
+	}
+	return sorted, nil
+}
+
+// dialFreshness returns the period dials of addresses are considered fresh.
+func (ab *DsAddrBook) dialFreshness() time.Duration {
+	if ab.opts.AddrDialFreshness > 0 {
+		return ab.opts.AddrDialFreshness
+	}
+	return logstore.DefaultAddrDialFreshness
+}
+
+// RecordDial stores the time and round-trip time of a successful dial.
+func (ab *DsAddrBook) RecordDial(t thread.ID, p thread.LogID, addr ma.Multiaddr, rtt time.Duration) error {
+	pr, err := ab.loadRecord(t, p, true, false)
+	if err != nil {
+		return fmt.Errorf("failed to load peerstore entry for log %s while recording dial: %w", p.Pretty(), err)
+	}
+
+	pr.Lock()
+	defer pr.Unlock()
+
+	for _, entry := range pr.Addrs {
+		if entry.Addr.Equal(addr) {
+			entry.LastDial, entry.Rtt = time.Now().UnixNano(), int64(rtt)
+			pr.dirty = true
+			return ab.flushRecord(ab.ds, pr)
+		}
+	}
+	return nil
+}
+
+func expiredAddress(e *pb.AddrBookRecord_AddrEntry) logstore.ExpiredAddress {
+	ea := logstore.ExpiredAddress{
+		Addr:    e.Addr,
+		Expires: time.Unix(e.Expiry, 0),
+		Source:  logstore.AddrSource(e.Source),
+		RTT:     time.Duration(e.Rtt),
+	}
+	if e.LastDial != 0 {
+		ea.LastDial = time.Unix(0, e.LastDial)
+	}
+	return ea
+}
+
+func (ab *DsAddrBook) AddrStream(ctx context.Context, t thread.ID, p thread.LogID) (<-chan ma.Multiaddr, error) {
 	initial, err := ab.Addrs(t, p)
 	if err != nil {
 		return nil, err
 	}
-	return ab.subsManager.AddrStream(ctx, p, initial), nil
+	return ab.subsManager.AddrStream(ctx, p, initial)
 }
 
-func (ab *DsAddrBook) ClearAddrs(t thread.ID, p peer.ID) error {
+// AddrSubscribers returns the number of active subscribers of address streams.
+func (ab *DsAddrBook) AddrSubscribers() int {
+	return ab.subsManager.AddrSubscribers()
+}
+
+func (ab *DsAddrBook) ThreadAddrStream(ctx context.Context, t thread.ID) (<-chan logstore.LogAddr, error) {
+	return ab.subsManager.ThreadAddrStream(ctx, t, func() ([]logstore.LogAddr, error) {
+		lids, err := ab.LogsWithAddrs(t)
+		if err != nil {
+			return nil, err
+		}
+		var initial []logstore.LogAddr
+		for _, p := range lids {
+			addrs, err := ab.Addrs(t, p)
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range addrs {
+				initial = append(initial, logstore.LogAddr{Log: p, Addr: a})
+			}
+		}
+		return initial, nil
+	})
+}
+
+func (ab *DsAddrBook) ControlledAddrStream(ctx context.Context, t thread.ID, p thread.LogID) (<-chan ma.Multiaddr, logstore.AddrStreamControl, error) {
+	initial, err := ab.Addrs(t, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, ctl := ab.subsManager.ControlledAddrStream(ctx, p, initial)
+	return out, ctl, nil
+}
+
+func (ab *DsAddrBook) ClearAddrs(t thread.ID, p thread.LogID) error {
 	ab.cache.Remove(genCacheKey(t, p))
 
 	key := genDSKey(t, p)
 	if err := ab.ds.Delete(key); err != nil {
 		return fmt.Errorf("failed to clear addresses for log %s: %w", p.Pretty(), err)
 	}
+	if err := ab.ds.Delete(genRecordKey(t, p)); err != nil {
+		return fmt.Errorf("failed to clear signed record for log %s: %w", p.Pretty(), err)
+	}
+	if err := ab.ds.Delete(dsLogIndexKey(addrIndexBase, p, t)); err != nil {
+		return fmt.Errorf("failed to clear index of log %s: %w", p.Pretty(), err)
+	}
 	return nil
 }
 
-func (ab *DsAddrBook) LogsWithAddrs(t thread.ID) (peer.IDSlice, error) {
+// ConsumeLogRecord replaces addresses of the log with the ones of the signed
+// record, unless a record with the same or higher sequence number is valid.
+func (ab *DsAddrBook) ConsumeLogRecord(t thread.ID, env *record.Envelope, ttl time.Duration) (bool, error) {
+	rec, raw, err := logstore.OpenLogRecord(env)
+	if err != nil {
+		return false, err
+	}
+	if ttl <= 0 {
+		return false, nil
+	}
+	p := thread.LogIDFromPeer(rec.PeerID)
+
+	pr, err := ab.loadRecord(t, p, true, false)
+	if err != nil {
+		return false, fmt.Errorf("failed to load peerstore entry for log %s while consuming record: %w", p.Pretty(), err)
+	}
+
+	pr.Lock()
+	defer pr.Unlock()
+
+	_, last, err := ab.logRecord(t, p, pr)
+	if err != nil {
+		return false, err
+	}
+	if last != nil && last.Seq >= rec.Seq {
+		return false, nil
+	}
+
+	known := make(map[string]*pb.AddrBookRecord_AddrEntry, len(pr.Addrs))
+	for _, entry := range pr.Addrs {
+		known[string(entry.Addr.Bytes())] = entry
+	}
+	newExp := time.Now().Add(ttl).Unix()
+	entries := make([]*pb.AddrBookRecord_AddrEntry, 0, len(rec.Addrs))
+	for _, addr := range cleanAddrs(rec.Addrs) {
+		entry, found := known[string(addr.Bytes())]
+		if !found {
+			entry = &pb.AddrBookRecord_AddrEntry{Addr: &pb.ProtoAddr{Multiaddr: addr}}
+			ab.subsManager.BroadcastLogAddr(t, p, addr)
+		}
+		entry.Ttl, entry.Expiry = int64(ttl), newExp
+		entries = append(entries, entry)
+	}
+	pr.Addrs = entries
+	pr.dirty = true
+	pr.clean()
+
+	// write the record along with addresses, so they never get out of sync
+	batch, err := ab.ds.Batch()
+	if err != nil {
+		return false, err
+	}
+	if err := batch.Put(genRecordKey(t, p), raw); err != nil {
+		return false, err
+	}
+	if err := pr.flush(batch); err == nil {
+		err = batch.Commit()
+	}
+	if err != nil {
+		ab.cache.Remove(genCacheKey(t, p))
+		return false, fmt.Errorf("failed to store signed record for log %s: %w", p.Pretty(), err)
+	}
+	return true, nil
+}
+
+// LogRecord returns the signed record of the log if it has valid certified addresses.
+func (ab *DsAddrBook) LogRecord(t thread.ID, p thread.LogID) (*record.Envelope, error) {
+	pr, err := ab.loadRecord(t, p, true, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load peerstore entry for log %s while querying record: %w", p.Pretty(), err)
+	}
+
+	pr.RLock()
+	defer pr.RUnlock()
+	env, _, err := ab.logRecord(t, p, pr)
+	return env, err
+}
+
+// logRecord returns the stored signed record of the log, unless all addresses
+// of the loaded record have expired. To be called within a lock.
+func (ab *DsAddrBook) logRecord(t thread.ID, p thread.LogID, pr *addrsRecord) (*record.Envelope, *peer.PeerRecord, error) {
+	if len(pr.Addrs) == 0 {
+		return nil, nil, nil
+	}
+	raw, err := ab.ds.Get(genRecordKey(t, p))
+	if err == ds.ErrNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load signed record for log %s: %w", p.Pretty(), err)
+	}
+	return logstore.DecodeLogRecord(raw)
+}
+
+func (ab *DsAddrBook) LogsWithAddrs(t thread.ID) (thread.LogIDSlice, error) {
 	ids, err := uniqueLogIds(ab.ds, logBookBase.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes())), func(result query.Result) string {
 		return ds.RawKey(result.Key).Name()
 	})
@@ -204,6 +458,64 @@ func (ab *DsAddrBook) LogsWithAddrs(t thread.ID) (peer.IDSlice, error) {
 	return ids, nil
 }
 
+// ThreadsWithLogAddrs returns threads having addresses of the log.
+func (ab *DsAddrBook) ThreadsWithLogAddrs(p thread.LogID) (thread.IDSlice, error) {
+	ids, err := indexedThreads(ab.ds, addrIndexBase, p)
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving threads of log: %v", err)
+	}
+	return ids, nil
+}
+
+// LogsWithAddr returns logs of all threads having the address. Index entries
+// of addresses removed from logs are dropped lazily here.
+func (ab *DsAddrBook) LogsWithAddr(addr ma.Multiaddr) ([]logstore.ThreadLog, error) {
+	prefix := addrLogsBase.ChildString(base32.RawStdEncoding.EncodeToString(addr.Bytes()))
+	results, err := ab.ds.Query(query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving logs with address: %w", err)
+	}
+
+	var logs []logstore.ThreadLog
+	for _, e := range entries {
+		key := ds.RawKey(e.Key)
+		tid, err := parseThreadID(key.Parent().Name())
+		if err != nil {
+			return nil, fmt.Errorf("bad address index key detected: %s", e.Key)
+		}
+		lid, err := parseLogID(key.Name())
+		if err != nil {
+			return nil, fmt.Errorf("bad address index key detected: %s", e.Key)
+		}
+		pr, err := ab.loadRecord(tid, lid, false, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load peerstore entry for log %s while querying logs: %w", lid.Pretty(), err)
+		}
+		if hasAddr(pr, addr) {
+			logs = append(logs, logstore.ThreadLog{Thread: tid, Log: lid})
+		} else if err := ab.ds.Delete(key); err != nil {
+			return nil, fmt.Errorf("failed to clear address index of log %s: %w", lid.Pretty(), err)
+		}
+	}
+	return logs, nil
+}
+
+func hasAddr(pr *addrsRecord, addr ma.Multiaddr) bool {
+	pr.RLock()
+	defer pr.RUnlock()
+	for _, a := range pr.Addrs {
+		if a.Addr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ThreadsFromAddrs returns a list of threads referenced in the book.
 func (ab *DsAddrBook) ThreadsFromAddrs() (thread.IDSlice, error) {
 	ids, err := uniqueThreadIds(ab.ds, logBookBase, func(result query.Result) string {
 		return ds.RawKey(result.Key).Parent().Name()
@@ -214,6 +526,69 @@ func (ab *DsAddrBook) ThreadsFromAddrs() (thread.IDSlice, error) {
 	return ids, nil
 }
 
+// ForEachThreadFromAddrs calls fn with threads having log addresses until
+// it returns false. Only keys are read from the datastore.
+func (ab *DsAddrBook) ForEachThreadFromAddrs(fn func(thread.ID) bool) error {
+	_, err := forEachThreadKey(ab.ds, logBookBase, 4, fn)
+	return err
+}
+
+// RawAddrEntry is the complete stored form of a log address. It's specific to
+// the datastore-backed address book and intended for debugging only.
+type RawAddrEntry struct {
+	Addr   ma.Multiaddr
+	TTL    time.Duration
+	Expiry time.Time
+	Source logstore.AddrSource
+	// LastDial is zero if the address wasn't dialed.
+	LastDial time.Time
+	RTT      time.Duration
+}
+
+// RawAddrEntries returns the address entries of a log exactly as they are stored
+// in the datastore, bypassing the cache and without purging expired entries.
+func (ab *DsAddrBook) RawAddrEntries(t thread.ID, p thread.LogID) ([]RawAddrEntry, error) {
+	data, err := ab.ds.Get(genDSKey(t, p))
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load raw entries for log %s: %w", p.Pretty(), err)
+	}
+
+	var rec pb.AddrBookRecord
+	if err := rec.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("cannot decode addressbook record: %w", err)
+	}
+	entries := make([]RawAddrEntry, len(rec.Addrs))
+	for i, e := range rec.Addrs {
+		entries[i] = RawAddrEntry{
+			Addr:   e.Addr.Multiaddr,
+			TTL:    time.Duration(e.Ttl),
+			Expiry: time.Unix(e.Expiry, 0),
+			Source: logstore.AddrSource(e.Source),
+			RTT:    time.Duration(e.Rtt),
+		}
+		if e.LastDial != 0 {
+			entries[i].LastDial = time.Unix(0, e.LastDial)
+		}
+	}
+	return entries, nil
+}
+
+// ThreadDiskUsage returns the size of all address records stored for a thread.
+func (ab *DsAddrBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	size, err := prefixDiskUsage(ab.ds, dsThreadKey(t, logBookBase))
+	if err != nil {
+		return 0, err
+	}
+	rsize, err := prefixDiskUsage(ab.ds, dsThreadKey(t, logRecordBase))
+	if err != nil {
+		return 0, err
+	}
+	return size + rsize, nil
+}
+
 // loadRecord is a read-through fetch. It fetches a record from cache, falling back to the
 // datastore upon a miss, and returning a newly initialized record if the peer doesn't exist.
 //
@@ -221,7 +596,7 @@ func (ab *DsAddrBook) ThreadsFromAddrs() (thread.IDSlice, error) {
 // as a result and the update argument is true, the resulting state is saved in the datastore.
 //
 // If the cache argument is true, the record is inserted in the cache when loaded from the datastore.
-func (ab *DsAddrBook) loadRecord(t thread.ID, p peer.ID, cache bool, update bool) (pr *addrsRecord, err error) {
+func (ab *DsAddrBook) loadRecord(t thread.ID, p thread.LogID, cache bool, update bool) (pr *addrsRecord, err error) {
 	cacheKey := genCacheKey(t, p)
 	if e, ok := ab.cache.Get(cacheKey); ok {
 		pr = e.(*addrsRecord)
@@ -240,7 +615,7 @@ func (ab *DsAddrBook) loadRecord(t thread.ID, p peer.ID, cache bool, update bool
 	case ds.ErrNotFound:
 		err = nil
 		pr.ThreadID = &pb.ProtoThreadID{ID: t}
-		pr.PeerID = &pb.ProtoPeerID{ID: p}
+		pr.PeerID = &pb.ProtoPeerID{ID: p.Peer()}
 	case nil:
 		if err = pr.Unmarshal(data); err != nil {
 			return nil, err
@@ -313,9 +688,13 @@ func (r *addrsRecord) clean() (chgd bool) {
 // flush writes the record to the datastore by calling ds.Put, unless the record is
 // marked for deletion, in which case we call ds.Delete. To be called within a lock.
 func (r *addrsRecord) flush(write ds.Write) (err error) {
-	key := genDSKey(r.ThreadID.ID, r.PeerID.ID)
+	key := genDSKey(r.ThreadID.ID, thread.LogIDFromPeer(r.PeerID.ID))
+	idx := dsLogIndexKey(addrIndexBase, thread.LogIDFromPeer(r.PeerID.ID), r.ThreadID.ID)
 	if len(r.Addrs) == 0 {
-		if err = write.Delete(key); err == nil {
+		if err = write.Delete(key); err != nil {
+			return err
+		}
+		if err = write.Delete(idx); err == nil {
 			r.dirty = false
 		}
 		return err
@@ -328,20 +707,32 @@ func (r *addrsRecord) flush(write ds.Write) (err error) {
 	if err = write.Put(key, data); err != nil {
 		return err
 	}
+	if err = write.Put(idx, nil); err != nil {
+		return err
+	}
+	for _, a := range r.Addrs {
+		if err = write.Put(dsAddrLogKey(a.Addr.Bytes(), r.ThreadID.ID, thread.LogIDFromPeer(r.PeerID.ID)), nil); err != nil {
+			return err
+		}
+	}
 	// write succeeded; record is no longer dirty.
 	r.dirty = false
 	return nil
 }
 
-func genDSKey(t thread.ID, p peer.ID) ds.Key {
+func genDSKey(t thread.ID, p thread.LogID) ds.Key {
 	return logBookBase.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes())).ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
 }
 
-func genCacheKey(t thread.ID, p peer.ID) cacheKey {
+func genRecordKey(t thread.ID, p thread.LogID) ds.Key {
+	return logRecordBase.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes())).ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
+}
+
+func genCacheKey(t thread.ID, p thread.LogID) cacheKey {
 	return cacheKey{threadID: t, peerID: p}
 }
 
-func (ab *DsAddrBook) setAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, mode ttlWriteMode) (err error) {
+func (ab *DsAddrBook) setAddrs(write ds.Write, t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src logstore.AddrSource, mode ttlWriteMode) (err error) {
 	pr, err := ab.loadRecord(t, p, true, false)
 	if err != nil {
 		return fmt.Errorf("failed to load peerstore entry for log %v while setting addrs, err: %v", p, err)
@@ -350,6 +741,15 @@ func (ab *DsAddrBook) setAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr, ttl
 	pr.Lock()
 	defer pr.Unlock()
 
+	// certified addresses beat uncertified ones
+	certified, err := ab.certified(t, p, pr)
+	if err != nil {
+		return err
+	}
+	if certified && mode == ttlExtend {
+		return nil
+	}
+
 	newExp := time.Now().Add(ttl).Unix()
 	existed := make([]bool, len(addrs)) // keeps track of which addrs we found.
 
@@ -358,6 +758,9 @@ Outer:
 		for _, have := range pr.Addrs {
 			if incoming.Equal(have.Addr) {
 				existed[i] = true
+				if src != logstore.AddrSourceUnknown {
+					have.Source = string(src)
+				}
 				switch mode {
 				case ttlOverride:
 					have.Ttl = int64(ttl)
@@ -380,31 +783,50 @@ Outer:
 		}
 	}
 
-	// add addresses we didn't hold.
+	// add addresses we didn't hold, once even if they are repeated.
 	var added []*pb.AddrBookRecord_AddrEntry
+	seen := make(map[string]struct{}, len(addrs))
 	for i, e := range existed {
-		if e {
+		if e || certified {
 			continue
 		}
 		addr := addrs[i]
+		if _, ok := seen[string(addr.Bytes())]; ok {
+			continue
+		}
+		seen[string(addr.Bytes())] = struct{}{}
 		entry := &pb.AddrBookRecord_AddrEntry{
 			Addr:   &pb.ProtoAddr{Multiaddr: addr},
 			Ttl:    int64(ttl),
 			Expiry: newExp,
+			Source: string(src),
 		}
 		added = append(added, entry)
 		// note: there's a minor chance that writing the record will fail, in which case we would've broadcast
 		// the addresses without persisting them. This is very unlikely and not much of an issue.
-		ab.subsManager.BroadcastAddr(p, addr)
+		ab.subsManager.BroadcastLogAddr(t, p, addr)
 	}
 
 	pr.Addrs = append(pr.Addrs, added...)
 	pr.dirty = true
 	pr.clean()
-	return pr.flush(ab.ds)
+	return ab.flushRecord(write, pr)
 }
 
-func (ab *DsAddrBook) deleteAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr) (err error) {
+// certified reports whether the log has a signed record with valid addresses.
+// To be called within a lock.
+func (ab *DsAddrBook) certified(t thread.ID, p thread.LogID, pr *addrsRecord) (bool, error) {
+	if len(pr.Addrs) == 0 {
+		return false, nil
+	}
+	has, err := ab.ds.Has(genRecordKey(t, p))
+	if err != nil {
+		return false, fmt.Errorf("failed to check signed record for log %s: %w", p.Pretty(), err)
+	}
+	return has, nil
+}
+
+func (ab *DsAddrBook) deleteAddrs(t thread.ID, p thread.LogID, addrs []ma.Multiaddr) (err error) {
 	pr, err := ab.loadRecord(t, p, false, false)
 	if err != nil {
 		return fmt.Errorf("failed to load peerstore entry for log %v while deleting addrs, err: %v", p, err)
@@ -434,7 +856,26 @@ func (ab *DsAddrBook) deleteAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr)
 
 	pr.dirty = true
 	pr.clean()
-	return pr.flush(ab.ds)
+	return ab.flushRecord(ab.ds, pr)
+}
+
+// flushRecord writes all addresses of the record at once. If the write fails,
+// the cached record is evicted, so it's reloaded with the persisted addresses
+// instead of serving changes that never hit the datastore. To be called
+// within a lock.
+func (ab *DsAddrBook) flushRecord(write ds.Write, pr *addrsRecord) error {
+	if err := pr.flush(write); err != nil {
+		ab.cache.Remove(genCacheKey(pr.ThreadID.ID, thread.LogIDFromPeer(pr.PeerID.ID)))
+		return err
+	}
+	return nil
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
 }
 
 func cleanAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
@@ -451,7 +892,7 @@ func cleanAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 func (ab *DsAddrBook) Close() error {
 	ab.cancelFn()
 	ab.childrenDone.Wait()
-	return nil
+	return syncPrefixes(ab.ds, logBookBase, logRecordBase, addrIndexBase, addrLogsBase)
 }
 
 func (ab *DsAddrBook) DumpAddrs() (logstore.DumpAddrBook, error) {
@@ -461,24 +902,25 @@ func (ab *DsAddrBook) DumpAddrs() (logstore.DumpAddrBook, error) {
 
 	var dump logstore.DumpAddrBook
 	data, err := ab.traverse(true)
-	unlock()
 	if err != nil {
+		unlock()
 		return dump, fmt.Errorf("traversing datastore: %w", err)
 	}
+	records, err := ab.signedRecords()
+	unlock()
+	if err != nil {
+		return dump, fmt.Errorf("traversing signed records: %w", err)
+	}
 
-	dump.Data = make(map[thread.ID]map[peer.ID][]logstore.ExpiredAddress, len(data))
+	dump.Data = make(map[thread.ID]map[thread.LogID][]logstore.ExpiredAddress, len(data))
 
 	for tid, logs := range data {
-		lm := make(map[peer.ID][]logstore.ExpiredAddress, len(logs))
+		lm := make(map[thread.LogID][]logstore.ExpiredAddress, len(logs))
 		for lid, rec := range logs {
 			if len(rec.Addrs) > 0 {
 				var addrs = make([]logstore.ExpiredAddress, len(rec.Addrs))
 				for i := 0; i < len(rec.Addrs); i++ {
-					var r = rec.Addrs[i]
-					addrs[i] = logstore.ExpiredAddress{
-						Addr:    r.Addr,
-						Expires: time.Unix(r.Expiry, 0),
-					}
+					addrs[i] = expiredAddress(rec.Addrs[i])
 				}
 				lm[lid] = addrs
 			}
@@ -486,6 +928,18 @@ func (ab *DsAddrBook) DumpAddrs() (logstore.DumpAddrBook, error) {
 		dump.Data[tid] = lm
 	}
 
+	dump.Records = make(map[thread.ID]map[thread.LogID][]byte, len(records))
+	for tid, logs := range records {
+		for lid, raw := range logs {
+			if _, ok := dump.Data[tid][lid]; !ok {
+				continue
+			}
+			if dump.Records[tid] == nil {
+				dump.Records[tid] = make(map[thread.LogID][]byte, len(logs))
+			}
+			dump.Records[tid][lid] = raw
+		}
+	}
 	return dump, nil
 }
 
@@ -502,33 +956,132 @@ func (ab *DsAddrBook) RestoreAddrs(dump logstore.DumpAddrBook) error {
 	if err != nil {
 		return fmt.Errorf("traversing datastore: %w", err)
 	}
-
-	for tid, logs := range stored {
-		for lid := range logs {
-			if err := ab.ClearAddrs(tid, lid); err != nil {
-				return fmt.Errorf("clearing addrs for %s/%s: %w", tid, lid, err)
-			}
-		}
+	storedRecords, err := ab.signedRecords()
+	if err != nil {
+		return fmt.Errorf("traversing signed records: %w", err)
 	}
 
-	var current = time.Now()
+	// Build complete records and replace the stored ones in a single batch,
+	// so an interrupted restore never leaves logs with part of addresses.
+	batch, err := ab.ds.Batch()
+	if err != nil {
+		return fmt.Errorf("creating batch: %w", err)
+	}
+	var (
+		current  = time.Now()
+		restored []*addrsRecord
+	)
 	for tid, logs := range dump.Data {
 		for lid, addrs := range logs {
+			pr := &addrsRecord{AddrBookRecord: &pb.AddrBookRecord{
+				ThreadID: &pb.ProtoThreadID{ID: tid},
+				PeerID:   &pb.ProtoPeerID{ID: lid.Peer()},
+			}}
 			for _, addr := range addrs {
 				if ttl := addr.Expires.Sub(current); ttl > 0 {
-					if err := ab.setAddrs(tid, lid, []ma.Multiaddr{addr.Addr}, ttl, ttlOverride); err != nil {
-						return fmt.Errorf("setting address %s for %s/%s: %w", addr.Addr, tid, lid, err)
-					}
+					pr.Addrs = append(pr.Addrs, &pb.AddrBookRecord_AddrEntry{
+						Addr:     &pb.ProtoAddr{Multiaddr: addr.Addr},
+						Ttl:      int64(ttl),
+						Expiry:   addr.Expires.Unix(),
+						Source:   string(addr.Source),
+						LastDial: unixNano(addr.LastDial),
+						Rtt:      int64(addr.RTT),
+					})
 				}
 			}
+			if len(pr.Addrs) == 0 {
+				continue
+			}
+			pr.dirty = true
+			pr.clean()
+			if err := pr.flush(batch); err != nil {
+				return fmt.Errorf("writing addrs for %s/%s: %w", tid, lid, err)
+			}
+			restored = append(restored, pr)
+			delete(stored[tid], lid)
+		}
+	}
+	for tid, logs := range stored {
+		for lid := range logs {
+			if err := batch.Delete(genDSKey(tid, lid)); err != nil {
+				return fmt.Errorf("clearing addrs for %s/%s: %w", tid, lid, err)
+			}
+			if err := batch.Delete(dsLogIndexKey(addrIndexBase, lid, tid)); err != nil {
+				return fmt.Errorf("clearing index for %s/%s: %w", tid, lid, err)
+			}
+		}
+	}
+	for tid, logs := range storedRecords {
+		for lid := range logs {
+			if _, ok := dump.Records[tid][lid]; ok {
+				continue
+			}
+			if err := batch.Delete(genRecordKey(tid, lid)); err != nil {
+				return fmt.Errorf("clearing signed record for %s/%s: %w", tid, lid, err)
+			}
 		}
 	}
+	for tid, logs := range dump.Records {
+		for lid, raw := range logs {
+			if _, _, err := logstore.DecodeLogRecord(raw); err != nil {
+				return fmt.Errorf("decoding signed record for %s/%s: %w", tid, lid, err)
+			}
+			if err := batch.Put(genRecordKey(tid, lid), raw); err != nil {
+				return fmt.Errorf("writing signed record for %s/%s: %w", tid, lid, err)
+			}
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("committing restored addrs: %w", err)
+	}
 
+	for _, k := range ab.cache.Keys() {
+		ab.cache.Remove(k)
+	}
+	for _, pr := range restored {
+		for _, entry := range pr.Addrs {
+			ab.subsManager.BroadcastLogAddr(pr.ThreadID.ID, thread.LogIDFromPeer(pr.PeerID.ID), entry.Addr.Multiaddr)
+		}
+	}
 	return nil
 }
 
-func (ab *DsAddrBook) traverse(withAddrs bool) (map[thread.ID]map[peer.ID]*pb.AddrBookRecord, error) {
-	var data = make(map[thread.ID]map[peer.ID]*pb.AddrBookRecord)
+// signedRecords returns all stored signed log records in serialized form.
+func (ab *DsAddrBook) signedRecords() (map[thread.ID]map[thread.LogID][]byte, error) {
+	var data = make(map[thread.ID]map[thread.LogID][]byte)
+	result, err := ab.ds.Query(query.Query{Prefix: logRecordBase.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	for entry := range result.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+		kns := ds.RawKey(entry.Key).Namespaces()
+		if len(kns) < 3 {
+			return nil, fmt.Errorf("bad signed record key detected: %s", entry.Key)
+		}
+		ts, ls := kns[len(kns)-2], kns[len(kns)-1]
+		tid, err := parseThreadID(ts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot restore thread ID %s: %w", ts, err)
+		}
+		lid, err := parseLogID(ls)
+		if err != nil {
+			return nil, fmt.Errorf("cannot restore log ID %s: %w", ls, err)
+		}
+		if data[tid] == nil {
+			data[tid] = make(map[thread.LogID][]byte)
+		}
+		data[tid][lid] = entry.Value
+	}
+	return data, nil
+}
+
+func (ab *DsAddrBook) traverse(withAddrs bool) (map[thread.ID]map[thread.LogID]*pb.AddrBookRecord, error) {
+	var data = make(map[thread.ID]map[thread.LogID]*pb.AddrBookRecord)
 	result, err := ab.ds.Query(query.Query{Prefix: logBookBase.String(), KeysOnly: !withAddrs})
 	if err != nil {
 		return nil, err
@@ -567,7 +1120,7 @@ func (ab *DsAddrBook) traverse(withAddrs bool) (map[thread.ID]map[peer.ID]*pb.Ad
 
 		la, exist := data[tid]
 		if !exist {
-			la = make(map[peer.ID]*pb.AddrBookRecord)
+			la = make(map[thread.LogID]*pb.AddrBookRecord)
 			data[tid] = la
 		}
 		la[lid] = record
@@ -3,10 +3,13 @@ package lstoreds
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	query "github.com/ipfs/go-datastore/query"
+	"github.com/textileio/go-threads/core/thread"
 	pb "github.com/textileio/go-threads/net/pb"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
@@ -19,6 +22,10 @@ var (
 
 // dsAddrBookGc is responsible for garbage collection in a datastore-backed address book.
 type dsAddrBookGc struct {
+	// purged counts addresses removed by all GC cycles, accessed atomically.
+	// Kept first for 64-bit alignment.
+	purged uint64
+
 	ctx       context.Context
 	ab        *DsAddrBook
 	running   chan struct{}
@@ -80,18 +87,28 @@ func (gc *dsAddrBookGc) purgeStore() {
 		return
 	}
 
+	if _, err := gc.purge(); err != nil {
+		log.Warnf("failed to purge expired addresses: %v", err)
+		gc.ab.opts.Events.Log("addr", zapcore.ErrorLevel, "gc cycle failed", "error", err.Error())
+	}
+}
+
+// purge removes expired addresses from the datastore and returns how many of
+// them were removed. To be called with the running slot taken.
+func (gc *dsAddrBookGc) purge() (int, error) {
+	start := time.Now()
 	batch, err := newCyclicBatch(gc.ab.ds, defaultOpsPerCyclicBatch)
 	if err != nil {
-		log.Warnf("failed while creating batch to purge GC entries: %v", err)
+		return 0, fmt.Errorf("creating batch to purge GC entries: %w", err)
 	}
 
 	results, err := gc.ab.ds.Query(purgeStoreQuery)
 	if err != nil {
-		log.Warnf("failed while opening iterator: %v", err)
-		return
+		return 0, fmt.Errorf("opening iterator: %w", err)
 	}
 	defer results.Close()
 
+	var purged int
 	record := &addrsRecord{AddrBookRecord: &pb.AddrBookRecord{}} // empty record to reuse and avoid allocs.
 	// keys: 	/thread/addrs/<thread ID b32>
 	for result := range results.Next() {
@@ -101,18 +118,41 @@ func (gc *dsAddrBookGc) purgeStore() {
 			continue
 		}
 
+		before := len(record.Addrs)
 		if !record.clean() {
 			continue
 		}
 
-		id := genCacheKey(record.ThreadID.ID, record.PeerID.ID)
+		id := genCacheKey(record.ThreadID.ID, thread.LogIDFromPeer(record.PeerID.ID))
 		if err := record.flush(batch); err != nil {
-			log.Warnf("failed to flush entry modified by GC for peer: &v, err: %v", id, err)
+			log.Warnf("failed to flush entry modified by GC for peer: %v, err: %v", id, err)
+			continue
 		}
 		gc.ab.cache.Remove(id)
+		purged += before - len(record.Addrs)
 	}
 
 	if err = batch.Commit(); err != nil {
-		log.Warnf("failed to commit GC purge batch: %v", err)
+		return 0, fmt.Errorf("committing GC purge batch: %w", err)
 	}
+	atomic.AddUint64(&gc.purged, uint64(purged))
+	gc.ab.opts.Events.Log("addr", zapcore.InfoLevel, "gc cycle done", "purged", purged, "duration", time.Since(start))
+	return purged, nil
+}
+
+// TriggerGC runs a GC cycle right away, waiting for a running one to finish
+// first. It returns the number of purged expired addresses.
+func (ab *DsAddrBook) TriggerGC() (int, error) {
+	select {
+	case ab.gc.running <- struct{}{}:
+		defer func() { <-ab.gc.running }()
+	case <-ab.ctx.Done():
+		return 0, ab.ctx.Err()
+	}
+	return ab.gc.purge()
+}
+
+// PurgedAddrs returns the total number of expired addresses purged by GC.
+func (ab *DsAddrBook) PurgedAddrs() uint64 {
+	return atomic.LoadUint64(&ab.gc.purged)
 }
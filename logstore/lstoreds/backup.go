@@ -0,0 +1,406 @@
+package lstoreds
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Backups start with a magic prefix followed by the format version as
+// uvarint. Then every datastore entry follows as uvarint length and key,
+// and uvarint length and value.
+const (
+	backupMagic   = "lstoreds-backup"
+	backupVersion = 1
+)
+
+// maxBackupEntry caps the size of keys and values read from backups, so
+// that corrupt backups don't exhaust memory.
+const maxBackupEntry = 1 << 30
+
+// ErrBackupsInUse indicates Backups attached to another logstore.
+var ErrBackupsInUse = errors.New("backups are attached to another logstore")
+
+// Backups takes online backups of the logstore they are attached to with
+// Options.Backups. A backup holds the datastore entries of the logstore at
+// the point it started, while writers carry on: entries are copied on
+// their first write during the backup. Private keys kept in
+// Options.KeyStorage are not included.
+type Backups struct {
+	// lock is held shared by writes and exclusively to start and end
+	// backups.
+	lock  sync.RWMutex
+	store ds.Datastore
+	// cow is set during a backup.
+	cow *copyOnWrite
+
+	// running serializes backups.
+	running sync.Mutex
+}
+
+// copyOnWrite holds entries of a backup changed since it started.
+type copyOnWrite struct {
+	// lock serializes writes, so that entries are saved before they change.
+	lock sync.Mutex
+	// saved values are nil for entries absent at the start.
+	saved map[ds.Key][]byte
+	// copied entries were written to the backup.
+	copied map[ds.Key]struct{}
+}
+
+// NewBackups creates backups to be attached to a logstore.
+func NewBackups() *Backups {
+	return &Backups{}
+}
+
+func (b *Backups) attach(store ds.Batching, txnStore ds.TxnDatastore) (*backupDatastore, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.store != nil {
+		return nil, ErrBackupsInUse
+	}
+	b.store = store
+	return &backupDatastore{Batching: store, txnStore: txnStore, b: b}, nil
+}
+
+// detach waits for a running backup to end and frees the backups for
+// another logstore.
+func (b *Backups) detach() {
+	b.running.Lock()
+	defer b.running.Unlock()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.store = nil
+}
+
+// backupsCloser detaches backups when the logstore is closed.
+type backupsCloser struct {
+	b *Backups
+}
+
+func (c backupsCloser) Close() error {
+	c.b.detach()
+	return nil
+}
+
+// Backup writes the entries of the logstore to w. They are restored into
+// an empty datastore with RestoreBackup.
+func (b *Backups) Backup(ctx context.Context, w io.Writer) error {
+	b.running.Lock()
+	defer b.running.Unlock()
+
+	b.lock.Lock()
+	store := b.store
+	if store == nil {
+		b.lock.Unlock()
+		return fmt.Errorf("backups are not attached to a logstore")
+	}
+	cow := &copyOnWrite{saved: make(map[ds.Key][]byte), copied: make(map[ds.Key]struct{})}
+	b.cow = cow
+	b.lock.Unlock()
+	defer func() {
+		b.lock.Lock()
+		b.cow = nil
+		b.lock.Unlock()
+	}()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(backupMagic); err != nil {
+		return err
+	}
+	if err := writeUvarint(bw, backupVersion); err != nil {
+		return err
+	}
+
+	results, err := store.Query(query.Query{})
+	if err != nil {
+		return fmt.Errorf("querying datastore: %w", err)
+	}
+	defer results.Close()
+	for res := range results.Next() {
+		if res.Error != nil {
+			return fmt.Errorf("querying datastore: %w", res.Error)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := ds.RawKey(res.Key)
+		value, ok := cow.copy(key, res.Value)
+		if !ok {
+			continue
+		}
+		if err := writeBackupEntry(bw, key, value); err != nil {
+			return err
+		}
+	}
+
+	// entries deleted before they were reached
+	cow.lock.Lock()
+	defer cow.lock.Unlock()
+	for key, value := range cow.saved {
+		if _, ok := cow.copied[key]; ok || value == nil {
+			continue
+		}
+		if err := writeBackupEntry(bw, key, value); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// BackupToDir writes a backup into a new file of the directory and
+// returns its path. The file only appears once the backup is complete.
+func (b *Backups) BackupToDir(ctx context.Context, dir string) (string, error) {
+	f, err := ioutil.TempFile(dir, ".backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if err := b.Backup(ctx, f); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("lstoreds-%s.backup", time.Now().UTC().Format("20060102T150405.000000000Z")))
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// copy returns the value of the entry at the start of the backup, given
+// its current value, and whether it existed and wasn't copied yet.
+func (c *copyOnWrite) copy(key ds.Key, current []byte) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.copied[key]; ok {
+		return nil, false
+	}
+	c.copied[key] = struct{}{}
+	if saved, ok := c.saved[key]; ok {
+		return saved, saved != nil
+	}
+	return current, true
+}
+
+// save keeps the values of entries about to change, unless they were
+// saved or copied already.
+func (c *copyOnWrite) save(store ds.Datastore, keys []ds.Key) error {
+	for _, key := range keys {
+		if _, ok := c.saved[key]; ok {
+			continue
+		}
+		if _, ok := c.copied[key]; ok {
+			continue
+		}
+		value, err := store.Get(key)
+		if errors.Is(err, ds.ErrNotFound) {
+			value = nil
+		} else if err != nil {
+			return fmt.Errorf("saving entry for backup: %w", err)
+		} else if value == nil {
+			value = []byte{}
+		}
+		c.saved[key] = value
+	}
+	return nil
+}
+
+// write applies a write of the keys, saving their values first during a
+// backup.
+func (b *Backups) write(keys []ds.Key, apply func() error) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.cow == nil {
+		return apply()
+	}
+	b.cow.lock.Lock()
+	defer b.cow.lock.Unlock()
+	if err := b.cow.save(b.store, keys); err != nil {
+		return err
+	}
+	return apply()
+}
+
+// RestoreBackup writes the entries of a backup read from r to the
+// datastore, which should be empty.
+func RestoreBackup(store ds.Batching, r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("reading backup header: %w", err)
+	}
+	if string(magic) != backupMagic {
+		return fmt.Errorf("not a logstore backup")
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("reading backup version: %w", err)
+	}
+	if version != backupVersion {
+		return fmt.Errorf("unsupported backup version %d", version)
+	}
+
+	batch, err := store.Batch()
+	if err != nil {
+		return err
+	}
+	for {
+		key, err := readBackupBytes(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading backup: %w", err)
+		}
+		value, err := readBackupBytes(br)
+		if err != nil {
+			return fmt.Errorf("reading backup: %w", unexpectedEOF(err))
+		}
+		if err := batch.Put(ds.RawKey(string(key)), value); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	return store.Sync(ds.NewKey("/"))
+}
+
+func writeBackupEntry(w *bufio.Writer, key ds.Key, value []byte) error {
+	for _, b := range [][]byte{key.Bytes(), value} {
+		if err := writeUvarint(w, uint64(len(b))); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeUvarint(w *bufio.Writer, n uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	_, err := w.Write(buf[:binary.PutUvarint(buf[:], n)])
+	return err
+}
+
+func readBackupBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxBackupEntry {
+		return nil, fmt.Errorf("backup entry of %d bytes exceeds limit", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// backupDatastore saves entries for a running backup before writing them.
+type backupDatastore struct {
+	ds.Batching
+	txnStore ds.TxnDatastore
+	b        *Backups
+}
+
+var (
+	_ ds.Batching     = (*backupDatastore)(nil)
+	_ ds.TxnDatastore = (*backupDatastore)(nil)
+)
+
+func (d *backupDatastore) Put(key ds.Key, value []byte) error {
+	return d.b.write([]ds.Key{key}, func() error {
+		return d.Batching.Put(key, value)
+	})
+}
+
+func (d *backupDatastore) Delete(key ds.Key) error {
+	return d.b.write([]ds.Key{key}, func() error {
+		return d.Batching.Delete(key)
+	})
+}
+
+func (d *backupDatastore) Batch() (ds.Batch, error) {
+	b, err := d.Batching.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &backupBatch{Batch: b, b: d.b}, nil
+}
+
+func (d *backupDatastore) NewTransaction(readOnly bool) (ds.Txn, error) {
+	txn, err := d.txnStore.NewTransaction(readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &backupTxn{Txn: txn, b: d.b}, nil
+}
+
+// backupBatch tracks keys written by a batch, to be saved on commit.
+type backupBatch struct {
+	ds.Batch
+	b    *Backups
+	keys []ds.Key
+}
+
+func (b *backupBatch) Put(key ds.Key, value []byte) error {
+	b.keys = append(b.keys, key)
+	return b.Batch.Put(key, value)
+}
+
+func (b *backupBatch) Delete(key ds.Key) error {
+	b.keys = append(b.keys, key)
+	return b.Batch.Delete(key)
+}
+
+func (b *backupBatch) Commit() error {
+	return b.b.write(b.keys, b.Batch.Commit)
+}
+
+// backupTxn tracks keys written by a transaction, to be saved on commit.
+type backupTxn struct {
+	ds.Txn
+	b    *Backups
+	keys []ds.Key
+}
+
+func (t *backupTxn) Put(key ds.Key, value []byte) error {
+	t.keys = append(t.keys, key)
+	return t.Txn.Put(key, value)
+}
+
+func (t *backupTxn) Delete(key ds.Key) error {
+	t.keys = append(t.keys, key)
+	return t.Txn.Delete(key)
+}
+
+func (t *backupTxn) Commit() error {
+	return t.b.write(t.keys, t.Txn.Commit)
+}
@@ -0,0 +1,265 @@
+package lstoreds
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// Codec serializes thread metadata values kept in the datastore. Values are
+// always one of int64, bool, string or []byte, and codecs must decode them
+// into the same type.
+type Codec interface {
+	// Name identifies the codec in the datastore.
+	Name() string
+
+	// Marshal encodes the value.
+	Marshal(val interface{}) ([]byte, error)
+
+	// Unmarshal decodes a value encoded with Marshal.
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+var (
+	// GobCodec encodes values with encoding/gob. It's the default codec
+	// and the one used by stores created before codecs were configurable.
+	GobCodec Codec = gobCodec{}
+
+	// JSONCodec encodes values as JSON objects keyed by the value type,
+	// which is convenient for debugging.
+	JSONCodec Codec = jsonCodec{}
+
+	// CBORCodec encodes values as plain CBOR items.
+	CBORCodec Codec = cborCodec{}
+
+	// ProtoCodec encodes values as protobuf Any messages holding the
+	// well-known wrapper types.
+	ProtoCodec Codec = protoCodec{}
+)
+
+// ErrCodecMismatch indicates the datastore holds metadata encoded with
+// another codec.
+var ErrCodecMismatch = errors.New("datastore metadata codec mismatch")
+
+// Name of the codec used for metadata is stored in db key:
+// /thread/codec
+var codecKey = ds.NewKey("/thread/codec")
+
+// checkCodec ensures the store is used with a single codec, recording
+// the codec of new stores.
+func checkCodec(store ds.Datastore, c Codec) error {
+	v, err := store.Get(codecKey)
+	if err == ds.ErrNotFound {
+		// metadata written before codecs were recorded is gob encoded
+		results, err := store.Query(query.Query{Prefix: tmetaBase.String(), KeysOnly: true, Limit: 1})
+		if err != nil {
+			return err
+		}
+		existing, err := results.Rest()
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 && c.Name() != GobCodec.Name() {
+			return fmt.Errorf("%w: stored with %s, got %s", ErrCodecMismatch, GobCodec.Name(), c.Name())
+		}
+		return store.Put(codecKey, []byte(c.Name()))
+	}
+	if err != nil {
+		return fmt.Errorf("getting metadata codec: %w", err)
+	}
+	if string(v) != c.Name() {
+		return fmt.Errorf("%w: stored with %s, got %s", ErrCodecMismatch, v, c.Name())
+	}
+	return nil
+}
+
+func unsupportedValue(val interface{}) error {
+	return fmt.Errorf("unsupported value type %T", val)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(val interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal tries every known type, since gob streams of basic types don't
+// carry the type on the wire.
+func (gobCodec) Unmarshal(data []byte) (interface{}, error) {
+	var (
+		vInt64  int64
+		vBool   bool
+		vString string
+		vBytes  []byte
+	)
+	for _, res := range []interface{}{&vInt64, &vBool, &vString, &vBytes} {
+		if gob.NewDecoder(bytes.NewReader(data)).Decode(res) == nil {
+			switch v := res.(type) {
+			case *int64:
+				return *v, nil
+			case *bool:
+				return *v, nil
+			case *string:
+				return *v, nil
+			case *[]byte:
+				return *v, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot decode gob value %v", data)
+}
+
+type jsonCodec struct{}
+
+// jsonValue holds exactly one of the values.
+type jsonValue struct {
+	Int64  *int64  `json:"int64,omitempty"`
+	Bool   *bool   `json:"bool,omitempty"`
+	String *string `json:"string,omitempty"`
+	Bytes  *[]byte `json:"bytes,omitempty"`
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(val interface{}) ([]byte, error) {
+	var jv jsonValue
+	switch v := val.(type) {
+	case int64:
+		jv.Int64 = &v
+	case bool:
+		jv.Bool = &v
+	case string:
+		jv.String = &v
+	case []byte:
+		jv.Bytes = &v
+	default:
+		return nil, unsupportedValue(val)
+	}
+	return json.Marshal(jv)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (interface{}, error) {
+	var jv jsonValue
+	if err := json.Unmarshal(data, &jv); err != nil {
+		return nil, err
+	}
+	switch {
+	case jv.Int64 != nil:
+		return *jv.Int64, nil
+	case jv.Bool != nil:
+		return *jv.Bool, nil
+	case jv.String != nil:
+		return *jv.String, nil
+	case jv.Bytes != nil:
+		if *jv.Bytes == nil {
+			return []byte{}, nil
+		}
+		return *jv.Bytes, nil
+	default:
+		return nil, fmt.Errorf("empty json value")
+	}
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (cborCodec) Marshal(val interface{}) ([]byte, error) {
+	switch val.(type) {
+	case int64, bool, string, []byte:
+		return cbornode.DumpObject(val)
+	default:
+		return nil, unsupportedValue(val)
+	}
+}
+
+func (cborCodec) Unmarshal(data []byte) (interface{}, error) {
+	var val interface{}
+	if err := cbornode.DecodeInto(data, &val); err != nil {
+		return nil, err
+	}
+	// integers are decoded with the smallest fitting type
+	switch v := val.(type) {
+	case int:
+		return int64(v), nil
+	case int64, bool, string, []byte:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	default:
+		return nil, fmt.Errorf("unexpected cbor value type %T", val)
+	}
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "protobuf"
+}
+
+func (protoCodec) Marshal(val interface{}) ([]byte, error) {
+	var msg proto.Message
+	switch v := val.(type) {
+	case int64:
+		msg = &types.Int64Value{Value: v}
+	case bool:
+		msg = &types.BoolValue{Value: v}
+	case string:
+		msg = &types.StringValue{Value: v}
+	case []byte:
+		msg = &types.BytesValue{Value: v}
+	default:
+		return nil, unsupportedValue(val)
+	}
+	a, err := types.MarshalAny(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(a)
+}
+
+func (protoCodec) Unmarshal(data []byte) (interface{}, error) {
+	var a types.Any
+	if err := proto.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	var da types.DynamicAny
+	if err := types.UnmarshalAny(&a, &da); err != nil {
+		return nil, err
+	}
+	switch v := da.Message.(type) {
+	case *types.Int64Value:
+		return v.Value, nil
+	case *types.BoolValue:
+		return v.Value, nil
+	case *types.StringValue:
+		return v.Value, nil
+	case *types.BytesValue:
+		if v.Value == nil {
+			return []byte{}, nil
+		}
+		return v.Value, nil
+	default:
+		return nil, fmt.Errorf("unexpected protobuf message %s", a.TypeUrl)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	ds "github.com/ipfs/go-datastore"
+	core "github.com/textileio/go-threads/core/logstore"
 )
 
 // how many operations are queued in a cyclic batch before we flush it.
@@ -21,17 +22,17 @@ type cyclicBatch struct {
 	pending int
 }
 
-func newCyclicBatch(ds ds.Batching, _ int) (ds.Batch, error) {
+func newCyclicBatch(ds ds.Batching, threshold int) (ds.Batch, error) {
 	batch, err := ds.Batch()
 	if err != nil {
 		return nil, err
 	}
-	return &cyclicBatch{Batch: batch, ds: ds}, nil
+	return &cyclicBatch{threshold: threshold, Batch: batch, ds: ds}, nil
 }
 
 func (cb *cyclicBatch) cycle() (err error) {
 	if cb.Batch == nil {
-		return fmt.Errorf("cyclic batch is closed")
+		return fmt.Errorf("%w: cyclic batch", core.ErrClosed)
 	}
 	if cb.pending < cb.threshold {
 		// we haven't reached the threshold yet.
@@ -44,6 +45,7 @@ func (cb *cyclicBatch) cycle() (err error) {
 	if cb.Batch, err = cb.ds.Batch(); err != nil {
 		return fmt.Errorf("failed while renewing cyclic batch: %s", err)
 	}
+	cb.pending = 0
 	return nil
 }
 
@@ -65,7 +67,7 @@ func (cb *cyclicBatch) Delete(key ds.Key) error {
 
 func (cb *cyclicBatch) Commit() error {
 	if cb.Batch == nil {
-		return fmt.Errorf("cyclic batch is closed")
+		return fmt.Errorf("%w: cyclic batch", core.ErrClosed)
 	}
 	if err := cb.Batch.Commit(); err != nil {
 		return err
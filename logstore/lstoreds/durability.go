@@ -0,0 +1,144 @@
+package lstoreds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// Durability selects when writes of a logstore are flushed to stable
+// storage, trading write throughput for crash safety.
+type Durability int
+
+const (
+	// DurabilityOnClose flushes writes when the logstore is closed, leaving
+	// it to the datastore otherwise.
+	DurabilityOnClose Durability = iota
+
+	// DurabilityPeriodic additionally flushes writes every FlushInterval,
+	// bounding writes lost on a crash to the ones of the last interval.
+	DurabilityPeriodic
+
+	// DurabilityEveryWrite flushes every write before it returns.
+	DurabilityEveryWrite
+)
+
+// DefaultFlushInterval is the period of flushes with DurabilityPeriodic if
+// Options.FlushInterval isn't set.
+var DefaultFlushInterval = time.Second
+
+func (d Durability) String() string {
+	switch d {
+	case DurabilityOnClose:
+		return "on-close"
+	case DurabilityPeriodic:
+		return "periodic"
+	case DurabilityEveryWrite:
+		return "every-write"
+	default:
+		return fmt.Sprintf("Durability(%d)", int(d))
+	}
+}
+
+// syncedDatastore flushes every write, including batches and transactions,
+// before returning.
+type syncedDatastore struct {
+	ds.Batching
+	txnStore ds.TxnDatastore
+}
+
+var (
+	_ ds.Batching     = (*syncedDatastore)(nil)
+	_ ds.TxnDatastore = (*syncedDatastore)(nil)
+)
+
+func (d *syncedDatastore) Put(key ds.Key, value []byte) error {
+	if err := d.Batching.Put(key, value); err != nil {
+		return err
+	}
+	return d.Batching.Sync(key)
+}
+
+func (d *syncedDatastore) Delete(key ds.Key) error {
+	if err := d.Batching.Delete(key); err != nil {
+		return err
+	}
+	return d.Batching.Sync(key)
+}
+
+func (d *syncedDatastore) Batch() (ds.Batch, error) {
+	b, err := d.Batching.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &syncedBatch{Batch: b, store: d.Batching}, nil
+}
+
+func (d *syncedDatastore) NewTransaction(readOnly bool) (ds.Txn, error) {
+	txn, err := d.txnStore.NewTransaction(readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &syncedTxn{Txn: txn, store: d.Batching}, nil
+}
+
+type syncedBatch struct {
+	ds.Batch
+	store ds.Datastore
+}
+
+func (b *syncedBatch) Commit() error {
+	if err := b.Batch.Commit(); err != nil {
+		return err
+	}
+	return b.store.Sync(ds.NewKey("/"))
+}
+
+type syncedTxn struct {
+	ds.Txn
+	store ds.Datastore
+}
+
+func (t *syncedTxn) Commit() error {
+	if err := t.Txn.Commit(); err != nil {
+		return err
+	}
+	return t.store.Sync(ds.NewKey("/"))
+}
+
+// flusher flushes writes of the datastore at regular intervals until the
+// context is done or it's closed.
+type flusher struct {
+	cancel func()
+	done   chan struct{}
+}
+
+func startFlusher(ctx context.Context, store ds.Datastore, interval time.Duration) *flusher {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &flusher{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := store.Sync(ds.NewKey("/")); err != nil {
+					log.Warnf("failed to flush datastore: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return f
+}
+
+// Close stops flushing. Pending writes are flushed by the books on close.
+func (f *flusher) Close() error {
+	f.cancel()
+	<-f.done
+	return nil
+}
@@ -0,0 +1,343 @@
+package lstoreds
+
+import (
+	"fmt"
+	"strconv"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	pb "github.com/textileio/go-threads/net/pb"
+)
+
+// FsckProblem is the kind of a problem found by Fsck.
+type FsckProblem int
+
+const (
+	// FsckCorrupt entries have malformed keys or values which can't be
+	// decoded.
+	FsckCorrupt FsckProblem = iota
+	// FsckOrphaned entries belong to logs or threads which are gone, e.g.
+	// addresses of logs without keys or metadata of deleted threads.
+	FsckOrphaned
+)
+
+func (p FsckProblem) String() string {
+	switch p {
+	case FsckCorrupt:
+		return "corrupt"
+	case FsckOrphaned:
+		return "orphaned"
+	default:
+		return fmt.Sprintf("FsckProblem(%d)", int(p))
+	}
+}
+
+// FsckIssue is an entry of the datastore with a problem.
+type FsckIssue struct {
+	Key     ds.Key
+	Problem FsckProblem
+	Reason  string
+}
+
+func (i FsckIssue) String() string {
+	return fmt.Sprintf("%s: %s entry: %s", i.Key, i.Problem, i.Reason)
+}
+
+// FsckReport summarizes a check of the datastore.
+type FsckReport struct {
+	// Checked is the number of entries checked.
+	Checked int
+	// Issues lists entries with problems.
+	Issues []FsckIssue
+	// Pruned is the number of entries deleted by a repair.
+	Pruned int
+}
+
+// String returns a one-line summary of the report.
+func (r FsckReport) String() string {
+	counts := make(map[FsckProblem]int)
+	for _, i := range r.Issues {
+		counts[i.Problem]++
+	}
+	return fmt.Sprintf("checked %d entries: %d corrupt, %d orphaned, %d pruned",
+		r.Checked, counts[FsckCorrupt], counts[FsckOrphaned], r.Pruned)
+}
+
+// Fsck checks the integrity of the logstore entries of the datastore, which
+// must not be open meanwhile. It reports entries which are corrupt or
+// orphaned, and prunes them if repair is set. Options must match the ones
+// the logstore is opened with, so that values can be decoded.
+func Fsck(store ds.Batching, opts Options, repair bool) (FsckReport, error) {
+	codec := opts.MetaCodec
+	if codec == nil {
+		codec = GobCodec
+	}
+	f := &fsck{
+		codec:    codec,
+		enc:      opts.MasterKey,
+		logs:     make(map[string]struct{}),
+		threads:  make(map[string]struct{}),
+		addrs:    make(map[string]struct{}),
+		metaKeys: make(map[string]struct{}),
+	}
+	if err := f.index(store); err != nil {
+		return f.report, err
+	}
+
+	results, err := store.Query(query.Query{Prefix: "/thread"})
+	if err != nil {
+		return f.report, err
+	}
+	defer results.Close()
+	for res := range results.Next() {
+		if res.Error != nil {
+			return f.report, res.Error
+		}
+		f.report.Checked++
+		key := ds.RawKey(res.Key)
+		if problem, reason := f.check(key, res.Value); reason != "" {
+			f.report.Issues = append(f.report.Issues, FsckIssue{Key: key, Problem: problem, Reason: reason})
+		}
+	}
+	if !repair || len(f.report.Issues) == 0 {
+		return f.report, nil
+	}
+
+	batch, err := newCyclicBatch(store, defaultOpsPerCyclicBatch)
+	if err != nil {
+		return f.report, err
+	}
+	for _, issue := range f.report.Issues {
+		if err := batch.Delete(issue.Key); err != nil {
+			return f.report, fmt.Errorf("pruning %s: %w", issue.Key, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return f.report, fmt.Errorf("pruning entries: %w", err)
+	}
+	f.report.Pruned = len(f.report.Issues)
+	return f.report, nil
+}
+
+type fsck struct {
+	codec Codec
+	enc   *sym.Key
+
+	// logs having keys and threads having keys, addresses or heads, by
+	// their encoded IDs joined with a slash
+	logs    map[string]struct{}
+	threads map[string]struct{}
+	// logs having addresses
+	addrs map[string]struct{}
+	// metadata keys
+	metaKeys map[string]struct{}
+
+	report FsckReport
+}
+
+// index collects the logs and threads present in the datastore.
+func (f *fsck) index(store ds.Datastore) error {
+	for _, base := range []ds.Key{kbBase, logBookBase, hbBase, tmetaBase} {
+		results, err := store.Query(query.Query{Prefix: base.String(), KeysOnly: true})
+		if err != nil {
+			return err
+		}
+		for res := range results.Next() {
+			if res.Error != nil {
+				results.Close()
+				return res.Error
+			}
+			kns := ds.RawKey(res.Key).Namespaces()
+			if len(kns) < 3 {
+				continue
+			}
+			switch base {
+			case kbBase:
+				f.threads[kns[2]] = struct{}{}
+				if len(kns) == 5 {
+					f.logs[kns[2]+"/"+kns[3]] = struct{}{}
+				}
+			case logBookBase:
+				f.threads[kns[2]] = struct{}{}
+				if len(kns) == 4 {
+					f.addrs[kns[2]+"/"+kns[3]] = struct{}{}
+				}
+			case hbBase:
+				f.threads[kns[2]] = struct{}{}
+			case tmetaBase:
+				f.metaKeys[res.Key] = struct{}{}
+			}
+		}
+		results.Close()
+	}
+	return nil
+}
+
+// check returns the problem of the entry, if the reason is set.
+func (f *fsck) check(key ds.Key, value []byte) (FsckProblem, string) {
+	kns := key.Namespaces()
+	if len(kns) < 2 {
+		return FsckCorrupt, "unknown key"
+	}
+	base := ds.KeyWithNamespaces(kns[:2])
+	switch base {
+	case codecKey, schemaVersionKey:
+		return 0, ""
+	case kbBase:
+		return f.checkKey(key, kns, value)
+	case khBase, ktBase:
+		// /thread/keyhist/<thread>/(read|service)/<version>
+		if len(kns) != 5 || !validThread(kns[2]) || !symKeyKind(kns[3]) {
+			return FsckCorrupt, "malformed key"
+		}
+		if _, err := strconv.Atoi(kns[4]); err != nil {
+			return FsckCorrupt, "malformed version"
+		}
+		if base == khBase {
+			if _, err := f.symKey(key, value); err != nil {
+				return FsckCorrupt, err.Error()
+			}
+		} else if len(value) != 8 {
+			return FsckCorrupt, "malformed creation time"
+		}
+	case logBookBase, logRecordBase, hbBase:
+		if len(kns) != 4 || !validThread(kns[2]) || !validLog(kns[3]) {
+			return FsckCorrupt, "malformed key"
+		}
+		var err error
+		switch base {
+		case logBookBase:
+			err = new(pb.AddrBookRecord).Unmarshal(value)
+		case logRecordBase:
+			_, err = record.UnmarshalEnvelope(value)
+		case hbBase:
+			err = new(pb.HeadBookRecord).Unmarshal(value)
+		}
+		if err != nil {
+			return FsckCorrupt, fmt.Sprintf("cannot decode value: %v", err)
+		}
+		if _, ok := f.logs[kns[2]+"/"+kns[3]]; !ok {
+			return FsckOrphaned, "log has no keys"
+		}
+	case tmetaBase:
+		if len(kns) < 4 || !validThread(kns[2]) {
+			return FsckCorrupt, "malformed key"
+		}
+		if _, err := f.codec.Unmarshal(value); err != nil {
+			return FsckCorrupt, fmt.Sprintf("cannot decode value: %v", err)
+		}
+		if _, ok := f.threads[kns[2]]; !ok {
+			return FsckOrphaned, "thread has no keys, addresses or heads"
+		}
+	case tmetaExpBase:
+		if len(kns) < 4 || !validThread(kns[2]) {
+			return FsckCorrupt, "malformed key"
+		}
+		if len(value) != 8 {
+			return FsckCorrupt, "malformed expiration time"
+		}
+		if _, ok := f.metaKeys[tmetaBase.Child(ds.KeyWithNamespaces(kns[2:])).String()]; !ok {
+			return FsckOrphaned, "metadata is gone"
+		}
+		if _, ok := f.threads[kns[2]]; !ok {
+			return FsckOrphaned, "thread has no keys, addresses or heads"
+		}
+	case keyIndexBase, addrIndexBase:
+		// /thread/(keyidx|addridx)/<log>/<thread>
+		if len(kns) != 4 || !validLog(kns[2]) || !validThread(kns[3]) {
+			return FsckCorrupt, "malformed key"
+		}
+		if base == keyIndexBase {
+			return f.checkIndexed(kns[3], kns[2], false)
+		}
+		return f.checkIndexed(kns[3], kns[2], true)
+	case addrLogsBase:
+		// /thread/addrlogs/<address>/<thread>/<log>
+		if len(kns) != 5 || !validThread(kns[3]) || !validLog(kns[4]) {
+			return FsckCorrupt, "malformed key"
+		}
+		return f.checkIndexed(kns[3], kns[4], true)
+	default:
+		return FsckCorrupt, "unknown key"
+	}
+	return 0, ""
+}
+
+// checkIndexed checks that an indexed log has keys, and addresses if
+// required. Indexes of orphaned addresses are orphaned too, so that they're
+// pruned along with them.
+func (f *fsck) checkIndexed(t, l string, addrs bool) (FsckProblem, string) {
+	if _, ok := f.logs[t+"/"+l]; !ok {
+		return FsckOrphaned, "indexed log has no keys"
+	}
+	if _, ok := f.addrs[t+"/"+l]; addrs && !ok {
+		return FsckOrphaned, "indexed log has no addresses"
+	}
+	return 0, ""
+}
+
+// checkKey checks entries of the key book:
+// /thread/keys/<thread>/<log>/(pub|priv|revoked)
+// /thread/keys/<thread>/(read|service)
+func (f *fsck) checkKey(key ds.Key, kns []string, value []byte) (FsckProblem, string) {
+	switch {
+	case len(kns) == 4 && validThread(kns[2]) && symKeyKind(kns[3]):
+		if _, err := f.symKey(key, value); err != nil {
+			return FsckCorrupt, err.Error()
+		}
+	case len(kns) == 5 && validThread(kns[2]) && validLog(kns[3]):
+		var err error
+		switch "/" + kns[4] {
+		case pubSuffix.String():
+			if value, err = f.decrypt(key, value); err == nil {
+				_, err = crypto.UnmarshalPublicKey(value)
+			}
+		case privSuffix.String():
+			if value, err = f.decrypt(key, value); err == nil {
+				_, err = crypto.UnmarshalPrivateKey(value)
+			}
+		case revokedSuffix.String():
+		default:
+			return FsckCorrupt, "malformed key"
+		}
+		if err != nil {
+			return FsckCorrupt, fmt.Sprintf("cannot decode value: %v", err)
+		}
+	default:
+		return FsckCorrupt, "malformed key"
+	}
+	return 0, ""
+}
+
+func (f *fsck) symKey(dk ds.Key, value []byte) (*sym.Key, error) {
+	value, err := f.decrypt(dk, value)
+	if err != nil {
+		return nil, err
+	}
+	key, err := sym.FromBytes(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode value: %w", err)
+	}
+	return key, nil
+}
+
+func (f *fsck) decrypt(key ds.Key, value []byte) ([]byte, error) {
+	return (&dsKeyBook{enc: f.enc}).decrypt(key, value)
+}
+
+func validThread(s string) bool {
+	_, err := parseThreadID(s)
+	return err == nil
+}
+
+func validLog(s string) bool {
+	_, err := parseLogID(s)
+	return err == nil
+}
+
+func symKeyKind(s string) bool {
+	return "/"+s == readSuffix.String() || "/"+s == serviceSuffix.String()
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
-	"github.com/libp2p/go-libp2p-core/peer"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 	pb "github.com/textileio/go-threads/net/pb"
@@ -32,12 +31,12 @@ func NewHeadBook(ds ds.TxnDatastore) core.HeadBook {
 }
 
 // AddHead addes a new head to a log.
-func (hb *dsHeadBook) AddHead(t thread.ID, p peer.ID, head cid.Cid) error {
+func (hb *dsHeadBook) AddHead(t thread.ID, p thread.LogID, head cid.Cid) error {
 	return hb.AddHeads(t, p, []cid.Cid{head})
 }
 
 // AddHeads adds multiple heads to a log.
-func (hb *dsHeadBook) AddHeads(t thread.ID, p peer.ID, heads []cid.Cid) error {
+func (hb *dsHeadBook) AddHeads(t thread.ID, p thread.LogID, heads []cid.Cid) error {
 	txn, err := hb.ds.NewTransaction(false)
 	if err != nil {
 		return fmt.Errorf("error when creating txn in datastore: %w", err)
@@ -79,11 +78,11 @@ func (hb *dsHeadBook) AddHeads(t thread.ID, p peer.ID, heads []cid.Cid) error {
 	return txn.Commit()
 }
 
-func (hb *dsHeadBook) SetHead(t thread.ID, p peer.ID, c cid.Cid) error {
+func (hb *dsHeadBook) SetHead(t thread.ID, p thread.LogID, c cid.Cid) error {
 	return hb.SetHeads(t, p, []cid.Cid{c})
 }
 
-func (hb *dsHeadBook) SetHeads(t thread.ID, p peer.ID, heads []cid.Cid) error {
+func (hb *dsHeadBook) SetHeads(t thread.ID, p thread.LogID, heads []cid.Cid) error {
 	key := dsLogKey(t, p, hbBase)
 	hr := pb.HeadBookRecord{}
 	for i := range heads {
@@ -105,7 +104,7 @@ func (hb *dsHeadBook) SetHeads(t thread.ID, p peer.ID, heads []cid.Cid) error {
 	return nil
 }
 
-func (hb *dsHeadBook) Heads(t thread.ID, p peer.ID) ([]cid.Cid, error) {
+func (hb *dsHeadBook) Heads(t thread.ID, p thread.LogID) ([]cid.Cid, error) {
 	key := dsLogKey(t, p, hbBase)
 	v, err := hb.ds.Get(key)
 	if err == ds.ErrNotFound {
@@ -125,7 +124,7 @@ func (hb *dsHeadBook) Heads(t thread.ID, p peer.ID) ([]cid.Cid, error) {
 	return ret, nil
 }
 
-func (hb *dsHeadBook) ClearHeads(t thread.ID, p peer.ID) error {
+func (hb *dsHeadBook) ClearHeads(t thread.ID, p thread.LogID) error {
 	key := dsLogKey(t, p, hbBase)
 	if err := hb.ds.Delete(key); err != nil {
 		return fmt.Errorf("error when deleting heads from %s", key)
@@ -133,6 +132,16 @@ func (hb *dsHeadBook) ClearHeads(t thread.ID, p peer.ID) error {
 	return nil
 }
 
+// Close flushes pending writes of head records.
+func (hb *dsHeadBook) Close() error {
+	return syncPrefixes(hb.ds, hbBase)
+}
+
+// ThreadDiskUsage returns the size of all head records stored for a thread.
+func (hb *dsHeadBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return prefixDiskUsage(hb.ds, dsThreadKey(t, hbBase))
+}
+
 // Dump entire headbook into the tree-structure.
 // Not a thread-safe, should not be interleaved with other methods!
 func (hb *dsHeadBook) DumpHeads() (core.DumpHeadBook, error) {
@@ -173,8 +182,8 @@ func (hb *dsHeadBook) RestoreHeads(dump core.DumpHeadBook) error {
 	return nil
 }
 
-func (hb *dsHeadBook) traverse(withHeads bool) (map[thread.ID]map[peer.ID][]cid.Cid, error) {
-	var data = make(map[thread.ID]map[peer.ID][]cid.Cid)
+func (hb *dsHeadBook) traverse(withHeads bool) (map[thread.ID]map[thread.LogID][]cid.Cid, error) {
+	var data = make(map[thread.ID]map[thread.LogID][]cid.Cid)
 	result, err := hb.ds.Query(query.Query{Prefix: hbBase.String(), KeysOnly: !withHeads})
 	if err != nil {
 		return nil, err
@@ -217,7 +226,7 @@ func (hb *dsHeadBook) traverse(withHeads bool) (map[thread.ID]map[peer.ID][]cid.
 
 		lh, exist := data[tid]
 		if !exist {
-			lh = make(map[peer.ID][]cid.Cid)
+			lh = make(map[thread.LogID][]cid.Cid)
 			data[tid] = lh
 		}
 
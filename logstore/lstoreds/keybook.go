@@ -1,30 +1,62 @@
 package lstoreds
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	lru "github.com/hashicorp/golang-lru"
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 	"github.com/libp2p/go-libp2p-core/crypto"
-	"github.com/libp2p/go-libp2p-core/peer"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 	sym "github.com/textileio/go-threads/crypto/symmetric"
 	"github.com/whyrusleeping/base32"
+	"golang.org/x/crypto/hkdf"
 )
 
 type dsKeyBook struct {
 	ds ds.Datastore
+
+	// enc encrypts stored keys if set.
+	enc *sym.Key
+
+	// privs holds private keys instead of the datastore if set.
+	privs core.KeyStorage
+
+	// cache holds decoded keys by datastore key, including absent ones.
+	// Writes are serialized by the lock and bump the generation when done,
+	// while lookups run concurrently and only cache what they read if no
+	// write completed meanwhile.
+	cache cache
+	lock  sync.RWMutex
+	gen   uint64
 }
 
 // Public and private keys are stored under the following db key pattern:
 // /threads/keys/<b32 thread id no padding>/<b32 log id no padding>/(pub|priv)
+// Revoked public keys are flagged under the following db key pattern:
+// /threads/keys/<b32 thread id no padding>/<b32 log id no padding>/revoked
 // Follow and read keys are stored under the following db key pattern:
 // /threads/keys/<b32 thread id no padding>/(service|read)
+// Previous read and service keys are stored under the following db key pattern:
+// /thread/keyhist/<b32 thread id no padding>/(service|read)/<version>
+// Creation times of read and service key versions are stored under the following db key pattern:
+// /thread/keytime/<b32 thread id no padding>/(service|read)/<version>
 var (
 	kbBase        = ds.NewKey("/thread/keys")
+	khBase        = ds.NewKey("/thread/keyhist")
+	ktBase        = ds.NewKey("/thread/keytime")
 	pubSuffix     = ds.NewKey("/pub")
 	privSuffix    = ds.NewKey("/priv")
+	revokedSuffix = ds.NewKey("/revoked")
 	readSuffix    = ds.NewKey("/read")
 	serviceSuffix = ds.NewKey("/service")
 )
@@ -32,110 +64,255 @@ var (
 var _ core.KeyBook = (*dsKeyBook)(nil)
 
 // NewKeyBook returns a new key book for storing public and private keys
-// of (thread.ID, peer.ID) pairs with durable guarantees by store.
+// of (thread.ID, thread.LogID) pairs with durable guarantees by store.
 func NewKeyBook(store ds.Datastore) (core.KeyBook, error) {
-	return &dsKeyBook{ds: store}, nil
+	return newKeyBook(store, 0, nil, nil)
 }
 
-// PubKey returns the public key of (thread.ID, peer.ID). The implementation
-// assumes the key is in the store with the exception that peer.ID is an
-// Identity multihash. If the public key can't be resolved, nil is returned.
-func (kb *dsKeyBook) PubKey(t thread.ID, p peer.ID) (crypto.PubKey, error) {
-	key := dsLogKey(t, p, kbBase).Child(pubSuffix)
+// NewCachedKeyBook returns a key book keeping up to cacheSize recently used
+// keys in an in-memory ARC cache. A zero size disables the cache.
+func NewCachedKeyBook(store ds.Datastore, cacheSize uint) (core.KeyBook, error) {
+	return newKeyBook(store, cacheSize, nil, nil)
+}
 
-	v, err := kb.ds.Get(key)
-	if err == ds.ErrNotFound {
-		return nil, nil
+// NewEncryptedKeyBook returns a cached key book encrypting all stored keys
+// with AES-GCM under the master key, so they don't leak through datastore
+// dumps. Keys are bound to their datastore keys, so that a ciphertext moved
+// to another key fails to decrypt. A store must always be opened with the
+// same master key, and stores of NewKeyBook must be migrated first with
+// EncryptKeyBook.
+func NewEncryptedKeyBook(store ds.Datastore, cacheSize uint, master *sym.Key) (core.KeyBook, error) {
+	if master == nil {
+		return nil, fmt.Errorf("master key is nil")
 	}
-	if err != nil {
-		return nil, fmt.Errorf("error when getting key %s from store: %v", key, err)
+	return newKeyBook(store, cacheSize, master, nil)
+}
+
+// NewKeyBookWithStorage returns a cached key book keeping private keys in
+// the given storage, while other keys are kept in the datastore.
+func NewKeyBookWithStorage(store ds.Datastore, cacheSize uint, storage core.KeyStorage) (core.KeyBook, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("key storage is nil")
+	}
+	return newKeyBook(store, cacheSize, nil, storage)
+}
+
+func newKeyBook(store ds.Datastore, cacheSize uint, master *sym.Key, privs core.KeyStorage) (core.KeyBook, error) {
+	var c cache = new(noopCache)
+	if cacheSize > 0 {
+		var err error
+		if c, err = lru.NewARC(int(cacheSize)); err != nil {
+			return nil, err
+		}
 	}
-	pk, err := crypto.UnmarshalPublicKey(v)
+	return &dsKeyBook{ds: store, cache: c, enc: master, privs: privs}, nil
+}
+
+// MasterKeyFromPrivKey derives a keybook master key from a libp2p private key.
+func MasterKeyFromPrivKey(sk crypto.PrivKey) (*sym.Key, error) {
+	raw, err := sk.Raw()
 	if err != nil {
-		return nil, fmt.Errorf("store backed public key %s can't be unmarshaled: %w", key, err)
+		return nil, err
+	}
+	key := make([]byte, sym.KeyBytes)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, raw, nil, []byte("threads keybook")), key); err != nil {
+		return nil, err
 	}
+	return sym.FromBytes(key)
+}
 
-	return pk, nil
+// PubKey returns the public key of (thread.ID, thread.LogID). The implementation
+// assumes the key is in the store with the exception that thread.LogID is an
+// Identity multihash. If the public key can't be resolved, nil is returned.
+func (kb *dsKeyBook) PubKey(t thread.ID, p thread.LogID) (crypto.PubKey, error) {
+	key := dsLogKey(t, p, kbBase).Child(pubSuffix)
+	v, err := kb.load(key, func(v []byte) (interface{}, error) {
+		pk, err := crypto.UnmarshalPublicKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("store backed public key %s can't be unmarshaled: %w", key, err)
+		}
+		return pk, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error when getting key %s from store: %v", key, err)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	return v.(crypto.PubKey), nil
 }
 
-// AddPubKey adds the public key of peer.ID which should match accordingly.
-func (kb *dsKeyBook) AddPubKey(t thread.ID, p peer.ID, pk crypto.PubKey) error {
+// AddPubKey adds the public key of thread.LogID which should match accordingly.
+func (kb *dsKeyBook) AddPubKey(t thread.ID, p thread.LogID, pk crypto.PubKey) error {
 	if pk == nil {
-		return fmt.Errorf("public key is nil")
+		return fmt.Errorf("%w: public key is nil", core.ErrInvalidKey)
 	}
 
 	if !p.MatchesPublicKey(pk) {
-		return fmt.Errorf("log ID doesn't provided match public key")
+		return fmt.Errorf("%w: log ID doesn't provided match public key", core.ErrInvalidKey)
 	}
 	val, err := pk.Bytes()
 	if err != nil {
 		return fmt.Errorf("error when getting bytes from public key: %w", err)
 	}
 	key := dsLogKey(t, p, kbBase).Child(pubSuffix)
-	if kb.ds.Put(key, val) != nil {
+	if err := kb.put(key, val); err != nil {
 		return fmt.Errorf("error when putting public key in store: %w", err)
 	}
+	if err := kb.ds.Put(dsLogIndexKey(keyIndexBase, p, t), nil); err != nil {
+		return fmt.Errorf("error when indexing log in store: %w", err)
+	}
 	return nil
 }
 
-// PrivKey returns the private key of (thread.ID, peer.ID). If not private key
+// RevokePubKey flags the public key of (thread.ID, thread.LogID) as revoked.
+func (kb *dsKeyBook) RevokePubKey(t thread.ID, p thread.LogID) error {
+	key := dsLogKey(t, p, kbBase).Child(revokedSuffix)
+	if err := kb.put(key, []byte{}); err != nil {
+		return fmt.Errorf("error when revoking public key in store: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked returns whether the public key of (thread.ID, thread.LogID) was revoked.
+func (kb *dsKeyBook) IsRevoked(t thread.ID, p thread.LogID) (bool, error) {
+	key := dsLogKey(t, p, kbBase).Child(revokedSuffix)
+	v, err := kb.load(key, func([]byte) (interface{}, error) {
+		return true, nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("error when getting key %s from store: %v", key, err)
+	}
+	return v != nil, nil
+}
+
+// PrivKey returns the private key of (thread.ID, thread.LogID). If not private key
 // is stored, returns nil.
-func (kb *dsKeyBook) PrivKey(t thread.ID, p peer.ID) (crypto.PrivKey, error) {
+func (kb *dsKeyBook) PrivKey(t thread.ID, p thread.LogID) (crypto.PrivKey, error) {
 	key := dsLogKey(t, p, kbBase).Child(privSuffix)
-	v, err := kb.ds.Get(key)
-	if err == ds.ErrNotFound {
-		return nil, nil
+	if kb.privs != nil {
+		v, err := kb.cached(key, func() (interface{}, error) {
+			sk, err := kb.privs.GetPrivKey(t, p)
+			if sk == nil || err != nil {
+				// avoid caching typed nil
+				return nil, err
+			}
+			return sk, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error when getting private key for %s from storage: %w", key, err)
+		}
+		if v == nil {
+			return nil, nil
+		}
+		return v.(crypto.PrivKey), nil
 	}
+	v, err := kb.load(key, func(v []byte) (interface{}, error) {
+		sk, err := crypto.UnmarshalPrivateKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("error when unmarshaling private key of %v", key)
+		}
+		return sk, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error when getting private key for %s", key)
+		return nil, fmt.Errorf("error when getting private key for %s: %w", key, err)
 	}
-	sk, err := crypto.UnmarshalPrivateKey(v)
-	if err != nil {
-		return nil, fmt.Errorf("error when unmarshaling private key of %v", key)
+	if v == nil {
+		return nil, nil
 	}
-	return sk, nil
+	return v.(crypto.PrivKey), nil
 }
 
-// AddPrivKey adds the private key of peer.ID which should match accordingly.
-func (kb *dsKeyBook) AddPrivKey(t thread.ID, p peer.ID, sk crypto.PrivKey) error {
+// AddPrivKey adds the private key of thread.LogID which should match accordingly.
+func (kb *dsKeyBook) AddPrivKey(t thread.ID, p thread.LogID, sk crypto.PrivKey) error {
 	if sk == nil {
-		return fmt.Errorf("private key is nil")
+		return fmt.Errorf("%w: private key is nil", core.ErrInvalidKey)
 	}
 	if !p.MatchesPrivateKey(sk) {
-		return fmt.Errorf("peer ID doesn't match with private key")
+		return fmt.Errorf("%w: peer ID doesn't match with private key", core.ErrInvalidKey)
+	}
+	key := dsLogKey(t, p, kbBase).Child(privSuffix)
+	if kb.privs != nil {
+		kb.lockWrites()
+		defer kb.unlockWrites()
+
+		kb.cache.Remove(key.String())
+		if err := kb.privs.PutPrivKey(t, p, sk); err != nil {
+			return fmt.Errorf("error when putting key %v in storage: %w", key, err)
+		}
+		return nil
 	}
 	skb, err := sk.Bytes()
 	if err != nil {
 		return fmt.Errorf("error when getting private key bytes: %w", err)
 	}
-	key := dsLogKey(t, p, kbBase).Child(privSuffix)
-	if err = kb.ds.Put(key, skb); err != nil {
+	if err = kb.put(key, skb); err != nil {
 		return fmt.Errorf("error when putting key %v in datastore: %w", key, err)
 	}
+	if err := kb.ds.Put(dsLogIndexKey(keyIndexBase, p, t), nil); err != nil {
+		return fmt.Errorf("error when indexing log in datastore: %w", err)
+	}
 	return nil
 }
 
+// HasPrivKey returns whether a private key of (thread.ID, thread.LogID) is stored.
+func (kb *dsKeyBook) HasPrivKey(t thread.ID, p thread.LogID) (bool, error) {
+	key := dsLogKey(t, p, kbBase).Child(privSuffix)
+	if kb.privs != nil {
+		if v, ok := kb.cache.Get(key.String()); ok {
+			return v != nil, nil
+		}
+		sk, err := kb.privs.GetPrivKey(t, p)
+		if err != nil {
+			return false, fmt.Errorf("error when checking private key for %s in storage: %w", key, err)
+		}
+		return sk != nil, nil
+	}
+	has, err := kb.has(key)
+	if err != nil {
+		return false, fmt.Errorf("error when checking private key for %s: %w", key, err)
+	}
+	return has, nil
+}
+
+// HasReadKey returns whether a read-key of thread.ID is stored.
+func (kb *dsKeyBook) HasReadKey(t thread.ID) (bool, error) {
+	has, err := kb.has(dsThreadKey(t, kbBase).Child(readSuffix))
+	if err != nil {
+		return false, fmt.Errorf("error when checking read-key in datastore: %w", err)
+	}
+	return has, nil
+}
+
+// HasServiceKey returns whether a service-key of thread.ID is stored.
+func (kb *dsKeyBook) HasServiceKey(t thread.ID) (bool, error) {
+	has, err := kb.has(dsThreadKey(t, kbBase).Child(serviceSuffix))
+	if err != nil {
+		return false, fmt.Errorf("error when checking service-key in datastore: %w", err)
+	}
+	return has, nil
+}
+
 // ReadKey returns the read-key associated with thread.ID.
 // In case it doesn't exist, it will return nil.
 func (kb *dsKeyBook) ReadKey(t thread.ID) (*sym.Key, error) {
 	key := dsThreadKey(t, kbBase).Child(readSuffix)
-	v, err := kb.ds.Get(key)
-	if err == ds.ErrNotFound {
-		return nil, nil
-	}
+	v, err := kb.load(key, decodeSymKey)
 	if err != nil {
 		return nil, fmt.Errorf("error when getting read-key from datastore: %v", err)
 	}
-	return sym.FromBytes(v)
+	if v == nil {
+		return nil, nil
+	}
+	return v.(*sym.Key), nil
 }
 
-// AddReadKey adds a read-key for a peer.ID.
+// AddReadKey adds a read-key for a thread.LogID.
 func (kb *dsKeyBook) AddReadKey(t thread.ID, rk *sym.Key) error {
 	if rk == nil {
-		return fmt.Errorf("read-key is nil")
+		return fmt.Errorf("%w: read-key is nil", core.ErrInvalidKey)
 	}
-	key := dsThreadKey(t, kbBase).Child(readSuffix)
-	if err := kb.ds.Put(key, rk.Bytes()); err != nil {
+	if err := kb.putCurrent(t, readSuffix, rk); err != nil {
 		return fmt.Errorf("error when adding read-key to datastore: %w", err)
 	}
 	return nil
@@ -145,46 +322,411 @@ func (kb *dsKeyBook) AddReadKey(t thread.ID, rk *sym.Key) error {
 // In case it doesn't exist, it will return nil.
 func (kb *dsKeyBook) ServiceKey(t thread.ID) (*sym.Key, error) {
 	key := dsThreadKey(t, kbBase).Child(serviceSuffix)
-
-	v, err := kb.ds.Get(key)
-	if err == ds.ErrNotFound {
-		return nil, nil
-	}
+	v, err := kb.load(key, decodeSymKey)
 	if err != nil {
 		return nil, fmt.Errorf("error when getting service-key from datastore: %v", err)
 	}
-	return sym.FromBytes(v)
+	if v == nil {
+		return nil, nil
+	}
+	return v.(*sym.Key), nil
 }
 
-// AddServiceKey adds a service-key for a peer.ID.
+// AddServiceKey adds a service-key for a thread.LogID.
 func (kb *dsKeyBook) AddServiceKey(t thread.ID, fk *sym.Key) error {
 	if fk == nil {
-		return fmt.Errorf("service-key is nil")
+		return fmt.Errorf("%w: service-key is nil", core.ErrInvalidKey)
 	}
-	key := dsThreadKey(t, kbBase).Child(serviceSuffix)
-	if err := kb.ds.Put(key, fk.Bytes()); err != nil {
+	if err := kb.putCurrent(t, serviceSuffix, fk); err != nil {
 		return fmt.Errorf("error when adding service-key to datastore: %w", err)
 	}
 	return nil
 }
 
+// RotateReadKey replaces the read key of a thread, retaining the previous one.
+func (kb *dsKeyBook) RotateReadKey(t thread.ID, rk *sym.Key) (int, error) {
+	if rk == nil {
+		return 0, fmt.Errorf("%w: read-key is nil", core.ErrInvalidKey)
+	}
+	v, err := kb.rotateKey(t, readSuffix, rk)
+	if err != nil {
+		return 0, fmt.Errorf("error when rotating read-key: %w", err)
+	}
+	return v, nil
+}
+
+// ReadKeyVersions returns all read-keys of thread.ID ordered by version.
+func (kb *dsKeyBook) ReadKeyVersions(t thread.ID) ([]core.KeyVersion, error) {
+	vs, err := kb.keyVersions(t, readSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting read-key versions from datastore: %v", err)
+	}
+	return vs, nil
+}
+
+// ReadKeyVersion returns the read-key of thread.ID with the given version.
+// In case it doesn't exist, it will return nil.
+func (kb *dsKeyBook) ReadKeyVersion(t thread.ID, version int) (*sym.Key, error) {
+	k, err := kb.keyVersion(t, readSuffix, version)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting read-key version from datastore: %v", err)
+	}
+	return k, nil
+}
+
+// RotateServiceKey replaces the service key of a thread, retaining the previous one.
+func (kb *dsKeyBook) RotateServiceKey(t thread.ID, fk *sym.Key) (int, error) {
+	if fk == nil {
+		return 0, fmt.Errorf("%w: service-key is nil", core.ErrInvalidKey)
+	}
+	v, err := kb.rotateKey(t, serviceSuffix, fk)
+	if err != nil {
+		return 0, fmt.Errorf("error when rotating service-key: %w", err)
+	}
+	return v, nil
+}
+
+// ServiceKeyVersions returns all service-keys of thread.ID ordered by version.
+func (kb *dsKeyBook) ServiceKeyVersions(t thread.ID) ([]core.KeyVersion, error) {
+	vs, err := kb.keyVersions(t, serviceSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting service-key versions from datastore: %v", err)
+	}
+	return vs, nil
+}
+
+// ServiceKeyVersion returns the service-key of thread.ID with the given version.
+// In case it doesn't exist, it will return nil.
+func (kb *dsKeyBook) ServiceKeyVersion(t thread.ID, version int) (*sym.Key, error) {
+	k, err := kb.keyVersion(t, serviceSuffix, version)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting service-key version from datastore: %v", err)
+	}
+	return k, nil
+}
+
+// rotateKey moves the current key into the history and stores the new one.
+func (kb *dsKeyBook) rotateKey(t thread.ID, suffix ds.Key, key *sym.Key) (int, error) {
+	kb.lockWrites()
+	defer kb.unlockWrites()
+
+	n, err := kb.historyLen(t, suffix)
+	if err != nil {
+		return 0, err
+	}
+	cur := dsThreadKey(t, kbBase).Child(suffix)
+	data, err := kb.ds.Get(cur)
+	switch err {
+	case nil:
+		// encrypted values are bound to their keys, so the value is
+		// encrypted again under the history key
+		if data, err = kb.decrypt(cur, data); err != nil {
+			return 0, err
+		}
+		if err := kb.store(histKey(t, suffix, n), data); err != nil {
+			return 0, err
+		}
+		n++
+	case ds.ErrNotFound:
+	default:
+		return 0, err
+	}
+	if err := kb.store(cur, key.Bytes()); err != nil {
+		return 0, err
+	}
+	if err := kb.setCreated(t, suffix, n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// putCurrent replaces the current key keeping its version.
+func (kb *dsKeyBook) putCurrent(t thread.ID, suffix ds.Key, key *sym.Key) error {
+	kb.lockWrites()
+	defer kb.unlockWrites()
+
+	if err := kb.store(dsThreadKey(t, kbBase).Child(suffix), key.Bytes()); err != nil {
+		return err
+	}
+	n, err := kb.historyLen(t, suffix)
+	if err != nil {
+		return err
+	}
+	return kb.setCreated(t, suffix, n)
+}
+
+func (kb *dsKeyBook) setCreated(t thread.ID, suffix ds.Key, version int) error {
+	var created [8]byte
+	binary.BigEndian.PutUint64(created[:], uint64(time.Now().UnixNano()))
+	return kb.ds.Put(timeKey(t, suffix, version), created[:])
+}
+
+func (kb *dsKeyBook) keyVersions(t thread.ID, suffix ds.Key) ([]core.KeyVersion, error) {
+	n, err := kb.historyLen(t, suffix)
+	if err != nil {
+		return nil, err
+	}
+	var versions []core.KeyVersion
+	for v := 0; v <= n; v++ {
+		k, err := kb.keyVersion(t, suffix, v)
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			continue
+		}
+		kv := core.KeyVersion{Version: v, Key: k}
+		created, err := kb.ds.Get(timeKey(t, suffix, v))
+		switch {
+		case err == nil && len(created) == 8:
+			kv.Created = time.Unix(0, int64(binary.BigEndian.Uint64(created)))
+		case err != nil && err != ds.ErrNotFound:
+			return nil, err
+		}
+		versions = append(versions, kv)
+	}
+	return versions, nil
+}
+
+func (kb *dsKeyBook) keyVersion(t thread.ID, suffix ds.Key, version int) (*sym.Key, error) {
+	n, err := kb.historyLen(t, suffix)
+	if err != nil {
+		return nil, err
+	}
+	var key ds.Key
+	switch {
+	case version >= 0 && version < n:
+		key = histKey(t, suffix, version)
+	case version == n:
+		key = dsThreadKey(t, kbBase).Child(suffix)
+	default:
+		return nil, nil
+	}
+	v, err := kb.load(key, decodeSymKey)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.(*sym.Key), nil
+}
+
+// historyLen returns the number of previous keys, which is also the version
+// of the current key.
+func (kb *dsKeyBook) historyLen(t thread.ID, suffix ds.Key) (int, error) {
+	results, err := kb.ds.Query(query.Query{Prefix: dsThreadKey(t, khBase).Child(suffix).String(), KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+func histKey(t thread.ID, suffix ds.Key, version int) ds.Key {
+	return dsThreadKey(t, khBase).Child(suffix).ChildString(strconv.Itoa(version))
+}
+
+func timeKey(t thread.ID, suffix ds.Key, version int) ds.Key {
+	return dsThreadKey(t, ktBase).Child(suffix).ChildString(strconv.Itoa(version))
+}
+
 // ClearKeys deletes all keys under a thread.
 func (kb *dsKeyBook) ClearKeys(t thread.ID) error {
-	return kb.clearKeys(dsThreadKey(t, kbBase))
+	ids, err := uniqueLogIds(kb.ds, dsThreadKey(t, kbBase), func(result query.Result) string {
+		return ds.RawKey(result.Key).Parent().Name()
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := kb.ds.Delete(dsLogIndexKey(keyIndexBase, id, t)); err != nil {
+			return fmt.Errorf("error when clearing log index: %w", err)
+		}
+	}
+	if err := kb.clearKeys(dsThreadKey(t, kbBase)); err != nil {
+		return err
+	}
+	if err := kb.clearKeys(dsThreadKey(t, khBase)); err != nil {
+		return err
+	}
+	if err := kb.clearKeys(dsThreadKey(t, ktBase)); err != nil {
+		return err
+	}
+	return kb.clearPrivKeys(func(id thread.ID) bool {
+		return id.Equals(t)
+	})
 }
 
 // ClearLogKeys deletes all keys under a log.
-func (kb *dsKeyBook) ClearLogKeys(t thread.ID, p peer.ID) error {
-	if err := kb.ds.Delete(dsLogKey(t, p, kbBase).Child(privSuffix)); err != nil {
-		return fmt.Errorf("error when clearing key: %w", err)
+func (kb *dsKeyBook) ClearLogKeys(t thread.ID, p thread.LogID) error {
+	kb.lockWrites()
+	defer kb.unlockWrites()
+
+	for _, suffix := range []ds.Key{privSuffix, pubSuffix, revokedSuffix} {
+		key := dsLogKey(t, p, kbBase).Child(suffix)
+		kb.cache.Remove(key.String())
+		if err := kb.ds.Delete(key); err != nil {
+			return fmt.Errorf("error when clearing key: %w", err)
+		}
+	}
+	if err := kb.ds.Delete(dsLogIndexKey(keyIndexBase, p, t)); err != nil {
+		return fmt.Errorf("error when clearing log index: %w", err)
+	}
+	if kb.privs != nil {
+		if err := kb.privs.DeletePrivKey(t, p); err != nil {
+			return fmt.Errorf("error when clearing key in storage: %w", err)
+		}
+	}
+	return nil
+}
+
+// load returns the decoded value stored under key, or nil if there is none.
+func (kb *dsKeyBook) load(key ds.Key, decode func([]byte) (interface{}, error)) (interface{}, error) {
+	return kb.cached(key, func() (interface{}, error) {
+		data, err := kb.ds.Get(key)
+		if err == ds.ErrNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data, err = kb.decrypt(key, data); err != nil {
+			return nil, err
+		}
+		return decode(data)
+	})
+}
+
+// has returns whether a value is stored under key, without decoding it.
+func (kb *dsKeyBook) has(key ds.Key) (bool, error) {
+	if v, ok := kb.cache.Get(key.String()); ok {
+		return v != nil, nil
+	}
+	return kb.ds.Has(key)
+}
+
+// cached returns the cached value of key, fetching it on a miss. Misses
+// don't block each other, nor do they wait for writes other than to cache
+// the value.
+func (kb *dsKeyBook) cached(key ds.Key, fetch func() (interface{}, error)) (interface{}, error) {
+	if v, ok := kb.cache.Get(key.String()); ok {
+		return v, nil
+	}
+
+	gen := atomic.LoadUint64(&kb.gen)
+	v, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	kb.lock.RLock()
+	if atomic.LoadUint64(&kb.gen) == gen {
+		kb.cache.Add(key.String(), v)
+	}
+	kb.lock.RUnlock()
+	return v, nil
+}
+
+func (kb *dsKeyBook) lockWrites() {
+	kb.lock.Lock()
+}
+
+// unlockWrites bumps the generation, so that lookups racing with the write
+// don't cache the value they read.
+func (kb *dsKeyBook) unlockWrites() {
+	atomic.AddUint64(&kb.gen, 1)
+	kb.lock.Unlock()
+}
+
+// put stores the value, dropping the cached one.
+func (kb *dsKeyBook) put(key ds.Key, value []byte) error {
+	kb.lockWrites()
+	defer kb.unlockWrites()
+
+	return kb.store(key, value)
+}
+
+func (kb *dsKeyBook) store(key ds.Key, value []byte) error {
+	kb.cache.Remove(key.String())
+	if kb.enc != nil {
+		var err error
+		if value, err = kb.enc.EncryptWithAD(value, key.Bytes()); err != nil {
+			return fmt.Errorf("error when encrypting key: %w", err)
+		}
+	}
+	return kb.ds.Put(key, value)
+}
+
+func (kb *dsKeyBook) decrypt(key ds.Key, value []byte) ([]byte, error) {
+	if kb.enc == nil {
+		return value, nil
+	}
+	return decryptKey(kb.enc, key, value)
+}
+
+// decryptKey decrypts the value stored under key.
+func decryptKey(master *sym.Key, key ds.Key, value []byte) ([]byte, error) {
+	if len(value) < sym.NonceBytes {
+		return nil, fmt.Errorf("encrypted key is too short")
+	}
+	plain, err := master.DecryptWithAD(value, key.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error when decrypting key: %w", err)
+	}
+	return plain, nil
+}
+
+// EncryptKeyBook migrates the keys stored by NewKeyBook in plaintext, so
+// that the store can be opened with NewEncryptedKeyBook under the master
+// key. Keys already encrypted under the master key are left as they are,
+// so an interrupted migration may be run again. The store must not be in
+// use while migrating.
+func EncryptKeyBook(store ds.Datastore, master *sym.Key) error {
+	if master == nil {
+		return fmt.Errorf("master key is nil")
+	}
+	var entries []query.Entry
+	for _, prefix := range []ds.Key{kbBase, khBase} {
+		results, err := store.Query(query.Query{Prefix: prefix.String()})
+		if err != nil {
+			return err
+		}
+		all, err := results.Rest()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, all...)
 	}
-	if err := kb.ds.Delete(dsLogKey(t, p, kbBase).Child(pubSuffix)); err != nil {
-		return fmt.Errorf("error when clearing key: %w", err)
+	for _, entry := range entries {
+		key := ds.RawKey(entry.Key)
+		if _, err := decryptKey(master, key, entry.Value); err == nil {
+			continue
+		}
+		value, err := master.EncryptWithAD(entry.Value, key.Bytes())
+		if err != nil {
+			return fmt.Errorf("error when encrypting key %s: %w", key, err)
+		}
+		if err := store.Put(key, value); err != nil {
+			return fmt.Errorf("error when storing key %s: %w", key, err)
+		}
 	}
 	return nil
 }
 
+func decodeSymKey(v []byte) (interface{}, error) {
+	return sym.FromBytes(v)
+}
+
 func (kb *dsKeyBook) clearKeys(prefix ds.Key) error {
+	kb.lockWrites()
+	defer kb.unlockWrites()
+
+	for _, k := range kb.cache.Keys() {
+		if ks := k.(string); ks == prefix.String() || strings.HasPrefix(ks, prefix.String()+"/") {
+			kb.cache.Remove(k)
+		}
+	}
+
 	q := query.Query{Prefix: prefix.String(), KeysOnly: true}
 	results, err := kb.ds.Query(q)
 	if err != nil {
@@ -200,8 +742,35 @@ func (kb *dsKeyBook) clearKeys(prefix ds.Key) error {
 	return nil
 }
 
+// clearPrivKeys deletes private keys of matching threads from the storage.
+func (kb *dsKeyBook) clearPrivKeys(match func(thread.ID) bool) error {
+	if kb.privs == nil {
+		return nil
+	}
+	list, err := kb.privs.ListPrivKeys()
+	if err != nil {
+		return fmt.Errorf("error when listing keys in storage: %w", err)
+	}
+
+	kb.lockWrites()
+	defer kb.unlockWrites()
+
+	for tid, logs := range list {
+		if !match(tid) {
+			continue
+		}
+		for _, lid := range logs {
+			kb.cache.Remove(dsLogKey(tid, lid, kbBase).Child(privSuffix).String())
+			if err := kb.privs.DeletePrivKey(tid, lid); err != nil {
+				return fmt.Errorf("error when clearing key in storage: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
 // LogsWithKeys returns a list of log IDs for a thread.
-func (kb *dsKeyBook) LogsWithKeys(t thread.ID) (peer.IDSlice, error) {
+func (kb *dsKeyBook) LogsWithKeys(t thread.ID) (thread.LogIDSlice, error) {
 	ids, err := uniqueLogIds(kb.ds, kbBase.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes())),
 		func(result query.Result) string {
 			return ds.RawKey(result.Key).Parent().Name()
@@ -209,6 +778,13 @@ func (kb *dsKeyBook) LogsWithKeys(t thread.ID) (peer.IDSlice, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error while retrieving logs with addresses: %v", err)
 	}
+	if kb.privs != nil {
+		list, err := kb.privs.ListPrivKeys()
+		if err != nil {
+			return nil, fmt.Errorf("error while retrieving logs from key storage: %v", err)
+		}
+		ids = mergeLogIDs(ids, list[t])
+	}
 	return ids, nil
 }
 
@@ -220,16 +796,118 @@ func (kb *dsKeyBook) ThreadsFromKeys() (thread.IDSlice, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error while retrieving threads from keys: %v", err)
 	}
+	if kb.privs != nil {
+		list, err := kb.privs.ListPrivKeys()
+		if err != nil {
+			return nil, fmt.Errorf("error while retrieving threads from key storage: %v", err)
+		}
+	outer:
+		for tid := range list {
+			for _, id := range ids {
+				if id.Equals(tid) {
+					continue outer
+				}
+			}
+			ids = append(ids, tid)
+		}
+	}
+	return ids, nil
+}
+
+// ForEachThreadFromKeys calls fn with threads having log keys until it
+// returns false. Only keys are read from the datastore, and threads may be
+// passed more than once.
+func (kb *dsKeyBook) ForEachThreadFromKeys(fn func(thread.ID) bool) error {
+	stopped, err := forEachThreadKey(kb.ds, kbBase, 5, fn)
+	if err != nil || stopped || kb.privs == nil {
+		return err
+	}
+	list, err := kb.privs.ListPrivKeys()
+	if err != nil {
+		return fmt.Errorf("error while retrieving threads from key storage: %v", err)
+	}
+	for tid := range list {
+		if !fn(tid) {
+			break
+		}
+	}
+	return nil
+}
+
+// ThreadsWithLogKeys returns threads having keys of the log.
+func (kb *dsKeyBook) ThreadsWithLogKeys(p thread.LogID) (thread.IDSlice, error) {
+	ids, err := indexedThreads(kb.ds, keyIndexBase, p)
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving threads of log: %v", err)
+	}
+	if kb.privs != nil {
+		list, err := kb.privs.ListPrivKeys()
+		if err != nil {
+			return nil, fmt.Errorf("error while retrieving threads from key storage: %v", err)
+		}
+	outer:
+		for tid, logs := range list {
+			for _, id := range ids {
+				if id.Equals(tid) {
+					continue outer
+				}
+			}
+			for _, lid := range logs {
+				if lid == p {
+					ids = append(ids, tid)
+					break
+				}
+			}
+		}
+	}
 	return ids, nil
 }
 
+func mergeLogIDs(ids, more thread.LogIDSlice) thread.LogIDSlice {
+	set := make(map[thread.LogID]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	for _, id := range more {
+		if _, ok := set[id]; !ok {
+			set[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Close flushes pending writes of keys.
+func (kb *dsKeyBook) Close() error {
+	return syncPrefixes(kb.ds, kbBase, khBase, ktBase, keyIndexBase)
+}
+
+// ThreadDiskUsage returns the size of all keys stored for a thread.
+func (kb *dsKeyBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	size, err := prefixDiskUsage(kb.ds, dsThreadKey(t, kbBase))
+	if err != nil {
+		return 0, err
+	}
+	hsize, err := prefixDiskUsage(kb.ds, dsThreadKey(t, khBase))
+	if err != nil {
+		return 0, err
+	}
+	tsize, err := prefixDiskUsage(kb.ds, dsThreadKey(t, ktBase))
+	if err != nil {
+		return 0, err
+	}
+	return size + hsize + tsize, nil
+}
+
 func (kb *dsKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 	var (
 		dump core.DumpKeyBook
-		pub  = make(map[thread.ID]map[peer.ID]crypto.PubKey)
-		priv = make(map[thread.ID]map[peer.ID]crypto.PrivKey)
+		pub  = make(map[thread.ID]map[thread.LogID]crypto.PubKey)
+		priv = make(map[thread.ID]map[thread.LogID]crypto.PrivKey)
 		rks  = make(map[thread.ID][]byte)
 		sks  = make(map[thread.ID][]byte)
+
+		revoked = make(map[thread.ID]thread.LogIDSlice)
 	)
 
 	result, err := kb.ds.Query(query.Query{Prefix: kbBase.String(), KeysOnly: false})
@@ -243,6 +921,10 @@ func (kb *dsKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 		if len(kns) < 4 {
 			return dump, fmt.Errorf("bad keybook key detected: %s", entry.Key)
 		}
+		value, err := kb.decrypt(ds.RawKey(entry.Key), entry.Value)
+		if err != nil {
+			return dump, fmt.Errorf("cannot decrypt key %s: %w", entry.Key, err)
+		}
 
 		// discriminate by key suffix
 		switch suffix := "/" + kns[len(kns)-1]; suffix {
@@ -256,13 +938,13 @@ func (kb *dsKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 			if err != nil {
 				return dump, fmt.Errorf("cannot parse log ID %s: %w", ls, err)
 			}
-			pk, err := crypto.UnmarshalPublicKey(entry.Value)
+			pk, err := crypto.UnmarshalPublicKey(value)
 			if err != nil {
 				return dump, fmt.Errorf("cannot unmarshal public key: %w", err)
 			}
 			pkm, ok := pub[tid]
 			if !ok {
-				pkm = make(map[peer.ID]crypto.PubKey, 1)
+				pkm = make(map[thread.LogID]crypto.PubKey, 1)
 				pub[tid] = pkm
 			}
 			pkm[lid] = pk
@@ -277,24 +959,36 @@ func (kb *dsKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 			if err != nil {
 				return dump, fmt.Errorf("cannot parse log ID %s: %w", ls, err)
 			}
-			pk, err := crypto.UnmarshalPrivateKey(entry.Value)
+			pk, err := crypto.UnmarshalPrivateKey(value)
 			if err != nil {
 				return dump, fmt.Errorf("cannot unmarshal private key: %w", err)
 			}
 			pkm, ok := priv[tid]
 			if !ok {
-				pkm = make(map[peer.ID]crypto.PrivKey, 1)
+				pkm = make(map[thread.LogID]crypto.PrivKey, 1)
 				priv[tid] = pkm
 			}
 			pkm[lid] = pk
 
+		case revokedSuffix.String():
+			ts, ls := kns[2], kns[3]
+			tid, err := parseThreadID(ts)
+			if err != nil {
+				return dump, fmt.Errorf("cannot parse thread ID %s: %w", ts, err)
+			}
+			lid, err := parseLogID(ls)
+			if err != nil {
+				return dump, fmt.Errorf("cannot parse log ID %s: %w", ls, err)
+			}
+			revoked[tid] = append(revoked[tid], lid)
+
 		case readSuffix.String():
 			ts := kns[2]
 			tid, err := parseThreadID(ts)
 			if err != nil {
 				return dump, fmt.Errorf("cannot restore thread ID %s: %w", ts, err)
 			}
-			rks[tid] = entry.Value
+			rks[tid] = value
 
 		case serviceSuffix.String():
 			ts := kns[2]
@@ -302,17 +996,55 @@ func (kb *dsKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 			if err != nil {
 				return dump, fmt.Errorf("cannot restore thread ID %s: %w", ts, err)
 			}
-			sks[tid] = entry.Value
+			sks[tid] = value
 
 		default:
 			return dump, fmt.Errorf("bad suffix %s in a key: %s", suffix, entry.Key)
 		}
 	}
 
+	if kb.privs != nil {
+		list, err := kb.privs.ListPrivKeys()
+		if err != nil {
+			return dump, fmt.Errorf("cannot list keys in storage: %w", err)
+		}
+		for tid, logs := range list {
+			for _, lid := range logs {
+				sk, err := kb.privs.GetPrivKey(tid, lid)
+				if err != nil {
+					return dump, fmt.Errorf("cannot get private key from storage: %w", err)
+				}
+				if sk == nil {
+					continue
+				}
+				pkm, ok := priv[tid]
+				if !ok {
+					pkm = make(map[thread.LogID]crypto.PrivKey, 1)
+					priv[tid] = pkm
+				}
+				pkm[lid] = sk
+			}
+		}
+	}
+
+	rhist, shist, err := kb.dumpHistory()
+	if err != nil {
+		return dump, err
+	}
+	rtimes, stimes, err := kb.dumpCreated()
+	if err != nil {
+		return dump, err
+	}
+
 	dump.Data.Public = pub
 	dump.Data.Private = priv
 	dump.Data.Read = rks
 	dump.Data.Service = sks
+	dump.Data.ReadHistory = rhist
+	dump.Data.ServiceHistory = shist
+	dump.Data.ReadCreated = rtimes
+	dump.Data.ServiceCreated = stimes
+	dump.Data.Revoked = revoked
 
 	return dump, nil
 }
@@ -330,6 +1062,18 @@ func (kb *dsKeyBook) RestoreKeys(dump core.DumpKeyBook) error {
 	if err := kb.clearKeys(kbBase); err != nil {
 		return err
 	}
+	if err := kb.clearKeys(keyIndexBase); err != nil {
+		return err
+	}
+	if err := kb.clearPrivKeys(func(thread.ID) bool { return true }); err != nil {
+		return err
+	}
+	if err := kb.clearKeys(khBase); err != nil {
+		return err
+	}
+	if err := kb.clearKeys(ktBase); err != nil {
+		return err
+	}
 
 	for tid, logs := range dump.Data.Public {
 		for lid, pubKey := range logs {
@@ -367,5 +1111,153 @@ func (kb *dsKeyBook) RestoreKeys(dump core.DumpKeyBook) error {
 		}
 	}
 
+	for tid, logs := range dump.Data.Revoked {
+		for _, lid := range logs {
+			if err := kb.RevokePubKey(tid, lid); err != nil {
+				return err
+			}
+		}
+	}
+
+	for suffix, hist := range map[ds.Key]map[thread.ID][][]byte{
+		readSuffix:    dump.Data.ReadHistory,
+		serviceSuffix: dump.Data.ServiceHistory,
+	} {
+		for tid, keys := range hist {
+			for i, b := range keys {
+				if _, err := sym.FromBytes(b); err != nil {
+					return fmt.Errorf("decoding previous key for thread %s: %w", tid, err)
+				}
+				if err := kb.put(histKey(tid, suffix, i), b); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for suffix, times := range map[ds.Key]map[thread.ID][]int64{
+		readSuffix:    dump.Data.ReadCreated,
+		serviceSuffix: dump.Data.ServiceCreated,
+	} {
+		for tid, created := range times {
+			for v, c := range created {
+				if c == 0 {
+					continue
+				}
+				var b [8]byte
+				binary.BigEndian.PutUint64(b[:], uint64(c))
+				if err := kb.ds.Put(timeKey(tid, suffix, v), b[:]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	return nil
 }
+
+// dumpHistory collects previous read and service keys ordered by version.
+func (kb *dsKeyBook) dumpHistory() (rhist, shist map[thread.ID][][]byte, err error) {
+	results, err := kb.ds.Query(query.Query{Prefix: khBase.String()})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer results.Close()
+
+	var versions = map[string]map[thread.ID]map[int][]byte{
+		readSuffix.String():    {},
+		serviceSuffix.String(): {},
+	}
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, nil, entry.Error
+		}
+		kns := ds.RawKey(entry.Key).Namespaces()
+		if len(kns) != 5 {
+			return nil, nil, fmt.Errorf("bad key history key detected: %s", entry.Key)
+		}
+		vs, ok := versions["/"+kns[3]]
+		if !ok {
+			return nil, nil, fmt.Errorf("bad suffix %s in a key: %s", kns[3], entry.Key)
+		}
+		tid, err := parseThreadID(kns[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse thread ID %s: %w", kns[2], err)
+		}
+		v, err := strconv.Atoi(kns[4])
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse key version %s: %w", kns[4], err)
+		}
+		value, err := kb.decrypt(ds.RawKey(entry.Key), entry.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot decrypt key %s: %w", entry.Key, err)
+		}
+		if vs[tid] == nil {
+			vs[tid] = make(map[int][]byte)
+		}
+		vs[tid][v] = value
+	}
+
+	order := func(vs map[thread.ID]map[int][]byte) (map[thread.ID][][]byte, error) {
+		hist := make(map[thread.ID][][]byte, len(vs))
+		for tid, keys := range vs {
+			hist[tid] = make([][]byte, len(keys))
+			for v, key := range keys {
+				if v < 0 || v >= len(keys) {
+					return nil, fmt.Errorf("missing previous keys of thread %s", tid)
+				}
+				hist[tid][v] = key
+			}
+		}
+		return hist, nil
+	}
+	if rhist, err = order(versions[readSuffix.String()]); err != nil {
+		return nil, nil, err
+	}
+	if shist, err = order(versions[serviceSuffix.String()]); err != nil {
+		return nil, nil, err
+	}
+	return rhist, shist, nil
+}
+
+// dumpCreated collects creation times of read and service key versions.
+func (kb *dsKeyBook) dumpCreated() (rtimes, stimes map[thread.ID][]int64, err error) {
+	results, err := kb.ds.Query(query.Query{Prefix: ktBase.String()})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer results.Close()
+
+	var times = map[string]map[thread.ID][]int64{
+		readSuffix.String():    {},
+		serviceSuffix.String(): {},
+	}
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, nil, entry.Error
+		}
+		kns := ds.RawKey(entry.Key).Namespaces()
+		if len(kns) != 5 || len(entry.Value) != 8 {
+			return nil, nil, fmt.Errorf("bad key creation time detected: %s", entry.Key)
+		}
+		ts, ok := times["/"+kns[3]]
+		if !ok {
+			return nil, nil, fmt.Errorf("bad suffix %s in a key: %s", kns[3], entry.Key)
+		}
+		tid, err := parseThreadID(kns[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse thread ID %s: %w", kns[2], err)
+		}
+		v, err := strconv.Atoi(kns[4])
+		if err != nil || v < 0 {
+			return nil, nil, fmt.Errorf("cannot parse key version %s", kns[4])
+		}
+		c := ts[tid]
+		for len(c) <= v {
+			c = append(c, 0)
+		}
+		c[v] = int64(binary.BigEndian.Uint64(entry.Value))
+		ts[tid] = c
+	}
+	return times[readSuffix.String()], times[serviceSuffix.String()], nil
+}
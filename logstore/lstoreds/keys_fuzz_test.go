@@ -0,0 +1,116 @@
+//go:build go1.18
+// +build go1.18
+
+package lstoreds
+
+import (
+	"bytes"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	mbase "github.com/multiformats/go-multibase"
+	"github.com/textileio/go-threads/core/thread"
+	"github.com/whyrusleeping/base32"
+)
+
+var fuzzPeerID = "12D3KooWJzw7RNGWzdF56ykVzJBUxpGZthBPRYxeqhgekZh3BSAW"
+
+func addIDSeeds(f *testing.F) {
+	for _, v := range []thread.Variant{thread.Raw, thread.AccessControlled} {
+		for _, size := range []uint8{16, 24, 32} {
+			f.Add(thread.NewIDV1(v, size).Bytes())
+		}
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0x01})
+	f.Add([]byte{0x01, 0x55})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+}
+
+// FuzzThreadKey checks that thread and log IDs are round-tripped through
+// datastore keys.
+func FuzzThreadKey(f *testing.F) {
+	addIDSeeds(f)
+	lid, err := thread.DecodeLogID(fuzzPeerID)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tid, err := thread.Cast(data)
+		if err != nil {
+			return
+		}
+		key := dsLogKey(tid, lid, logBookBase)
+		kns := key.Namespaces()
+		if len(kns) != len(logBookBase.Namespaces())+2 {
+			t.Fatalf("unexpected key %s", key)
+		}
+		gotTid, err := parseThreadID(kns[len(kns)-2])
+		if err != nil {
+			t.Fatalf("cannot parse thread ID of key %s: %v", key, err)
+		}
+		if !gotTid.Equals(tid) {
+			t.Fatalf("expected thread ID %s, got %s", tid, gotTid)
+		}
+		gotLid, err := parseLogID(kns[len(kns)-1])
+		if err != nil {
+			t.Fatalf("cannot parse log ID of key %s: %v", key, err)
+		}
+		if gotLid != lid {
+			t.Fatalf("expected log ID %s, got %s", lid, gotLid)
+		}
+		if dsThreadKey(tid, logBookBase) != key.Parent() {
+			t.Fatalf("expected thread key %s to be the parent of %s", dsThreadKey(tid, logBookBase), key)
+		}
+	})
+}
+
+// FuzzMultibaseThreadKey checks that thread IDs decoded from any multibase
+// form are encoded the same way in datastore keys.
+func FuzzMultibaseThreadKey(f *testing.F) {
+	tid := thread.NewIDV1(thread.Raw, 32)
+	for _, enc := range []mbase.Encoding{mbase.Base32, mbase.Base32hex, mbase.Base36, mbase.Base58BTC, mbase.Base64url} {
+		s, err := tid.StringOfBase(enc)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(s)
+	}
+	f.Add("b")
+	f.Add("zzzz")
+	f.Fuzz(func(t *testing.T, s string) {
+		tid, err := thread.Decode(s)
+		if err != nil {
+			return
+		}
+		key := dsThreadKey(tid, logBookBase)
+		got, err := parseThreadID(key.Name())
+		if err != nil {
+			t.Fatalf("cannot parse thread ID of key %s: %v", key, err)
+		}
+		if !bytes.Equal(got.Bytes(), tid.Bytes()) {
+			t.Fatalf("expected thread ID %s, got %s", tid, got)
+		}
+	})
+}
+
+// FuzzParseKey checks that malformed key namespaces are rejected without
+// panicking, and that accepted ones are canonical.
+func FuzzParseKey(f *testing.F) {
+	addIDSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		name := base32.RawStdEncoding.EncodeToString(data)
+		for _, s := range []string{name, string(data), ds.NewKey(string(data)).Name()} {
+			if tid, err := parseThreadID(s); err == nil {
+				if enc := base32.RawStdEncoding.EncodeToString(tid.Bytes()); enc != s {
+					t.Fatalf("thread ID %s parsed from non-canonical %q", tid, s)
+				}
+			}
+			if lid, err := parseLogID(s); err == nil {
+				if enc := base32.RawStdEncoding.EncodeToString([]byte(lid)); enc != s {
+					t.Fatalf("log ID %s parsed from non-canonical %q", lid, s)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package lstoreds
+
+import (
+	"fmt"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/textileio/go-threads/core/thread"
+	pb "github.com/textileio/go-threads/net/pb"
+	"github.com/whyrusleeping/base32"
+)
+
+// Threads having keys and addresses of logs are indexed in db key patterns:
+// /thread/keyidx/<base32 log id no padding>/<base32 thread id no padding>
+// /thread/addridx/<base32 log id no padding>/<base32 thread id no padding>
+// Logs having addresses are indexed in db key pattern:
+// /thread/addrlogs/<base32 address no padding>/<base32 thread id no padding>/<base32 log id no padding>
+var (
+	keyIndexBase  = ds.NewKey("/thread/keyidx")
+	addrIndexBase = ds.NewKey("/thread/addridx")
+	addrLogsBase  = ds.NewKey("/thread/addrlogs")
+)
+
+func dsLogIndexKey(base ds.Key, p thread.LogID, t thread.ID) ds.Key {
+	return base.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p))).
+		ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes()))
+}
+
+func dsAddrLogKey(addr []byte, t thread.ID, p thread.LogID) ds.Key {
+	return addrLogsBase.ChildString(base32.RawStdEncoding.EncodeToString(addr)).
+		ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes())).
+		ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
+}
+
+// indexedThreads returns threads indexed for the log under the base key.
+func indexedThreads(store ds.Datastore, base ds.Key, p thread.LogID) (thread.IDSlice, error) {
+	prefix := base.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
+	results, err := store.Query(query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var tids thread.IDSlice
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		tid, err := parseThreadID(ds.RawKey(result.Key).Name())
+		if err != nil {
+			return nil, fmt.Errorf("bad log index key detected: %s", result.Key)
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+// indexLogs builds the indexes of threads having keys and addresses of logs
+// from keys of the keybook and the address book. Keys of malformed IDs are
+// skipped, as they're when listing logs.
+func indexLogs(store ds.Datastore) error {
+	batch, err := newCyclicBatch(store.(ds.Batching), defaultOpsPerCyclicBatch)
+	if err != nil {
+		return err
+	}
+	for _, idx := range []struct {
+		base, index ds.Key
+		depth       int
+	}{
+		// /thread/keys/<thread>/<log>/<suffix>
+		{base: kbBase, index: keyIndexBase, depth: 4},
+		// /thread/addrs/<thread>/<log>
+		{base: logBookBase, index: addrIndexBase, depth: 3},
+	} {
+		results, err := store.Query(query.Query{Prefix: idx.base.String(), KeysOnly: true})
+		if err != nil {
+			return err
+		}
+		for result := range results.Next() {
+			if result.Error != nil {
+				results.Close()
+				return result.Error
+			}
+			kns := ds.RawKey(result.Key).Namespaces()
+			if len(kns) != idx.depth+1 || idx.base == kbBase && "/"+kns[4] == revokedSuffix.String() {
+				// e.g. read and service keys of threads
+				continue
+			}
+			tid, err := parseThreadID(kns[2])
+			if err != nil {
+				continue
+			}
+			lid, err := parseLogID(kns[3])
+			if err != nil {
+				continue
+			}
+			if err := batch.Put(dsLogIndexKey(idx.index, lid, tid), nil); err != nil {
+				results.Close()
+				return err
+			}
+		}
+		results.Close()
+	}
+	return batch.Commit()
+}
+
+// indexAddrs builds the index of logs having addresses from records of the
+// address book.
+func indexAddrs(store ds.Datastore) error {
+	batch, err := newCyclicBatch(store.(ds.Batching), defaultOpsPerCyclicBatch)
+	if err != nil {
+		return err
+	}
+	results, err := store.Query(query.Query{Prefix: logBookBase.String()})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		pr := &addrsRecord{AddrBookRecord: &pb.AddrBookRecord{}}
+		if err := pr.Unmarshal(result.Value); err != nil {
+			return fmt.Errorf("bad address record %s: %w", result.Key, err)
+		}
+		for _, a := range pr.Addrs {
+			if err := batch.Put(dsAddrLogKey(a.Addr.Bytes(), pr.ThreadID.ID, thread.LogIDFromPeer(pr.PeerID.ID)), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Commit()
+}
@@ -2,25 +2,37 @@ package lstoreds
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
-	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/prometheus/client_golang/prometheus"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
 	lstore "github.com/textileio/go-threads/logstore"
 	"github.com/whyrusleeping/base32"
+	"go.opentelemetry.io/otel/api/trace"
 )
 
 // Define if storage will accept empty dumps.
 var AllowEmptyRestore = false
 
+// DefaultMetaSweepInterval is the period of purging expired metadata if
+// Options.MetaSweepInterval isn't set.
+const DefaultMetaSweepInterval = time.Minute
+
 // Configuration object for datastores
 type Options struct {
 	// The size of the in-memory cache. A value of 0 or lower disables the cache.
 	CacheSize uint
 
+	// The number of keys kept in the in-memory keybook cache. A value of 0
+	// disables the cache.
+	KeyCacheSize uint
+
 	// Sweep interval to purge expired addresses from the datastore. If this is a zero value, GC will not run
 	// automatically, but it'll be available on demand via explicit calls.
 	GCPurgeInterval time.Duration
@@ -28,16 +40,72 @@ type Options struct {
 	// Initial delay before GC processes start. Intended to give the system breathing room to fully boot
 	// before starting GC.
 	GCInitialDelay time.Duration
+
+	// MetaSweepInterval is the period of purging expired metadata. A zero
+	// value selects DefaultMetaSweepInterval.
+	MetaSweepInterval time.Duration
+
+	// AddrDialFreshness is the period a successful dial of an address is
+	// considered fresh when sorting addresses. A zero value selects
+	// logstore.DefaultAddrDialFreshness.
+	AddrDialFreshness time.Duration
+
+	// Strict requires threads to be registered with CreateThread before
+	// they can be added or receive logs.
+	Strict bool
+
+	// DryRunMigrations prevents upgrading the key layout of the datastore on
+	// open. Instead, pending migrations are reported with ErrMigrationsPending.
+	DryRunMigrations bool
+
+	// MetaCodec serializes thread metadata values. A nil value selects
+	// GobCodec. A datastore must always be opened with the same codec.
+	MetaCodec Codec
+
+	// MasterKey encrypts keys stored in the keybook if set. It may be
+	// derived from a libp2p private key with MasterKeyFromPrivKey.
+	MasterKey *sym.Key
+
+	// KeyStorage keeps log private keys outside of the datastore if set.
+	KeyStorage core.KeyStorage
+
+	// Registerer collects metrics of the logstore if set.
+	Registerer prometheus.Registerer
+
+	// Tracer traces operations of the logstore if set.
+	Tracer trace.Tracer
+
+	// Events receives structured events of the books and GC cycles if set.
+	Events *lstore.EventLogger
+
+	// Observers are notified of operations on the books.
+	Observers []lstore.Observer
+
+	// Quota limits resources used by every thread.
+	Quota lstore.Quota
+
+	// Durability selects when writes are flushed to stable storage.
+	// Writes are flushed on close by default.
+	Durability Durability
+
+	// FlushInterval is the period of flushes with DurabilityPeriodic. A
+	// zero value selects DefaultFlushInterval.
+	FlushInterval time.Duration
+
+	// Backups takes online backups of the logstore if set.
+	Backups *Backups
 }
 
 // DefaultOpts returns the default options for a persistent peerstore, with the full-purge GC algorithm:
 //
 // * Cache size: 1024.
+// * Key cache size: 1024.
 // * GC purge interval: 2 hours.
 // * GC initial delay: 60 seconds.
 func DefaultOpts() Options {
 	return Options{
 		CacheSize:       1024,
+		KeyCacheSize:    1024,
 		GCPurgeInterval: 2 * time.Hour,
 		GCInitialDelay:  60 * time.Second,
 	}
@@ -45,21 +113,87 @@ func DefaultOpts() Options {
 
 // NewLogstore creates a logstore backed by the provided persistent datastore.
 func NewLogstore(ctx context.Context, store ds.Batching, opts Options) (core.Logstore, error) {
+	pending, err := Migrate(store, opts.DryRunMigrations)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRunMigrations && len(pending) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMigrationsPending, strings.Join(pending, "; "))
+	}
+
+	flushInterval := opts.FlushInterval
+	switch opts.Durability {
+	case DurabilityOnClose:
+	case DurabilityPeriodic:
+		if flushInterval < 0 {
+			return nil, fmt.Errorf("negative flush interval provided: %s", flushInterval)
+		} else if flushInterval == 0 {
+			flushInterval = DefaultFlushInterval
+		}
+	case DurabilityEveryWrite:
+		txnStore, ok := store.(ds.TxnDatastore)
+		if !ok {
+			return nil, fmt.Errorf("datastore does not support transactions")
+		}
+		store = &syncedDatastore{Batching: store, txnStore: txnStore}
+	default:
+		return nil, fmt.Errorf("unknown durability mode: %s", opts.Durability)
+	}
+
+	if opts.Backups != nil {
+		txnStore, ok := store.(ds.TxnDatastore)
+		if !ok {
+			return nil, fmt.Errorf("datastore does not support transactions")
+		}
+		if store, err = opts.Backups.attach(store, txnStore); err != nil {
+			return nil, err
+		}
+	}
+
 	addrBook, err := NewAddrBook(ctx, store, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	keyBook, err := NewKeyBook(store)
+	keyBook, err := newKeyBook(store, opts.KeyCacheSize, opts.MasterKey, opts.KeyStorage)
 	if err != nil {
 		return nil, err
 	}
 
-	threadMetadata := NewThreadMetadata(store)
+	codec := opts.MetaCodec
+	if codec == nil {
+		codec = GobCodec
+	}
+	if err := checkCodec(store, codec); err != nil {
+		return nil, err
+	}
+	if opts.MetaSweepInterval < 0 {
+		return nil, fmt.Errorf("negative metadata sweep interval provided: %s", opts.MetaSweepInterval)
+	}
+	threadMetadata := newThreadMetadata(store, codec, opts.MetaSweepInterval)
 
 	headBook := NewHeadBook(store.(ds.TxnDatastore))
 
-	ps := lstore.NewLogstore(keyBook, addrBook, headBook, threadMetadata)
+	lopts := []lstore.Option{lstore.WithStrictMode(opts.Strict), lstore.WithQuota(opts.Quota)}
+	if opts.Registerer != nil {
+		lopts = append(lopts, lstore.WithMetrics(opts.Registerer))
+	}
+	if opts.Tracer != nil {
+		lopts = append(lopts, lstore.WithTracer(opts.Tracer))
+	}
+	if opts.Events != nil {
+		lopts = append(lopts, lstore.WithEventLogger(opts.Events))
+	}
+	for _, o := range opts.Observers {
+		lopts = append(lopts, lstore.WithObserver(o))
+	}
+	if opts.Durability == DurabilityPeriodic {
+		lopts = append(lopts, lstore.WithCloser(startFlusher(ctx, store, flushInterval)))
+	}
+	if opts.Backups != nil {
+		lopts = append(lopts, lstore.WithCloser(backupsCloser{b: opts.Backups}))
+	}
+	ps := lstore.NewLogstore(keyBook, addrBook, headBook, threadMetadata, lopts...)
 	return ps, nil
 }
 
@@ -98,8 +232,40 @@ func uniqueThreadIds(ds ds.Datastore, prefix ds.Key, extractor func(result query
 	return ids, nil
 }
 
+// forEachThreadKey calls fn with threads of keys under the prefix made of
+// the given number of namespaces, until it returns false. Consecutive keys
+// of the same thread are passed once. Returns whether fn stopped the
+// iteration.
+func forEachThreadKey(store ds.Datastore, prefix ds.Key, namespaces int, fn func(thread.ID) bool) (bool, error) {
+	results, err := store.Query(query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return false, err
+	}
+	defer results.Close()
+
+	var last string
+	for result := range results.Next() {
+		if result.Error != nil {
+			return false, result.Error
+		}
+		kns := ds.RawKey(result.Key).Namespaces()
+		if len(kns) != namespaces || kns[2] == last {
+			continue
+		}
+		last = kns[2]
+		id, err := parseThreadID(last)
+		if err != nil {
+			continue
+		}
+		if !fn(id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // uniqueLogIds extracts and returns unique thread IDs from database keys.
-func uniqueLogIds(ds ds.Datastore, prefix ds.Key, extractor func(result query.Result) string) (peer.IDSlice, error) {
+func uniqueLogIds(ds ds.Datastore, prefix ds.Key, extractor func(result query.Result) string) (thread.LogIDSlice, error) {
 	var (
 		q       = query.Query{Prefix: prefix.String(), KeysOnly: true}
 		results query.Results
@@ -120,10 +286,10 @@ func uniqueLogIds(ds ds.Datastore, prefix ds.Key, extractor func(result query.Re
 	}
 
 	if len(idset) == 0 {
-		return peer.IDSlice{}, nil
+		return thread.LogIDSlice{}, nil
 	}
 
-	ids := make(peer.IDSlice, 0, len(idset))
+	ids := make(thread.LogIDSlice, 0, len(idset))
 	for id := range idset {
 		id, err := parseLogID(id)
 		if err == nil {
@@ -133,12 +299,41 @@ func uniqueLogIds(ds ds.Datastore, prefix ds.Key, extractor func(result query.Re
 	return ids, nil
 }
 
+// prefixDiskUsage returns the total size of the keys and values stored under prefix.
+func prefixDiskUsage(ds ds.Datastore, prefix ds.Key) (int64, error) {
+	results, err := ds.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	var size int64
+	for result := range results.Next() {
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		size += int64(len(result.Key) + len(result.Value))
+	}
+	return size, nil
+}
+
+// syncPrefixes flushes writes under the prefixes which the datastore may
+// still buffer.
+func syncPrefixes(ds ds.Datastore, prefixes ...ds.Key) error {
+	for _, prefix := range prefixes {
+		if err := ds.Sync(prefix); err != nil {
+			return fmt.Errorf("syncing %s: %w", prefix, err)
+		}
+	}
+	return nil
+}
+
 func dsThreadKey(t thread.ID, baseKey ds.Key) ds.Key {
 	key := baseKey.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes()))
 	return key
 }
 
-func dsLogKey(t thread.ID, p peer.ID, baseKey ds.Key) ds.Key {
+func dsLogKey(t thread.ID, p thread.LogID, baseKey ds.Key) ds.Key {
 	key := baseKey.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes()))
 	key = key.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
 	return key
@@ -153,11 +348,11 @@ func parseThreadID(id string) (thread.ID, error) {
 	return thread.Cast(pid)
 }
 
-func parseLogID(id string) (peer.ID, error) {
+func parseLogID(id string) (thread.LogID, error) {
 	pid, err := base32.RawStdEncoding.DecodeString(id)
 	if err != nil {
 		return "", err
 	}
 
-	return peer.IDFromBytes(pid)
+	return thread.LogIDFromBytes(pid)
 }
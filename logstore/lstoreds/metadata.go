@@ -1,9 +1,13 @@
 package lstoreds
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
@@ -14,21 +18,59 @@ import (
 
 // Thread metadata is stored in db key pattern:
 // /thread/meta/<base32 thread id no padding>
+// Expiration times of keys stored with a TTL are kept under the same key in:
+// /thread/metaexp/<base32 thread id no padding>
 var (
-	tmetaBase                     = ds.NewKey("/thread/meta")
-	_         core.ThreadMetadata = (*dsThreadMetadata)(nil)
+	tmetaBase                        = ds.NewKey("/thread/meta")
+	tmetaExpBase                     = ds.NewKey("/thread/metaexp")
+	_            core.ThreadMetadata = (*dsThreadMetadata)(nil)
 )
 
 type dsThreadMetadata struct {
-	ds ds.Datastore
+	ds    ds.Datastore
+	codec Codec
+
+	// sweeper is started with the first key stored with a TTL and purges
+	// expired keys every sweep interval.
+	sweepInterval time.Duration
+	sweepOnce     sync.Once
+	ctx           context.Context
+	cancel        func()
+	sweepDone     sync.WaitGroup
 }
 
 func NewThreadMetadata(ds ds.Datastore) core.ThreadMetadata {
+	return NewThreadMetadataWithCodec(ds, GobCodec)
+}
+
+// NewThreadMetadataWithCodec returns a metadata book serializing values
+// with the given codec.
+func NewThreadMetadataWithCodec(ds ds.Datastore, codec Codec) core.ThreadMetadata {
+	return newThreadMetadata(ds, codec, DefaultMetaSweepInterval)
+}
+
+// newThreadMetadata returns a metadata book purging expired values every
+// sweep interval, DefaultMetaSweepInterval if zero.
+func newThreadMetadata(ds ds.Datastore, codec Codec, sweep time.Duration) *dsThreadMetadata {
+	if sweep == 0 {
+		sweep = DefaultMetaSweepInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &dsThreadMetadata{
-		ds: ds,
+		ds:            ds,
+		codec:         codec,
+		sweepInterval: sweep,
+		ctx:           ctx,
+		cancel:        cancel,
 	}
 }
 
+func (m *dsThreadMetadata) Close() error {
+	m.cancel()
+	m.sweepDone.Wait()
+	return syncPrefixes(m.ds, tmetaBase, tmetaExpBase)
+}
+
 func (m *dsThreadMetadata) GetInt64(t thread.ID, key string) (*int64, error) {
 	var val int64
 	err := m.getValue(t, key, &val)
@@ -93,14 +135,228 @@ func (m *dsThreadMetadata) PutBytes(t thread.ID, key string, val []byte) error {
 	return m.setValue(t, key, val)
 }
 
+func (m *dsThreadMetadata) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return core.ErrInvalidTTL
+	}
+	switch val.(type) {
+	case int64, string, bool, []byte:
+	default:
+		return fmt.Errorf("unsupported value type %T", val)
+	}
+	if err := m.putValue(keyMeta(t, key), val); err != nil {
+		return err
+	}
+	return m.putExpiry(t, key, time.Now().Add(ttl))
+}
+
+// putExpiry stores the expiration time of the key and starts the sweeper.
+func (m *dsThreadMetadata) putExpiry(t thread.ID, key string, exp time.Time) error {
+	m.sweepOnce.Do(func() {
+		m.sweepDone.Add(1)
+		go m.background()
+	})
+
+	var v [8]byte
+	binary.BigEndian.PutUint64(v[:], uint64(exp.UnixNano()))
+	if err := m.ds.Put(keyMetaExp(t, key), v[:]); err != nil {
+		return fmt.Errorf("error when saving expiration time in datastore: %w", err)
+	}
+	return nil
+}
+
+// background periodically purges expired keys.
+func (m *dsThreadMetadata) background() {
+	defer m.sweepDone.Done()
+
+	ticker := time.NewTicker(m.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.sweep(); err != nil {
+				log.Errorf("error while purging expired metadata: %v", err)
+			}
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *dsThreadMetadata) sweep() error {
+	expired, err := m.expiredKeys(tmetaExpBase)
+	if err != nil {
+		return err
+	}
+	for k := range expired {
+		if err := m.ds.Delete(ds.RawKey(k)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+		if err := m.ds.Delete(expKeyOf(ds.RawKey(k))); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// expiredKeys returns a set of expired metadata keys having expiration
+// times stored under the prefix.
+func (m *dsThreadMetadata) expiredKeys(prefix ds.Key) (map[string]struct{}, error) {
+	exps, err := m.expirations(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		expired = make(map[string]struct{})
+		now     = time.Now()
+	)
+	for k, exp := range exps {
+		if !exp.After(now) {
+			expired[k] = struct{}{}
+		}
+	}
+	return expired, nil
+}
+
+// expirations returns expiration times stored under the prefix by
+// metadata key.
+func (m *dsThreadMetadata) expirations(prefix ds.Key) (map[string]time.Time, error) {
+	results, err := m.ds.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	exps := make(map[string]time.Time)
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+		if len(entry.Value) != 8 {
+			return nil, fmt.Errorf("bad expiration time at key %s", entry.Key)
+		}
+		kns := ds.RawKey(entry.Key).Namespaces()
+		k := tmetaBase.Child(ds.KeyWithNamespaces(kns[2:])).String()
+		exps[k] = time.Unix(0, int64(binary.BigEndian.Uint64(entry.Value)))
+	}
+	return exps, nil
+}
+
+// isExpired checks whether the key stored with a TTL has expired.
+func (m *dsThreadMetadata) isExpired(k ds.Key) (bool, error) {
+	v, err := m.ds.Get(expKeyOf(k))
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error when getting expiration time from datastore: %w", err)
+	}
+	if len(v) != 8 {
+		return false, fmt.Errorf("bad expiration time at key %s", k)
+	}
+	return int64(binary.BigEndian.Uint64(v)) <= time.Now().UnixNano(), nil
+}
+
+// ForEachThreadWithMeta calls fn with every thread having a value stored
+// under the key until it returns false. Only keys are read from the
+// datastore.
+func (m *dsThreadMetadata) ForEachThreadWithMeta(key string, fn func(thread.ID) bool) error {
+	// only values stored with a TTL have to be checked for expiration
+	withTTL, err := m.metaKeysWithPrefix(tmetaExpBase, key)
+	if err != nil {
+		return err
+	}
+	results, err := m.ds.Query(query.Query{
+		Prefix:   tmetaBase.String(),
+		KeysOnly: true,
+		Filters:  []query.Filter{metaKeyFilter(key)},
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		k := ds.RawKey(res.Key)
+		tid, err := parseThreadID(k.Namespaces()[2])
+		if err != nil {
+			return fmt.Errorf("cannot parse thread ID of key %s: %w", k, err)
+		}
+		if _, ok := withTTL[expKeyOf(k).String()]; ok {
+			expired, err := m.isExpired(k)
+			if err != nil {
+				return err
+			}
+			if expired {
+				continue
+			}
+		}
+		if !fn(tid) {
+			break
+		}
+	}
+	return nil
+}
+
+// metaKeysWithPrefix returns datastore keys of a metadata key of any thread
+// under the prefix, reading keys only.
+func (m *dsThreadMetadata) metaKeysWithPrefix(prefix ds.Key, key string) (map[string]struct{}, error) {
+	results, err := m.ds.Query(query.Query{
+		Prefix:   prefix.String(),
+		KeysOnly: true,
+		Filters:  []query.Filter{metaKeyFilter(key)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	keys := make(map[string]struct{})
+	for res := range results.Next() {
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		keys[res.Key] = struct{}{}
+	}
+	return keys, nil
+}
+
+// metaKeyFilter accepts entries of a metadata key of any thread.
+type metaKeyFilter string
+
+func (f metaKeyFilter) Filter(e query.Entry) bool {
+	kns := ds.RawKey(e.Key).Namespaces()
+	return len(kns) > 3 && strings.Join(kns[3:], "/") == string(f)
+}
+
 func keyMeta(t thread.ID, k string) ds.Key {
 	key := tmetaBase.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes()))
 	key = key.ChildString(k)
 	return key
 }
 
+func keyMetaExp(t thread.ID, k string) ds.Key {
+	return expKeyOf(keyMeta(t, k))
+}
+
+// expKeyOf returns the key holding the expiration time of the metadata key.
+func expKeyOf(k ds.Key) ds.Key {
+	return tmetaExpBase.Child(ds.KeyWithNamespaces(k.Namespaces()[2:]))
+}
+
 func (m *dsThreadMetadata) getValue(t thread.ID, key string, res interface{}) error {
 	k := keyMeta(t, key)
+	expired, err := m.isExpired(k)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return ds.ErrNotFound
+	}
 	v, err := m.ds.Get(k)
 	if err == ds.ErrNotFound {
 		return err
@@ -108,107 +364,264 @@ func (m *dsThreadMetadata) getValue(t thread.ID, key string, res interface{}) er
 	if err != nil {
 		return fmt.Errorf("error when getting key from meta datastore: %w", err)
 	}
-	r := bytes.NewReader(v)
-	if err := gob.NewDecoder(r).Decode(res); err != nil {
+	val, err := m.codec.Unmarshal(v)
+	if err != nil {
 		return fmt.Errorf("error when deserializing value in datastore for %s: %v", key, err)
 	}
+	var ok bool
+	switch r := res.(type) {
+	case *int64:
+		*r, ok = val.(int64)
+	case *bool:
+		*r, ok = val.(bool)
+	case *string:
+		*r, ok = val.(string)
+	case *[]byte:
+		*r, ok = val.([]byte)
+	}
+	if !ok {
+		return fmt.Errorf("error when deserializing value in datastore for %s: unexpected type %T", key, val)
+	}
 	return nil
 }
 
 func (m *dsThreadMetadata) setValue(t thread.ID, key string, val interface{}) error {
-	k := keyMeta(t, key)
+	if err := m.putValue(keyMeta(t, key), val); err != nil {
+		return err
+	}
+	// the key becomes permanent
+	if err := m.ds.Delete(keyMetaExp(t, key)); err != nil && err != ds.ErrNotFound {
+		return fmt.Errorf("error when clearing expiration time: %w", err)
+	}
+	return nil
+}
 
-	var buf bytes.Buffer
-	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+func (m *dsThreadMetadata) putValue(k ds.Key, val interface{}) error {
+	data, err := m.codec.Marshal(val)
+	if err != nil {
 		return fmt.Errorf("error when marshaling value: %w", err)
 	}
-	if err := m.ds.Put(k, buf.Bytes()); err != nil {
+	if err := m.ds.Put(k, data); err != nil {
 		return fmt.Errorf("error when saving marshaled value in datastore: %w", err)
 	}
 	return nil
 }
 
 func (m *dsThreadMetadata) ClearMetadata(t thread.ID) error {
+	if err := m.clearKeys(dsThreadKey(t, tmetaExpBase).String()); err != nil {
+		return err
+	}
 	return m.clearKeys(tmetaBase.ChildString(base32.RawStdEncoding.EncodeToString(t.Bytes())).String())
 }
 
+func (m *dsThreadMetadata) MetaKeys(t thread.ID) ([]string, error) {
+	results, err := m.ds.Query(query.Query{Prefix: dsThreadKey(t, tmetaBase).String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	expired, err := m.expiredKeys(dsThreadKey(t, tmetaExpBase))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+		if _, ok := expired[entry.Key]; ok {
+			continue
+		}
+		kns := ds.RawKey(entry.Key).Namespaces()
+		if len(kns) < 4 {
+			return nil, fmt.Errorf("bad metabook key detected: %s", entry.Key)
+		}
+		keys = append(keys, strings.Join(kns[3:], "/"))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// DeleteMetaPrefix deletes the key and all keys nested under it. Keys are
+// cleaned by the datastore, so prefixes of every key, which would delete
+// reserved keys too, fail with core.ErrInvalidMetaKey, see ClearMetadata.
+func (m *dsThreadMetadata) DeleteMetaPrefix(t thread.ID, prefix string) error {
+	if core.CleanMetaKey(prefix) == "" {
+		return core.ErrInvalidMetaKey
+	}
+	for _, key := range []ds.Key{keyMeta(t, prefix), keyMetaExp(t, prefix)} {
+		if err := m.clearKeys(key.String()); err != nil {
+			return err
+		}
+		// query by prefix matches nested keys only
+		if err := m.ds.Delete(key); err != nil && err != ds.ErrNotFound {
+			return fmt.Errorf("error when clearing key: %w", err)
+		}
+	}
+	return nil
+}
+
+// ThreadDiskUsage returns the size of all metadata stored for a thread.
+func (m *dsThreadMetadata) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return prefixDiskUsage(m.ds, dsThreadKey(t, tmetaBase))
+}
+
+// MetaEntrySizes returns sizes of metadata entries of a thread by key, as
+// counted against quotas.
+func (m *dsThreadMetadata) MetaEntrySizes(t thread.ID) (map[string]int64, error) {
+	expired, err := m.expiredKeys(dsThreadKey(t, tmetaExpBase))
+	if err != nil {
+		return nil, err
+	}
+	results, err := m.ds.Query(query.Query{Prefix: dsThreadKey(t, tmetaBase).String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	sizes := make(map[string]int64)
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+		if _, ok := expired[entry.Key]; ok {
+			continue
+		}
+		kns := ds.RawKey(entry.Key).Namespaces()
+		if len(kns) < 4 {
+			return nil, fmt.Errorf("bad metabook key detected: %s", entry.Key)
+		}
+		value, err := m.codec.Unmarshal(entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode value at key %s: %w", entry.Key, err)
+		}
+		key := strings.Join(kns[3:], "/")
+		sizes[key] = core.MetaEntrySize(key, value)
+	}
+	return sizes, nil
+}
+
+// ThreadMeta returns all metadata values of a thread, reading entries of
+// the thread only.
+func (m *dsThreadMetadata) ThreadMeta(t thread.ID) (core.MetadataValues, error) {
+	vals := core.MetadataValues{
+		Int64:   make(map[string]int64),
+		Bool:    make(map[string]bool),
+		String:  make(map[string]string),
+		Bytes:   make(map[string][]byte),
+		Expires: make(map[string]time.Time),
+	}
+	exps, err := m.expirations(dsThreadKey(t, tmetaExpBase))
+	if err != nil {
+		return vals, err
+	}
+	results, err := m.ds.Query(query.Query{Prefix: dsThreadKey(t, tmetaBase).String()})
+	if err != nil {
+		return vals, err
+	}
+	defer results.Close()
+
+	now := time.Now()
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return vals, entry.Error
+		}
+		exp, withTTL := exps[entry.Key]
+		if withTTL && !exp.After(now) {
+			continue
+		}
+		kns := ds.RawKey(entry.Key).Namespaces()
+		if len(kns) < 4 {
+			return vals, fmt.Errorf("bad metabook key detected: %s", entry.Key)
+		}
+		value, err := m.codec.Unmarshal(entry.Value)
+		if err != nil {
+			return vals, fmt.Errorf("cannot decode value at key %s: %w", entry.Key, err)
+		}
+		key := strings.Join(kns[3:], "/")
+		if withTTL {
+			vals.Expires[key] = exp
+		}
+		switch v := value.(type) {
+		case int64:
+			vals.Int64[key] = v
+		case bool:
+			vals.Bool[key] = v
+		case string:
+			vals.String[key] = v
+		case []byte:
+			vals.Bytes[key] = v
+		}
+	}
+	return vals, nil
+}
+
 func (m *dsThreadMetadata) DumpMeta() (core.DumpMetadata, error) {
 	var (
 		vBool   = make(map[core.MetadataKey]bool)
 		vInt64  = make(map[core.MetadataKey]int64)
 		vString = make(map[core.MetadataKey]string)
 		vBytes  = make(map[core.MetadataKey][]byte)
+		expires = make(map[core.MetadataKey]time.Time)
 
-		buff bytes.Buffer
 		dump core.DumpMetadata
-		dec  = gob.NewDecoder(&buff)
 	)
 
+	exps, err := m.expirations(tmetaExpBase)
+	if err != nil {
+		return dump, err
+	}
 	results, err := m.ds.Query(query.Query{Prefix: tmetaBase.String()})
 	if err != nil {
 		return dump, err
 	}
 	defer results.Close()
 
+	now := time.Now()
 	for entry := range results.Next() {
+		exp, withTTL := exps[entry.Key]
+		if withTTL && !exp.After(now) {
+			continue
+		}
 		kns := ds.RawKey(entry.Key).Namespaces()
 		if len(kns) < 4 {
 			return dump, fmt.Errorf("bad metabook key detected: %s", entry.Key)
 		}
 
-		ts, key := kns[2], kns[3]
+		// metadata keys may contain separators themselves
+		ts, key := kns[2], strings.Join(kns[3:], "/")
 		tid, err := parseThreadID(ts)
 		if err != nil {
 			return dump, fmt.Errorf("cannot parse thread ID %s: %w", ts, err)
 		}
 
 		var mk = core.MetadataKey{T: tid, K: key}
-
-		// we (kinda) don't know about type on the wire, so try to decode into every known type
-		{
-			var value int64
-			buff.Reset()
-			buff.Write(entry.Value)
-			if dec.Decode(&value) == nil {
-				vInt64[mk] = value
-				continue
-			}
+		if withTTL {
+			expires[mk] = exp
 		}
-		{
-			var value bool
-			buff.Reset()
-			buff.Write(entry.Value)
-			if dec.Decode(&value) == nil {
-				vBool[mk] = value
-				continue
-			}
-		}
-		{
-			var value string
-			buff.Reset()
-			buff.Write(entry.Value)
-			if dec.Decode(&value) == nil {
-				vString[mk] = value
-				continue
-			}
+
+		value, err := m.codec.Unmarshal(entry.Value)
+		if err != nil {
+			return dump, fmt.Errorf("cannot decode value at key: %v, value: %v", mk, entry.Value)
 		}
-		{
-			var value []byte
-			buff.Reset()
-			buff.Write(entry.Value)
-			if dec.Decode(&value) == nil {
-				vBytes[mk] = value
-				continue
-			}
+		switch v := value.(type) {
+		case int64:
+			vInt64[mk] = v
+		case bool:
+			vBool[mk] = v
+		case string:
+			vString[mk] = v
+		case []byte:
+			vBytes[mk] = v
 		}
-
-		return dump, fmt.Errorf("cannot decode value at key: %v, value: %v", mk, entry.Value)
 	}
 
 	dump.Data.Bool = vBool
 	dump.Data.Int64 = vInt64
 	dump.Data.String = vString
 	dump.Data.Bytes = vBytes
+	dump.Expires = expires
 	return dump, nil
 }
 
@@ -224,6 +637,9 @@ func (m *dsThreadMetadata) RestoreMeta(dump core.DumpMetadata) error {
 	if err := m.clearKeys(tmetaBase.String()); err != nil {
 		return err
 	}
+	if err := m.clearKeys(tmetaExpBase.String()); err != nil {
+		return err
+	}
 
 	for mk, val := range dump.Data.Bool {
 		if err := m.setValue(mk.T, mk.K, val); err != nil {
@@ -246,6 +662,23 @@ func (m *dsThreadMetadata) RestoreMeta(dump core.DumpMetadata) error {
 		}
 	}
 
+	// keep values stored with a TTL expiring, dropping the expired ones
+	now := time.Now()
+	for mk, exp := range dump.Expires {
+		if ok, err := m.ds.Has(keyMeta(mk.T, mk.K)); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if exp.After(now) {
+			if err := m.putExpiry(mk.T, mk.K, exp); err != nil {
+				return err
+			}
+		} else if err := m.ds.Delete(keyMeta(mk.T, mk.K)); err != nil && err != ds.ErrNotFound {
+			return fmt.Errorf("error when clearing expired key: %w", err)
+		}
+	}
+
 	return nil
 }
 
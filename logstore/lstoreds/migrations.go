@@ -0,0 +1,136 @@
+package lstoreds
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Version of the key layout is stored in db key:
+// /thread/schema
+var schemaVersionKey = ds.NewKey("/thread/schema")
+
+// ErrSchemaTooNew indicates the datastore was written by a newer version
+// of the logstore with an unknown key layout.
+var ErrSchemaTooNew = errors.New("datastore schema is newer than supported")
+
+// ErrMigrationsPending indicates the datastore needs to be migrated, but
+// migrations run in dry-run mode.
+var ErrMigrationsPending = errors.New("datastore migrations pending")
+
+// baseSchemaVersion is the key layout stores had before versioning was
+// introduced. Stores without a version record are assumed to use it.
+const baseSchemaVersion = 1
+
+// migration upgrades the key layout of the datastore to the version.
+type migration struct {
+	version     int
+	description string
+	migrate     func(ds.Datastore) error
+}
+
+// migrations must be ordered by version. Each one upgrades the store from
+// the preceding version.
+var migrations = []migration{
+	{version: 2, description: "index threads of logs", migrate: indexLogs},
+	{version: 3, description: "index logs of addresses", migrate: indexAddrs},
+}
+
+// SchemaVersion returns the key layout version written by this logstore.
+func SchemaVersion() int {
+	if len(migrations) == 0 {
+		return baseSchemaVersion
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate upgrades the key layout of the datastore to the current schema
+// version and returns descriptions of the applied migrations. With dryRun
+// set, pending migrations are only reported and the store is left intact.
+func Migrate(store ds.Datastore, dryRun bool) ([]string, error) {
+	version, recorded, err := storedSchemaVersion(store)
+	if err != nil {
+		return nil, err
+	}
+	if version > SchemaVersion() {
+		return nil, fmt.Errorf("%w: %d > %d", ErrSchemaTooNew, version, SchemaVersion())
+	}
+
+	var applied []string
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		desc := fmt.Sprintf("%d: %s", m.version, m.description)
+		if !dryRun {
+			if err := m.migrate(store); err != nil {
+				return applied, fmt.Errorf("migrating datastore to version %d: %w", m.version, err)
+			}
+			if err := putSchemaVersion(store, m.version); err != nil {
+				return applied, err
+			}
+			log.Infof("migrated datastore to version %s", desc)
+		}
+		applied = append(applied, desc)
+	}
+	if !dryRun && !recorded {
+		if err := putSchemaVersion(store, SchemaVersion()); err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+// storedSchemaVersion returns the schema version of the store and whether
+// it's recorded. Empty stores are considered up to date, unversioned ones
+// to have the base version.
+func storedSchemaVersion(store ds.Datastore) (version int, recorded bool, err error) {
+	v, err := store.Get(schemaVersionKey)
+	if err == ds.ErrNotFound {
+		empty, err := isEmpty(store)
+		if err != nil {
+			return 0, false, err
+		}
+		if empty {
+			return SchemaVersion(), false, nil
+		}
+		return baseSchemaVersion, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("getting schema version: %w", err)
+	}
+	ver, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, false, fmt.Errorf("bad schema version record")
+	}
+	return int(ver), true, nil
+}
+
+func putSchemaVersion(store ds.Datastore, version int) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(version))
+	if err := store.Put(schemaVersionKey, buf[:n]); err != nil {
+		return fmt.Errorf("saving schema version: %w", err)
+	}
+	return nil
+}
+
+// isEmpty reports whether the store holds no logstore keys.
+func isEmpty(store ds.Datastore) (bool, error) {
+	results, err := store.Query(query.Query{Prefix: "/thread", KeysOnly: true, Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	defer results.Close()
+
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return false, entry.Error
+		}
+		return false, nil
+	}
+	return true, nil
+}
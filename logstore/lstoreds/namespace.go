@@ -0,0 +1,184 @@
+package lstoreds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/keytransform"
+	"github.com/ipfs/go-datastore/query"
+	core "github.com/textileio/go-threads/core/logstore"
+)
+
+// Logstores of namespaces are stored in db key pattern:
+// /ns/<namespace>/<logstore key>
+// Namespaces in use are registered in db key pattern:
+// /nsindex/<namespace>
+var (
+	nsBase      = ds.NewKey("/ns")
+	nsIndexBase = ds.NewKey("/nsindex")
+)
+
+// ErrInvalidNamespace indicates a namespace is empty or contains a separator.
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+func checkNamespace(ns string) error {
+	if ns == "" || strings.Contains(ns, "/") || ds.NewKey(ns).Name() != ns {
+		return fmt.Errorf("%w: %q", ErrInvalidNamespace, ns)
+	}
+	return nil
+}
+
+// NewNamespacedLogstore creates a logstore seeing only threads of the
+// namespace, e.g. a tenant ID, so that multiple applications or users can
+// share a datastore. The datastore must support transactions.
+func NewNamespacedLogstore(ctx context.Context, store ds.Batching, ns string, opts Options) (core.Logstore, error) {
+	if err := checkNamespace(ns); err != nil {
+		return nil, err
+	}
+	txnStore, ok := store.(ds.TxnDatastore)
+	if !ok {
+		return nil, fmt.Errorf("datastore of namespace %s does not support transactions", ns)
+	}
+	if err := store.Put(nsIndexBase.ChildString(ns), nil); err != nil {
+		return nil, fmt.Errorf("registering namespace %s: %w", ns, err)
+	}
+	prefix := nsBase.ChildString(ns)
+	return NewLogstore(ctx, &nsDatastore{
+		Datastore: keytransform.Wrap(store, keytransform.PrefixTransform{Prefix: prefix}),
+		txnStore:  txnStore,
+		prefix:    prefix,
+	}, opts)
+}
+
+// Namespaces returns sorted namespaces having logstores in the datastore.
+func Namespaces(store ds.Datastore) ([]string, error) {
+	results, err := store.Query(query.Query{Prefix: nsIndexBase.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var nss []string
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+		key := ds.RawKey(entry.Key)
+		if key.Parent() == nsIndexBase {
+			nss = append(nss, key.Name())
+		}
+	}
+	sort.Strings(nss)
+	return nss, nil
+}
+
+// DeleteNamespace deletes all threads of the namespace from the datastore.
+// Logstores of the namespace must be closed beforehand.
+func DeleteNamespace(store ds.Batching, ns string) error {
+	if err := checkNamespace(ns); err != nil {
+		return err
+	}
+	prefix := nsBase.ChildString(ns)
+	results, err := store.Query(query.Query{Prefix: prefix.String() + "/", KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	batch, err := newCyclicBatch(store, defaultOpsPerCyclicBatch)
+	if err != nil {
+		return err
+	}
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return entry.Error
+		}
+		if key := ds.RawKey(entry.Key); key.IsDescendantOf(prefix) {
+			if err := batch.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := batch.Delete(nsIndexBase.ChildString(ns)); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+// nsDatastore prefixes keys of all operations, including ones of
+// transactions, with the key of a namespace.
+type nsDatastore struct {
+	*keytransform.Datastore
+	txnStore ds.TxnDatastore
+	prefix   ds.Key
+}
+
+var _ ds.TxnDatastore = (*nsDatastore)(nil)
+
+func (d *nsDatastore) NewTransaction(readOnly bool) (ds.Txn, error) {
+	txn, err := d.txnStore.NewTransaction(readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &nsTxn{Txn: txn, prefix: d.prefix}, nil
+}
+
+// Close leaves the shared datastore open.
+func (d *nsDatastore) Close() error {
+	return nil
+}
+
+type nsTxn struct {
+	ds.Txn
+	prefix ds.Key
+}
+
+func (t *nsTxn) Get(key ds.Key) ([]byte, error) {
+	return t.Txn.Get(t.prefix.Child(key))
+}
+
+func (t *nsTxn) Has(key ds.Key) (bool, error) {
+	return t.Txn.Has(t.prefix.Child(key))
+}
+
+func (t *nsTxn) GetSize(key ds.Key) (int, error) {
+	return t.Txn.GetSize(t.prefix.Child(key))
+}
+
+func (t *nsTxn) Put(key ds.Key, value []byte) error {
+	return t.Txn.Put(t.prefix.Child(key), value)
+}
+
+func (t *nsTxn) Delete(key ds.Key) error {
+	return t.Txn.Delete(t.prefix.Child(key))
+}
+
+func (t *nsTxn) Query(q query.Query) (query.Results, error) {
+	// filters and orders may depend on keys, so they're applied to
+	// results with the prefix removed
+	cq := query.Query{Prefix: t.prefix.Child(ds.NewKey(q.Prefix)).String(), KeysOnly: q.KeysOnly, ReturnExpirations: q.ReturnExpirations}
+	results, err := t.Txn.Query(cq)
+	if err != nil {
+		return nil, err
+	}
+	nq := q
+	nq.Prefix = ""
+	return query.NaiveQueryApply(nq, query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			r, ok := results.NextSync()
+			if ok && r.Error == nil {
+				key := ds.RawKey(r.Entry.Key)
+				if !key.IsDescendantOf(t.prefix) {
+					return query.Result{Error: fmt.Errorf("key %s out of namespace %s", key, t.prefix)}, true
+				}
+				r.Entry.Key = ds.RawKey(strings.TrimPrefix(key.String(), t.prefix.String())).String()
+			}
+			return r, ok
+		},
+		Close: results.Close,
+	})), nil
+}
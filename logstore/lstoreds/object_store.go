@@ -0,0 +1,416 @@
+package lstoreds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// ErrObjectNotFound is returned by an ObjectStore for missing objects.
+var ErrObjectNotFound = errors.New("object not found")
+
+var errReadOnlyTxn = errors.New("transaction is read-only")
+
+// DefaultMaxBuffered is the size of writes buffered by an ObjectDatastore
+// before they're flushed if ObjectOptions.MaxBuffered isn't set.
+var DefaultMaxBuffered = 4 << 20
+
+// ObjectStore is a bucket of an object store, e.g. of an S3-compatible
+// service. Object names are slash separated paths. S3ObjectStore implements
+// it for S3-compatible services.
+type ObjectStore interface {
+	// GetObject returns the content of the object, or ErrObjectNotFound.
+	GetObject(ctx context.Context, name string) ([]byte, error)
+
+	// PutObject creates or replaces the object.
+	PutObject(ctx context.Context, name string, data []byte) error
+
+	// DeleteObject deletes the object. Deleting a missing object must not
+	// fail.
+	DeleteObject(ctx context.Context, name string) error
+
+	// ListObjects returns names of all objects starting with the prefix.
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ObjectOptions configures an ObjectDatastore.
+type ObjectOptions struct {
+	// Prefix is prepended to names of all objects, so that a bucket can be
+	// shared, e.g. "threads/".
+	Prefix string
+
+	// MaxBuffered caps the size in bytes of keys and values of writes
+	// buffered locally, after which they're flushed to the object store.
+	// A value of 0 selects DefaultMaxBuffered.
+	MaxBuffered int
+}
+
+// ObjectDatastore persists a datastore to an object store, one object per
+// key, so that a logstore can be run without attached disks. Writes are
+// buffered in memory until they're synced, the buffer is full or the
+// datastore is closed, so it's best paired with DurabilityPeriodic to bound
+// writes lost on a crash.
+//
+// Writes are flushed one object at a time, so a crash during a flush may
+// persist a part of a batch or transaction only. The object store must not
+// be written to by others while the datastore is in use.
+type ObjectDatastore struct {
+	ctx    context.Context
+	store  ObjectStore
+	prefix string
+	max    int
+
+	lock     sync.RWMutex
+	pending  map[ds.Key]*objectWrite
+	buffered int
+
+	// flushLock serializes flushes, so that writes of a key are applied to
+	// the object store in order.
+	flushLock sync.Mutex
+
+	// txnLock is held by the open read-write transaction.
+	txnLock sync.Mutex
+}
+
+var (
+	_ ds.Batching     = (*ObjectDatastore)(nil)
+	_ ds.TxnDatastore = (*ObjectDatastore)(nil)
+)
+
+// objectWrite is a buffered put, or deletion if deleted is set.
+type objectWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// NewObjectDatastore creates a datastore backed by the object store.
+func NewObjectDatastore(ctx context.Context, store ObjectStore, opts ObjectOptions) (*ObjectDatastore, error) {
+	max := opts.MaxBuffered
+	if max < 0 {
+		return nil, fmt.Errorf("negative buffer size provided: %d", max)
+	} else if max == 0 {
+		max = DefaultMaxBuffered
+	}
+	return &ObjectDatastore{
+		ctx:     ctx,
+		store:   store,
+		prefix:  opts.Prefix,
+		max:     max,
+		pending: make(map[ds.Key]*objectWrite),
+	}, nil
+}
+
+func (o *ObjectDatastore) objectName(key ds.Key) string {
+	return o.prefix + strings.TrimPrefix(key.String(), "/")
+}
+
+func writeSize(key ds.Key, w *objectWrite) int {
+	return len(key.String()) + len(w.value)
+}
+
+func (o *ObjectDatastore) Get(key ds.Key) ([]byte, error) {
+	o.lock.RLock()
+	w, ok := o.pending[key]
+	o.lock.RUnlock()
+	if ok {
+		if w.deleted {
+			return nil, ds.ErrNotFound
+		}
+		return w.value, nil
+	}
+	return o.getObject(key)
+}
+
+func (o *ObjectDatastore) getObject(key ds.Key) ([]byte, error) {
+	value, err := o.store.GetObject(o.ctx, o.objectName(key))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, ds.ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("getting object of %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (o *ObjectDatastore) Has(key ds.Key) (bool, error) {
+	_, err := o.Get(key)
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (o *ObjectDatastore) GetSize(key ds.Key) (int, error) {
+	value, err := o.Get(key)
+	if err != nil {
+		return -1, err
+	}
+	return len(value), nil
+}
+
+func (o *ObjectDatastore) Query(q query.Query) (query.Results, error) {
+	return o.query(q, nil)
+}
+
+// query lists keys of the object store overlaid with buffered writes and
+// the given ones, and applies the query to them.
+func (o *ObjectDatastore) query(q query.Query, overlay map[ds.Key]*objectWrite) (query.Results, error) {
+	prefix := ds.NewKey(q.Prefix)
+	matches := func(key ds.Key) bool {
+		return q.Prefix == "" || key.Equal(prefix) || prefix.IsAncestorOf(key)
+	}
+
+	writes := make(map[ds.Key]*objectWrite)
+	o.lock.RLock()
+	for key, w := range o.pending {
+		if matches(key) {
+			writes[key] = w
+		}
+	}
+	o.lock.RUnlock()
+	for key, w := range overlay {
+		if matches(key) {
+			writes[key] = w
+		}
+	}
+
+	// listed after buffered writes are copied, so that no flushed ones are
+	// missed
+	names, err := o.store.ListObjects(o.ctx, o.objectName(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("listing objects: %w", err)
+	}
+
+	keys := make(map[ds.Key]struct{}, len(names))
+	for _, name := range names {
+		keys[ds.NewKey(strings.TrimPrefix(name, o.prefix))] = struct{}{}
+	}
+	for key, w := range writes {
+		if w.deleted {
+			delete(keys, key)
+		} else {
+			keys[key] = struct{}{}
+		}
+	}
+
+	entries := make([]query.Entry, 0, len(keys))
+	for key := range keys {
+		e := query.Entry{Key: key.String(), Size: -1}
+		if !q.KeysOnly || q.ReturnsSizes {
+			var value []byte
+			if w, ok := writes[key]; ok {
+				value = w.value
+			} else if value, err = o.getObject(key); err == ds.ErrNotFound {
+				// deleted meanwhile
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			e.Size = len(value)
+			if !q.KeysOnly {
+				e.Value = value
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return query.NaiveQueryApply(q, query.ResultsWithEntries(q, entries)), nil
+}
+
+func (o *ObjectDatastore) Put(key ds.Key, value []byte) error {
+	o.lock.Lock()
+	o.write(key, &objectWrite{value: append([]byte(nil), value...)})
+	o.lock.Unlock()
+	return o.flushIfFull()
+}
+
+func (o *ObjectDatastore) Delete(key ds.Key) error {
+	o.lock.Lock()
+	o.write(key, &objectWrite{deleted: true})
+	o.lock.Unlock()
+	return o.flushIfFull()
+}
+
+// write buffers the write of the key. The lock must be held.
+func (o *ObjectDatastore) write(key ds.Key, w *objectWrite) {
+	if old, ok := o.pending[key]; ok {
+		o.buffered -= writeSize(key, old)
+	}
+	o.pending[key] = w
+	o.buffered += writeSize(key, w)
+}
+
+func (o *ObjectDatastore) flushIfFull() error {
+	o.lock.RLock()
+	full := o.buffered >= o.max
+	o.lock.RUnlock()
+	if !full {
+		return nil
+	}
+	return o.flush(ds.NewKey("/"))
+}
+
+// Sync flushes buffered writes of keys under the prefix to the object store.
+func (o *ObjectDatastore) Sync(prefix ds.Key) error {
+	return o.flush(prefix)
+}
+
+func (o *ObjectDatastore) flush(prefix ds.Key) error {
+	o.flushLock.Lock()
+	defer o.flushLock.Unlock()
+
+	writes := make(map[ds.Key]*objectWrite)
+	o.lock.RLock()
+	for key, w := range o.pending {
+		if key.Equal(prefix) || prefix.IsAncestorOf(key) {
+			writes[key] = w
+		}
+	}
+	o.lock.RUnlock()
+
+	for key, w := range writes {
+		var err error
+		if w.deleted {
+			err = o.store.DeleteObject(o.ctx, o.objectName(key))
+		} else {
+			err = o.store.PutObject(o.ctx, o.objectName(key), w.value)
+		}
+		if err != nil {
+			return fmt.Errorf("flushing %s: %w", key, err)
+		}
+
+		o.lock.Lock()
+		// keep the key buffered if it was written meanwhile
+		if o.pending[key] == w {
+			delete(o.pending, key)
+			o.buffered -= writeSize(key, w)
+		}
+		o.lock.Unlock()
+	}
+	return nil
+}
+
+// Close flushes all buffered writes.
+func (o *ObjectDatastore) Close() error {
+	return o.flush(ds.NewKey("/"))
+}
+
+func (o *ObjectDatastore) Batch() (ds.Batch, error) {
+	return &objectBatch{o: o, writes: make(map[ds.Key]*objectWrite)}, nil
+}
+
+type objectBatch struct {
+	o      *ObjectDatastore
+	writes map[ds.Key]*objectWrite
+}
+
+func (b *objectBatch) Put(key ds.Key, value []byte) error {
+	b.writes[key] = &objectWrite{value: append([]byte(nil), value...)}
+	return nil
+}
+
+func (b *objectBatch) Delete(key ds.Key) error {
+	b.writes[key] = &objectWrite{deleted: true}
+	return nil
+}
+
+func (b *objectBatch) Commit() error {
+	b.o.lock.Lock()
+	for key, w := range b.writes {
+		b.o.write(key, w)
+	}
+	b.o.lock.Unlock()
+	b.writes = make(map[ds.Key]*objectWrite)
+	return b.o.flushIfFull()
+}
+
+// NewTransaction starts a transaction. Read-write transactions are run one
+// at a time, so that they don't conflict.
+func (o *ObjectDatastore) NewTransaction(readOnly bool) (ds.Txn, error) {
+	if !readOnly {
+		o.txnLock.Lock()
+	}
+	return &objectTxn{o: o, readOnly: readOnly, writes: make(map[ds.Key]*objectWrite)}, nil
+}
+
+type objectTxn struct {
+	o        *ObjectDatastore
+	readOnly bool
+	done     bool
+	writes   map[ds.Key]*objectWrite
+}
+
+func (t *objectTxn) Get(key ds.Key) ([]byte, error) {
+	if w, ok := t.writes[key]; ok {
+		if w.deleted {
+			return nil, ds.ErrNotFound
+		}
+		return w.value, nil
+	}
+	return t.o.Get(key)
+}
+
+func (t *objectTxn) Has(key ds.Key) (bool, error) {
+	_, err := t.Get(key)
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *objectTxn) GetSize(key ds.Key) (int, error) {
+	value, err := t.Get(key)
+	if err != nil {
+		return -1, err
+	}
+	return len(value), nil
+}
+
+func (t *objectTxn) Query(q query.Query) (query.Results, error) {
+	return t.o.query(q, t.writes)
+}
+
+func (t *objectTxn) Put(key ds.Key, value []byte) error {
+	if t.readOnly {
+		return errReadOnlyTxn
+	}
+	t.writes[key] = &objectWrite{value: append([]byte(nil), value...)}
+	return nil
+}
+
+func (t *objectTxn) Delete(key ds.Key) error {
+	if t.readOnly {
+		return errReadOnlyTxn
+	}
+	t.writes[key] = &objectWrite{deleted: true}
+	return nil
+}
+
+func (t *objectTxn) Commit() error {
+	if t.done {
+		return errors.New("transaction is done")
+	}
+	t.o.lock.Lock()
+	for key, w := range t.writes {
+		t.o.write(key, w)
+	}
+	t.o.lock.Unlock()
+	t.Discard()
+	return t.o.flushIfFull()
+}
+
+func (t *objectTxn) Discard() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.writes = nil
+	if !t.readOnly {
+		t.o.txnLock.Unlock()
+	}
+}
@@ -0,0 +1,293 @@
+package lstoreds
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configures an S3ObjectStore.
+type S3Options struct {
+	// Endpoint is the base URL of the service, e.g.
+	// "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+
+	// Region of the bucket, e.g. "us-east-1". Services without regions,
+	// such as MinIO, accept "us-east-1".
+	Region string
+
+	// Bucket holding the objects.
+	Bucket string
+
+	// AccessKey and SecretKey are the credentials requests are signed with.
+	AccessKey string
+	SecretKey string
+
+	// PathStyle addresses the bucket as the first path segment of URLs
+	// instead of as a subdomain of the endpoint, as required by most
+	// S3-compatible services other than AWS.
+	PathStyle bool
+
+	// Client sends the requests. A value of nil selects http.DefaultClient.
+	Client *http.Client
+}
+
+// S3ObjectStore is an ObjectStore of a bucket of an S3-compatible service,
+// such as AWS S3, MinIO or Ceph, speaking the S3 REST API with requests
+// signed with AWS Signature Version 4.
+type S3ObjectStore struct {
+	opts S3Options
+	base *url.URL
+	now  func() time.Time
+}
+
+var _ ObjectStore = (*S3ObjectStore)(nil)
+
+// NewS3ObjectStore creates an object store of the bucket.
+func NewS3ObjectStore(opts S3Options) (*S3ObjectStore, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("bucket is empty")
+	}
+	if opts.Region == "" {
+		return nil, fmt.Errorf("region is empty")
+	}
+	base, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported endpoint scheme: %q", base.Scheme)
+	}
+	if opts.PathStyle {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/" + opts.Bucket
+	} else {
+		base.Host = opts.Bucket + "." + base.Host
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &S3ObjectStore{opts: opts, base: base, now: time.Now}, nil
+}
+
+func (s *S3ObjectStore) GetObject(ctx context.Context, name string) ([]byte, error) {
+	res, err := s.do(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if err := s3Error(res); err != nil {
+		return nil, fmt.Errorf("getting object %s: %w", name, err)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func (s *S3ObjectStore) PutObject(ctx context.Context, name string, data []byte) error {
+	res, err := s.do(ctx, http.MethodPut, name, nil, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := s3Error(res); err != nil {
+		return fmt.Errorf("putting object %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteObject deletes the object. S3 doesn't fail deleting missing objects.
+func (s *S3ObjectStore) DeleteObject(ctx context.Context, name string) error {
+	res, err := s.do(ctx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err := s3Error(res); err != nil {
+		return fmt.Errorf("deleting object %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListObjects lists the objects with ListObjectsV2, following continuation
+// tokens of truncated pages.
+func (s *S3ObjectStore) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var (
+		names []string
+		token string
+	)
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		res, err := s.do(ctx, http.MethodGet, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = s3Error(res)
+		if err == nil {
+			err = xml.NewDecoder(res.Body).Decode(&page)
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing objects %s: %w", prefix, err)
+		}
+		for _, c := range page.Contents {
+			names = append(names, c.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// do sends a signed request for the object, or for the bucket if name is
+// empty.
+func (s *S3ObjectStore) do(ctx context.Context, method, name string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3EscapeQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	signS3Request(req, body, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, s.now())
+	return s.opts.Client.Do(req)
+}
+
+// s3Error returns the error of a response which isn't successful.
+func s3Error(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	var e struct {
+		Code    string
+		Message string
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s: %s (%s)", res.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s", res.Status)
+}
+
+// signS3Request signs the request with AWS Signature Version 4, signing the
+// host along with all headers set on the request.
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(vs, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath escapes every segment of the path as URI-encoded by
+// Signature Version 4, keeping the slashes.
+func s3EscapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		segs[i] = s3Escape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// s3EscapeQuery encodes the query sorted by key, as signed by Signature
+// Version 4.
+func s3EscapeQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes all bytes but the unreserved characters of
+// RFC 3986.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,259 @@
+package lstoreds
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-datastore"
+	pb "github.com/textileio/go-threads/net/pb"
+)
+
+// sqlSchema keeps relational tables of heads, addresses and keys in sync
+// with the entries of the key-value table, see SQLDatastore.
+type sqlSchema struct {
+	heads, addrs, keys string
+
+	deleteHeads, insertHead string
+	deleteAddrs, insertAddr string
+	deleteKey, insertKey    string
+}
+
+// sqlRow is a projected entry of the key-value table.
+type sqlRow struct {
+	namespace, thread, log string
+	// book is one of "heads", "addrs" or "keys".
+	book string
+	// kind is the key kind of keys, e.g. "pub" or "read".
+	kind string
+}
+
+func newSQLSchema(db *sql.DB, table string, d SQLDialect) (*sqlSchema, bool, error) {
+	s := &sqlSchema{
+		heads: table + "_heads",
+		addrs: table + "_addrs",
+		keys:  table + "_keys",
+	}
+	var n int
+	created := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", s.heads)).Scan(&n) != nil
+
+	blob, createView := "BLOB", "CREATE VIEW IF NOT EXISTS"
+	if d == Postgres {
+		blob, createView = "BYTEA", "CREATE OR REPLACE VIEW"
+	}
+	for _, stmt := range []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			namespace TEXT NOT NULL,
+			thread    TEXT NOT NULL,
+			log       TEXT NOT NULL,
+			cid       TEXT NOT NULL,
+			PRIMARY KEY (namespace, thread, log, cid))`, s.heads),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			namespace TEXT NOT NULL,
+			thread    TEXT NOT NULL,
+			log       TEXT NOT NULL,
+			addr      TEXT NOT NULL,
+			expires   TIMESTAMP NOT NULL,
+			source    TEXT NOT NULL,
+			PRIMARY KEY (namespace, thread, log, addr))`, s.addrs),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			namespace TEXT NOT NULL,
+			thread    TEXT NOT NULL,
+			log       TEXT NOT NULL,
+			kind      TEXT NOT NULL,
+			value     %s,
+			PRIMARY KEY (namespace, thread, log, kind))`, s.keys, blob),
+		fmt.Sprintf(`%s %s_logs AS
+			SELECT namespace, thread, log FROM %s WHERE log <> ''
+			UNION SELECT namespace, thread, log FROM %s
+			UNION SELECT namespace, thread, log FROM %s`, createView, table, s.keys, s.heads, s.addrs),
+		fmt.Sprintf(`%s %s_threads AS
+			SELECT namespace, thread FROM %s
+			UNION SELECT namespace, thread FROM %s
+			UNION SELECT namespace, thread FROM %s`, createView, table, s.keys, s.heads, s.addrs),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, false, fmt.Errorf("creating schema of %s: %w", table, err)
+		}
+	}
+
+	args := func(n int) string {
+		ps := make([]string, n)
+		for i := range ps {
+			if d == Postgres {
+				ps[i] = fmt.Sprintf("$%d", i+1)
+			} else {
+				ps[i] = "?"
+			}
+		}
+		return strings.Join(ps, ", ")
+	}
+	where := func(cols ...string) string {
+		for i, c := range cols {
+			if d == Postgres {
+				cols[i] = fmt.Sprintf("%s = $%d", c, i+1)
+			} else {
+				cols[i] = c + " = ?"
+			}
+		}
+		return strings.Join(cols, " AND ")
+	}
+	s.deleteHeads = fmt.Sprintf("DELETE FROM %s WHERE %s", s.heads, where("namespace", "thread", "log"))
+	s.insertHead = fmt.Sprintf("INSERT INTO %s (namespace, thread, log, cid) VALUES (%s)", s.heads, args(4))
+	s.deleteAddrs = fmt.Sprintf("DELETE FROM %s WHERE %s", s.addrs, where("namespace", "thread", "log"))
+	s.insertAddr = fmt.Sprintf("INSERT INTO %s (namespace, thread, log, addr, expires, source) VALUES (%s)", s.addrs, args(6))
+	s.deleteKey = fmt.Sprintf("DELETE FROM %s WHERE %s", s.keys, where("namespace", "thread", "log", "kind"))
+	s.insertKey = fmt.Sprintf("INSERT INTO %s (namespace, thread, log, kind, value) VALUES (%s)", s.keys, args(5))
+	return s, created, nil
+}
+
+// parseSQLRow returns the row of the table an entry is projected to, if
+// any. Entries of namespaces, see NewNamespacedLogstore, are projected with
+// their namespace.
+func parseSQLRow(key ds.Key) (sqlRow, bool) {
+	var (
+		r   sqlRow
+		nss = key.Namespaces()
+	)
+	if len(nss) > 2 && nss[0] == nsBase.Name() {
+		r.namespace, nss = nss[1], nss[2:]
+	}
+	if len(nss) < 4 || nss[0] != "thread" {
+		return r, false
+	}
+	r.book = nss[1]
+	switch {
+	case r.book == "heads" && len(nss) == 4, r.book == "addrs" && len(nss) == 4:
+	case r.book == "keys" && len(nss) == 4:
+		r.kind = nss[3]
+		nss = nss[:3]
+	case r.book == "keys" && len(nss) == 5:
+		r.kind = nss[4]
+	default:
+		return r, false
+	}
+
+	t, err := parseThreadID(nss[2])
+	if err != nil {
+		return r, false
+	}
+	r.thread = t.String()
+	if len(nss) > 3 {
+		l, err := parseLogID(nss[3])
+		if err != nil {
+			return r, false
+		}
+		r.log = l.String()
+	}
+	return r, true
+}
+
+// project replaces the rows of an entry with the ones of its new value, or
+// removes them if value is nil. Values which can't be decoded leave no
+// rows, they're reported by Fsck.
+func (s *sqlSchema) project(c sqlConn, key ds.Key, value []byte) error {
+	r, ok := parseSQLRow(key)
+	if !ok {
+		return nil
+	}
+	ctx := context.Background()
+	switch r.book {
+	case "heads":
+		if _, err := c.ExecContext(ctx, s.deleteHeads, r.namespace, r.thread, r.log); err != nil {
+			return fmt.Errorf("projecting %s: %w", key, err)
+		}
+		var hr pb.HeadBookRecord
+		if value == nil || proto.Unmarshal(value, &hr) != nil {
+			return nil
+		}
+		for _, h := range hr.Heads {
+			if h.Cid == nil || !h.Cid.Defined() {
+				continue
+			}
+			if _, err := c.ExecContext(ctx, s.insertHead, r.namespace, r.thread, r.log, h.Cid.String()); err != nil {
+				return fmt.Errorf("projecting %s: %w", key, err)
+			}
+		}
+	case "addrs":
+		if _, err := c.ExecContext(ctx, s.deleteAddrs, r.namespace, r.thread, r.log); err != nil {
+			return fmt.Errorf("projecting %s: %w", key, err)
+		}
+		var ar pb.AddrBookRecord
+		if value == nil || proto.Unmarshal(value, &ar) != nil {
+			return nil
+		}
+		seen := make(map[string]struct{}, len(ar.Addrs))
+		for _, a := range ar.Addrs {
+			if a.Addr == nil || a.Addr.Multiaddr == nil {
+				continue
+			}
+			addr := a.Addr.String()
+			if _, ok := seen[addr]; ok {
+				continue
+			}
+			seen[addr] = struct{}{}
+			if _, err := c.ExecContext(ctx, s.insertAddr, r.namespace, r.thread, r.log, addr, time.Unix(a.Expiry, 0).UTC(), a.Source); err != nil {
+				return fmt.Errorf("projecting %s: %w", key, err)
+			}
+		}
+	case "keys":
+		if _, err := c.ExecContext(ctx, s.deleteKey, r.namespace, r.thread, r.log, r.kind); err != nil {
+			return fmt.Errorf("projecting %s: %w", key, err)
+		}
+		if value == nil {
+			return nil
+		}
+		// secrets stay in the key-value table
+		var pub []byte
+		if r.kind == pubSuffix.Name() {
+			pub = value
+		}
+		if _, err := c.ExecContext(ctx, s.insertKey, r.namespace, r.thread, r.log, r.kind, pub); err != nil {
+			return fmt.Errorf("projecting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// rebuild projects all entries of the key-value table, e.g. of a database
+// written before the tables existed.
+func (s *sqlSchema) rebuild(tx *sql.Tx, table string) error {
+	ctx := context.Background()
+	for _, t := range []string{s.heads, s.addrs, s.keys} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+t); err != nil {
+			return fmt.Errorf("clearing %s: %w", t, err)
+		}
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT key, value FROM %s", table))
+	if err != nil {
+		return fmt.Errorf("querying %s: %w", table, err)
+	}
+	type entry struct {
+		key   string
+		value []byte
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.key, &e.value); err != nil {
+			rows.Close()
+			return fmt.Errorf("querying %s: %w", table, err)
+		}
+		if _, ok := parseSQLRow(ds.RawKey(e.key)); ok {
+			entries = append(entries, e)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("querying %s: %w", table, err)
+	}
+	for _, e := range entries {
+		if err := s.project(tx, ds.RawKey(e.key), e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package lstoreds
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// SQLDialect selects the flavor of SQL spoken by the database.
+type SQLDialect int
+
+const (
+	// SQLite is the dialect of SQLite 3.24 and later.
+	SQLite SQLDialect = iota
+
+	// Postgres is the dialect of PostgreSQL 9.5 and later.
+	Postgres
+)
+
+// DefaultSQLTable is the table storing entries if SQLOptions.Table isn't set.
+var DefaultSQLTable = "threadstore"
+
+var sqlTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (d SQLDialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite"
+	case Postgres:
+		return "postgres"
+	default:
+		return fmt.Sprintf("SQLDialect(%d)", int(d))
+	}
+}
+
+// SQLOptions configures a SQLDatastore.
+type SQLOptions struct {
+	// Dialect of the database.
+	Dialect SQLDialect
+
+	// Table storing entries, created if missing. A value of "" selects
+	// DefaultSQLTable.
+	Table string
+}
+
+// SQLDatastore persists a datastore to a SQL database, e.g. one of an
+// existing Postgres deployment. Entries of the logstore are kept in a
+// key-value table, and heads, addresses and keys of threads are modeled in
+// relational tables next to it, written in the same SQL transactions, so
+// that operators can query threads with SQL. With the default table name,
+// the schema is
+//
+//	-- encoded entries by datastore key, e.g. /thread/heads/<thread>/<log>
+//	-- with base32 encoded IDs; BLOB instead of BYTEA on SQLite
+//	CREATE TABLE threadstore (
+//		key   TEXT PRIMARY KEY,
+//		value BYTEA NOT NULL
+//	);
+//
+//	-- heads of logs
+//	CREATE TABLE threadstore_heads (
+//		namespace TEXT NOT NULL, -- "" outside of namespaces
+//		thread    TEXT NOT NULL, -- thread ID, e.g. bafk...
+//		log       TEXT NOT NULL, -- log ID, e.g. 12D3KooW...
+//		cid       TEXT NOT NULL,
+//		PRIMARY KEY (namespace, thread, log, cid)
+//	);
+//
+//	-- addresses of logs, kept until they're collected after expiring
+//	CREATE TABLE threadstore_addrs (
+//		namespace TEXT NOT NULL,
+//		thread    TEXT NOT NULL,
+//		log       TEXT NOT NULL,
+//		addr      TEXT NOT NULL, -- multiaddr, e.g. /ip4/1.2.3.4/tcp/4006
+//		expires   TIMESTAMP NOT NULL, -- UTC
+//		source    TEXT NOT NULL, -- how the address was learned, if known
+//		PRIMARY KEY (namespace, thread, log, addr)
+//	);
+//
+//	-- keys of threads, with log "", and of logs
+//	CREATE TABLE threadstore_keys (
+//		namespace TEXT NOT NULL,
+//		thread    TEXT NOT NULL,
+//		log       TEXT NOT NULL,
+//		kind      TEXT NOT NULL, -- pub, priv or revoked for logs,
+//		                         -- read or service for threads
+//		value     BYTEA, -- public key as stored, NULL for secrets
+//		PRIMARY KEY (namespace, thread, log, kind)
+//	);
+//
+//	-- logs and threads having any of the above
+//	CREATE VIEW threadstore_logs AS ...;    -- (namespace, thread, log)
+//	CREATE VIEW threadstore_threads AS ...; -- (namespace, thread)
+//
+// The relational tables are read-only views of the logstore: writes must go
+// through it, and the tables are rebuilt from the key-value table when
+// they're created. Secrets stay in the key-value table only. Transactions
+// and batches map to SQL transactions, so writes of the logstore are
+// atomic. Transactions run with serializable isolation, failing on
+// conflicts with concurrent ones.
+type SQLDatastore struct {
+	db      *sql.DB
+	dialect SQLDialect
+	schema  *sqlSchema
+
+	getStmt    string
+	putStmt    string
+	deleteStmt string
+	queryStmt  string
+}
+
+var (
+	_ ds.Batching     = (*SQLDatastore)(nil)
+	_ ds.TxnDatastore = (*SQLDatastore)(nil)
+)
+
+// sqlConn is satisfied by *sql.DB and *sql.Tx.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewSQLDatastore creates a datastore backed by the database, creating its
+// table if missing. The database is owned by the caller, and isn't closed
+// with the datastore.
+func NewSQLDatastore(db *sql.DB, opts SQLOptions) (*SQLDatastore, error) {
+	table := opts.Table
+	if table == "" {
+		table = DefaultSQLTable
+	}
+	if !sqlTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+
+	var blob, arg1, arg2 string
+	switch opts.Dialect {
+	case SQLite:
+		blob, arg1, arg2 = "BLOB", "?", "?"
+	case Postgres:
+		blob, arg1, arg2 = "BYTEA", "$1", "$2"
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect: %s", opts.Dialect)
+	}
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (key TEXT PRIMARY KEY, value %s NOT NULL)", table, blob)
+	if _, err := db.Exec(create); err != nil {
+		return nil, fmt.Errorf("creating table %s: %w", table, err)
+	}
+	schema, created, err := newSQLSchema(db, table, opts.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLDatastore{
+		db:         db,
+		dialect:    opts.Dialect,
+		schema:     schema,
+		getStmt:    fmt.Sprintf("SELECT value FROM %s WHERE key = %s", table, arg1),
+		putStmt:    fmt.Sprintf("INSERT INTO %s (key, value) VALUES (%s, %s) ON CONFLICT (key) DO UPDATE SET value = excluded.value", table, arg1, arg2),
+		deleteStmt: fmt.Sprintf("DELETE FROM %s WHERE key = %s", table, arg1),
+		queryStmt:  fmt.Sprintf(`SELECT key, value FROM %s WHERE key LIKE %s ESCAPE '\' ORDER BY key`, table, arg1),
+	}
+	if created {
+		if err := s.inTxn(func(tx *sql.Tx) error { return schema.rebuild(tx, table) }); err != nil {
+			return nil, fmt.Errorf("building schema of %s: %w", table, err)
+		}
+	}
+	return s, nil
+}
+
+// inTxn runs f in a SQL transaction, committing it if f succeeds.
+func (s *SQLDatastore) inTxn(f func(*sql.Tx) error) error {
+	tx, err := s.begin(false)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLDatastore) Get(key ds.Key) ([]byte, error) {
+	return s.get(s.db, key)
+}
+
+func (s *SQLDatastore) get(c sqlConn, key ds.Key) ([]byte, error) {
+	var value []byte
+	err := c.QueryRowContext(context.Background(), s.getStmt, key.String()).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, ds.ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (s *SQLDatastore) Has(key ds.Key) (bool, error) {
+	return s.has(s.db, key)
+}
+
+func (s *SQLDatastore) has(c sqlConn, key ds.Key) (bool, error) {
+	_, err := s.get(c, key)
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SQLDatastore) GetSize(key ds.Key) (int, error) {
+	return s.getSize(s.db, key)
+}
+
+func (s *SQLDatastore) getSize(c sqlConn, key ds.Key) (int, error) {
+	value, err := s.get(c, key)
+	if err != nil {
+		return -1, err
+	}
+	return len(value), nil
+}
+
+func (s *SQLDatastore) Query(q query.Query) (query.Results, error) {
+	return s.query(s.db, q)
+}
+
+// query selects rows with keys under the prefix and applies the rest of the
+// query to them. Rows are streamed from the database, holding a connection
+// until the results are closed. Transactions run on a single connection,
+// which some drivers can't share between a cursor and other statements, so
+// their rows are read upfront.
+func (s *SQLDatastore) query(c sqlConn, q query.Query) (query.Results, error) {
+	prefix := ds.NewKey(q.Prefix).String()
+	if prefix != "/" {
+		prefix += "/"
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	rows, err := c.QueryContext(context.Background(), s.queryStmt, escaper.Replace(prefix)+"%")
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", prefix, err)
+	}
+
+	var done bool
+	next := func() (query.Result, bool) {
+		if done {
+			return query.Result{}, false
+		}
+		if !rows.Next() {
+			done = true
+			if err := rows.Err(); err != nil {
+				return query.Result{Error: fmt.Errorf("querying %s: %w", prefix, err)}, true
+			}
+			return query.Result{}, false
+		}
+		var e query.Entry
+		if err := rows.Scan(&e.Key, &e.Value); err != nil {
+			done = true
+			return query.Result{Error: fmt.Errorf("querying %s: %w", prefix, err)}, true
+		}
+		e.Size = len(e.Value)
+		if q.KeysOnly {
+			e.Value = nil
+		}
+		return query.Result{Entry: e}, true
+	}
+
+	var results query.Results
+	if _, ok := c.(*sql.Tx); ok {
+		defer rows.Close()
+		var entries []query.Entry
+		for {
+			r, ok := next()
+			if !ok {
+				break
+			}
+			if r.Error != nil {
+				return nil, r.Error
+			}
+			entries = append(entries, r.Entry)
+		}
+		results = query.ResultsWithEntries(q, entries)
+	} else {
+		results = query.ResultsFromIterator(q, query.Iterator{Next: next, Close: rows.Close})
+	}
+	// LIKE may be case-insensitive, so prefixes are checked again
+	return query.NaiveQueryApply(q, results), nil
+}
+
+// Put writes the entry along with its relational rows, if any, atomically.
+func (s *SQLDatastore) Put(key ds.Key, value []byte) error {
+	if _, ok := parseSQLRow(key); ok {
+		return s.inTxn(func(tx *sql.Tx) error { return s.put(tx, key, value) })
+	}
+	return s.put(s.db, key, value)
+}
+
+func (s *SQLDatastore) put(c sqlConn, key ds.Key, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	if _, err := c.ExecContext(context.Background(), s.putStmt, key.String(), value); err != nil {
+		return fmt.Errorf("putting %s: %w", key, err)
+	}
+	return s.schema.project(c, key, value)
+}
+
+// Delete removes the entry along with its relational rows, if any,
+// atomically.
+func (s *SQLDatastore) Delete(key ds.Key) error {
+	if _, ok := parseSQLRow(key); ok {
+		return s.inTxn(func(tx *sql.Tx) error { return s.delete(tx, key) })
+	}
+	return s.delete(s.db, key)
+}
+
+func (s *SQLDatastore) delete(c sqlConn, key ds.Key) error {
+	if _, err := c.ExecContext(context.Background(), s.deleteStmt, key.String()); err != nil {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	return s.schema.project(c, key, nil)
+}
+
+// Sync is a no-op, as committed writes are durable.
+func (s *SQLDatastore) Sync(ds.Key) error {
+	return nil
+}
+
+// Close is a no-op, as the database is owned by the caller.
+func (s *SQLDatastore) Close() error {
+	return nil
+}
+
+func (s *SQLDatastore) begin(readOnly bool) (*sql.Tx, error) {
+	opts := &sql.TxOptions{ReadOnly: readOnly}
+	if s.dialect == Postgres {
+		// SQLite transactions are always serializable
+		opts.Isolation = sql.LevelSerializable
+	}
+	return s.db.BeginTx(context.Background(), opts)
+}
+
+func (s *SQLDatastore) Batch() (ds.Batch, error) {
+	return &sqlBatch{s: s}, nil
+}
+
+type sqlBatch struct {
+	s   *SQLDatastore
+	ops []func(sqlConn) error
+}
+
+func (b *sqlBatch) Put(key ds.Key, value []byte) error {
+	value = append([]byte(nil), value...)
+	b.ops = append(b.ops, func(c sqlConn) error { return b.s.put(c, key, value) })
+	return nil
+}
+
+func (b *sqlBatch) Delete(key ds.Key) error {
+	b.ops = append(b.ops, func(c sqlConn) error { return b.s.delete(c, key) })
+	return nil
+}
+
+func (b *sqlBatch) Commit() error {
+	err := b.s.inTxn(func(tx *sql.Tx) error {
+		for _, op := range b.ops {
+			if err := op(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.ops = nil
+	return nil
+}
+
+func (s *SQLDatastore) NewTransaction(readOnly bool) (ds.Txn, error) {
+	tx, err := s.begin(readOnly)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	return &sqlTxn{s: s, tx: tx}, nil
+}
+
+type sqlTxn struct {
+	s  *SQLDatastore
+	tx *sql.Tx
+}
+
+func (t *sqlTxn) Get(key ds.Key) ([]byte, error) {
+	return t.s.get(t.tx, key)
+}
+
+func (t *sqlTxn) Has(key ds.Key) (bool, error) {
+	return t.s.has(t.tx, key)
+}
+
+func (t *sqlTxn) GetSize(key ds.Key) (int, error) {
+	return t.s.getSize(t.tx, key)
+}
+
+func (t *sqlTxn) Query(q query.Query) (query.Results, error) {
+	return t.s.query(t.tx, q)
+}
+
+func (t *sqlTxn) Put(key ds.Key, value []byte) error {
+	return t.s.put(t.tx, key, value)
+}
+
+func (t *sqlTxn) Delete(key ds.Key) error {
+	return t.s.delete(t.tx, key)
+}
+
+func (t *sqlTxn) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTxn) Discard() {
+	_ = t.tx.Rollback()
+}
@@ -0,0 +1,553 @@
+package lstorehybrid
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+)
+
+var log = logging.Logger("lstorehybrid")
+
+// NewCachedLogstore creates a logstore reading keys, addresses and heads of
+// threads through an in-memory logstore bounded by bounds. Unlike the hybrid
+// logstore, threads are loaded from the persistent logstore on first read
+// instead of on start. Writes go to the persistent logstore, after which
+// cached heads are refreshed and other cached entries of the thread are
+// dropped, so that they are loaded again on next read.
+//
+// All other reads and writes go straight to the persistent logstore, which
+// must not be written to otherwise while the cache is in use.
+func NewCachedLogstore(persist core.Logstore, bounds lstoremem.Bounds) core.Logstore {
+	c := &cachedLogstore{Logstore: persist, loaded: make(map[thread.ID]struct{})}
+	onEvict := bounds.OnEvict
+	bounds.OnEvict = func(id thread.ID) {
+		// memory is changed only with the lock held
+		delete(c.loaded, id)
+		if onEvict != nil {
+			onEvict(id)
+		}
+	}
+	c.mem = lstoremem.NewBoundedLogstore(bounds)
+	return c
+}
+
+// cachedLogstore passes calls through to the persistent logstore, except
+// for cached reads. Writes added to core.Logstore changing keys, addresses
+// or heads must be overridden here.
+type cachedLogstore struct {
+	core.Logstore
+	mem core.Logstore
+
+	// lock is held exclusively when changing memory, and shared when
+	// reading from it. Loads are dropped if the generation of the thread is
+	// bumped meanwhile by a write.
+	lock   sync.RWMutex
+	loaded map[thread.ID]struct{}
+	gens   [256]uint64
+}
+
+var (
+	_ core.Logstore    = (*cachedLogstore)(nil)
+	_ core.Wrapper     = (*cachedLogstore)(nil)
+	_ core.Inviter     = (*cachedLogstore)(nil)
+	_ core.Snapshotter = (*cachedLogstore)(nil)
+	_ core.Transactor  = (*cachedLogstore)(nil)
+)
+
+// Unwrap returns the persistent logstore, which serves optional
+// capabilities not changing keys, addresses or heads.
+func (c *cachedLogstore) Unwrap() core.Logstore { return c.Logstore }
+
+func genIndex(id thread.ID) int {
+	if len(id) == 0 {
+		return 0
+	}
+	return int(id[len(id)-1])
+}
+
+// read calls fn with the in-memory logstore if the thread is cached or can
+// be loaded, and with the persistent one otherwise.
+func (c *cachedLogstore) read(id thread.ID, fn func(core.Logstore) error) error {
+	c.lock.RLock()
+	if _, ok := c.loaded[id]; ok {
+		defer c.lock.RUnlock()
+		return fn(c.mem)
+	}
+	gen := c.gens[genIndex(id)]
+	c.lock.RUnlock()
+
+	data, err := c.Logstore.ExportThread(id)
+	if errors.Is(err, core.ErrThreadNotFound) {
+		return fn(c.Logstore)
+	} else if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	if _, ok := c.loaded[id]; !ok && c.gens[genIndex(id)] == gen {
+		if err := c.load(id, data); err != nil {
+			log.Errorf("error caching thread %s: %v", id, err)
+		}
+	}
+	c.lock.Unlock()
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if _, ok := c.loaded[id]; ok {
+		return fn(c.mem)
+	}
+	return fn(c.Logstore)
+}
+
+// load replaces the thread in memory with the exported one. The lock must
+// be held.
+func (c *cachedLogstore) load(id thread.ID, data []byte) error {
+	if err := c.mem.DeleteThread(id); err != nil {
+		return err
+	}
+	if err := c.mem.ImportThread(data); err != nil {
+		_ = c.mem.DeleteThread(id)
+		return err
+	}
+	c.loaded[id] = struct{}{}
+	return nil
+}
+
+// invalidate drops the thread from memory after a write to it.
+func (c *cachedLogstore) invalidate(id thread.ID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.drop(id)
+}
+
+// drop removes the thread from memory. The lock must be held.
+func (c *cachedLogstore) drop(id thread.ID) {
+	c.gens[genIndex(id)]++
+	if _, ok := c.loaded[id]; !ok {
+		return
+	}
+	delete(c.loaded, id)
+	if err := c.mem.DeleteThread(id); err != nil {
+		log.Errorf("error dropping cached thread %s: %v", id, err)
+	}
+}
+
+// invalidateAll drops all threads from memory after a write that may touch
+// any of them.
+func (c *cachedLogstore) invalidateAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for id := range c.loaded {
+		c.drop(id)
+	}
+	for i := range c.gens {
+		c.gens[i]++
+	}
+}
+
+// refreshHeads copies heads of the log from the persistent logstore to
+// memory after a write, so that concurrent writes are applied in order.
+func (c *cachedLogstore) refreshHeads(id thread.ID, lid thread.LogID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.gens[genIndex(id)]++
+	if _, ok := c.loaded[id]; !ok {
+		return
+	}
+	heads, err := c.Logstore.Heads(id, lid)
+	if err == nil {
+		if len(heads) == 0 {
+			err = c.mem.ClearHeads(id, lid)
+		} else {
+			err = c.mem.SetHeads(id, lid, heads)
+		}
+	}
+	if err != nil {
+		log.Errorf("error refreshing cached heads of log %s: %v", lid, err)
+		c.drop(id)
+	}
+}
+
+func (c *cachedLogstore) Close() error {
+	if err := c.Logstore.Close(); err != nil {
+		return err
+	}
+	return c.mem.Close()
+}
+
+/* cached reads */
+
+func (c *cachedLogstore) PubKey(tid thread.ID, lid thread.LogID) (pk crypto.PubKey, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		pk, err = ls.PubKey(tid, lid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) PrivKey(tid thread.ID, lid thread.LogID) (sk crypto.PrivKey, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		sk, err = ls.PrivKey(tid, lid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) HasPrivKey(tid thread.ID, lid thread.LogID) (ok bool, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		ok, err = ls.HasPrivKey(tid, lid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) IsRevoked(tid thread.ID, lid thread.LogID) (ok bool, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		ok, err = ls.IsRevoked(tid, lid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) ReadKey(tid thread.ID) (k *sym.Key, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		k, err = ls.ReadKey(tid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) HasReadKey(tid thread.ID) (ok bool, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		ok, err = ls.HasReadKey(tid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) ServiceKey(tid thread.ID) (k *sym.Key, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		k, err = ls.ServiceKey(tid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) HasServiceKey(tid thread.ID) (ok bool, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		ok, err = ls.HasServiceKey(tid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) LogsWithKeys(tid thread.ID) (ids thread.LogIDSlice, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		ids, err = ls.LogsWithKeys(tid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) Addrs(tid thread.ID, lid thread.LogID) (addrs []ma.Multiaddr, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		addrs, err = ls.Addrs(tid, lid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) ForEachLogAddr(tid thread.ID, lid thread.LogID, fn func(ma.Multiaddr) bool) error {
+	return c.read(tid, func(ls core.Logstore) error {
+		return ls.ForEachLogAddr(tid, lid, fn)
+	})
+}
+
+func (c *cachedLogstore) LogsWithAddrs(tid thread.ID) (ids thread.LogIDSlice, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		ids, err = ls.LogsWithAddrs(tid)
+		return
+	})
+	return
+}
+
+func (c *cachedLogstore) Heads(tid thread.ID, lid thread.LogID) (heads []cid.Cid, err error) {
+	err = c.read(tid, func(ls core.Logstore) (err error) {
+		heads, err = ls.Heads(tid, lid)
+		return
+	})
+	return
+}
+
+/* writes of heads */
+
+func (c *cachedLogstore) AddHead(tid thread.ID, lid thread.LogID, head cid.Cid) error {
+	defer c.refreshHeads(tid, lid)
+	return c.Logstore.AddHead(tid, lid, head)
+}
+
+func (c *cachedLogstore) AddHeads(tid thread.ID, lid thread.LogID, heads []cid.Cid) error {
+	defer c.refreshHeads(tid, lid)
+	return c.Logstore.AddHeads(tid, lid, heads)
+}
+
+func (c *cachedLogstore) SetHead(tid thread.ID, lid thread.LogID, head cid.Cid) error {
+	defer c.refreshHeads(tid, lid)
+	return c.Logstore.SetHead(tid, lid, head)
+}
+
+func (c *cachedLogstore) SetHeads(tid thread.ID, lid thread.LogID, heads []cid.Cid) error {
+	defer c.refreshHeads(tid, lid)
+	return c.Logstore.SetHeads(tid, lid, heads)
+}
+
+func (c *cachedLogstore) ClearHeads(tid thread.ID, lid thread.LogID) error {
+	defer c.refreshHeads(tid, lid)
+	return c.Logstore.ClearHeads(tid, lid)
+}
+
+/* writes of a thread */
+
+func (c *cachedLogstore) AddThread(info thread.Info) error {
+	defer c.invalidate(info.ID)
+	return c.Logstore.AddThread(info)
+}
+
+func (c *cachedLogstore) DeleteThread(tid thread.ID) error {
+	defer c.invalidate(tid)
+	return c.Logstore.DeleteThread(tid)
+}
+
+func (c *cachedLogstore) AddLog(tid thread.ID, lg thread.LogInfo) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddLog(tid, lg)
+}
+
+func (c *cachedLogstore) DeleteLog(tid thread.ID, lid thread.LogID) error {
+	defer c.invalidate(tid)
+	return c.Logstore.DeleteLog(tid, lid)
+}
+
+func (c *cachedLogstore) ArchiveThread(tid thread.ID, store ds.Datastore) error {
+	defer c.invalidate(tid)
+	return c.Logstore.ArchiveThread(tid, store)
+}
+
+func (c *cachedLogstore) UnarchiveThread(tid thread.ID, store ds.Datastore) error {
+	defer c.invalidate(tid)
+	return c.Logstore.UnarchiveThread(tid, store)
+}
+
+func (c *cachedLogstore) Archive(tid thread.ID, w io.Writer) error {
+	defer c.invalidate(tid)
+	return c.Logstore.Archive(tid, w)
+}
+
+func (c *cachedLogstore) AddPubKey(tid thread.ID, lid thread.LogID, pk crypto.PubKey) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddPubKey(tid, lid, pk)
+}
+
+func (c *cachedLogstore) RevokePubKey(tid thread.ID, lid thread.LogID) error {
+	defer c.invalidate(tid)
+	return c.Logstore.RevokePubKey(tid, lid)
+}
+
+func (c *cachedLogstore) AddPrivKey(tid thread.ID, lid thread.LogID, sk crypto.PrivKey) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddPrivKey(tid, lid, sk)
+}
+
+func (c *cachedLogstore) AddReadKey(tid thread.ID, key *sym.Key) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddReadKey(tid, key)
+}
+
+func (c *cachedLogstore) AddServiceKey(tid thread.ID, key *sym.Key) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddServiceKey(tid, key)
+}
+
+func (c *cachedLogstore) RotateReadKey(tid thread.ID, key *sym.Key) (int, error) {
+	defer c.invalidate(tid)
+	return c.Logstore.RotateReadKey(tid, key)
+}
+
+func (c *cachedLogstore) RotateServiceKey(tid thread.ID, key *sym.Key) (int, error) {
+	defer c.invalidate(tid)
+	return c.Logstore.RotateServiceKey(tid, key)
+}
+
+func (c *cachedLogstore) ClearKeys(tid thread.ID) error {
+	defer c.invalidate(tid)
+	return c.Logstore.ClearKeys(tid)
+}
+
+func (c *cachedLogstore) ClearLogKeys(tid thread.ID, lid thread.LogID) error {
+	defer c.invalidate(tid)
+	return c.Logstore.ClearLogKeys(tid, lid)
+}
+
+func (c *cachedLogstore) AddAddr(tid thread.ID, lid thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddAddr(tid, lid, addr, ttl)
+}
+
+func (c *cachedLogstore) AddAddrs(tid thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddAddrs(tid, lid, addrs, ttl)
+}
+
+func (c *cachedLogstore) AddAddrsFromSource(tid thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) error {
+	defer c.invalidate(tid)
+	return c.Logstore.AddAddrsFromSource(tid, lid, addrs, ttl, src)
+}
+
+func (c *cachedLogstore) ConsumeLogRecord(tid thread.ID, rec *record.Envelope, ttl time.Duration) (bool, error) {
+	defer c.invalidate(tid)
+	return c.Logstore.ConsumeLogRecord(tid, rec, ttl)
+}
+
+func (c *cachedLogstore) SetAddr(tid thread.ID, lid thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	defer c.invalidate(tid)
+	return c.Logstore.SetAddr(tid, lid, addr, ttl)
+}
+
+func (c *cachedLogstore) SetAddrs(tid thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	defer c.invalidate(tid)
+	return c.Logstore.SetAddrs(tid, lid, addrs, ttl)
+}
+
+func (c *cachedLogstore) UpdateAddrs(tid thread.ID, lid thread.LogID, oldTTL time.Duration, newTTL time.Duration) error {
+	defer c.invalidate(tid)
+	return c.Logstore.UpdateAddrs(tid, lid, oldTTL, newTTL)
+}
+
+func (c *cachedLogstore) ClearAddrs(tid thread.ID, lid thread.LogID) error {
+	defer c.invalidate(tid)
+	return c.Logstore.ClearAddrs(tid, lid)
+}
+
+/* writes of any thread */
+
+func (c *cachedLogstore) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	defer c.invalidateAll()
+	return c.Logstore.AddLogAddrsBulk(entries, ttl)
+}
+
+func (c *cachedLogstore) ReplaceAddr(old, repl ma.Multiaddr, ttl time.Duration) ([]core.ThreadLog, error) {
+	defer c.invalidateAll()
+	return c.Logstore.ReplaceAddr(old, repl, ttl)
+}
+
+func (c *cachedLogstore) ImportThread(data []byte) error {
+	defer c.invalidateAll()
+	return c.Logstore.ImportThread(data)
+}
+
+func (c *cachedLogstore) ImportKeys(bundle []byte, passphrase string) error {
+	defer c.invalidateAll()
+	return c.Logstore.ImportKeys(bundle, passphrase)
+}
+
+func (c *cachedLogstore) CreateInvite(tid thread.ID, withReadKey bool, password string) ([]byte, error) {
+	inv, err := core.Invites(c.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return inv.CreateInvite(tid, withReadKey, password)
+}
+
+func (c *cachedLogstore) AcceptInvite(invite []byte, passphrase string) (thread.Info, error) {
+	inv, err := core.Invites(c.Logstore)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	defer c.invalidateAll()
+	return inv.AcceptInvite(invite, passphrase)
+}
+
+func (c *cachedLogstore) Snapshot(w io.Writer) error {
+	sn, err := core.Snapshots(c.Logstore)
+	if err != nil {
+		return err
+	}
+	return sn.Snapshot(w)
+}
+
+func (c *cachedLogstore) Restore(r io.Reader) error {
+	sn, err := core.Snapshots(c.Logstore)
+	if err != nil {
+		return err
+	}
+	defer c.invalidateAll()
+	return sn.Restore(r)
+}
+
+func (c *cachedLogstore) Unarchive(r io.Reader) (thread.ID, error) {
+	defer c.invalidateAll()
+	return c.Logstore.Unarchive(r)
+}
+
+func (c *cachedLogstore) RestoreKeys(dump core.DumpKeyBook) error {
+	defer c.invalidateAll()
+	return c.Logstore.RestoreKeys(dump)
+}
+
+func (c *cachedLogstore) RestoreAddrs(dump core.DumpAddrBook) error {
+	defer c.invalidateAll()
+	return c.Logstore.RestoreAddrs(dump)
+}
+
+func (c *cachedLogstore) RestoreHeads(dump core.DumpHeadBook) error {
+	defer c.invalidateAll()
+	return c.Logstore.RestoreHeads(dump)
+}
+
+func (c *cachedLogstore) Batch() core.Batch {
+	return &cachedBatch{Batch: c.Logstore.Batch(), c: c}
+}
+
+type cachedBatch struct {
+	core.Batch
+	c *cachedLogstore
+}
+
+func (b *cachedBatch) Commit() error {
+	defer b.c.invalidateAll()
+	return b.Batch.Commit()
+}
+
+func (c *cachedLogstore) BeginTxn(readonly bool) (core.Txn, error) {
+	tr, err := core.Transactions(c.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := tr.BeginTxn(readonly)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedTxn{Txn: tx, c: c}, nil
+}
+
+type cachedTxn struct {
+	core.Txn
+	c *cachedLogstore
+}
+
+func (tx *cachedTxn) Commit() error {
+	defer tx.c.invalidateAll()
+	return tx.Txn.Commit()
+}
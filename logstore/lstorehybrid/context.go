@@ -0,0 +1,74 @@
+package lstorehybrid
+
+import (
+	"context"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+var _ core.ContextLogstore = (*lstore)(nil)
+
+// Writes are not interrupted once started, otherwise the persistent and the
+// in-memory storages may become inconsistent.
+
+// WithContext returns a view of the logstore writing to the persistent
+// storage bound to ctx. A write stopped by ctx never reaches the in-memory
+// storage, like a failed one. Reads are served from memory without
+// blocking and ignore ctx.
+func (l *lstore) WithContext(ctx context.Context) core.Logstore {
+	persist := l.persist
+	if cls, ok := persist.(core.ContextLogstore); ok {
+		persist = cls.WithContext(ctx)
+	}
+	return &lstore{inMem: l.inMem, persist: persist}
+}
+
+func (l *lstore) ThreadsContext(ctx context.Context) (thread.IDSlice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.Threads()
+}
+
+func (l *lstore) AddThreadContext(ctx context.Context, info thread.Info) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.AddThread(info)
+}
+
+func (l *lstore) GetThreadContext(ctx context.Context, tid thread.ID) (thread.Info, error) {
+	if err := ctx.Err(); err != nil {
+		return thread.Info{}, err
+	}
+	return l.GetThread(tid)
+}
+
+func (l *lstore) DeleteThreadContext(ctx context.Context, tid thread.ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.DeleteThread(tid)
+}
+
+func (l *lstore) AddLogContext(ctx context.Context, tid thread.ID, lg thread.LogInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.AddLog(tid, lg)
+}
+
+func (l *lstore) GetLogContext(ctx context.Context, tid thread.ID, lid thread.LogID) (thread.LogInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return thread.LogInfo{}, err
+	}
+	return l.GetLog(tid, lid)
+}
+
+func (l *lstore) DeleteLogContext(ctx context.Context, tid thread.ID, lid thread.LogID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.DeleteLog(tid, lid)
+}
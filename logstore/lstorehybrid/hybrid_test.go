@@ -1,13 +1,22 @@
 package lstorehybrid
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
 	badger "github.com/ipfs/go-ds-badger"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	mh "github.com/multiformats/go-multihash"
 	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
 	"github.com/textileio/go-threads/logstore/lstoreds"
 	m "github.com/textileio/go-threads/logstore/lstoremem"
 	pt "github.com/textileio/go-threads/test"
@@ -28,6 +37,7 @@ var (
 func TestHybridLogstore(t *testing.T) {
 	for psName, psF := range persist {
 		for msName, msF := range inMem {
+			msF := msF
 			t.Run(psName+"+"+msName, func(t *testing.T) {
 				t.Parallel()
 				pt.LogstoreTest(t, logstoreFactory(t, psF, msF))
@@ -39,6 +49,7 @@ func TestHybridLogstore(t *testing.T) {
 func TestHybridAddrBook(t *testing.T) {
 	for psName, psF := range persist {
 		for msName, msF := range inMem {
+			msF := msF
 			t.Run(psName+"+"+msName, func(t *testing.T) {
 				t.Parallel()
 				pt.AddrBookTest(t, adapterAddrBook(logstoreFactory(t, psF, msF)))
@@ -50,6 +61,7 @@ func TestHybridAddrBook(t *testing.T) {
 func TestHybridKeyBook(t *testing.T) {
 	for psName, psF := range persist {
 		for msName, msF := range inMem {
+			msF := msF
 			t.Run(psName+"+"+msName, func(t *testing.T) {
 				t.Parallel()
 				pt.KeyBookTest(t, adapterKeyBook(logstoreFactory(t, psF, msF)))
@@ -61,6 +73,7 @@ func TestHybridKeyBook(t *testing.T) {
 func TestHybridHeadBook(t *testing.T) {
 	for psName, psF := range persist {
 		for msName, msF := range inMem {
+			msF := msF
 			t.Run(psName+"+"+msName, func(t *testing.T) {
 				t.Parallel()
 				pt.HeadBookTest(t, adapterHeadBook(logstoreFactory(t, psF, msF)))
@@ -72,6 +85,7 @@ func TestHybridHeadBook(t *testing.T) {
 func TestHybridMetadataBook(t *testing.T) {
 	for psName, psF := range persist {
 		for msName, msF := range inMem {
+			msF := msF
 			t.Run(psName+"+"+msName, func(t *testing.T) {
 				t.Parallel()
 				pt.MetadataBookTest(t, adapterMetaBook(logstoreFactory(t, psF, msF)))
@@ -80,8 +94,175 @@ func TestHybridMetadataBook(t *testing.T) {
 	}
 }
 
+func TestCachedLogstore(t *testing.T) {
+	for psName, psF := range persist {
+		psF := psF
+		t.Run(psName, func(t *testing.T) {
+			t.Parallel()
+			pt.LogstoreTest(t, cachedFactory(t, psF, m.Bounds{}))
+		})
+	}
+}
+
+func TestCachedLogstoreBooks(t *testing.T) {
+	for psName, psF := range persist {
+		t.Run(psName, func(t *testing.T) {
+			// evict often to exercise loading
+			f := cachedFactory(t, psF, m.Bounds{MaxThreads: 2})
+			t.Run("AddrBook", func(t *testing.T) { pt.AddrBookTest(t, adapterAddrBook(f)) })
+			t.Run("KeyBook", func(t *testing.T) { pt.KeyBookTest(t, adapterKeyBook(f)) })
+			t.Run("HeadBook", func(t *testing.T) { pt.HeadBookTest(t, adapterHeadBook(f)) })
+			t.Run("MetadataBook", func(t *testing.T) { pt.MetadataBookTest(t, adapterMetaBook(f)) })
+		})
+	}
+}
+
+func TestCachedLogstoreReadThrough(t *testing.T) {
+	ps, psClose := lstoredsBadgerF(t)
+	defer psClose()
+	var evicted []thread.ID
+	ls := NewCachedLogstore(ps, m.Bounds{
+		MaxThreads: 1,
+		OnEvict:    func(id thread.ID) { evicted = append(evicted, id) },
+	})
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	sk, pk, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lid, err := thread.NewLogID(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var heads []cid.Cid
+	for _, data := range []string{"a", "b"} {
+		hash, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		heads = append(heads, cid.NewCidV1(cid.DagCBOR, hash))
+	}
+	if err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk, Head: heads[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if hs, err := ls.Heads(tid, lid); err != nil || len(hs) != 1 || !hs[0].Equals(heads[0]) {
+		t.Fatalf("expected head %s, got %v (err: %v)", heads[0], hs, err)
+	}
+
+	// loaded threads are read from memory
+	if err := ps.ClearHeads(tid, lid); err != nil {
+		t.Fatal(err)
+	}
+	if hs, err := ls.Heads(tid, lid); err != nil || len(hs) != 1 {
+		t.Fatalf("expected cached head, got %v (err: %v)", hs, err)
+	}
+
+	// writes are seen by following reads
+	if err := ls.SetHead(tid, lid, heads[1]); err != nil {
+		t.Fatal(err)
+	}
+	if hs, err := ls.Heads(tid, lid); err != nil || len(hs) != 1 || !hs[0].Equals(heads[1]) {
+		t.Fatalf("expected head %s, got %v (err: %v)", heads[1], hs, err)
+	}
+	addr := pt.GenerateAddrs(1)[0]
+	if err := ls.AddAddr(tid, lid, addr, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if addrs, err := ls.Addrs(tid, lid); err != nil || len(addrs) != 1 || !addrs[0].Equal(addr) {
+		t.Fatalf("expected address %s, got %v (err: %v)", addr, addrs, err)
+	}
+
+	// evicted threads are loaded again
+	other := thread.NewIDV1(thread.Raw, 24)
+	if err := ls.AddThread(thread.Info{ID: other, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.ServiceKey(other); err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || evicted[0] != tid {
+		t.Fatalf("expected thread %s to be evicted, got %v", tid, evicted)
+	}
+	if got, err := ls.PubKey(tid, lid); err != nil || got == nil || !got.Equals(pk) {
+		t.Fatalf("expected public key of evicted thread, err: %v", err)
+	}
+}
+
 /* store factories */
 
+func TestHybridLogstoreLoadsAffectedThreads(t *testing.T) {
+	ps, psClose := lstoredsBadgerF(t)
+	defer psClose()
+	ms, msClose := lstorememF(t)
+	defer msClose()
+	ls, err := NewLogstore(ps, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archived := thread.NewIDV1(thread.Raw, 24)
+	if err := ls.AddThread(thread.Info{ID: archived, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	if err := ls.Archive(archived, &blob); err != nil {
+		t.Fatal(err)
+	}
+	cold := thread.NewIDV1(thread.Raw, 24)
+	if err := ls.AddThread(thread.Info{ID: cold, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+	coldStore := syncds.MutexWrap(ds.NewMapDatastore())
+	if err := ls.ArchiveThread(cold, coldStore); err != nil {
+		t.Fatal(err)
+	}
+	snapshotted := thread.NewIDV1(thread.Raw, 24)
+	src := m.NewLogstore()
+	defer src.Close()
+	if err := src.CreateThread(snapshotted); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.AddThread(thread.Info{ID: snapshotted, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+	sn, err := core.Snapshots(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot bytes.Buffer
+	if err := sn.Snapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	// a thread written to the persistent storage behind the hybrid's back
+	// must not be loaded into memory as a side effect
+	other := thread.NewIDV1(thread.Raw, 24)
+	if err := ps.AddThread(thread.Info{ID: other, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ls.Unarchive(&blob); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.Restore(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.UnarchiveThread(cold, coldStore); err != nil {
+		t.Fatal(err)
+	}
+	for _, tid := range []thread.ID{archived, snapshotted, cold} {
+		if _, err := ms.GetThread(tid); err != nil {
+			t.Fatalf("expected thread %s in memory: %v", tid, err)
+		}
+	}
+	if _, err := ms.GetThread(other); err != core.ErrThreadNotFound {
+		t.Fatalf("expected unrelated thread not to be loaded, got %v", err)
+	}
+}
+
 func logstoreFactory(tb testing.TB, persistF, memF storeFactory) pt.LogstoreFactory {
 	return func() (core.Logstore, func()) {
 		ps, psClose := persistF(tb)
@@ -102,6 +283,17 @@ func logstoreFactory(tb testing.TB, persistF, memF storeFactory) pt.LogstoreFact
 	}
 }
 
+func cachedFactory(tb testing.TB, persistF storeFactory, bounds m.Bounds) pt.LogstoreFactory {
+	return func() (core.Logstore, func()) {
+		ps, psClose := persistF(tb)
+		ls := NewCachedLogstore(ps, bounds)
+		return ls, func() {
+			_ = ls.Close()
+			psClose()
+		}
+	}
+}
+
 func lstoredsBadgerF(tb testing.TB) (core.Logstore, func()) {
 	dataPath, err := ioutil.TempDir(os.TempDir(), "badger")
 	if err != nil {
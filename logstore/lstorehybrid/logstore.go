@@ -1,20 +1,34 @@
 package lstorehybrid
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"time"
 
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
 	ma "github.com/multiformats/go-multiaddr"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 	sym "github.com/textileio/go-threads/crypto/symmetric"
 )
 
-var _ core.Logstore = (*lstore)(nil)
+var (
+	_ core.Logstore    = (*lstore)(nil)
+	_ core.NameBook    = (*lstore)(nil)
+	_ core.PinBook     = (*lstore)(nil)
+	_ core.AccessBook  = (*lstore)(nil)
+	_ core.Inviter     = (*lstore)(nil)
+	_ core.Snapshotter = (*lstore)(nil)
+	_ core.Transactor  = (*lstore)(nil)
+)
 
 type lstore struct {
 	inMem, persist core.Logstore
@@ -23,38 +37,62 @@ type lstore struct {
 func NewLogstore(persist, inMem core.Logstore) (*lstore, error) {
 	// on a start it's required to synchronize both storages, so we
 	// initialize in-memory storage with data from the persistent one
-	dKeys, err := persist.DumpKeys()
+	l := &lstore{inMem: inMem, persist: persist}
+	if err := l.syncInMem(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// syncInMem replaces contents of the in-memory storage with data from the persistent one.
+func (l *lstore) syncInMem() error {
+	dKeys, err := l.persist.DumpKeys()
 	if err != nil {
-		return nil, fmt.Errorf("dumping keys from persistent storage: %w", err)
+		return fmt.Errorf("dumping keys from persistent storage: %w", err)
 	}
-	dAddrs, err := persist.DumpAddrs()
+	dAddrs, err := l.persist.DumpAddrs()
 	if err != nil {
-		return nil, fmt.Errorf("dumping addresses from persistent storage: %w", err)
+		return fmt.Errorf("dumping addresses from persistent storage: %w", err)
 	}
-	dHeads, err := persist.DumpHeads()
+	dHeads, err := l.persist.DumpHeads()
 	if err != nil {
-		return nil, fmt.Errorf("dumping heads from persistent storage: %w", err)
+		return fmt.Errorf("dumping heads from persistent storage: %w", err)
 	}
-	dMeta, err := persist.DumpMeta()
+	dMeta, err := l.persist.DumpMeta()
 	if err != nil {
-		return nil, fmt.Errorf("dumping metadata from persistent storage: %w", err)
+		return fmt.Errorf("dumping metadata from persistent storage: %w", err)
 	}
 
 	// initialize in-memory storage
-	if err := inMem.RestoreKeys(dKeys); err != nil {
-		return nil, fmt.Errorf("initializing in-memory storage with keys: %w", err)
+	if err := l.inMem.RestoreKeys(dKeys); err != nil {
+		return fmt.Errorf("initializing in-memory storage with keys: %w", err)
 	}
-	if err := inMem.RestoreAddrs(dAddrs); err != nil {
-		return nil, fmt.Errorf("initializing in-memory storage with addresses: %w", err)
+	if err := l.inMem.RestoreAddrs(dAddrs); err != nil {
+		return fmt.Errorf("initializing in-memory storage with addresses: %w", err)
 	}
-	if err := inMem.RestoreHeads(dHeads); err != nil {
-		return nil, fmt.Errorf("initializing in-memory storage with heads: %w", err)
+	if err := l.inMem.RestoreHeads(dHeads); err != nil {
+		return fmt.Errorf("initializing in-memory storage with heads: %w", err)
 	}
-	if err := inMem.RestoreMeta(dMeta); err != nil {
-		return nil, fmt.Errorf("initializing in-memory storage with metadata: %w", err)
+	if err := l.inMem.RestoreMeta(dMeta); err != nil {
+		return fmt.Errorf("initializing in-memory storage with metadata: %w", err)
 	}
+	return nil
+}
 
-	return &lstore{inMem: inMem, persist: persist}, nil
+// syncThread replaces the thread in the in-memory storage with its copy
+// from the persistent one, e.g. after it was imported in the latter.
+func (l *lstore) syncThread(tid thread.ID) error {
+	data, err := l.persist.ExportThread(tid)
+	if err != nil {
+		return fmt.Errorf("exporting thread %s from persistent storage: %w", tid, err)
+	}
+	if err := l.inMem.DeleteThread(tid); err != nil {
+		return err
+	}
+	if err := l.inMem.ImportThread(data); err != nil {
+		return fmt.Errorf("importing thread %s into in-memory storage: %w", tid, err)
+	}
+	return nil
 }
 
 func (l *lstore) Close() error {
@@ -108,6 +146,24 @@ func (l *lstore) PutBytes(tid thread.ID, key string, val []byte) error {
 	return l.inMem.PutBytes(tid, key, val)
 }
 
+func (l *lstore) PutMetaWithTTL(tid thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if err := l.persist.PutMetaWithTTL(tid, key, val, ttl); err != nil {
+		return err
+	}
+	return l.inMem.PutMetaWithTTL(tid, key, val, ttl)
+}
+
+func (l *lstore) MetaKeys(tid thread.ID) ([]string, error) {
+	return l.inMem.MetaKeys(tid)
+}
+
+func (l *lstore) DeleteMetaPrefix(tid thread.ID, prefix string) error {
+	if err := l.persist.DeleteMetaPrefix(tid, prefix); err != nil {
+		return err
+	}
+	return l.inMem.DeleteMetaPrefix(tid, prefix)
+}
+
 func (l *lstore) ClearMetadata(tid thread.ID) error {
 	if err := l.persist.ClearMetadata(tid); err != nil {
 		return err
@@ -115,28 +171,214 @@ func (l *lstore) ClearMetadata(tid thread.ID) error {
 	return l.inMem.ClearMetadata(tid)
 }
 
-func (l *lstore) PubKey(tid thread.ID, lid peer.ID) (crypto.PubKey, error) {
+func (l *lstore) GetLogInt64(tid thread.ID, lid thread.LogID, key string) (*int64, error) {
+	return l.inMem.GetLogInt64(tid, lid, key)
+}
+
+func (l *lstore) PutLogInt64(tid thread.ID, lid thread.LogID, key string, val int64) error {
+	if err := l.persist.PutLogInt64(tid, lid, key, val); err != nil {
+		return err
+	}
+	return l.inMem.PutLogInt64(tid, lid, key, val)
+}
+
+func (l *lstore) GetLogString(tid thread.ID, lid thread.LogID, key string) (*string, error) {
+	return l.inMem.GetLogString(tid, lid, key)
+}
+
+func (l *lstore) PutLogString(tid thread.ID, lid thread.LogID, key string, val string) error {
+	if err := l.persist.PutLogString(tid, lid, key, val); err != nil {
+		return err
+	}
+	return l.inMem.PutLogString(tid, lid, key, val)
+}
+
+func (l *lstore) GetLogBool(tid thread.ID, lid thread.LogID, key string) (*bool, error) {
+	return l.inMem.GetLogBool(tid, lid, key)
+}
+
+func (l *lstore) PutLogBool(tid thread.ID, lid thread.LogID, key string, val bool) error {
+	if err := l.persist.PutLogBool(tid, lid, key, val); err != nil {
+		return err
+	}
+	return l.inMem.PutLogBool(tid, lid, key, val)
+}
+
+func (l *lstore) GetLogBytes(tid thread.ID, lid thread.LogID, key string) (*[]byte, error) {
+	return l.inMem.GetLogBytes(tid, lid, key)
+}
+
+func (l *lstore) PutLogBytes(tid thread.ID, lid thread.LogID, key string, val []byte) error {
+	if err := l.persist.PutLogBytes(tid, lid, key, val); err != nil {
+		return err
+	}
+	return l.inMem.PutLogBytes(tid, lid, key, val)
+}
+
+func (l *lstore) SetThreadName(tid thread.ID, name string) error {
+	persist, inMem, err := l.names()
+	if err != nil {
+		return err
+	}
+	if err := persist.SetThreadName(tid, name); err != nil {
+		return err
+	}
+	return inMem.SetThreadName(tid, name)
+}
+
+func (l *lstore) ThreadByName(name string) (thread.ID, error) {
+	nb, err := core.Names(l.inMem)
+	if err != nil {
+		return thread.Undef, err
+	}
+	return nb.ThreadByName(name)
+}
+
+func (l *lstore) ThreadNames() (map[string]thread.ID, error) {
+	nb, err := core.Names(l.inMem)
+	if err != nil {
+		return nil, err
+	}
+	return nb.ThreadNames()
+}
+
+// names returns name books of both storages.
+func (l *lstore) names() (persist, inMem core.NameBook, err error) {
+	if persist, err = core.Names(l.persist); err != nil {
+		return
+	}
+	inMem, err = core.Names(l.inMem)
+	return
+}
+
+func (l *lstore) Pin(tid thread.ID, priority int) error {
+	persist, inMem, err := l.pins()
+	if err != nil {
+		return err
+	}
+	if err := persist.Pin(tid, priority); err != nil {
+		return err
+	}
+	return inMem.Pin(tid, priority)
+}
+
+func (l *lstore) Unpin(tid thread.ID) error {
+	persist, inMem, err := l.pins()
+	if err != nil {
+		return err
+	}
+	if err := persist.Unpin(tid); err != nil {
+		return err
+	}
+	return inMem.Unpin(tid)
+}
+
+func (l *lstore) PinnedThreads() ([]core.Pin, error) {
+	pb, err := core.Pins(l.inMem)
+	if err != nil {
+		return nil, err
+	}
+	return pb.PinnedThreads()
+}
+
+// pins returns pin books of both storages.
+func (l *lstore) pins() (persist, inMem core.PinBook, err error) {
+	if persist, err = core.Pins(l.persist); err != nil {
+		return
+	}
+	inMem, err = core.Pins(l.inMem)
+	return
+}
+
+func (l *lstore) SetRole(tid thread.ID, pk thread.PubKey, role core.Role) error {
+	persist, inMem, err := l.access()
+	if err != nil {
+		return err
+	}
+	if err := persist.SetRole(tid, pk, role); err != nil {
+		return err
+	}
+	return inMem.SetRole(tid, pk, role)
+}
+
+func (l *lstore) Role(tid thread.ID, pk thread.PubKey) (core.Role, error) {
+	ab, err := core.Access(l.inMem)
+	if err != nil {
+		return core.NoRole, err
+	}
+	return ab.Role(tid, pk)
+}
+
+func (l *lstore) HasRole(tid thread.ID, pk thread.PubKey, role core.Role) (bool, error) {
+	ab, err := core.Access(l.inMem)
+	if err != nil {
+		return false, err
+	}
+	return ab.HasRole(tid, pk, role)
+}
+
+func (l *lstore) Members(tid thread.ID) ([]core.Member, error) {
+	ab, err := core.Access(l.inMem)
+	if err != nil {
+		return nil, err
+	}
+	return ab.Members(tid)
+}
+
+// access returns access books of both storages.
+func (l *lstore) access() (persist, inMem core.AccessBook, err error) {
+	if persist, err = core.Access(l.persist); err != nil {
+		return
+	}
+	inMem, err = core.Access(l.inMem)
+	return
+}
+
+func (l *lstore) PubKey(tid thread.ID, lid thread.LogID) (crypto.PubKey, error) {
 	return l.inMem.PubKey(tid, lid)
 }
 
-func (l *lstore) AddPubKey(tid thread.ID, lid peer.ID, key crypto.PubKey) error {
+func (l *lstore) AddPubKey(tid thread.ID, lid thread.LogID, key crypto.PubKey) error {
 	if err := l.persist.AddPubKey(tid, lid, key); err != nil {
 		return err
 	}
 	return l.inMem.AddPubKey(tid, lid, key)
 }
 
-func (l *lstore) PrivKey(tid thread.ID, lid peer.ID) (crypto.PrivKey, error) {
+func (l *lstore) RevokePubKey(tid thread.ID, lid thread.LogID) error {
+	if err := l.persist.RevokePubKey(tid, lid); err != nil {
+		return err
+	}
+	return l.inMem.RevokePubKey(tid, lid)
+}
+
+func (l *lstore) IsRevoked(tid thread.ID, lid thread.LogID) (bool, error) {
+	return l.inMem.IsRevoked(tid, lid)
+}
+
+func (l *lstore) PrivKey(tid thread.ID, lid thread.LogID) (crypto.PrivKey, error) {
 	return l.inMem.PrivKey(tid, lid)
 }
 
-func (l *lstore) AddPrivKey(tid thread.ID, lid peer.ID, key crypto.PrivKey) error {
+func (l *lstore) AddPrivKey(tid thread.ID, lid thread.LogID, key crypto.PrivKey) error {
 	if err := l.persist.AddPrivKey(tid, lid, key); err != nil {
 		return err
 	}
 	return l.inMem.AddPrivKey(tid, lid, key)
 }
 
+func (l *lstore) HasPrivKey(tid thread.ID, lid thread.LogID) (bool, error) {
+	return l.inMem.HasPrivKey(tid, lid)
+}
+
+func (l *lstore) HasReadKey(tid thread.ID) (bool, error) {
+	return l.inMem.HasReadKey(tid)
+}
+
+func (l *lstore) HasServiceKey(tid thread.ID) (bool, error) {
+	return l.inMem.HasServiceKey(tid)
+}
+
 func (l *lstore) ReadKey(tid thread.ID) (*sym.Key, error) {
 	return l.inMem.ReadKey(tid)
 }
@@ -159,6 +401,36 @@ func (l *lstore) AddServiceKey(tid thread.ID, key *sym.Key) error {
 	return l.inMem.AddServiceKey(tid, key)
 }
 
+func (l *lstore) RotateReadKey(tid thread.ID, key *sym.Key) (int, error) {
+	if _, err := l.persist.RotateReadKey(tid, key); err != nil {
+		return 0, err
+	}
+	return l.inMem.RotateReadKey(tid, key)
+}
+
+func (l *lstore) ReadKeyVersion(tid thread.ID, version int) (*sym.Key, error) {
+	return l.inMem.ReadKeyVersion(tid, version)
+}
+
+func (l *lstore) ReadKeyVersions(tid thread.ID) ([]core.KeyVersion, error) {
+	return l.inMem.ReadKeyVersions(tid)
+}
+
+func (l *lstore) RotateServiceKey(tid thread.ID, key *sym.Key) (int, error) {
+	if _, err := l.persist.RotateServiceKey(tid, key); err != nil {
+		return 0, err
+	}
+	return l.inMem.RotateServiceKey(tid, key)
+}
+
+func (l *lstore) ServiceKeyVersion(tid thread.ID, version int) (*sym.Key, error) {
+	return l.inMem.ServiceKeyVersion(tid, version)
+}
+
+func (l *lstore) ServiceKeyVersions(tid thread.ID) ([]core.KeyVersion, error) {
+	return l.inMem.ServiceKeyVersions(tid)
+}
+
 func (l *lstore) ClearKeys(tid thread.ID) error {
 	if err := l.persist.ClearKeys(tid); err != nil {
 		return err
@@ -166,14 +438,14 @@ func (l *lstore) ClearKeys(tid thread.ID) error {
 	return l.inMem.ClearKeys(tid)
 }
 
-func (l *lstore) ClearLogKeys(tid thread.ID, lid peer.ID) error {
+func (l *lstore) ClearLogKeys(tid thread.ID, lid thread.LogID) error {
 	if err := l.persist.ClearLogKeys(tid, lid); err != nil {
 		return err
 	}
 	return l.inMem.ClearLogKeys(tid, lid)
 }
 
-func (l *lstore) LogsWithKeys(tid thread.ID) (peer.IDSlice, error) {
+func (l *lstore) LogsWithKeys(tid thread.ID) (thread.LogIDSlice, error) {
 	return l.inMem.LogsWithKeys(tid)
 }
 
@@ -181,57 +453,114 @@ func (l *lstore) ThreadsFromKeys() (thread.IDSlice, error) {
 	return l.inMem.ThreadsFromKeys()
 }
 
-func (l *lstore) AddAddr(tid thread.ID, lid peer.ID, addr ma.Multiaddr, dur time.Duration) error {
+func (l *lstore) ThreadsWithLogKeys(lid thread.LogID) (thread.IDSlice, error) {
+	return l.inMem.ThreadsWithLogKeys(lid)
+}
+
+func (l *lstore) AddAddr(tid thread.ID, lid thread.LogID, addr ma.Multiaddr, dur time.Duration) error {
 	if err := l.persist.AddAddr(tid, lid, addr, dur); err != nil {
 		return err
 	}
 	return l.inMem.AddAddr(tid, lid, addr, dur)
 }
 
-func (l *lstore) AddAddrs(tid thread.ID, lid peer.ID, addrs []ma.Multiaddr, dur time.Duration) error {
+func (l *lstore) AddAddrs(tid thread.ID, lid thread.LogID, addrs []ma.Multiaddr, dur time.Duration) error {
 	if err := l.persist.AddAddrs(tid, lid, addrs, dur); err != nil {
 		return err
 	}
 	return l.inMem.AddAddrs(tid, lid, addrs, dur)
 }
 
-func (l *lstore) SetAddr(tid thread.ID, lid peer.ID, addr ma.Multiaddr, dur time.Duration) error {
+func (l *lstore) AddAddrsFromSource(tid thread.ID, lid thread.LogID, addrs []ma.Multiaddr, dur time.Duration, src core.AddrSource) error {
+	if err := l.persist.AddAddrsFromSource(tid, lid, addrs, dur, src); err != nil {
+		return err
+	}
+	return l.inMem.AddAddrsFromSource(tid, lid, addrs, dur, src)
+}
+
+func (l *lstore) AddLogAddrsBulk(entries []core.ThreadLogAddrs, dur time.Duration) error {
+	if err := l.persist.AddLogAddrsBulk(entries, dur); err != nil {
+		return err
+	}
+	return l.inMem.AddLogAddrsBulk(entries, dur)
+}
+
+func (l *lstore) ConsumeLogRecord(tid thread.ID, env *record.Envelope, dur time.Duration) (bool, error) {
+	accepted, err := l.persist.ConsumeLogRecord(tid, env, dur)
+	if err != nil || !accepted {
+		return accepted, err
+	}
+	return l.inMem.ConsumeLogRecord(tid, env, dur)
+}
+
+func (l *lstore) RecordDial(tid thread.ID, lid thread.LogID, addr ma.Multiaddr, rtt time.Duration) error {
+	if err := l.persist.RecordDial(tid, lid, addr, rtt); err != nil {
+		return err
+	}
+	return l.inMem.RecordDial(tid, lid, addr, rtt)
+}
+
+func (l *lstore) SetAddr(tid thread.ID, lid thread.LogID, addr ma.Multiaddr, dur time.Duration) error {
 	if err := l.persist.SetAddr(tid, lid, addr, dur); err != nil {
 		return err
 	}
 	return l.inMem.SetAddr(tid, lid, addr, dur)
 }
 
-func (l *lstore) SetAddrs(tid thread.ID, lid peer.ID, addrs []ma.Multiaddr, dur time.Duration) error {
+func (l *lstore) SetAddrs(tid thread.ID, lid thread.LogID, addrs []ma.Multiaddr, dur time.Duration) error {
 	if err := l.persist.SetAddrs(tid, lid, addrs, dur); err != nil {
 		return err
 	}
 	return l.inMem.SetAddrs(tid, lid, addrs, dur)
 }
 
-func (l *lstore) UpdateAddrs(tid thread.ID, lid peer.ID, oldTTL time.Duration, newTTL time.Duration) error {
+func (l *lstore) UpdateAddrs(tid thread.ID, lid thread.LogID, oldTTL time.Duration, newTTL time.Duration) error {
 	if err := l.persist.UpdateAddrs(tid, lid, oldTTL, newTTL); err != nil {
 		return err
 	}
 	return l.inMem.UpdateAddrs(tid, lid, oldTTL, newTTL)
 }
 
-func (l *lstore) Addrs(tid thread.ID, lid peer.ID) ([]ma.Multiaddr, error) {
+func (l *lstore) Addrs(tid thread.ID, lid thread.LogID) ([]ma.Multiaddr, error) {
 	return l.inMem.Addrs(tid, lid)
 }
 
-func (l *lstore) AddrStream(ctx context.Context, tid thread.ID, lid peer.ID) (<-chan ma.Multiaddr, error) {
+func (l *lstore) ForEachLogAddr(tid thread.ID, lid thread.LogID, fn func(ma.Multiaddr) bool) error {
+	return l.inMem.ForEachLogAddr(tid, lid, fn)
+}
+
+func (l *lstore) LogRecord(tid thread.ID, lid thread.LogID) (*record.Envelope, error) {
+	return l.inMem.LogRecord(tid, lid)
+}
+
+func (l *lstore) SortedAddrs(tid thread.ID, lid thread.LogID) ([]ma.Multiaddr, error) {
+	return l.inMem.SortedAddrs(tid, lid)
+}
+
+func (l *lstore) AddrsWithSource(tid thread.ID, lid thread.LogID) ([]core.ExpiredAddress, error) {
+	return l.inMem.AddrsWithSource(tid, lid)
+}
+
+func (l *lstore) AddrStream(ctx context.Context, tid thread.ID, lid thread.LogID) (<-chan ma.Multiaddr, error) {
 	return l.inMem.AddrStream(ctx, tid, lid)
 }
 
-func (l *lstore) ClearAddrs(tid thread.ID, lid peer.ID) error {
+func (l *lstore) ThreadAddrStream(ctx context.Context, tid thread.ID) (<-chan core.LogAddr, error) {
+	return l.inMem.ThreadAddrStream(ctx, tid)
+}
+
+func (l *lstore) ControlledAddrStream(ctx context.Context, tid thread.ID, lid thread.LogID) (<-chan ma.Multiaddr, core.AddrStreamControl, error) {
+	return l.inMem.ControlledAddrStream(ctx, tid, lid)
+}
+
+func (l *lstore) ClearAddrs(tid thread.ID, lid thread.LogID) error {
 	if err := l.persist.ClearAddrs(tid, lid); err != nil {
 		return err
 	}
 	return l.inMem.ClearAddrs(tid, lid)
 }
 
-func (l *lstore) LogsWithAddrs(tid thread.ID) (peer.IDSlice, error) {
+func (l *lstore) LogsWithAddrs(tid thread.ID) (thread.LogIDSlice, error) {
 	return l.inMem.LogsWithAddrs(tid)
 }
 
@@ -239,39 +568,54 @@ func (l *lstore) ThreadsFromAddrs() (thread.IDSlice, error) {
 	return l.inMem.ThreadsFromAddrs()
 }
 
-func (l *lstore) AddHead(tid thread.ID, lid peer.ID, cid cid.Cid) error {
+func (l *lstore) ThreadsWithLogAddrs(lid thread.LogID) (thread.IDSlice, error) {
+	return l.inMem.ThreadsWithLogAddrs(lid)
+}
+
+func (l *lstore) LogsWithAddr(addr ma.Multiaddr) ([]core.ThreadLog, error) {
+	return l.inMem.LogsWithAddr(addr)
+}
+
+func (l *lstore) ReplaceAddr(old, repl ma.Multiaddr, ttl time.Duration) ([]core.ThreadLog, error) {
+	if _, err := l.persist.ReplaceAddr(old, repl, ttl); err != nil {
+		return nil, err
+	}
+	return l.inMem.ReplaceAddr(old, repl, ttl)
+}
+
+func (l *lstore) AddHead(tid thread.ID, lid thread.LogID, cid cid.Cid) error {
 	if err := l.persist.AddHead(tid, lid, cid); err != nil {
 		return err
 	}
 	return l.inMem.AddHead(tid, lid, cid)
 }
 
-func (l *lstore) AddHeads(tid thread.ID, lid peer.ID, cids []cid.Cid) error {
+func (l *lstore) AddHeads(tid thread.ID, lid thread.LogID, cids []cid.Cid) error {
 	if err := l.persist.AddHeads(tid, lid, cids); err != nil {
 		return err
 	}
 	return l.inMem.AddHeads(tid, lid, cids)
 }
 
-func (l *lstore) SetHead(tid thread.ID, lid peer.ID, cid cid.Cid) error {
+func (l *lstore) SetHead(tid thread.ID, lid thread.LogID, cid cid.Cid) error {
 	if err := l.persist.SetHead(tid, lid, cid); err != nil {
 		return err
 	}
 	return l.inMem.SetHead(tid, lid, cid)
 }
 
-func (l *lstore) SetHeads(tid thread.ID, lid peer.ID, cids []cid.Cid) error {
+func (l *lstore) SetHeads(tid thread.ID, lid thread.LogID, cids []cid.Cid) error {
 	if err := l.persist.SetHeads(tid, lid, cids); err != nil {
 		return err
 	}
 	return l.inMem.SetHeads(tid, lid, cids)
 }
 
-func (l *lstore) Heads(tid thread.ID, lid peer.ID) ([]cid.Cid, error) {
+func (l *lstore) Heads(tid thread.ID, lid thread.LogID) ([]cid.Cid, error) {
 	return l.inMem.Heads(tid, lid)
 }
 
-func (l *lstore) ClearHeads(tid thread.ID, lid peer.ID) error {
+func (l *lstore) ClearHeads(tid thread.ID, lid thread.LogID) error {
 	if err := l.persist.ClearHeads(tid, lid); err != nil {
 		return err
 	}
@@ -282,6 +626,13 @@ func (l *lstore) Threads() (thread.IDSlice, error) {
 	return l.inMem.Threads()
 }
 
+func (l *lstore) CreateThread(tid thread.ID, opts ...core.ThreadOption) error {
+	if err := l.persist.CreateThread(tid, opts...); err != nil {
+		return err
+	}
+	return l.inMem.CreateThread(tid, opts...)
+}
+
 func (l *lstore) AddThread(info thread.Info) error {
 	if err := l.persist.AddThread(info); err != nil {
 		return err
@@ -293,6 +644,40 @@ func (l *lstore) GetThread(tid thread.ID) (thread.Info, error) {
 	return l.inMem.GetThread(tid)
 }
 
+func (l *lstore) GetThreadHandle(tid thread.ID) (*core.ThreadHandle, error) {
+	if _, err := l.inMem.GetThreadHandle(tid); err != nil {
+		return nil, err
+	}
+	return core.NewThreadHandle(l, tid), nil
+}
+
+func (l *lstore) ThreadHandles() ([]*core.ThreadHandle, error) {
+	handles, err := l.inMem.ThreadHandles()
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range handles {
+		handles[i] = core.NewThreadHandle(l, h.ID)
+	}
+	return handles, nil
+}
+
+func (l *lstore) GetThreadFull(tid thread.ID) (core.ThreadInfoFull, error) {
+	return l.inMem.GetThreadFull(tid)
+}
+
+func (l *lstore) ThreadsPaged(offset, limit int) (thread.IDSlice, error) {
+	return l.inMem.ThreadsPaged(offset, limit)
+}
+
+func (l *lstore) ThreadsFilter(filter func(thread.ID) bool) (thread.IDSlice, error) {
+	return l.inMem.ThreadsFilter(filter)
+}
+
+func (l *lstore) LogsToThreads(lid thread.LogID) (thread.IDSlice, error) {
+	return l.inMem.LogsToThreads(lid)
+}
+
 func (l *lstore) DeleteThread(tid thread.ID) error {
 	if err := l.persist.DeleteThread(tid); err != nil {
 		return err
@@ -307,7 +692,7 @@ func (l *lstore) AddLog(tid thread.ID, info thread.LogInfo) error {
 	return l.inMem.AddLog(tid, info)
 }
 
-func (l *lstore) GetLog(tid thread.ID, lid peer.ID) (thread.LogInfo, error) {
+func (l *lstore) GetLog(tid thread.ID, lid thread.LogID) (thread.LogInfo, error) {
 	return l.inMem.GetLog(tid, lid)
 }
 
@@ -315,13 +700,167 @@ func (l *lstore) GetManagedLogs(tid thread.ID) ([]thread.LogInfo, error) {
 	return l.inMem.GetManagedLogs(tid)
 }
 
-func (l *lstore) DeleteLog(tid thread.ID, lid peer.ID) error {
+func (l *lstore) LogsForPeer(tid thread.ID, p peer.ID) (thread.LogIDSlice, error) {
+	return l.inMem.LogsForPeer(tid, p)
+}
+
+func (l *lstore) DeleteLog(tid thread.ID, lid thread.LogID) error {
 	if err := l.persist.DeleteLog(tid, lid); err != nil {
 		return err
 	}
 	return l.inMem.DeleteLog(tid, lid)
 }
 
+func (l *lstore) ThreadDiskUsage(tid thread.ID) (int64, error) {
+	return l.persist.ThreadDiskUsage(tid)
+}
+
+// Stats counts entries in the in-memory storage, sizes are reported by the persistent one.
+func (l *lstore) Stats() (core.Stats, error) {
+	stats, err := l.inMem.Stats()
+	if err != nil {
+		return stats, err
+	}
+	stats.Total.Size = 0
+	for tid, ts := range stats.PerThread {
+		size, err := l.persist.ThreadDiskUsage(tid)
+		if errors.Is(err, core.ErrNotSupported) {
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+		ts.Size = size
+		stats.PerThread[tid] = ts
+		stats.Total.Size += size
+	}
+	return stats, nil
+}
+
+func (l *lstore) ExportThread(tid thread.ID) ([]byte, error) {
+	return l.inMem.ExportThread(tid)
+}
+
+func (l *lstore) ImportThread(data []byte) error {
+	if err := l.persist.ImportThread(data); err != nil {
+		return err
+	}
+	return l.inMem.ImportThread(data)
+}
+
+func (l *lstore) ExportKeys(tid thread.ID, passphrase string) ([]byte, error) {
+	return l.inMem.ExportKeys(tid, passphrase)
+}
+
+func (l *lstore) ImportKeys(bundle []byte, passphrase string) error {
+	if err := l.persist.ImportKeys(bundle, passphrase); err != nil {
+		return err
+	}
+	return l.inMem.ImportKeys(bundle, passphrase)
+}
+
+func (l *lstore) CreateInvite(tid thread.ID, withReadKey bool, password string) ([]byte, error) {
+	inv, err := core.Invites(l.inMem)
+	if err != nil {
+		return nil, err
+	}
+	return inv.CreateInvite(tid, withReadKey, password)
+}
+
+func (l *lstore) AcceptInvite(invite []byte, password string) (thread.Info, error) {
+	persist, err := core.Invites(l.persist)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	inMem, err := core.Invites(l.inMem)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	if _, err := persist.AcceptInvite(invite, password); err != nil {
+		return thread.Info{}, err
+	}
+	return inMem.AcceptInvite(invite, password)
+}
+
+func (l *lstore) IssueCapability(tid thread.ID, issuer thread.LogID, subject peer.ID, role core.Role, ttl time.Duration) ([]byte, error) {
+	return l.inMem.IssueCapability(tid, issuer, subject, role, ttl)
+}
+
+func (l *lstore) VerifyCapability(token []byte) (core.Capability, error) {
+	return l.inMem.VerifyCapability(token)
+}
+
+func (l *lstore) Snapshot(w io.Writer) error {
+	sn, err := core.Snapshots(l.inMem)
+	if err != nil {
+		return err
+	}
+	return sn.Snapshot(w)
+}
+
+func (l *lstore) DumpCanonical(w io.Writer) error {
+	return l.inMem.DumpCanonical(w)
+}
+
+// Restore imports the snapshot into both storages. The snapshot is kept in
+// memory while being restored into the persistent storage, so that only
+// its threads are imported into the in-memory one.
+func (l *lstore) Restore(r io.Reader) error {
+	persist, err := core.Snapshots(l.persist)
+	if err != nil {
+		return err
+	}
+	inMem, err := core.Snapshots(l.inMem)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := persist.Restore(io.TeeReader(r, &buf)); err != nil {
+		return err
+	}
+	return inMem.Restore(&buf)
+}
+
+func (l *lstore) ArchiveThread(tid thread.ID, cold ds.Datastore) error {
+	if err := l.persist.ArchiveThread(tid, cold); err != nil {
+		return err
+	}
+	return l.inMem.DeleteThread(tid)
+}
+
+func (l *lstore) UnarchiveThread(tid thread.ID, cold ds.Datastore) error {
+	if err := l.persist.UnarchiveThread(tid, cold); err != nil {
+		return err
+	}
+	// archived copy is consumed at this point, so restored
+	// thread could be obtained from the persistent storage only
+	return l.syncThread(tid)
+}
+
+func (l *lstore) ArchivedThreads(cold ds.Datastore) (thread.IDSlice, error) {
+	return l.persist.ArchivedThreads(cold)
+}
+
+func (l *lstore) Archive(tid thread.ID, w io.Writer) error {
+	if err := l.persist.Archive(tid, w); err != nil {
+		return err
+	}
+	// leaves an archival stub of its own in the in-memory storage
+	return l.inMem.Archive(tid, ioutil.Discard)
+}
+
+func (l *lstore) Unarchive(r io.Reader) (thread.ID, error) {
+	tid, err := l.persist.Unarchive(r)
+	if err != nil {
+		return thread.Undef, err
+	}
+	return tid, l.syncThread(tid)
+}
+
+func (l *lstore) IsArchived(tid thread.ID) (bool, error) {
+	return l.inMem.IsArchived(tid)
+}
+
 func (l *lstore) DumpMeta() (core.DumpMetadata, error) {
 	return l.inMem.DumpMeta()
 }
@@ -365,3 +904,60 @@ func (l *lstore) RestoreHeads(dump core.DumpHeadBook) error {
 	}
 	return l.inMem.RestoreHeads(dump)
 }
+
+func (l *lstore) Subscribe(ctx context.Context, tid thread.ID) (<-chan core.Event, error) {
+	return l.inMem.Subscribe(ctx, tid)
+}
+
+func (l *lstore) Events(ctx context.Context) <-chan core.Event {
+	return l.inMem.Events(ctx)
+}
+
+func (l *lstore) RegisterHook(h core.Hook) func() {
+	return l.inMem.RegisterHook(h)
+}
+
+func (l *lstore) Batch() core.Batch {
+	return &batch{persist: l.persist.Batch(), inMem: l.inMem.Batch()}
+}
+
+type batch struct {
+	inMem, persist core.Batch
+}
+
+func (b *batch) AddThread(info thread.Info) {
+	b.persist.AddThread(info)
+	b.inMem.AddThread(info)
+}
+
+func (b *batch) AddLog(tid thread.ID, info thread.LogInfo) {
+	b.persist.AddLog(tid, info)
+	b.inMem.AddLog(tid, info)
+}
+
+func (b *batch) PutInt64(tid thread.ID, key string, val int64) {
+	b.persist.PutInt64(tid, key, val)
+	b.inMem.PutInt64(tid, key, val)
+}
+
+func (b *batch) PutString(tid thread.ID, key string, val string) {
+	b.persist.PutString(tid, key, val)
+	b.inMem.PutString(tid, key, val)
+}
+
+func (b *batch) PutBool(tid thread.ID, key string, val bool) {
+	b.persist.PutBool(tid, key, val)
+	b.inMem.PutBool(tid, key, val)
+}
+
+func (b *batch) PutBytes(tid thread.ID, key string, val []byte) {
+	b.persist.PutBytes(tid, key, val)
+	b.inMem.PutBytes(tid, key, val)
+}
+
+func (b *batch) Commit() error {
+	if err := b.persist.Commit(); err != nil {
+		return err
+	}
+	return b.inMem.Commit()
+}
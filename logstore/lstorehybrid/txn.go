@@ -0,0 +1,136 @@
+package lstorehybrid
+
+import (
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+var _ core.Txn = (*txn)(nil)
+
+// txn runs a transaction on both storages, reading from the in-memory one.
+type txn struct {
+	inMem, persist core.Txn
+}
+
+func (l *lstore) BeginTxn(readonly bool) (core.Txn, error) {
+	ptr, err := core.Transactions(l.persist)
+	if err != nil {
+		return nil, err
+	}
+	mtr, err := core.Transactions(l.inMem)
+	if err != nil {
+		return nil, err
+	}
+	persist, err := ptr.BeginTxn(readonly)
+	if err != nil {
+		return nil, err
+	}
+	inMem, err := mtr.BeginTxn(readonly)
+	if err != nil {
+		_ = persist.Rollback()
+		return nil, err
+	}
+	return &txn{persist: persist, inMem: inMem}, nil
+}
+
+func (tx *txn) Threads() (thread.IDSlice, error) {
+	return tx.inMem.Threads()
+}
+
+func (tx *txn) GetThread(tid thread.ID) (thread.Info, error) {
+	return tx.inMem.GetThread(tid)
+}
+
+func (tx *txn) GetLog(tid thread.ID, lid thread.LogID) (thread.LogInfo, error) {
+	return tx.inMem.GetLog(tid, lid)
+}
+
+func (tx *txn) AddThread(info thread.Info) error {
+	if err := tx.persist.AddThread(info); err != nil {
+		return err
+	}
+	return tx.inMem.AddThread(info)
+}
+
+func (tx *txn) AddLog(tid thread.ID, info thread.LogInfo) error {
+	if err := tx.persist.AddLog(tid, info); err != nil {
+		return err
+	}
+	return tx.inMem.AddLog(tid, info)
+}
+
+func (tx *txn) DeleteThread(tid thread.ID) error {
+	if err := tx.persist.DeleteThread(tid); err != nil {
+		return err
+	}
+	return tx.inMem.DeleteThread(tid)
+}
+
+func (tx *txn) ImportThread(data []byte) error {
+	if err := tx.persist.ImportThread(data); err != nil {
+		return err
+	}
+	return tx.inMem.ImportThread(data)
+}
+
+func (tx *txn) AddAddrs(tid thread.ID, lid thread.LogID, addrs []ma.Multiaddr, dur time.Duration) error {
+	if err := tx.persist.AddAddrs(tid, lid, addrs, dur); err != nil {
+		return err
+	}
+	return tx.inMem.AddAddrs(tid, lid, addrs, dur)
+}
+
+func (tx *txn) SetHeads(tid thread.ID, lid thread.LogID, heads []cid.Cid) error {
+	if err := tx.persist.SetHeads(tid, lid, heads); err != nil {
+		return err
+	}
+	return tx.inMem.SetHeads(tid, lid, heads)
+}
+
+func (tx *txn) PutInt64(tid thread.ID, key string, val int64) error {
+	if err := tx.persist.PutInt64(tid, key, val); err != nil {
+		return err
+	}
+	return tx.inMem.PutInt64(tid, key, val)
+}
+
+func (tx *txn) PutString(tid thread.ID, key string, val string) error {
+	if err := tx.persist.PutString(tid, key, val); err != nil {
+		return err
+	}
+	return tx.inMem.PutString(tid, key, val)
+}
+
+func (tx *txn) PutBool(tid thread.ID, key string, val bool) error {
+	if err := tx.persist.PutBool(tid, key, val); err != nil {
+		return err
+	}
+	return tx.inMem.PutBool(tid, key, val)
+}
+
+func (tx *txn) PutBytes(tid thread.ID, key string, val []byte) error {
+	if err := tx.persist.PutBytes(tid, key, val); err != nil {
+		return err
+	}
+	return tx.inMem.PutBytes(tid, key, val)
+}
+
+func (tx *txn) Commit() error {
+	if err := tx.persist.Commit(); err != nil {
+		_ = tx.inMem.Rollback()
+		return err
+	}
+	return tx.inMem.Commit()
+}
+
+func (tx *txn) Rollback() error {
+	if err := tx.persist.Rollback(); err != nil {
+		_ = tx.inMem.Rollback()
+		return err
+	}
+	return tx.inMem.Rollback()
+}
@@ -1,13 +1,15 @@
 package lstoremem
 
 import (
+	"container/heap"
 	"context"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
 
 	logging "github.com/ipfs/go-log"
-	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
 	"github.com/libp2p/go-libp2p-peerstore/addr"
 	ma "github.com/multiformats/go-multiaddr"
 	core "github.com/textileio/go-threads/core/logstore"
@@ -20,24 +22,125 @@ type expiringAddr struct {
 	Addr    ma.Multiaddr
 	TTL     time.Duration
 	Expires time.Time
+	Source  core.AddrSource
+
+	// dial quality
+	LastDial time.Time
+	RTT      time.Duration
+}
+
+func (e *expiringAddr) expired() core.ExpiredAddress {
+	return core.ExpiredAddress{
+		Addr:     e.Addr,
+		Expires:  e.Expires,
+		Source:   e.Source,
+		LastDial: e.LastDial,
+		RTT:      e.RTT,
+	}
 }
 
 func (e *expiringAddr) ExpiredBy(t time.Time) bool {
 	return t.After(e.Expires)
 }
 
+// expiryQueue orders addresses of a log by expiration time, so that the
+// address expiring first is found without scanning the log. An entry is
+// pushed on every change of an expiration time, and stale ones are dropped
+// once they reach the front.
+type expiryQueue []expiryEntry
+
+type expiryEntry struct {
+	key string
+	exp time.Time
+}
+
+func (q expiryQueue) Len() int            { return len(q) }
+func (q expiryQueue) Less(i, j int) bool  { return q[i].exp.Before(q[j].exp) }
+func (q expiryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiryEntry)) }
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
 type addrSegments [256]*addrSegment
 
 type addrSegment struct {
 	sync.RWMutex
 
+	// maxAddrs caps the number of addresses of a log, unlimited if zero.
+	maxAddrs int
+
 	// Use pointers to save memory. Maps always leave some fraction of their
 	// space unused. storing the *values* directly in the map will
 	// drastically increase the space waste. In our case, by 6x.
-	addrs map[thread.ID]map[peer.ID]map[string]*expiringAddr
+	addrs map[thread.ID]map[thread.LogID]map[string]*expiringAddr
+
+	// signed records of logs with certified addresses.
+	records map[thread.ID]map[thread.LogID]*certifiedRecord
+
+	// threads having addresses of logs.
+	threads map[thread.LogID]map[thread.ID]struct{}
+
+	// logs having addresses, keyed by address bytes.
+	logs map[string]map[core.ThreadLog]struct{}
+
+	// expiration order of addresses of logs, if their number is capped.
+	expiries map[thread.ID]map[thread.LogID]*expiryQueue
+}
+
+func newAddrSegment(maxAddrs int) *addrSegment {
+	return &addrSegment{
+		maxAddrs: maxAddrs,
+		addrs:    make(map[thread.ID]map[thread.LogID]map[string]*expiringAddr),
+		records:  make(map[thread.ID]map[thread.LogID]*certifiedRecord),
+		threads:  make(map[thread.LogID]map[thread.ID]struct{}),
+		logs:     make(map[string]map[core.ThreadLog]struct{}),
+		expiries: make(map[thread.ID]map[thread.LogID]*expiryQueue),
+	}
+}
+
+type certifiedRecord struct {
+	Envelope *record.Envelope
+	Raw      []byte
+	Seq      uint64
 }
 
-func (s *addrSegment) getAddrs(t thread.ID, p peer.ID) (map[string]*expiringAddr, bool) {
+// certified returns the signed record of a log if any of its addresses is still valid.
+func (s *addrSegment) certified(t thread.ID, p thread.LogID, now time.Time) *certifiedRecord {
+	rec := s.records[t][p]
+	if rec == nil {
+		return nil
+	}
+	amap, _ := s.getAddrs(t, p)
+	for _, a := range amap {
+		if !a.ExpiredBy(now) {
+			return rec
+		}
+	}
+	return nil
+}
+
+func (s *addrSegment) setRecord(t thread.ID, p thread.LogID, rec *certifiedRecord) {
+	if s.records[t] == nil {
+		s.records[t] = make(map[thread.LogID]*certifiedRecord, 1)
+	}
+	s.records[t][p] = rec
+}
+
+func (s *addrSegment) deleteRecord(t thread.ID, p thread.LogID) {
+	if rmap := s.records[t]; rmap != nil {
+		delete(rmap, p)
+		if len(rmap) == 0 {
+			delete(s.records, t)
+		}
+	}
+}
+
+func (s *addrSegment) getAddrs(t thread.ID, p thread.LogID) (map[string]*expiringAddr, bool) {
 	lmap, found := s.addrs[t]
 	if lmap == nil {
 		return nil, found
@@ -46,12 +149,155 @@ func (s *addrSegment) getAddrs(t thread.ID, p peer.ID) (map[string]*expiringAddr
 	return amap, found
 }
 
-func (s *addrSegments) get(p peer.ID) *addrSegment {
+func (s *addrSegment) putAddrs(t thread.ID, p thread.LogID, amap map[string]*expiringAddr) {
+	if old, _ := s.getAddrs(t, p); old != nil {
+		for k := range old {
+			s.unindexAddr(t, p, k)
+		}
+	}
+	for k := range amap {
+		s.indexAddr(t, p, k)
+	}
+	if s.addrs[t] == nil {
+		s.addrs[t] = make(map[thread.LogID]map[string]*expiringAddr, 1)
+	}
+	s.addrs[t][p] = amap
+	s.dropExpiries(t, p)
+	if s.threads[p] == nil {
+		s.threads[p] = make(map[thread.ID]struct{}, 1)
+	}
+	s.threads[p][t] = struct{}{}
+}
+
+func (s *addrSegment) deleteAddrs(t thread.ID, p thread.LogID) {
+	s.dropExpiries(t, p)
+	if lmap := s.addrs[t]; lmap != nil {
+		for k := range lmap[p] {
+			s.unindexAddr(t, p, k)
+		}
+		delete(lmap, p)
+		if len(lmap) == 0 {
+			delete(s.addrs, t)
+		}
+	}
+	if tmap := s.threads[p]; tmap != nil {
+		delete(tmap, t)
+		if len(tmap) == 0 {
+			delete(s.threads, p)
+		}
+	}
+}
+
+// setAddr puts the address into addresses of the log.
+func (s *addrSegment) setAddr(t thread.ID, p thread.LogID, amap map[string]*expiringAddr, key string, a *expiringAddr) {
+	amap[key] = a
+	s.indexAddr(t, p, key)
+	s.expiring(t, p, amap, key, a.Expires)
+}
+
+// setExpiry changes the expiration time and TTL of an address of the log.
+func (s *addrSegment) setExpiry(t thread.ID, p thread.LogID, amap map[string]*expiringAddr, key string, exp time.Time, ttl time.Duration) {
+	a := amap[key]
+	a.Expires, a.TTL = exp, ttl
+	s.expiring(t, p, amap, key, exp)
+}
+
+func (s *addrSegment) dropExpiries(t thread.ID, p thread.LogID) {
+	if qmap := s.expiries[t]; qmap != nil {
+		delete(qmap, p)
+		if len(qmap) == 0 {
+			delete(s.expiries, t)
+		}
+	}
+}
+
+// deleteAddr removes the address from addresses of the log.
+func (s *addrSegment) deleteAddr(t thread.ID, p thread.LogID, amap map[string]*expiringAddr, key string) {
+	delete(amap, key)
+	s.unindexAddr(t, p, key)
+}
+
+func (s *addrSegment) indexAddr(t thread.ID, p thread.LogID, key string) {
+	if s.logs[key] == nil {
+		s.logs[key] = make(map[core.ThreadLog]struct{}, 1)
+	}
+	s.logs[key][core.ThreadLog{Thread: t, Log: p}] = struct{}{}
+}
+
+func (s *addrSegment) unindexAddr(t thread.ID, p thread.LogID, key string) {
+	if lmap := s.logs[key]; lmap != nil {
+		delete(lmap, core.ThreadLog{Thread: t, Log: p})
+		if len(lmap) == 0 {
+			delete(s.logs, key)
+		}
+	}
+}
+
+// makeRoom ensures there is room for an address of the log expiring at exp
+// by evicting the address expiring first. It returns false if the new
+// address would be the one to evict.
+func (s *addrSegment) makeRoom(t thread.ID, p thread.LogID, amap map[string]*expiringAddr, exp time.Time) bool {
+	if s.maxAddrs <= 0 || len(amap) < s.maxAddrs {
+		return true
+	}
+	q := s.expiries[t][p]
+	if q == nil {
+		q = s.queueExpiries(t, p, amap)
+	}
+	// entries of changed or deleted addresses are dropped on the way
+	for q.Len() > 0 {
+		first := (*q)[0]
+		if a, ok := amap[first.key]; ok && a.Expires.Equal(first.exp) {
+			if !first.exp.Before(exp) {
+				return false
+			}
+			s.deleteAddr(t, p, amap, first.key)
+			return true
+		}
+		heap.Pop(q)
+	}
+	return true
+}
+
+// queueExpiries rebuilds the expiry queue of the log from its addresses.
+func (s *addrSegment) queueExpiries(t thread.ID, p thread.LogID, amap map[string]*expiringAddr) *expiryQueue {
+	q := make(expiryQueue, 0, len(amap))
+	for k, a := range amap {
+		q = append(q, expiryEntry{key: k, exp: a.Expires})
+	}
+	heap.Init(&q)
+	if s.expiries[t] == nil {
+		s.expiries[t] = make(map[thread.LogID]*expiryQueue, 1)
+	}
+	s.expiries[t][p] = &q
+	return &q
+}
+
+// expiring records the expiration time of an address of the log, which is
+// only tracked for logs with a limited number of addresses.
+func (s *addrSegment) expiring(t thread.ID, p thread.LogID, amap map[string]*expiringAddr, key string, exp time.Time) {
+	if s.maxAddrs <= 0 {
+		return
+	}
+	q := s.expiries[t][p]
+	if q == nil {
+		s.queueExpiries(t, p, amap)
+		return
+	}
+	heap.Push(q, expiryEntry{key: key, exp: exp})
+	// stale entries are bounded by rebuilding the queue
+	if q.Len() > 2*len(amap)+16 {
+		s.queueExpiries(t, p, amap)
+	}
+}
+
+func (s *addrSegments) get(p thread.LogID) *addrSegment {
 	return s[p[len(p)-1]]
 }
 
 // memoryAddrBook manages addresses.
 type memoryAddrBook struct {
+	opts     Options
 	segments addrSegments
 
 	ctx    context.Context
@@ -64,12 +310,19 @@ type memoryAddrBook struct {
 var _ core.AddrBook = (*memoryAddrBook)(nil)
 
 func NewAddrBook() core.AddrBook {
+	return NewAddrBookWithOptions(DefaultOpts())
+}
+
+// NewAddrBookWithOptions returns an address book keeping at most
+// o.MaxAddrsPerLog addresses of a log.
+func NewAddrBookWithOptions(o Options) core.AddrBook {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	ab := &memoryAddrBook{
+		opts: o,
 		segments: func() (ret addrSegments) {
 			for i := range ret {
-				ret[i] = &addrSegment{addrs: make(map[thread.ID]map[peer.ID]map[string]*expiringAddr)}
+				ret[i] = newAddrSegment(o.MaxAddrsPerLog)
 			}
 			return ret
 		}(),
@@ -115,23 +368,21 @@ func (mab *memoryAddrBook) gc() {
 			for p, amap := range pmap {
 				for k, a := range amap {
 					if a.ExpiredBy(now) {
-						delete(amap, k)
+						s.deleteAddr(t, p, amap, k)
 					}
 				}
 				if len(amap) == 0 {
-					delete(s.addrs[t], p)
+					s.deleteAddrs(t, p)
+					s.deleteRecord(t, p)
 				}
 			}
-			if len(pmap) == 0 {
-				delete(s.addrs, t)
-			}
 		}
 		s.Unlock()
 	}
 }
 
-func (mab *memoryAddrBook) LogsWithAddrs(t thread.ID) (peer.IDSlice, error) {
-	var pids peer.IDSlice
+func (mab *memoryAddrBook) LogsWithAddrs(t thread.ID) (thread.LogIDSlice, error) {
+	var pids thread.LogIDSlice
 	for _, s := range mab.segments {
 		s.RLock()
 		for pid := range s.addrs[t] {
@@ -159,15 +410,47 @@ func (mab *memoryAddrBook) ThreadsFromAddrs() (thread.IDSlice, error) {
 	return tids, nil
 }
 
+func (mab *memoryAddrBook) ThreadsWithLogAddrs(p thread.LogID) (thread.IDSlice, error) {
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+	tids := make(thread.IDSlice, 0, len(s.threads[p]))
+	for t := range s.threads[p] {
+		tids = append(tids, t)
+	}
+	return tids, nil
+}
+
+func (mab *memoryAddrBook) LogsWithAddr(addr ma.Multiaddr) ([]core.ThreadLog, error) {
+	var (
+		key  = string(addr.Bytes())
+		logs []core.ThreadLog
+	)
+	for _, s := range mab.segments {
+		s.RLock()
+		for tl := range s.logs[key] {
+			logs = append(logs, tl)
+		}
+		s.RUnlock()
+	}
+	return logs, nil
+}
+
 // AddAddr calls AddAddrs(t, p, []ma.Multiaddr{addr}, ttl)
-func (mab *memoryAddrBook) AddAddr(t thread.ID, p peer.ID, addr ma.Multiaddr, ttl time.Duration) error {
+func (mab *memoryAddrBook) AddAddr(t thread.ID, p thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
 	return mab.AddAddrs(t, p, []ma.Multiaddr{addr}, ttl)
 }
 
 // AddAddrs gives memoryAddrBook addresses to use, with a given ttl
 // (time-to-live), after which the address is no longer valid.
 // This function never reduces the TTL or expiration of an address.
-func (mab *memoryAddrBook) AddAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) error {
+func (mab *memoryAddrBook) AddAddrs(t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	return mab.AddAddrsFromSource(t, p, addrs, ttl, core.AddrSourceUnknown)
+}
+
+// AddAddrsFromSource works like AddAddrs, additionally recording the source
+// of addresses. Known addresses keep their source if src is unknown.
+func (mab *memoryAddrBook) AddAddrsFromSource(t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) error {
 	// if ttl is zero, exit. nothing to do.
 	if ttl <= 0 {
 		return nil
@@ -177,15 +460,45 @@ func (mab *memoryAddrBook) AddAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr
 	s.Lock()
 	defer s.Unlock()
 
+	mab.addAddrs(s, t, p, addrs, ttl, src)
+	return nil
+}
+
+// AddLogAddrsBulk adds addresses of many logs, locking every segment once.
+func (mab *memoryAddrBook) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	bySegment := make(map[*addrSegment][]core.ThreadLogAddrs)
+	for _, e := range entries {
+		s := mab.segments.get(e.Log)
+		bySegment[s] = append(bySegment[s], e)
+	}
+	for s, es := range bySegment {
+		s.Lock()
+		for _, e := range es {
+			mab.addAddrs(s, e.Thread, e.Log, e.Addrs, ttl, core.AddrSourceUnknown)
+		}
+		s.Unlock()
+	}
+	return nil
+}
+
+// addAddrs adds addresses of the log to the segment. To be called within
+// the segment lock.
+func (mab *memoryAddrBook) addAddrs(s *addrSegment, t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) {
+	now := time.Now()
+	if s.certified(t, p, now) != nil {
+		// certified addresses beat uncertified ones
+		return
+	}
 	amap, _ := s.getAddrs(t, p)
 	if amap == nil {
-		if s.addrs[t] == nil {
-			s.addrs[t] = make(map[peer.ID]map[string]*expiringAddr, 1)
-		}
 		amap = make(map[string]*expiringAddr, len(addrs))
-		s.addrs[t][p] = amap
+		s.putAddrs(t, p, amap)
 	}
-	exp := time.Now().Add(ttl)
+	exp := now.Add(ttl)
 	for _, a := range addrs {
 		if a == nil {
 			log.Warnf("was passed nil multiaddr for %s", p)
@@ -194,45 +507,50 @@ func (mab *memoryAddrBook) AddAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr
 		asBytes := a.Bytes()
 		x, found := amap[string(asBytes)] // won't allocate.
 		if !found {
+			if !s.makeRoom(t, p, amap, exp) {
+				log.Debugf("address limit of %s reached, dropping %s", p, a)
+				continue
+			}
 			// not found, save and announce it.
-			amap[string(asBytes)] = &expiringAddr{Addr: a, Expires: exp, TTL: ttl}
-			mab.subManager.BroadcastAddr(p, a)
+			s.setAddr(t, p, amap, string(asBytes), &expiringAddr{Addr: a, Expires: exp, TTL: ttl, Source: src})
+			mab.subManager.BroadcastLogAddr(t, p, a)
 		} else {
+			if src != core.AddrSourceUnknown {
+				x.Source = src
+			}
 			// Update expiration/TTL independently.
 			// We never want to reduce either.
 			if ttl > x.TTL {
 				x.TTL = ttl
 			}
 			if exp.After(x.Expires) {
-				x.Expires = exp
+				s.setExpiry(t, p, amap, string(asBytes), exp, x.TTL)
 			}
 		}
 	}
-	return nil
 }
 
 // SetAddr calls mgr.SetAddrs(t, p, addr, ttl)
-func (mab *memoryAddrBook) SetAddr(t thread.ID, p peer.ID, addr ma.Multiaddr, ttl time.Duration) error {
+func (mab *memoryAddrBook) SetAddr(t thread.ID, p thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
 	return mab.SetAddrs(t, p, []ma.Multiaddr{addr}, ttl)
 }
 
 // SetAddrs sets the ttl on addresses. This clears any TTL there previously.
 // This is used when we receive the best estimate of the validity of an address.
-func (mab *memoryAddrBook) SetAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) error {
+func (mab *memoryAddrBook) SetAddrs(t thread.ID, p thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
 	s := mab.segments.get(p)
 	s.Lock()
 	defer s.Unlock()
 
 	amap, _ := s.getAddrs(t, p)
 	if amap == nil {
-		if s.addrs[t] == nil {
-			s.addrs[t] = make(map[peer.ID]map[string]*expiringAddr, 1)
-		}
 		amap = make(map[string]*expiringAddr, len(addrs))
-		s.addrs[t][p] = amap
+		s.putAddrs(t, p, amap)
 	}
 
-	exp := time.Now().Add(ttl)
+	now := time.Now()
+	certified := s.certified(t, p, now) != nil
+	exp := now.Add(ttl)
 	for _, a := range addrs {
 		if a == nil {
 			log.Warnf("was passed nil multiaddr for %s", p)
@@ -242,10 +560,21 @@ func (mab *memoryAddrBook) SetAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr
 		// re-set all of them for new ttl.
 		aBytes := a.Bytes()
 		if ttl > 0 {
-			amap[string(aBytes)] = &expiringAddr{Addr: a, Expires: exp, TTL: ttl}
-			mab.subManager.BroadcastAddr(p, a)
+			if _, found := amap[string(aBytes)]; found {
+				// keep the source and dial quality
+				s.setExpiry(t, p, amap, string(aBytes), exp, ttl)
+			} else if certified {
+				// only certified addresses may be updated
+				continue
+			} else if s.makeRoom(t, p, amap, exp) {
+				s.setAddr(t, p, amap, string(aBytes), &expiringAddr{Addr: a, Expires: exp, TTL: ttl})
+			} else {
+				log.Debugf("address limit of %s reached, dropping %s", p, a)
+				continue
+			}
+			mab.subManager.BroadcastLogAddr(t, p, a)
 		} else {
-			delete(amap, string(aBytes))
+			s.deleteAddr(t, p, amap, string(aBytes))
 		}
 	}
 	return nil
@@ -253,7 +582,7 @@ func (mab *memoryAddrBook) SetAddrs(t thread.ID, p peer.ID, addrs []ma.Multiaddr
 
 // UpdateAddrs updates the addresses associated with the given peer that have
 // the given oldTTL to have the given newTTL.
-func (mab *memoryAddrBook) UpdateAddrs(t thread.ID, p peer.ID, oldTTL time.Duration, newTTL time.Duration) error {
+func (mab *memoryAddrBook) UpdateAddrs(t thread.ID, p thread.LogID, oldTTL time.Duration, newTTL time.Duration) error {
 	s := mab.segments.get(p)
 	s.Lock()
 	defer s.Unlock()
@@ -266,16 +595,14 @@ func (mab *memoryAddrBook) UpdateAddrs(t thread.ID, p peer.ID, oldTTL time.Durat
 	exp := time.Now().Add(newTTL)
 	for k, a := range amap {
 		if oldTTL == a.TTL {
-			a.TTL = newTTL
-			a.Expires = exp
-			amap[k] = a
+			s.setExpiry(t, p, amap, k, exp, newTTL)
 		}
 	}
 	return nil
 }
 
 // Addrs returns all known (and valid) addresses for a given log
-func (mab *memoryAddrBook) Addrs(t thread.ID, p peer.ID) ([]ma.Multiaddr, error) {
+func (mab *memoryAddrBook) Addrs(t thread.ID, p thread.LogID) ([]ma.Multiaddr, error) {
 	s := mab.segments.get(p)
 	s.RLock()
 	defer s.RUnlock()
@@ -296,25 +623,179 @@ func (mab *memoryAddrBook) Addrs(t thread.ID, p peer.ID) ([]ma.Multiaddr, error)
 	return good, nil
 }
 
+// ForEachLogAddr calls fn with each known (and valid) address of a given log
+// until it returns false.
+func (mab *memoryAddrBook) ForEachLogAddr(t thread.ID, p thread.LogID, fn func(ma.Multiaddr) bool) error {
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+
+	amap, found := s.getAddrs(t, p)
+	if !found {
+		return nil
+	}
+
+	now := time.Now()
+	for _, m := range amap {
+		if !m.ExpiredBy(now) && !fn(m.Addr) {
+			break
+		}
+	}
+	return nil
+}
+
+// AddrsWithSource returns all known (and valid) addresses for a given log
+// along with their expiration and source.
+func (mab *memoryAddrBook) AddrsWithSource(t thread.ID, p thread.LogID) ([]core.ExpiredAddress, error) {
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+
+	amap, found := s.getAddrs(t, p)
+	if !found {
+		return nil, nil
+	}
+
+	now := time.Now()
+	good := make([]core.ExpiredAddress, 0, len(amap))
+	for _, m := range amap {
+		if !m.ExpiredBy(now) {
+			good = append(good, m.expired())
+		}
+	}
+	return good, nil
+}
+
+// SortedAddrs returns all known (and valid) addresses for a given log, best first.
+func (mab *memoryAddrBook) SortedAddrs(t thread.ID, p thread.LogID) ([]ma.Multiaddr, error) {
+	addrs, err := mab.AddrsWithSource(t, p)
+	if err != nil {
+		return nil, err
+	}
+	core.SortAddrs(addrs, time.Now(), mab.dialFreshness())
+	sorted := make([]ma.Multiaddr, len(addrs))
+	for i, a := range addrs {
+		sorted[i] = a.Addr
+	}
+	return sorted, nil
+}
+
+// dialFreshness returns the period dials of addresses are considered fresh.
+func (mab *memoryAddrBook) dialFreshness() time.Duration {
+	if mab.opts.AddrDialFreshness > 0 {
+		return mab.opts.AddrDialFreshness
+	}
+	return core.DefaultAddrDialFreshness
+}
+
+// RecordDial stores the time and round-trip time of a successful dial.
+func (mab *memoryAddrBook) RecordDial(t thread.ID, p thread.LogID, addr ma.Multiaddr, rtt time.Duration) error {
+	s := mab.segments.get(p)
+	s.Lock()
+	defer s.Unlock()
+
+	amap, _ := s.getAddrs(t, p)
+	if x, found := amap[string(addr.Bytes())]; found {
+		x.LastDial, x.RTT = time.Now(), rtt
+	}
+	return nil
+}
+
 // ClearAddrs removes all previously stored addresses
-func (mab *memoryAddrBook) ClearAddrs(t thread.ID, p peer.ID) error {
+func (mab *memoryAddrBook) ClearAddrs(t thread.ID, p thread.LogID) error {
 	s := mab.segments.get(p)
 	s.Lock()
 	defer s.Unlock()
 
-	lmap := s.addrs[t]
-	if lmap != nil {
-		delete(lmap, p)
-		if len(lmap) == 0 {
-			delete(s.addrs, t)
+	s.deleteAddrs(t, p)
+	s.deleteRecord(t, p)
+	return nil
+}
+
+// ConsumeLogRecord replaces addresses of the log with the ones of the signed
+// record, unless a record with the same or higher sequence number is valid.
+func (mab *memoryAddrBook) ConsumeLogRecord(t thread.ID, env *record.Envelope, ttl time.Duration) (bool, error) {
+	rec, raw, err := core.OpenLogRecord(env)
+	if err != nil {
+		return false, err
+	}
+	if ttl <= 0 {
+		return false, nil
+	}
+	p := thread.LogIDFromPeer(rec.PeerID)
+
+	s := mab.segments.get(p)
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	if last := s.certified(t, p, now); last != nil && last.Seq >= rec.Seq {
+		return false, nil
+	}
+
+	old, _ := s.getAddrs(t, p)
+	amap := make(map[string]*expiringAddr, len(rec.Addrs))
+	exp := now.Add(ttl)
+	for _, a := range rec.Addrs {
+		key := string(a.Bytes())
+		if x, found := old[key]; found {
+			x.Expires, x.TTL = exp, ttl
+			amap[key] = x
+		} else {
+			amap[key] = &expiringAddr{Addr: a, Expires: exp, TTL: ttl}
+			mab.subManager.BroadcastLogAddr(t, p, a)
 		}
 	}
-	return nil
+	s.putAddrs(t, p, amap)
+	s.setRecord(t, p, &certifiedRecord{Envelope: env, Raw: raw, Seq: rec.Seq})
+	return true, nil
+}
+
+// LogRecord returns the signed record of the log if it has valid certified addresses.
+func (mab *memoryAddrBook) LogRecord(t thread.ID, p thread.LogID) (*record.Envelope, error) {
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+
+	if rec := s.certified(t, p, time.Now()); rec != nil {
+		return rec.Envelope, nil
+	}
+	return nil, nil
 }
 
 // AddrStream returns a channel on which all new addresses discovered for a
 // given peer ID will be published.
-func (mab *memoryAddrBook) AddrStream(ctx context.Context, t thread.ID, p peer.ID) (<-chan ma.Multiaddr, error) {
+func (mab *memoryAddrBook) AddrStream(ctx context.Context, t thread.ID, p thread.LogID) (<-chan ma.Multiaddr, error) {
+	out, _, err := mab.ControlledAddrStream(ctx, t, p)
+	return out, err
+}
+
+// ThreadAddrStream returns a channel on which addresses of all logs of the
+// thread are published.
+func (mab *memoryAddrBook) ThreadAddrStream(ctx context.Context, t thread.ID) (<-chan core.LogAddr, error) {
+	return mab.subManager.ThreadAddrStream(ctx, t, func() ([]core.LogAddr, error) {
+		var initial []core.LogAddr
+		for _, s := range mab.segments {
+			s.RLock()
+			for p, amap := range s.addrs[t] {
+				for _, a := range amap {
+					initial = append(initial, core.LogAddr{Log: p, Addr: a.Addr})
+				}
+			}
+			s.RUnlock()
+		}
+		return initial, nil
+	})
+}
+
+// AddrSubscribers returns the number of active subscribers of address streams.
+func (mab *memoryAddrBook) AddrSubscribers() int {
+	return mab.subManager.AddrSubscribers()
+}
+
+// ControlledAddrStream works like AddrStream, but the returned stream can be
+// paused and resumed.
+func (mab *memoryAddrBook) ControlledAddrStream(ctx context.Context, t thread.ID, p thread.LogID) (<-chan ma.Multiaddr, core.AddrStreamControl, error) {
 	s := mab.segments.get(p)
 	s.RLock()
 	defer s.RUnlock()
@@ -325,12 +806,14 @@ func (mab *memoryAddrBook) AddrStream(ctx context.Context, t thread.ID, p peer.I
 		initial = append(initial, a.Addr)
 	}
 
-	return mab.subManager.AddrStream(ctx, p, initial)
+	out, ctl := mab.subManager.ControlledAddrStream(ctx, p, initial)
+	return out, ctl, nil
 }
 
 func (mab *memoryAddrBook) DumpAddrs() (core.DumpAddrBook, error) {
 	var dump = core.DumpAddrBook{
-		Data: make(map[thread.ID]map[peer.ID][]core.ExpiredAddress, 256),
+		Data:    make(map[thread.ID]map[thread.LogID][]core.ExpiredAddress, 256),
+		Records: make(map[thread.ID]map[thread.LogID][]byte),
 	}
 
 	mab.gcLock.Lock()
@@ -340,17 +823,20 @@ func (mab *memoryAddrBook) DumpAddrs() (core.DumpAddrBook, error) {
 		for tid, logs := range segment.addrs {
 			lm, exist := dump.Data[tid]
 			if !exist {
-				lm = make(map[peer.ID][]core.ExpiredAddress, len(logs))
+				lm = make(map[thread.LogID][]core.ExpiredAddress, len(logs))
 				dump.Data[tid] = lm
 			}
 
 			for lid, addrMap := range logs {
+				if rec := segment.certified(tid, lid, now); rec != nil {
+					if dump.Records[tid] == nil {
+						dump.Records[tid] = make(map[thread.LogID][]byte)
+					}
+					dump.Records[tid][lid] = rec.Raw
+				}
 				for _, ap := range addrMap {
 					if ap != nil && !ap.ExpiredBy(now) {
-						lm[lid] = append(lm[lid], core.ExpiredAddress{
-							Addr:    ap.Addr,
-							Expires: ap.Expires,
-						})
+						lm[lid] = append(lm[lid], ap.expired())
 					}
 				}
 			}
@@ -370,9 +856,7 @@ func (mab *memoryAddrBook) RestoreAddrs(dump core.DumpAddrBook) error {
 
 	// reset segments
 	for i := range mab.segments {
-		mab.segments[i] = &addrSegment{
-			addrs: make(map[thread.ID]map[peer.ID]map[string]*expiringAddr, len(mab.segments[i].addrs)),
-		}
+		mab.segments[i] = newAddrSegment(mab.opts.MaxAddrsPerLog)
 	}
 
 	var now = time.Now()
@@ -381,152 +865,312 @@ func (mab *memoryAddrBook) RestoreAddrs(dump core.DumpAddrBook) error {
 			s := mab.segments.get(lid)
 			am, _ := s.getAddrs(tid, lid)
 			if am == nil {
-				if s.addrs[tid] == nil {
-					s.addrs[tid] = make(map[peer.ID]map[string]*expiringAddr, 1)
-				}
 				am = make(map[string]*expiringAddr, len(addrs))
-				s.addrs[tid][lid] = am
+				s.putAddrs(tid, lid, am)
 			}
 
 			for _, rec := range addrs {
 				if rec.Expires.After(now) {
-					am[string(rec.Addr.Bytes())] = &expiringAddr{
-						Addr:    rec.Addr,
-						TTL:     rec.Expires.Sub(now),
-						Expires: rec.Expires,
-					}
+					s.setAddr(tid, lid, am, string(rec.Addr.Bytes()), &expiringAddr{
+						Addr:     rec.Addr,
+						TTL:      rec.Expires.Sub(now),
+						Expires:  rec.Expires,
+						Source:   rec.Source,
+						LastDial: rec.LastDial,
+						RTT:      rec.RTT,
+					})
 				}
 			}
 		}
 	}
+
+	for tid, logs := range dump.Records {
+		for lid, raw := range logs {
+			env, rec, err := core.DecodeLogRecord(raw)
+			if err != nil {
+				return fmt.Errorf("decoding record of log %s: %w", lid, err)
+			}
+			mab.segments.get(lid).setRecord(tid, lid, &certifiedRecord{Envelope: env, Raw: raw, Seq: rec.Seq})
+		}
+	}
 	return nil
 }
 
-type addrSub struct {
-	pubch chan ma.Multiaddr
-	ctx   context.Context
+// addrTopic holds recent addresses broadcast for a log or a thread in a ring
+// buffer. Subscribers read it at their own pace by keeping a cursor, so
+// broadcasting never waits for them.
+type addrTopic struct {
+	// ring grows up to size addresses before wrapping around.
+	ring []core.LogAddr
+	size uint64
+	// seq is the sequence number of the next address.
+	seq uint64
+	// notify is closed and replaced on every broadcast.
+	notify chan struct{}
+	subs   int
 }
 
-func (s *addrSub) pubAddr(a ma.Multiaddr) {
-	select {
-	case s.pubch <- a:
-	case <-s.ctx.Done():
+func (t *addrTopic) publish(la core.LogAddr) {
+	if uint64(len(t.ring)) < t.size {
+		t.ring = append(t.ring, la)
+	} else {
+		t.ring[t.seq%t.size] = la
 	}
+	t.seq++
+	close(t.notify)
+	t.notify = make(chan struct{})
+}
+
+// read returns addresses broadcast since the cursor, along with the number of
+// addresses overwritten before the subscriber got to them. To be called
+// within the manager lock.
+func (t *addrTopic) read(cursor uint64) (addrs []core.LogAddr, next uint64, dropped uint64) {
+	if t.seq-cursor > t.size {
+		dropped = t.seq - cursor - t.size
+		cursor = t.seq - t.size
+	}
+	for ; cursor < t.seq; cursor++ {
+		addrs = append(addrs, t.ring[cursor%t.size])
+	}
+	return addrs, cursor, dropped
 }
 
 // An abstracted, pub-sub manager for address streams. Extracted from
 // memoryAddrBook in order to support additional implementations.
 type AddrSubManager struct {
-	mu   sync.RWMutex
-	subs map[peer.ID][]*addrSub
+	mu sync.Mutex
+	// topics are keyed by thread.LogID for log streams and thread.ID for thread streams.
+	topics map[interface{}]*addrTopic
 }
 
 // NewAddrSubManager initializes an AddrSubManager.
 func NewAddrSubManager() *AddrSubManager {
 	return &AddrSubManager{
-		subs: make(map[peer.ID][]*addrSub),
+		topics: make(map[interface{}]*addrTopic),
 	}
 }
 
-// Used internally by the address stream coroutine to remove a subscription
-// from the manager.
-func (mgr *AddrSubManager) removeSub(p peer.ID, s *addrSub) {
+func (mgr *AddrSubManager) subscribe(key interface{}) (*addrTopic, uint64) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
-	subs := mgr.subs[p]
-	if len(subs) == 1 {
-		if subs[0] != s {
-			return
+	t, ok := mgr.topics[key]
+	if !ok {
+		size := MaxPausedAddrs
+		if size < 1 {
+			size = 1
 		}
-		delete(mgr.subs, p)
-		return
+		t = &addrTopic{size: uint64(size), notify: make(chan struct{})}
+		mgr.topics[key] = t
 	}
+	t.subs++
+	return t, t.seq
+}
 
-	for i, v := range subs {
-		if v == s {
-			subs[i] = subs[len(subs)-1]
-			subs[len(subs)-1] = nil
-			mgr.subs[p] = subs[:len(subs)-1]
-			return
-		}
+func (mgr *AddrSubManager) unsubscribe(key interface{}, t *addrTopic) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	t.subs--
+	if t.subs == 0 && mgr.topics[key] == t {
+		delete(mgr.topics, key)
 	}
 }
 
-// BroadcastAddr broadcasts a new address to all subscribed streams.
-func (mgr *AddrSubManager) BroadcastAddr(p peer.ID, addr ma.Multiaddr) {
-	mgr.mu.RLock()
-	defer mgr.mu.RUnlock()
+// AddrSubscribers returns the number of active subscribers of all streams.
+func (mgr *AddrSubManager) AddrSubscribers() int {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
 
-	if subs, ok := mgr.subs[p]; ok {
-		for _, sub := range subs {
-			sub.pubAddr(addr)
-		}
+	var n int
+	for _, t := range mgr.topics {
+		n += t.subs
 	}
+	return n
 }
 
-// AddrStream creates a new subscription for a given peer ID, pre-populating the
-// channel with any addresses we might already have on file.
-func (mgr *AddrSubManager) AddrStream(ctx context.Context, p peer.ID, initial []ma.Multiaddr) (<-chan ma.Multiaddr, error) {
-	sub := &addrSub{pubch: make(chan ma.Multiaddr), ctx: ctx}
-	out := make(chan ma.Multiaddr)
+func (mgr *AddrSubManager) read(key interface{}, t *addrTopic, cursor uint64) ([]core.LogAddr, uint64, <-chan struct{}) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	addrs, next, dropped := t.read(cursor)
+	if dropped > 0 {
+		log.Warnf("address stream for %s is lagging behind, dropped %d addresses", key, dropped)
+	}
+	return addrs, next, t.notify
+}
 
+// BroadcastAddr broadcasts a new address to all streams of the peer. It never
+// blocks on slow subscribers.
+func (mgr *AddrSubManager) BroadcastAddr(p thread.LogID, addr ma.Multiaddr) {
 	mgr.mu.Lock()
-	if _, ok := mgr.subs[p]; ok {
-		mgr.subs[p] = append(mgr.subs[p], sub)
-	} else {
-		mgr.subs[p] = []*addrSub{sub}
+	defer mgr.mu.Unlock()
+
+	if t, ok := mgr.topics[p]; ok {
+		t.publish(core.LogAddr{Log: p, Addr: addr})
 	}
-	mgr.mu.Unlock()
+}
+
+// BroadcastLogAddr broadcasts a new address to all streams of the log and
+// of the thread it belongs to.
+func (mgr *AddrSubManager) BroadcastLogAddr(tid thread.ID, p thread.LogID, addr ma.Multiaddr) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	la := core.LogAddr{Log: p, Addr: addr}
+	if t, ok := mgr.topics[p]; ok {
+		t.publish(la)
+	}
+	if t, ok := mgr.topics[tid]; ok {
+		t.publish(la)
+	}
+}
+
+// AddrStream creates a new subscription for a given peer ID, pre-populating the
+// channel with any addresses we might already have on file.
+func (mgr *AddrSubManager) AddrStream(ctx context.Context, p thread.LogID, initial []ma.Multiaddr) (<-chan ma.Multiaddr, error) {
+	out, _ := mgr.ControlledAddrStream(ctx, p, initial)
+	return out, nil
+}
+
+// ControlledAddrStream works like AddrStream, but also returns a handle able to
+// pause and resume delivery. Streams that are paused or lagging behind by more
+// than MaxPausedAddrs new addresses lose the oldest ones.
+func (mgr *AddrSubManager) ControlledAddrStream(ctx context.Context, p thread.LogID, initial []ma.Multiaddr) (<-chan ma.Multiaddr, core.AddrStreamControl) {
+	ctl := &addrStreamControl{ch: make(chan bool), ctx: ctx}
+	out := make(chan ma.Multiaddr)
+	topic, cursor := mgr.subscribe(p)
 
 	sort.Sort(addr.AddrList(initial))
 
 	go func(buffer []ma.Multiaddr) {
 		defer close(out)
+		defer mgr.unsubscribe(p, topic)
 
 		sent := make(map[string]bool, len(buffer))
-		var outch chan ma.Multiaddr
-
 		for _, a := range buffer {
 			sent[string(a.Bytes())] = true
 		}
 
-		var next ma.Multiaddr
-		if len(buffer) > 0 {
-			next = buffer[0]
-			buffer = buffer[1:]
-			outch = out
-		}
-
+		var paused bool
 		for {
+			var (
+				outch  chan ma.Multiaddr
+				next   ma.Multiaddr
+				notify <-chan struct{}
+			)
+			if !paused && len(buffer) == 0 {
+				var addrs []core.LogAddr
+				addrs, cursor, notify = mgr.read(p, topic, cursor)
+				for _, la := range addrs {
+					if !sent[string(la.Addr.Bytes())] {
+						sent[string(la.Addr.Bytes())] = true
+						buffer = append(buffer, la.Addr)
+					}
+				}
+			}
+			if len(buffer) > 0 && !paused {
+				next = buffer[0]
+				outch = out
+				// new addresses are read once the buffer is drained
+				notify = nil
+			}
+
 			select {
 			case outch <- next:
-				if len(buffer) > 0 {
-					next = buffer[0]
-					buffer = buffer[1:]
-				} else {
-					outch = nil
-					next = nil
-				}
-			case naddr := <-sub.pubch:
-				if sent[string(naddr.Bytes())] {
-					continue
-				}
+				buffer = buffer[1:]
+			case <-notify:
+			case paused = <-ctl.ch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(initial)
 
-				sent[string(naddr.Bytes())] = true
-				if next == nil {
-					next = naddr
-					outch = out
-				} else {
-					buffer = append(buffer, naddr)
+	return out, ctl
+}
+
+// ThreadAddrStream creates a new subscription delivering addresses of all logs
+// of the thread. The stream is subscribed before loading initial addresses,
+// so none gets lost in between.
+func (mgr *AddrSubManager) ThreadAddrStream(ctx context.Context, tid thread.ID, initial func() ([]core.LogAddr, error)) (<-chan core.LogAddr, error) {
+	topic, cursor := mgr.subscribe(tid)
+	buffer, err := initial()
+	if err != nil {
+		mgr.unsubscribe(tid, topic)
+		return nil, err
+	}
+
+	out := make(chan core.LogAddr)
+	go func() {
+		defer close(out)
+		defer mgr.unsubscribe(tid, topic)
+
+		sent := make(map[string]bool, len(buffer))
+		filter := func(addrs []core.LogAddr) []core.LogAddr {
+			fresh := addrs[:0]
+			for _, la := range addrs {
+				key := string(la.Log) + string(la.Addr.Bytes())
+				if !sent[key] {
+					sent[key] = true
+					fresh = append(fresh, la)
 				}
+			}
+			return fresh
+		}
+		buffer = filter(buffer)
+
+		for {
+			var (
+				outch  chan core.LogAddr
+				next   core.LogAddr
+				notify <-chan struct{}
+			)
+			if len(buffer) == 0 {
+				var addrs []core.LogAddr
+				addrs, cursor, notify = mgr.read(tid, topic, cursor)
+				buffer = filter(addrs)
+			}
+			if len(buffer) > 0 {
+				next = buffer[0]
+				outch = out
+				notify = nil
+			}
+
+			select {
+			case outch <- next:
+				buffer = buffer[1:]
+			case <-notify:
 			case <-ctx.Done():
-				mgr.removeSub(p, sub)
 				return
 			}
 		}
+	}()
+	return out, nil
+}
 
-	}(initial)
+// MaxPausedAddrs is the maximum number of new addresses a paused or lagging
+// stream may fall behind before the oldest of them are dropped.
+var MaxPausedAddrs = 1024
 
-	return out, nil
+type addrStreamControl struct {
+	ch  chan bool
+	ctx context.Context
+}
+
+var _ core.AddrStreamControl = (*addrStreamControl)(nil)
+
+func (c *addrStreamControl) Pause() {
+	c.set(true)
+}
+
+func (c *addrStreamControl) Resume() {
+	c.set(false)
+}
+
+func (c *addrStreamControl) set(paused bool) {
+	select {
+	case c.ch <- paused:
+	case <-c.ctx.Done():
+	}
 }
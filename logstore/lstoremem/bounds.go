@@ -0,0 +1,286 @@
+package lstoremem
+
+import (
+	"container/list"
+	"sync"
+
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	lstore "github.com/textileio/go-threads/logstore"
+)
+
+// Bounds caps memory used by a logstore. Once a bound is exceeded, least
+// recently used threads are evicted, so that the logstore can be used as a
+// cache in front of a persistent one.
+type Bounds struct {
+	// MaxThreads caps the number of threads, unbounded if zero.
+	MaxThreads int
+
+	// MaxEntries caps the total number of keys, addresses, heads and
+	// metadata entries of all threads, unbounded if zero.
+	MaxEntries int
+
+	// OnEvict is called with the ID of every evicted thread, if set.
+	OnEvict func(thread.ID)
+}
+
+// NewBoundedLogstore creates an in-memory logstore evicting least recently
+// used threads to stay within the bounds. Threads being used are never
+// evicted, so a single thread may exceed MaxEntries on its own.
+func NewBoundedLogstore(b Bounds, opts ...lstore.Option) core.Logstore {
+	e := &evictor{
+		bounds: b,
+		kb:     NewKeyBook(),
+		ab:     NewAddrBook(),
+		hb:     NewHeadBook(),
+		md:     NewThreadMetadata(),
+		lru:    list.New(),
+		items:  make(map[thread.ID]*list.Element),
+	}
+	return lstore.NewLogstore(e.kb, e.ab, e.hb, e.md, append(opts, lstore.WithObserver(e))...)
+}
+
+type lruItem struct {
+	id      thread.ID
+	entries int
+}
+
+// evictor tracks use of threads by observing book operations and evicts
+// threads from the books once bounds are exceeded. It talks to the books
+// directly, as operations of the logstore may hold its lock meanwhile.
+type evictor struct {
+	bounds Bounds
+	kb     core.KeyBook
+	ab     core.AddrBook
+	hb     core.HeadBook
+	md     core.ThreadMetadata
+
+	lock    sync.Mutex
+	lru     *list.List // front is the most recently used
+	items   map[thread.ID]*list.Element
+	entries int
+}
+
+var _ lstore.Observer = (*evictor)(nil)
+
+func (e *evictor) Start(_, op string, t thread.ID) func(error) {
+	return func(err error) {
+		if err != nil {
+			return
+		}
+		write := lstore.IsWriteOp(op)
+		e.lock.Lock()
+		var evicted []thread.ID
+		switch {
+		case t.Defined() && write:
+			if err := e.recount(t); err != nil {
+				log.Errorf("error counting entries of thread %s: %v", t, err)
+			}
+			evicted = e.evict(t)
+		case t.Defined():
+			if el, ok := e.items[t]; ok {
+				e.lru.MoveToFront(el)
+			}
+		case write:
+			// e.g. restores and bulk writes may touch any thread
+			if err := e.recountAll(); err != nil {
+				log.Errorf("error counting entries of threads: %v", err)
+			}
+			evicted = e.evict(thread.Undef)
+		}
+		e.lock.Unlock()
+
+		if e.bounds.OnEvict != nil {
+			for _, id := range evicted {
+				e.bounds.OnEvict(id)
+			}
+		}
+	}
+}
+
+// recount updates entries of the thread and marks it as most recently used,
+// or stops tracking it if it has none left.
+func (e *evictor) recount(t thread.ID) error {
+	n, err := e.count(t)
+	if err != nil {
+		return err
+	}
+	el, ok := e.items[t]
+	switch {
+	case !ok && n == 0:
+		return nil
+	case !ok:
+		e.items[t] = e.lru.PushFront(&lruItem{id: t, entries: n})
+	case n == 0:
+		e.remove(el)
+		return nil
+	default:
+		item := el.Value.(*lruItem)
+		e.entries -= item.entries
+		item.entries = n
+		e.lru.MoveToFront(el)
+	}
+	e.entries += n
+	return nil
+}
+
+// recountAll updates entries of all threads, tracking new ones as most
+// recently used.
+func (e *evictor) recountAll() error {
+	ids := make(map[thread.ID]struct{}, len(e.items))
+	for id := range e.items {
+		ids[id] = struct{}{}
+	}
+	fromKeys, err := e.kb.ThreadsFromKeys()
+	if err != nil {
+		return err
+	}
+	fromAddrs, err := e.ab.ThreadsFromAddrs()
+	if err != nil {
+		return err
+	}
+	for _, id := range append(fromKeys, fromAddrs...) {
+		ids[id] = struct{}{}
+	}
+
+	for id := range ids {
+		n, err := e.count(id)
+		if err != nil {
+			return err
+		}
+		el, ok := e.items[id]
+		switch {
+		case !ok && n > 0:
+			e.items[id] = e.lru.PushFront(&lruItem{id: id, entries: n})
+			e.entries += n
+		case ok && n == 0:
+			e.remove(el)
+		case ok:
+			item := el.Value.(*lruItem)
+			e.entries += n - item.entries
+			item.entries = n
+		}
+	}
+	return nil
+}
+
+// count returns the number of entries of the thread.
+func (e *evictor) count(t thread.ID) (int, error) {
+	logs, err := e.logs(t)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if sk, err := e.kb.ServiceKey(t); err != nil {
+		return 0, err
+	} else if sk != nil {
+		n++
+	}
+	if rk, err := e.kb.ReadKey(t); err != nil {
+		return 0, err
+	} else if rk != nil {
+		n++
+	}
+	for l := range logs {
+		if pk, err := e.kb.PubKey(t, l); err != nil {
+			return 0, err
+		} else if pk != nil {
+			n++
+		}
+		if sk, err := e.kb.PrivKey(t, l); err != nil {
+			return 0, err
+		} else if sk != nil {
+			n++
+		}
+		if err := e.ab.ForEachLogAddr(t, l, func(_ ma.Multiaddr) bool {
+			n++
+			return true
+		}); err != nil {
+			return 0, err
+		}
+		heads, err := e.hb.Heads(t, l)
+		if err != nil {
+			return 0, err
+		}
+		n += len(heads)
+	}
+	keys, err := e.md.MetaKeys(t)
+	if err != nil {
+		return 0, err
+	}
+	return n + len(keys), nil
+}
+
+func (e *evictor) logs(t thread.ID) (map[thread.LogID]struct{}, error) {
+	set := make(map[thread.LogID]struct{})
+	withKeys, err := e.kb.LogsWithKeys(t)
+	if err != nil {
+		return nil, err
+	}
+	withAddrs, err := e.ab.LogsWithAddrs(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range append(withKeys, withAddrs...) {
+		set[l] = struct{}{}
+	}
+	return set, nil
+}
+
+// evict deletes least recently used threads other than the one in use
+// until bounds are met, and returns their IDs.
+func (e *evictor) evict(inUse thread.ID) []thread.ID {
+	var evicted []thread.ID
+	for e.exceeded() {
+		el := e.lru.Back()
+		if el == nil {
+			break
+		}
+		item := el.Value.(*lruItem)
+		if item.id == inUse {
+			break
+		}
+		if err := e.clear(item.id); err != nil {
+			log.Errorf("error evicting thread %s: %v", item.id, err)
+			break
+		}
+		e.remove(el)
+		evicted = append(evicted, item.id)
+	}
+	return evicted
+}
+
+func (e *evictor) exceeded() bool {
+	return e.bounds.MaxThreads > 0 && e.lru.Len() > e.bounds.MaxThreads ||
+		e.bounds.MaxEntries > 0 && e.entries > e.bounds.MaxEntries
+}
+
+func (e *evictor) remove(el *list.Element) {
+	item := e.lru.Remove(el).(*lruItem)
+	delete(e.items, item.id)
+	e.entries -= item.entries
+}
+
+// clear deletes all entries of the thread from the books.
+func (e *evictor) clear(t thread.ID) error {
+	logs, err := e.logs(t)
+	if err != nil {
+		return err
+	}
+	if err := e.kb.ClearKeys(t); err != nil {
+		return err
+	}
+	if err := e.md.ClearMetadata(t); err != nil {
+		return err
+	}
+	for l := range logs {
+		if err := e.ab.ClearAddrs(t, l); err != nil {
+			return err
+		}
+		if err := e.hb.ClearHeads(t, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,19 +4,22 @@ import (
 	"sync"
 
 	"github.com/ipfs/go-cid"
-	"github.com/libp2p/go-libp2p-core/peer"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 )
 
-type memoryHeadBook struct {
+type headSegments [256]*headSegment
+
+// headSegment holds heads of the threads hashed to it, so that writers
+// of different threads don't contend.
+type headSegment struct {
 	sync.RWMutex
 
-	heads map[thread.ID]map[peer.ID]map[cid.Cid]struct{}
+	heads map[thread.ID]map[thread.LogID]map[cid.Cid]struct{}
 }
 
-func (mhb *memoryHeadBook) getHeads(t thread.ID, p peer.ID) (map[cid.Cid]struct{}, bool) {
-	lmap, found := mhb.heads[t]
+func (s *headSegment) getHeads(t thread.ID, p thread.LogID) (map[cid.Cid]struct{}, bool) {
+	lmap, found := s.heads[t]
 	if lmap == nil {
 		return nil, found
 	}
@@ -24,29 +27,49 @@ func (mhb *memoryHeadBook) getHeads(t thread.ID, p peer.ID) (map[cid.Cid]struct{
 	return hmap, found
 }
 
+func (s *headSegment) putHeads(t thread.ID, p thread.LogID, hmap map[cid.Cid]struct{}) {
+	if s.heads[t] == nil {
+		s.heads[t] = make(map[thread.LogID]map[cid.Cid]struct{}, 1)
+	}
+	s.heads[t][p] = hmap
+}
+
+func (s *headSegments) get(t thread.ID) *headSegment {
+	if len(t) == 0 {
+		return s[0]
+	}
+	return s[t[len(t)-1]]
+}
+
+type memoryHeadBook struct {
+	segments headSegments
+}
+
 var _ core.HeadBook = (*memoryHeadBook)(nil)
 
 func NewHeadBook() core.HeadBook {
-	return &memoryHeadBook{
-		heads: map[thread.ID]map[peer.ID]map[cid.Cid]struct{}{},
+	mhb := &memoryHeadBook{}
+	for i := range mhb.segments {
+		mhb.segments[i] = &headSegment{
+			heads: make(map[thread.ID]map[thread.LogID]map[cid.Cid]struct{}),
+		}
 	}
+	return mhb
 }
 
-func (mhb *memoryHeadBook) AddHead(t thread.ID, p peer.ID, head cid.Cid) error {
+func (mhb *memoryHeadBook) AddHead(t thread.ID, p thread.LogID, head cid.Cid) error {
 	return mhb.AddHeads(t, p, []cid.Cid{head})
 }
 
-func (mhb *memoryHeadBook) AddHeads(t thread.ID, p peer.ID, heads []cid.Cid) error {
-	mhb.Lock()
-	defer mhb.Unlock()
+func (mhb *memoryHeadBook) AddHeads(t thread.ID, p thread.LogID, heads []cid.Cid) error {
+	s := mhb.segments.get(t)
+	s.Lock()
+	defer s.Unlock()
 
-	hmap, _ := mhb.getHeads(t, p)
+	hmap, _ := s.getHeads(t, p)
 	if hmap == nil {
-		if mhb.heads[t] == nil {
-			mhb.heads[t] = make(map[peer.ID]map[cid.Cid]struct{}, 1)
-		}
 		hmap = make(map[cid.Cid]struct{}, len(heads))
-		mhb.heads[t][p] = hmap
+		s.putHeads(t, p, hmap)
 	}
 
 	for _, h := range heads {
@@ -59,22 +82,17 @@ func (mhb *memoryHeadBook) AddHeads(t thread.ID, p peer.ID, heads []cid.Cid) err
 	return nil
 }
 
-func (mhb *memoryHeadBook) SetHead(t thread.ID, p peer.ID, head cid.Cid) error {
+func (mhb *memoryHeadBook) SetHead(t thread.ID, p thread.LogID, head cid.Cid) error {
 	return mhb.SetHeads(t, p, []cid.Cid{head})
 }
 
-func (mhb *memoryHeadBook) SetHeads(t thread.ID, p peer.ID, heads []cid.Cid) error {
-	mhb.Lock()
-	defer mhb.Unlock()
+func (mhb *memoryHeadBook) SetHeads(t thread.ID, p thread.LogID, heads []cid.Cid) error {
+	s := mhb.segments.get(t)
+	s.Lock()
+	defer s.Unlock()
 
-	hmap, _ := mhb.getHeads(t, p)
-	if hmap == nil {
-		if mhb.heads[t] == nil {
-			mhb.heads[t] = make(map[peer.ID]map[cid.Cid]struct{}, 1)
-		}
-	}
-	hmap = make(map[cid.Cid]struct{}, len(heads))
-	mhb.heads[t][p] = hmap
+	hmap := make(map[cid.Cid]struct{}, len(heads))
+	s.putHeads(t, p, hmap)
 
 	for _, h := range heads {
 		if !h.Defined() {
@@ -86,12 +104,13 @@ func (mhb *memoryHeadBook) SetHeads(t thread.ID, p peer.ID, heads []cid.Cid) err
 	return nil
 }
 
-func (mhb *memoryHeadBook) Heads(t thread.ID, p peer.ID) ([]cid.Cid, error) {
-	mhb.RLock()
-	defer mhb.RUnlock()
+func (mhb *memoryHeadBook) Heads(t thread.ID, p thread.LogID) ([]cid.Cid, error) {
+	s := mhb.segments.get(t)
+	s.RLock()
+	defer s.RUnlock()
 
 	var heads []cid.Cid
-	hmap, _ := mhb.getHeads(t, p)
+	hmap, _ := s.getHeads(t, p)
 	if hmap == nil {
 		return heads, nil
 	}
@@ -101,15 +120,16 @@ func (mhb *memoryHeadBook) Heads(t thread.ID, p peer.ID) ([]cid.Cid, error) {
 	return heads, nil
 }
 
-func (mhb *memoryHeadBook) ClearHeads(t thread.ID, p peer.ID) error {
-	mhb.Lock()
-	defer mhb.Unlock()
+func (mhb *memoryHeadBook) ClearHeads(t thread.ID, p thread.LogID) error {
+	s := mhb.segments.get(t)
+	s.Lock()
+	defer s.Unlock()
 
-	lmap := mhb.heads[t]
+	lmap := s.heads[t]
 	if lmap != nil {
 		delete(lmap, p)
 		if len(lmap) == 0 {
-			delete(mhb.heads, t)
+			delete(s.heads, t)
 		}
 	}
 	return nil
@@ -117,19 +137,23 @@ func (mhb *memoryHeadBook) ClearHeads(t thread.ID, p peer.ID) error {
 
 func (mhb *memoryHeadBook) DumpHeads() (core.DumpHeadBook, error) {
 	var dump = core.DumpHeadBook{
-		Data: make(map[thread.ID]map[peer.ID][]cid.Cid, len(mhb.heads)),
+		Data: make(map[thread.ID]map[thread.LogID][]cid.Cid),
 	}
 
-	for tid, logs := range mhb.heads {
-		lm := make(map[peer.ID][]cid.Cid, len(logs))
-		for lid, hs := range logs {
-			heads := make([]cid.Cid, 0, len(hs))
-			for head := range hs {
-				heads = append(heads, head)
+	for _, s := range mhb.segments {
+		s.RLock()
+		for tid, logs := range s.heads {
+			lm := make(map[thread.LogID][]cid.Cid, len(logs))
+			for lid, hs := range logs {
+				heads := make([]cid.Cid, 0, len(hs))
+				for head := range hs {
+					heads = append(heads, head)
+				}
+				lm[lid] = heads
 			}
-			lm[lid] = heads
+			dump.Data[tid] = lm
 		}
-		dump.Data[tid] = lm
+		s.RUnlock()
 	}
 
 	return dump, nil
@@ -140,9 +164,14 @@ func (mhb *memoryHeadBook) RestoreHeads(dump core.DumpHeadBook) error {
 		return core.ErrEmptyDump
 	}
 
-	var restored = make(map[thread.ID]map[peer.ID]map[cid.Cid]struct{}, len(dump.Data))
+	var restored headSegments
+	for i := range restored {
+		restored[i] = &headSegment{
+			heads: make(map[thread.ID]map[thread.LogID]map[cid.Cid]struct{}),
+		}
+	}
 	for tid, logs := range dump.Data {
-		lm := make(map[peer.ID]map[cid.Cid]struct{}, len(logs))
+		lm := make(map[thread.LogID]map[cid.Cid]struct{}, len(logs))
 		for lid, hs := range logs {
 			hm := make(map[cid.Cid]struct{}, len(hs))
 			for _, head := range hs {
@@ -150,9 +179,13 @@ func (mhb *memoryHeadBook) RestoreHeads(dump core.DumpHeadBook) error {
 			}
 			lm[lid] = hm
 		}
-		restored[tid] = lm
+		restored.get(tid).heads[tid] = lm
 	}
 
-	mhb.heads = restored
+	for i, s := range mhb.segments {
+		s.Lock()
+		s.heads = restored[i].heads
+		s.Unlock()
+	}
 	return nil
 }
@@ -1,11 +1,32 @@
 package lstoremem_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
 	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+	lstore "github.com/textileio/go-threads/logstore"
 	m "github.com/textileio/go-threads/logstore/lstoremem"
 	pt "github.com/textileio/go-threads/test"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"go.opentelemetry.io/otel/label"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestInMemoryLogstore(t *testing.T) {
@@ -14,12 +35,981 @@ func TestInMemoryLogstore(t *testing.T) {
 	})
 }
 
+func TestInMemoryLogstoreValidation(t *testing.T) {
+	ls := lstore.Validate(m.NewLogstore())
+	defer ls.Close()
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lid, err := thread.NewLogID(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSk, otherPk, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/4006")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		write    func() error
+		expected error
+	}{
+		{"thread version", func() error { return ls.CreateThread(thread.ID([]byte{0x02, 0x55, 0x01})) }, core.ErrInvalidThreadID},
+		{"thread variant", func() error { return ls.CreateThread(thread.ID([]byte{0x01, 0x42, 0x01})) }, core.ErrInvalidThreadID},
+		{"undefined thread", func() error { return ls.PutString(thread.Undef, "k", "v") }, core.ErrInvalidThreadID},
+		{"log ID", func() error { return ls.AddAddr(tid, thread.LogID("garbage"), addr, time.Hour) }, core.ErrInvalidLogID},
+		{"nil address", func() error { return ls.AddAddrs(tid, lid, []ma.Multiaddr{addr, nil}, time.Hour) }, core.ErrInvalidAddr},
+		{"service key", func() error { return ls.AddThread(thread.Info{ID: tid, Key: thread.Key{}}) }, core.ErrInvalidKey},
+		{"read key", func() error { return ls.AddReadKey(tid, nil) }, core.ErrInvalidKey},
+		{"public key", func() error { return ls.AddPubKey(tid, lid, otherPk) }, core.ErrInvalidKey},
+		{"private key", func() error { return ls.AddPrivKey(tid, lid, otherSk) }, core.ErrInvalidKey},
+		{"log", func() error { return ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: otherSk}) }, core.ErrInvalidKey},
+		{"head", func() error { return ls.SetHead(tid, lid, cid.Undef) }, core.ErrInvalidHead},
+		{"metadata key", func() error { return ls.PutLogBool(tid, lid, "", true) }, core.ErrInvalidMetaKey},
+		{"txn address", func() error {
+			txn, err := ls.(core.Transactor).BeginTxn(false)
+			if err != nil {
+				return err
+			}
+			defer txn.Rollback()
+			return txn.AddAddrs(tid, lid, []ma.Multiaddr{nil}, time.Hour)
+		}, core.ErrInvalidAddr},
+		{"batch log", func() error {
+			b := ls.Batch()
+			b.AddLog(tid, thread.LogInfo{ID: lid, PubKey: otherPk})
+			return b.Commit()
+		}, core.ErrInvalidKey},
+	} {
+		if err := c.write(); !errors.Is(err, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, err)
+		}
+	}
+	if ids, err := ls.Threads(); err != nil || len(ids) != 0 {
+		t.Fatalf("expected nothing to be stored, got %v (%v)", ids, err)
+	}
+
+	if err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk, Addrs: []ma.Multiaddr{addr}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// invites are validated before being accepted
+	inv, err := core.Invites(ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invite, err := inv.CreateInvite(tid, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inv.AcceptInvite([]byte("garbage"), ""); err == nil {
+		t.Fatal("expected accepting a malformed invite to fail")
+	}
+	if info, err := inv.AcceptInvite(invite, ""); err != nil {
+		t.Fatal(err)
+	} else if !info.ID.Equals(tid) || len(info.Logs) != 1 {
+		t.Fatalf("unexpected thread of an accepted invite: %v", info)
+	}
+}
+
+func TestInMemoryLogstoreMetrics(t *testing.T) {
+	pt.LogstoreTest(t, func() (core.Logstore, func()) {
+		return m.NewLogstore(lstore.WithMetrics(prometheus.NewRegistry())), nil
+	})
+
+	reg := prometheus.NewRegistry()
+	ls := m.NewLogstore(lstore.WithMetrics(reg))
+	defer ls.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	if _, err := ls.ThreadAddrStream(ctx, tid); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.AddServiceKey(tid, nil); err == nil {
+		t.Fatal("expected adding a nil service key to fail")
+	}
+
+	values := gatherMetrics(t, reg)
+	if values["threads_logstore_ops_total"] == 0 {
+		t.Fatal("expected operations to be counted")
+	}
+	if values["threads_logstore_op_duration_seconds"] != values["threads_logstore_ops_total"] {
+		t.Fatal("expected a latency sample per operation")
+	}
+	if values["threads_logstore_errors_total"] == 0 {
+		t.Fatal("expected failed operations to be counted")
+	}
+	if values["threads_logstore_addr_subscribers"] != 1 {
+		t.Fatalf("expected 1 address stream subscriber, got %v", values["threads_logstore_addr_subscribers"])
+	}
+}
+
+func TestInMemoryLogstoreMetricsSharedRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	ls1 := m.NewLogstore(lstore.WithMetrics(reg))
+	defer ls1.Close()
+	ls2 := m.NewLogstore(lstore.WithMetrics(reg))
+	defer ls2.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	if _, err := ls1.Threads(); err != nil {
+		t.Fatal(err)
+	}
+	ops := gatherMetrics(t, reg)["threads_logstore_ops_total"]
+	if _, err := ls2.Threads(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls2.ThreadAddrStream(ctx, tid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls1.ThreadAddrStream(ctx, tid); err != nil {
+		t.Fatal(err)
+	}
+
+	values := gatherMetrics(t, reg)
+	if values["threads_logstore_ops_total"] <= ops {
+		t.Fatal("expected operations of the second store to be counted")
+	}
+	if values["threads_logstore_addr_subscribers"] != 2 {
+		t.Fatalf("expected 2 address stream subscribers, got %v", values["threads_logstore_addr_subscribers"])
+	}
+}
+
+// gatherMetrics returns values of the metric families of the registry,
+// summed up over labels. Histograms count samples.
+func gatherMetrics(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, metric := range f.Metric {
+			switch {
+			case metric.Counter != nil:
+				values[f.GetName()] += metric.Counter.GetValue()
+			case metric.Gauge != nil:
+				values[f.GetName()] += metric.Gauge.GetValue()
+			case metric.Histogram != nil:
+				values[f.GetName()] += float64(metric.Histogram.GetSampleCount())
+			}
+		}
+	}
+	return values
+}
+
+func TestInMemoryLogstoreTracing(t *testing.T) {
+	recorder := &tracetest.StandardSpanRecorder{}
+	tracer := tracetest.NewProvider(tracetest.WithSpanRecorder(recorder)).Tracer("test")
+	ls := m.NewLogstore(lstore.WithTracer(tracer))
+	defer ls.Close()
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	if err := ls.AddServiceKey(tid, nil); err == nil {
+		t.Fatal("expected adding a nil service key to fail")
+	}
+	spans := recorder.Completed()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "logstore.key.AddServiceKey" {
+		t.Fatalf("unexpected span name %s", span.Name())
+	}
+	attrs := span.Attributes()
+	if attrs[label.Key("logstore.book")].AsString() != "key" || attrs[label.Key("thread.id")].AsString() != tid.String() {
+		t.Fatalf("unexpected span attributes %v", attrs)
+	}
+	if len(span.Events()) != 1 {
+		t.Fatal("expected the error to be recorded")
+	}
+}
+
+func TestInMemoryLogstoreTracingContext(t *testing.T) {
+	recorder := &tracetest.StandardSpanRecorder{}
+	tracer := tracetest.NewProvider(tracetest.WithSpanRecorder(recorder)).Tracer("test")
+	ls := m.NewLogstore(lstore.WithTracer(tracer))
+	defer ls.Close()
+
+	ctx, parent := tracer.Start(context.Background(), "caller")
+	tid := thread.NewIDV1(thread.Raw, 24)
+	err := ls.(core.ContextLogstore).AddThreadContext(ctx, thread.Info{ID: tid, Key: thread.NewRandomKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	var op *tracetest.Span
+	spans := recorder.Completed()
+	for _, s := range spans {
+		if s.Name() == "logstore.logstore.AddThread" {
+			op = s
+		}
+	}
+	if op == nil {
+		t.Fatal("expected a span of the operation")
+	}
+	if op.ParentSpanID() != parent.SpanContext().SpanID {
+		t.Fatal("expected the operation to be a child of the caller span")
+	}
+	if op.SpanContext().TraceID != parent.SpanContext().TraceID {
+		t.Fatal("expected the operation to join the caller trace")
+	}
+	var books int
+	for _, s := range spans {
+		if s == op || s.Name() == "caller" {
+			continue
+		}
+		books++
+		if s.ParentSpanID() != op.SpanContext().SpanID {
+			t.Fatalf("expected %s to be a child of the operation", s.Name())
+		}
+	}
+	if books == 0 {
+		t.Fatal("expected spans of the book operations")
+	}
+}
+
+// stopAfter is a context done once its error was checked n times.
+type stopAfter struct {
+	context.Context
+	n int32
+}
+
+func newStopAfter(n int32) *stopAfter {
+	return &stopAfter{Context: context.Background(), n: n}
+}
+
+func (c *stopAfter) Err() error {
+	if atomic.AddInt32(&c.n, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestInMemoryLogstoreContextCancel(t *testing.T) {
+	ls := m.NewLogstore()
+	defer ls.Close()
+	cls := ls.(core.ContextLogstore)
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	checkErr(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+	addr, _ := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/1")
+	var logs []thread.LogInfo
+	for i := 0; i < 3; i++ {
+		sk, pk, _ := crypto.GenerateEd25519Key(nil)
+		lid, _ := thread.LogIDFromPrivKey(sk)
+		lg := thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk, Addrs: []ma.Multiaddr{addr}, Head: newCid(t, lid.String())}
+		logs = append(logs, lg)
+
+		// stopped additions are retried until they complete
+		for n := int32(2); ; n++ {
+			err := cls.AddLogContext(newStopAfter(n), tid, lg)
+			if err == nil {
+				break
+			}
+			if err != context.Canceled {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+		}
+		got, err := ls.GetLog(tid, lid)
+		checkErr(t, err)
+		if got.PrivKey == nil || len(got.Addrs) != 1 || !got.Head.Defined() || !got.Managed {
+			t.Fatalf("expected log to be complete, got %v", got)
+		}
+	}
+
+	// reads stop between logs and books
+	if _, err := cls.GetThreadContext(newStopAfter(4), tid); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := cls.WithContext(newStopAfter(4)).ExportThread(tid); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// stopped imports are cleaned up
+	data, err := ls.ExportThread(tid)
+	checkErr(t, err)
+	checkErr(t, ls.DeleteThread(tid))
+	ctx, cancel := context.WithCancel(context.Background())
+	events := ls.Events(ctx)
+	if err := cls.WithContext(newStopAfter(8)).ImportThread(data); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := ls.GetThread(tid); err != core.ErrThreadNotFound {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+	checkErr(t, ls.ImportThread(data))
+	// the cleanup of the stopped import isn't reported
+	select {
+	case ev := <-events:
+		if ev.Type != core.ThreadCreated {
+			t.Fatalf("expected %s, got %s", core.ThreadCreated, ev.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the import")
+	}
+	cancel()
+
+	// stopped deletions leave the thread to the next one
+	stopped := 0
+	for n := int32(2); ; n++ {
+		err := cls.DeleteThreadContext(newStopAfter(n), tid)
+		if err == nil {
+			break
+		}
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		stopped++
+		info, err := ls.GetThread(tid)
+		checkErr(t, err)
+		if len(info.Logs) != len(logs) {
+			t.Fatalf("expected %d logs, got %d", len(logs), len(info.Logs))
+		}
+	}
+	if stopped < len(logs) {
+		t.Fatalf("expected deletion to be stopped between logs, stopped %d times", stopped)
+	}
+	if _, err := ls.GetThread(tid); err != core.ErrThreadNotFound {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+	for _, lg := range logs {
+		if addrs, _ := ls.Addrs(tid, lg.ID); len(addrs) != 0 {
+			t.Fatalf("expected addresses to be deleted, got %v", addrs)
+		}
+		if heads, _ := ls.Heads(tid, lg.ID); len(heads) != 0 {
+			t.Fatalf("expected heads to be deleted, got %v", heads)
+		}
+	}
+}
+
+func TestInMemoryLogstoreEventLogger(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	ls := m.NewLogstore(lstore.WithEventLogger(&lstore.EventLogger{
+		Logger: zap.New(obs).Sugar(),
+		Levels: map[string]zapcore.Level{"addr": zapcore.DebugLevel},
+	}))
+	defer ls.Close()
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	lid := pt.GenerateLogIDs(1)[0]
+	if err := ls.AddServiceKey(tid, nil); err == nil {
+		t.Fatal("expected adding a nil service key to fail")
+	}
+	if err := ls.AddAddrs(tid, lid, pt.GenerateAddrs(1), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// metadata changes are below the default level
+	if err := ls.PutString(tid, "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(entries))
+	}
+	if entries[0].Level != zapcore.ErrorLevel || entries[0].ContextMap()["op"] != "AddServiceKey" {
+		t.Fatalf("expected an error event of AddServiceKey, got %v", entries[0])
+	}
+	if entries[1].Level != zapcore.DebugLevel || entries[1].ContextMap()["book"] != "addr" {
+		t.Fatalf("expected an address change event, got %v", entries[1])
+	}
+	if entries[1].ContextMap()["thread"] != tid.String() {
+		t.Fatalf("expected the thread of the event to be %s", tid)
+	}
+}
+
+func TestInMemoryLogstoreQuota(t *testing.T) {
+	pt.LogstoreQuotaTest(t, func(q lstore.Quota) (core.Logstore, func()) {
+		return m.NewLogstore(lstore.WithQuota(q)), nil
+	})
+}
+
+func TestInMemoryReadOnlyLogstore(t *testing.T) {
+	ls := m.NewLogstore()
+	defer ls.Close()
+	tid := thread.NewIDV1(thread.Raw, 24)
+	if err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.PutString(tid, "name", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	ro := lstore.ReadOnly(ls)
+	if _, err := ro.GetThread(tid); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := ro.GetString(tid, "name"); err != nil || name == nil || *name != "foo" {
+		t.Fatalf("expected metadata to be readable, got %v (%v)", name, err)
+	}
+	tr, err := core.Transactions(ro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn, err := tr.BeginTxn(true); err != nil {
+		t.Fatal(err)
+	} else if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.BeginTxn(false); err != core.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	batch := ro.Batch()
+	batch.PutString(tid, "name", "bar")
+	if err := batch.Commit(); err != core.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+
+	// every method named like a write is rejected, whatever the arguments
+	writes := []string{"Accept", "Add", "Archive", "Clear", "Consume", "Create", "Delete", "Import",
+		"Pin", "Put", "Record", "Replace", "Restore", "Revoke", "Rotate", "Set", "Unarchive", "Unpin", "Update"}
+	v := reflect.ValueOf(ro)
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf((*core.Logstore)(nil)).Elem(),
+		reflect.TypeOf((*core.NameBook)(nil)).Elem(),
+		reflect.TypeOf((*core.PinBook)(nil)).Elem(),
+		reflect.TypeOf((*core.AccessBook)(nil)).Elem(),
+		reflect.TypeOf((*core.Inviter)(nil)).Elem(),
+		reflect.TypeOf((*core.Snapshotter)(nil)).Elem(),
+	} {
+		for i := 0; i < typ.NumMethod(); i++ {
+			name := typ.Method(i).Name
+			switch name {
+			case "Addrs", "AddrStream", "AddrsWithSource", "ArchivedThreads", "CreateInvite", "PinnedThreads":
+				continue
+			}
+			write := false
+			for _, prefix := range writes {
+				write = write || strings.HasPrefix(name, prefix)
+			}
+			if !write {
+				continue
+			}
+			method := v.MethodByName(name)
+			args := make([]reflect.Value, method.Type().NumIn())
+			for j := range args {
+				args[j] = reflect.Zero(method.Type().In(j))
+			}
+			if method.Type().IsVariadic() {
+				args = args[:len(args)-1]
+			}
+			out := method.Call(args)
+			if err, _ := out[len(out)-1].Interface().(error); err != core.ErrReadOnly {
+				t.Errorf("expected %s to fail with ErrReadOnly, got %v", name, err)
+			}
+		}
+	}
+
+	if err := ro.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name, err := ls.GetString(tid, "name")
+	if err != nil || name == nil || *name != "foo" {
+		t.Fatalf("expected the logstore to be unchanged and open, got %v (%v)", name, err)
+	}
+}
+
+// recordingLogstore records calls of AddThread before passing them on.
+type recordingLogstore struct {
+	core.Logstore
+	name  string
+	calls *[]string
+}
+
+func (r *recordingLogstore) AddThread(info thread.Info) error {
+	*r.calls = append(*r.calls, r.name)
+	return r.Logstore.AddThread(info)
+}
+
+func recording(name string, calls *[]string) lstore.Middleware {
+	return func(ls core.Logstore) core.Logstore {
+		return &recordingLogstore{Logstore: ls, name: name, calls: calls}
+	}
+}
+
+func TestInMemoryLogstoreMiddleware(t *testing.T) {
+	ls := m.NewLogstore()
+	defer ls.Close()
+	info := thread.Info{ID: thread.NewIDV1(thread.Raw, 24), Key: thread.NewRandomKey()}
+
+	var calls []string
+	chained := lstore.Chain(ls, recording("outer", &calls), recording("inner", &calls))
+	if err := chained.AddThread(info); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "outer" || calls[1] != "inner" {
+		t.Fatalf("expected middlewares to be called outermost first, got %v", calls)
+	}
+
+	calls = nil
+	mw := lstore.Compose(recording("outer", &calls), lstore.Compose(lstore.ReadOnly, recording("inner", &calls)))
+	if err := mw(ls).AddThread(info); err != core.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "outer" {
+		t.Fatalf("expected calls to stop at the read-only middleware, got %v", calls)
+	}
+	if lstore.Chain(ls) != ls {
+		t.Fatal("expected an empty chain to return the logstore")
+	}
+}
+
+func TestInMemoryLogstoreJournal(t *testing.T) {
+	var journal bytes.Buffer
+	key := sym.New()
+	ls := m.NewLogstore(lstore.WithJournal(&journal), lstore.WithJournalKey(key))
+	defer ls.Close()
+
+	info := thread.Info{ID: thread.NewIDV1(thread.Raw, 24), Key: thread.NewRandomKey()}
+	checkErr(t, ls.AddThread(info))
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	lid, err := thread.LogIDFromPrivKey(sk)
+	checkErr(t, err)
+	addr := pt.Multiaddr("/ip4/1.2.3.4/tcp/4001")
+	checkErr(t, ls.AddLog(info.ID, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk, Addrs: []ma.Multiaddr{addr}}))
+	heads := []cid.Cid{newCid(t, "a"), newCid(t, "b")}
+	checkErr(t, ls.SetHeads(info.ID, lid, heads))
+	checkErr(t, ls.PutString(info.ID, "name", "before"))
+	until := time.Now()
+	time.Sleep(time.Millisecond)
+	checkErr(t, ls.PutString(info.ID, "name", "after"))
+	checkErr(t, ls.PutMetaWithTTL(info.ID, "lease", int64(1), time.Hour))
+
+	check := func(replayed core.Logstore, name string) {
+		t.Helper()
+		got, err := replayed.GetThread(info.ID)
+		checkErr(t, err)
+		if !bytes.Equal(got.Key.Bytes(), info.Key.Bytes()) || len(got.Logs) != 1 {
+			t.Fatalf("expected thread with key and log to be replayed, got %v", got)
+		}
+		lg := got.Logs[0]
+		if lg.ID != lid || !lg.PubKey.Equals(pk) || !lg.PrivKey.Equals(sk) {
+			t.Fatal("expected log keys to be replayed")
+		}
+		if len(lg.Addrs) != 1 || !lg.Addrs[0].Equal(addr) {
+			t.Fatalf("expected log addresses to be replayed, got %v", lg.Addrs)
+		}
+		gotHeads, err := replayed.Heads(info.ID, lid)
+		checkErr(t, err)
+		if len(gotHeads) != len(heads) {
+			t.Fatalf("expected %d heads to be replayed, got %d", len(heads), len(gotHeads))
+		}
+		val, err := replayed.GetString(info.ID, "name")
+		checkErr(t, err)
+		if val == nil || *val != name {
+			t.Fatalf("expected name %s, got %v", name, val)
+		}
+	}
+
+	replayed := m.NewLogstore()
+	defer replayed.Close()
+	checkErr(t, lstore.Replay(replayed, bytes.NewReader(journal.Bytes()), key))
+	check(replayed, "after")
+	lease, err := replayed.GetInt64(info.ID, "lease")
+	checkErr(t, err)
+	if lease == nil || *lease != 1 {
+		t.Fatalf("expected lease to be replayed, got %v", lease)
+	}
+
+	// recovered to a point in time
+	recovered := m.NewLogstore()
+	defer recovered.Close()
+	checkErr(t, lstore.ReplayUntil(recovered, bytes.NewReader(journal.Bytes()), until, key))
+	check(recovered, "before")
+
+	// secrets are encrypted
+	skBytes, err := sk.Raw()
+	checkErr(t, err)
+	for _, secret := range [][]byte{skBytes, info.Key.Read().Bytes(), info.Key.Service().Bytes()} {
+		if bytes.Contains(journal.Bytes(), secret) {
+			t.Fatal("expected secrets not to be journaled in plaintext")
+		}
+	}
+	if err := lstore.Replay(m.NewLogstore(), bytes.NewReader(journal.Bytes()), nil); err == nil {
+		t.Fatal("expected replay without the journal key to fail")
+	}
+
+	// complete entries of a truncated journal are replayed
+	var ops []string
+	err = lstore.ReadJournal(bytes.NewReader(journal.Bytes()[:journal.Len()-1]), func(e lstore.JournalEntry) error {
+		ops = append(ops, e.Op)
+		return nil
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+	if len(ops) == 0 || ops[len(ops)-1] != "PutString" {
+		t.Fatalf("expected entries up to the truncated one, got %v", ops)
+	}
+
+	// failed writes are aborted
+	_, other, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	if err := ls.AddPubKey(info.ID, lid, other); err == nil {
+		t.Fatal("expected adding a key of another log to fail")
+	}
+	checkErr(t, ls.PutString(info.ID, "name", "last"))
+	ops = nil
+	checkErr(t, lstore.ReadJournal(bytes.NewReader(journal.Bytes()), func(e lstore.JournalEntry) error {
+		ops = append(ops, e.Op)
+		return nil
+	}))
+	if ops[len(ops)-2] != "PutMetaWithTTL" || ops[len(ops)-1] != "PutString" {
+		t.Fatalf("expected failed write to be skipped, got %v", ops)
+	}
+	aborted := m.NewLogstore()
+	defer aborted.Close()
+	checkErr(t, lstore.Replay(aborted, bytes.NewReader(journal.Bytes()), key))
+	check(aborted, "last")
+}
+
+func TestInMemoryLogstoreJournalWithoutKey(t *testing.T) {
+	var journal bytes.Buffer
+	ls := m.NewLogstore(lstore.WithJournal(&journal))
+	defer ls.Close()
+
+	info := thread.Info{ID: thread.NewIDV1(thread.Raw, 24), Key: thread.NewRandomKey()}
+	checkErr(t, ls.AddThread(info))
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	lid, err := thread.LogIDFromPrivKey(sk)
+	checkErr(t, err)
+	checkErr(t, ls.AddLog(info.ID, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk}))
+
+	// secrets are left out
+	replayed := m.NewLogstore()
+	defer replayed.Close()
+	checkErr(t, lstore.Replay(replayed, bytes.NewReader(journal.Bytes()), nil))
+	got, err := replayed.PubKey(info.ID, lid)
+	checkErr(t, err)
+	if got == nil || !got.Equals(pk) {
+		t.Fatal("expected public key to be replayed")
+	}
+	gotSk, err := replayed.PrivKey(info.ID, lid)
+	checkErr(t, err)
+	rk, err := replayed.ReadKey(info.ID)
+	checkErr(t, err)
+	svk, err := replayed.ServiceKey(info.ID)
+	checkErr(t, err)
+	if gotSk != nil || rk != nil || svk != nil {
+		t.Fatal("expected secrets not to be journaled")
+	}
+}
+
+func newCid(t *testing.T, data string) cid.Cid {
+	c, err := cid.NewPrefixV1(cid.Raw, mh.SHA2_256).Sum([]byte(data))
+	checkErr(t, err)
+	return c
+}
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInMemoryStrictLogstore(t *testing.T) {
+	ls := m.NewLogstore(lstore.WithStrictMode(true))
+	defer ls.Close()
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	info := thread.Info{ID: tid, Key: thread.NewRandomKey()}
+	if err := ls.AddThread(info); err != core.ErrThreadNotFound {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lid, err := thread.NewLogID(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk}
+	if err := ls.AddLog(tid, lg); err != core.ErrThreadNotFound {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+
+	// no write adds entries of undeclared threads
+	addr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	head, _ := cid.Decode("bafkreidrfyazsmlj45ahtkaytfxqgswy6rwyoohsuqa6imagedhhkrfb3y")
+	for name, write := range map[string]func() error{
+		"AddAddrs":      func() error { return ls.AddAddrs(tid, lid, []ma.Multiaddr{addr}, time.Hour) },
+		"AddHead":       func() error { return ls.AddHead(tid, lid, head) },
+		"AddPubKey":     func() error { return ls.AddPubKey(tid, lid, pk) },
+		"AddServiceKey": func() error { return ls.AddServiceKey(tid, info.Key.Service()) },
+		"PutString":     func() error { return ls.PutString(tid, "foo", "bar") },
+	} {
+		if err := write(); err != core.ErrThreadNotFound {
+			t.Fatalf("%s: expected ErrThreadNotFound, got %v", name, err)
+		}
+	}
+	if threads, err := ls.Threads(); err != nil || len(threads) != 0 {
+		t.Fatalf("expected no threads, got %v (%v)", threads, err)
+	}
+
+	if err := ls.CreateThread(tid); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.AddThread(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.AddLog(tid, lg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInMemoryBoundedLogstore(t *testing.T) {
+	pt.LogstoreTest(t, func() (core.Logstore, func()) {
+		return m.NewBoundedLogstore(m.Bounds{MaxThreads: 1000, MaxEntries: 100000}), nil
+	})
+}
+
+func TestInMemoryBoundedLogstoreEviction(t *testing.T) {
+	t.Run("threads", func(t *testing.T) {
+		var evicted []thread.ID
+		ls := m.NewBoundedLogstore(m.Bounds{
+			MaxThreads: 2,
+			OnEvict:    func(id thread.ID) { evicted = append(evicted, id) },
+		})
+		defer ls.Close()
+
+		tids := make([]thread.ID, 3)
+		for i := range tids {
+			tids[i] = thread.NewIDV1(thread.Raw, 24)
+		}
+		for _, tid := range tids[:2] {
+			if err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// reads keep threads from being evicted
+		if _, err := ls.ServiceKey(tids[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := ls.AddThread(thread.Info{ID: tids[2], Key: thread.NewRandomKey()}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(evicted) != 1 || evicted[0] != tids[1] {
+			t.Fatalf("expected thread %s to be evicted, got %v", tids[1], evicted)
+		}
+		if sk, err := ls.ServiceKey(tids[1]); err != nil || sk != nil {
+			t.Fatalf("expected evicted thread to be cleared, got %v (err: %v)", sk, err)
+		}
+		for _, tid := range []thread.ID{tids[0], tids[2]} {
+			if sk, err := ls.ServiceKey(tid); err != nil || sk == nil {
+				t.Fatalf("expected thread %s to be kept, err: %v", tid, err)
+			}
+		}
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		var evicted []thread.ID
+		ls := m.NewBoundedLogstore(m.Bounds{
+			MaxEntries: 5,
+			OnEvict:    func(id thread.ID) { evicted = append(evicted, id) },
+		})
+		defer ls.Close()
+
+		tid1, tid2 := thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24)
+		for _, tid := range []thread.ID{tid1, tid2} {
+			if err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(evicted) != 0 {
+			t.Fatalf("expected no evictions, got %v", evicted)
+		}
+
+		lid := pt.GenerateLogIDs(1)[0]
+		addrs := pt.GenerateAddrs(6)
+		if err := ls.AddAddrs(tid2, lid, addrs[:2], time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if len(evicted) != 1 || evicted[0] != tid1 {
+			t.Fatalf("expected thread %s to be evicted, got %v", tid1, evicted)
+		}
+
+		// a thread in use is kept even if it exceeds the bound on its own
+		if err := ls.AddAddrs(tid2, lid, addrs[2:], time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if addrs, err := ls.Addrs(tid2, lid); err != nil || len(addrs) != 6 {
+			t.Fatalf("expected 6 addresses, got %d (err: %v)", len(addrs), err)
+		}
+	})
+}
+
 func TestInMemoryAddrBook(t *testing.T) {
 	pt.AddrBookTest(t, func() (core.AddrBook, func()) {
 		return m.NewAddrBook(), nil
 	})
 }
 
+func TestInMemoryAddrLimit(t *testing.T) {
+	ab := m.NewAddrBookWithOptions(m.Options{MaxAddrsPerLog: 3})
+	tid := thread.NewIDV1(thread.Raw, 24)
+	id := pt.GenerateLogIDs(1)[0]
+	addrs := pt.GenerateAddrs(5)
+
+	if err := ab.AddAddrs(tid, id, addrs[:3], time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// the address expiring first gets evicted
+	if err := ab.AddAddr(tid, id, addrs[3], 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := ab.SetAddr(tid, id, addrs[0], 3*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// addresses expiring before all stored ones are dropped
+	if err := ab.AddAddr(tid, id, addrs[4], time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := ab.Addrs(tid, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 3 {
+		t.Fatalf("expected 3 addresses, got %d", len(stored))
+	}
+	for _, a := range stored {
+		if a.Equal(addrs[4]) {
+			t.Fatalf("address %s should have been dropped", a)
+		}
+	}
+	var kept int
+	for _, a := range stored {
+		if a.Equal(addrs[0]) || a.Equal(addrs[3]) {
+			kept++
+		}
+	}
+	if kept != 2 {
+		t.Fatalf("expected the longest living addresses to be kept, got %v", stored)
+	}
+}
+
+func TestInMemoryAddrDialFreshness(t *testing.T) {
+	tid := thread.NewIDV1(thread.Raw, 24)
+	id := pt.GenerateLogIDs(1)[0]
+	addrs := pt.GenerateAddrs(2)
+
+	sorted := func(ab core.AddrBook) []ma.Multiaddr {
+		if err := ab.AddAddrs(tid, id, addrs, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		// the faster address is dialed first
+		if err := ab.RecordDial(tid, id, addrs[0], time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+		if err := ab.RecordDial(tid, id, addrs[1], time.Second); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+		res, err := ab.SortedAddrs(tid, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// fresh dials are ordered by round-trip time
+	if res := sorted(m.NewAddrBook()); !res[0].Equal(addrs[0]) {
+		t.Fatalf("expected the faster address first, got %v", res)
+	}
+	// stale ones by the time of the dial
+	if res := sorted(m.NewAddrBookWithOptions(m.Options{AddrDialFreshness: time.Nanosecond})); !res[0].Equal(addrs[1]) {
+		t.Fatalf("expected the address dialed last first, got %v", res)
+	}
+}
+
+func TestAddrSubManagerFanOut(t *testing.T) {
+	mgr := m.NewAddrSubManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	id := pt.GenerateLogIDs(1)[0]
+	addrs := pt.GenerateAddrs(10)
+	streams := make([]<-chan ma.Multiaddr, 100)
+	for i := range streams {
+		streams[i], _ = mgr.AddrStream(ctx, id, nil)
+	}
+	// broadcasting doesn't wait for subscribers
+	for _, a := range addrs {
+		mgr.BroadcastAddr(id, a)
+	}
+
+	for i, stream := range streams {
+		for j, expected := range addrs {
+			select {
+			case a := <-stream:
+				if !a.Equal(expected) {
+					t.Fatalf("stream %d: expected %s at %d, got %s", i, expected, j, a)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatalf("stream %d timed out", i)
+			}
+		}
+	}
+}
+
+func TestAddrSubManagerLagging(t *testing.T) {
+	defer func(max int) { m.MaxPausedAddrs = max }(m.MaxPausedAddrs)
+	m.MaxPausedAddrs = 3
+
+	mgr := m.NewAddrSubManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	id := pt.GenerateLogIDs(1)[0]
+	addrs := pt.GenerateAddrs(5)
+	stream, ctl := mgr.ControlledAddrStream(ctx, id, nil)
+	ctl.Pause()
+	for _, a := range addrs {
+		mgr.BroadcastAddr(id, a)
+	}
+	ctl.Resume()
+
+	// the oldest addresses are dropped
+	for _, expected := range addrs[2:] {
+		select {
+		case a := <-stream:
+			if !a.Equal(expected) {
+				t.Fatalf("expected %s, got %s", expected, a)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out")
+		}
+	}
+	select {
+	case a := <-stream:
+		t.Fatalf("unexpected address %s", a)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
 func TestInMemoryKeyBook(t *testing.T) {
 	pt.KeyBookTest(t, func() (core.KeyBook, func()) {
 		return m.NewKeyBook(), nil
@@ -44,6 +1034,12 @@ func BenchmarkInMemoryLogstore(b *testing.B) {
 	}, "InMem")
 }
 
+func BenchmarkInMemoryLogstoreScale(b *testing.B) {
+	pt.BenchmarkLogstoreScale(b, func() (core.Logstore, func()) {
+		return m.NewLogstore(), nil
+	}, "InMem")
+}
+
 func BenchmarkInMemoryKeyBook(b *testing.B) {
 	pt.BenchmarkKeyBook(b, func() (core.KeyBook, func()) {
 		return m.NewKeyBook(), nil
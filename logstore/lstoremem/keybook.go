@@ -1,11 +1,11 @@
 package lstoremem
 
 import (
-	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/libp2p/go-libp2p-core/crypto"
-	"github.com/libp2p/go-libp2p-core/peer"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 	sym "github.com/textileio/go-threads/crypto/symmetric"
@@ -14,13 +14,48 @@ import (
 type memoryKeyBook struct {
 	sync.RWMutex
 
-	pks map[thread.ID]map[peer.ID]crypto.PubKey
-	sks map[thread.ID]map[peer.ID]crypto.PrivKey
+	pks map[thread.ID]map[thread.LogID]crypto.PubKey
+	sks map[thread.ID]map[thread.LogID]crypto.PrivKey
 	rks map[thread.ID][]byte
 	fks map[thread.ID][]byte
+
+	// previous read and service keys by version
+	rkh map[thread.ID][][]byte
+	fkh map[thread.ID][][]byte
+
+	// creation times of read and service key versions in unix nanoseconds
+	rkc map[thread.ID][]int64
+	fkc map[thread.ID][]int64
+
+	// logs with revoked public keys
+	revoked map[thread.ID]map[thread.LogID]struct{}
+
+	// threads having public or private keys of logs
+	threads map[thread.LogID]map[thread.ID]struct{}
 }
 
-func (mkb *memoryKeyBook) getPubKey(t thread.ID, p peer.ID) (crypto.PubKey, bool) {
+func (mkb *memoryKeyBook) indexLog(t thread.ID, p thread.LogID) {
+	if mkb.threads[p] == nil {
+		mkb.threads[p] = make(map[thread.ID]struct{}, 1)
+	}
+	mkb.threads[p][t] = struct{}{}
+}
+
+// unindexLog drops the thread from threads of the log unless the thread
+// still has keys of it.
+func (mkb *memoryKeyBook) unindexLog(t thread.ID, p thread.LogID) {
+	_, pub := mkb.getPubKey(t, p)
+	_, priv := mkb.getPrivKey(t, p)
+	if pub || priv {
+		return
+	}
+	delete(mkb.threads[p], t)
+	if len(mkb.threads[p]) == 0 {
+		delete(mkb.threads, p)
+	}
+}
+
+func (mkb *memoryKeyBook) getPubKey(t thread.ID, p thread.LogID) (crypto.PubKey, bool) {
 	lmap, found := mkb.pks[t]
 	if lmap == nil {
 		return nil, found
@@ -29,7 +64,7 @@ func (mkb *memoryKeyBook) getPubKey(t thread.ID, p peer.ID) (crypto.PubKey, bool
 	return hmap, found
 }
 
-func (mkb *memoryKeyBook) getPrivKey(t thread.ID, p peer.ID) (crypto.PrivKey, bool) {
+func (mkb *memoryKeyBook) getPrivKey(t thread.ID, p thread.LogID) (crypto.PrivKey, bool) {
 	lmap, found := mkb.sks[t]
 	if lmap == nil {
 		return nil, found
@@ -42,61 +77,94 @@ var _ core.KeyBook = (*memoryKeyBook)(nil)
 
 func NewKeyBook() core.KeyBook {
 	return &memoryKeyBook{
-		pks: map[thread.ID]map[peer.ID]crypto.PubKey{},
-		sks: map[thread.ID]map[peer.ID]crypto.PrivKey{},
+		pks: map[thread.ID]map[thread.LogID]crypto.PubKey{},
+		sks: map[thread.ID]map[thread.LogID]crypto.PrivKey{},
 		rks: map[thread.ID][]byte{},
 		fks: map[thread.ID][]byte{},
+		rkh: map[thread.ID][][]byte{},
+		fkh: map[thread.ID][][]byte{},
+		rkc: map[thread.ID][]int64{},
+		fkc: map[thread.ID][]int64{},
+
+		revoked: map[thread.ID]map[thread.LogID]struct{}{},
+		threads: map[thread.LogID]map[thread.ID]struct{}{},
 	}
 }
 
-func (mkb *memoryKeyBook) PubKey(t thread.ID, p peer.ID) (crypto.PubKey, error) {
+func (mkb *memoryKeyBook) PubKey(t thread.ID, p thread.LogID) (crypto.PubKey, error) {
 	mkb.RLock()
 	pk, _ := mkb.getPubKey(t, p)
 	mkb.RUnlock()
 	return pk, nil
 }
 
-func (mkb *memoryKeyBook) AddPubKey(t thread.ID, p peer.ID, pk crypto.PubKey) error {
+func (mkb *memoryKeyBook) AddPubKey(t thread.ID, p thread.LogID, pk crypto.PubKey) error {
 	// check it's correct first
 	if !p.MatchesPublicKey(pk) {
-		return errors.New("ID does not match PublicKey")
+		return fmt.Errorf("%w: ID does not match PublicKey", core.ErrInvalidKey)
 	}
 
 	mkb.Lock()
 	if mkb.pks[t] == nil {
-		mkb.pks[t] = make(map[peer.ID]crypto.PubKey, 1)
+		mkb.pks[t] = make(map[thread.LogID]crypto.PubKey, 1)
 	}
 	mkb.pks[t][p] = pk
+	mkb.indexLog(t, p)
+	mkb.Unlock()
+	return nil
+}
+
+func (mkb *memoryKeyBook) RevokePubKey(t thread.ID, p thread.LogID) error {
+	mkb.Lock()
+	if mkb.revoked[t] == nil {
+		mkb.revoked[t] = make(map[thread.LogID]struct{}, 1)
+	}
+	mkb.revoked[t][p] = struct{}{}
 	mkb.Unlock()
 	return nil
 }
 
-func (mkb *memoryKeyBook) PrivKey(t thread.ID, p peer.ID) (crypto.PrivKey, error) {
+func (mkb *memoryKeyBook) IsRevoked(t thread.ID, p thread.LogID) (bool, error) {
+	mkb.RLock()
+	_, revoked := mkb.revoked[t][p]
+	mkb.RUnlock()
+	return revoked, nil
+}
+
+func (mkb *memoryKeyBook) PrivKey(t thread.ID, p thread.LogID) (crypto.PrivKey, error) {
 	mkb.RLock()
 	sk, _ := mkb.getPrivKey(t, p)
 	mkb.RUnlock()
 	return sk, nil
 }
 
-func (mkb *memoryKeyBook) AddPrivKey(t thread.ID, p peer.ID, sk crypto.PrivKey) error {
+func (mkb *memoryKeyBook) AddPrivKey(t thread.ID, p thread.LogID, sk crypto.PrivKey) error {
 	if sk == nil {
-		return errors.New("sk is nil (PrivKey)")
+		return fmt.Errorf("%w: sk is nil (PrivKey)", core.ErrInvalidKey)
 	}
 
 	// check it's correct first
 	if !p.MatchesPrivateKey(sk) {
-		return errors.New("ID does not match PrivateKey")
+		return fmt.Errorf("%w: ID does not match PrivateKey", core.ErrInvalidKey)
 	}
 
 	mkb.Lock()
 	if mkb.sks[t] == nil {
-		mkb.sks[t] = make(map[peer.ID]crypto.PrivKey, 1)
+		mkb.sks[t] = make(map[thread.LogID]crypto.PrivKey, 1)
 	}
 	mkb.sks[t][p] = sk
+	mkb.indexLog(t, p)
 	mkb.Unlock()
 	return nil
 }
 
+func (mkb *memoryKeyBook) HasPrivKey(t thread.ID, p thread.LogID) (bool, error) {
+	mkb.RLock()
+	_, found := mkb.getPrivKey(t, p)
+	mkb.RUnlock()
+	return found, nil
+}
+
 func (mkb *memoryKeyBook) ReadKey(t thread.ID) (key *sym.Key, err error) {
 	mkb.RLock()
 	b := mkb.rks[t]
@@ -109,15 +177,23 @@ func (mkb *memoryKeyBook) ReadKey(t thread.ID) (key *sym.Key, err error) {
 
 func (mkb *memoryKeyBook) AddReadKey(t thread.ID, key *sym.Key) error {
 	if key == nil {
-		return errors.New("key is nil (ReadKey)")
+		return fmt.Errorf("%w: key is nil (ReadKey)", core.ErrInvalidKey)
 	}
 
 	mkb.Lock()
 	mkb.rks[t] = key.Bytes()
+	setCreated(mkb.rkc, t, len(mkb.rkh[t]))
 	mkb.Unlock()
 	return nil
 }
 
+func (mkb *memoryKeyBook) HasReadKey(t thread.ID) (bool, error) {
+	mkb.RLock()
+	_, found := mkb.rks[t]
+	mkb.RUnlock()
+	return found, nil
+}
+
 func (mkb *memoryKeyBook) ServiceKey(t thread.ID) (key *sym.Key, err error) {
 	mkb.RLock()
 	b := mkb.fks[t]
@@ -130,36 +206,167 @@ func (mkb *memoryKeyBook) ServiceKey(t thread.ID) (key *sym.Key, err error) {
 
 func (mkb *memoryKeyBook) AddServiceKey(t thread.ID, key *sym.Key) error {
 	if key == nil {
-		return errors.New("key is nil (ServiceKey)")
+		return fmt.Errorf("%w: key is nil (ServiceKey)", core.ErrInvalidKey)
 	}
 
 	mkb.Lock()
 	mkb.fks[t] = key.Bytes()
+	setCreated(mkb.fkc, t, len(mkb.fkh[t]))
 	mkb.Unlock()
 	return nil
 }
 
+func (mkb *memoryKeyBook) HasServiceKey(t thread.ID) (bool, error) {
+	mkb.RLock()
+	_, found := mkb.fks[t]
+	mkb.RUnlock()
+	return found, nil
+}
+
+func (mkb *memoryKeyBook) RotateReadKey(t thread.ID, key *sym.Key) (int, error) {
+	if key == nil {
+		return 0, fmt.Errorf("%w: key is nil (ReadKey)", core.ErrInvalidKey)
+	}
+
+	mkb.Lock()
+	defer mkb.Unlock()
+	v := rotateKey(mkb.rks, mkb.rkh, t, key)
+	setCreated(mkb.rkc, t, v)
+	return v, nil
+}
+
+func (mkb *memoryKeyBook) ReadKeyVersion(t thread.ID, version int) (*sym.Key, error) {
+	mkb.RLock()
+	defer mkb.RUnlock()
+	return keyVersion(mkb.rks, mkb.rkh, t, version)
+}
+
+func (mkb *memoryKeyBook) ReadKeyVersions(t thread.ID) ([]core.KeyVersion, error) {
+	mkb.RLock()
+	defer mkb.RUnlock()
+	return keyVersions(mkb.rks, mkb.rkh, mkb.rkc, t)
+}
+
+func (mkb *memoryKeyBook) RotateServiceKey(t thread.ID, key *sym.Key) (int, error) {
+	if key == nil {
+		return 0, fmt.Errorf("%w: key is nil (ServiceKey)", core.ErrInvalidKey)
+	}
+
+	mkb.Lock()
+	defer mkb.Unlock()
+	v := rotateKey(mkb.fks, mkb.fkh, t, key)
+	setCreated(mkb.fkc, t, v)
+	return v, nil
+}
+
+func (mkb *memoryKeyBook) ServiceKeyVersion(t thread.ID, version int) (*sym.Key, error) {
+	mkb.RLock()
+	defer mkb.RUnlock()
+	return keyVersion(mkb.fks, mkb.fkh, t, version)
+}
+
+func (mkb *memoryKeyBook) ServiceKeyVersions(t thread.ID) ([]core.KeyVersion, error) {
+	mkb.RLock()
+	defer mkb.RUnlock()
+	return keyVersions(mkb.fks, mkb.fkh, mkb.fkc, t)
+}
+
+// rotateKey retains the current key in the history and replaces it.
+func rotateKey(current map[thread.ID][]byte, history map[thread.ID][][]byte, t thread.ID, key *sym.Key) int {
+	if b, ok := current[t]; ok {
+		history[t] = append(history[t], b)
+	}
+	current[t] = key.Bytes()
+	return len(history[t])
+}
+
+func keyVersion(current map[thread.ID][]byte, history map[thread.ID][][]byte, t thread.ID, version int) (*sym.Key, error) {
+	var b []byte
+	switch h := history[t]; {
+	case version >= 0 && version < len(h):
+		b = h[version]
+	case version == len(h):
+		b = current[t]
+	}
+	if b == nil {
+		return nil, nil
+	}
+	return sym.FromBytes(b)
+}
+
+func keyVersions(current map[thread.ID][]byte, history map[thread.ID][][]byte, created map[thread.ID][]int64, t thread.ID) ([]core.KeyVersion, error) {
+	var versions []core.KeyVersion
+	for v := 0; v <= len(history[t]); v++ {
+		k, err := keyVersion(current, history, t, v)
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			continue
+		}
+		kv := core.KeyVersion{Version: v, Key: k}
+		if c := created[t]; v < len(c) && c[v] != 0 {
+			kv.Created = time.Unix(0, c[v])
+		}
+		versions = append(versions, kv)
+	}
+	return versions, nil
+}
+
+// setCreated records the current time as the creation time of the key version.
+func setCreated(created map[thread.ID][]int64, t thread.ID, version int) {
+	c := created[t]
+	for len(c) <= version {
+		c = append(c, 0)
+	}
+	c[version] = time.Now().UnixNano()
+	created[t] = c
+}
+
 func (mkb *memoryKeyBook) ClearKeys(t thread.ID) error {
 	mkb.Lock()
+	pks, sks := mkb.pks[t], mkb.sks[t]
 	delete(mkb.pks, t)
 	delete(mkb.sks, t)
+	for p := range pks {
+		mkb.unindexLog(t, p)
+	}
+	for p := range sks {
+		mkb.unindexLog(t, p)
+	}
 	delete(mkb.rks, t)
 	delete(mkb.fks, t)
+	delete(mkb.rkh, t)
+	delete(mkb.fkh, t)
+	delete(mkb.rkc, t)
+	delete(mkb.fkc, t)
+	delete(mkb.revoked, t)
 	mkb.Unlock()
 	return nil
 }
 
-func (mkb *memoryKeyBook) ClearLogKeys(t thread.ID, _ peer.ID) error {
+func (mkb *memoryKeyBook) ClearLogKeys(t thread.ID, p thread.LogID) error {
 	mkb.Lock()
-	delete(mkb.pks, t)
-	delete(mkb.sks, t)
+	delete(mkb.pks[t], p)
+	if len(mkb.pks[t]) == 0 {
+		delete(mkb.pks, t)
+	}
+	delete(mkb.sks[t], p)
+	if len(mkb.sks[t]) == 0 {
+		delete(mkb.sks, t)
+	}
+	delete(mkb.revoked[t], p)
+	if len(mkb.revoked[t]) == 0 {
+		delete(mkb.revoked, t)
+	}
+	mkb.unindexLog(t, p)
 	mkb.Unlock()
 	return nil
 }
 
-func (mkb *memoryKeyBook) LogsWithKeys(t thread.ID) (peer.IDSlice, error) {
+func (mkb *memoryKeyBook) LogsWithKeys(t thread.ID) (thread.LogIDSlice, error) {
 	mkb.RLock()
-	ps := make(map[peer.ID]struct{})
+	ps := make(map[thread.LogID]struct{})
 	if mkb.pks[t] != nil {
 		for p := range mkb.pks[t] {
 			ps[p] = struct{}{}
@@ -171,7 +378,7 @@ func (mkb *memoryKeyBook) LogsWithKeys(t thread.ID) (peer.IDSlice, error) {
 		}
 	}
 	mkb.RUnlock()
-	var pids peer.IDSlice
+	var pids thread.LogIDSlice
 	for p := range ps {
 		pids = append(pids, p)
 	}
@@ -195,20 +402,35 @@ func (mkb *memoryKeyBook) ThreadsFromKeys() (thread.IDSlice, error) {
 	return tids, nil
 }
 
+func (mkb *memoryKeyBook) ThreadsWithLogKeys(p thread.LogID) (thread.IDSlice, error) {
+	mkb.RLock()
+	defer mkb.RUnlock()
+	tids := make(thread.IDSlice, 0, len(mkb.threads[p]))
+	for t := range mkb.threads[p] {
+		tids = append(tids, t)
+	}
+	return tids, nil
+}
+
 func (mkb *memoryKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 	mkb.RLock()
 	defer mkb.RUnlock()
 
 	var (
 		dump    core.DumpKeyBook
-		public  = make(map[thread.ID]map[peer.ID]crypto.PubKey, len(mkb.pks))
-		private = make(map[thread.ID]map[peer.ID]crypto.PrivKey, len(mkb.sks))
+		public  = make(map[thread.ID]map[thread.LogID]crypto.PubKey, len(mkb.pks))
+		private = make(map[thread.ID]map[thread.LogID]crypto.PrivKey, len(mkb.sks))
 		read    = make(map[thread.ID][]byte, len(mkb.rks))
 		service = make(map[thread.ID][]byte, len(mkb.fks))
+		rhist   = make(map[thread.ID][][]byte, len(mkb.rkh))
+		shist   = make(map[thread.ID][][]byte, len(mkb.fkh))
+		rtimes  = make(map[thread.ID][]int64, len(mkb.rkc))
+		stimes  = make(map[thread.ID][]int64, len(mkb.fkc))
+		revoked = make(map[thread.ID]thread.LogIDSlice, len(mkb.revoked))
 	)
 
 	for tid, logs := range mkb.pks {
-		lm := make(map[peer.ID]crypto.PubKey, len(logs))
+		lm := make(map[thread.LogID]crypto.PubKey, len(logs))
 		for lid, key := range logs {
 			lm[lid] = key
 		}
@@ -216,7 +438,7 @@ func (mkb *memoryKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 	}
 
 	for tid, logs := range mkb.sks {
-		lm := make(map[peer.ID]crypto.PrivKey, len(logs))
+		lm := make(map[thread.LogID]crypto.PrivKey, len(logs))
 		for lid, key := range logs {
 			lm[lid] = key
 		}
@@ -231,10 +453,37 @@ func (mkb *memoryKeyBook) DumpKeys() (core.DumpKeyBook, error) {
 		service[tid] = key
 	}
 
+	for tid, keys := range mkb.rkh {
+		rhist[tid] = append([][]byte(nil), keys...)
+	}
+
+	for tid, keys := range mkb.fkh {
+		shist[tid] = append([][]byte(nil), keys...)
+	}
+
+	for tid, times := range mkb.rkc {
+		rtimes[tid] = append([]int64(nil), times...)
+	}
+
+	for tid, times := range mkb.fkc {
+		stimes[tid] = append([]int64(nil), times...)
+	}
+
+	for tid, logs := range mkb.revoked {
+		for lid := range logs {
+			revoked[tid] = append(revoked[tid], lid)
+		}
+	}
+
 	dump.Data.Public = public
 	dump.Data.Private = private
 	dump.Data.Read = read
 	dump.Data.Service = service
+	dump.Data.ReadHistory = rhist
+	dump.Data.ServiceHistory = shist
+	dump.Data.ReadCreated = rtimes
+	dump.Data.ServiceCreated = stimes
+	dump.Data.Revoked = revoked
 
 	return dump, nil
 }
@@ -255,5 +504,40 @@ func (mkb *memoryKeyBook) RestoreKeys(dump core.DumpKeyBook) error {
 	mkb.sks = dump.Data.Private
 	mkb.rks = dump.Data.Read
 	mkb.fks = dump.Data.Service
+	mkb.rkh = make(map[thread.ID][][]byte, len(dump.Data.ReadHistory))
+	for tid, keys := range dump.Data.ReadHistory {
+		mkb.rkh[tid] = keys
+	}
+	mkb.fkh = make(map[thread.ID][][]byte, len(dump.Data.ServiceHistory))
+	for tid, keys := range dump.Data.ServiceHistory {
+		mkb.fkh[tid] = keys
+	}
+	mkb.rkc = make(map[thread.ID][]int64, len(dump.Data.ReadCreated))
+	for tid, times := range dump.Data.ReadCreated {
+		mkb.rkc[tid] = times
+	}
+	mkb.fkc = make(map[thread.ID][]int64, len(dump.Data.ServiceCreated))
+	for tid, times := range dump.Data.ServiceCreated {
+		mkb.fkc[tid] = times
+	}
+	mkb.revoked = make(map[thread.ID]map[thread.LogID]struct{}, len(dump.Data.Revoked))
+	for tid, logs := range dump.Data.Revoked {
+		lm := make(map[thread.LogID]struct{}, len(logs))
+		for _, lid := range logs {
+			lm[lid] = struct{}{}
+		}
+		mkb.revoked[tid] = lm
+	}
+	mkb.threads = make(map[thread.LogID]map[thread.ID]struct{})
+	for tid, logs := range mkb.pks {
+		for lid := range logs {
+			mkb.indexLog(tid, lid)
+		}
+	}
+	for tid, logs := range mkb.sks {
+		for lid := range logs {
+			mkb.indexLog(tid, lid)
+		}
+	}
 	return nil
 }
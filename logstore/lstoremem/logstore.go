@@ -1,6 +1,8 @@
 package lstoremem
 
 import (
+	"time"
+
 	core "github.com/textileio/go-threads/core/logstore"
 	lstore "github.com/textileio/go-threads/logstore"
 )
@@ -8,11 +10,46 @@ import (
 // Define if storage will accept empty dumps.
 var AllowEmptyRestore = true
 
+// DefaultMetaSweepInterval is the period of purging expired metadata if
+// Options.MetaSweepInterval isn't set.
+const DefaultMetaSweepInterval = time.Minute
+
+// Options configures the in-memory books.
+type Options struct {
+	// MaxAddrsPerLog is the maximum number of addresses kept for a log.
+	// When exceeded, the address expiring first is evicted. Zero means no
+	// limit.
+	MaxAddrsPerLog int
+
+	// MetaSweepInterval is the period of purging expired metadata. A zero
+	// value selects DefaultMetaSweepInterval.
+	MetaSweepInterval time.Duration
+
+	// AddrDialFreshness is the period a successful dial of an address is
+	// considered fresh when sorting addresses. A zero value selects
+	// core.DefaultAddrDialFreshness.
+	AddrDialFreshness time.Duration
+}
+
+// DefaultOpts returns the options of books created without options.
+func DefaultOpts() Options {
+	return Options{
+		MaxAddrsPerLog: 1024,
+	}
+}
+
 // NewLogstore creates an in-memory threadsafe collection of thread logs.
-func NewLogstore() core.Logstore {
+func NewLogstore(opts ...lstore.Option) core.Logstore {
+	return NewLogstoreWithOptions(DefaultOpts(), opts...)
+}
+
+// NewLogstoreWithOptions creates an in-memory logstore whose books are
+// configured by o.
+func NewLogstoreWithOptions(o Options, opts ...lstore.Option) core.Logstore {
 	return lstore.NewLogstore(
 		NewKeyBook(),
-		NewAddrBook(),
+		NewAddrBookWithOptions(o),
 		NewHeadBook(),
-		NewThreadMetadata())
+		NewThreadMetadataWithOptions(o),
+		opts...)
 }
@@ -1,26 +1,86 @@
 package lstoremem
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 )
 
 type memoryThreadMetadata struct {
-	ds     map[core.MetadataKey]interface{}
-	dslock sync.RWMutex
+	ds map[core.MetadataKey]interface{}
+	// expires holds expiration times of keys stored with a TTL.
+	expires map[core.MetadataKey]time.Time
+	dslock  sync.RWMutex
+
+	// sweeper is started with the first key stored with a TTL and purges
+	// expired keys every sweep interval.
+	sweepInterval time.Duration
+	sweepOnce     sync.Once
+	ctx           context.Context
+	cancel        func()
 }
 
 var _ core.ThreadMetadata = (*memoryThreadMetadata)(nil)
 
 func NewThreadMetadata() core.ThreadMetadata {
+	return NewThreadMetadataWithOptions(DefaultOpts())
+}
+
+// NewThreadMetadataWithOptions returns a metadata book purging expired
+// values every o.MetaSweepInterval.
+func NewThreadMetadataWithOptions(o Options) core.ThreadMetadata {
+	sweep := o.MetaSweepInterval
+	if sweep <= 0 {
+		sweep = DefaultMetaSweepInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &memoryThreadMetadata{
-		ds: make(map[core.MetadataKey]interface{}),
+		ds:            make(map[core.MetadataKey]interface{}),
+		expires:       make(map[core.MetadataKey]time.Time),
+		sweepInterval: sweep,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// background periodically purges expired keys.
+func (m *memoryThreadMetadata) background() {
+	ticker := time.NewTicker(m.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.sweep()
+		case <-m.ctx.Done():
+			return
+		}
 	}
 }
 
+func (m *memoryThreadMetadata) sweep() {
+	m.dslock.Lock()
+	defer m.dslock.Unlock()
+	now := time.Now()
+	for k, exp := range m.expires {
+		if !exp.After(now) {
+			delete(m.ds, k)
+			delete(m.expires, k)
+		}
+	}
+}
+
+func (m *memoryThreadMetadata) Close() error {
+	m.cancel()
+	return nil
+}
+
 func (m *memoryThreadMetadata) PutInt64(t thread.ID, key string, val int64) error {
 	m.putValue(t, key, val)
 	return nil
@@ -75,27 +135,175 @@ func (m *memoryThreadMetadata) GetBytes(t thread.ID, key string) (*[]byte, error
 	return &val, nil
 }
 
+func (m *memoryThreadMetadata) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return core.ErrInvalidTTL
+	}
+	switch v := val.(type) {
+	case int64, string, bool:
+	case []byte:
+		b := make([]byte, len(v))
+		copy(b, v)
+		val = b
+	default:
+		return fmt.Errorf("unsupported value type %T", val)
+	}
+	m.sweepOnce.Do(func() { go m.background() })
+
+	m.dslock.Lock()
+	defer m.dslock.Unlock()
+	mk := core.MetadataKey{T: t, K: key}
+	m.ds[mk] = val
+	m.expires[mk] = time.Now().Add(ttl)
+	return nil
+}
+
 func (m *memoryThreadMetadata) putValue(t thread.ID, key string, val interface{}) {
 	m.dslock.Lock()
 	defer m.dslock.Unlock()
-	m.ds[core.MetadataKey{T: t, K: key}] = val
+	mk := core.MetadataKey{T: t, K: key}
+	m.ds[mk] = val
+	delete(m.expires, mk)
 }
 
 func (m *memoryThreadMetadata) getValue(t thread.ID, key string) interface{} {
 	m.dslock.RLock()
 	defer m.dslock.RUnlock()
-	if v, ok := m.ds[core.MetadataKey{T: t, K: key}]; ok {
+	mk := core.MetadataKey{T: t, K: key}
+	if m.expired(mk, time.Now()) {
+		return nil
+	}
+	if v, ok := m.ds[mk]; ok {
 		return v
 	}
 	return nil
 }
 
+// expired reports whether the key has expired but isn't purged yet.
+func (m *memoryThreadMetadata) expired(mk core.MetadataKey, now time.Time) bool {
+	exp, ok := m.expires[mk]
+	return ok && !exp.After(now)
+}
+
+func (m *memoryThreadMetadata) MetaKeys(t thread.ID) ([]string, error) {
+	m.dslock.RLock()
+	defer m.dslock.RUnlock()
+	var (
+		keys []string
+		now  = time.Now()
+	)
+	for k := range m.ds {
+		if k.T.Equals(t) && !m.expired(k, now) {
+			keys = append(keys, k.K)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ForEachThreadWithMeta calls fn with every thread having a value stored
+// under the key until it returns false.
+func (m *memoryThreadMetadata) ForEachThreadWithMeta(key string, fn func(thread.ID) bool) error {
+	m.dslock.RLock()
+	var (
+		ids thread.IDSlice
+		now = time.Now()
+	)
+	for k := range m.ds {
+		if k.K == key && !m.expired(k, now) {
+			ids = append(ids, k.T)
+		}
+	}
+	m.dslock.RUnlock()
+
+	for _, id := range ids {
+		if !fn(id) {
+			break
+		}
+	}
+	return nil
+}
+
+// MetaEntrySizes returns sizes of metadata entries of a thread by key, as
+// counted against quotas.
+func (m *memoryThreadMetadata) MetaEntrySizes(t thread.ID) (map[string]int64, error) {
+	m.dslock.RLock()
+	defer m.dslock.RUnlock()
+	var (
+		sizes = make(map[string]int64)
+		now   = time.Now()
+	)
+	for k, v := range m.ds {
+		if k.T.Equals(t) && !m.expired(k, now) {
+			sizes[k.K] = core.MetaEntrySize(k.K, v)
+		}
+	}
+	return sizes, nil
+}
+
+// ThreadMeta returns all metadata values of a thread.
+func (m *memoryThreadMetadata) ThreadMeta(t thread.ID) (core.MetadataValues, error) {
+	vals := core.MetadataValues{
+		Int64:   make(map[string]int64),
+		Bool:    make(map[string]bool),
+		String:  make(map[string]string),
+		Bytes:   make(map[string][]byte),
+		Expires: make(map[string]time.Time),
+	}
+	m.dslock.RLock()
+	defer m.dslock.RUnlock()
+	now := time.Now()
+	for k, v := range m.ds {
+		if !k.T.Equals(t) || m.expired(k, now) {
+			continue
+		}
+		if exp, ok := m.expires[k]; ok {
+			vals.Expires[k.K] = exp
+		}
+		switch val := v.(type) {
+		case int64:
+			vals.Int64[k.K] = val
+		case bool:
+			vals.Bool[k.K] = val
+		case string:
+			vals.String[k.K] = val
+		case []byte:
+			vals.Bytes[k.K] = val
+		}
+	}
+	return vals, nil
+}
+
+// DeleteMetaPrefix deletes the key and all keys nested under it. Reserved
+// keys are only deleted by reserved prefixes, and prefixes of every key fail
+// with core.ErrInvalidMetaKey, see ClearMetadata.
+func (m *memoryThreadMetadata) DeleteMetaPrefix(t thread.ID, prefix string) error {
+	prefix = core.CleanMetaKey(prefix)
+	if prefix == "" {
+		return core.ErrInvalidMetaKey
+	}
+	reserved := core.IsReservedKey(prefix)
+	m.dslock.Lock()
+	defer m.dslock.Unlock()
+	for k := range m.ds {
+		if !k.T.Equals(t) || core.IsReservedKey(k.K) != reserved {
+			continue
+		}
+		if k.K == prefix || strings.HasPrefix(k.K, prefix+"/") {
+			delete(m.ds, k)
+			delete(m.expires, k)
+		}
+	}
+	return nil
+}
+
 func (m *memoryThreadMetadata) ClearMetadata(t thread.ID) error {
 	m.dslock.Lock()
 	defer m.dslock.Unlock()
 	for k := range m.ds {
 		if k.T.Equals(t) {
 			delete(m.ds, k)
+			delete(m.expires, k)
 		}
 	}
 	return nil
@@ -111,9 +319,14 @@ func (m *memoryThreadMetadata) DumpMeta() (core.DumpMetadata, error) {
 		vBool   = make(map[core.MetadataKey]bool)
 		vString = make(map[core.MetadataKey]string)
 		vBytes  = make(map[core.MetadataKey][]byte)
+		expires = make(map[core.MetadataKey]time.Time)
+		now     = time.Now()
 	)
 
 	for mk, value := range m.ds {
+		if m.expired(mk, now) {
+			continue
+		}
 		switch v := value.(type) {
 		case bool:
 			vBool[mk] = v
@@ -126,12 +339,16 @@ func (m *memoryThreadMetadata) DumpMeta() (core.DumpMetadata, error) {
 		default:
 			return dump, fmt.Errorf("unsupported value type %T, key: %v, value: %v", value, mk, value)
 		}
+		if exp, ok := m.expires[mk]; ok {
+			expires[mk] = exp
+		}
 	}
 
 	dump.Data.Bool = vBool
 	dump.Data.Int64 = vInt64
 	dump.Data.String = vString
 	dump.Data.Bytes = vBytes
+	dump.Expires = expires
 	return dump, nil
 }
 
@@ -149,6 +366,7 @@ func (m *memoryThreadMetadata) RestoreMeta(dump core.DumpMetadata) error {
 
 	// clear local data
 	m.ds = make(map[core.MetadataKey]interface{}, dataLen)
+	m.expires = make(map[core.MetadataKey]time.Time)
 
 	// replace with dump
 	for mk, val := range dump.Data.Bool {
@@ -164,5 +382,21 @@ func (m *memoryThreadMetadata) RestoreMeta(dump core.DumpMetadata) error {
 		m.ds[mk] = val
 	}
 
+	// keep values stored with a TTL expiring, dropping the expired ones
+	now := time.Now()
+	for mk, exp := range dump.Expires {
+		if _, ok := m.ds[mk]; !ok {
+			continue
+		}
+		if !exp.After(now) {
+			delete(m.ds, mk)
+			continue
+		}
+		m.expires[mk] = exp
+	}
+	if len(m.expires) > 0 {
+		m.sweepOnce.Do(func() { go m.background() })
+	}
+
 	return nil
 }
@@ -0,0 +1,177 @@
+package logstore
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+const metricsNamespace = "threads_logstore"
+
+// WithMetrics registers metrics of the logstore to the registerer: counts,
+// errors and latencies of operations per book, along with the number of
+// address stream subscribers and addresses purged by GC if supported by
+// the address book.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(opts *Options) {
+		opts.Registerer = reg
+	}
+}
+
+// metrics observes book operations.
+type metrics struct {
+	ops      *prometheus.CounterVec
+	errs     *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var _ Observer = (*metrics)(nil)
+
+// addrSubscribers is implemented by address books counting subscribers of
+// address streams.
+type addrSubscribers interface {
+	AddrSubscribers() int
+}
+
+// addrPurger is implemented by address books purging expired addresses.
+type addrPurger interface {
+	PurgedAddrs() uint64
+}
+
+func newMetrics(reg prometheus.Registerer, ab interface{}) (*metrics, error) {
+	labels := []string{"book", "op"}
+	m := &metrics{
+		ops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "ops_total",
+			Help:      "Number of operations on logstore books.",
+		}, labels),
+		errs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "errors_total",
+			Help:      "Number of failed operations on logstore books.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "op_duration_seconds",
+			Help:      "Latency of operations on logstore books.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, labels),
+	}
+	// several stores may share a registerer, e.g. the default one, so
+	// operations of all of them are counted by the collectors registered
+	// first, and values of the address books are summed up
+	ops, err := registerOrExisting(reg, m.ops)
+	if err != nil {
+		return nil, err
+	}
+	errs, err := registerOrExisting(reg, m.errs)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := registerOrExisting(reg, m.duration)
+	if err != nil {
+		return nil, err
+	}
+	m.ops = ops.(*prometheus.CounterVec)
+	m.errs = errs.(*prometheus.CounterVec)
+	m.duration = duration.(*prometheus.HistogramVec)
+	if s, ok := ab.(addrSubscribers); ok {
+		err = registerSum(reg, s.AddrSubscribers, func(sum func() float64) prometheus.Collector {
+			return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "addr_subscribers",
+				Help:      "Number of subscribers of address streams.",
+			}, sum)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p, ok := ab.(addrPurger); ok {
+		purged := func() int { return int(p.PurgedAddrs()) }
+		err = registerSum(reg, purged, func(sum func() float64) prometheus.Collector {
+			return prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "gc_purged_addrs_total",
+				Help:      "Number of expired addresses purged by GC.",
+			}, sum)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// registerOrExisting registers the collector, or returns the one already
+// registered under the same descriptors.
+func registerOrExisting(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	err := reg.Register(c)
+	if err == nil {
+		return c, nil
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if reflect.TypeOf(are.ExistingCollector) == reflect.TypeOf(c) {
+			return are.ExistingCollector, nil
+		}
+		return nil, fmt.Errorf("metric of another collector already registered: %w", err)
+	}
+	return nil, err
+}
+
+// sumCollector reports the sum of values of several stores.
+type sumCollector struct {
+	prometheus.Collector
+
+	lk  sync.Mutex
+	fns []func() int
+}
+
+func (s *sumCollector) add(fn func() int) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.fns = append(s.fns, fn)
+}
+
+func (s *sumCollector) sum() float64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	var sum int
+	for _, fn := range s.fns {
+		sum += fn()
+	}
+	return float64(sum)
+}
+
+// registerSum adds the value to the sum reported by the collector made with
+// newCollector, registering it on first use.
+func registerSum(reg prometheus.Registerer, fn func() int, newCollector func(func() float64) prometheus.Collector) error {
+	s := &sumCollector{fns: []func() int{fn}}
+	s.Collector = newCollector(s.sum)
+	existing, err := registerOrExisting(reg, s)
+	if err != nil {
+		return err
+	}
+	if existing != prometheus.Collector(s) {
+		existing.(*sumCollector).add(fn)
+	}
+	return nil
+}
+
+func (m *metrics) Start(book, op string, _ thread.ID) func(error) {
+	start := time.Now()
+	return func(err error) {
+		m.ops.WithLabelValues(book, op).Inc()
+		m.duration.WithLabelValues(book, op).Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.errs.WithLabelValues(book, op).Inc()
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package logstore
+
+import (
+	core "github.com/textileio/go-threads/core/logstore"
+)
+
+// Middleware decorates a logstore, e.g. with logging, metrics, validation,
+// rate-limiting or caching. Decorators usually embed the logstore and
+// override the methods they are concerned with, as ReadOnly does.
+type Middleware func(core.Logstore) core.Logstore
+
+var _ Middleware = ReadOnly
+
+// Chain decorates the logstore with the middlewares. The first middleware
+// is the outermost one, i.e. it sees calls first and results last.
+func Chain(ls core.Logstore, mws ...Middleware) core.Logstore {
+	for i := len(mws) - 1; i >= 0; i-- {
+		ls = mws[i](ls)
+	}
+	return ls
+}
+
+// Compose returns a middleware applying the middlewares like Chain does.
+func Compose(mws ...Middleware) Middleware {
+	return func(ls core.Logstore) core.Logstore {
+		return Chain(ls, mws...)
+	}
+}
@@ -0,0 +1,102 @@
+package logstore
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	core "github.com/textileio/go-threads/core/logstore"
+)
+
+// logstoreWrites names writes of core.Logstore not covered by IsWriteOp.
+var logstoreWrites = map[string]bool{
+	"AcceptInvite":    true,
+	"Archive":         true,
+	"ArchiveThread":   true,
+	"Batch":           true,
+	"BeginTxn":        true,
+	"CreateThread":    true,
+	"ImportKeys":      true,
+	"ImportThread":    true,
+	"Pin":             true,
+	"Unarchive":       true,
+	"UnarchiveThread": true,
+	"Unpin":           true,
+}
+
+// writeMethods returns the names of all writes of core.Logstore and its
+// optional capabilities.
+func writeMethods() []string {
+	var names []string
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf((*core.Logstore)(nil)).Elem(),
+		reflect.TypeOf((*core.NameBook)(nil)).Elem(),
+		reflect.TypeOf((*core.PinBook)(nil)).Elem(),
+		reflect.TypeOf((*core.AccessBook)(nil)).Elem(),
+		reflect.TypeOf((*core.Inviter)(nil)).Elem(),
+		reflect.TypeOf((*core.Snapshotter)(nil)).Elem(),
+		reflect.TypeOf((*core.Transactor)(nil)).Elem(),
+	} {
+		for i := 0; i < typ.NumMethod(); i++ {
+			if name := typ.Method(i).Name; IsWriteOp(name) || logstoreWrites[name] {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// overrides reports whether the method is declared on the type itself,
+// rather than promoted from the embedded logstore by a wrapper generated by
+// the compiler.
+func overrides(typ reflect.Type, name string) bool {
+	m, ok := typ.MethodByName(name)
+	if !ok {
+		return false
+	}
+	fn := runtime.FuncForPC(m.Func.Pointer())
+	file, _ := fn.FileLine(fn.Entry())
+	return !strings.HasSuffix(file, "<autogenerated>")
+}
+
+func TestReadOnlyOverridesWrites(t *testing.T) {
+	typ := reflect.TypeOf(&readOnlyLogstore{})
+	for _, name := range writeMethods() {
+		if !overrides(typ, name) {
+			t.Errorf("read-only logstore passes %s through", name)
+		}
+	}
+}
+
+func TestValidateOverridesWrites(t *testing.T) {
+	// blobs and backups are decoded by the store itself
+	unvalidated := map[string]bool{
+		"ImportKeys":   true,
+		"ImportThread": true,
+		"Restore":      true,
+		"Unarchive":    true,
+	}
+
+	typ := reflect.TypeOf(&validatingLogstore{})
+	for _, name := range writeMethods() {
+		if !unvalidated[name] && !overrides(typ, name) {
+			t.Errorf("validating logstore passes %s through", name)
+		}
+	}
+}
+
+func TestValidateTxnOverridesWrites(t *testing.T) {
+	// blobs are decoded by the store itself
+	unvalidated := map[string]bool{"ImportThread": true, "Commit": true, "Rollback": true}
+
+	typ := reflect.TypeOf(&validatingTxn{})
+	txn := reflect.TypeOf((*core.Txn)(nil)).Elem()
+	for i := 0; i < txn.NumMethod(); i++ {
+		name := txn.Method(i).Name
+		if (IsWriteOp(name) || logstoreWrites[name] || strings.HasPrefix(name, "Delete")) &&
+			!unvalidated[name] && !overrides(typ, name) {
+			t.Errorf("validating txn passes %s through", name)
+		}
+	}
+}
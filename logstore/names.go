@@ -0,0 +1,90 @@
+package logstore
+
+import (
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Thread names are kept in the thread metadata under the same key as the
+// name given on creation. Lookups by name walk the threads having a name,
+// reading values of the name key only.
+
+// SetThreadName names the thread, ensuring no other thread has the name.
+func (ls *logstore) SetThreadName(id thread.ID, name string) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return core.ErrThreadNotFound
+	}
+	if name == "" {
+		return ls.ThreadMetadata.DeleteMetaPrefix(id, core.MetaThreadName)
+	}
+	owner, found, err := ls.threadByName(name)
+	if err != nil {
+		return err
+	}
+	if found && !owner.Equals(id) {
+		return core.ErrThreadNameTaken
+	}
+	return ls.putString(id, core.MetaThreadName, name)
+}
+
+// ThreadByName returns the thread having the name.
+func (ls *logstore) ThreadByName(name string) (thread.ID, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	id, found, err := ls.threadByName(name)
+	if err != nil {
+		return thread.Undef, err
+	}
+	if !found {
+		return thread.Undef, core.ErrThreadNotFound
+	}
+	return id, nil
+}
+
+// ThreadNames returns all named threads by name.
+func (ls *logstore) ThreadNames() (map[string]thread.ID, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	names := make(map[string]thread.ID)
+	err := ls.forEachName(func(id thread.ID, name string) bool {
+		names[name] = id
+		return true
+	})
+	return names, err
+}
+
+func (ls *logstore) threadByName(name string) (id thread.ID, found bool, err error) {
+	err = ls.forEachName(func(tid thread.ID, n string) bool {
+		if n == name {
+			id, found = tid, true
+		}
+		return !found
+	})
+	return
+}
+
+// forEachName calls fn for every named thread until it returns false.
+func (ls *logstore) forEachName(fn func(thread.ID, string) bool) error {
+	var ferr error
+	if err := forEachThreadWithMeta(ls.ThreadMetadata, core.MetaThreadName, func(id thread.ID) bool {
+		name, err := ls.GetString(id, core.MetaThreadName)
+		if err != nil {
+			ferr = err
+			return false
+		}
+		// the name may be gone since the thread was passed
+		return name == nil || fn(id, *name)
+	}); err != nil {
+		return err
+	}
+	return ferr
+}
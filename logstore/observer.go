@@ -0,0 +1,787 @@
+package logstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// Observer is notified of operations on the books of a logstore, e.g. to
+// collect metrics or trace them.
+type Observer interface {
+	// Start is called before an operation of a book on a thread and returns
+	// a function called with the error of the operation once it is done.
+	// The thread is undefined for operations spanning all threads.
+	Start(book, op string, t thread.ID) func(error)
+}
+
+// ContextObserver is an Observer joining the context of callers of the
+// context-aware logstore, see core.ContextLogstore. Operations of the books
+// done on behalf of such a call are started with the returned context.
+type ContextObserver interface {
+	Observer
+
+	// StartContext is like Start, but starts the operation from ctx and
+	// returns the context of the operation.
+	StartContext(ctx context.Context, book, op string, t thread.ID) (context.Context, func(error))
+}
+
+// writeOps prefix names of book operations changing entries of a thread.
+var writeOps = []string{"Add", "Clear", "Consume", "Delete", "Put", "Record", "Replace", "Restore", "Revoke", "Rotate", "Set", "Update"}
+
+// IsWriteOp reports whether the book operation passed to an Observer
+// changes entries of the books.
+func IsWriteOp(op string) bool {
+	if strings.HasPrefix(op, "Addr") {
+		// Addrs, AddrStream, etc.
+		return false
+	}
+	for _, prefix := range writeOps {
+		if strings.HasPrefix(op, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithObserver adds an observer of book operations.
+func WithObserver(o Observer) Option {
+	return func(opts *Options) {
+		opts.Observers = append(opts.Observers, o)
+	}
+}
+
+type observeFunc func(ctx context.Context, book, op string, t thread.ID) func(*error)
+
+// observeWith returns a function notifying all observers of an operation.
+// Context observers are started from ctx unless it's nil.
+func observeWith(observers []Observer) observeFunc {
+	return func(ctx context.Context, book, op string, t thread.ID) func(*error) {
+		done := make([]func(error), len(observers))
+		for i, o := range observers {
+			if co, ok := o.(ContextObserver); ok && ctx != nil {
+				_, done[i] = co.StartContext(ctx, book, op, t)
+			} else {
+				done[i] = o.Start(book, op, t)
+			}
+		}
+		return func(err *error) {
+			for _, fn := range done {
+				fn(*err)
+			}
+		}
+	}
+}
+
+// withContext starts an operation of the logstore with context observers
+// and returns a view of the logstore bound to the context of the operation,
+// see bind.
+func (ls *logstore) withContext(ctx context.Context, op string, t thread.ID) (*logstore, func(*error)) {
+	var done []func(error)
+	for _, o := range ls.opts.Observers {
+		if co, ok := o.(ContextObserver); ok {
+			var fn func(error)
+			ctx, fn = co.StartContext(ctx, "logstore", op, t)
+			done = append(done, fn)
+		}
+	}
+	finish := func(err *error) {
+		for _, fn := range done {
+			fn(*err)
+		}
+	}
+	return ls.bind(ctx), finish
+}
+
+// bind returns a view of the logstore whose books start their operations
+// from ctx and fail with its error once it's done. The view shares its
+// lock and state with the logstore.
+func (ls *logstore) bind(ctx context.Context) *logstore {
+	v := *ls
+	if b, ok := ls.KeyBook.(*observedKeyBook); ok {
+		kb := *b
+		kb.ctx = ctx
+		v.KeyBook = &kb
+	} else {
+		v.KeyBook = &observedKeyBook{KeyBook: ls.KeyBook, observe: observeWith(nil), ctx: ctx}
+	}
+	if b, ok := ls.AddrBook.(*observedAddrBook); ok {
+		ab := *b
+		ab.ctx = ctx
+		v.AddrBook = &ab
+	} else {
+		v.AddrBook = &observedAddrBook{AddrBook: ls.AddrBook, observe: observeWith(nil), ctx: ctx}
+	}
+	if b, ok := ls.HeadBook.(*observedHeadBook); ok {
+		hb := *b
+		hb.ctx = ctx
+		v.HeadBook = &hb
+	} else {
+		v.HeadBook = &observedHeadBook{HeadBook: ls.HeadBook, observe: observeWith(nil), ctx: ctx}
+	}
+	if b, ok := ls.ThreadMetadata.(*observedThreadMetadata); ok {
+		md := *b
+		md.ctx = ctx
+		v.ThreadMetadata = &md
+	} else {
+		v.ThreadMetadata = &observedThreadMetadata{ThreadMetadata: ls.ThreadMetadata, observe: observeWith(nil), ctx: ctx}
+	}
+	return &v
+}
+
+// withoutCancel returns a view of the logstore whose books keep running
+// once the context of the view is done, e.g. to clean up after a stopped
+// operation.
+func (ls *logstore) withoutCancel() *logstore {
+	if b, ok := ls.KeyBook.(*observedKeyBook); ok && b.ctx != nil {
+		return ls.bind(detachedContext{b.ctx})
+	}
+	return ls
+}
+
+// observeBooks wraps the books of the logstore to notify observers.
+func (ls *logstore) observeBooks(observers []Observer) {
+	observe := observeWith(observers)
+	ls.KeyBook = &observedKeyBook{KeyBook: ls.KeyBook, observe: observe}
+	ls.AddrBook = &observedAddrBook{AddrBook: ls.AddrBook, observe: observe}
+	ls.HeadBook = &observedHeadBook{HeadBook: ls.HeadBook, observe: observe}
+	ls.ThreadMetadata = &observedThreadMetadata{ThreadMetadata: ls.ThreadMetadata, observe: observe}
+}
+
+func closeBook(b interface{}) error {
+	if c, ok := b.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (b *observedKeyBook) Close() error        { return closeBook(b.KeyBook) }
+func (b *observedAddrBook) Close() error       { return closeBook(b.AddrBook) }
+func (b *observedHeadBook) Close() error       { return closeBook(b.HeadBook) }
+func (b *observedThreadMetadata) Close() error { return closeBook(b.ThreadMetadata) }
+
+func (b *observedKeyBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.KeyBook, t)
+}
+func (b *observedAddrBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.AddrBook, t)
+}
+func (b *observedHeadBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.HeadBook, t)
+}
+func (b *observedThreadMetadata) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.ThreadMetadata, t)
+}
+
+// observedKeyBook notifies observers of operations on a key book.
+type observedKeyBook struct {
+	core.KeyBook
+	observe observeFunc
+	ctx     context.Context
+}
+
+func (b *observedKeyBook) PubKey(t thread.ID, l thread.LogID) (v crypto.PubKey, err error) {
+	defer b.observe(b.ctx, "key", "PubKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.PubKey(t, l)
+}
+
+func (b *observedKeyBook) AddPubKey(t thread.ID, l thread.LogID, pk crypto.PubKey) (err error) {
+	defer b.observe(b.ctx, "key", "AddPubKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.AddPubKey(t, l, pk)
+}
+
+func (b *observedKeyBook) RevokePubKey(t thread.ID, l thread.LogID) (err error) {
+	defer b.observe(b.ctx, "key", "RevokePubKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.RevokePubKey(t, l)
+}
+
+func (b *observedKeyBook) IsRevoked(t thread.ID, l thread.LogID) (v bool, err error) {
+	defer b.observe(b.ctx, "key", "IsRevoked", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.IsRevoked(t, l)
+}
+
+func (b *observedKeyBook) PrivKey(t thread.ID, l thread.LogID) (v crypto.PrivKey, err error) {
+	defer b.observe(b.ctx, "key", "PrivKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.PrivKey(t, l)
+}
+
+func (b *observedKeyBook) AddPrivKey(t thread.ID, l thread.LogID, sk crypto.PrivKey) (err error) {
+	defer b.observe(b.ctx, "key", "AddPrivKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.AddPrivKey(t, l, sk)
+}
+
+func (b *observedKeyBook) HasPrivKey(t thread.ID, l thread.LogID) (v bool, err error) {
+	defer b.observe(b.ctx, "key", "HasPrivKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.HasPrivKey(t, l)
+}
+
+func (b *observedKeyBook) ReadKey(t thread.ID) (v *sym.Key, err error) {
+	defer b.observe(b.ctx, "key", "ReadKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ReadKey(t)
+}
+
+func (b *observedKeyBook) AddReadKey(t thread.ID, key *sym.Key) (err error) {
+	defer b.observe(b.ctx, "key", "AddReadKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.AddReadKey(t, key)
+}
+
+func (b *observedKeyBook) HasReadKey(t thread.ID) (v bool, err error) {
+	defer b.observe(b.ctx, "key", "HasReadKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.HasReadKey(t)
+}
+
+func (b *observedKeyBook) ServiceKey(t thread.ID) (v *sym.Key, err error) {
+	defer b.observe(b.ctx, "key", "ServiceKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ServiceKey(t)
+}
+
+func (b *observedKeyBook) AddServiceKey(t thread.ID, key *sym.Key) (err error) {
+	defer b.observe(b.ctx, "key", "AddServiceKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.AddServiceKey(t, key)
+}
+
+func (b *observedKeyBook) HasServiceKey(t thread.ID) (v bool, err error) {
+	defer b.observe(b.ctx, "key", "HasServiceKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.HasServiceKey(t)
+}
+
+func (b *observedKeyBook) RotateReadKey(t thread.ID, key *sym.Key) (v int, err error) {
+	defer b.observe(b.ctx, "key", "RotateReadKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.RotateReadKey(t, key)
+}
+
+func (b *observedKeyBook) ReadKeyVersion(t thread.ID, version int) (v *sym.Key, err error) {
+	defer b.observe(b.ctx, "key", "ReadKeyVersion", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ReadKeyVersion(t, version)
+}
+
+func (b *observedKeyBook) ReadKeyVersions(t thread.ID) (v []core.KeyVersion, err error) {
+	defer b.observe(b.ctx, "key", "ReadKeyVersions", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ReadKeyVersions(t)
+}
+
+func (b *observedKeyBook) RotateServiceKey(t thread.ID, key *sym.Key) (v int, err error) {
+	defer b.observe(b.ctx, "key", "RotateServiceKey", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.RotateServiceKey(t, key)
+}
+
+func (b *observedKeyBook) ServiceKeyVersion(t thread.ID, version int) (v *sym.Key, err error) {
+	defer b.observe(b.ctx, "key", "ServiceKeyVersion", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ServiceKeyVersion(t, version)
+}
+
+func (b *observedKeyBook) ServiceKeyVersions(t thread.ID) (v []core.KeyVersion, err error) {
+	defer b.observe(b.ctx, "key", "ServiceKeyVersions", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ServiceKeyVersions(t)
+}
+
+func (b *observedKeyBook) ClearKeys(t thread.ID) (err error) {
+	defer b.observe(b.ctx, "key", "ClearKeys", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ClearKeys(t)
+}
+
+func (b *observedKeyBook) ClearLogKeys(t thread.ID, l thread.LogID) (err error) {
+	defer b.observe(b.ctx, "key", "ClearLogKeys", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ClearLogKeys(t, l)
+}
+
+func (b *observedKeyBook) LogsWithKeys(t thread.ID) (v thread.LogIDSlice, err error) {
+	defer b.observe(b.ctx, "key", "LogsWithKeys", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.LogsWithKeys(t)
+}
+
+func (b *observedKeyBook) ThreadsFromKeys() (v thread.IDSlice, err error) {
+	defer b.observe(b.ctx, "key", "ThreadsFromKeys", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ThreadsFromKeys()
+}
+
+func (b *observedKeyBook) ThreadsWithLogKeys(l thread.LogID) (v thread.IDSlice, err error) {
+	defer b.observe(b.ctx, "key", "ThreadsWithLogKeys", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.ThreadsWithLogKeys(l)
+}
+
+func (b *observedKeyBook) DumpKeys() (v core.DumpKeyBook, err error) {
+	defer b.observe(b.ctx, "key", "DumpKeys", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.DumpKeys()
+}
+
+func (b *observedKeyBook) RestoreKeys(dump core.DumpKeyBook) (err error) {
+	defer b.observe(b.ctx, "key", "RestoreKeys", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.KeyBook.RestoreKeys(dump)
+}
+
+// observedAddrBook notifies observers of operations on a addr book.
+type observedAddrBook struct {
+	core.AddrBook
+	observe observeFunc
+	ctx     context.Context
+}
+
+func (b *observedAddrBook) AddAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) (err error) {
+	defer b.observe(b.ctx, "addr", "AddAddr", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.AddAddr(t, l, addr, ttl)
+}
+
+func (b *observedAddrBook) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) (err error) {
+	defer b.observe(b.ctx, "addr", "AddAddrs", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.AddAddrs(t, l, addrs, ttl)
+}
+
+func (b *observedAddrBook) SetAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) (err error) {
+	defer b.observe(b.ctx, "addr", "SetAddr", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.SetAddr(t, l, addr, ttl)
+}
+
+func (b *observedAddrBook) SetAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) (err error) {
+	defer b.observe(b.ctx, "addr", "SetAddrs", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.SetAddrs(t, l, addrs, ttl)
+}
+
+func (b *observedAddrBook) AddAddrsFromSource(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) (err error) {
+	defer b.observe(b.ctx, "addr", "AddAddrsFromSource", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.AddAddrsFromSource(t, l, addrs, ttl, src)
+}
+
+func (b *observedAddrBook) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) (err error) {
+	defer b.observe(b.ctx, "addr", "AddLogAddrsBulk", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.AddLogAddrsBulk(entries, ttl)
+}
+
+func (b *observedAddrBook) ConsumeLogRecord(t thread.ID, rec *record.Envelope, ttl time.Duration) (v bool, err error) {
+	defer b.observe(b.ctx, "addr", "ConsumeLogRecord", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.ConsumeLogRecord(t, rec, ttl)
+}
+
+func (b *observedAddrBook) LogRecord(t thread.ID, l thread.LogID) (v *record.Envelope, err error) {
+	defer b.observe(b.ctx, "addr", "LogRecord", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.LogRecord(t, l)
+}
+
+func (b *observedAddrBook) RecordDial(t thread.ID, l thread.LogID, addr ma.Multiaddr, latency time.Duration) (err error) {
+	defer b.observe(b.ctx, "addr", "RecordDial", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.RecordDial(t, l, addr, latency)
+}
+
+func (b *observedAddrBook) UpdateAddrs(t thread.ID, l thread.LogID, oldTTL time.Duration, newTTL time.Duration) (err error) {
+	defer b.observe(b.ctx, "addr", "UpdateAddrs", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.UpdateAddrs(t, l, oldTTL, newTTL)
+}
+
+func (b *observedAddrBook) Addrs(t thread.ID, l thread.LogID) (v []ma.Multiaddr, err error) {
+	defer b.observe(b.ctx, "addr", "Addrs", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.Addrs(t, l)
+}
+
+func (b *observedAddrBook) ForEachLogAddr(t thread.ID, l thread.LogID, fn func(ma.Multiaddr) bool) (err error) {
+	defer b.observe(b.ctx, "addr", "ForEachLogAddr", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.ForEachLogAddr(t, l, fn)
+}
+
+func (b *observedAddrBook) AddrsWithSource(t thread.ID, l thread.LogID) (v []core.ExpiredAddress, err error) {
+	defer b.observe(b.ctx, "addr", "AddrsWithSource", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.AddrsWithSource(t, l)
+}
+
+func (b *observedAddrBook) SortedAddrs(t thread.ID, l thread.LogID) (v []ma.Multiaddr, err error) {
+	defer b.observe(b.ctx, "addr", "SortedAddrs", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.SortedAddrs(t, l)
+}
+
+func (b *observedAddrBook) AddrStream(ctx context.Context, t thread.ID, l thread.LogID) (v <-chan ma.Multiaddr, err error) {
+	defer b.observe(b.ctx, "addr", "AddrStream", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.AddrStream(ctx, t, l)
+}
+
+func (b *observedAddrBook) ControlledAddrStream(ctx context.Context, t thread.ID, l thread.LogID) (v <-chan ma.Multiaddr, w core.AddrStreamControl, err error) {
+	defer b.observe(b.ctx, "addr", "ControlledAddrStream", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.ControlledAddrStream(ctx, t, l)
+}
+
+func (b *observedAddrBook) ThreadAddrStream(ctx context.Context, t thread.ID) (v <-chan core.LogAddr, err error) {
+	defer b.observe(b.ctx, "addr", "ThreadAddrStream", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.ThreadAddrStream(ctx, t)
+}
+
+func (b *observedAddrBook) ClearAddrs(t thread.ID, l thread.LogID) (err error) {
+	defer b.observe(b.ctx, "addr", "ClearAddrs", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.ClearAddrs(t, l)
+}
+
+func (b *observedAddrBook) LogsWithAddrs(t thread.ID) (v thread.LogIDSlice, err error) {
+	defer b.observe(b.ctx, "addr", "LogsWithAddrs", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.LogsWithAddrs(t)
+}
+
+func (b *observedAddrBook) ThreadsFromAddrs() (v thread.IDSlice, err error) {
+	defer b.observe(b.ctx, "addr", "ThreadsFromAddrs", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.ThreadsFromAddrs()
+}
+
+func (b *observedAddrBook) ThreadsWithLogAddrs(l thread.LogID) (v thread.IDSlice, err error) {
+	defer b.observe(b.ctx, "addr", "ThreadsWithLogAddrs", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.ThreadsWithLogAddrs(l)
+}
+
+func (b *observedAddrBook) LogsWithAddr(addr ma.Multiaddr) (v []core.ThreadLog, err error) {
+	defer b.observe(b.ctx, "addr", "LogsWithAddr", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.LogsWithAddr(addr)
+}
+
+func (b *observedAddrBook) DumpAddrs() (v core.DumpAddrBook, err error) {
+	defer b.observe(b.ctx, "addr", "DumpAddrs", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.DumpAddrs()
+}
+
+func (b *observedAddrBook) RestoreAddrs(dump core.DumpAddrBook) (err error) {
+	defer b.observe(b.ctx, "addr", "RestoreAddrs", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.AddrBook.RestoreAddrs(dump)
+}
+
+// observedHeadBook notifies observers of operations on a head book.
+type observedHeadBook struct {
+	core.HeadBook
+	observe observeFunc
+	ctx     context.Context
+}
+
+func (b *observedHeadBook) AddHead(t thread.ID, l thread.LogID, head cid.Cid) (err error) {
+	defer b.observe(b.ctx, "head", "AddHead", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.AddHead(t, l, head)
+}
+
+func (b *observedHeadBook) AddHeads(t thread.ID, l thread.LogID, heads []cid.Cid) (err error) {
+	defer b.observe(b.ctx, "head", "AddHeads", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.AddHeads(t, l, heads)
+}
+
+func (b *observedHeadBook) SetHead(t thread.ID, l thread.LogID, head cid.Cid) (err error) {
+	defer b.observe(b.ctx, "head", "SetHead", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.SetHead(t, l, head)
+}
+
+func (b *observedHeadBook) SetHeads(t thread.ID, l thread.LogID, heads []cid.Cid) (err error) {
+	defer b.observe(b.ctx, "head", "SetHeads", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.SetHeads(t, l, heads)
+}
+
+func (b *observedHeadBook) Heads(t thread.ID, l thread.LogID) (v []cid.Cid, err error) {
+	defer b.observe(b.ctx, "head", "Heads", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.Heads(t, l)
+}
+
+func (b *observedHeadBook) ClearHeads(t thread.ID, l thread.LogID) (err error) {
+	defer b.observe(b.ctx, "head", "ClearHeads", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.ClearHeads(t, l)
+}
+
+func (b *observedHeadBook) DumpHeads() (v core.DumpHeadBook, err error) {
+	defer b.observe(b.ctx, "head", "DumpHeads", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.DumpHeads()
+}
+
+func (b *observedHeadBook) RestoreHeads(dump core.DumpHeadBook) (err error) {
+	defer b.observe(b.ctx, "head", "RestoreHeads", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.HeadBook.RestoreHeads(dump)
+}
+
+// observedThreadMetadata notifies observers of operations on a metadata book.
+type observedThreadMetadata struct {
+	core.ThreadMetadata
+	observe observeFunc
+	ctx     context.Context
+}
+
+func (b *observedThreadMetadata) GetInt64(t thread.ID, key string) (v *int64, err error) {
+	defer b.observe(b.ctx, "metadata", "GetInt64", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.GetInt64(t, key)
+}
+
+func (b *observedThreadMetadata) PutInt64(t thread.ID, key string, val int64) (err error) {
+	defer b.observe(b.ctx, "metadata", "PutInt64", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.PutInt64(t, key, val)
+}
+
+func (b *observedThreadMetadata) GetString(t thread.ID, key string) (v *string, err error) {
+	defer b.observe(b.ctx, "metadata", "GetString", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.GetString(t, key)
+}
+
+func (b *observedThreadMetadata) PutString(t thread.ID, key string, val string) (err error) {
+	defer b.observe(b.ctx, "metadata", "PutString", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.PutString(t, key, val)
+}
+
+func (b *observedThreadMetadata) GetBool(t thread.ID, key string) (v *bool, err error) {
+	defer b.observe(b.ctx, "metadata", "GetBool", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.GetBool(t, key)
+}
+
+func (b *observedThreadMetadata) PutBool(t thread.ID, key string, val bool) (err error) {
+	defer b.observe(b.ctx, "metadata", "PutBool", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.PutBool(t, key, val)
+}
+
+func (b *observedThreadMetadata) GetBytes(t thread.ID, key string) (v *[]byte, err error) {
+	defer b.observe(b.ctx, "metadata", "GetBytes", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.GetBytes(t, key)
+}
+
+func (b *observedThreadMetadata) PutBytes(t thread.ID, key string, val []byte) (err error) {
+	defer b.observe(b.ctx, "metadata", "PutBytes", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.PutBytes(t, key, val)
+}
+
+func (b *observedThreadMetadata) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) (err error) {
+	defer b.observe(b.ctx, "metadata", "PutMetaWithTTL", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.PutMetaWithTTL(t, key, val, ttl)
+}
+
+func (b *observedThreadMetadata) MetaKeys(t thread.ID) (v []string, err error) {
+	defer b.observe(b.ctx, "metadata", "MetaKeys", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.MetaKeys(t)
+}
+
+func (b *observedThreadMetadata) DeleteMetaPrefix(t thread.ID, prefix string) (err error) {
+	defer b.observe(b.ctx, "metadata", "DeleteMetaPrefix", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.DeleteMetaPrefix(t, prefix)
+}
+
+func (b *observedThreadMetadata) ClearMetadata(t thread.ID) (err error) {
+	defer b.observe(b.ctx, "metadata", "ClearMetadata", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.ClearMetadata(t)
+}
+
+func (b *observedThreadMetadata) DumpMeta() (v core.DumpMetadata, err error) {
+	defer b.observe(b.ctx, "metadata", "DumpMeta", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.DumpMeta()
+}
+
+func (b *observedThreadMetadata) RestoreMeta(dump core.DumpMetadata) (err error) {
+	defer b.observe(b.ctx, "metadata", "RestoreMeta", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return b.ThreadMetadata.RestoreMeta(dump)
+}
@@ -0,0 +1,68 @@
+package logstore
+
+import (
+	"sort"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Pin priorities are kept in the thread metadata as int64 values under
+// MetaThreadPinned, so that they are dropped along with the thread.
+
+// Pin pins the thread with the priority.
+func (ls *logstore) Pin(id thread.ID, priority int) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	exists, err := ls.threadExists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return core.ErrThreadNotFound
+	}
+	return ls.putInt64(id, core.MetaThreadPinned, int64(priority))
+}
+
+// Unpin unpins the thread.
+func (ls *logstore) Unpin(id thread.ID) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	return ls.ThreadMetadata.DeleteMetaPrefix(id, core.MetaThreadPinned)
+}
+
+// PinnedThreads returns pinned threads, highest priority first. Threads of
+// the same priority are ordered by ID.
+func (ls *logstore) PinnedThreads() ([]core.Pin, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	dump, err := ls.DumpMeta()
+	if err != nil {
+		return nil, err
+	}
+	var pins []core.Pin
+	for mk, v := range dump.Data.Int64 {
+		if mk.K == core.MetaThreadPinned {
+			pins = append(pins, core.Pin{Thread: mk.T, Priority: int(v)})
+		}
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].Priority != pins[j].Priority {
+			return pins[i].Priority > pins[j].Priority
+		}
+		return pins[i].Thread.KeyString() < pins[j].Thread.KeyString()
+	})
+	return pins, nil
+}
+
+// isPinned returns whether the thread is pinned.
+func (ls *logstore) isPinned(id thread.ID) (bool, error) {
+	priority, err := ls.GetInt64(id, core.MetaThreadPinned)
+	if err != nil {
+		return false, err
+	}
+	return priority != nil, nil
+}
@@ -0,0 +1,549 @@
+package logstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Quota limits resources used by every thread. Zero values mean no limit.
+type Quota struct {
+	// MaxLogs is the maximum number of logs of a thread.
+	MaxLogs int
+
+	// MaxAddrs is the maximum number of addresses of a log.
+	MaxAddrs int
+
+	// MaxMetaBytes is the maximum size of the metadata of a thread, as
+	// computed by core.MetaEntrySize.
+	MaxMetaBytes int64
+}
+
+func (q Quota) enabled() bool {
+	return q.MaxLogs > 0 || q.MaxAddrs > 0 || q.MaxMetaBytes > 0
+}
+
+// WithQuota enforces the quota on writes. Writes exceeding it fail with a
+// *core.QuotaError. Restores of books are checked with the dump in place of
+// the book it replaces.
+func WithQuota(q Quota) Option {
+	return func(opts *Options) {
+		opts.Quota = q
+	}
+}
+
+// enforceQuota wraps the books of the logstore to reject writes exceeding
+// the quota.
+func (ls *logstore) enforceQuota(q Quota) {
+	e := &quotaEnforcer{
+		Quota: q,
+		kb:    ls.KeyBook,
+		ab:    ls.AddrBook,
+		md:    ls.ThreadMetadata,
+	}
+	if q.MaxLogs > 0 {
+		ls.KeyBook = &quotaKeyBook{KeyBook: ls.KeyBook, e: e}
+	}
+	if q.MaxLogs > 0 || q.MaxAddrs > 0 {
+		ls.AddrBook = &quotaAddrBook{AddrBook: ls.AddrBook, e: e}
+	}
+	if q.MaxMetaBytes > 0 {
+		ls.ThreadMetadata = &quotaThreadMetadata{ThreadMetadata: ls.ThreadMetadata, e: e}
+	}
+}
+
+// quotaEnforcer checks writes against the quota using the unwrapped books.
+// Checks and writes are serialized, so that concurrent writes cannot
+// exceed the quota together.
+type quotaEnforcer struct {
+	Quota
+	sync.Mutex
+
+	kb core.KeyBook
+	ab core.AddrBook
+	md core.ThreadMetadata
+}
+
+// checkLog ensures adding the log does not exceed the number of logs.
+func (e *quotaEnforcer) checkLog(t thread.ID, l thread.LogID) error {
+	if e.MaxLogs <= 0 {
+		return nil
+	}
+	set, err := e.threadLogs(t)
+	if err != nil {
+		return err
+	}
+	if _, ok := set[l]; ok {
+		return nil
+	}
+	if len(set) >= e.MaxLogs {
+		return &core.QuotaError{Thread: t, Limit: core.QuotaLogs, Max: int64(e.MaxLogs), Requested: int64(len(set) + 1)}
+	}
+	return nil
+}
+
+// threadLogs returns logs of the thread having keys or addresses.
+func (e *quotaEnforcer) threadLogs(t thread.ID) (map[thread.LogID]struct{}, error) {
+	set := make(map[thread.LogID]struct{})
+	withKeys, err := e.kb.LogsWithKeys(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range withKeys {
+		set[id] = struct{}{}
+	}
+	withAddrs, err := e.ab.LogsWithAddrs(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range withAddrs {
+		set[id] = struct{}{}
+	}
+	return set, nil
+}
+
+// checkAddrs ensures adding the addresses neither exceeds the number of
+// logs nor the number of addresses of the log.
+func (e *quotaEnforcer) checkAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if ttl <= 0 || len(addrs) == 0 {
+		// addresses are removed
+		return nil
+	}
+	if err := e.checkLog(t, l); err != nil {
+		return err
+	}
+	if e.MaxAddrs <= 0 {
+		return nil
+	}
+	current, err := e.ab.Addrs(t, l)
+	if err != nil {
+		return err
+	}
+	return e.checkAddrCount(t, append(current, addrs...))
+}
+
+// checkBulkAddrs works like checkAddrs for addresses of many logs, counting
+// logs and addresses added together.
+func (e *quotaEnforcer) checkBulkAddrs(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	var (
+		merged = make(map[core.ThreadLog][]ma.Multiaddr)
+		logs   = make(map[thread.ID][]thread.LogID)
+	)
+	for _, en := range entries {
+		if len(en.Addrs) == 0 {
+			continue
+		}
+		tl := core.ThreadLog{Thread: en.Thread, Log: en.Log}
+		if _, ok := merged[tl]; !ok {
+			logs[en.Thread] = append(logs[en.Thread], en.Log)
+		}
+		merged[tl] = append(merged[tl], en.Addrs...)
+	}
+	for tl, addrs := range merged {
+		if err := e.checkAddrs(tl.Thread, tl.Log, addrs, ttl); err != nil {
+			return err
+		}
+	}
+	if e.MaxLogs <= 0 {
+		return nil
+	}
+	for t, ids := range logs {
+		set, err := e.threadLogs(t)
+		if err != nil {
+			return err
+		}
+		before := len(set)
+		for _, id := range ids {
+			set[id] = struct{}{}
+		}
+		if len(set) > before && len(set) > e.MaxLogs {
+			return &core.QuotaError{Thread: t, Limit: core.QuotaLogs, Max: int64(e.MaxLogs), Requested: int64(len(set))}
+		}
+	}
+	return nil
+}
+
+// checkRecord ensures the addresses of a signed peer record, which replace
+// the ones of its log, neither exceed the number of logs nor the number of
+// addresses of the log.
+func (e *quotaEnforcer) checkRecord(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if ttl <= 0 || len(addrs) == 0 {
+		return nil
+	}
+	if err := e.checkLog(t, l); err != nil {
+		return err
+	}
+	return e.checkAddrCount(t, addrs)
+}
+
+// checkAddrCount ensures a log has no more distinct addresses than allowed.
+func (e *quotaEnforcer) checkAddrCount(t thread.ID, addrs []ma.Multiaddr) error {
+	if e.MaxAddrs <= 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		set[string(addr.Bytes())] = struct{}{}
+	}
+	if len(set) > e.MaxAddrs {
+		return &core.QuotaError{Thread: t, Limit: core.QuotaAddrs, Max: int64(e.MaxAddrs), Requested: int64(len(set))}
+	}
+	return nil
+}
+
+// checkLogCount ensures a thread has no more logs than allowed.
+func (e *quotaEnforcer) checkLogCount(t thread.ID, set map[thread.LogID]struct{}) error {
+	if e.MaxLogs > 0 && len(set) > e.MaxLogs {
+		return &core.QuotaError{Thread: t, Limit: core.QuotaLogs, Max: int64(e.MaxLogs), Requested: int64(len(set))}
+	}
+	return nil
+}
+
+// checkRestoredKeys ensures restoring the keys, which replace the ones of
+// the key book, does not exceed the number of logs along with logs having
+// addresses.
+func (e *quotaEnforcer) checkRestoredKeys(dump core.DumpKeyBook) error {
+	logs := make(map[thread.ID]map[thread.LogID]struct{})
+	add := func(t thread.ID, l thread.LogID) {
+		if logs[t] == nil {
+			logs[t] = make(map[thread.LogID]struct{})
+		}
+		logs[t][l] = struct{}{}
+	}
+	for t, keys := range dump.Data.Public {
+		for l := range keys {
+			add(t, l)
+		}
+	}
+	for t, keys := range dump.Data.Private {
+		for l := range keys {
+			add(t, l)
+		}
+	}
+	for t, set := range logs {
+		withAddrs, err := e.ab.LogsWithAddrs(t)
+		if err != nil {
+			return err
+		}
+		for _, l := range withAddrs {
+			set[l] = struct{}{}
+		}
+		if err := e.checkLogCount(t, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRestoredAddrs ensures restoring the unexpired addresses, which
+// replace the ones of the address book, neither exceeds the number of logs
+// along with logs having keys nor the number of addresses of a log.
+func (e *quotaEnforcer) checkRestoredAddrs(dump core.DumpAddrBook) error {
+	now := time.Now()
+	for t, logs := range dump.Data {
+		set := make(map[thread.LogID]struct{})
+		for l, entries := range logs {
+			var addrs []ma.Multiaddr
+			for _, en := range entries {
+				if en.Expires.After(now) {
+					addrs = append(addrs, en.Addr)
+				}
+			}
+			if len(addrs) == 0 {
+				continue
+			}
+			if err := e.checkAddrCount(t, addrs); err != nil {
+				return err
+			}
+			set[l] = struct{}{}
+		}
+		if len(set) == 0 || e.MaxLogs <= 0 {
+			continue
+		}
+		withKeys, err := e.kb.LogsWithKeys(t)
+		if err != nil {
+			return err
+		}
+		for _, l := range withKeys {
+			set[l] = struct{}{}
+		}
+		if err := e.checkLogCount(t, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRestoredMeta ensures restoring the unexpired metadata, which
+// replaces the one of the metadata book, does not exceed the metadata size
+// of any thread.
+func (e *quotaEnforcer) checkRestoredMeta(dump core.DumpMetadata) error {
+	var (
+		now   = time.Now()
+		sizes = make(map[thread.ID]int64)
+	)
+	add := func(mk core.MetadataKey, v interface{}) {
+		if exp, ok := dump.Expires[mk]; ok && !exp.After(now) {
+			return
+		}
+		sizes[mk.T] += core.MetaEntrySize(mk.K, v)
+	}
+	for mk, v := range dump.Data.Int64 {
+		add(mk, v)
+	}
+	for mk, v := range dump.Data.Bool {
+		add(mk, v)
+	}
+	for mk, v := range dump.Data.String {
+		add(mk, v)
+	}
+	for mk, v := range dump.Data.Bytes {
+		add(mk, v)
+	}
+	for t, size := range sizes {
+		if size > e.MaxMetaBytes {
+			return &core.QuotaError{Thread: t, Limit: core.QuotaMetaBytes, Max: e.MaxMetaBytes, Requested: size}
+		}
+	}
+	return nil
+}
+
+// checkMeta ensures storing the value under the key does not exceed the
+// metadata size of the thread.
+func (e *quotaEnforcer) checkMeta(t thread.ID, key string, val interface{}) error {
+	sizes, err := e.metaEntrySizes(t)
+	if err != nil {
+		return err
+	}
+	size := core.MetaEntrySize(key, val)
+	for k, s := range sizes {
+		if k != key {
+			size += s
+		}
+	}
+	if size > e.MaxMetaBytes {
+		return &core.QuotaError{Thread: t, Limit: core.QuotaMetaBytes, Max: e.MaxMetaBytes, Requested: size}
+	}
+	return nil
+}
+
+func (e *quotaEnforcer) metaEntrySizes(t thread.ID) (map[string]int64, error) {
+	type entrySizer interface {
+		MetaEntrySizes(thread.ID) (map[string]int64, error)
+	}
+	if es, ok := e.md.(entrySizer); ok {
+		return es.MetaEntrySizes(t)
+	}
+
+	// fall back to scanning metadata of all threads
+	dump, err := e.md.DumpMeta()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64)
+	add := func(mk core.MetadataKey, v interface{}) {
+		if mk.T.Equals(t) {
+			sizes[mk.K] = core.MetaEntrySize(mk.K, v)
+		}
+	}
+	for mk, v := range dump.Data.Int64 {
+		add(mk, v)
+	}
+	for mk, v := range dump.Data.Bool {
+		add(mk, v)
+	}
+	for mk, v := range dump.Data.String {
+		add(mk, v)
+	}
+	for mk, v := range dump.Data.Bytes {
+		add(mk, v)
+	}
+	return sizes, nil
+}
+
+func (b *quotaKeyBook) Close() error        { return closeBook(b.KeyBook) }
+func (b *quotaAddrBook) Close() error       { return closeBook(b.AddrBook) }
+func (b *quotaThreadMetadata) Close() error { return closeBook(b.ThreadMetadata) }
+
+func (b *quotaKeyBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.KeyBook, t)
+}
+func (b *quotaAddrBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.AddrBook, t)
+}
+func (b *quotaThreadMetadata) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.ThreadMetadata, t)
+}
+
+// quotaKeyBook limits the number of logs of threads.
+type quotaKeyBook struct {
+	core.KeyBook
+	e *quotaEnforcer
+}
+
+func (b *quotaKeyBook) AddPubKey(t thread.ID, l thread.LogID, pk crypto.PubKey) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkLog(t, l); err != nil {
+		return err
+	}
+	return b.KeyBook.AddPubKey(t, l, pk)
+}
+
+func (b *quotaKeyBook) AddPrivKey(t thread.ID, l thread.LogID, sk crypto.PrivKey) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkLog(t, l); err != nil {
+		return err
+	}
+	return b.KeyBook.AddPrivKey(t, l, sk)
+}
+
+func (b *quotaKeyBook) RestoreKeys(dump core.DumpKeyBook) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkRestoredKeys(dump); err != nil {
+		return err
+	}
+	return b.KeyBook.RestoreKeys(dump)
+}
+
+// quotaAddrBook limits the number of logs of threads and of addresses of logs.
+type quotaAddrBook struct {
+	core.AddrBook
+	e *quotaEnforcer
+}
+
+func (b *quotaAddrBook) AddAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	return b.AddAddrs(t, l, []ma.Multiaddr{addr}, ttl)
+}
+
+func (b *quotaAddrBook) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkAddrs(t, l, addrs, ttl); err != nil {
+		return err
+	}
+	return b.AddrBook.AddAddrs(t, l, addrs, ttl)
+}
+
+func (b *quotaAddrBook) SetAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	return b.SetAddrs(t, l, []ma.Multiaddr{addr}, ttl)
+}
+
+func (b *quotaAddrBook) SetAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkAddrs(t, l, addrs, ttl); err != nil {
+		return err
+	}
+	return b.AddrBook.SetAddrs(t, l, addrs, ttl)
+}
+
+func (b *quotaAddrBook) AddAddrsFromSource(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkAddrs(t, l, addrs, ttl); err != nil {
+		return err
+	}
+	return b.AddrBook.AddAddrsFromSource(t, l, addrs, ttl, src)
+}
+
+func (b *quotaAddrBook) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkBulkAddrs(entries, ttl); err != nil {
+		return err
+	}
+	return b.AddrBook.AddLogAddrsBulk(entries, ttl)
+}
+
+func (b *quotaAddrBook) ConsumeLogRecord(t thread.ID, env *record.Envelope, ttl time.Duration) (bool, error) {
+	rec, _, err := core.OpenLogRecord(env)
+	if err != nil {
+		return false, err
+	}
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkRecord(t, thread.LogIDFromPeer(rec.PeerID), rec.Addrs, ttl); err != nil {
+		return false, err
+	}
+	return b.AddrBook.ConsumeLogRecord(t, env, ttl)
+}
+
+func (b *quotaAddrBook) RestoreAddrs(dump core.DumpAddrBook) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkRestoredAddrs(dump); err != nil {
+		return err
+	}
+	return b.AddrBook.RestoreAddrs(dump)
+}
+
+// quotaThreadMetadata limits the size of the metadata of threads.
+type quotaThreadMetadata struct {
+	core.ThreadMetadata
+	e *quotaEnforcer
+}
+
+func (b *quotaThreadMetadata) PutInt64(t thread.ID, key string, val int64) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkMeta(t, key, val); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutInt64(t, key, val)
+}
+
+func (b *quotaThreadMetadata) PutString(t thread.ID, key string, val string) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkMeta(t, key, val); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutString(t, key, val)
+}
+
+func (b *quotaThreadMetadata) PutBool(t thread.ID, key string, val bool) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkMeta(t, key, val); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutBool(t, key, val)
+}
+
+func (b *quotaThreadMetadata) PutBytes(t thread.ID, key string, val []byte) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkMeta(t, key, val); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutBytes(t, key, val)
+}
+
+func (b *quotaThreadMetadata) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkMeta(t, key, val); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutMetaWithTTL(t, key, val, ttl)
+}
+
+func (b *quotaThreadMetadata) RestoreMeta(dump core.DumpMetadata) error {
+	b.e.Lock()
+	defer b.e.Unlock()
+	if err := b.e.checkRestoredMeta(dump); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.RestoreMeta(dump)
+}
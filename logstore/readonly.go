@@ -0,0 +1,314 @@
+package logstore
+
+import (
+	"io"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// ReadOnly returns a view of the logstore rejecting all writes with
+// core.ErrReadOnly, for components that should only inspect the store.
+// Closing the view leaves the logstore open.
+func ReadOnly(ls core.Logstore) core.Logstore {
+	return &readOnlyLogstore{Logstore: ls}
+}
+
+// readOnlyLogstore passes reads through to the logstore. Writes added to
+// core.Logstore must be overridden here. The view doesn't unwrap to the
+// logstore, so optional capabilities are passed through only if implemented
+// here as well.
+type readOnlyLogstore struct {
+	core.Logstore
+}
+
+var (
+	_ core.Logstore    = (*readOnlyLogstore)(nil)
+	_ core.NameBook    = (*readOnlyLogstore)(nil)
+	_ core.PinBook     = (*readOnlyLogstore)(nil)
+	_ core.AccessBook  = (*readOnlyLogstore)(nil)
+	_ core.Inviter     = (*readOnlyLogstore)(nil)
+	_ core.Snapshotter = (*readOnlyLogstore)(nil)
+	_ core.Transactor  = (*readOnlyLogstore)(nil)
+)
+
+func (r *readOnlyLogstore) Close() error { return nil }
+
+func (r *readOnlyLogstore) CreateThread(thread.ID, ...core.ThreadOption) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) AddThread(thread.Info) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) DeleteThread(thread.ID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) AddLog(thread.ID, thread.LogInfo) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) DeleteLog(thread.ID, thread.LogID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) ImportThread([]byte) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) ImportKeys([]byte, string) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) ArchiveThread(thread.ID, ds.Datastore) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) UnarchiveThread(thread.ID, ds.Datastore) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) Archive(thread.ID, io.Writer) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) Unarchive(io.Reader) (thread.ID, error) {
+	return thread.Undef, core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) Batch() core.Batch { return readOnlyBatch{} }
+
+// Names
+
+func (r *readOnlyLogstore) SetThreadName(thread.ID, string) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) ThreadByName(name string) (thread.ID, error) {
+	nb, err := core.Names(r.Logstore)
+	if err != nil {
+		return thread.Undef, err
+	}
+	return nb.ThreadByName(name)
+}
+
+func (r *readOnlyLogstore) ThreadNames() (map[string]thread.ID, error) {
+	nb, err := core.Names(r.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return nb.ThreadNames()
+}
+
+// Pins
+
+func (r *readOnlyLogstore) Pin(thread.ID, int) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) Unpin(thread.ID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) PinnedThreads() ([]core.Pin, error) {
+	pb, err := core.Pins(r.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return pb.PinnedThreads()
+}
+
+// Access
+
+func (r *readOnlyLogstore) SetRole(thread.ID, thread.PubKey, core.Role) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) Role(t thread.ID, pk thread.PubKey) (core.Role, error) {
+	ab, err := core.Access(r.Logstore)
+	if err != nil {
+		return core.NoRole, err
+	}
+	return ab.Role(t, pk)
+}
+
+func (r *readOnlyLogstore) HasRole(t thread.ID, pk thread.PubKey, role core.Role) (bool, error) {
+	ab, err := core.Access(r.Logstore)
+	if err != nil {
+		return false, err
+	}
+	return ab.HasRole(t, pk, role)
+}
+
+func (r *readOnlyLogstore) Members(t thread.ID) ([]core.Member, error) {
+	ab, err := core.Access(r.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return ab.Members(t)
+}
+
+// Invites
+
+func (r *readOnlyLogstore) CreateInvite(t thread.ID, withReadKey bool, password string) ([]byte, error) {
+	inv, err := core.Invites(r.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return inv.CreateInvite(t, withReadKey, password)
+}
+
+func (r *readOnlyLogstore) AcceptInvite([]byte, string) (thread.Info, error) {
+	return thread.Info{}, core.ErrReadOnly
+}
+
+// Snapshots
+
+func (r *readOnlyLogstore) Snapshot(w io.Writer) error {
+	sn, err := core.Snapshots(r.Logstore)
+	if err != nil {
+		return err
+	}
+	return sn.Snapshot(w)
+}
+
+func (r *readOnlyLogstore) Restore(io.Reader) error { return core.ErrReadOnly }
+
+// Transactions
+
+func (r *readOnlyLogstore) BeginTxn(readonly bool) (core.Txn, error) {
+	if !readonly {
+		return nil, core.ErrReadOnly
+	}
+	tr, err := core.Transactions(r.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return tr.BeginTxn(true)
+}
+
+// Key book
+
+func (r *readOnlyLogstore) AddPubKey(thread.ID, thread.LogID, crypto.PubKey) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) RevokePubKey(thread.ID, thread.LogID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) AddPrivKey(thread.ID, thread.LogID, crypto.PrivKey) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) AddReadKey(thread.ID, *sym.Key) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) AddServiceKey(thread.ID, *sym.Key) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) RotateReadKey(thread.ID, *sym.Key) (int, error) {
+	return 0, core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) RotateServiceKey(thread.ID, *sym.Key) (int, error) {
+	return 0, core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) ClearKeys(thread.ID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) ClearLogKeys(thread.ID, thread.LogID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) RestoreKeys(core.DumpKeyBook) error { return core.ErrReadOnly }
+
+// Address book
+
+func (r *readOnlyLogstore) AddAddr(thread.ID, thread.LogID, ma.Multiaddr, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) AddAddrs(thread.ID, thread.LogID, []ma.Multiaddr, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) SetAddr(thread.ID, thread.LogID, ma.Multiaddr, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) SetAddrs(thread.ID, thread.LogID, []ma.Multiaddr, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) AddAddrsFromSource(thread.ID, thread.LogID, []ma.Multiaddr, time.Duration, core.AddrSource) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) AddLogAddrsBulk([]core.ThreadLogAddrs, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) ConsumeLogRecord(thread.ID, *record.Envelope, time.Duration) (bool, error) {
+	return false, core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) RecordDial(thread.ID, thread.LogID, ma.Multiaddr, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) ReplaceAddr(ma.Multiaddr, ma.Multiaddr, time.Duration) ([]core.ThreadLog, error) {
+	return nil, core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) UpdateAddrs(thread.ID, thread.LogID, time.Duration, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) ClearAddrs(thread.ID, thread.LogID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) RestoreAddrs(core.DumpAddrBook) error { return core.ErrReadOnly }
+
+// Head book
+
+func (r *readOnlyLogstore) AddHead(thread.ID, thread.LogID, cid.Cid) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) AddHeads(thread.ID, thread.LogID, []cid.Cid) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) SetHead(thread.ID, thread.LogID, cid.Cid) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) SetHeads(thread.ID, thread.LogID, []cid.Cid) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) ClearHeads(thread.ID, thread.LogID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) RestoreHeads(core.DumpHeadBook) error { return core.ErrReadOnly }
+
+// Thread and log metadata
+
+func (r *readOnlyLogstore) PutInt64(thread.ID, string, int64) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) PutString(thread.ID, string, string) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) PutBool(thread.ID, string, bool) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) PutBytes(thread.ID, string, []byte) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) PutMetaWithTTL(thread.ID, string, interface{}, time.Duration) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) DeleteMetaPrefix(thread.ID, string) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) ClearMetadata(thread.ID) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) RestoreMeta(core.DumpMetadata) error { return core.ErrReadOnly }
+
+func (r *readOnlyLogstore) PutLogInt64(thread.ID, thread.LogID, string, int64) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) PutLogString(thread.ID, thread.LogID, string, string) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) PutLogBool(thread.ID, thread.LogID, string, bool) error {
+	return core.ErrReadOnly
+}
+
+func (r *readOnlyLogstore) PutLogBytes(thread.ID, thread.LogID, string, []byte) error {
+	return core.ErrReadOnly
+}
+
+// readOnlyBatch drops writes and fails on commit.
+type readOnlyBatch struct{}
+
+func (readOnlyBatch) AddThread(thread.Info)               {}
+func (readOnlyBatch) AddLog(thread.ID, thread.LogInfo)    {}
+func (readOnlyBatch) PutInt64(thread.ID, string, int64)   {}
+func (readOnlyBatch) PutString(thread.ID, string, string) {}
+func (readOnlyBatch) PutBool(thread.ID, string, bool)     {}
+func (readOnlyBatch) PutBytes(thread.ID, string, []byte)  {}
+func (readOnlyBatch) Commit() error                       { return core.ErrReadOnly }
@@ -0,0 +1,110 @@
+package recordstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/textileio/go-threads/cbor"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/net"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// Codec implements the encryption scheme of records with keys looked up in
+// a keybook. Record bodies are wrapped in events readable with the thread
+// read key, while records themselves are readable with the service key, so
+// that followers can relay records without reading their contents.
+type Codec struct {
+	dag format.DAGService
+	kb  core.KeyBook
+}
+
+// NewCodec returns a codec storing encoded blocks in the DAG service.
+func NewCodec(dag format.DAGService, kb core.KeyBook) *Codec {
+	return &Codec{dag: dag, kb: kb}
+}
+
+// Encode creates a record of the log following prev, which holds the body
+// and is signed with the private key of the log on behalf of the identity.
+func (c *Codec) Encode(
+	ctx context.Context,
+	t thread.ID,
+	l thread.LogID,
+	body format.Node,
+	prev cid.Cid,
+	identity thread.PubKey,
+) (net.Record, error) {
+	lk, err := c.kb.PrivKey(t, l)
+	if err != nil {
+		return nil, err
+	}
+	if lk == nil {
+		return nil, fmt.Errorf("a private-key is required to create records")
+	}
+	sk, err := c.serviceKey(t)
+	if err != nil {
+		return nil, err
+	}
+	rk, err := c.readKey(t)
+	if err != nil {
+		return nil, err
+	}
+	event, err := cbor.CreateEvent(ctx, c.dag, body, rk)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.CreateRecord(ctx, c.dag, cbor.CreateRecordConfig{
+		Block:      event,
+		Prev:       prev,
+		Key:        lk,
+		PubKey:     identity,
+		ServiceKey: sk,
+	})
+}
+
+// DecodeRecord decrypts a record node of the thread.
+func (c *Codec) DecodeRecord(t thread.ID, node format.Node) (net.Record, error) {
+	sk, err := c.serviceKey(t)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.RecordFromNode(node, sk)
+}
+
+// DecodeBody loads and decrypts the body of a record of the thread.
+func (c *Codec) DecodeBody(ctx context.Context, t thread.ID, rec net.Record) (format.Node, error) {
+	rk, err := c.readKey(t)
+	if err != nil {
+		return nil, err
+	}
+	event, err := cbor.EventFromRecord(ctx, c.dag, rec)
+	if err != nil {
+		return nil, err
+	}
+	return event.GetBody(ctx, c.dag, rk)
+}
+
+func (c *Codec) serviceKey(t thread.ID) (*sym.Key, error) {
+	sk, err := c.kb.ServiceKey(t)
+	if err != nil {
+		return nil, err
+	}
+	if sk == nil {
+		return nil, fmt.Errorf("a service-key is required to encode or decode records")
+	}
+	return sk, nil
+}
+
+func (c *Codec) readKey(t thread.ID) (*sym.Key, error) {
+	rk, err := c.kb.ReadKey(t)
+	if err != nil {
+		return nil, err
+	}
+	if rk == nil {
+		return nil, fmt.Errorf("a read-key is required to encode or decode record bodies")
+	}
+	return rk, nil
+}
@@ -0,0 +1,90 @@
+package recordstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/net"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+var _ core.RecordIterator = (*iterator)(nil)
+
+// iterator follows parent pointers of records, loading them lazily.
+type iterator struct {
+	ctx    context.Context
+	s      *recordStore
+	sk     *sym.Key
+	pk     crypto.PubKey
+	q      core.RecordQuery
+	cursor cid.Cid
+	// boundary is the oldest record left by compaction.
+	boundary cid.Cid
+	count    int
+	err      error
+}
+
+func (s *recordStore) Iterate(ctx context.Context, t thread.ID, l thread.LogID, q core.RecordQuery) (core.RecordIterator, error) {
+	if !q.Since.IsZero() && q.Time == nil {
+		return nil, fmt.Errorf("bounding records by time requires a time function")
+	}
+	sk, pk, err := s.keys(t, l)
+	if err != nil {
+		return nil, err
+	}
+	cursor := q.From
+	if !cursor.Defined() {
+		heads, err := s.ls.Heads(t, l)
+		if err != nil {
+			return nil, err
+		}
+		if len(heads) > 0 {
+			cursor = heads[0]
+		}
+	}
+	boundary, err := s.boundary(t, l)
+	if err != nil {
+		return nil, err
+	}
+	return &iterator{ctx: ctx, s: s, sk: sk, pk: pk, q: q, cursor: cursor, boundary: boundary}, nil
+}
+
+func (it *iterator) Next() (net.Record, bool) {
+	if it.err != nil || !it.cursor.Defined() || it.cursor.Equals(it.q.Until) {
+		return nil, false
+	}
+	if it.q.Limit > 0 && it.count >= it.q.Limit {
+		return nil, false
+	}
+	rec, err := it.s.get(it.ctx, it.cursor, it.sk, it.pk)
+	if err != nil {
+		it.err = err
+		return nil, false
+	}
+	if !it.q.Since.IsZero() {
+		created, err := it.q.Time(it.ctx, rec)
+		if err != nil {
+			it.err = err
+			return nil, false
+		}
+		if created.Before(it.q.Since) {
+			it.cursor = cid.Undef
+			return nil, false
+		}
+	}
+	if it.cursor.Equals(it.boundary) {
+		it.cursor = cid.Undef
+	} else {
+		it.cursor = rec.PrevID()
+	}
+	it.count++
+	return rec, true
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,131 @@
+package recordstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/textileio/go-threads/cbor"
+	"github.com/textileio/go-threads/core/net"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// branch is the chain of records behind a head, newest first.
+type branch struct {
+	head cid.Cid
+	recs []net.Record
+}
+
+func (s *recordStore) Merge(ctx context.Context, t thread.ID, l thread.LogID, heads ...cid.Cid) (cid.Cid, error) {
+	sk, pk, err := s.writeKeys(t, l)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if len(heads) == 0 {
+		if heads, err = s.ls.Heads(t, l); err != nil {
+			return cid.Undef, err
+		}
+	}
+	boundary, err := s.boundary(t, l)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	var (
+		branches []branch
+		seen     = make(map[cid.Cid]struct{}, len(heads))
+	)
+	for _, head := range heads {
+		if _, ok := seen[head]; ok || !head.Defined() {
+			continue
+		}
+		seen[head] = struct{}{}
+		b := branch{head: head}
+		for cursor := head; cursor.Defined(); {
+			rec, err := s.get(ctx, cursor, sk, pk)
+			if err != nil {
+				return cid.Undef, err
+			}
+			b.recs = append(b.recs, rec)
+			if cursor.Equals(boundary) {
+				break
+			}
+			cursor = rec.PrevID()
+		}
+		branches = append(branches, b)
+	}
+	if len(branches) == 0 {
+		return cid.Undef, nil
+	}
+
+	// keep the longest branch, the one with the lowest head on ties
+	sort.Slice(branches, func(i, j int) bool {
+		if len(branches[i].recs) != len(branches[j].recs) {
+			return len(branches[i].recs) > len(branches[j].recs)
+		}
+		return bytes.Compare(branches[i].head.Bytes(), branches[j].head.Bytes()) < 0
+	})
+	kept := make(map[cid.Cid]struct{}, len(branches[0].recs))
+	for _, rec := range branches[0].recs {
+		kept[rec.Cid()] = struct{}{}
+	}
+
+	// records missing from the kept branch, ordered by height in their
+	// branch, then by cid; heights of different branches are not causally
+	// related, the order is only meant to be the same for the same heads
+	type missing struct {
+		rec    net.Record
+		height int
+	}
+	var recs []missing
+	for _, b := range branches[1:] {
+		for i, rec := range b.recs {
+			if _, ok := kept[rec.Cid()]; ok {
+				continue
+			}
+			kept[rec.Cid()] = struct{}{}
+			recs = append(recs, missing{rec: rec, height: len(b.recs) - i})
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].height != recs[j].height {
+			return recs[i].height < recs[j].height
+		}
+		return bytes.Compare(recs[i].rec.Cid().Bytes(), recs[j].rec.Cid().Bytes()) < 0
+	})
+
+	merged := branches[0].head
+	if len(recs) > 0 {
+		lk, err := s.ls.PrivKey(t, l)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if lk == nil {
+			return cid.Undef, fmt.Errorf("a private-key is required to merge diverged heads")
+		}
+		for _, m := range recs {
+			block, err := m.rec.GetBlock(ctx, s.dag)
+			if err != nil {
+				return cid.Undef, err
+			}
+			identity := &thread.Libp2pPubKey{}
+			if err := identity.UnmarshalBinary(m.rec.PubKey()); err != nil {
+				return cid.Undef, err
+			}
+			rec, err := cbor.CreateRecord(ctx, s.dag, cbor.CreateRecordConfig{
+				Block:      block,
+				Prev:       merged,
+				Key:        lk,
+				PubKey:     identity,
+				ServiceKey: sk,
+			})
+			if err != nil {
+				return cid.Undef, err
+			}
+			merged = rec.Cid()
+		}
+	}
+	return merged, s.ls.SetHead(t, l, merged)
+}
@@ -0,0 +1,166 @@
+package recordstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/textileio/go-threads/cbor"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/net"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+var _ core.RecordStore = (*recordStore)(nil)
+
+// recordStore keeps records in a DAG service. Records are decoded with the
+// thread service key and checked against the log key, both taken from the
+// logstore, so no index of records by log is needed.
+type recordStore struct {
+	dag format.DAGService
+	ls  core.Logstore
+}
+
+// NewRecordStore returns a record store persisting records in the given
+// DAG service, which allows plugging in any block storage.
+func NewRecordStore(dag format.DAGService, ls core.Logstore) core.RecordStore {
+	return &recordStore{dag: dag, ls: ls}
+}
+
+func (s *recordStore) Put(ctx context.Context, t thread.ID, l thread.LogID, rec net.Record, blocks ...format.Node) error {
+	_, pk, err := s.writeKeys(t, l)
+	if err != nil {
+		return err
+	}
+	block, err := rec.GetBlock(ctx, s.dag)
+	if err != nil {
+		return fmt.Errorf("loading block of record %s: %w", rec.Cid(), err)
+	}
+	if err := rec.Verify(pk); err != nil {
+		return fmt.Errorf("record %s is not signed by log %s: %w", rec.Cid(), l, err)
+	}
+	return s.dag.AddMany(ctx, append([]format.Node{rec, block}, blocks...))
+}
+
+func (s *recordStore) Get(ctx context.Context, t thread.ID, l thread.LogID, id cid.Cid) (net.Record, error) {
+	sk, pk, err := s.keys(t, l)
+	if err != nil {
+		return nil, err
+	}
+	return s.get(ctx, id, sk, pk)
+}
+
+func (s *recordStore) GetRange(ctx context.Context, t thread.ID, l thread.LogID, from, to cid.Cid, limit int) ([]net.Record, error) {
+	if !from.Defined() {
+		return nil, nil
+	}
+	it, err := s.Iterate(ctx, t, l, core.RecordQuery{From: from, Until: to, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	var recs []net.Record
+	for rec, ok := it.Next(); ok; rec, ok = it.Next() {
+		recs = append(recs, rec)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(recs)-1; i < j; i, j = i+1, j-1 {
+		recs[i], recs[j] = recs[j], recs[i]
+	}
+	return recs, nil
+}
+
+func (s *recordStore) WalkHeads(ctx context.Context, t thread.ID, l thread.LogID, fn func(net.Record) bool) error {
+	sk, pk, err := s.keys(t, l)
+	if err != nil {
+		return err
+	}
+	heads, err := s.ls.Heads(t, l)
+	if err != nil {
+		return err
+	}
+	boundary, err := s.boundary(t, l)
+	if err != nil {
+		return err
+	}
+	visited := make(map[cid.Cid]struct{})
+	for _, head := range heads {
+		for cursor := head; cursor.Defined(); {
+			if _, seen := visited[cursor]; seen {
+				break
+			}
+			visited[cursor] = struct{}{}
+			rec, err := s.get(ctx, cursor, sk, pk)
+			if err != nil {
+				return err
+			}
+			if !fn(rec) {
+				return nil
+			}
+			if cursor.Equals(boundary) {
+				break
+			}
+			cursor = rec.PrevID()
+		}
+	}
+	return nil
+}
+
+// keys returns the service key of the thread and the public key of the log.
+func (s *recordStore) keys(t thread.ID, l thread.LogID) (*sym.Key, crypto.PubKey, error) {
+	sk, err := s.ls.ServiceKey(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sk == nil {
+		return nil, nil, core.ErrThreadNotFound
+	}
+	pk, err := s.ls.PubKey(t, l)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pk == nil {
+		return nil, nil, core.ErrLogNotFound
+	}
+	return sk, pk, nil
+}
+
+// writeKeys returns the keys like keys for storing new records of the log,
+// failing with core.ErrLogRevoked for revoked logs.
+func (s *recordStore) writeKeys(t thread.ID, l thread.LogID) (*sym.Key, crypto.PubKey, error) {
+	sk, pk, err := s.keys(t, l)
+	if err != nil {
+		return nil, nil, err
+	}
+	revoked, err := s.ls.IsRevoked(t, l)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, core.ErrLogRevoked
+	}
+	return sk, pk, nil
+}
+
+// get loads the record, hiding records of other logs.
+func (s *recordStore) get(ctx context.Context, id cid.Cid, sk *sym.Key, pk crypto.PubKey) (net.Record, error) {
+	rec, err := cbor.GetRecord(ctx, s.dag, id, sk)
+	if err == format.ErrNotFound {
+		return nil, core.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the signature covers the block, which must be loaded to verify it
+	if _, err := rec.GetBlock(ctx, s.dag); err != nil {
+		return nil, err
+	}
+	if err := rec.Verify(pk); err != nil {
+		return nil, core.ErrRecordNotFound
+	}
+	return rec, nil
+}
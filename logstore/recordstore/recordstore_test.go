@@ -0,0 +1,391 @@
+package recordstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	mdutils "github.com/ipfs/go-merkledag/test"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/textileio/go-threads/cbor"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/net"
+	"github.com/textileio/go-threads/core/thread"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+)
+
+func TestRecordStore(t *testing.T) {
+	ctx := context.Background()
+	ls := lstoremem.NewLogstore()
+	rs := NewRecordStore(mdutils.Mock(), ls)
+	tid, lid, recs := createLog(t, ls, rs, 5)
+	prev := recs[len(recs)-1].Cid()
+
+	rec, err := rs.Get(ctx, tid, lid, recs[2].Cid())
+	checkErr(t, err)
+	if !rec.Cid().Equals(recs[2].Cid()) || !rec.PrevID().Equals(recs[1].Cid()) {
+		t.Fatal("loaded record mismatch")
+	}
+
+	// records of other logs are not found
+	osk, opk, _ := crypto.GenerateEd25519Key(nil)
+	other, _ := thread.LogIDFromPrivKey(osk)
+	checkErr(t, ls.AddLog(tid, thread.LogInfo{ID: other, PubKey: opk}))
+	if _, err := rs.Get(ctx, tid, other, recs[2].Cid()); err != core.ErrRecordNotFound {
+		t.Fatalf("expected ErrRecordNotFound, got %v", err)
+	}
+	if err := rs.Put(ctx, tid, other, recs[0]); err == nil {
+		t.Fatal("expected storing a record of another log to fail")
+	}
+
+	// full range from the head, oldest first
+	all, err := rs.GetRange(ctx, tid, lid, prev, cid.Undef, 0)
+	checkErr(t, err)
+	assertRecords(t, recs, all)
+	// range following a record, limited to the newest ones
+	part, err := rs.GetRange(ctx, tid, lid, prev, recs[0].Cid(), 2)
+	checkErr(t, err)
+	assertRecords(t, recs[3:], part)
+
+	var walked []net.Record
+	checkErr(t, rs.WalkHeads(ctx, tid, lid, func(r net.Record) bool {
+		walked = append(walked, r)
+		return len(walked) < 3
+	}))
+	assertRecords(t, []net.Record{recs[4], recs[3], recs[2]}, walked)
+
+	// records of revoked logs are rejected, stored ones are still served
+	checkErr(t, ls.RevokePubKey(tid, lid))
+	if err := rs.Put(ctx, tid, lid, recs[0]); err != core.ErrLogRevoked {
+		t.Fatalf("expected ErrLogRevoked, got %v", err)
+	}
+	if _, err := rs.Merge(ctx, tid, lid); err != core.ErrLogRevoked {
+		t.Fatalf("expected ErrLogRevoked, got %v", err)
+	}
+	if _, err := rs.Get(ctx, tid, lid, recs[2].Cid()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordIterator(t *testing.T) {
+	ctx := context.Background()
+	ls := lstoremem.NewLogstore()
+	rs := NewRecordStore(mdutils.Mock(), ls)
+	tid, lid, recs := createLog(t, ls, rs, 5)
+
+	// pretend records were created a minute apart
+	start := time.Now()
+	created := make(map[cid.Cid]time.Time, len(recs))
+	for i, r := range recs {
+		created[r.Cid()] = start.Add(time.Duration(i) * time.Minute)
+	}
+	timeOf := func(_ context.Context, r net.Record) (time.Time, error) {
+		return created[r.Cid()], nil
+	}
+
+	for name, c := range map[string]struct {
+		query    core.RecordQuery
+		expected []net.Record
+	}{
+		"head":  {core.RecordQuery{}, []net.Record{recs[4], recs[3], recs[2], recs[1], recs[0]}},
+		"from":  {core.RecordQuery{From: recs[2].Cid()}, []net.Record{recs[2], recs[1], recs[0]}},
+		"until": {core.RecordQuery{Until: recs[1].Cid()}, []net.Record{recs[4], recs[3], recs[2]}},
+		"limit": {core.RecordQuery{Limit: 2}, []net.Record{recs[4], recs[3]}},
+		"since": {core.RecordQuery{Since: created[recs[3].Cid()], Time: timeOf}, []net.Record{recs[4], recs[3]}},
+		"first bound": {
+			core.RecordQuery{From: recs[3].Cid(), Until: recs[0].Cid(), Since: created[recs[2].Cid()], Time: timeOf},
+			[]net.Record{recs[3], recs[2]},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			it, err := rs.Iterate(ctx, tid, lid, c.query)
+			checkErr(t, err)
+			var walked []net.Record
+			for rec, ok := it.Next(); ok; rec, ok = it.Next() {
+				walked = append(walked, rec)
+			}
+			checkErr(t, it.Err())
+			assertRecords(t, c.expected, walked)
+		})
+	}
+
+	if _, err := rs.Iterate(ctx, tid, lid, core.RecordQuery{Since: start}); err == nil {
+		t.Fatal("expected a time bound without a time function to fail")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	ls := lstoremem.NewLogstore()
+	rs := NewRecordStore(mdutils.Mock(), ls)
+	tid, lid, recs := createLog(t, ls, rs, 5)
+
+	if _, err := rs.Snapshot(ctx, tid, lid); err != core.ErrNoSnapshot {
+		t.Fatalf("expected ErrNoSnapshot, got %v", err)
+	}
+	if _, err := rs.Compact(ctx, tid, lid); err != core.ErrNoSnapshot {
+		t.Fatalf("expected ErrNoSnapshot, got %v", err)
+	}
+
+	state, err := cbornode.WrapObject(map[string]int{"sum": 3}, mh.SHA2_256, -1)
+	checkErr(t, err)
+	checkErr(t, rs.PutSnapshot(ctx, tid, lid, recs[2].Cid(), state))
+	snap, err := rs.Snapshot(ctx, tid, lid)
+	checkErr(t, err)
+	if !snap.Upto.Equals(recs[2].Cid()) || !snap.State.Cid().Equals(state.Cid()) || snap.Pruned {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+
+	pruned, err := rs.Compact(ctx, tid, lid)
+	checkErr(t, err)
+	if pruned != 2 {
+		t.Fatalf("expected 2 pruned records, got %d", pruned)
+	}
+	if _, err := rs.Get(ctx, tid, lid, recs[1].Cid()); err != core.ErrRecordNotFound {
+		t.Fatalf("expected ErrRecordNotFound, got %v", err)
+	}
+	// walks end at the snapshot
+	all, err := rs.GetRange(ctx, tid, lid, recs[4].Cid(), cid.Undef, 0)
+	checkErr(t, err)
+	assertRecords(t, recs[2:], all)
+	var walked int
+	checkErr(t, rs.WalkHeads(ctx, tid, lid, func(net.Record) bool {
+		walked++
+		return true
+	}))
+	if walked != 3 {
+		t.Fatalf("expected 3 walked records, got %d", walked)
+	}
+
+	// a newer snapshot prunes up to the previous one
+	checkErr(t, rs.PutSnapshot(ctx, tid, lid, recs[3].Cid(), state))
+	pruned, err = rs.Compact(ctx, tid, lid)
+	checkErr(t, err)
+	if pruned != 1 {
+		t.Fatalf("expected 1 pruned record, got %d", pruned)
+	}
+	all, err = rs.GetRange(ctx, tid, lid, recs[4].Cid(), cid.Undef, 0)
+	checkErr(t, err)
+	assertRecords(t, recs[3:], all)
+}
+
+func TestCodec(t *testing.T) {
+	ctx := context.Background()
+	dag := mdutils.Mock()
+	ls := lstoremem.NewLogstore()
+	c := NewCodec(dag, ls)
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	key := thread.NewRandomKey()
+	checkErr(t, ls.AddThread(thread.Info{ID: tid, Key: key}))
+	sk, pk, _ := crypto.GenerateEd25519Key(nil)
+	lid, _ := thread.LogIDFromPrivKey(sk)
+	checkErr(t, ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk}))
+
+	body, err := cbornode.WrapObject(map[string]string{"msg": "hello"}, mh.SHA2_256, -1)
+	checkErr(t, err)
+	rec, err := c.Encode(ctx, tid, lid, body, cid.Undef, thread.NewLibp2pPubKey(pk))
+	checkErr(t, err)
+	checkErr(t, rec.Verify(pk))
+
+	node, err := dag.Get(ctx, rec.Cid())
+	checkErr(t, err)
+	decoded, err := c.DecodeRecord(tid, node)
+	checkErr(t, err)
+	if !decoded.BlockID().Equals(rec.BlockID()) {
+		t.Fatal("decoded record mismatch")
+	}
+	got, err := c.DecodeBody(ctx, tid, decoded)
+	checkErr(t, err)
+	if !got.Cid().Equals(body.Cid()) {
+		t.Fatal("decoded body mismatch")
+	}
+
+	// followers without the read key cannot read bodies
+	follower := lstoremem.NewLogstore()
+	checkErr(t, follower.AddThread(thread.Info{ID: tid, Key: thread.NewServiceKey(key.Service())}))
+	fc := NewCodec(dag, follower)
+	decoded, err = fc.DecodeRecord(tid, node)
+	checkErr(t, err)
+	if _, err := fc.DecodeBody(ctx, tid, decoded); err == nil {
+		t.Fatal("expected decoding a body without the read key to fail")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	ls := lstoremem.NewLogstore()
+	rs := NewRecordStore(mdutils.Mock(), ls)
+	tid, lid, recs := createLog(t, ls, rs, 3)
+
+	// two devices appended to the log from the same record
+	long := appendBranch(t, ls, rs, tid, lid, recs[2], 0, 2)
+	short := appendBranch(t, ls, rs, tid, lid, recs[2], 1, 1)
+
+	merged, err := rs.Merge(ctx, tid, lid, short[0].Cid(), long[1].Cid())
+	checkErr(t, err)
+	heads, err := ls.Heads(tid, lid)
+	checkErr(t, err)
+	if len(heads) != 1 || !heads[0].Equals(merged) {
+		t.Fatalf("expected merged head %s, got %v", merged, heads)
+	}
+	all, err := rs.GetRange(ctx, tid, lid, merged, cid.Undef, 0)
+	checkErr(t, err)
+	assertRecords(t, append(recs, long...), all[:5])
+	if len(all) != 6 || !all[5].BlockID().Equals(short[0].BlockID()) {
+		t.Fatal("expected the shorter branch to follow the longer one")
+	}
+
+	// the merge does not depend on the order of heads
+	again, err := rs.Merge(ctx, tid, lid, long[1].Cid(), short[0].Cid())
+	checkErr(t, err)
+	reordered, err := rs.GetRange(ctx, tid, lid, again, cid.Undef, 0)
+	checkErr(t, err)
+	if len(reordered) != len(all) {
+		t.Fatalf("expected %d records, got %d", len(all), len(reordered))
+	}
+	for i := range all {
+		if !reordered[i].BlockID().Equals(all[i].BlockID()) {
+			t.Fatalf("record %d of merges differ", i)
+		}
+	}
+
+	// heads on the same branch merge into the newest one
+	head, err := rs.Merge(ctx, tid, lid, recs[1].Cid(), merged)
+	checkErr(t, err)
+	if !head.Equals(merged) {
+		t.Fatalf("expected head %s, got %s", merged, head)
+	}
+}
+
+func TestMergeManyHeads(t *testing.T) {
+	ctx := context.Background()
+	ls := lstoremem.NewLogstore()
+	rs := NewRecordStore(mdutils.Mock(), ls)
+	tid, lid, recs := createLog(t, ls, rs, 2)
+
+	// three devices diverged from the same record, two of them by the same
+	// number of records
+	long := appendBranch(t, ls, rs, tid, lid, recs[1], 0, 3)
+	left := appendBranch(t, ls, rs, tid, lid, recs[1], 1, 2)
+	right := appendBranch(t, ls, rs, tid, lid, recs[1], 2, 2)
+	heads := []cid.Cid{long[2].Cid(), left[1].Cid(), right[1].Cid()}
+
+	var expected []cid.Cid
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 0, 2}, {1, 2, 0}} {
+		merged, err := rs.Merge(ctx, tid, lid, heads[order[0]], heads[order[1]], heads[order[2]])
+		checkErr(t, err)
+		all, err := rs.GetRange(ctx, tid, lid, merged, cid.Undef, 0)
+		checkErr(t, err)
+		if len(all) != len(recs)+len(long)+len(left)+len(right) {
+			t.Fatalf("expected every record once, got %d records", len(all))
+		}
+		assertRecords(t, append(append([]net.Record{}, recs...), long...), all[:5])
+
+		// records missing from the longest branch follow it by height in
+		// their branch
+		appended := all[5:]
+		for i, h := range []int{0, 0, 1, 1} {
+			if !appended[i].BlockID().Equals(left[h].BlockID()) && !appended[i].BlockID().Equals(right[h].BlockID()) {
+				t.Fatalf("appended record %d is not at height %d of its branch", i, h+1)
+			}
+		}
+
+		// merges of the same heads replay the same events in the same
+		// order, while merged records are signed anew
+		blocks := make([]cid.Cid, len(all))
+		for i, rec := range all {
+			blocks[i] = rec.BlockID()
+		}
+		if expected == nil {
+			expected = blocks
+			continue
+		}
+		for i := range expected {
+			if !blocks[i].Equals(expected[i]) {
+				t.Fatalf("merge of heads in order %v differs at record %d", order, i)
+			}
+		}
+	}
+}
+
+// appendBranch appends n records to the log after prev, tagging their
+// blocks with the branch, and returns them oldest first.
+func appendBranch(t *testing.T, ls core.Logstore, rs core.RecordStore, tid thread.ID, lid thread.LogID, prev net.Record, branch, n int) (recs []net.Record) {
+	ctx := context.Background()
+	lk, err := ls.PrivKey(tid, lid)
+	checkErr(t, err)
+	sk, err := ls.ServiceKey(tid)
+	checkErr(t, err)
+	for i := 0; i < n; i++ {
+		block, err := cbornode.WrapObject(map[string]int{"branch": branch, "n": i}, mh.SHA2_256, -1)
+		checkErr(t, err)
+		rec, err := cbor.CreateRecord(ctx, nil, cbor.CreateRecordConfig{
+			Block:      block,
+			Prev:       prev.Cid(),
+			Key:        lk,
+			PubKey:     thread.NewLibp2pPubKey(lk.GetPublic()),
+			ServiceKey: sk,
+		})
+		checkErr(t, err)
+		checkErr(t, rs.Put(ctx, tid, lid, rec))
+		recs = append(recs, rec)
+		prev = rec
+	}
+	return recs
+}
+
+// createLog adds a thread with a log of n records and returns them oldest first.
+func createLog(t *testing.T, ls core.Logstore, rs core.RecordStore, n int) (thread.ID, thread.LogID, []net.Record) {
+	ctx := context.Background()
+	tid := thread.NewIDV1(thread.Raw, 24)
+	key := thread.NewRandomKey()
+	checkErr(t, ls.AddThread(thread.Info{ID: tid, Key: key}))
+	sk, pk, _ := crypto.GenerateEd25519Key(nil)
+	lid, _ := thread.LogIDFromPrivKey(sk)
+	checkErr(t, ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk}))
+
+	var (
+		recs []net.Record
+		prev cid.Cid
+	)
+	for i := 0; i < n; i++ {
+		block, err := cbornode.WrapObject(map[string]int{"n": i}, mh.SHA2_256, -1)
+		checkErr(t, err)
+		rec, err := cbor.CreateRecord(ctx, nil, cbor.CreateRecordConfig{
+			Block:      block,
+			Prev:       prev,
+			Key:        sk,
+			PubKey:     thread.NewLibp2pPubKey(pk),
+			ServiceKey: key.Service(),
+		})
+		checkErr(t, err)
+		checkErr(t, rs.Put(ctx, tid, lid, rec))
+		recs = append(recs, rec)
+		prev = rec.Cid()
+	}
+	checkErr(t, ls.SetHead(tid, lid, prev))
+	return tid, lid, recs
+}
+
+func assertRecords(t *testing.T, expected, actual []net.Record) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d records, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if !expected[i].Cid().Equals(actual[i].Cid()) {
+			t.Fatalf("record %d mismatch: %s != %s", i, expected[i].Cid(), actual[i].Cid())
+		}
+	}
+}
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package recordstore
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+func init() {
+	cbornode.RegisterCborType(snapshotEntry{})
+}
+
+// Snapshots are kept in the log metadata under snapshotKey, while the
+// state node goes to the DAG service along with records.
+const snapshotKey = "_snapshot"
+
+// snapshotEntry is the stored form of a snapshot, encoded with CBOR.
+type snapshotEntry struct {
+	Upto   []byte
+	State  []byte
+	Pruned bool
+}
+
+func (s *recordStore) PutSnapshot(ctx context.Context, t thread.ID, l thread.LogID, upto cid.Cid, state format.Node) error {
+	if _, err := s.Get(ctx, t, l, upto); err != nil {
+		return err
+	}
+	prev, err := s.snapshotEntry(t, l)
+	if err != nil && err != core.ErrNoSnapshot {
+		return err
+	}
+	if err := s.dag.Add(ctx, state); err != nil {
+		return err
+	}
+	// records pruned by the previous snapshot stay unreachable
+	return s.putSnapshotEntry(t, l, snapshotEntry{
+		Upto:   upto.Bytes(),
+		State:  state.Cid().Bytes(),
+		Pruned: prev.Pruned,
+	})
+}
+
+func (s *recordStore) Snapshot(ctx context.Context, t thread.ID, l thread.LogID) (core.LogSnapshot, error) {
+	var snap core.LogSnapshot
+	e, err := s.snapshotEntry(t, l)
+	if err != nil {
+		return snap, err
+	}
+	if snap.Upto, err = cid.Cast(e.Upto); err != nil {
+		return snap, err
+	}
+	id, err := cid.Cast(e.State)
+	if err != nil {
+		return snap, err
+	}
+	if snap.State, err = s.dag.Get(ctx, id); err != nil {
+		return snap, err
+	}
+	snap.Pruned = e.Pruned
+	return snap, nil
+}
+
+func (s *recordStore) Compact(ctx context.Context, t thread.ID, l thread.LogID) (int, error) {
+	sk, pk, err := s.keys(t, l)
+	if err != nil {
+		return 0, err
+	}
+	e, err := s.snapshotEntry(t, l)
+	if err != nil {
+		return 0, err
+	}
+	upto, err := cid.Cast(e.Upto)
+	if err != nil {
+		return 0, err
+	}
+	rec, err := s.get(ctx, upto, sk, pk)
+	if err != nil {
+		return 0, err
+	}
+
+	var pruned int
+	for cursor := rec.PrevID(); cursor.Defined(); {
+		old, err := s.get(ctx, cursor, sk, pk)
+		if err == core.ErrRecordNotFound {
+			// the rest was pruned by a previous compaction
+			break
+		}
+		if err != nil {
+			return pruned, err
+		}
+		if err := s.dag.RemoveMany(ctx, []cid.Cid{old.Cid(), old.BlockID()}); err != nil {
+			return pruned, err
+		}
+		pruned++
+		cursor = old.PrevID()
+	}
+	e.Pruned = true
+	return pruned, s.putSnapshotEntry(t, l, e)
+}
+
+// boundary returns the oldest record of a compacted log, undefined if the
+// log was not compacted.
+func (s *recordStore) boundary(t thread.ID, l thread.LogID) (cid.Cid, error) {
+	e, err := s.snapshotEntry(t, l)
+	if err == core.ErrNoSnapshot || (err == nil && !e.Pruned) {
+		return cid.Undef, nil
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.Cast(e.Upto)
+}
+
+func (s *recordStore) snapshotEntry(t thread.ID, l thread.LogID) (e snapshotEntry, err error) {
+	data, err := s.ls.GetLogBytes(t, l, snapshotKey)
+	if err != nil {
+		return
+	}
+	if data == nil {
+		return e, core.ErrNoSnapshot
+	}
+	err = cbornode.DecodeInto(*data, &e)
+	return
+}
+
+func (s *recordStore) putSnapshotEntry(t thread.ID, l thread.LogID, e snapshotEntry) error {
+	data, err := cbornode.DumpObject(e)
+	if err != nil {
+		return err
+	}
+	return s.ls.PutLogBytes(t, l, snapshotKey, data)
+}
@@ -0,0 +1,108 @@
+// Package replication streams changes of a logstore from a leader to
+// follower logstores, e.g. to run hot standbys of a hosted service.
+//
+// The leader records IDs of changed threads in a ChangeLog observing its
+// logstore, and sends the exported state of every changed thread to
+// followers, which import it. Followers resume from the last change they
+// applied when they reconnect, and receive all threads again if the changes
+// they missed were dropped from the log meanwhile. Only followers allowed
+// by the leader are served, and private keys of logs and read keys of
+// threads are sent only if enabled with WithSecrets.
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/textileio/go-threads/core/thread"
+	lstore "github.com/textileio/go-threads/logstore"
+)
+
+var log = logging.Logger("replication")
+
+// DefaultLogSize is the number of changes kept by a ChangeLog if none is
+// given.
+var DefaultLogSize = 4096
+
+// change is a write to a thread, or to any thread if it's undefined.
+type change struct {
+	seq    uint64
+	thread thread.ID
+}
+
+// ChangeLog records changes of a logstore for followers. It must observe
+// every write to the logstore, so it's installed with lstore.WithObserver
+// when the logstore is created.
+type ChangeLog struct {
+	// epoch identifies the log, so that followers of a previous leader
+	// aren't resumed from sequence numbers of another log.
+	epoch uint64
+	size  int
+
+	lock    sync.Mutex
+	seq     uint64
+	dropped uint64 // seq of the last change dropped from changes
+	changes []change
+	notify  chan struct{}
+}
+
+var _ lstore.Observer = (*ChangeLog)(nil)
+
+// NewChangeLog creates a log keeping the last size changes, or
+// DefaultLogSize if size isn't positive.
+func NewChangeLog(size int) *ChangeLog {
+	if size <= 0 {
+		size = DefaultLogSize
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return &ChangeLog{
+		epoch:  binary.BigEndian.Uint64(b[:]) | 1, // never zero
+		size:   size,
+		notify: make(chan struct{}),
+	}
+}
+
+func (c *ChangeLog) Start(_, op string, t thread.ID) func(error) {
+	if !lstore.IsWriteOp(op) {
+		return func(error) {}
+	}
+	return func(err error) {
+		if err != nil {
+			return
+		}
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.seq++
+		c.changes = append(c.changes, change{seq: c.seq, thread: t})
+		if len(c.changes) > c.size {
+			c.dropped = c.changes[0].seq
+			c.changes = c.changes[1:]
+		}
+		close(c.notify)
+		c.notify = make(chan struct{})
+	}
+}
+
+// Seq returns the sequence number of the last change.
+func (c *ChangeLog) Seq() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.seq
+}
+
+// since returns changes after seq and a channel closed on the next change.
+// If some of them were dropped, ok is false.
+func (c *ChangeLog) since(seq uint64) (changes []change, ok bool, next <-chan struct{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if seq < c.dropped || seq > c.seq {
+		return nil, false, c.notify
+	}
+	i := len(c.changes) - int(c.seq-seq)
+	return append([]change(nil), c.changes[i:]...), true, c.notify
+}
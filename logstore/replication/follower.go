@@ -0,0 +1,171 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Follower applies changes of a leader to a logstore, which must not be
+// written to otherwise.
+type Follower struct {
+	store core.Logstore
+
+	syncing sync.Mutex
+
+	lock  sync.Mutex
+	epoch uint64
+	seq   uint64
+}
+
+// NewFollower creates a follower writing to the logstore.
+func NewFollower(store core.Logstore) *Follower {
+	return &Follower{store: store}
+}
+
+// Seq returns the last change of the leader applied by the follower.
+func (f *Follower) Seq() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.seq
+}
+
+// SyncPeer syncs with the leader over a libp2p stream of the host, see
+// Sync.
+func (f *Follower) SyncPeer(ctx context.Context, h host.Host, leader peer.ID) error {
+	s, err := h.NewStream(ctx, leader, Protocol)
+	if err != nil {
+		return fmt.Errorf("opening stream to leader %s: %w", leader, err)
+	}
+	defer s.Close()
+	if err := f.Sync(ctx, s); err != nil {
+		_ = s.Reset()
+		return err
+	}
+	return nil
+}
+
+// Sync applies changes sent by the leader on the other end of the stream
+// until the context is cancelled or the stream ends. It resumes from the
+// last change applied by a previous sync. Only one sync runs at a time.
+func (f *Follower) Sync(ctx context.Context, rw io.ReadWriter) error {
+	f.syncing.Lock()
+	defer f.syncing.Unlock()
+	stop := closeOnDone(ctx, rw)
+	defer stop()
+
+	r, w := bufio.NewReader(rw), bufio.NewWriter(rw)
+	f.lock.Lock()
+	hello := frame{kind: frameHello, num: f.epoch, seq: f.seq}
+	f.lock.Unlock()
+	if err := writeFrame(w, hello); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var (
+		epoch uint64
+		// threads received since a reset, which replace all local
+		// threads once it's complete
+		staged map[thread.ID]struct{}
+	)
+	for {
+		fr, err := readFrame(r)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+		switch fr.kind {
+		case frameReset:
+			// local threads are kept until the leader sent all of its
+			// threads, so that an interrupted reset doesn't leave the
+			// follower empty; followed from the next mark on
+			f.setSeq(0, 0)
+			epoch = fr.num
+			staged = make(map[thread.ID]struct{})
+		case framePut:
+			if err := f.replace(fr.thread, fr.data); err != nil {
+				return fmt.Errorf("replacing thread %s: %w", fr.thread, err)
+			}
+			if staged != nil {
+				staged[fr.thread] = struct{}{}
+			}
+		case frameDelete:
+			if err := f.store.DeleteThread(fr.thread); err != nil {
+				return fmt.Errorf("deleting thread %s: %w", fr.thread, err)
+			}
+		case frameMark:
+			if staged != nil {
+				if err := f.prune(staged); err != nil {
+					return err
+				}
+				staged = nil
+			}
+			if epoch != 0 {
+				f.setSeq(epoch, fr.num)
+				epoch = 0
+			} else {
+				f.setSeq(f.epoch, fr.num)
+			}
+		default:
+			return fmt.Errorf("unexpected frame %d", fr.kind)
+		}
+	}
+}
+
+func (f *Follower) setSeq(epoch, seq uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.epoch, f.seq = epoch, seq
+}
+
+// replace swaps the local thread with the exported one in a transaction,
+// so that the thread is never missing or partial.
+func (f *Follower) replace(id thread.ID, data []byte) error {
+	tr, err := core.Transactions(f.store)
+	if err != nil {
+		return err
+	}
+	tx, err := tr.BeginTxn(false)
+	if err != nil {
+		return err
+	}
+	if err := tx.DeleteThread(id); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.ImportThread(data); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w, rolling back: %s", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// prune deletes threads missing from a complete reset.
+func (f *Follower) prune(keep map[thread.ID]struct{}) error {
+	ids, err := f.store.Threads()
+	if err != nil {
+		return fmt.Errorf("listing threads: %w", err)
+	}
+	for _, id := range ids {
+		if _, ok := keep[id]; ok {
+			continue
+		}
+		if err := f.store.DeleteThread(id); err != nil {
+			return fmt.Errorf("deleting thread %s: %w", id, err)
+		}
+	}
+	return nil
+}
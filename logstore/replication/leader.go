@@ -0,0 +1,235 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	lstore "github.com/textileio/go-threads/logstore"
+)
+
+// Leader serves changes of a logstore to followers.
+type Leader struct {
+	store   core.Logstore
+	changes *ChangeLog
+	opts    LeaderOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// LeaderOptions holds the leader configuration.
+type LeaderOptions struct {
+	// Followers are the peers allowed to follow the leader over libp2p
+	// streams. Streams of other peers are refused.
+	Followers []peer.ID
+
+	// Secrets sends private keys of logs and read keys of threads to
+	// followers, which are left out of the threads sent otherwise.
+	Secrets bool
+}
+
+// LeaderOption configures a leader.
+type LeaderOption func(*LeaderOptions)
+
+// WithFollowers allows the peers to follow the leader.
+func WithFollowers(ids ...peer.ID) LeaderOption {
+	return func(opts *LeaderOptions) {
+		opts.Followers = append(opts.Followers, ids...)
+	}
+}
+
+// WithSecrets enables or disables sending secrets to followers, e.g. to
+// let a standby take over writing to the logs.
+func WithSecrets(secrets bool) LeaderOption {
+	return func(opts *LeaderOptions) {
+		opts.Secrets = secrets
+	}
+}
+
+// NewLeader creates a leader of the logstore, whose writes are observed by
+// the change log.
+func NewLeader(store core.Logstore, changes *ChangeLog, opts ...LeaderOption) *Leader {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Leader{store: store, changes: changes, ctx: ctx, cancel: cancel}
+	for _, opt := range opts {
+		opt(&l.opts)
+	}
+	return l
+}
+
+// HandleStream serves a follower over a libp2p stream. It's meant to be set
+// as the handler of Protocol on the host of the leader. Streams of peers
+// not allowed with WithFollowers are reset.
+func (l *Leader) HandleStream(s network.Stream) {
+	defer s.Close()
+	p := s.Conn().RemotePeer()
+	if !l.allowed(p) {
+		log.Warnf("refusing to serve unknown follower %s", p)
+		_ = s.Reset()
+		return
+	}
+	if err := l.Serve(l.ctx, s); err != nil && !errors.Is(err, io.EOF) && l.ctx.Err() == nil {
+		log.Warnf("error serving follower %s: %v", p, err)
+		_ = s.Reset()
+	}
+}
+
+func (l *Leader) allowed(p peer.ID) bool {
+	for _, f := range l.opts.Followers {
+		if f == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Serve sends changes to the follower on the other end of the stream until
+// the context is cancelled, the leader is closed or the stream fails. The
+// follower isn't authorized, which is left to callers of Serve.
+func (l *Leader) Serve(ctx context.Context, rw io.ReadWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-l.ctx.Done():
+			cancel()
+		}
+	}()
+	stop := closeOnDone(ctx, rw)
+	defer stop()
+
+	r, w := bufio.NewReader(rw), bufio.NewWriter(rw)
+	hello, err := readFrame(r)
+	if err != nil {
+		return fmt.Errorf("reading hello: %w", err)
+	}
+	if hello.kind != frameHello {
+		return fmt.Errorf("expected hello, got frame %d", hello.kind)
+	}
+
+	seq := hello.seq
+	full := hello.num != l.changes.epoch || seq == 0
+	for {
+		if full {
+			if seq, err = l.sendAll(w); err != nil {
+				return err
+			}
+			full = false
+		}
+
+		changes, ok, next := l.changes.since(seq)
+		if !ok {
+			full = true
+			continue
+		}
+		if len(changes) > 0 {
+			if seq, full, err = l.sendChanges(w, changes); err != nil {
+				return err
+			}
+			if full {
+				continue
+			}
+		}
+
+		select {
+		case <-next:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sendAll resets the follower to all threads, and returns the change they
+// are in sync with.
+func (l *Leader) sendAll(w *bufio.Writer) (uint64, error) {
+	// later changes are sent again, so that none are missed
+	seq := l.changes.Seq()
+	if err := writeFrame(w, frame{kind: frameReset, num: l.changes.epoch}); err != nil {
+		return 0, err
+	}
+	ids, err := l.store.Threads()
+	if err != nil {
+		return 0, fmt.Errorf("listing threads: %w", err)
+	}
+	for _, id := range ids {
+		if err := l.sendThread(w, id); err != nil {
+			return 0, err
+		}
+	}
+	return seq, l.mark(w, seq)
+}
+
+// sendChanges sends changed threads once each, and returns the last change
+// sent. If any thread may have changed, full is set instead.
+func (l *Leader) sendChanges(w *bufio.Writer, changes []change) (seq uint64, full bool, err error) {
+	sent := make(map[thread.ID]struct{}, len(changes))
+	for _, c := range changes {
+		if !c.thread.Defined() {
+			return 0, true, nil
+		}
+		if _, ok := sent[c.thread]; ok {
+			continue
+		}
+		sent[c.thread] = struct{}{}
+		if err := l.sendThread(w, c.thread); err != nil {
+			return 0, false, err
+		}
+	}
+	seq = changes[len(changes)-1].seq
+	return seq, false, l.mark(w, seq)
+}
+
+func (l *Leader) sendThread(w *bufio.Writer, id thread.ID) error {
+	data, err := l.store.ExportThread(id)
+	if errors.Is(err, core.ErrThreadNotFound) {
+		return writeFrame(w, frame{kind: frameDelete, thread: id})
+	} else if err != nil {
+		return fmt.Errorf("exporting thread %s: %w", id, err)
+	}
+	if !l.opts.Secrets {
+		if data, err = lstore.RedactExport(data); err != nil {
+			return fmt.Errorf("redacting thread %s: %w", id, err)
+		}
+	}
+	return writeFrame(w, frame{kind: framePut, thread: id, data: data})
+}
+
+func (l *Leader) mark(w *bufio.Writer, seq uint64) error {
+	if err := writeFrame(w, frame{kind: frameMark, num: seq}); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Close stops serving followers.
+func (l *Leader) Close() error {
+	l.cancel()
+	return nil
+}
+
+// closeOnDone closes the stream, if it can be closed, once the context is
+// done, so that blocked reads and writes return. The returned function
+// stops watching the context.
+func closeOnDone(ctx context.Context, rw io.ReadWriter) func() {
+	c, ok := rw.(io.Closer)
+	if !ok {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Close()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
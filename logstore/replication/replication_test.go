@@ -0,0 +1,272 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	mh "github.com/multiformats/go-multihash"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	lstore "github.com/textileio/go-threads/logstore"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+)
+
+func TestReplication(t *testing.T) {
+	changes := NewChangeLog(4)
+	leaderStore := lstoremem.NewLogstore(lstore.WithObserver(changes))
+	defer leaderStore.Close()
+	leader := NewLeader(leaderStore, changes)
+	defer leader.Close()
+	followerStore := lstoremem.NewLogstore()
+	defer followerStore.Close()
+	follower := NewFollower(followerStore)
+
+	// threads existing before the follower connects are sent too
+	a, alog := addThread(t, leaderStore)
+	sync := func() (stop func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		lconn, fconn := net.Pipe()
+		done := make(chan struct{}, 2)
+		go func() {
+			_ = leader.Serve(ctx, lconn)
+			done <- struct{}{}
+		}()
+		go func() {
+			_ = follower.Sync(ctx, fconn)
+			done <- struct{}{}
+		}()
+		return func() {
+			cancel()
+			<-done
+			<-done
+		}
+	}
+	stop := sync()
+	waitForHeads(t, followerStore, a, alog, 1)
+
+	// secrets are left out by default
+	sk, err := followerStore.PrivKey(a, alog)
+	checkErr(t, err)
+	rk, err := followerStore.ReadKey(a)
+	checkErr(t, err)
+	if sk != nil || rk != nil {
+		t.Fatal("expected secrets not to be sent")
+	}
+	pk, err := followerStore.PubKey(a, alog)
+	checkErr(t, err)
+	if pk == nil {
+		t.Fatal("expected public key to be sent")
+	}
+
+	b, blog := addThread(t, leaderStore)
+	waitForHeads(t, followerStore, b, blog, 1)
+	checkErr(t, leaderStore.AddHead(a, alog, newHead("a2")))
+	waitForHeads(t, followerStore, a, alog, 2)
+	checkErr(t, leaderStore.DeleteThread(a))
+	waitFor(t, "thread to be deleted", func() bool {
+		_, err := followerStore.GetThread(a)
+		return err == core.ErrThreadNotFound
+	})
+	waitFor(t, "follower to catch up", func() bool {
+		return follower.Seq() == changes.Seq()
+	})
+	stop()
+
+	// missed changes are resumed from the log
+	checkErr(t, leaderStore.PutString(b, "name", "b"))
+	stop = sync()
+	waitFor(t, "metadata to be synced", func() bool {
+		name, err := followerStore.GetString(b, "name")
+		return err == nil && name != nil && *name == "b"
+	})
+	stop()
+
+	// or sent again in full once dropped from the log
+	c, clog := addThread(t, leaderStore)
+	for _, v := range []string{"b1", "b2", "b3", "b4", "b5"} {
+		checkErr(t, leaderStore.PutString(b, "name", v))
+	}
+	checkErr(t, leaderStore.DeleteThread(b))
+	stop = sync()
+	defer stop()
+	waitForHeads(t, followerStore, c, clog, 1)
+	waitFor(t, "thread to be deleted", func() bool {
+		_, err := followerStore.GetThread(b)
+		return err == core.ErrThreadNotFound
+	})
+	waitFor(t, "follower to catch up", func() bool {
+		return follower.Seq() == changes.Seq()
+	})
+}
+
+func TestReplicationLibp2p(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, err := mocknet.FullMeshConnected(ctx, 3)
+	checkErr(t, err)
+	hosts := mn.Hosts()
+
+	changes := NewChangeLog(0)
+	leaderStore := lstoremem.NewLogstore(lstore.WithObserver(changes))
+	defer leaderStore.Close()
+	leader := NewLeader(leaderStore, changes, WithFollowers(hosts[1].ID()), WithSecrets(true))
+	defer leader.Close()
+	hosts[0].SetStreamHandler(Protocol, leader.HandleStream)
+	id, lid := addThread(t, leaderStore)
+
+	// unknown peers are refused
+	strangerStore := lstoremem.NewLogstore()
+	defer strangerStore.Close()
+	if err := NewFollower(strangerStore).SyncPeer(ctx, hosts[2], hosts[0].ID()); err == nil {
+		t.Fatal("expected sync of unknown follower to fail")
+	}
+	if _, err := strangerStore.GetThread(id); err != core.ErrThreadNotFound {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+
+	followerStore := lstoremem.NewLogstore()
+	defer followerStore.Close()
+	follower := NewFollower(followerStore)
+	done := make(chan error, 1)
+	go func() {
+		done <- follower.SyncPeer(ctx, hosts[1], hosts[0].ID())
+	}()
+	waitForHeads(t, followerStore, id, lid, 1)
+
+	// secrets are sent if enabled
+	sk, err := followerStore.PrivKey(id, lid)
+	checkErr(t, err)
+	rk, err := followerStore.ReadKey(id)
+	checkErr(t, err)
+	if sk == nil || rk == nil {
+		t.Fatal("expected secrets to be sent")
+	}
+
+	// closing the leader ends the sync
+	checkErr(t, leader.Close())
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected sync to end")
+	}
+}
+
+func TestReplicationInterruptedReset(t *testing.T) {
+	leaderStore := lstoremem.NewLogstore()
+	defer leaderStore.Close()
+	followerStore := lstoremem.NewLogstore()
+	defer followerStore.Close()
+	follower := NewFollower(followerStore)
+
+	kept, klog := addThread(t, followerStore)
+	stale, _ := addThread(t, followerStore)
+	checkErr(t, followerStore.PutString(kept, "name", "old"))
+	id, lid := addThread(t, leaderStore)
+	checkErr(t, leaderStore.PutString(id, "name", "new"))
+	data, err := leaderStore.ExportThread(id)
+	checkErr(t, err)
+	keptData, err := followerStore.ExportThread(kept)
+	checkErr(t, err)
+
+	// sync runs a reset sending the given frames, and closes the stream
+	sync := func(frames ...frame) {
+		lconn, fconn := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- follower.Sync(context.Background(), fconn)
+		}()
+		r, w := bufio.NewReader(lconn), bufio.NewWriter(lconn)
+		_, err := readFrame(r)
+		checkErr(t, err)
+		for _, fr := range frames {
+			checkErr(t, writeFrame(w, fr))
+		}
+		checkErr(t, w.Flush())
+		checkErr(t, lconn.Close())
+		<-done
+	}
+
+	// local threads survive a reset interrupted before its mark
+	sync(frame{kind: frameReset, num: 1}, frame{kind: framePut, thread: id, data: data})
+	waitForHeads(t, followerStore, kept, klog, 1)
+	waitForHeads(t, followerStore, id, lid, 1)
+	if _, err := followerStore.GetThread(stale); err != nil {
+		t.Fatalf("expected thread to be kept, got %v", err)
+	}
+
+	// replaced threads are never partial
+	if err := follower.replace(kept, []byte("garbage")); err == nil {
+		t.Fatal("expected replacing with a malformed export to fail")
+	}
+	name, err := followerStore.GetString(kept, "name")
+	checkErr(t, err)
+	if name == nil || *name != "old" {
+		t.Fatal("expected failed replacement to be rolled back")
+	}
+
+	// threads missing from a complete reset are deleted
+	sync(frame{kind: frameReset, num: 1},
+		frame{kind: framePut, thread: id, data: data},
+		frame{kind: framePut, thread: kept, data: keptData},
+		frame{kind: frameMark, num: 1})
+	if _, err := followerStore.GetThread(stale); err != core.ErrThreadNotFound {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+	waitForHeads(t, followerStore, kept, klog, 1)
+	name, err = followerStore.GetString(id, "name")
+	checkErr(t, err)
+	if name == nil || *name != "new" {
+		t.Fatal("expected thread to be replaced")
+	}
+	if follower.Seq() != 1 {
+		t.Fatalf("expected follower to be at change 1, got %d", follower.Seq())
+	}
+}
+
+// addThread adds a thread with a log and a head.
+func addThread(t *testing.T, ls core.Logstore) (thread.ID, thread.LogID) {
+	id := thread.NewIDV1(thread.Raw, 32)
+	checkErr(t, ls.AddThread(thread.Info{ID: id, Key: thread.NewRandomKey()}))
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	lid, err := thread.LogIDFromPrivKey(sk)
+	checkErr(t, err)
+	checkErr(t, ls.AddLog(id, thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk}))
+	checkErr(t, ls.AddHead(id, lid, newHead(id.String())))
+	return id, lid
+}
+
+func newHead(data string) cid.Cid {
+	hash, _ := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	return cid.NewCidV1(cid.Raw, hash)
+}
+
+func waitForHeads(t *testing.T, ls core.Logstore, id thread.ID, lid thread.LogID, n int) {
+	waitFor(t, "heads to be synced", func() bool {
+		heads, err := ls.Heads(id, lid)
+		return err == nil && len(heads) == n
+	})
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
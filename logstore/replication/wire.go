@@ -0,0 +1,122 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Protocol is the libp2p protocol of followers syncing with a leader.
+const Protocol protocol.ID = "/threads/replication/0.0.1"
+
+// maxFrameData caps the data of a frame, so that corrupt frames don't
+// exhaust memory.
+const maxFrameData = 1 << 28
+
+// A follower opens a stream with a hello frame holding the epoch of the
+// log it follows and the last change it applied. The leader replies with
+// frames changing threads of the follower, each batch of them followed by
+// a mark frame.
+type frameKind byte
+
+const (
+	// frameHello holds the epoch and last applied change of the follower.
+	frameHello frameKind = iota + 1
+	// frameReset precedes all threads of the leader. Threads of the
+	// follower missing from them are dropped at the next mark, from which
+	// on it follows the log of the given epoch.
+	frameReset
+	// framePut replaces the thread with the exported one.
+	framePut
+	// frameDelete deletes the thread.
+	frameDelete
+	// frameMark tells the follower that it's in sync up to a change.
+	frameMark
+)
+
+type frame struct {
+	kind   frameKind
+	num    uint64 // epoch of hello and reset frames, seq of mark frames
+	seq    uint64 // last applied change of hello frames
+	thread thread.ID
+	data   []byte
+}
+
+func writeFrame(w *bufio.Writer, f frame) error {
+	var buf [binary.MaxVarintLen64]byte
+	if err := w.WriteByte(byte(f.kind)); err != nil {
+		return err
+	}
+	for _, n := range []uint64{f.num, f.seq} {
+		if _, err := w.Write(buf[:binary.PutUvarint(buf[:], n)]); err != nil {
+			return err
+		}
+	}
+	for _, b := range [][]byte{f.thread.Bytes(), f.data} {
+		if _, err := w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(b)))]); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFrame(r *bufio.Reader) (f frame, err error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return f, err
+	}
+	f.kind = frameKind(kind)
+	if f.num, err = binary.ReadUvarint(r); err != nil {
+		return f, unexpectedEOF(err)
+	}
+	if f.seq, err = binary.ReadUvarint(r); err != nil {
+		return f, unexpectedEOF(err)
+	}
+	id, err := readBytes(r)
+	if err != nil {
+		return f, err
+	}
+	if len(id) > 0 {
+		if f.thread, err = thread.Cast(id); err != nil {
+			return f, fmt.Errorf("decoding thread of frame: %w", err)
+		}
+	}
+	if f.data, err = readBytes(r); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if n > maxFrameData {
+		return nil, fmt.Errorf("frame data of %d bytes exceeds limit", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// unexpectedEOF reports streams ending within a frame.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
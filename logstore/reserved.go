@@ -0,0 +1,127 @@
+package logstore
+
+import (
+	"time"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Metadata under reserved keys, see core.IsReservedKey, holds state of the
+// logstore, e.g. thread names, roles and pins, which has to go through the
+// methods maintaining it. The metadata setters and deleters reject reserved
+// keys, while the logstore writes them through its books.
+
+// PutInt64 stores an int value under key, failing with core.ErrReservedKey
+// for reserved keys.
+func (ls *logstore) PutInt64(id thread.ID, key string, val int64) error {
+	if core.IsReservedKey(key) {
+		return core.ErrReservedKey
+	}
+	return ls.putInt64(id, key, val)
+}
+
+// PutString stores a string value under key, failing with
+// core.ErrReservedKey for reserved keys.
+func (ls *logstore) PutString(id thread.ID, key string, val string) error {
+	if core.IsReservedKey(key) {
+		return core.ErrReservedKey
+	}
+	return ls.putString(id, key, val)
+}
+
+// PutBool stores a boolean value under key, failing with
+// core.ErrReservedKey for reserved keys.
+func (ls *logstore) PutBool(id thread.ID, key string, val bool) error {
+	if core.IsReservedKey(key) {
+		return core.ErrReservedKey
+	}
+	return ls.putBool(id, key, val)
+}
+
+// PutBytes stores a byte value under key, failing with core.ErrReservedKey
+// for reserved keys.
+func (ls *logstore) PutBytes(id thread.ID, key string, val []byte) error {
+	if core.IsReservedKey(key) {
+		return core.ErrReservedKey
+	}
+	return ls.putBytes(id, key, val)
+}
+
+// PutMetaWithTTL stores a value under key expiring after the TTL, failing
+// with core.ErrReservedKey for reserved keys.
+func (ls *logstore) PutMetaWithTTL(id thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if core.IsReservedKey(key) {
+		return core.ErrReservedKey
+	}
+	return ls.putMetaWithTTL(id, key, val, ttl)
+}
+
+// DeleteMetaPrefix deletes a key along with all keys namespaced under it,
+// failing with core.ErrReservedKey for reserved keys and with
+// core.ErrInvalidMetaKey for prefixes of every key. The prefix is checked
+// the way books match it, so "/_name" is reserved as well.
+func (ls *logstore) DeleteMetaPrefix(id thread.ID, prefix string) error {
+	key := core.CleanMetaKey(prefix)
+	if key == "" {
+		return core.ErrInvalidMetaKey
+	}
+	if core.IsReservedKey(key) {
+		return core.ErrReservedKey
+	}
+	return ls.ThreadMetadata.DeleteMetaPrefix(id, prefix)
+}
+
+// ClearMetadata clears all metadata under a thread but reserved keys,
+// which go along with the thread.
+func (ls *logstore) ClearMetadata(id thread.ID) error {
+	keys, err := ls.MetaKeys(id)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if core.IsReservedKey(k) {
+			continue
+		}
+		if err := ls.ThreadMetadata.DeleteMetaPrefix(id, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trustedMetadata writes reserved keys of the logstore too, e.g. to replay
+// its journal.
+type trustedMetadata struct {
+	core.ThreadMetadata
+	ls *logstore
+}
+
+// metadataOf returns the metadata of the logstore taking writes of reserved
+// keys if it's of this package, or the logstore itself otherwise.
+func metadataOf(ls core.Logstore) core.ThreadMetadata {
+	if l, ok := ls.(*logstore); ok {
+		return trustedMetadata{ThreadMetadata: l.ThreadMetadata, ls: l}
+	}
+	return ls
+}
+
+func (m trustedMetadata) PutInt64(id thread.ID, key string, val int64) error {
+	return m.ls.putInt64(id, key, val)
+}
+
+func (m trustedMetadata) PutString(id thread.ID, key string, val string) error {
+	return m.ls.putString(id, key, val)
+}
+
+func (m trustedMetadata) PutBool(id thread.ID, key string, val bool) error {
+	return m.ls.putBool(id, key, val)
+}
+
+func (m trustedMetadata) PutBytes(id thread.ID, key string, val []byte) error {
+	return m.ls.putBytes(id, key, val)
+}
+
+func (m trustedMetadata) PutMetaWithTTL(id thread.ID, key string, val interface{}, ttl time.Duration) error {
+	return m.ls.putMetaWithTTL(id, key, val, ttl)
+}
@@ -0,0 +1,126 @@
+package logstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Snapshots start with a magic prefix followed by the format version as
+// uvarint. Then every thread follows as uvarint length and the thread export.
+const (
+	snapshotMagic   = "lstore"
+	snapshotVersion = 1
+
+	// maxSnapshotThread caps the size of a thread in a snapshot, so that
+	// corrupt snapshots don't exhaust memory.
+	maxSnapshotThread = 1 << 28
+)
+
+// Snapshot writes contents of all threads in the store to w.
+func (ls *logstore) Snapshot(w io.Writer) error {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	ids, err := ls.threads()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	n := binary.PutUvarint(buf, snapshotVersion)
+	if _, err := bw.Write(buf[:n]); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		data, err := ls.exportThread(id)
+		if err != nil {
+			return fmt.Errorf("exporting thread %s: %w", id, err)
+		}
+		n = binary.PutUvarint(buf, uint64(len(data)))
+		if _, err := bw.Write(buf[:n]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore imports all threads from a snapshot read from r. Threads already
+// present in the store are rejected with ErrThreadExists. Restoring is all
+// or nothing: on failure, threads imported from the snapshot so far are
+// deleted again.
+func (ls *logstore) Restore(r io.Reader) error {
+	ls.Lock()
+	defer ls.Unlock()
+
+	var restored thread.IDSlice
+	if err := ls.restore(r, func(id thread.ID) { restored = append(restored, id) }); err != nil {
+		for _, id := range restored {
+			if derr := ls.deleteThread(id); derr != nil {
+				return fmt.Errorf("%w, cleaning up thread %s: %s", err, id, derr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// restore imports threads from the snapshot, calling done with every
+// thread imported.
+func (ls *logstore) restore(r io.Reader, done func(thread.ID)) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("reading snapshot header: %w", err)
+	}
+	if string(magic) != snapshotMagic {
+		return fmt.Errorf("not a logstore snapshot")
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("reading snapshot version: %w", err)
+	}
+	if version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		if size > maxSnapshotThread {
+			return fmt.Errorf("reading snapshot: thread of %d bytes exceeds limit", size)
+		}
+		// the buffer grows with the data actually read, not the size claimed
+		data, err := ioutil.ReadAll(io.LimitReader(br, int64(size)))
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		if uint64(len(data)) != size {
+			return fmt.Errorf("reading snapshot: %w", io.ErrUnexpectedEOF)
+		}
+		te, id, err := decodeThread(data)
+		if err != nil {
+			return fmt.Errorf("decoding thread: %w", err)
+		}
+		if err := ls.importThread(id, te); err != nil {
+			return err
+		}
+		done(id)
+	}
+}
@@ -0,0 +1,112 @@
+package logstore
+
+import (
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// Stats counts logs, addresses, keys and metadata entries of every thread.
+// Sizes are filled in only if the books report disk usage.
+func (ls *logstore) Stats() (core.Stats, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	stats := core.Stats{PerThread: make(map[thread.ID]core.ThreadStats)}
+	ids, err := ls.threads()
+	if err != nil {
+		return stats, err
+	}
+	addrs, err := ls.DumpAddrs()
+	if err != nil {
+		return stats, err
+	}
+	meta, err := ls.DumpMeta()
+	if err != nil {
+		return stats, err
+	}
+	metaCount := make(map[thread.ID]int)
+	for mk := range meta.Data.Int64 {
+		metaCount[mk.T]++
+	}
+	for mk := range meta.Data.Bool {
+		metaCount[mk.T]++
+	}
+	for mk := range meta.Data.String {
+		metaCount[mk.T]++
+	}
+	for mk := range meta.Data.Bytes {
+		metaCount[mk.T]++
+	}
+
+	for _, id := range ids {
+		ts := core.ThreadStats{Meta: metaCount[id]}
+		if ts.Keys, err = ls.threadKeyCount(id); err != nil {
+			return stats, err
+		}
+		set, err := ls.getLogIDs(id)
+		if err != nil {
+			return stats, err
+		}
+		ts.Logs = len(set)
+		for lid := range set {
+			ts.Addrs += len(addrs.Data[id][lid])
+			n, err := ls.logKeyCount(id, lid)
+			if err != nil {
+				return stats, err
+			}
+			ts.Keys += n
+		}
+		switch size, err := ls.threadDiskUsage(id); err {
+		case nil:
+			ts.Size = size
+		case core.ErrNotSupported:
+		default:
+			return stats, err
+		}
+
+		stats.PerThread[id] = ts
+		stats.Threads++
+		stats.Total.Logs += ts.Logs
+		stats.Total.Addrs += ts.Addrs
+		stats.Total.Keys += ts.Keys
+		stats.Total.Meta += ts.Meta
+		stats.Total.Size += ts.Size
+	}
+	return stats, nil
+}
+
+func (ls *logstore) threadKeyCount(id thread.ID) (n int, err error) {
+	sk, err := ls.ServiceKey(id)
+	if err != nil {
+		return
+	}
+	if sk != nil {
+		n++
+	}
+	rk, err := ls.ReadKey(id)
+	if err != nil {
+		return
+	}
+	if rk != nil {
+		n++
+	}
+	return
+}
+
+func (ls *logstore) logKeyCount(id thread.ID, lid thread.LogID) (n int, err error) {
+	pk, err := ls.PubKey(id, lid)
+	if err != nil {
+		return
+	}
+	if pk != nil {
+		n++
+	}
+	sk, err := ls.PrivKey(id, lid)
+	if err != nil {
+		return
+	}
+	if sk != nil {
+		n++
+	}
+	return
+}
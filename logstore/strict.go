@@ -0,0 +1,266 @@
+package logstore
+
+import (
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// enforceStrict wraps the books of the logstore to reject writes adding
+// entries to threads not registered with CreateThread. Removals are left
+// through, so that undeclared threads can still be cleaned up.
+func (ls *logstore) enforceStrict() {
+	c := &strictChecker{md: ls.ThreadMetadata}
+	ls.KeyBook = &strictKeyBook{KeyBook: ls.KeyBook, c: c}
+	ls.AddrBook = &strictAddrBook{AddrBook: ls.AddrBook, c: c}
+	ls.HeadBook = &strictHeadBook{HeadBook: ls.HeadBook, c: c}
+	ls.ThreadMetadata = &strictThreadMetadata{ThreadMetadata: ls.ThreadMetadata, c: c}
+}
+
+// strictChecker checks threads were created using the unwrapped metadata.
+type strictChecker struct {
+	md core.ThreadMetadata
+}
+
+func (c *strictChecker) check(t thread.ID) error {
+	return checkCreated(c.md, t)
+}
+
+// checkCreated returns core.ErrThreadNotFound if the thread wasn't
+// registered with CreateThread.
+func checkCreated(md core.ThreadMetadata, t thread.ID) error {
+	created, err := md.GetInt64(t, core.MetaThreadCreated)
+	if err != nil {
+		return err
+	}
+	if created == nil {
+		return core.ErrThreadNotFound
+	}
+	return nil
+}
+
+func (b *strictKeyBook) Close() error        { return closeBook(b.KeyBook) }
+func (b *strictAddrBook) Close() error       { return closeBook(b.AddrBook) }
+func (b *strictHeadBook) Close() error       { return closeBook(b.HeadBook) }
+func (b *strictThreadMetadata) Close() error { return closeBook(b.ThreadMetadata) }
+
+func (b *strictKeyBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.KeyBook, t)
+}
+func (b *strictAddrBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.AddrBook, t)
+}
+func (b *strictHeadBook) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.HeadBook, t)
+}
+func (b *strictThreadMetadata) ThreadDiskUsage(t thread.ID) (int64, error) {
+	return diskUsage(b.ThreadMetadata, t)
+}
+
+// strictKeyBook rejects keys of undeclared threads.
+type strictKeyBook struct {
+	core.KeyBook
+	c *strictChecker
+}
+
+func (b *strictKeyBook) AddPubKey(t thread.ID, l thread.LogID, pk crypto.PubKey) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.KeyBook.AddPubKey(t, l, pk)
+}
+
+func (b *strictKeyBook) RevokePubKey(t thread.ID, l thread.LogID) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.KeyBook.RevokePubKey(t, l)
+}
+
+func (b *strictKeyBook) AddPrivKey(t thread.ID, l thread.LogID, sk crypto.PrivKey) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.KeyBook.AddPrivKey(t, l, sk)
+}
+
+func (b *strictKeyBook) AddReadKey(t thread.ID, key *sym.Key) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.KeyBook.AddReadKey(t, key)
+}
+
+func (b *strictKeyBook) AddServiceKey(t thread.ID, key *sym.Key) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.KeyBook.AddServiceKey(t, key)
+}
+
+func (b *strictKeyBook) RotateReadKey(t thread.ID, key *sym.Key) (int, error) {
+	if err := b.c.check(t); err != nil {
+		return 0, err
+	}
+	return b.KeyBook.RotateReadKey(t, key)
+}
+
+func (b *strictKeyBook) RotateServiceKey(t thread.ID, key *sym.Key) (int, error) {
+	if err := b.c.check(t); err != nil {
+		return 0, err
+	}
+	return b.KeyBook.RotateServiceKey(t, key)
+}
+
+// strictAddrBook rejects addresses of undeclared threads.
+type strictAddrBook struct {
+	core.AddrBook
+	c *strictChecker
+}
+
+func (b *strictAddrBook) AddAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.AddrBook.AddAddr(t, l, addr, ttl)
+}
+
+func (b *strictAddrBook) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.AddrBook.AddAddrs(t, l, addrs, ttl)
+}
+
+func (b *strictAddrBook) SetAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.AddrBook.SetAddr(t, l, addr, ttl)
+}
+
+func (b *strictAddrBook) SetAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.AddrBook.SetAddrs(t, l, addrs, ttl)
+}
+
+func (b *strictAddrBook) AddAddrsFromSource(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.AddrBook.AddAddrsFromSource(t, l, addrs, ttl, src)
+}
+
+func (b *strictAddrBook) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	checked := make(map[thread.ID]struct{})
+	for _, en := range entries {
+		if _, ok := checked[en.Thread]; ok {
+			continue
+		}
+		if err := b.c.check(en.Thread); err != nil {
+			return err
+		}
+		checked[en.Thread] = struct{}{}
+	}
+	return b.AddrBook.AddLogAddrsBulk(entries, ttl)
+}
+
+func (b *strictAddrBook) ConsumeLogRecord(t thread.ID, env *record.Envelope, ttl time.Duration) (bool, error) {
+	if err := b.c.check(t); err != nil {
+		return false, err
+	}
+	return b.AddrBook.ConsumeLogRecord(t, env, ttl)
+}
+
+func (b *strictAddrBook) RecordDial(t thread.ID, l thread.LogID, addr ma.Multiaddr, rtt time.Duration) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.AddrBook.RecordDial(t, l, addr, rtt)
+}
+
+// strictHeadBook rejects heads of undeclared threads.
+type strictHeadBook struct {
+	core.HeadBook
+	c *strictChecker
+}
+
+func (b *strictHeadBook) AddHead(t thread.ID, l thread.LogID, head cid.Cid) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.HeadBook.AddHead(t, l, head)
+}
+
+func (b *strictHeadBook) AddHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.HeadBook.AddHeads(t, l, heads)
+}
+
+func (b *strictHeadBook) SetHead(t thread.ID, l thread.LogID, head cid.Cid) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.HeadBook.SetHead(t, l, head)
+}
+
+func (b *strictHeadBook) SetHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.HeadBook.SetHeads(t, l, heads)
+}
+
+// strictThreadMetadata rejects metadata of undeclared threads, except for
+// the creation time registering them.
+type strictThreadMetadata struct {
+	core.ThreadMetadata
+	c *strictChecker
+}
+
+func (b *strictThreadMetadata) PutInt64(t thread.ID, key string, val int64) error {
+	if key != core.MetaThreadCreated {
+		if err := b.c.check(t); err != nil {
+			return err
+		}
+	}
+	return b.ThreadMetadata.PutInt64(t, key, val)
+}
+
+func (b *strictThreadMetadata) PutString(t thread.ID, key string, val string) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutString(t, key, val)
+}
+
+func (b *strictThreadMetadata) PutBool(t thread.ID, key string, val bool) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutBool(t, key, val)
+}
+
+func (b *strictThreadMetadata) PutBytes(t thread.ID, key string, val []byte) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutBytes(t, key, val)
+}
+
+func (b *strictThreadMetadata) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if err := b.c.check(t); err != nil {
+		return err
+	}
+	return b.ThreadMetadata.PutMetaWithTTL(t, key, val, ttl)
+}
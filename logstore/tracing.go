@@ -0,0 +1,46 @@
+package logstore
+
+import (
+	"context"
+
+	"github.com/textileio/go-threads/core/thread"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+)
+
+// WithTracer traces operations on the books of the logstore. Spans are
+// named after the book and operation, e.g. "logstore.addr.AddAddrs", and
+// carry the thread ID if the operation has one. Operations of the
+// context-aware logstore, e.g. "logstore.logstore.AddThread", are children
+// of the span of the caller's context, and parents of the book operations
+// they do.
+func WithTracer(tracer trace.Tracer) Option {
+	return WithObserver(&tracing{tracer: tracer})
+}
+
+// tracing starts a span per book operation.
+type tracing struct {
+	tracer trace.Tracer
+}
+
+var _ ContextObserver = (*tracing)(nil)
+
+func (tr *tracing) Start(book, op string, t thread.ID) func(error) {
+	_, done := tr.StartContext(context.Background(), book, op, t)
+	return done
+}
+
+func (tr *tracing) StartContext(ctx context.Context, book, op string, t thread.ID) (context.Context, func(error)) {
+	attrs := []label.KeyValue{label.String("logstore.book", book)}
+	if t.Defined() {
+		attrs = append(attrs, label.String("thread.id", t.String()))
+	}
+	ctx, span := tr.tracer.Start(ctx, "logstore."+book+"."+op, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(ctx, err, trace.WithErrorStatus(codes.Unknown))
+		}
+		span.End()
+	}
+}
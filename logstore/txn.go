@@ -0,0 +1,546 @@
+package logstore
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+var _ core.Txn = (*txn)(nil)
+
+// txn holds the logstore lock until it's done. Writable transactions
+// buffer their writes until commit: every write is queued and applied to a
+// staged state of its thread, which reads of the transaction are served
+// from. On commit, the queued writes are applied through a view of the
+// logstore holding back events. If one of them fails, the threads are
+// reverted to their state before the commit and the events are dropped.
+// Rollback just discards the queued writes.
+//
+// Readers taking the logstore lock never observe a partially applied
+// commit. Reads of the books, e.g. Addrs, Heads, GetInt64 or PubKey, don't
+// take it and may observe one while it's being applied.
+type txn struct {
+	ls       *logstore
+	readonly bool
+	done     bool
+	// staged maps threads written by the transaction to their state with
+	// the writes applied, which is nil for missing threads.
+	staged map[thread.ID]*threadExport
+	// ops are the queued writes, applied in order on commit.
+	ops []func() error
+}
+
+// BeginTxn starts a transaction holding the logstore lock. Read-only
+// transactions don't block each other.
+func (ls *logstore) BeginTxn(readonly bool) (core.Txn, error) {
+	if readonly {
+		ls.RLock()
+	} else {
+		ls.Lock()
+		v := *ls
+		v.pending = &[]core.Event{}
+		ls = &v
+	}
+	return &txn{
+		ls:       ls,
+		readonly: readonly,
+		staged:   make(map[thread.ID]*threadExport),
+	}, nil
+}
+
+func (tx *txn) Threads() (thread.IDSlice, error) {
+	if tx.done {
+		return nil, core.ErrTxnDone
+	}
+	ids, err := tx.ls.threads()
+	if err != nil || len(tx.staged) == 0 {
+		return ids, err
+	}
+	res := make(thread.IDSlice, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := tx.staged[id]; !ok {
+			res = append(res, id)
+		}
+	}
+	for id, te := range tx.staged {
+		if te.exists() {
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+func (tx *txn) GetThread(id thread.ID) (thread.Info, error) {
+	if tx.done {
+		return thread.Info{}, core.ErrTxnDone
+	}
+	if te, ok := tx.staged[id]; ok {
+		return te.info(id)
+	}
+	return tx.ls.getThread(id)
+}
+
+func (tx *txn) GetLog(id thread.ID, lid thread.LogID) (thread.LogInfo, error) {
+	if tx.done {
+		return thread.LogInfo{}, core.ErrTxnDone
+	}
+	if te, ok := tx.staged[id]; ok {
+		if te == nil {
+			return thread.LogInfo{}, core.ErrLogNotFound
+		}
+		return te.logInfo(lid)
+	}
+	return tx.ls.getLog(id, lid)
+}
+
+func (tx *txn) AddThread(info thread.Info) error {
+	te, err := tx.write(info.ID)
+	if err != nil {
+		return err
+	}
+	if info.Key.Service() == nil {
+		return fmt.Errorf("a service-key is required to add a thread")
+	}
+	if te == nil {
+		te = newThreadExport(info.ID)
+	}
+	if te.ServiceKey == nil {
+		te.ServiceKey = info.Key.Service().Bytes()
+	} else if !bytes.Equal(info.Key.Service().Bytes(), te.ServiceKey) {
+		return fmt.Errorf("service-key mismatch")
+	}
+	if info.Key.CanRead() {
+		if te.ReadKey == nil {
+			te.ReadKey = info.Key.Read().Bytes()
+		} else if !bytes.Equal(info.Key.Read().Bytes(), te.ReadKey) {
+			return fmt.Errorf("read-key mismatch")
+		}
+	}
+	for _, lg := range info.Logs {
+		if err := te.addLog(lg); err != nil {
+			return err
+		}
+	}
+	tx.staged[info.ID] = te
+	tx.queue(func() error {
+		if err := tx.ls.addThread(info); err != nil {
+			return err
+		}
+		for _, lg := range info.Logs {
+			if err := tx.ls.addLog(info.ID, lg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+func (tx *txn) AddLog(id thread.ID, lg thread.LogInfo) error {
+	te, err := tx.write(id)
+	if err != nil {
+		return err
+	}
+	if te == nil {
+		te = newThreadExport(id)
+	}
+	if err := te.addLog(lg); err != nil {
+		return err
+	}
+	tx.staged[id] = te
+	tx.queue(func() error { return tx.ls.addLog(id, lg) })
+	return nil
+}
+
+func (tx *txn) DeleteThread(id thread.ID) error {
+	if _, err := tx.write(id); err != nil {
+		return err
+	}
+	tx.staged[id] = nil
+	tx.queue(func() error { return tx.ls.deleteThread(id) })
+	return nil
+}
+
+func (tx *txn) ImportThread(data []byte) error {
+	te, id, err := decodeThread(data)
+	if err != nil {
+		return fmt.Errorf("decoding thread: %w", err)
+	}
+	prev, err := tx.write(id)
+	if err != nil {
+		return err
+	}
+	if prev.exists() {
+		return core.ErrThreadExists
+	}
+	// the staged state is changed by later writes, the queued one isn't
+	staged, _, err := decodeThread(data)
+	if err != nil {
+		return fmt.Errorf("decoding thread: %w", err)
+	}
+	tx.staged[id] = &staged
+	tx.queue(func() error { return tx.ls.importThread(id, te) })
+	return nil
+}
+
+func (tx *txn) AddAddrs(id thread.ID, lid thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	te, err := tx.write(id)
+	if err != nil {
+		return err
+	}
+	if te == nil {
+		te = newThreadExport(id)
+	}
+	te.log(lid).addAddrs(addrs, ttl)
+	tx.staged[id] = te
+	tx.queue(func() error { return tx.ls.AddAddrs(id, lid, addrs, ttl) })
+	return nil
+}
+
+func (tx *txn) SetHeads(id thread.ID, lid thread.LogID, heads []cid.Cid) error {
+	te, err := tx.write(id)
+	if err != nil {
+		return err
+	}
+	if te == nil {
+		te = newThreadExport(id)
+	}
+	le := te.log(lid)
+	le.Heads = make([][]byte, len(heads))
+	for i, h := range heads {
+		le.Heads[i] = h.Bytes()
+	}
+	tx.staged[id] = te
+	tx.queue(func() error { return tx.ls.SetHeads(id, lid, heads) })
+	return nil
+}
+
+func (tx *txn) PutInt64(id thread.ID, key string, val int64) error {
+	if err := tx.putMeta(id, key, val); err != nil {
+		return err
+	}
+	tx.queue(func() error { return tx.ls.PutInt64(id, key, val) })
+	return nil
+}
+
+func (tx *txn) PutString(id thread.ID, key string, val string) error {
+	if err := tx.putMeta(id, key, val); err != nil {
+		return err
+	}
+	tx.queue(func() error { return tx.ls.PutString(id, key, val) })
+	return nil
+}
+
+func (tx *txn) PutBool(id thread.ID, key string, val bool) error {
+	if err := tx.putMeta(id, key, val); err != nil {
+		return err
+	}
+	tx.queue(func() error { return tx.ls.PutBool(id, key, val) })
+	return nil
+}
+
+func (tx *txn) PutBytes(id thread.ID, key string, val []byte) error {
+	if err := tx.putMeta(id, key, val); err != nil {
+		return err
+	}
+	tx.queue(func() error { return tx.ls.PutBytes(id, key, val) })
+	return nil
+}
+
+func (tx *txn) Commit() error {
+	if tx.done {
+		return core.ErrTxnDone
+	}
+	defer tx.end()
+	if tx.readonly {
+		return nil
+	}
+
+	// remember the state of the threads to revert them on failure
+	prev := make(map[thread.ID]*threadExport, len(tx.staged))
+	for id := range tx.staged {
+		te, err := tx.ls.currentState(id)
+		if err != nil {
+			return err
+		}
+		prev[id] = te
+	}
+	for _, op := range tx.ops {
+		if err := op(); err != nil {
+			if rerr := tx.revert(prev); rerr != nil {
+				return fmt.Errorf("%w, reverting: %s", err, rerr)
+			}
+			return err
+		}
+	}
+	for _, ev := range *tx.ls.pending {
+		tx.ls.dispatch(ev)
+	}
+	return nil
+}
+
+func (tx *txn) Rollback() error {
+	if tx.done {
+		return core.ErrTxnDone
+	}
+	tx.end()
+	return nil
+}
+
+// revert restores the threads to their previous state, which is nil for
+// threads missing before.
+func (tx *txn) revert(prev map[thread.ID]*threadExport) error {
+	for id, te := range prev {
+		if err := tx.ls.revertThread(id, te); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write checks the transaction accepts writes and returns the staged
+// state of the thread, loading it on the first write.
+func (tx *txn) write(id thread.ID) (*threadExport, error) {
+	if tx.done {
+		return nil, core.ErrTxnDone
+	}
+	if tx.readonly {
+		return nil, core.ErrTxnReadOnly
+	}
+	if te, ok := tx.staged[id]; ok {
+		return te, nil
+	}
+	return tx.ls.currentState(id)
+}
+
+func (tx *txn) putMeta(id thread.ID, key string, val interface{}) error {
+	if core.IsReservedKey(key) {
+		return core.ErrReservedKey
+	}
+	te, err := tx.write(id)
+	if err != nil {
+		return err
+	}
+	if te == nil {
+		te = newThreadExport(id)
+	}
+	te.putMeta(key, val)
+	tx.staged[id] = te
+	return nil
+}
+
+func (tx *txn) queue(op func() error) {
+	tx.ops = append(tx.ops, op)
+}
+
+func (tx *txn) end() {
+	tx.done = true
+	if tx.readonly {
+		tx.ls.RUnlock()
+	} else {
+		tx.ls.Unlock()
+	}
+}
+
+// Staged states of threads are kept as exports, see threadExport.
+
+func newThreadExport(id thread.ID) *threadExport {
+	return &threadExport{
+		ID:     id.Bytes(),
+		Int64:  make(map[string]int64),
+		Bool:   make(map[string]bool),
+		String: make(map[string]string),
+		Bytes:  make(map[string][]byte),
+	}
+}
+
+// exists reports whether the thread would be found in a logstore.
+func (te *threadExport) exists() bool {
+	if te == nil {
+		return false
+	}
+	_, created := te.Int64[core.MetaThreadCreated]
+	return created || te.ServiceKey != nil || len(te.Logs) > 0
+}
+
+func (te *threadExport) info(id thread.ID) (thread.Info, error) {
+	if te == nil || te.ServiceKey == nil {
+		return thread.Info{}, core.ErrThreadNotFound
+	}
+	sk, err := sym.FromBytes(te.ServiceKey)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	var rk *sym.Key
+	if te.ReadKey != nil {
+		if rk, err = sym.FromBytes(te.ReadKey); err != nil {
+			return thread.Info{}, err
+		}
+	}
+	logs := make([]thread.LogInfo, 0, len(te.Logs))
+	for _, le := range te.Logs {
+		lid, err := thread.LogIDFromBytes(le.ID)
+		if err != nil {
+			return thread.Info{}, err
+		}
+		lg, err := te.logInfo(lid)
+		if err == core.ErrLogNotFound {
+			continue
+		} else if err != nil {
+			return thread.Info{}, err
+		}
+		logs = append(logs, lg)
+	}
+	return thread.Info{ID: id, Logs: logs, Key: thread.NewKey(sk, rk)}, nil
+}
+
+func (te *threadExport) logInfo(lid thread.LogID) (info thread.LogInfo, err error) {
+	var le *logExport
+	for i := range te.Logs {
+		if bytes.Equal(te.Logs[i].ID, []byte(lid)) {
+			le = &te.Logs[i]
+		}
+	}
+	if le == nil || le.PubKey == nil {
+		return info, core.ErrLogNotFound
+	}
+	if info.PubKey, err = crypto.UnmarshalPublicKey(le.PubKey); err != nil {
+		return
+	}
+	if le.PrivKey != nil {
+		if info.PrivKey, err = crypto.UnmarshalPrivateKey(le.PrivKey); err != nil {
+			return
+		}
+	}
+	now := time.Now().Unix()
+	for i, b := range le.Addrs {
+		if le.Expires[i] <= now {
+			continue
+		}
+		addr, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			return info, err
+		}
+		info.Addrs = append(info.Addrs, addr)
+	}
+	if len(le.Heads) > 0 {
+		if info.Head, err = cid.Cast(le.Heads[0]); err != nil {
+			return
+		}
+	}
+	info.ID = lid
+	info.Managed = te.Bool[logMetaKey(lid, managedKey)]
+	if owner, ok := te.Bytes[logMetaKey(lid, peerKey)]; ok {
+		info.Peer = peer.ID(owner)
+	}
+	return info, nil
+}
+
+// log returns the log of the thread, adding it if missing.
+func (te *threadExport) log(lid thread.LogID) *logExport {
+	for i := range te.Logs {
+		if bytes.Equal(te.Logs[i].ID, []byte(lid)) {
+			return &te.Logs[i]
+		}
+	}
+	te.Logs = append(te.Logs, logExport{ID: []byte(lid)})
+	return &te.Logs[len(te.Logs)-1]
+}
+
+func (te *threadExport) addLog(lg thread.LogInfo) error {
+	le := te.log(lg.ID)
+	if lg.PrivKey != nil {
+		if le.PrivKey != nil {
+			return core.ErrLogExists
+		}
+		sk, err := crypto.MarshalPrivateKey(lg.PrivKey)
+		if err != nil {
+			return err
+		}
+		le.PrivKey = sk
+	}
+	if lg.PubKey != nil {
+		pk, err := crypto.MarshalPublicKey(lg.PubKey)
+		if err != nil {
+			return err
+		}
+		le.PubKey = pk
+	}
+	le.addAddrs(lg.Addrs, pstore.PermanentAddrTTL)
+	if lg.Head.Defined() {
+		le.Heads = [][]byte{lg.Head.Bytes()}
+	}
+	if lg.Managed || lg.PrivKey != nil {
+		te.putMeta(logMetaKey(lg.ID, managedKey), true)
+	}
+	if lg.Peer != "" {
+		te.putMeta(logMetaKey(lg.ID, peerKey), []byte(lg.Peer))
+	}
+	return nil
+}
+
+func (le *logExport) addAddrs(addrs []ma.Multiaddr, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	exp := time.Now().Unix() + int64(ttl/time.Second)
+	for _, addr := range addrs {
+		i := 0
+		for ; i < len(le.Addrs); i++ {
+			if bytes.Equal(le.Addrs[i], addr.Bytes()) {
+				break
+			}
+		}
+		if i < len(le.Addrs) {
+			if le.Expires[i] < exp {
+				le.Expires[i] = exp
+			}
+			continue
+		}
+		le.Addrs = append(le.Addrs, addr.Bytes())
+		le.Expires = append(le.Expires, exp)
+		if len(le.Sources) == len(le.Addrs)-1 {
+			le.Sources = append(le.Sources, string(core.AddrSourceUnknown))
+		}
+	}
+}
+
+// putMeta stores the value under key, replacing values of other types.
+func (te *threadExport) putMeta(key string, val interface{}) {
+	if te.Int64 == nil {
+		te.Int64 = make(map[string]int64)
+	}
+	if te.Bool == nil {
+		te.Bool = make(map[string]bool)
+	}
+	if te.String == nil {
+		te.String = make(map[string]string)
+	}
+	if te.Bytes == nil {
+		te.Bytes = make(map[string][]byte)
+	}
+	delete(te.Int64, key)
+	delete(te.Bool, key)
+	delete(te.String, key)
+	delete(te.Bytes, key)
+	delete(te.Expires, key)
+	switch v := val.(type) {
+	case int64:
+		te.Int64[key] = v
+	case bool:
+		te.Bool[key] = v
+	case string:
+		te.String[key] = v
+	case []byte:
+		te.Bytes[key] = v
+	}
+}
@@ -0,0 +1,879 @@
+package logstore
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// Validate returns a middleware rejecting writes of malformed thread and log
+// IDs, addresses, keys, heads and metadata keys with errors wrapping
+// core.ErrInvalidThreadID, core.ErrInvalidLogID, core.ErrInvalidAddr,
+// core.ErrInvalidKey, core.ErrInvalidHead or core.ErrInvalidMetaKey.
+func Validate(ls core.Logstore) core.Logstore {
+	return &validatingLogstore{Logstore: ls}
+}
+
+var _ Middleware = Validate
+
+// validatingLogstore validates arguments of writes before passing them on.
+// Optional capabilities having writes validated here are implemented in
+// full, other ones are looked up in the wrapped logstore.
+type validatingLogstore struct {
+	core.Logstore
+}
+
+var (
+	_ core.Wrapper    = (*validatingLogstore)(nil)
+	_ core.NameBook   = (*validatingLogstore)(nil)
+	_ core.PinBook    = (*validatingLogstore)(nil)
+	_ core.AccessBook = (*validatingLogstore)(nil)
+	_ core.Inviter    = (*validatingLogstore)(nil)
+	_ core.Transactor = (*validatingLogstore)(nil)
+)
+
+func (v *validatingLogstore) Unwrap() core.Logstore { return v.Logstore }
+
+func validateThread(t thread.ID) error {
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", core.ErrInvalidThreadID, err)
+	}
+	return nil
+}
+
+func validateLog(t thread.ID, l thread.LogID) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	if _, err := thread.LogIDFromBytes([]byte(l)); err != nil {
+		return fmt.Errorf("%w: %v", core.ErrInvalidLogID, err)
+	}
+	return nil
+}
+
+func validateAddrs(addrs []ma.Multiaddr) error {
+	for _, addr := range addrs {
+		if addr == nil || len(addr.Bytes()) == 0 {
+			return fmt.Errorf("%w: empty address", core.ErrInvalidAddr)
+		}
+		if _, err := ma.NewMultiaddrBytes(addr.Bytes()); err != nil {
+			return fmt.Errorf("%w: %v", core.ErrInvalidAddr, err)
+		}
+	}
+	return nil
+}
+
+func validateSymKey(key *sym.Key) error {
+	if key == nil || len(key.Bytes()) != sym.KeyBytes {
+		return fmt.Errorf("%w: expected %d bytes of symmetric key", core.ErrInvalidKey, sym.KeyBytes)
+	}
+	return nil
+}
+
+func validatePubKey(l thread.LogID, pk crypto.PubKey) error {
+	if pk == nil || !l.MatchesPublicKey(pk) {
+		return fmt.Errorf("%w: public key does not match log %s", core.ErrInvalidKey, l)
+	}
+	return nil
+}
+
+func validatePrivKey(l thread.LogID, sk crypto.PrivKey) error {
+	if sk == nil || !l.MatchesPrivateKey(sk) {
+		return fmt.Errorf("%w: private key does not match log %s", core.ErrInvalidKey, l)
+	}
+	return nil
+}
+
+func validateHeads(heads []cid.Cid) error {
+	for _, h := range heads {
+		if !h.Defined() {
+			return core.ErrInvalidHead
+		}
+	}
+	return nil
+}
+
+func validateMetaKey(t thread.ID, key string) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	if key == "" {
+		return core.ErrInvalidMetaKey
+	}
+	return nil
+}
+
+func validateLogMetaKey(t thread.ID, l thread.LogID, key string) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if key == "" {
+		return core.ErrInvalidMetaKey
+	}
+	return nil
+}
+
+func validateThreadInfo(info thread.Info) error {
+	if err := validateThread(info.ID); err != nil {
+		return err
+	}
+	if err := validateSymKey(info.Key.Service()); err != nil {
+		return err
+	}
+	if info.Key.Read() != nil {
+		if err := validateSymKey(info.Key.Read()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLogInfo(t thread.ID, lg thread.LogInfo) error {
+	if err := validateLog(t, lg.ID); err != nil {
+		return err
+	}
+	if err := validatePubKey(lg.ID, lg.PubKey); err != nil {
+		return err
+	}
+	if lg.PrivKey != nil {
+		if err := validatePrivKey(lg.ID, lg.PrivKey); err != nil {
+			return err
+		}
+	}
+	return validateAddrs(lg.Addrs)
+}
+
+func (v *validatingLogstore) CreateThread(t thread.ID, opts ...core.ThreadOption) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.CreateThread(t, opts...)
+}
+
+func (v *validatingLogstore) AddThread(info thread.Info) error {
+	if err := validateThreadInfo(info); err != nil {
+		return err
+	}
+	return v.Logstore.AddThread(info)
+}
+
+func (v *validatingLogstore) AddLog(t thread.ID, lg thread.LogInfo) error {
+	if err := validateLogInfo(t, lg); err != nil {
+		return err
+	}
+	return v.Logstore.AddLog(t, lg)
+}
+
+func (v *validatingLogstore) DeleteThread(t thread.ID) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.DeleteThread(t)
+}
+
+func (v *validatingLogstore) DeleteLog(t thread.ID, l thread.LogID) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	return v.Logstore.DeleteLog(t, l)
+}
+
+func (v *validatingLogstore) ArchiveThread(t thread.ID, cold ds.Datastore) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.ArchiveThread(t, cold)
+}
+
+func (v *validatingLogstore) UnarchiveThread(t thread.ID, cold ds.Datastore) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.UnarchiveThread(t, cold)
+}
+
+func (v *validatingLogstore) Archive(t thread.ID, w io.Writer) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.Archive(t, w)
+}
+
+// Batch returns a batch validating its writes. The first invalid write
+// fails the commit, before anything is applied.
+func (v *validatingLogstore) Batch() core.Batch {
+	return &validatingBatch{Batch: v.Logstore.Batch()}
+}
+
+// validatingBatch validates arguments of writes before buffering them.
+type validatingBatch struct {
+	core.Batch
+	err error
+}
+
+func (b *validatingBatch) check(err error) bool {
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return err == nil
+}
+
+func (b *validatingBatch) AddThread(info thread.Info) {
+	if b.check(validateThreadInfo(info)) {
+		b.Batch.AddThread(info)
+	}
+}
+
+func (b *validatingBatch) AddLog(t thread.ID, lg thread.LogInfo) {
+	if b.check(validateLogInfo(t, lg)) {
+		b.Batch.AddLog(t, lg)
+	}
+}
+
+func (b *validatingBatch) PutInt64(t thread.ID, key string, val int64) {
+	if b.check(validateMetaKey(t, key)) {
+		b.Batch.PutInt64(t, key, val)
+	}
+}
+
+func (b *validatingBatch) PutString(t thread.ID, key string, val string) {
+	if b.check(validateMetaKey(t, key)) {
+		b.Batch.PutString(t, key, val)
+	}
+}
+
+func (b *validatingBatch) PutBool(t thread.ID, key string, val bool) {
+	if b.check(validateMetaKey(t, key)) {
+		b.Batch.PutBool(t, key, val)
+	}
+}
+
+func (b *validatingBatch) PutBytes(t thread.ID, key string, val []byte) {
+	if b.check(validateMetaKey(t, key)) {
+		b.Batch.PutBytes(t, key, val)
+	}
+}
+
+func (b *validatingBatch) Commit() error {
+	if b.err != nil {
+		return b.err
+	}
+	return b.Batch.Commit()
+}
+
+// Names
+
+func (v *validatingLogstore) SetThreadName(t thread.ID, name string) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	nb, err := core.Names(v.Logstore)
+	if err != nil {
+		return err
+	}
+	return nb.SetThreadName(t, name)
+}
+
+func (v *validatingLogstore) ThreadByName(name string) (thread.ID, error) {
+	nb, err := core.Names(v.Logstore)
+	if err != nil {
+		return thread.Undef, err
+	}
+	return nb.ThreadByName(name)
+}
+
+func (v *validatingLogstore) ThreadNames() (map[string]thread.ID, error) {
+	nb, err := core.Names(v.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return nb.ThreadNames()
+}
+
+// Pins
+
+func (v *validatingLogstore) Pin(t thread.ID, priority int) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	pb, err := core.Pins(v.Logstore)
+	if err != nil {
+		return err
+	}
+	return pb.Pin(t, priority)
+}
+
+func (v *validatingLogstore) Unpin(t thread.ID) error {
+	pb, err := core.Pins(v.Logstore)
+	if err != nil {
+		return err
+	}
+	return pb.Unpin(t)
+}
+
+func (v *validatingLogstore) PinnedThreads() ([]core.Pin, error) {
+	pb, err := core.Pins(v.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return pb.PinnedThreads()
+}
+
+// Access
+
+func (v *validatingLogstore) SetRole(t thread.ID, pk thread.PubKey, role core.Role) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	if pk == nil {
+		return fmt.Errorf("%w: missing identity", core.ErrInvalidKey)
+	}
+	ab, err := core.Access(v.Logstore)
+	if err != nil {
+		return err
+	}
+	return ab.SetRole(t, pk, role)
+}
+
+func (v *validatingLogstore) Role(t thread.ID, pk thread.PubKey) (core.Role, error) {
+	ab, err := core.Access(v.Logstore)
+	if err != nil {
+		return core.NoRole, err
+	}
+	return ab.Role(t, pk)
+}
+
+func (v *validatingLogstore) HasRole(t thread.ID, pk thread.PubKey, role core.Role) (bool, error) {
+	ab, err := core.Access(v.Logstore)
+	if err != nil {
+		return false, err
+	}
+	return ab.HasRole(t, pk, role)
+}
+
+func (v *validatingLogstore) Members(t thread.ID) ([]core.Member, error) {
+	ab, err := core.Access(v.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return ab.Members(t)
+}
+
+// Invites
+
+func (v *validatingLogstore) CreateInvite(t thread.ID, withReadKey bool, password string) ([]byte, error) {
+	inv, err := core.Invites(v.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	return inv.CreateInvite(t, withReadKey, password)
+}
+
+// AcceptInvite validates the thread and logs of the invite before passing
+// it on.
+func (v *validatingLogstore) AcceptInvite(data []byte, password string) (thread.Info, error) {
+	info, err := openInvite(data, password)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	if err := validateThreadInfo(info); err != nil {
+		return thread.Info{}, err
+	}
+	for _, lg := range info.Logs {
+		if err := validateLogInfo(info.ID, lg); err != nil {
+			return thread.Info{}, err
+		}
+	}
+	inv, err := core.Invites(v.Logstore)
+	if err != nil {
+		return thread.Info{}, err
+	}
+	return inv.AcceptInvite(data, password)
+}
+
+// Transactions
+
+// BeginTxn starts a transaction validating its writes.
+func (v *validatingLogstore) BeginTxn(readOnly bool) (core.Txn, error) {
+	tr, err := core.Transactions(v.Logstore)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := tr.BeginTxn(readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &validatingTxn{Txn: txn}, nil
+}
+
+// validatingTxn validates arguments of writes before buffering them.
+type validatingTxn struct {
+	core.Txn
+}
+
+func (x *validatingTxn) AddThread(info thread.Info) error {
+	if err := validateThreadInfo(info); err != nil {
+		return err
+	}
+	return x.Txn.AddThread(info)
+}
+
+func (x *validatingTxn) AddLog(t thread.ID, lg thread.LogInfo) error {
+	if err := validateLogInfo(t, lg); err != nil {
+		return err
+	}
+	return x.Txn.AddLog(t, lg)
+}
+
+func (x *validatingTxn) DeleteThread(t thread.ID) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return x.Txn.DeleteThread(t)
+}
+
+func (x *validatingTxn) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateAddrs(addrs); err != nil {
+		return err
+	}
+	return x.Txn.AddAddrs(t, l, addrs, ttl)
+}
+
+func (x *validatingTxn) SetHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateHeads(heads); err != nil {
+		return err
+	}
+	return x.Txn.SetHeads(t, l, heads)
+}
+
+func (x *validatingTxn) PutInt64(t thread.ID, key string, val int64) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return x.Txn.PutInt64(t, key, val)
+}
+
+func (x *validatingTxn) PutString(t thread.ID, key string, val string) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return x.Txn.PutString(t, key, val)
+}
+
+func (x *validatingTxn) PutBool(t thread.ID, key string, val bool) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return x.Txn.PutBool(t, key, val)
+}
+
+func (x *validatingTxn) PutBytes(t thread.ID, key string, val []byte) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return x.Txn.PutBytes(t, key, val)
+}
+
+// Key book
+
+func (v *validatingLogstore) AddPubKey(t thread.ID, l thread.LogID, pk crypto.PubKey) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validatePubKey(l, pk); err != nil {
+		return err
+	}
+	return v.Logstore.AddPubKey(t, l, pk)
+}
+
+func (v *validatingLogstore) AddPrivKey(t thread.ID, l thread.LogID, sk crypto.PrivKey) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validatePrivKey(l, sk); err != nil {
+		return err
+	}
+	return v.Logstore.AddPrivKey(t, l, sk)
+}
+
+func (v *validatingLogstore) AddReadKey(t thread.ID, key *sym.Key) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	if err := validateSymKey(key); err != nil {
+		return err
+	}
+	return v.Logstore.AddReadKey(t, key)
+}
+
+func (v *validatingLogstore) AddServiceKey(t thread.ID, key *sym.Key) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	if err := validateSymKey(key); err != nil {
+		return err
+	}
+	return v.Logstore.AddServiceKey(t, key)
+}
+
+func (v *validatingLogstore) RotateReadKey(t thread.ID, key *sym.Key) (int, error) {
+	if err := validateThread(t); err != nil {
+		return 0, err
+	}
+	if err := validateSymKey(key); err != nil {
+		return 0, err
+	}
+	return v.Logstore.RotateReadKey(t, key)
+}
+
+func (v *validatingLogstore) RotateServiceKey(t thread.ID, key *sym.Key) (int, error) {
+	if err := validateThread(t); err != nil {
+		return 0, err
+	}
+	if err := validateSymKey(key); err != nil {
+		return 0, err
+	}
+	return v.Logstore.RotateServiceKey(t, key)
+}
+
+func (v *validatingLogstore) RevokePubKey(t thread.ID, l thread.LogID) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	return v.Logstore.RevokePubKey(t, l)
+}
+
+func (v *validatingLogstore) ClearKeys(t thread.ID) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.ClearKeys(t)
+}
+
+func (v *validatingLogstore) ClearLogKeys(t thread.ID, l thread.LogID) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	return v.Logstore.ClearLogKeys(t, l)
+}
+
+func (v *validatingLogstore) RestoreKeys(dump core.DumpKeyBook) error {
+	for t, logs := range dump.Data.Public {
+		for l, pk := range logs {
+			if err := validateLog(t, l); err != nil {
+				return err
+			}
+			if err := validatePubKey(l, pk); err != nil {
+				return err
+			}
+		}
+	}
+	for t, logs := range dump.Data.Private {
+		for l, sk := range logs {
+			if err := validateLog(t, l); err != nil {
+				return err
+			}
+			if err := validatePrivKey(l, sk); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keys := range []map[thread.ID][]byte{dump.Data.Read, dump.Data.Service} {
+		for t, key := range keys {
+			if err := validateThread(t); err != nil {
+				return err
+			}
+			if _, err := sym.FromBytes(key); err != nil {
+				return fmt.Errorf("%w: %v", core.ErrInvalidKey, err)
+			}
+		}
+	}
+	for t, logs := range dump.Data.Revoked {
+		for _, l := range logs {
+			if err := validateLog(t, l); err != nil {
+				return err
+			}
+		}
+	}
+	return v.Logstore.RestoreKeys(dump)
+}
+
+// Address book
+
+func (v *validatingLogstore) AddAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	return v.AddAddrs(t, l, []ma.Multiaddr{addr}, ttl)
+}
+
+func (v *validatingLogstore) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateAddrs(addrs); err != nil {
+		return err
+	}
+	return v.Logstore.AddAddrs(t, l, addrs, ttl)
+}
+
+func (v *validatingLogstore) SetAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, ttl time.Duration) error {
+	return v.SetAddrs(t, l, []ma.Multiaddr{addr}, ttl)
+}
+
+func (v *validatingLogstore) SetAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateAddrs(addrs); err != nil {
+		return err
+	}
+	return v.Logstore.SetAddrs(t, l, addrs, ttl)
+}
+
+func (v *validatingLogstore) AddAddrsFromSource(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, ttl time.Duration, src core.AddrSource) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateAddrs(addrs); err != nil {
+		return err
+	}
+	return v.Logstore.AddAddrsFromSource(t, l, addrs, ttl, src)
+}
+
+func (v *validatingLogstore) ReplaceAddr(old, repl ma.Multiaddr, ttl time.Duration) ([]core.ThreadLog, error) {
+	if err := validateAddrs([]ma.Multiaddr{old, repl}); err != nil {
+		return nil, err
+	}
+	return v.Logstore.ReplaceAddr(old, repl, ttl)
+}
+
+func (v *validatingLogstore) AddLogAddrsBulk(entries []core.ThreadLogAddrs, ttl time.Duration) error {
+	for _, e := range entries {
+		if err := validateLog(e.Thread, e.Log); err != nil {
+			return err
+		}
+		if err := validateAddrs(e.Addrs); err != nil {
+			return err
+		}
+	}
+	return v.Logstore.AddLogAddrsBulk(entries, ttl)
+}
+
+func (v *validatingLogstore) RecordDial(t thread.ID, l thread.LogID, addr ma.Multiaddr, rtt time.Duration) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateAddrs([]ma.Multiaddr{addr}); err != nil {
+		return err
+	}
+	return v.Logstore.RecordDial(t, l, addr, rtt)
+}
+
+func (v *validatingLogstore) ConsumeLogRecord(t thread.ID, env *record.Envelope, ttl time.Duration) (bool, error) {
+	if err := validateThread(t); err != nil {
+		return false, err
+	}
+	return v.Logstore.ConsumeLogRecord(t, env, ttl)
+}
+
+func (v *validatingLogstore) UpdateAddrs(t thread.ID, l thread.LogID, oldTTL, newTTL time.Duration) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	return v.Logstore.UpdateAddrs(t, l, oldTTL, newTTL)
+}
+
+func (v *validatingLogstore) ClearAddrs(t thread.ID, l thread.LogID) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	return v.Logstore.ClearAddrs(t, l)
+}
+
+func (v *validatingLogstore) RestoreAddrs(dump core.DumpAddrBook) error {
+	for t, logs := range dump.Data {
+		for l, addrs := range logs {
+			if err := validateLog(t, l); err != nil {
+				return err
+			}
+			for _, a := range addrs {
+				if err := validateAddrs([]ma.Multiaddr{a.Addr}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for t, logs := range dump.Records {
+		for l := range logs {
+			if err := validateLog(t, l); err != nil {
+				return err
+			}
+		}
+	}
+	return v.Logstore.RestoreAddrs(dump)
+}
+
+// Head book
+
+func (v *validatingLogstore) AddHead(t thread.ID, l thread.LogID, head cid.Cid) error {
+	return v.AddHeads(t, l, []cid.Cid{head})
+}
+
+func (v *validatingLogstore) AddHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateHeads(heads); err != nil {
+		return err
+	}
+	return v.Logstore.AddHeads(t, l, heads)
+}
+
+func (v *validatingLogstore) SetHead(t thread.ID, l thread.LogID, head cid.Cid) error {
+	return v.SetHeads(t, l, []cid.Cid{head})
+}
+
+func (v *validatingLogstore) SetHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	if err := validateHeads(heads); err != nil {
+		return err
+	}
+	return v.Logstore.SetHeads(t, l, heads)
+}
+
+func (v *validatingLogstore) ClearHeads(t thread.ID, l thread.LogID) error {
+	if err := validateLog(t, l); err != nil {
+		return err
+	}
+	return v.Logstore.ClearHeads(t, l)
+}
+
+func (v *validatingLogstore) RestoreHeads(dump core.DumpHeadBook) error {
+	for t, logs := range dump.Data {
+		for l, heads := range logs {
+			if err := validateLog(t, l); err != nil {
+				return err
+			}
+			if err := validateHeads(heads); err != nil {
+				return err
+			}
+		}
+	}
+	return v.Logstore.RestoreHeads(dump)
+}
+
+// Thread and log metadata
+
+func (v *validatingLogstore) PutInt64(t thread.ID, key string, val int64) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutInt64(t, key, val)
+}
+
+func (v *validatingLogstore) PutString(t thread.ID, key string, val string) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutString(t, key, val)
+}
+
+func (v *validatingLogstore) PutBool(t thread.ID, key string, val bool) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutBool(t, key, val)
+}
+
+func (v *validatingLogstore) PutBytes(t thread.ID, key string, val []byte) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutBytes(t, key, val)
+}
+
+func (v *validatingLogstore) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if err := validateMetaKey(t, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutMetaWithTTL(t, key, val, ttl)
+}
+
+func (v *validatingLogstore) DeleteMetaPrefix(t thread.ID, prefix string) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.DeleteMetaPrefix(t, prefix)
+}
+
+func (v *validatingLogstore) ClearMetadata(t thread.ID) error {
+	if err := validateThread(t); err != nil {
+		return err
+	}
+	return v.Logstore.ClearMetadata(t)
+}
+
+func (v *validatingLogstore) RestoreMeta(dump core.DumpMetadata) error {
+	var keys []core.MetadataKey
+	for k := range dump.Data.Int64 {
+		keys = append(keys, k)
+	}
+	for k := range dump.Data.Bool {
+		keys = append(keys, k)
+	}
+	for k := range dump.Data.String {
+		keys = append(keys, k)
+	}
+	for k := range dump.Data.Bytes {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if err := validateMetaKey(k.T, k.K); err != nil {
+			return err
+		}
+	}
+	return v.Logstore.RestoreMeta(dump)
+}
+
+func (v *validatingLogstore) PutLogInt64(t thread.ID, l thread.LogID, key string, val int64) error {
+	if err := validateLogMetaKey(t, l, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutLogInt64(t, l, key, val)
+}
+
+func (v *validatingLogstore) PutLogString(t thread.ID, l thread.LogID, key string, val string) error {
+	if err := validateLogMetaKey(t, l, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutLogString(t, l, key, val)
+}
+
+func (v *validatingLogstore) PutLogBool(t thread.ID, l thread.LogID, key string, val bool) error {
+	if err := validateLogMetaKey(t, l, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutLogBool(t, l, key, val)
+}
+
+func (v *validatingLogstore) PutLogBytes(t thread.ID, l thread.LogID, key string, val []byte) error {
+	if err := validateLogMetaKey(t, l, key); err != nil {
+		return err
+	}
+	return v.Logstore.PutLogBytes(t, l, key, val)
+}
@@ -0,0 +1,314 @@
+package logstore
+
+import (
+	"container/heap"
+	"time"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+// keyThreadWalker is implemented by key books able to stream threads having
+// log keys without collecting them first.
+type keyThreadWalker interface {
+	ForEachThreadFromKeys(fn func(thread.ID) bool) error
+}
+
+// addrThreadWalker is implemented by address books able to stream threads
+// having log addresses without collecting them first.
+type addrThreadWalker interface {
+	ForEachThreadFromAddrs(fn func(thread.ID) bool) error
+}
+
+// forEachThreadFromKeys calls fn with threads having log keys until it
+// returns false. Threads may be passed more than once.
+func forEachThreadFromKeys(kb core.KeyBook, fn func(thread.ID) bool) error {
+	if w, ok := kb.(keyThreadWalker); ok {
+		return w.ForEachThreadFromKeys(fn)
+	}
+	ids, err := kb.ThreadsFromKeys()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !fn(id) {
+			break
+		}
+	}
+	return nil
+}
+
+// forEachThreadFromAddrs calls fn with threads having log addresses until
+// it returns false. Threads may be passed more than once.
+func forEachThreadFromAddrs(ab core.AddrBook, fn func(thread.ID) bool) error {
+	if w, ok := ab.(addrThreadWalker); ok {
+		return w.ForEachThreadFromAddrs(fn)
+	}
+	ids, err := ab.ThreadsFromAddrs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !fn(id) {
+			break
+		}
+	}
+	return nil
+}
+
+// metaThreadWalker is implemented by metadata books able to list threads
+// having a key without loading values of other keys.
+type metaThreadWalker interface {
+	ForEachThreadWithMeta(key string, fn func(thread.ID) bool) error
+}
+
+// forEachThreadWithMeta calls fn with every thread having a value stored
+// under the key until it returns false. Books not implementing
+// metaThreadWalker are dumped instead.
+func forEachThreadWithMeta(md core.ThreadMetadata, key string, fn func(thread.ID) bool) error {
+	if w, ok := md.(metaThreadWalker); ok {
+		return w.ForEachThreadWithMeta(key, fn)
+	}
+	dump, err := md.DumpMeta()
+	if err != nil {
+		return err
+	}
+	ids := make(map[thread.ID]struct{})
+	visit := func(mk core.MetadataKey) {
+		if mk.K == key {
+			ids[mk.T] = struct{}{}
+		}
+	}
+	for mk := range dump.Data.Int64 {
+		visit(mk)
+	}
+	for mk := range dump.Data.Bool {
+		visit(mk)
+	}
+	for mk := range dump.Data.String {
+		visit(mk)
+	}
+	for mk := range dump.Data.Bytes {
+		visit(mk)
+	}
+	for id := range ids {
+		if !fn(id) {
+			break
+		}
+	}
+	return nil
+}
+
+// threadMetaReader is implemented by metadata books able to read values of
+// a thread without loading other threads.
+type threadMetaReader interface {
+	ThreadMeta(t thread.ID) (core.MetadataValues, error)
+}
+
+// threadMeta returns all metadata values of the thread. Books not
+// implementing threadMetaReader are dumped instead.
+func threadMeta(md core.ThreadMetadata, id thread.ID) (core.MetadataValues, error) {
+	if r, ok := md.(threadMetaReader); ok {
+		return r.ThreadMeta(id)
+	}
+	vals := core.MetadataValues{
+		Int64:   make(map[string]int64),
+		Bool:    make(map[string]bool),
+		String:  make(map[string]string),
+		Bytes:   make(map[string][]byte),
+		Expires: make(map[string]time.Time),
+	}
+	dump, err := md.DumpMeta()
+	if err != nil {
+		return vals, err
+	}
+	for mk, v := range dump.Data.Int64 {
+		if mk.T == id {
+			vals.Int64[mk.K] = v
+		}
+	}
+	for mk, v := range dump.Data.Bool {
+		if mk.T == id {
+			vals.Bool[mk.K] = v
+		}
+	}
+	for mk, v := range dump.Data.String {
+		if mk.T == id {
+			vals.String[mk.K] = v
+		}
+	}
+	for mk, v := range dump.Data.Bytes {
+		if mk.T == id {
+			vals.Bytes[mk.K] = v
+		}
+	}
+	for mk, exp := range dump.Expires {
+		if mk.T == id {
+			vals.Expires[mk.K] = exp
+		}
+	}
+	return vals, nil
+}
+
+// smallestThreads keeps the n smallest distinct threads added to it in a
+// max-heap, so that a page of threads is collected without holding all of
+// them.
+type smallestThreads struct {
+	n   int
+	ids thread.IDSlice
+	in  map[thread.ID]struct{}
+}
+
+func newSmallestThreads(n int) *smallestThreads {
+	return &smallestThreads{n: n, in: make(map[thread.ID]struct{}, n)}
+}
+
+func (h *smallestThreads) Len() int           { return len(h.ids) }
+func (h *smallestThreads) Less(i, j int) bool { return h.ids[i] > h.ids[j] }
+func (h *smallestThreads) Swap(i, j int)      { h.ids[i], h.ids[j] = h.ids[j], h.ids[i] }
+func (h *smallestThreads) Push(x interface{}) { h.ids = append(h.ids, x.(thread.ID)) }
+
+func (h *smallestThreads) Pop() interface{} {
+	last := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	return last
+}
+
+func (h *smallestThreads) add(id thread.ID) {
+	if _, ok := h.in[id]; ok || h.n == 0 {
+		return
+	}
+	if len(h.ids) < h.n {
+		h.in[id] = struct{}{}
+		heap.Push(h, id)
+		return
+	}
+	if id >= h.ids[0] {
+		return
+	}
+	delete(h.in, h.ids[0])
+	h.in[id] = struct{}{}
+	h.ids[0] = id
+	heap.Fix(h, 0)
+}
+
+// sorted returns the threads in ascending order.
+func (h *smallestThreads) sorted() thread.IDSlice {
+	ids := make(thread.IDSlice, len(h.ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		ids[i] = heap.Pop(h).(thread.ID)
+	}
+	return ids
+}
+
+func (b *closingKeyBook) ForEachThreadFromKeys(fn func(thread.ID) bool) error {
+	if err := b.lc.enter(); err != nil {
+		return err
+	}
+	defer b.lc.exit()
+	return forEachThreadFromKeys(b.KeyBook, fn)
+}
+
+func (b *closingAddrBook) ForEachThreadFromAddrs(fn func(thread.ID) bool) error {
+	if err := b.lc.enter(); err != nil {
+		return err
+	}
+	defer b.lc.exit()
+	return forEachThreadFromAddrs(b.AddrBook, fn)
+}
+
+func (b *closingThreadMetadata) ForEachThreadWithMeta(key string, fn func(thread.ID) bool) error {
+	if err := b.lc.enter(); err != nil {
+		return err
+	}
+	defer b.lc.exit()
+	return forEachThreadWithMeta(b.ThreadMetadata, key, fn)
+}
+
+func (b *journaledKeyBook) ForEachThreadFromKeys(fn func(thread.ID) bool) error {
+	return forEachThreadFromKeys(b.KeyBook, fn)
+}
+
+func (b *journaledAddrBook) ForEachThreadFromAddrs(fn func(thread.ID) bool) error {
+	return forEachThreadFromAddrs(b.AddrBook, fn)
+}
+
+func (b *journaledThreadMetadata) ForEachThreadWithMeta(key string, fn func(thread.ID) bool) error {
+	return forEachThreadWithMeta(b.ThreadMetadata, key, fn)
+}
+
+func (b *observedKeyBook) ForEachThreadFromKeys(fn func(thread.ID) bool) (err error) {
+	defer b.observe(b.ctx, "key", "ForEachThreadFromKeys", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return forEachThreadFromKeys(b.KeyBook, fn)
+}
+
+func (b *observedAddrBook) ForEachThreadFromAddrs(fn func(thread.ID) bool) (err error) {
+	defer b.observe(b.ctx, "addr", "ForEachThreadFromAddrs", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return forEachThreadFromAddrs(b.AddrBook, fn)
+}
+
+func (b *observedThreadMetadata) ForEachThreadWithMeta(key string, fn func(thread.ID) bool) (err error) {
+	defer b.observe(b.ctx, "metadata", "ForEachThreadWithMeta", thread.Undef)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return forEachThreadWithMeta(b.ThreadMetadata, key, fn)
+}
+
+func (b *strictKeyBook) ForEachThreadFromKeys(fn func(thread.ID) bool) error {
+	return forEachThreadFromKeys(b.KeyBook, fn)
+}
+
+func (b *strictAddrBook) ForEachThreadFromAddrs(fn func(thread.ID) bool) error {
+	return forEachThreadFromAddrs(b.AddrBook, fn)
+}
+
+func (b *strictThreadMetadata) ForEachThreadWithMeta(key string, fn func(thread.ID) bool) error {
+	return forEachThreadWithMeta(b.ThreadMetadata, key, fn)
+}
+
+func (b *quotaKeyBook) ForEachThreadFromKeys(fn func(thread.ID) bool) error {
+	return forEachThreadFromKeys(b.KeyBook, fn)
+}
+
+func (b *quotaAddrBook) ForEachThreadFromAddrs(fn func(thread.ID) bool) error {
+	return forEachThreadFromAddrs(b.AddrBook, fn)
+}
+
+func (b *quotaThreadMetadata) ForEachThreadWithMeta(key string, fn func(thread.ID) bool) error {
+	return forEachThreadWithMeta(b.ThreadMetadata, key, fn)
+}
+
+func (b *closingThreadMetadata) ThreadMeta(t thread.ID) (core.MetadataValues, error) {
+	if err := b.lc.enter(); err != nil {
+		return core.MetadataValues{}, err
+	}
+	defer b.lc.exit()
+	return threadMeta(b.ThreadMetadata, t)
+}
+
+func (b *journaledThreadMetadata) ThreadMeta(t thread.ID) (core.MetadataValues, error) {
+	return threadMeta(b.ThreadMetadata, t)
+}
+
+func (b *observedThreadMetadata) ThreadMeta(t thread.ID) (vals core.MetadataValues, err error) {
+	defer b.observe(b.ctx, "metadata", "ThreadMeta", t)(&err)
+	if err = ctxErr(b.ctx); err != nil {
+		return
+	}
+	return threadMeta(b.ThreadMetadata, t)
+}
+
+func (b *strictThreadMetadata) ThreadMeta(t thread.ID) (core.MetadataValues, error) {
+	return threadMeta(b.ThreadMetadata, t)
+}
+
+func (b *quotaThreadMetadata) ThreadMeta(t thread.ID) (core.MetadataValues, error) {
+	return threadMeta(b.ThreadMetadata, t)
+}
@@ -0,0 +1,33 @@
+package logstore
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/textileio/go-threads/core/thread"
+)
+
+func TestSmallestThreads(t *testing.T) {
+	all := make(thread.IDSlice, 50)
+	for i := range all {
+		all[i] = thread.NewIDV1(thread.Raw, 24)
+	}
+	page := newSmallestThreads(7)
+	for _, i := range rand.Perm(len(all)) {
+		page.add(all[i])
+		// duplicates are held once
+		page.add(all[i%10])
+	}
+	sort.Sort(all)
+
+	got := page.sorted()
+	if len(got) != 7 {
+		t.Fatalf("expected 7 threads, got %d", len(got))
+	}
+	for i := range got {
+		if got[i] != all[i] {
+			t.Fatalf("thread %d mismatch: %s != %s", i, got[i], all[i])
+		}
+	}
+}
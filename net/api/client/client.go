@@ -233,12 +233,12 @@ func (c *Client) CreateRecord(ctx context.Context, id thread.ID, body format.Nod
 	return threadRecordFromProto(resp, info.Key.Service())
 }
 
-func (c *Client) AddRecord(ctx context.Context, id thread.ID, lid peer.ID, rec core.Record, opts ...core.ThreadOption) error {
+func (c *Client) AddRecord(ctx context.Context, id thread.ID, lid thread.LogID, rec core.Record, opts ...core.ThreadOption) error {
 	args := &core.ThreadOptions{}
 	for _, opt := range opts {
 		opt(args)
 	}
-	lidb, _ := lid.Marshal()
+	lidb, _ := lid.MarshalBinary()
 	prec, err := cbor.RecordToProto(ctx, nil, rec)
 	if err != nil {
 		return err
@@ -357,7 +357,7 @@ func threadInfoFromProto(reply *pb.ThreadInfoReply) (info thread.Info, err error
 	}
 	logs := make([]thread.LogInfo, len(reply.Logs))
 	for i, lg := range reply.Logs {
-		id, err := peer.IDFromBytes(lg.ID)
+		id, err := thread.LogIDFromBytes(lg.ID)
 		if err != nil {
 			return info, err
 		}
@@ -416,7 +416,7 @@ func threadRecordFromProto(reply *pb.NewRecordReply, key crypto.DecryptionKey) (
 	if err != nil {
 		return nil, err
 	}
-	logID, err := peer.IDFromBytes(reply.LogID)
+	logID, err := thread.LogIDFromBytes(reply.LogID)
 	if err != nil {
 		return nil, err
 	}
@@ -264,7 +264,7 @@ func TestClient_AddRecord(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		logID, err := peer.IDFromPublicKey(logPk)
+		logID, err := thread.NewLogID(logPk)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -306,7 +306,7 @@ func (s *Service) CreateRecord(ctx context.Context, req *pb.CreateRecordRequest)
 	}
 	return &pb.NewRecordReply{
 		ThreadID: rec.ThreadID().Bytes(),
-		LogID:    marshalPeerID(rec.LogID()),
+		LogID:    marshalLogID(rec.LogID()),
 		Record:   util.RecFromServiceRec(prec),
 	}, nil
 }
@@ -326,7 +326,7 @@ func (s *Service) AddRecord(ctx context.Context, req *pb.AddRecordRequest) (*pb.
 	if err != nil {
 		return nil, err
 	}
-	logID, err := peer.IDFromBytes(req.LogID)
+	logID, err := thread.LogIDFromBytes(req.LogID)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -397,7 +397,7 @@ func (s *Service) Subscribe(req *pb.SubscribeRequest, server pb.API_SubscribeSer
 		}
 		if err := server.Send(&pb.NewRecordReply{
 			ThreadID: rec.ThreadID().Bytes(),
-			LogID:    marshalPeerID(rec.LogID()),
+			LogID:    marshalLogID(rec.LogID()),
 			Record:   util.RecFromServiceRec(prec),
 		}); err != nil {
 			return err
@@ -411,6 +411,11 @@ func marshalPeerID(id peer.ID) []byte {
 	return b
 }
 
+func marshalLogID(id thread.LogID) []byte {
+	b, _ := id.MarshalBinary() // This will never return an error
+	return b
+}
+
 func getKeyOptions(keys *pb.Keys) (opts []net.NewThreadOption, err error) {
 	if keys == nil {
 		return
@@ -455,7 +460,7 @@ func threadInfoToProto(info thread.Info) (*pb.ThreadInfoReply, error) {
 			addrs[j] = addr.Bytes()
 		}
 		logs[i] = &pb.LogInfo{
-			ID:      marshalPeerID(lg.ID),
+			ID:      marshalLogID(lg.ID),
 			PubKey:  pk,
 			PrivKey: sk,
 			Addrs:   addrs,
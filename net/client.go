@@ -17,6 +17,7 @@ import (
 	gostream "github.com/libp2p/go-libp2p-gostream"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/textileio/go-threads/cbor"
+	lstore "github.com/textileio/go-threads/core/logstore"
 	core "github.com/textileio/go-threads/core/net"
 	"github.com/textileio/go-threads/core/thread"
 	sym "github.com/textileio/go-threads/crypto/symmetric"
@@ -126,9 +127,9 @@ func (s *server) pushLog(ctx context.Context, id thread.ID, lg thread.LogInfo, p
 func (s *server) getRecords(
 	ctx context.Context,
 	tid thread.ID,
-	offsets map[peer.ID]cid.Cid,
+	offsets map[thread.LogID]cid.Cid,
 	limit int,
-) (map[peer.ID][]core.Record, error) {
+) (map[thread.LogID][]core.Record, error) {
 	sk, err := s.net.store.ServiceKey(tid)
 	if err != nil {
 		return nil, err
@@ -136,10 +137,14 @@ func (s *server) getRecords(
 		return nil, errors.New("a service-key is required to request records")
 	}
 
-	var pblgs = make([]*pb.GetRecordsRequest_Body_LogEntry, 0, len(offsets))
+	var (
+		pblgs = make([]*pb.GetRecordsRequest_Body_LogEntry, 0, len(offsets))
+		lids  = make([]thread.LogID, 0, len(offsets))
+	)
 	for lid, offset := range offsets {
+		lids = append(lids, lid)
 		pblgs = append(pblgs, &pb.GetRecordsRequest_Body_LogEntry{
-			LogID:  &pb.ProtoPeerID{ID: lid},
+			LogID:  &pb.ProtoPeerID{ID: lid.Peer()},
 			Offset: &pb.ProtoCid{Cid: offset},
 			Limit:  int32(limit),
 		})
@@ -167,12 +172,11 @@ func (s *server) getRecords(
 	// set of unique log addresses
 	var logAddrs = make(map[ma.Multiaddr]struct{}, len(offsets))
 	for lid := range offsets {
-		las, err := s.net.store.Addrs(tid, lid)
-		if err != nil {
-			return nil, err
-		}
-		for _, addr := range las {
+		if err := s.net.store.ForEachLogAddr(tid, lid, func(addr ma.Multiaddr) bool {
 			logAddrs[addr] = struct{}{}
+			return true
+		}); err != nil {
+			return nil, err
 		}
 	}
 
@@ -204,18 +208,20 @@ func (s *server) getRecords(
 
 			cctx, cancel := context.WithTimeout(ctx, PullTimeout)
 			defer cancel()
+			start := time.Now()
 			reply, err := client.GetRecords(cctx, req)
 			if err != nil {
 				log.Warnf("get records from %s failed: %s", pid, err)
 				return nil
 			}
+			s.recordDial(tid, lids, addr, time.Since(start))
 
 			for _, l := range reply.Logs {
-				var logID = l.LogID.ID
+				var logID = thread.LogIDFromPeer(l.LogID.ID)
 				log.Debugf("received %d records in log %s from %s", len(l.Records), logID, pid)
 
 				if l.Log != nil && len(l.Log.Addrs) > 0 {
-					if err = s.net.store.AddAddrs(tid, logID, addrsFromProto(l.Log.Addrs), pstore.PermanentAddrTTL); err != nil {
+					if err = s.net.store.AddAddrsFromSource(tid, logID, addrsFromProto(l.Log.Addrs), pstore.PermanentAddrTTL, lstore.AddrSourceDial); err != nil {
 						return err
 					}
 				}
@@ -236,6 +242,15 @@ func (s *server) getRecords(
 					pk = l.Log.PubKey
 				}
 
+				revoked, err := s.net.store.IsRevoked(tid, logID)
+				if err != nil {
+					return err
+				}
+				if revoked {
+					log.Warnf("skipping records of revoked log %s from %s", logID, pid)
+					continue
+				}
+
 				for _, r := range l.Records {
 					rec, err := cbor.RecordFromProto(r, sk)
 					if err != nil {
@@ -256,38 +271,25 @@ func (s *server) getRecords(
 	return rc.List()
 }
 
-// pushRecord to log addresses and thread topic.
-func (s *server) pushRecord(ctx context.Context, id thread.ID, lid peer.ID, rec core.Record) error {
+// pushRecord to log addresses and thread topic. Records that cannot be
+// pushed to a peer are queued for a retry.
+func (s *server) pushRecord(ctx context.Context, id thread.ID, lid thread.LogID, rec core.Record) error {
 	// Collect known writers
 	addrs := make([]ma.Multiaddr, 0)
 	info, err := s.net.store.GetThread(id)
 	if err != nil {
 		return err
 	}
+	lids := make([]thread.LogID, 0, len(info.Logs))
 	for _, l := range info.Logs {
 		addrs = append(addrs, l.Addrs...)
+		lids = append(lids, l.ID)
 	}
 
-	pbrec, err := cbor.RecordToProto(ctx, s.net, rec)
-	if err != nil {
-		return err
-	}
-	body := &pb.PushRecordRequest_Body{
-		ThreadID: &pb.ProtoThreadID{ID: id},
-		LogID:    &pb.ProtoPeerID{ID: lid},
-		Record:   pbrec,
-	}
-	sig, key, err := s.signRequestBody(body)
+	req, err := s.pushRecordRequest(ctx, id, lid, rec)
 	if err != nil {
 		return err
 	}
-	req := &pb.PushRecordRequest{
-		Header: &pb.Header{
-			PubKey:    &pb.ProtoPubKey{PubKey: key},
-			Signature: sig,
-		},
-		Body: body,
-	}
 
 	// Push to each address
 	for _, addr := range addrs {
@@ -300,43 +302,12 @@ func (s *server) pushRecord(ctx context.Context, id thread.ID, lid peer.ID, rec
 				return nil
 			}
 
-			client, err := s.dial(pid)
-			if err != nil {
-				return fmt.Errorf("dial %s failed: %w", pid, err)
-			}
-			cctx, cancel := context.WithTimeout(context.Background(), PushTimeout)
-			defer cancel()
-			if _, err = client.PushRecord(cctx, req); err != nil {
-				if status.Convert(err).Code() == codes.NotFound { // Send the missing log
-					log.Debugf("pushing log %s to %s...", lid, pid)
-					l, err := s.net.store.GetLog(id, lid)
-					if err != nil {
-						return err
-					}
-					body := &pb.PushLogRequest_Body{
-						ThreadID: &pb.ProtoThreadID{ID: id},
-						Log:      logToProto(l),
-					}
-					sig, key, err := s.signRequestBody(body)
-					if err != nil {
-						return err
-					}
-					lreq := &pb.PushLogRequest{
-						Header: &pb.Header{
-							PubKey:    &pb.ProtoPubKey{PubKey: key},
-							Signature: sig,
-						},
-						Body: body,
-					}
-					if _, err = client.PushLog(cctx, lreq); err != nil {
-						log.Warnf("push log to %s failed: %s", pid, err)
-						return nil
-					}
-					return nil
-				}
-				log.Warnf("push record to %s failed: %s", pid, err)
-				return nil
+			start := time.Now()
+			if err := s.pushRecordToPeer(id, lid, pid, req); err != nil {
+				log.Warnf("%s, queueing record %s", err, rec.Cid())
+				return s.net.queue.add(id, pid, lid, rec.Cid())
 			}
+			s.recordDial(id, lids, addr, time.Since(start))
 			return nil
 		})
 	}
@@ -351,6 +322,71 @@ func (s *server) pushRecord(ctx context.Context, id thread.ID, lid peer.ID, rec
 	return nil
 }
 
+// pushRecordRequest returns a signed request pushing the record of the log.
+func (s *server) pushRecordRequest(ctx context.Context, id thread.ID, lid thread.LogID, rec core.Record) (*pb.PushRecordRequest, error) {
+	pbrec, err := cbor.RecordToProto(ctx, s.net, rec)
+	if err != nil {
+		return nil, err
+	}
+	body := &pb.PushRecordRequest_Body{
+		ThreadID: &pb.ProtoThreadID{ID: id},
+		LogID:    &pb.ProtoPeerID{ID: lid.Peer()},
+		Record:   pbrec,
+	}
+	sig, key, err := s.signRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PushRecordRequest{
+		Header: &pb.Header{
+			PubKey:    &pb.ProtoPubKey{PubKey: key},
+			Signature: sig,
+		},
+		Body: body,
+	}, nil
+}
+
+// pushRecordToPeer sends a record request to the peer. If the peer does
+// not know the log yet, the log is sent instead, which the peer pulls.
+func (s *server) pushRecordToPeer(id thread.ID, lid thread.LogID, pid peer.ID, req *pb.PushRecordRequest) error {
+	client, err := s.dial(pid)
+	if err != nil {
+		return fmt.Errorf("dial %s failed: %w", pid, err)
+	}
+	cctx, cancel := context.WithTimeout(context.Background(), PushTimeout)
+	defer cancel()
+	if _, err = client.PushRecord(cctx, req); err != nil {
+		if status.Convert(err).Code() != codes.NotFound {
+			return fmt.Errorf("push record to %s failed: %w", pid, err)
+		}
+		// Send the missing log
+		log.Debugf("pushing log %s to %s...", lid, pid)
+		l, err := s.net.store.GetLog(id, lid)
+		if err != nil {
+			return err
+		}
+		body := &pb.PushLogRequest_Body{
+			ThreadID: &pb.ProtoThreadID{ID: id},
+			Log:      logToProto(l),
+		}
+		sig, key, err := s.signRequestBody(body)
+		if err != nil {
+			return err
+		}
+		lreq := &pb.PushLogRequest{
+			Header: &pb.Header{
+				PubKey:    &pb.ProtoPubKey{PubKey: key},
+				Signature: sig,
+			},
+			Body: body,
+		}
+		if _, err = client.PushLog(cctx, lreq); err != nil {
+			return fmt.Errorf("push log to %s failed: %w", pid, err)
+		}
+	}
+	return nil
+}
+
 // dial attempts to open a gRPC connection over libp2p to a peer.
 func (s *server) dial(peerID peer.ID) (pb.ServiceClient, error) {
 	s.Lock()
@@ -410,6 +446,16 @@ func (s *server) signRequestBody(msg proto.Marshaler) (sig []byte, pk crypto.Pub
 	return sig, sk.GetPublic(), nil
 }
 
+// recordDial stores the round-trip time of a successful call to a thread
+// address for the logs it may belong to.
+func (s *server) recordDial(id thread.ID, lids []thread.LogID, addr ma.Multiaddr, rtt time.Duration) {
+	for _, lid := range lids {
+		if err := s.net.store.RecordDial(id, lid, addr, rtt); err != nil {
+			log.Warnf("recording dial of %s failed: %s", addr, err)
+		}
+	}
+}
+
 func withErrLog(addr ma.Multiaddr, f func(addr ma.Multiaddr) error) {
 	if err := f(addr); err != nil {
 		log.Error(err.Error())
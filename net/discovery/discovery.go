@@ -0,0 +1,144 @@
+// Package discovery finds followers of threads through a content routing
+// system like the DHT. Followers announce provider records for threads they
+// follow, which lets others learn addresses of the peers hosting the logs.
+package discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	ma "github.com/multiformats/go-multiaddr"
+	mh "github.com/multiformats/go-multihash"
+	lstore "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+var log = logging.Logger("discovery")
+
+var (
+	// AnnounceInterval is the interval between announcements of followed
+	// threads, which must be shorter than the lifetime of provider records.
+	AnnounceInterval = time.Hour * 12
+
+	// AddrTTL is the TTL of log addresses learned from provider records.
+	AddrTTL = time.Hour
+
+	// MaxFollowers is the maximum number of followers looked up per thread.
+	MaxFollowers = 20
+)
+
+// ThreadCid returns the key followers of the thread announce.
+func ThreadCid(id thread.ID) (cid.Cid, error) {
+	h, err := mh.Sum(id.Bytes(), mh.SHA2_256, -1)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(cid.Raw, h), nil
+}
+
+// Discovery announces and looks up followers of threads in the logstore.
+type Discovery struct {
+	router routing.ContentRouting
+	store  lstore.Logstore
+	self   peer.ID
+}
+
+// New returns a discovery of threads in the store for the host with id self.
+func New(router routing.ContentRouting, store lstore.Logstore, self peer.ID) *Discovery {
+	return &Discovery{router: router, store: store, self: self}
+}
+
+// Announce advertises the host as a follower of the thread.
+func (d *Discovery) Announce(ctx context.Context, id thread.ID) error {
+	key, err := ThreadCid(id)
+	if err != nil {
+		return err
+	}
+	return d.router.Provide(ctx, key, true)
+}
+
+// Discover looks up followers of the thread. Addresses of followers hosting
+// known logs of the thread are added to the logs, tagged with the DHT source.
+func (d *Discovery) Discover(ctx context.Context, id thread.ID) ([]peer.AddrInfo, error) {
+	key, err := ThreadCid(id)
+	if err != nil {
+		return nil, err
+	}
+	var found []peer.AddrInfo
+	for pi := range d.router.FindProvidersAsync(ctx, key, MaxFollowers) {
+		if pi.ID == d.self {
+			continue
+		}
+		found = append(found, pi)
+		if err := addHostedAddrs(d.store, id, pi, AddrTTL, lstore.AddrSourceDHT); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// Run announces and discovers followers of all threads in the store every
+// AnnounceInterval until the context is done.
+func (d *Discovery) Run(ctx context.Context) {
+	tick := time.NewTicker(AnnounceInterval)
+	defer tick.Stop()
+	for {
+		ids, err := d.store.Threads()
+		if err != nil {
+			log.Errorf("error listing threads: %v", err)
+		}
+		for _, id := range ids {
+			if err := d.Announce(ctx, id); err != nil {
+				log.Warnf("error announcing thread %s: %v", id, err)
+			}
+			if _, err := d.Discover(ctx, id); err != nil {
+				log.Warnf("error discovering followers of thread %s: %v", id, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// addHostedAddrs adds addresses of the peer to known logs of the thread
+// hosted by the peer, i.e. having an address of the peer.
+func addHostedAddrs(store lstore.Logstore, id thread.ID, pi peer.AddrInfo, ttl time.Duration, src lstore.AddrSource) error {
+	if len(pi.Addrs) == 0 {
+		return nil
+	}
+	info, err := store.GetThread(id)
+	if err != nil {
+		return err
+	}
+	addrs, err := peer.AddrInfoToP2pAddrs(&pi)
+	if err != nil {
+		return err
+	}
+	for _, lg := range info.Logs {
+		for _, addr := range lg.Addrs {
+			if pid, err := hostOf(addr); err != nil || pid != pi.ID {
+				continue
+			}
+			if err := store.AddAddrsFromSource(id, lg.ID, addrs, ttl, src); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func hostOf(addr ma.Multiaddr) (peer.ID, error) {
+	v, err := addr.ValueForProtocol(ma.P_P2P)
+	if err != nil {
+		return "", err
+	}
+	return peer.Decode(v)
+}
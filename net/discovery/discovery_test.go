@@ -0,0 +1,150 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	lstore "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+)
+
+// mockRouter keeps provider records in memory.
+type mockRouter struct {
+	sync.Mutex
+	addrs     map[peer.ID][]ma.Multiaddr
+	providers map[cid.Cid][]peer.ID
+}
+
+func newMockRouter() *mockRouter {
+	return &mockRouter{
+		addrs:     make(map[peer.ID][]ma.Multiaddr),
+		providers: make(map[cid.Cid][]peer.ID),
+	}
+}
+
+// as returns a router announcing the peer.
+func (r *mockRouter) as(p peer.ID, addrs ...ma.Multiaddr) *peerRouter {
+	r.Lock()
+	r.addrs[p] = addrs
+	r.Unlock()
+	return &peerRouter{mockRouter: r, self: p}
+}
+
+type peerRouter struct {
+	*mockRouter
+	self peer.ID
+}
+
+func (r *peerRouter) Provide(_ context.Context, key cid.Cid, _ bool) error {
+	r.Lock()
+	defer r.Unlock()
+	r.providers[key] = append(r.providers[key], r.self)
+	return nil
+}
+
+func (r *peerRouter) FindProvidersAsync(_ context.Context, key cid.Cid, count int) <-chan peer.AddrInfo {
+	r.Lock()
+	defer r.Unlock()
+	ch := make(chan peer.AddrInfo, len(r.providers[key]))
+	for i, p := range r.providers[key] {
+		if count > 0 && i == count {
+			break
+		}
+		ch <- peer.AddrInfo{ID: p, Addrs: r.addrs[p]}
+	}
+	close(ch)
+	return ch
+}
+
+func TestDiscover(t *testing.T) {
+	ctx := context.Background()
+	router := newMockRouter()
+	tid := thread.NewIDV1(thread.Raw, 24)
+
+	self, follower := newPeer(t), newPeer(t)
+	followerAddr, _ := ma.NewMultiaddr("/ip4/10.0.0.1/tcp/4006")
+
+	ls := lstoremem.NewLogstore()
+	checkErr(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+	// the follower hosts a log known only by its peer address
+	lsk, lpk, _ := crypto.GenerateEd25519Key(nil)
+	lid, _ := thread.LogIDFromPrivKey(lsk)
+	hostAddr, _ := ma.NewMultiaddr("/p2p/" + follower.String())
+	checkErr(t, ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: lpk, Addrs: []ma.Multiaddr{hostAddr}}))
+
+	d := New(router.as(self), ls, self)
+	checkErr(t, d.Announce(ctx, tid))
+	checkErr(t, New(router.as(follower, followerAddr), lstoremem.NewLogstore(), follower).Announce(ctx, tid))
+
+	found, err := d.Discover(ctx, tid)
+	checkErr(t, err)
+	if len(found) != 1 || found[0].ID != follower {
+		t.Fatalf("expected to find the follower only, got %v", found)
+	}
+
+	addrs, err := ls.AddrsWithSource(tid, lid)
+	checkErr(t, err)
+	expected := followerAddr.Encapsulate(hostAddr)
+	var discovered bool
+	for _, a := range addrs {
+		if a.Addr.Equal(expected) {
+			discovered = a.Source == lstore.AddrSourceDHT
+		}
+	}
+	if !discovered {
+		t.Fatalf("expected %s from the DHT in %v", expected, addrs)
+	}
+}
+
+func TestLocalNotifee(t *testing.T) {
+	tid := thread.NewIDV1(thread.Raw, 24)
+	self, neighbor := newPeer(t), newPeer(t)
+	lanAddr, _ := ma.NewMultiaddr("/ip4/192.168.1.7/tcp/4006")
+
+	ls := lstoremem.NewLogstore()
+	checkErr(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+	lsk, lpk, _ := crypto.GenerateEd25519Key(nil)
+	lid, _ := thread.LogIDFromPrivKey(lsk)
+	hostAddr, _ := ma.NewMultiaddr("/p2p/" + neighbor.String())
+	checkErr(t, ls.AddLog(tid, thread.LogInfo{ID: lid, PubKey: lpk, Addrs: []ma.Multiaddr{hostAddr}}))
+
+	n := &localNotifee{id: tid, self: self, store: ls}
+	n.HandlePeerFound(peer.AddrInfo{ID: self, Addrs: []ma.Multiaddr{lanAddr}})
+	n.HandlePeerFound(peer.AddrInfo{ID: neighbor, Addrs: []ma.Multiaddr{lanAddr}})
+
+	addrs, err := ls.AddrsWithSource(tid, lid)
+	checkErr(t, err)
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %v", addrs)
+	}
+	for _, a := range addrs {
+		if a.Addr.Equal(lanAddr.Encapsulate(hostAddr)) && a.Source != lstore.AddrSourceMDNS {
+			t.Fatalf("expected local address from mDNS, got %s", a.Source)
+		}
+	}
+
+	if ServiceTag(tid) == ServiceTag(thread.NewIDV1(thread.Raw, 24)) {
+		t.Fatal("expected service tags of threads to differ")
+	}
+}
+
+func newPeer(t *testing.T) peer.ID {
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	checkErr(t, err)
+	p, err := peer.IDFromPrivateKey(sk)
+	checkErr(t, err)
+	return p
+}
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
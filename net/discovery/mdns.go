@@ -0,0 +1,110 @@
+package discovery
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery"
+	lstore "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	"github.com/whyrusleeping/base32"
+)
+
+var (
+	// MDNSInterval is the interval between queries for peers on the local network.
+	MDNSInterval = time.Minute
+
+	// LocalAddrTTL is the TTL of log addresses of peers on the local network.
+	LocalAddrTTL = time.Minute * 10
+)
+
+// ServiceTag returns the mDNS service advertised by hosts of the thread. It
+// is derived from a hash of the thread ID to fit into a DNS label.
+func ServiceTag(id thread.ID) string {
+	h := sha256.Sum256(id.Bytes())
+	return "_threads-" + base32.RawHexEncoding.EncodeToString(h[:16])
+}
+
+// Local advertises threads of the logstore over mDNS and adds addresses of
+// peers hosting their logs on the same network, so that peers can sync
+// without any infrastructure.
+type Local struct {
+	sync.Mutex
+
+	ctx      context.Context
+	host     host.Host
+	store    lstore.Logstore
+	services map[thread.ID]discovery.Service
+}
+
+// NewLocal returns a local discovery for the host.
+func NewLocal(ctx context.Context, h host.Host, store lstore.Logstore) *Local {
+	return &Local{
+		ctx:      ctx,
+		host:     h,
+		store:    store,
+		services: make(map[thread.ID]discovery.Service),
+	}
+}
+
+// Add starts advertising the thread. This may be called repeatedly for the same thread.
+func (l *Local) Add(id thread.ID) error {
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.services[id]; ok {
+		return nil
+	}
+	srv, err := discovery.NewMdnsService(l.ctx, l.host, MDNSInterval, ServiceTag(id))
+	if err != nil {
+		return err
+	}
+	srv.RegisterNotifee(&localNotifee{id: id, self: l.host.ID(), store: l.store})
+	l.services[id] = srv
+	return nil
+}
+
+// Remove stops advertising the thread. This may be called repeatedly for the same thread.
+func (l *Local) Remove(id thread.ID) error {
+	l.Lock()
+	defer l.Unlock()
+	srv, ok := l.services[id]
+	if !ok {
+		return nil
+	}
+	delete(l.services, id)
+	return srv.Close()
+}
+
+// Close stops advertising all threads.
+func (l *Local) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	var err error
+	for id, srv := range l.services {
+		if cerr := srv.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(l.services, id)
+	}
+	return err
+}
+
+// localNotifee adds addresses of peers found hosting the thread.
+type localNotifee struct {
+	id    thread.ID
+	self  peer.ID
+	store lstore.Logstore
+}
+
+func (n *localNotifee) HandlePeerFound(pi peer.AddrInfo) {
+	if pi.ID == n.self {
+		return
+	}
+	if err := addHostedAddrs(n.store, n.id, pi, LocalAddrTTL, lstore.AddrSourceMDNS); err != nil {
+		log.Warnf("error adding local addresses of %s to thread %s: %v", pi.ID, n.id, err)
+	}
+}
@@ -1,3 +1,8 @@
+// Package net syncs thread logs between peers. It serves the thread
+// protocol over libp2p streams, pushing new records to the addresses of
+// known logs and pulling missing records periodically or on demand. Which
+// peers to talk to and how far each log got is driven by the address and
+// head books of the logstore.
 package net
 
 import (
@@ -11,6 +16,8 @@ import (
 	"time"
 
 	"github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	bs "github.com/ipfs/go-ipfs-blockstore"
 	format "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log"
@@ -27,6 +34,7 @@ import (
 	core "github.com/textileio/go-threads/core/net"
 	"github.com/textileio/go-threads/core/thread"
 	sym "github.com/textileio/go-threads/crypto/symmetric"
+	"github.com/textileio/go-threads/logstore/recordstore"
 	pb "github.com/textileio/go-threads/net/pb"
 	"github.com/textileio/go-threads/net/util"
 	tu "github.com/textileio/go-threads/util"
@@ -87,6 +95,8 @@ type net struct {
 	bstore bs.Blockstore
 
 	store lstore.Logstore
+	codec *recordstore.Codec
+	queue *pushQueue
 
 	rpc    *grpc.Server
 	server *server
@@ -103,8 +113,14 @@ type net struct {
 
 // Config is used to specify thread instance options.
 type Config struct {
-	Debug  bool
+	Debug bool
+	// PubSub enables multicasting new records on a gossipsub topic per
+	// thread in the store, so that followers learn of them without
+	// waiting for the next pull of every log.
 	PubSub bool
+	// Queue persists records still to be pushed to unreachable peers.
+	// Pushes are queued in memory if not set.
+	Queue datastore.Datastore
 }
 
 // NewNetwork creates an instance of net from the given host and thread store.
@@ -128,12 +144,18 @@ func NewNetwork(
 		}
 	}
 
+	if conf.Queue == nil {
+		conf.Queue = dssync.MutexWrap(datastore.NewMapDatastore())
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	t := &net{
 		DAGService: ds,
 		host:       h,
 		bstore:     bstore,
 		store:      ls,
+		codec:      recordstore.NewCodec(ds, ls),
+		queue:      newPushQueue(conf.Queue),
 		rpc:        grpc.NewServer(serverOptions...),
 		bus:        broadcast.NewBroadcaster(EventBusCapacity),
 		connectors: make(map[thread.ID]*app.Connector),
@@ -159,6 +181,7 @@ func NewNetwork(
 	}()
 
 	go t.startPulling()
+	go t.retryPushes()
 	return t, nil
 }
 
@@ -453,6 +476,7 @@ func (n *net) DeleteThread(ctx context.Context, id thread.ID, opts ...core.Threa
 // deleteThread cleans up all the persistent and in-memory bits of a thread. This includes:
 // - Removing all record and event nodes.
 // - Deleting all logstore keys, addresses, and heads.
+// - Dropping queued pushes of records.
 // - Cancelling the pubsub subscription and topic.
 // Local subscriptions will not be cancelled and will simply stop reporting.
 // This method is internal and *not* thread-safe. It assumes we currently own the thread-lock.
@@ -477,6 +501,9 @@ func (n *net) deleteThread(ctx context.Context, id thread.ID) error {
 		}
 	}
 
+	if err := n.queue.clear(id); err != nil {
+		return err
+	}
 	return n.store.DeleteThread(id) // Delete logstore keys, addresses, heads, and metadata
 }
 
@@ -514,7 +541,7 @@ func (n *net) AddReplicator(ctx context.Context, id thread.ID, paddr ma.Multiadd
 		return
 	}
 	for _, lg := range managedLogs {
-		if err = n.store.AddAddr(info.ID, lg.ID, addr, pstore.PermanentAddrTTL); err != nil {
+		if err = n.store.AddAddrsFromSource(info.ID, lg.ID, []ma.Multiaddr{addr}, pstore.PermanentAddrTTL, lstore.AddrSourceManual); err != nil {
 			return
 		}
 	}
@@ -650,7 +677,7 @@ func (n *net) CreateRecord(ctx context.Context, id thread.ID, body format.Node,
 	return tr, nil
 }
 
-func (n *net) AddRecord(ctx context.Context, id thread.ID, lid peer.ID, rec core.Record, opts ...core.ThreadOption) error {
+func (n *net) AddRecord(ctx context.Context, id thread.ID, lid thread.LogID, rec core.Record, opts ...core.ThreadOption) error {
 	args := &core.ThreadOptions{}
 	for _, opt := range opts {
 		opt(args)
@@ -675,6 +702,14 @@ func (n *net) AddRecord(ctx context.Context, id thread.ID, lid peer.ID, rec core
 		return nil
 	}
 
+	revoked, err := n.store.IsRevoked(id, lid)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return lstore.ErrLogRevoked
+	}
+
 	if err = rec.Verify(logpk); err != nil {
 		return err
 	}
@@ -710,11 +745,11 @@ func (n *net) getRecord(ctx context.Context, id thread.ID, rid cid.Cid) (core.Re
 type Record struct {
 	core.Record
 	threadID thread.ID
-	logID    peer.ID
+	logID    thread.LogID
 }
 
 // NewRecord returns a record with the given values.
-func NewRecord(r core.Record, id thread.ID, lid peer.ID) core.ThreadRecord {
+func NewRecord(r core.Record, id thread.ID, lid thread.LogID) core.ThreadRecord {
 	return &Record{Record: r, threadID: id, logID: lid}
 }
 
@@ -726,7 +761,7 @@ func (r *Record) ThreadID() thread.ID {
 	return r.threadID
 }
 
-func (r *Record) LogID() peer.ID {
+func (r *Record) LogID() thread.LogID {
 	return r.logID
 }
 
@@ -834,7 +869,7 @@ func (n *net) getConnectorProtected(id thread.ID, token core.Token) (*app.Connec
 }
 
 // PutRecord adds an existing record. This method is thread-safe.
-func (n *net) PutRecord(ctx context.Context, id thread.ID, lid peer.ID, rec core.Record) error {
+func (n *net) PutRecord(ctx context.Context, id thread.ID, lid thread.LogID, rec core.Record) error {
 	if err := id.Validate(); err != nil {
 		return err
 	}
@@ -842,7 +877,7 @@ func (n *net) PutRecord(ctx context.Context, id thread.ID, lid peer.ID, rec core
 }
 
 // putRecord adds an existing record. This method is thread-safe.
-func (n *net) putRecord(ctx context.Context, tid thread.ID, lid peer.ID, rec core.Record) error {
+func (n *net) putRecord(ctx context.Context, tid thread.ID, lid thread.LogID, rec core.Record) error {
 	unknown, head, err := n.loadUnknownRecords(ctx, tid, lid, rec)
 	if err != nil {
 		return fmt.Errorf("loading records failed: %w", err)
@@ -898,7 +933,7 @@ func (n *net) putRecord(ctx context.Context, tid thread.ID, lid peer.ID, rec cor
 func (n *net) loadUnknownRecords(
 	ctx context.Context,
 	tid thread.ID,
-	lid peer.ID,
+	lid thread.LogID,
 	last core.Record,
 ) ([]core.ThreadRecord, cid.Cid, error) {
 	// check if last record was already loaded and processed
@@ -1005,7 +1040,7 @@ func (n *net) loadUnknownRecords(
 	return tRecords, head, nil
 }
 
-func (n *net) currentHead(tid thread.ID, lid peer.ID) (cid.Cid, error) {
+func (n *net) currentHead(tid thread.ID, lid thread.LogID) (cid.Cid, error) {
 	var head cid.Cid
 	heads, err := n.store.Heads(tid, lid)
 	if err != nil {
@@ -1023,34 +1058,7 @@ func (n *net) currentHead(tid thread.ID, lid peer.ID) (cid.Cid, error) {
 
 // newRecord creates a new record with the given body as a new event body.
 func (n *net) newRecord(ctx context.Context, id thread.ID, lg thread.LogInfo, body format.Node, pk thread.PubKey) (core.Record, error) {
-	if lg.PrivKey == nil {
-		return nil, fmt.Errorf("a private-key is required to create records")
-	}
-	sk, err := n.store.ServiceKey(id)
-	if err != nil {
-		return nil, err
-	}
-	if sk == nil {
-		return nil, fmt.Errorf("a service-key is required to create records")
-	}
-	rk, err := n.store.ReadKey(id)
-	if err != nil {
-		return nil, err
-	}
-	if rk == nil {
-		return nil, fmt.Errorf("a read-key is required to create records")
-	}
-	event, err := cbor.CreateEvent(ctx, n, body, rk)
-	if err != nil {
-		return nil, err
-	}
-	return cbor.CreateRecord(ctx, n, cbor.CreateRecordConfig{
-		Block:      event,
-		Prev:       lg.Head,
-		Key:        lg.PrivKey,
-		PubKey:     pk,
-		ServiceKey: sk,
-	})
+	return n.codec.Encode(ctx, id, lg.ID, body, lg.Head, pk)
 }
 
 // getPrivKey returns the host's private key.
@@ -1062,7 +1070,7 @@ func (n *net) getPrivKey() crypto.PrivKey {
 // offset but not farther than limit.
 // It is possible to reach limit before offset, meaning that the caller
 // will be responsible for the remaining traversal.
-func (n *net) getLocalRecords(ctx context.Context, id thread.ID, lid peer.ID, offset cid.Cid, limit int) ([]core.Record, error) {
+func (n *net) getLocalRecords(ctx context.Context, id thread.ID, lid thread.LogID, offset cid.Cid, limit int) ([]core.Record, error) {
 	lg, err := n.store.GetLog(id, lid)
 	if err != nil {
 		return nil, err
@@ -1114,7 +1122,7 @@ func (n *net) deleteRecord(ctx context.Context, rid cid.Cid, sk *sym.Key) (prev
 	return rec.PrevID(), nil
 }
 
-// startPulling periodically pulls on all threads.
+// startPulling periodically pulls on all threads, pinned ones first.
 func (n *net) startPulling() {
 	select {
 	case <-time.After(PullStartAfter):
@@ -1128,7 +1136,7 @@ func (n *net) startPulling() {
 
 PullCycle:
 	for {
-		ts, err := n.store.Threads()
+		ts, err := n.pullOrder()
 		if err != nil {
 			log.Errorf("error listing threads: %s", err)
 			return
@@ -1174,6 +1182,47 @@ PullCycle:
 	}
 }
 
+// pullOrder returns all threads in pulling order, i.e. pinned threads by
+// priority followed by the rest.
+func (n *net) pullOrder() (thread.IDSlice, error) {
+	ts, err := n.store.Threads()
+	if err != nil {
+		return nil, err
+	}
+	// stores without pins pull threads in their order
+	pb, err := lstore.Pins(n.store)
+	if errors.Is(err, lstore.ErrNotSupported) {
+		return ts, nil
+	} else if err != nil {
+		return nil, err
+	}
+	pins, err := pb.PinnedThreads()
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) == 0 {
+		return ts, nil
+	}
+	// pinned threads without logs are not pulled
+	rest := make(map[thread.ID]struct{}, len(ts))
+	for _, id := range ts {
+		rest[id] = struct{}{}
+	}
+	ordered := make(thread.IDSlice, 0, len(ts))
+	for _, p := range pins {
+		if _, ok := rest[p.Thread]; ok {
+			delete(rest, p.Thread)
+			ordered = append(ordered, p.Thread)
+		}
+	}
+	for _, id := range ts {
+		if _, ok := rest[id]; ok {
+			ordered = append(ordered, id)
+		}
+	}
+	return ordered, nil
+}
+
 // createLog creates a new log with the given peer as host.
 func (n *net) createLog(id thread.ID, key crypto.Key, identity thread.PubKey) (info thread.LogInfo, err error) {
 	var ok bool
@@ -1187,7 +1236,7 @@ func (n *net) createLog(id thread.ID, key crypto.Key, identity thread.PubKey) (i
 	} else if info.PubKey, ok = key.(crypto.PubKey); !ok {
 		return info, fmt.Errorf("invalid log-key")
 	}
-	info.ID, err = peer.IDFromPublicKey(info.PubKey)
+	info.ID, err = thread.NewLogID(info.PubKey)
 	if err != nil {
 		return
 	}
@@ -1234,7 +1283,7 @@ func (n *net) getOrCreateLog(id thread.ID, identity thread.PubKey) (info thread.
 			return *ownLog, nil
 		}
 	} else if lidb != nil {
-		lid, err := peer.IDFromBytes(*lidb)
+		lid, err := thread.LogIDFromBytes(*lidb)
 		if err != nil {
 			return info, err
 		}
@@ -1245,7 +1294,7 @@ func (n *net) getOrCreateLog(id thread.ID, identity thread.PubKey) (info thread.
 
 // createExternalLogIfNotExist creates an external log if doesn't exists. The created
 // log will have cid.Undef as the current head. Is thread-safe.
-func (n *net) createExternalLogIfNotExist(tid thread.ID, lid peer.ID, pubKey crypto.PubKey, privKey crypto.PrivKey, addrs []ma.Multiaddr) error {
+func (n *net) createExternalLogIfNotExist(tid thread.ID, lid thread.LogID, pubKey crypto.PubKey, privKey crypto.PrivKey, addrs []ma.Multiaddr) error {
 	ts := n.semaphores.Get(semaThreadUpdate(tid))
 	ts.Acquire()
 	defer ts.Release()
@@ -1277,16 +1326,16 @@ func (n *net) ensureUniqueLog(id thread.ID, key crypto.Key, identity thread.PubK
 	if err != nil {
 		return err
 	}
-	var lid peer.ID
+	var lid thread.LogID
 	if key != nil {
 		switch key.(type) {
 		case crypto.PubKey:
-			lid, err = peer.IDFromPublicKey(key.(crypto.PubKey))
+			lid, err = thread.NewLogID(key.(crypto.PubKey))
 			if err != nil {
 				return err
 			}
 		case crypto.PrivKey:
-			lid, err = peer.IDFromPrivateKey(key.(crypto.PrivKey))
+			lid, err = thread.LogIDFromPrivKey(key.(crypto.PrivKey))
 			if err != nil {
 				return err
 			}
@@ -1307,7 +1356,7 @@ func (n *net) ensureUniqueLog(id thread.ID, key crypto.Key, identity thread.PubK
 			}
 			return nil
 		}
-		lid, err = peer.IDFromBytes(*lidb)
+		lid, err = thread.LogIDFromBytes(*lidb)
 		if err != nil {
 			return err
 		}
@@ -1324,7 +1373,7 @@ func (n *net) ensureUniqueLog(id thread.ID, key crypto.Key, identity thread.PubK
 
 // updateRecordsFromLog will fetch lid addrs for new logs & records,
 // and will add them in the local peer store. Method is thread-safe.
-func (n *net) updateRecordsFromLog(tid thread.ID, lid peer.ID) {
+func (n *net) updateRecordsFromLog(tid thread.ID, lid thread.LogID) {
 	tps := n.semaphores.Get(semaThreadPull(tid))
 	if !tps.TryAcquire() {
 		log.Debugf("skip updating thread %s (log %s): concurrent pull in progress", tid, lid)
@@ -1360,13 +1409,13 @@ func (n *net) updateRecordsFromLog(tid thread.ID, lid peer.ID) {
 }
 
 // get offsets for all known thread's logs
-func (n *net) threadOffsets(tid thread.ID) (map[peer.ID]cid.Cid, error) {
+func (n *net) threadOffsets(tid thread.ID) (map[thread.LogID]cid.Cid, error) {
 	info, err := n.store.GetThread(tid)
 	if err != nil {
 		return nil, err
 	}
 
-	var offsets = make(map[peer.ID]cid.Cid, len(info.Logs))
+	var offsets = make(map[thread.LogID]cid.Cid, len(info.Logs))
 	for _, lg := range info.Logs {
 		var has bool
 		if lg.Head.Defined() {
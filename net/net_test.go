@@ -409,6 +409,36 @@ func TestNet_DeleteThread(t *testing.T) {
 	}
 }
 
+func TestNet_PullOrder(t *testing.T) {
+	t.Parallel()
+	n := makeNetwork(t)
+	defer n.Close()
+
+	ctx := context.Background()
+	infos := make([]thread.Info, 3)
+	for i := range infos {
+		infos[i] = createThread(t, ctx, n)
+	}
+	store, err := logstore.Pins(n.(*net).store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Pin(infos[2].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Pin(infos[1].ID, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := n.(*net).pullOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 3 || !ts[0].Equals(infos[1].ID) || !ts[1].Equals(infos[2].ID) || !ts[2].Equals(infos[0].ID) {
+		t.Fatalf("expected pinned threads to be pulled first, got %v", ts)
+	}
+}
+
 func TestClose(t *testing.T) {
 	t.Parallel()
 	n := makeNetwork(t)
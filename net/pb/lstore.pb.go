@@ -79,6 +79,12 @@ type AddrBookRecord_AddrEntry struct {
 	Expiry int64 `protobuf:"varint,2,opt,name=expiry,proto3" json:"expiry,omitempty"`
 	// The original TTL of this address.
 	Ttl int64 `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// Where this address was learned from.
+	Source string `protobuf:"bytes,4,opt,name=source,proto3" json:"source,omitempty"`
+	// The point in time of the last successful dial, in unix nanoseconds.
+	LastDial int64 `protobuf:"varint,5,opt,name=last_dial,json=lastDial,proto3" json:"last_dial,omitempty"`
+	// The round-trip time measured on the last successful dial.
+	Rtt int64 `protobuf:"varint,6,opt,name=rtt,proto3" json:"rtt,omitempty"`
 }
 
 func (m *AddrBookRecord_AddrEntry) Reset()         { *m = AddrBookRecord_AddrEntry{} }
@@ -128,6 +134,27 @@ func (m *AddrBookRecord_AddrEntry) GetTtl() int64 {
 	return 0
 }
 
+func (m *AddrBookRecord_AddrEntry) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *AddrBookRecord_AddrEntry) GetLastDial() int64 {
+	if m != nil {
+		return m.LastDial
+	}
+	return 0
+}
+
+func (m *AddrBookRecord_AddrEntry) GetRtt() int64 {
+	if m != nil {
+		return m.Rtt
+	}
+	return 0
+}
+
 // HeadBookRecord represents the list of heads currently in a log
 type HeadBookRecord struct {
 	// List of current heads of a log.
@@ -222,28 +249,31 @@ func init() {
 func init() { proto.RegisterFile("lstore.proto", fileDescriptor_804c9876c53f6037) }
 
 var fileDescriptor_804c9876c53f6037 = []byte{
-	// 334 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x91, 0x3f, 0x4f, 0xfa, 0x40,
-	0x1c, 0xc6, 0xb9, 0x5f, 0x7f, 0x34, 0xf0, 0xe5, 0x8f, 0x7a, 0x83, 0x69, 0x18, 0xae, 0x95, 0x45,
-	0x12, 0x43, 0x49, 0x34, 0x61, 0x17, 0x31, 0x91, 0x8d, 0x5c, 0x1c, 0x5c, 0x5b, 0xee, 0x84, 0x46,
-	0xe4, 0x9a, 0xe3, 0x48, 0xe4, 0x5d, 0xf8, 0x92, 0x1c, 0x1d, 0x19, 0x4d, 0x87, 0x46, 0xcb, 0x9b,
-	0x30, 0x4e, 0xa6, 0x5f, 0x1a, 0x22, 0xdb, 0x3d, 0xcf, 0xf3, 0x69, 0xee, 0xd3, 0x1c, 0xd4, 0xe7,
-	0x4b, 0xa3, 0xb4, 0xf4, 0x63, 0xad, 0x8c, 0xa2, 0xf6, 0x42, 0x1a, 0x3f, 0x0e, 0x5b, 0xdd, 0x69,
-	0x64, 0x66, 0xab, 0xd0, 0x9f, 0xa8, 0xe7, 0xde, 0x54, 0x4d, 0x55, 0x0f, 0xe7, 0x70, 0xf5, 0x88,
-	0x09, 0x03, 0x9e, 0x76, 0x9f, 0xb5, 0x7f, 0x08, 0x34, 0xaf, 0x85, 0xd0, 0x03, 0xa5, 0x9e, 0xb8,
-	0x9c, 0x28, 0x2d, 0x68, 0x17, 0x2a, 0x66, 0xa6, 0x65, 0x20, 0x46, 0x43, 0x87, 0x78, 0xa4, 0x53,
-	0x1f, 0x9c, 0x24, 0xa9, 0xdb, 0x18, 0xe7, 0xfc, 0x7d, 0x31, 0xf0, 0x3d, 0x42, 0xcf, 0xc1, 0x8e,
-	0xa5, 0xd4, 0xa3, 0xa1, 0xf3, 0x0f, 0xe1, 0xa3, 0x24, 0x75, 0x6b, 0x08, 0x8f, 0xb1, 0xe6, 0xc5,
-	0x4c, 0xfb, 0x50, 0x0e, 0x84, 0xd0, 0x4b, 0xc7, 0xf2, 0xac, 0x4e, 0xed, 0xd2, 0xf3, 0x77, 0xc6,
-	0xfe, 0xe1, 0xf5, 0x18, 0x6f, 0x17, 0x46, 0xaf, 0xf9, 0x0e, 0x6f, 0x3d, 0x40, 0x75, 0xdf, 0xd1,
-	0x33, 0xf8, 0x9f, 0xb7, 0x85, 0x58, 0x23, 0x49, 0xdd, 0x2a, 0xde, 0x95, 0x13, 0x1c, 0x27, 0x7a,
-	0x0a, 0xb6, 0x7c, 0x89, 0x23, 0xbd, 0x46, 0x21, 0x8b, 0x17, 0x89, 0x1e, 0x83, 0x65, 0xcc, 0xdc,
-	0xb1, 0xb0, 0xcc, 0x8f, 0xed, 0x15, 0x34, 0xef, 0x64, 0x20, 0xfe, 0xfc, 0x7b, 0x1f, 0xca, 0x33,
-	0x19, 0x88, 0xa5, 0x43, 0x0e, 0x1d, 0x0f, 0x31, 0x8c, 0x85, 0x23, 0xe2, 0xad, 0x0b, 0xa8, 0xee,
-	0x3b, 0xca, 0xc0, 0x9a, 0x44, 0xa2, 0x50, 0xac, 0x27, 0xa9, 0x5b, 0x41, 0xc5, 0x9b, 0x48, 0xf0,
-	0x7c, 0x18, 0x78, 0xdf, 0x5f, 0x8c, 0xbc, 0x65, 0x8c, 0xbc, 0x67, 0x8c, 0x6c, 0x32, 0x46, 0x3e,
-	0x33, 0x46, 0x5e, 0xb7, 0xac, 0xb4, 0xd9, 0xb2, 0xd2, 0xc7, 0x96, 0x95, 0x42, 0x1b, 0x1f, 0xe7,
-	0xea, 0x37, 0x00, 0x00, 0xff, 0xff, 0x28, 0xd9, 0xee, 0xa2, 0xe3, 0x01, 0x00, 0x00,
+	// 377 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x91, 0xcf, 0xaa, 0xd3, 0x40,
+	0x18, 0xc5, 0x3b, 0x37, 0xb7, 0xa1, 0x99, 0xfe, 0x51, 0x67, 0x21, 0x43, 0x85, 0x49, 0xec, 0xc6,
+	0x82, 0x34, 0x05, 0x85, 0xee, 0xad, 0x15, 0xec, 0xae, 0x0c, 0xee, 0x25, 0xc9, 0x8c, 0x6d, 0x30,
+	0x76, 0xc2, 0x64, 0x02, 0xf6, 0x2d, 0x7c, 0x03, 0x5f, 0x45, 0x5c, 0xb9, 0xec, 0x52, 0xb2, 0x08,
+	0x9a, 0xbe, 0x84, 0x4b, 0x99, 0x2f, 0xa1, 0xdc, 0xee, 0xe6, 0x9c, 0xf3, 0xcb, 0x7c, 0xdf, 0xc9,
+	0xe0, 0x51, 0x56, 0x18, 0xa5, 0x65, 0x98, 0x6b, 0x65, 0x14, 0x71, 0x8f, 0xd2, 0x84, 0x79, 0x3c,
+	0x5d, 0xec, 0x53, 0x73, 0x28, 0xe3, 0x30, 0x51, 0x5f, 0x96, 0x7b, 0xb5, 0x57, 0x4b, 0x88, 0xe3,
+	0xf2, 0x13, 0x28, 0x10, 0x70, 0x6a, 0x3f, 0x9b, 0xfd, 0xbc, 0xc3, 0x93, 0x37, 0x42, 0xe8, 0xb5,
+	0x52, 0x9f, 0xb9, 0x4c, 0x94, 0x16, 0x64, 0x81, 0x07, 0xe6, 0xa0, 0x65, 0x24, 0xb6, 0x1b, 0x8a,
+	0x02, 0x34, 0x1f, 0xad, 0x9f, 0x54, 0xb5, 0x3f, 0xde, 0x59, 0xfe, 0x43, 0x17, 0xf0, 0x2b, 0x42,
+	0x5e, 0x60, 0x37, 0x97, 0x52, 0x6f, 0x37, 0xf4, 0x0e, 0xe0, 0x47, 0x55, 0xed, 0x0f, 0x01, 0xde,
+	0x81, 0xcd, 0xbb, 0x98, 0xac, 0x70, 0x3f, 0x12, 0x42, 0x17, 0xd4, 0x09, 0x9c, 0xf9, 0xf0, 0x55,
+	0x10, 0xb6, 0x1b, 0x87, 0xb7, 0xe3, 0x41, 0xbe, 0x3b, 0x1a, 0x7d, 0xe2, 0x2d, 0x3e, 0xfd, 0x8e,
+	0xb0, 0x77, 0x35, 0xc9, 0x73, 0x7c, 0x6f, 0xed, 0x6e, 0xb3, 0x71, 0x55, 0xfb, 0x1e, 0x0c, 0xb3,
+	0x04, 0x87, 0x88, 0x3c, 0xc5, 0xae, 0xfc, 0x9a, 0xa7, 0xfa, 0x04, 0x1b, 0x39, 0xbc, 0x53, 0xe4,
+	0x31, 0x76, 0x8c, 0xc9, 0xa8, 0x03, 0xa6, 0x3d, 0x5a, 0xb2, 0x50, 0xa5, 0x4e, 0x24, 0xbd, 0x0f,
+	0xd0, 0xdc, 0xe3, 0x9d, 0x22, 0xcf, 0xb0, 0x97, 0x45, 0x85, 0xf9, 0x28, 0xd2, 0x28, 0xa3, 0x7d,
+	0xe0, 0x07, 0xd6, 0xd8, 0xa4, 0x51, 0x66, 0xaf, 0xd1, 0xc6, 0x50, 0xb7, 0xbd, 0x46, 0x1b, 0x33,
+	0x2b, 0xf1, 0xe4, 0xbd, 0x8c, 0xc4, 0x83, 0x7f, 0xb8, 0xc2, 0xfd, 0x83, 0x8c, 0x44, 0x41, 0xd1,
+	0x6d, 0xd7, 0x5b, 0x0c, 0x64, 0xd7, 0x15, 0xf0, 0xe9, 0x4b, 0xec, 0x5d, 0x3d, 0xc2, 0xb0, 0x93,
+	0xa4, 0xa2, 0x6b, 0x3a, 0xaa, 0x6a, 0x7f, 0x00, 0x4d, 0xdf, 0xa6, 0x82, 0xdb, 0x60, 0x1d, 0xfc,
+	0xfb, 0xcb, 0xd0, 0x8f, 0x86, 0xa1, 0x5f, 0x0d, 0x43, 0xe7, 0x86, 0xa1, 0x3f, 0x0d, 0x43, 0xdf,
+	0x2e, 0xac, 0x77, 0xbe, 0xb0, 0xde, 0xef, 0x0b, 0xeb, 0xc5, 0x2e, 0x3c, 0xf2, 0xeb, 0xff, 0x03,
+	0x00, 0x5e, 0x81, 0x03, 0xd7, 0x2b, 0x02, 0x00, 0x00,
 }
 
 func (m *AddrBookRecord) Marshal() (dAtA []byte, err error) {
@@ -331,6 +361,22 @@ func (m *AddrBookRecord_AddrEntry) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintLstore(dAtA, i, uint64(m.Ttl))
 	}
+	if len(m.Source) > 0 {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintLstore(dAtA, i, uint64(len(m.Source)))
+		i += copy(dAtA[i:], m.Source)
+	}
+	if m.LastDial != 0 {
+		dAtA[i] = 0x28
+		i++
+		i = encodeVarintLstore(dAtA, i, uint64(m.LastDial))
+	}
+	if m.Rtt != 0 {
+		dAtA[i] = 0x30
+		i++
+		i = encodeVarintLstore(dAtA, i, uint64(m.Rtt))
+	}
 	return i, nil
 }
 
@@ -428,6 +474,15 @@ func NewPopulatedAddrBookRecord_AddrEntry(r randyLstore, easy bool) *AddrBookRec
 	if r.Intn(2) == 0 {
 		this.Ttl *= -1
 	}
+	this.Source = string(randStringLstore(r))
+	this.LastDial = int64(r.Int63())
+	if r.Intn(2) == 0 {
+		this.LastDial *= -1
+	}
+	this.Rtt = int64(r.Int63())
+	if r.Intn(2) == 0 {
+		this.Rtt *= -1
+	}
 	if !easy && r.Intn(10) != 0 {
 	}
 	return this
@@ -566,6 +621,16 @@ func (m *AddrBookRecord_AddrEntry) Size() (n int) {
 	if m.Ttl != 0 {
 		n += 1 + sovLstore(uint64(m.Ttl))
 	}
+	l = len(m.Source)
+	if l > 0 {
+		n += 1 + l + sovLstore(uint64(l))
+	}
+	if m.LastDial != 0 {
+		n += 1 + sovLstore(uint64(m.LastDial))
+	}
+	if m.Rtt != 0 {
+		n += 1 + sovLstore(uint64(m.Rtt))
+	}
 	return n
 }
 
@@ -869,6 +934,76 @@ func (m *AddrBookRecord_AddrEntry) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Source", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLstore
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthLstore
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthLstore
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Source = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastDial", wireType)
+			}
+			m.LastDial = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLstore
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LastDial |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rtt", wireType)
+			}
+			m.Rtt = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLstore
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Rtt |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipLstore(dAtA[iNdEx:])
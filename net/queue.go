@@ -0,0 +1,267 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+var (
+	// QueueInterval is the interval between checks for queued pushes to retry.
+	QueueInterval = time.Second * 30
+
+	// MinRetryBackoff is the pause before the first retry of a failed push.
+	MinRetryBackoff = time.Second * 30
+
+	// MaxRetryBackoff is the maximum pause between retries of a failed push.
+	MaxRetryBackoff = time.Hour * 6
+
+	// MaxRetryAttempts is the number of failed attempts after which a
+	// queued push is dropped. Zero means no limit.
+	MaxRetryAttempts = 20
+
+	// MaxQueueAge is the duration after which a queued push still failing
+	// is dropped. Zero means no limit.
+	MaxQueueAge = time.Hour * 72
+
+	// queuePrefix is the datastore namespace of queued pushes.
+	queuePrefix = ds.NewKey("/net/queue")
+)
+
+func init() {
+	cbornode.RegisterCborType(queueEntry{})
+}
+
+// queueEntry is the stored form of a queued push, encoded with CBOR.
+type queueEntry struct {
+	Log      []byte
+	Attempts int
+	Next     int64
+	Added    int64
+}
+
+// queuedPush is a record still to be pushed to a peer.
+type queuedPush struct {
+	thread   thread.ID
+	peer     peer.ID
+	log      thread.LogID
+	record   cid.Cid
+	attempts int
+}
+
+// pushQueue keeps track of records that could not be pushed to peers of
+// their thread. Entries are keyed by thread, peer and record, so that the
+// queue can be inspected and cleared per thread.
+type pushQueue struct {
+	ds ds.Datastore
+}
+
+func newPushQueue(store ds.Datastore) *pushQueue {
+	return &pushQueue{ds: store}
+}
+
+// add queues the record for the peer, or postpones the next attempt if
+// the record is already queued. Records failing for more than
+// MaxRetryAttempts or MaxQueueAge are dropped instead.
+func (q *pushQueue) add(id thread.ID, pid peer.ID, lid thread.LogID, rid cid.Cid) error {
+	key := queueKey(id, pid, rid)
+	now := time.Now()
+	var e queueEntry
+	data, err := q.ds.Get(key)
+	switch err {
+	case nil:
+		if err := cbornode.DecodeInto(data, &e); err != nil {
+			return err
+		}
+	case ds.ErrNotFound:
+		e.Log = []byte(lid)
+	default:
+		return err
+	}
+	if e.Added == 0 {
+		// entries queued before ages were recorded start aging now
+		e.Added = now.UnixNano()
+	}
+	if exhausted(e, now) {
+		log.Warnf("dropping push of %s to %s after %d attempts", rid, pid, e.Attempts)
+		return q.ds.Delete(key)
+	}
+	e.Next = now.Add(retryBackoff(e.Attempts)).UnixNano()
+	e.Attempts++
+	if data, err = cbornode.DumpObject(e); err != nil {
+		return err
+	}
+	return q.ds.Put(key, data)
+}
+
+// remove drops the record from the queue of the peer.
+func (q *pushQueue) remove(id thread.ID, pid peer.ID, rid cid.Cid) error {
+	return q.ds.Delete(queueKey(id, pid, rid))
+}
+
+// due returns pushes whose next attempt is before now.
+func (q *pushQueue) due(now time.Time) ([]queuedPush, error) {
+	res, err := q.ds.Query(query.Query{Prefix: queuePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var pushes []queuedPush
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var e queueEntry
+		if err := cbornode.DecodeInto(r.Value, &e); err != nil {
+			return nil, err
+		}
+		if e.Next > now.UnixNano() {
+			continue
+		}
+		p, err := parseQueueKey(ds.RawKey(r.Key))
+		if err != nil {
+			return nil, err
+		}
+		if p.log, err = thread.LogIDFromBytes(e.Log); err != nil {
+			return nil, err
+		}
+		p.attempts = e.Attempts
+		pushes = append(pushes, p)
+	}
+	return pushes, nil
+}
+
+// depth returns the number of queued pushes of the thread.
+func (q *pushQueue) depth(id thread.ID) (int, error) {
+	res, err := q.ds.Query(query.Query{
+		Prefix:   queuePrefix.ChildString(id.String()).String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// clear drops all queued pushes of the thread.
+func (q *pushQueue) clear(id thread.ID) error {
+	res, err := q.ds.Query(query.Query{
+		Prefix:   queuePrefix.ChildString(id.String()).String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := q.ds.Delete(ds.RawKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exhausted reports whether the queued push exceeds MaxRetryAttempts or
+// MaxQueueAge.
+func exhausted(e queueEntry, now time.Time) bool {
+	if MaxRetryAttempts > 0 && e.Attempts >= MaxRetryAttempts {
+		return true
+	}
+	return MaxQueueAge > 0 && now.Sub(time.Unix(0, e.Added)) > MaxQueueAge
+}
+
+// retryBackoff returns the pause before the next attempt, doubling with
+// every failed attempt up to MaxRetryBackoff.
+func retryBackoff(attempts int) time.Duration {
+	backoff := MinRetryBackoff
+	for i := 0; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= MaxRetryBackoff {
+			return MaxRetryBackoff
+		}
+	}
+	return backoff
+}
+
+func queueKey(id thread.ID, pid peer.ID, rid cid.Cid) ds.Key {
+	return queuePrefix.ChildString(id.String()).ChildString(pid.String()).ChildString(rid.String())
+}
+
+func parseQueueKey(key ds.Key) (p queuedPush, err error) {
+	parts := key.List()
+	if len(parts) != 5 {
+		return p, fmt.Errorf("invalid queue key %s", key)
+	}
+	if p.thread, err = thread.Decode(parts[2]); err != nil {
+		return
+	}
+	if p.peer, err = peer.Decode(parts[3]); err != nil {
+		return
+	}
+	p.record, err = cid.Decode(parts[4])
+	return
+}
+
+// retryPushes periodically pushes queued records to peers that were
+// unreachable, until the net is closed.
+func (n *net) retryPushes() {
+	tick := time.NewTicker(QueueInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-tick.C:
+		}
+		pushes, err := n.queue.due(time.Now())
+		if err != nil {
+			log.Errorf("error listing queued pushes: %v", err)
+			continue
+		}
+		for _, p := range pushes {
+			if err := n.retryPush(n.ctx, p); err != nil {
+				log.Errorf("error retrying push of %s to %s: %v", p.record, p.peer, err)
+			}
+		}
+	}
+}
+
+// retryPush pushes a queued record to its peer, postponing the next attempt on failure.
+func (n *net) retryPush(ctx context.Context, p queuedPush) error {
+	rec, err := n.getRecord(ctx, p.thread, p.record)
+	if err != nil {
+		// the record or its thread is gone
+		log.Debugf("dropping queued push of %s: %v", p.record, err)
+		return n.queue.remove(p.thread, p.peer, p.record)
+	}
+	req, err := n.server.pushRecordRequest(ctx, p.thread, p.log, rec)
+	if err != nil {
+		return err
+	}
+	if err := n.server.pushRecordToPeer(p.thread, p.log, p.peer, req); err != nil {
+		log.Debugf("retry %d of %s failed: %v", p.attempts, p.record, err)
+		return n.queue.add(p.thread, p.peer, p.log, p.record)
+	}
+	return n.queue.remove(p.thread, p.peer, p.record)
+}
+
+// QueueDepth returns the number of records of the thread still to be
+// pushed to peers that were unreachable.
+func (n *net) QueueDepth(id thread.ID) (int, error) {
+	return n.queue.depth(id)
+}
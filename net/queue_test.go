@@ -0,0 +1,145 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pt "github.com/libp2p/go-libp2p-core/test"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+func TestPushQueue(t *testing.T) {
+	q := newPushQueue(syncds.MutexWrap(ds.NewMapDatastore()))
+	tid, other := thread.NewIDV1(thread.Raw, 32), thread.NewIDV1(thread.Raw, 32)
+	pid, lid := randPeerID(t), thread.LogIDFromPeer(randPeerID(t))
+	r1, r2 := generateRecord([]byte("r1"), cid.Undef).Cid(), generateRecord([]byte("r2"), cid.Undef).Cid()
+
+	if err := q.add(tid, pid, lid, r1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.add(tid, pid, lid, r2); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.add(other, pid, lid, r1); err != nil {
+		t.Fatal(err)
+	}
+	// retrying a queued record postpones it
+	if err := q.add(tid, pid, lid, r1); err != nil {
+		t.Fatal(err)
+	}
+
+	if depth, err := q.depth(tid); err != nil {
+		t.Fatal(err)
+	} else if depth != 2 {
+		t.Fatalf("expected queue depth 2, got %d", depth)
+	}
+
+	due, err := q.due(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("expected no due pushes, got %d", len(due))
+	}
+	due, err = q.due(time.Now().Add(MinRetryBackoff * 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 3 {
+		t.Fatalf("expected 3 due pushes, got %d", len(due))
+	}
+	for _, p := range due {
+		if p.peer != pid || p.log != lid {
+			t.Fatalf("unexpected push %v", p)
+		}
+		if p.thread == tid && p.record == r1 && p.attempts != 2 {
+			t.Fatalf("expected 2 attempts, got %d", p.attempts)
+		}
+	}
+
+	if err := q.remove(tid, pid, r2); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.clear(other); err != nil {
+		t.Fatal(err)
+	}
+	if depth, err := q.depth(other); err != nil {
+		t.Fatal(err)
+	} else if depth != 0 {
+		t.Fatalf("expected empty queue, got %d", depth)
+	}
+	if depth, err := q.depth(tid); err != nil {
+		t.Fatal(err)
+	} else if depth != 1 {
+		t.Fatalf("expected queue depth 1, got %d", depth)
+	}
+}
+
+func TestPushQueueLimits(t *testing.T) {
+	q := newPushQueue(syncds.MutexWrap(ds.NewMapDatastore()))
+	tid, pid := thread.NewIDV1(thread.Raw, 32), randPeerID(t)
+	lid := thread.LogIDFromPeer(randPeerID(t))
+	r1, r2 := generateRecord([]byte("r1"), cid.Undef).Cid(), generateRecord([]byte("r2"), cid.Undef).Cid()
+
+	attempts, age := MaxRetryAttempts, MaxQueueAge
+	defer func() { MaxRetryAttempts, MaxQueueAge = attempts, age }()
+	MaxRetryAttempts = 3
+
+	for i := 0; i < MaxRetryAttempts; i++ {
+		if err := q.add(tid, pid, lid, r1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if depth, err := q.depth(tid); err != nil {
+		t.Fatal(err)
+	} else if depth != 1 {
+		t.Fatalf("expected queue depth 1, got %d", depth)
+	}
+	// the push failing once more is dropped
+	if err := q.add(tid, pid, lid, r1); err != nil {
+		t.Fatal(err)
+	}
+	if depth, err := q.depth(tid); err != nil {
+		t.Fatal(err)
+	} else if depth != 0 {
+		t.Fatalf("expected push to be dropped after %d attempts, got depth %d", MaxRetryAttempts, depth)
+	}
+
+	MaxRetryAttempts, MaxQueueAge = 0, time.Millisecond
+	if err := q.add(tid, pid, lid, r2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 5)
+	if err := q.add(tid, pid, lid, r2); err != nil {
+		t.Fatal(err)
+	}
+	if depth, err := q.depth(tid); err != nil {
+		t.Fatal(err)
+	} else if depth != 0 {
+		t.Fatalf("expected push to be dropped after %s, got depth %d", MaxQueueAge, depth)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	if b := retryBackoff(0); b != MinRetryBackoff {
+		t.Fatalf("expected first backoff %s, got %s", MinRetryBackoff, b)
+	}
+	if b := retryBackoff(2); b != MinRetryBackoff*4 {
+		t.Fatalf("expected backoff %s, got %s", MinRetryBackoff*4, b)
+	}
+	if b := retryBackoff(100); b != MaxRetryBackoff {
+		t.Fatalf("expected backoff to be capped at %s, got %s", MaxRetryBackoff, b)
+	}
+}
+
+func randPeerID(t *testing.T) peer.ID {
+	pid, err := pt.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pid
+}
@@ -5,8 +5,8 @@ import (
 	"sync"
 
 	"github.com/ipfs/go-cid"
-	"github.com/libp2p/go-libp2p-core/peer"
 	core "github.com/textileio/go-threads/core/net"
+	"github.com/textileio/go-threads/core/thread"
 )
 
 type linkedRecord interface {
@@ -16,16 +16,16 @@ type linkedRecord interface {
 
 // Collector maintains an ordered list of records from multiple sources (thread-safe)
 type recordCollector struct {
-	rs   map[peer.ID]*recordSequence
+	rs   map[thread.LogID]*recordSequence
 	lock sync.Mutex
 }
 
 func newRecordCollector() *recordCollector {
-	return &recordCollector{rs: make(map[peer.ID]*recordSequence)}
+	return &recordCollector{rs: make(map[thread.LogID]*recordSequence)}
 }
 
 // Store the record of the log.
-func (r *recordCollector) Store(lid peer.ID, rec core.Record) {
+func (r *recordCollector) Store(lid thread.LogID, rec core.Record) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
@@ -39,11 +39,11 @@ func (r *recordCollector) Store(lid peer.ID, rec core.Record) {
 }
 
 // List all previously stored records in a proper order if the latter exists.
-func (r *recordCollector) List() (map[peer.ID][]core.Record, error) {
+func (r *recordCollector) List() (map[thread.LogID][]core.Record, error) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	logSeqs := make(map[peer.ID][]core.Record, len(r.rs))
+	logSeqs := make(map[thread.LogID][]core.Record, len(r.rs))
 	for id, seq := range r.rs {
 		ordered, ok := seq.List()
 		if !ok {
@@ -162,9 +162,9 @@ func (s *server) GetRecords(ctx context.Context, req *pb.GetRecordsRequest) (*pb
 		return pbrecs, err
 	}
 
-	reqd := make(map[peer.ID]*pb.GetRecordsRequest_Body_LogEntry)
+	reqd := make(map[thread.LogID]*pb.GetRecordsRequest_Body_LogEntry)
 	for _, l := range req.Body.Logs {
-		reqd[l.LogID.ID] = l
+		reqd[thread.LogIDFromPeer(l.LogID.ID)] = l
 	}
 	info, err := s.net.store.GetThread(req.Body.ThreadID.ID)
 	if err != nil {
@@ -190,7 +190,7 @@ func (s *server) GetRecords(ctx context.Context, req *pb.GetRecordsRequest) (*pb
 		}
 
 		entry := &pb.GetRecordsReply_LogEntry{
-			LogID:   &pb.ProtoPeerID{ID: lg.ID},
+			LogID:   &pb.ProtoPeerID{ID: lg.ID.Peer()},
 			Records: make([]*pb.Log_Record, len(recs)),
 			Log:     pblg,
 		}
@@ -217,7 +217,8 @@ func (s *server) PushRecord(ctx context.Context, req *pb.PushRecordRequest) (*pb
 	log.Debugf("received push record request from %s", pid)
 
 	// A log is required to accept new records
-	logpk, err := s.net.store.PubKey(req.Body.ThreadID.ID, req.Body.LogID.ID)
+	lid := thread.LogIDFromPeer(req.Body.LogID.ID)
+	logpk, err := s.net.store.PubKey(req.Body.ThreadID.ID, lid)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -241,10 +242,18 @@ func (s *server) PushRecord(ctx context.Context, req *pb.PushRecordRequest) (*pb
 		return &pb.PushRecordReply{}, nil
 	}
 
+	revoked, err := s.net.store.IsRevoked(req.Body.ThreadID.ID, lid)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if revoked {
+		return nil, status.Error(codes.PermissionDenied, lstore.ErrLogRevoked.Error())
+	}
+
 	if err = rec.Verify(logpk); err != nil {
 		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
-	if err = s.net.PutRecord(ctx, req.Body.ThreadID.ID, req.Body.LogID.ID, rec); err != nil {
+	if err = s.net.PutRecord(ctx, req.Body.ThreadID.ID, lid, rec); err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	return &pb.PushRecordReply{}, nil
@@ -295,7 +304,7 @@ func verifyRequest(header *pb.Header, body proto.Marshaler) (pid peer.ID, err er
 // logToProto returns a proto log from a thread log.
 func logToProto(l thread.LogInfo) *pb.Log {
 	return &pb.Log{
-		ID:     &pb.ProtoPeerID{ID: l.ID},
+		ID:     &pb.ProtoPeerID{ID: l.ID.Peer()},
 		PubKey: &pb.ProtoPubKey{PubKey: l.PubKey},
 		Addrs:  addrsToProto(l.Addrs),
 		Head:   &pb.ProtoCid{Cid: l.Head},
@@ -305,7 +314,7 @@ func logToProto(l thread.LogInfo) *pb.Log {
 // logFromProto returns a thread log from a proto log.
 func logFromProto(l *pb.Log) thread.LogInfo {
 	return thread.LogInfo{
-		ID:     l.ID.ID,
+		ID:     thread.LogIDFromPeer(l.ID.ID),
 		PubKey: l.PubKey.PubKey,
 		Addrs:  addrsFromProto(l.Addrs),
 		Head:   l.Head.Cid,
@@ -1,11 +1,15 @@
 package test
 
 import (
+	"crypto/rand"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/record"
 	ma "github.com/multiformats/go-multiaddr"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
@@ -22,6 +26,10 @@ var addressBookSuite = map[string]func(book core.AddrBook) func(*testing.T){
 	"LogsWithAddresses":    testLogsWithAddrs,
 	"ThreadsWithAddresses": testThreadsFromAddrs,
 	"ExportAddressBook":    testExportAddressBook,
+	"AddressSources":       testAddrSources,
+	"CertifiedAddresses":   testCertifiedAddrs,
+	"AddressQuality":       testAddrQuality,
+	"ForEachAddress":       testForEachLogAddr,
 }
 
 type AddrBookFactory func() (core.AddrBook, func())
@@ -46,7 +54,7 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
 		t.Run("add a single address", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 			addrs := GenerateAddrs(1)
 
 			check(t, ab.AddAddr(tid, id, addrs[0], time.Hour))
@@ -54,7 +62,7 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 		})
 
 		t.Run("idempotent add single address", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 			addrs := GenerateAddrs(1)
 
 			check(t, ab.AddAddr(tid, id, addrs[0], time.Hour))
@@ -64,7 +72,7 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 		})
 
 		t.Run("add multiple addresses", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 			addrs := GenerateAddrs(3)
 
 			check(t, ab.AddAddrs(tid, id, addrs, time.Hour))
@@ -72,7 +80,7 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 		})
 
 		t.Run("idempotent add multiple addresses", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 			addrs := GenerateAddrs(3)
 
 			check(t, ab.AddAddrs(tid, id, addrs, time.Hour))
@@ -82,7 +90,7 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 		})
 
 		t.Run("adding an existing address with a later expiration extends its ttl", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 			addrs := GenerateAddrs(3)
 
 			check(t, ab.AddAddrs(tid, id, addrs, time.Second))
@@ -101,7 +109,7 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 		})
 
 		t.Run("adding an existing address with an earlier expiration never reduces the expiration", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 			addrs := GenerateAddrs(3)
 
 			check(t, ab.AddAddrs(tid, id, addrs, time.Hour))
@@ -116,7 +124,7 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 		})
 
 		t.Run("adding an existing address with an earlier expiration never reduces the TTL", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 			addrs := GenerateAddrs(1)
 
 			check(t, ab.AddAddrs(tid, id, addrs, 4*time.Second))
@@ -138,11 +146,46 @@ func testAddAddress(ab core.AddrBook) func(*testing.T) {
 	}
 }
 
+func testForEachLogAddr(ab core.AddrBook) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+
+		ids := GenerateLogIDs(2)
+		addrs := GenerateAddrs(5)
+
+		check(t, ab.AddAddrs(tid, ids[0], addrs[:4], time.Hour))
+		check(t, ab.AddAddr(tid, ids[0], addrs[4], 100*time.Microsecond))
+		<-time.After(100 * time.Millisecond)
+
+		var visited []ma.Multiaddr
+		check(t, ab.ForEachLogAddr(tid, ids[0], func(addr ma.Multiaddr) bool {
+			visited = append(visited, addr)
+			return true
+		}))
+		AssertAddressesEqual(t, addrs[:4], visited)
+
+		// iteration stops once fn returns false
+		var calls int
+		check(t, ab.ForEachLogAddr(tid, ids[0], func(ma.Multiaddr) bool {
+			calls++
+			return false
+		}))
+		if calls != 1 {
+			t.Fatalf("expected iteration to stop after the first address, got %d calls", calls)
+		}
+
+		check(t, ab.ForEachLogAddr(tid, ids[1], func(addr ma.Multiaddr) bool {
+			t.Fatalf("unexpected address %s of unknown log", addr)
+			return true
+		}))
+	}
+}
+
 func testClearWorks(ab core.AddrBook) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		ids := GeneratePeerIDs(2)
+		ids := GenerateLogIDs(2)
 		addrs := GenerateAddrs(5)
 
 		check(t, ab.AddAddrs(tid, ids[0], addrs[0:3], time.Hour))
@@ -165,7 +208,7 @@ func testSetNegativeTTLClears(ab core.AddrBook) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		id := GeneratePeerIDs(1)[0]
+		id := GenerateLogIDs(1)[0]
 		addrs := GenerateAddrs(100)
 
 		check(t, ab.SetAddrs(tid, id, addrs, time.Hour))
@@ -188,14 +231,14 @@ func testUpdateTTLs(ab core.AddrBook) func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
 		t.Run("update ttl of log with no addrs", func(t *testing.T) {
-			id := GeneratePeerIDs(1)[0]
+			id := GenerateLogIDs(1)[0]
 
 			// Shouldn't panic.
 			check(t, ab.UpdateAddrs(tid, id, time.Hour, time.Minute))
 		})
 
 		t.Run("update ttls successfully", func(t *testing.T) {
-			ids := GeneratePeerIDs(2)
+			ids := GenerateLogIDs(2)
 			addrs1, addrs2 := GenerateAddrs(2), GenerateAddrs(2)
 
 			// set two keys with different ttls for each log.
@@ -243,7 +286,7 @@ func testNilAddrsDontBreak(ab core.AddrBook) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		id := GeneratePeerIDs(1)[0]
+		id := GenerateLogIDs(1)[0]
 
 		check(t, ab.SetAddr(tid, id, nil, time.Hour))
 		check(t, ab.AddAddr(tid, id, nil, time.Hour))
@@ -254,7 +297,7 @@ func testAddressesExpire(ab core.AddrBook) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		ids := GeneratePeerIDs(2)
+		ids := GenerateLogIDs(2)
 		addrs1 := GenerateAddrs(3)
 		addrs2 := GenerateAddrs(2)
 
@@ -301,7 +344,7 @@ func testClearWithIterator(ab core.AddrBook) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		ids := GeneratePeerIDs(2)
+		ids := GenerateLogIDs(2)
 		addrs := GenerateAddrs(100)
 
 		// Add the logs with 50 addresses each.
@@ -341,7 +384,7 @@ func testLogsWithAddrs(ab core.AddrBook) func(t *testing.T) {
 		})
 
 		t.Run("non-empty addrbook", func(t *testing.T) {
-			ids := GeneratePeerIDs(2)
+			ids := GenerateLogIDs(2)
 			addrs := GenerateAddrs(10)
 
 			err := ab.AddAddrs(tid, ids[0], addrs[:5], pstore.PermanentAddrTTL)
@@ -372,7 +415,7 @@ func testThreadsFromAddrs(ab core.AddrBook) func(t *testing.T) {
 			tids := make([]thread.ID, 3)
 			for i := range tids {
 				tids[i] = thread.NewIDV1(thread.Raw, 24)
-				ids := GeneratePeerIDs(2)
+				ids := GenerateLogIDs(2)
 				addrs := GenerateAddrs(4)
 
 				err := ab.AddAddrs(tids[i], ids[0], addrs[:2], pstore.PermanentAddrTTL)
@@ -393,7 +436,7 @@ func testExportAddressBook(ab core.AddrBook) func(*testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
 		t.Run("dump and restore", func(t *testing.T) {
-			ids := GeneratePeerIDs(2)
+			ids := GenerateLogIDs(2)
 			addrs := GenerateAddrs(2)
 
 			check(t, ab.AddAddr(tid, ids[0], addrs[0], time.Hour))
@@ -413,7 +456,221 @@ func testExportAddressBook(ab core.AddrBook) func(*testing.T) {
 	}
 }
 
-func checkedAddrs(t *testing.T, ab core.AddrBook, tid thread.ID, id peer.ID) []ma.Multiaddr {
+func testAddrSources(ab core.AddrBook) func(*testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+
+		t.Run("record sources", func(t *testing.T) {
+			id := GenerateLogIDs(1)[0]
+			addrs := GenerateAddrs(3)
+
+			check(t, ab.AddAddrsFromSource(tid, id, addrs[:1], time.Hour, core.AddrSourceManual))
+			check(t, ab.AddAddrsFromSource(tid, id, addrs[1:2], time.Hour, core.AddrSourcePubsub))
+			check(t, ab.AddAddrs(tid, id, addrs[2:], time.Hour))
+
+			AssertAddressesEqual(t, addrs, checkedAddrs(t, ab, tid, id))
+			assertAddrSources(t, ab, tid, id, map[string]core.AddrSource{
+				addrs[0].String(): core.AddrSourceManual,
+				addrs[1].String(): core.AddrSourcePubsub,
+				addrs[2].String(): core.AddrSourceUnknown,
+			})
+		})
+
+		t.Run("known source is kept or replaced", func(t *testing.T) {
+			id := GenerateLogIDs(1)[0]
+			addrs := GenerateAddrs(2)
+
+			check(t, ab.AddAddrsFromSource(tid, id, addrs, time.Hour, core.AddrSourceDHT))
+			check(t, ab.AddAddrs(tid, id, addrs[:1], 2*time.Hour))
+			check(t, ab.SetAddrs(tid, id, addrs[:1], time.Hour))
+			check(t, ab.AddAddrsFromSource(tid, id, addrs[1:], time.Hour, core.AddrSourceDial))
+
+			assertAddrSources(t, ab, tid, id, map[string]core.AddrSource{
+				addrs[0].String(): core.AddrSourceDHT,
+				addrs[1].String(): core.AddrSourceDial,
+			})
+		})
+
+		t.Run("dump and restore", func(t *testing.T) {
+			id := GenerateLogIDs(1)[0]
+			addrs := GenerateAddrs(1)
+
+			check(t, ab.AddAddrsFromSource(tid, id, addrs, time.Hour, core.AddrSourceDHT))
+			dump, err := ab.DumpAddrs()
+			check(t, err)
+			check(t, ab.ClearAddrs(tid, id))
+			check(t, ab.RestoreAddrs(dump))
+
+			assertAddrSources(t, ab, tid, id, map[string]core.AddrSource{
+				addrs[0].String(): core.AddrSourceDHT,
+			})
+		})
+	}
+}
+
+func testCertifiedAddrs(ab core.AddrBook) func(*testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		check(t, err)
+		lid, err := thread.LogIDFromPrivKey(sk)
+		check(t, err)
+		addrs := GenerateAddrs(4)
+
+		seal := func(t *testing.T, key crypto.PrivKey, seq uint64, addrs []ma.Multiaddr) *record.Envelope {
+			rec := peer.NewPeerRecord()
+			rec.PeerID = lid.Peer()
+			rec.Seq = seq
+			rec.Addrs = addrs
+			env, err := record.Seal(rec, key)
+			check(t, err)
+			return env
+		}
+		consume := func(t *testing.T, env *record.Envelope, expected bool) {
+			accepted, err := ab.ConsumeLogRecord(tid, env, time.Hour)
+			check(t, err)
+			if accepted != expected {
+				t.Fatalf("expected record acceptance to be %v", expected)
+			}
+		}
+		assertRecord := func(t *testing.T, expected *record.Envelope) {
+			env, err := ab.LogRecord(tid, lid)
+			check(t, err)
+			if expected == nil && env != nil {
+				t.Fatal("expected no signed record")
+			}
+			if expected != nil && (env == nil || !env.Equal(expected)) {
+				t.Fatal("signed record doesn't match")
+			}
+		}
+
+		check(t, ab.AddAddrs(tid, lid, addrs[:1], time.Hour))
+		assertRecord(t, nil)
+
+		first := seal(t, sk, 1, addrs[1:3])
+		consume(t, first, true)
+		AssertAddressesEqual(t, addrs[1:3], checkedAddrs(t, ab, tid, lid))
+		assertRecord(t, first)
+
+		t.Run("uncertified addresses are ignored", func(t *testing.T) {
+			check(t, ab.AddAddrs(tid, lid, addrs[3:], time.Hour))
+			check(t, ab.SetAddrs(tid, lid, addrs[3:], time.Hour))
+			check(t, ab.SetAddrs(tid, lid, addrs[1:2], 2*time.Hour))
+			AssertAddressesEqual(t, addrs[1:3], checkedAddrs(t, ab, tid, lid))
+		})
+
+		t.Run("stale and foreign records are rejected", func(t *testing.T) {
+			consume(t, seal(t, sk, 1, addrs[3:]), false)
+			other, _, err := crypto.GenerateEd25519Key(rand.Reader)
+			check(t, err)
+			if _, err := ab.ConsumeLogRecord(tid, seal(t, other, 2, addrs[3:]), time.Hour); !errors.Is(err, core.ErrInvalidLogRecord) {
+				t.Fatalf("expected invalid record error, got %v", err)
+			}
+			AssertAddressesEqual(t, addrs[1:3], checkedAddrs(t, ab, tid, lid))
+			assertRecord(t, first)
+		})
+
+		second := seal(t, sk, 2, addrs[3:])
+		t.Run("newer record replaces addresses", func(t *testing.T) {
+			consume(t, second, true)
+			AssertAddressesEqual(t, addrs[3:], checkedAddrs(t, ab, tid, lid))
+			assertRecord(t, second)
+		})
+
+		t.Run("dump and restore", func(t *testing.T) {
+			dump, err := ab.DumpAddrs()
+			check(t, err)
+			check(t, ab.ClearAddrs(tid, lid))
+			assertRecord(t, nil)
+			check(t, ab.RestoreAddrs(dump))
+			AssertAddressesEqual(t, addrs[3:], checkedAddrs(t, ab, tid, lid))
+			assertRecord(t, second)
+		})
+
+		t.Run("clearing drops the record", func(t *testing.T) {
+			check(t, ab.ClearAddrs(tid, lid))
+			assertRecord(t, nil)
+			check(t, ab.AddAddrs(tid, lid, addrs[:1], time.Hour))
+			AssertAddressesEqual(t, addrs[:1], checkedAddrs(t, ab, tid, lid))
+		})
+	}
+}
+
+func testAddrQuality(ab core.AddrBook) func(*testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		id := GenerateLogIDs(1)[0]
+		addrs := GenerateAddrs(4)
+
+		check(t, ab.AddAddrs(tid, id, addrs, time.Hour))
+		check(t, ab.RecordDial(tid, id, addrs[2], 30*time.Millisecond))
+		check(t, ab.RecordDial(tid, id, addrs[3], 10*time.Millisecond))
+		check(t, ab.RecordDial(tid, id, GenerateAddrs(5)[4], time.Millisecond))
+
+		assertOrder := func(t *testing.T, expected []ma.Multiaddr) {
+			t.Helper()
+			sorted, err := ab.SortedAddrs(tid, id)
+			check(t, err)
+			if len(sorted) != len(addrs) {
+				t.Fatalf("expected %d addresses, got %d", len(addrs), len(sorted))
+			}
+			for i, a := range expected {
+				if !sorted[i].Equal(a) {
+					t.Fatalf("expected %s at position %d, got %s", a, i, sorted[i])
+				}
+			}
+		}
+
+		t.Run("dialed addresses first by latency", func(t *testing.T) {
+			assertOrder(t, []ma.Multiaddr{addrs[3], addrs[2]})
+		})
+
+		t.Run("quality survives updates", func(t *testing.T) {
+			check(t, ab.AddAddrs(tid, id, addrs, 2*time.Hour))
+			check(t, ab.SetAddrs(tid, id, addrs[2:], time.Hour))
+			assertOrder(t, []ma.Multiaddr{addrs[3], addrs[2]})
+
+			check(t, ab.RecordDial(tid, id, addrs[2], 5*time.Millisecond))
+			assertOrder(t, []ma.Multiaddr{addrs[2], addrs[3]})
+		})
+
+		t.Run("dump and restore", func(t *testing.T) {
+			dump, err := ab.DumpAddrs()
+			check(t, err)
+			check(t, ab.ClearAddrs(tid, id))
+			check(t, ab.RestoreAddrs(dump))
+
+			withQuality, err := ab.AddrsWithSource(tid, id)
+			check(t, err)
+			for _, a := range withQuality {
+				if a.Addr.Equal(addrs[2]) && (a.LastDial.IsZero() || a.RTT != 5*time.Millisecond) {
+					t.Fatalf("dial quality of %s is lost", a.Addr)
+				}
+			}
+			assertOrder(t, []ma.Multiaddr{addrs[2], addrs[3]})
+		})
+	}
+}
+
+func assertAddrSources(t *testing.T, ab core.AddrBook, tid thread.ID, id thread.LogID, expected map[string]core.AddrSource) {
+	t.Helper()
+	addrs, err := ab.AddrsWithSource(tid, id)
+	check(t, err)
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %d addresses, got %d", len(expected), len(addrs))
+	}
+	for _, a := range addrs {
+		src, ok := expected[a.Addr.String()]
+		if !ok {
+			t.Fatalf("unexpected address %s", a.Addr)
+		}
+		if a.Source != src {
+			t.Fatalf("expected source %q of %s, got %q", src, a.Addr, a.Source)
+		}
+	}
+}
+
+func checkedAddrs(t *testing.T, ab core.AddrBook, tid thread.ID, id thread.LogID) []ma.Multiaddr {
 	addrs, err := ab.Addrs(tid, id)
 	if err != nil {
 		t.Fatal("error when getting addresses")
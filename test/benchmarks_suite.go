@@ -6,7 +6,9 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/libp2p/go-libp2p-core/crypto"
 	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 )
@@ -129,3 +131,123 @@ func benchmarkGet1000LogsWithAddrs(ls core.Logstore, addrs chan *logpair) func(*
 		}
 	}
 }
+
+// BenchmarkScales are the numbers of logs held by the logstore in
+// BenchmarkLogstoreScale. Scales above 1000 are skipped in short mode.
+var BenchmarkScales = []int{1000, 100000, 1000000}
+
+// logsPerThread is the number of logs of each thread in scale benchmarks.
+const logsPerThread = 10
+
+type threadLog struct {
+	thread thread.ID
+	id     thread.LogID
+}
+
+var threadstoreScaleBenchmarks = map[string]func(core.Logstore, []threadLog) func(*testing.B){
+	"AddLogAddr": benchmarkAddLogAddr,
+	"LogAddrs":   benchmarkLogAddrs,
+	"PubKey":     benchmarkScalePubKey,
+	"ServiceKey": benchmarkScaleServiceKey,
+	"Threads":    benchmarkThreads,
+}
+
+// BenchmarkLogstoreScale measures operations on a logstore filled with as
+// many logs as each of BenchmarkScales, with 10 logs per thread.
+func BenchmarkLogstoreScale(b *testing.B, factory LogstoreFactory, variant string) {
+	ordernames := make([]string, 0, len(threadstoreScaleBenchmarks))
+	for name := range threadstoreScaleBenchmarks {
+		ordernames = append(ordernames, name)
+	}
+	sort.Strings(ordernames)
+
+	for _, n := range BenchmarkScales {
+		if n > 1000 && testing.Short() {
+			b.Logf("skipping scale %d in short mode", n)
+			continue
+		}
+		ls, closeFunc := factory()
+		logs := populateLogstore(b, ls, n)
+
+		for _, name := range ordernames {
+			b.Run(fmt.Sprintf("%s-%dLogs-%s", name, n, variant), threadstoreScaleBenchmarks[name](ls, logs))
+		}
+
+		if closeFunc != nil {
+			closeFunc()
+		}
+	}
+}
+
+func populateLogstore(b *testing.B, ls core.Logstore, n int) []threadLog {
+	b.Helper()
+	logs := make([]threadLog, 0, n)
+	var tid thread.ID
+	for i := 0; i < n; i++ {
+		if i%logsPerThread == 0 {
+			tid = thread.NewIDV1(thread.Raw, 32)
+			if err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}); err != nil {
+				b.Fatal(err)
+			}
+		}
+		_, pk, err := crypto.GenerateEd25519Key(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		id, err := thread.NewLogID(pk)
+		if err != nil {
+			b.Fatal(err)
+		}
+		addr := Multiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", i%65536))
+		if err := ls.AddLog(tid, thread.LogInfo{ID: id, PubKey: pk, Addrs: []ma.Multiaddr{addr}}); err != nil {
+			b.Fatal(err)
+		}
+		logs = append(logs, threadLog{thread: tid, id: id})
+	}
+	return logs
+}
+
+func benchmarkAddLogAddr(ls core.Logstore, logs []threadLog) func(*testing.B) {
+	return func(b *testing.B) {
+		addrs := GenerateAddrs(256)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			l := logs[i%len(logs)]
+			_ = ls.AddAddr(l.thread, l.id, addrs[i%len(addrs)], pstore.PermanentAddrTTL)
+		}
+	}
+}
+
+func benchmarkLogAddrs(ls core.Logstore, logs []threadLog) func(*testing.B) {
+	return func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			l := logs[i%len(logs)]
+			_, _ = ls.Addrs(l.thread, l.id)
+		}
+	}
+}
+
+func benchmarkScalePubKey(ls core.Logstore, logs []threadLog) func(*testing.B) {
+	return func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			l := logs[i%len(logs)]
+			_, _ = ls.PubKey(l.thread, l.id)
+		}
+	}
+}
+
+func benchmarkScaleServiceKey(ls core.Logstore, logs []threadLog) func(*testing.B) {
+	return func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ls.ServiceKey(logs[i%len(logs)].thread)
+		}
+	}
+}
+
+func benchmarkThreads(ls core.Logstore, _ []threadLog) func(*testing.B) {
+	return func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ls.Threads()
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	ma "github.com/multiformats/go-multiaddr"
+	mh "github.com/multiformats/go-multihash"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+)
+
+var (
+	// DiffTestSeed seeds the operations of LogstoreDiffTest. A zero value
+	// picks a random seed, which is logged to reproduce failures.
+	DiffTestSeed int64
+
+	// DiffTestOps is the number of operations run by LogstoreDiffTest.
+	DiffTestOps = 300
+)
+
+// diffCheckInterval is the number of operations between full comparisons.
+const diffCheckInterval = 10
+
+// LogstoreDiffTest runs the same random sequence of operations against
+// logstores of both factories and fails as soon as they disagree on the
+// outcome of an operation or on their observable state.
+func LogstoreDiffTest(t *testing.T, a, b LogstoreFactory) {
+	seed := DiffTestSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("seed %d", seed)
+
+	lsa, closeA := a()
+	if closeA != nil {
+		defer closeA()
+	}
+	lsb, closeB := b()
+	if closeB != nil {
+		defer closeB()
+	}
+
+	g := newDiffGen(rand.New(rand.NewSource(seed)))
+	for i := 0; i < DiffTestOps; i++ {
+		op := g.next()
+		errA, errB := op.apply(lsa), op.apply(lsb)
+		if (errA == nil) != (errB == nil) {
+			t.Fatalf("op %d %s: outcomes differ: %v != %v", i, op.name, errA, errB)
+		}
+		if errA == nil && op.commit != nil {
+			op.commit()
+		}
+		if i%diffCheckInterval == 0 || i == DiffTestOps-1 {
+			if err := compareLogstores(lsa, lsb); err != nil {
+				t.Fatalf("after op %d %s: %v", i, op.name, err)
+			}
+		}
+	}
+}
+
+type diffOp struct {
+	name   string
+	apply  func(core.Logstore) error
+	commit func()
+}
+
+// diffGen generates random operations, mostly on known threads and logs.
+type diffGen struct {
+	r       *rand.Rand
+	threads []thread.ID
+	logs    map[thread.ID][]thread.LogID
+	addrs   []ma.Multiaddr
+	heads   []cid.Cid
+}
+
+func newDiffGen(r *rand.Rand) *diffGen {
+	g := &diffGen{r: r, logs: make(map[thread.ID][]thread.LogID)}
+	for i := 0; i < 8; i++ {
+		g.addrs = append(g.addrs, Multiaddr(fmt.Sprintf("/ip4/1.2.3.%d/tcp/4006", i)))
+		hash, _ := mh.Sum([]byte(fmt.Sprintf("head %d", i)), mh.SHA2_256, -1)
+		g.heads = append(g.heads, cid.NewCidV1(cid.Raw, hash))
+	}
+	return g
+}
+
+func (g *diffGen) next() diffOp {
+	if len(g.threads) == 0 || g.r.Intn(10) == 0 {
+		return g.addThread()
+	}
+	tid := g.threads[g.r.Intn(len(g.threads))]
+	if g.r.Intn(20) == 0 {
+		// operations on unknown threads must fail or succeed alike
+		tid = thread.NewIDV1(thread.Raw, 24)
+	}
+	logs := g.logs[tid]
+	if len(logs) == 0 || g.r.Intn(6) == 0 {
+		return g.addLog(tid)
+	}
+	lid := logs[g.r.Intn(len(logs))]
+	addr := g.addrs[g.r.Intn(len(g.addrs))]
+	head := g.heads[g.r.Intn(len(g.heads))]
+	key := fmt.Sprintf("k%d", g.r.Intn(4))
+	if g.r.Intn(2) == 0 {
+		key = "app/" + key
+	}
+
+	switch g.r.Intn(12) {
+	case 0:
+		return diffOp{name: "AddAddr", apply: func(ls core.Logstore) error {
+			return ls.AddAddr(tid, lid, addr, time.Hour)
+		}}
+	case 1:
+		return diffOp{name: "RemoveAddr", apply: func(ls core.Logstore) error {
+			return ls.SetAddr(tid, lid, addr, 0)
+		}}
+	case 2:
+		return diffOp{name: "ClearAddrs", apply: func(ls core.Logstore) error {
+			return ls.ClearAddrs(tid, lid)
+		}}
+	case 3:
+		return diffOp{name: "AddHead", apply: func(ls core.Logstore) error {
+			return ls.AddHead(tid, lid, head)
+		}}
+	case 4:
+		return diffOp{name: "SetHead", apply: func(ls core.Logstore) error {
+			return ls.SetHead(tid, lid, head)
+		}}
+	case 5:
+		return diffOp{name: "ClearHeads", apply: func(ls core.Logstore) error {
+			return ls.ClearHeads(tid, lid)
+		}}
+	case 6:
+		val := fmt.Sprintf("v%d", g.r.Intn(100))
+		return diffOp{name: "PutString", apply: func(ls core.Logstore) error {
+			return ls.PutString(tid, "s/"+key, val)
+		}}
+	case 7:
+		val := g.r.Int63()
+		return diffOp{name: "PutInt64", apply: func(ls core.Logstore) error {
+			return ls.PutInt64(tid, "i/"+key, val)
+		}}
+	case 8:
+		prefix := []string{"s", "i", "s/app", "i/app"}[g.r.Intn(4)]
+		return diffOp{name: "DeleteMetaPrefix", apply: func(ls core.Logstore) error {
+			return ls.DeleteMetaPrefix(tid, prefix)
+		}}
+	case 9:
+		rk := thread.NewRandomKey().Read()
+		return diffOp{name: "AddReadKey", apply: func(ls core.Logstore) error {
+			return ls.AddReadKey(tid, rk)
+		}}
+	case 10:
+		return diffOp{name: "DeleteLog", apply: func(ls core.Logstore) error {
+			return ls.DeleteLog(tid, lid)
+		}, commit: func() {
+			g.removeLog(tid, lid)
+		}}
+	default:
+		if g.r.Intn(3) != 0 {
+			return g.addLog(tid)
+		}
+		return diffOp{name: "DeleteThread", apply: func(ls core.Logstore) error {
+			return ls.DeleteThread(tid)
+		}, commit: func() {
+			g.removeThread(tid)
+		}}
+	}
+}
+
+func (g *diffGen) addThread() diffOp {
+	key := thread.NewRandomKey()
+	if g.r.Intn(3) == 0 {
+		key = thread.NewRandomServiceKey()
+	}
+	info := thread.Info{ID: thread.NewIDV1(thread.Raw, 24), Key: key}
+	return diffOp{name: "AddThread", apply: func(ls core.Logstore) error {
+		return ls.AddThread(info)
+	}, commit: func() {
+		g.threads = append(g.threads, info.ID)
+	}}
+}
+
+func (g *diffGen) addLog(tid thread.ID) diffOp {
+	sk, pk, err := crypto.GenerateEd25519Key(g.r)
+	if err != nil {
+		panic(err)
+	}
+	lid, err := thread.NewLogID(pk)
+	if err != nil {
+		panic(err)
+	}
+	lg := thread.LogInfo{ID: lid, PubKey: pk}
+	if g.r.Intn(2) == 0 {
+		lg.PrivKey = sk
+	}
+	for i := g.r.Intn(3); i > 0; i-- {
+		lg.Addrs = append(lg.Addrs, g.addrs[g.r.Intn(len(g.addrs))])
+	}
+	if g.r.Intn(2) == 0 {
+		lg.Head = g.heads[g.r.Intn(len(g.heads))]
+	}
+	return diffOp{name: "AddLog", apply: func(ls core.Logstore) error {
+		return ls.AddLog(tid, lg)
+	}, commit: func() {
+		if _, ok := g.logs[tid]; !ok {
+			g.threads = append(g.threads, tid)
+		}
+		g.logs[tid] = append(g.logs[tid], lid)
+	}}
+}
+
+func (g *diffGen) removeLog(tid thread.ID, lid thread.LogID) {
+	logs := g.logs[tid]
+	for i, l := range logs {
+		if l == lid {
+			g.logs[tid] = append(logs[:i:i], logs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (g *diffGen) removeThread(tid thread.ID) {
+	delete(g.logs, tid)
+	for i, t := range g.threads {
+		if t.Equals(tid) {
+			g.threads = append(g.threads[:i:i], g.threads[i+1:]...)
+			return
+		}
+	}
+}
+
+// compareLogstores returns an error describing the first difference in the
+// observable state of the logstores.
+func compareLogstores(a, b core.Logstore) error {
+	tidsA, err := sortedThreads(a)
+	if err != nil {
+		return err
+	}
+	tidsB, err := sortedThreads(b)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(tidsA, tidsB) {
+		return fmt.Errorf("threads differ: %v != %v", tidsA, tidsB)
+	}
+	for _, tid := range tidsA {
+		sa, err := threadState(a, tid)
+		if err != nil {
+			return err
+		}
+		sb, err := threadState(b, tid)
+		if err != nil {
+			return err
+		}
+		if sa != sb {
+			return fmt.Errorf("thread %s differs:\n%s\n!=\n%s", tid, sa, sb)
+		}
+	}
+	return nil
+}
+
+func sortedThreads(ls core.Logstore) ([]string, error) {
+	ids, err := ls.Threads()
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]string, len(ids))
+	for i, id := range ids {
+		tids[i] = id.String()
+	}
+	sort.Strings(tids)
+	return tids, nil
+}
+
+// threadState renders the observable state of a thread in a canonical form.
+func threadState(ls core.Logstore, id string) (string, error) {
+	tid, err := thread.Decode(id)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	info, err := ls.GetThread(tid)
+	if err == core.ErrThreadNotFound {
+		// threads with logs but without keys are listed
+		info = thread.Info{ID: tid}
+		lids, err := ls.LogsWithKeys(tid)
+		if err != nil {
+			return "", err
+		}
+		for _, lid := range lids {
+			lg, err := ls.GetLog(tid, lid)
+			if err != nil {
+				return "", err
+			}
+			info.Logs = append(info.Logs, lg)
+		}
+	} else if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&buf, "key %s\n", info.Key)
+	sort.Slice(info.Logs, func(i, j int) bool {
+		return info.Logs[i].ID < info.Logs[j].ID
+	})
+	for _, lg := range info.Logs {
+		pk, err := crypto.MarshalPublicKey(lg.PubKey)
+		if err != nil {
+			return "", err
+		}
+		addrs := make([]string, len(lg.Addrs))
+		for i, addr := range lg.Addrs {
+			addrs[i] = addr.String()
+		}
+		sort.Strings(addrs)
+		heads, err := ls.Heads(tid, lg.ID)
+		if err != nil {
+			return "", err
+		}
+		hs := make([]string, len(heads))
+		for i, h := range heads {
+			hs[i] = h.String()
+		}
+		sort.Strings(hs)
+		fmt.Fprintf(&buf, "log %s pk %x sk %t managed %t addrs %v heads %v\n",
+			lg.ID, pk, lg.PrivKey != nil, lg.Managed, addrs, hs)
+	}
+	keys, err := ls.MetaKeys(tid)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		var v interface{}
+		switch {
+		case strings.HasPrefix(key, "i/"):
+			v, err = ls.GetInt64(tid, key)
+		case strings.HasPrefix(key, "s/"):
+			v, err = ls.GetString(tid, key)
+		default:
+			// keys internal to the implementation
+			fmt.Fprintf(&buf, "meta %s\n", key)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&buf, "meta %s %v\n", key, reflect.Indirect(reflect.ValueOf(v)))
+	}
+	return buf.String(), nil
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/crypto"
-	"github.com/libp2p/go-libp2p-core/peer"
 	pt "github.com/libp2p/go-libp2p-core/test"
 	mh "github.com/multiformats/go-multihash"
 	core "github.com/textileio/go-threads/core/logstore"
@@ -200,6 +199,8 @@ var logHeadbookBenchmarkSuite = map[string]func(hb core.HeadBook) func(*testing.
 	"AddHeads":   benchmarkAddHeads,
 	"SetHeads":   benchmarkSetHeads,
 	"ClearHeads": benchmarkClearHeads,
+	// Writers of different threads are expected not to contend.
+	"AddHeadsParallel": benchmarkAddHeadsParallel,
 }
 
 func BenchmarkHeadBook(b *testing.B, factory HeadBookFactory) {
@@ -258,6 +259,22 @@ func benchmarkAddHeads(hb core.HeadBook) func(*testing.B) {
 	}
 }
 
+func benchmarkAddHeadsParallel(hb core.HeadBook) func(*testing.B) {
+	return func(b *testing.B) {
+		_, logs := genHeads(1, 1)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			// every goroutine writes to a thread of its own
+			tid := thread.NewIDV1(thread.Raw, 32)
+			for pb.Next() {
+				for lid, heads := range logs {
+					_ = hb.AddHeads(tid, lid, heads)
+				}
+			}
+		})
+	}
+}
+
 func benchmarkSetHeads(hb core.HeadBook) func(*testing.B) {
 	return func(b *testing.B) {
 		var (
@@ -296,15 +313,15 @@ func benchmarkClearHeads(hb core.HeadBook) func(*testing.B) {
 	}
 }
 
-func genHeads(numLogs, numHeads int) (thread.ID, map[peer.ID][]cid.Cid) {
+func genHeads(numLogs, numHeads int) (thread.ID, map[thread.LogID][]cid.Cid) {
 	var (
-		logs = make(map[peer.ID][]cid.Cid)
+		logs = make(map[thread.LogID][]cid.Cid)
 		tid  = thread.NewIDV1(thread.Raw, 32)
 	)
 
 	for i := 0; i < numLogs; i++ {
 		_, pub, _ := pt.RandTestKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-		lid, _ := peer.IDFromPublicKey(pub)
+		lid, _ := thread.NewLogID(pub)
 
 		heads := make([]cid.Cid, numHeads)
 		for j := 0; j < numHeads; j++ {
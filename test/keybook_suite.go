@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/crypto"
-	"github.com/libp2p/go-libp2p-core/peer"
 	pt "github.com/libp2p/go-libp2p-core/test"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
@@ -26,6 +25,10 @@ var keyBookSuite = map[string]func(kb core.KeyBook) func(*testing.T){
 	"ThreadsFromKeys":         testKeyBookThreads,
 	"PubKeyAddedOnRetrieve":   testInlinedPubKeyAddedOnRetrieve,
 	"ExportKeyBook":           testKeyBookExport,
+	"RotateReadKey":           testKeyBookRotateReadKey,
+	"RotateServiceKey":        testKeyBookRotateServiceKey,
+	"RevokePubKey":            testKeyBookRevokePubKey,
+	"HasKeys":                 testKeyBookHasKeys,
 }
 
 type KeyBookFactory func() (core.KeyBook, func())
@@ -58,7 +61,7 @@ func testKeyBookPrivKey(kb core.KeyBook) func(t *testing.T) {
 			t.Error(err)
 		}
 
-		id, err := peer.IDFromPrivateKey(priv)
+		id, err := thread.LogIDFromPrivKey(priv)
 		if err != nil {
 			t.Error(err)
 		}
@@ -95,7 +98,7 @@ func testKeyBookPubKey(kb core.KeyBook) func(t *testing.T) {
 			t.Error(err)
 		}
 
-		id, err := peer.IDFromPublicKey(pub)
+		id, err := thread.NewLogID(pub)
 		if err != nil {
 			t.Error(err)
 		}
@@ -167,6 +170,189 @@ func testKeyBookServiceKey(kb core.KeyBook) func(t *testing.T) {
 	}
 }
 
+func testKeyBookRotateReadKey(kb core.KeyBook) func(t *testing.T) {
+	return testKeyBookRotateKey(kb, kb.AddReadKey, kb.ReadKey, kb.RotateReadKey, kb.ReadKeyVersion, kb.ReadKeyVersions)
+}
+
+func testKeyBookRotateServiceKey(kb core.KeyBook) func(t *testing.T) {
+	return testKeyBookRotateKey(kb, kb.AddServiceKey, kb.ServiceKey, kb.RotateServiceKey, kb.ServiceKeyVersion, kb.ServiceKeyVersions)
+}
+
+func testKeyBookRotateKey(
+	kb core.KeyBook,
+	add func(thread.ID, *sym.Key) error,
+	get func(thread.ID) (*sym.Key, error),
+	rotate func(thread.ID, *sym.Key) (int, error),
+	version func(thread.ID, int) (*sym.Key, error),
+	versions func(thread.ID) ([]core.KeyVersion, error),
+) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+
+		if k, err := version(tid, 0); err != nil || k != nil {
+			t.Fatalf("expected no key versions on init, got %v (err: %v)", k, err)
+		}
+
+		start := time.Now()
+		keys := []*sym.Key{sym.New(), sym.New(), sym.New()}
+		if err := add(tid, keys[0]); err != nil {
+			t.Fatal(err)
+		}
+		for i, k := range keys[1:] {
+			v, err := rotate(tid, k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != i+1 {
+				t.Fatalf("expected key version %d, got %d", i+1, v)
+			}
+		}
+
+		check := func() {
+			if k, err := get(tid); err != nil || !bytes.Equal(k.Bytes(), keys[2].Bytes()) {
+				t.Fatalf("expected the latest key to be current, err: %v", err)
+			}
+			for v, key := range keys {
+				k, err := version(tid, v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if k == nil || !bytes.Equal(k.Bytes(), key.Bytes()) {
+					t.Fatalf("key version %d did not match the stored key", v)
+				}
+			}
+			for _, v := range []int{-1, len(keys)} {
+				if k, err := version(tid, v); err != nil || k != nil {
+					t.Fatalf("expected no key of version %d, got %v (err: %v)", v, k, err)
+				}
+			}
+		}
+		check()
+
+		kvs, err := versions(tid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kvs) != len(keys) {
+			t.Fatalf("expected %d key versions, got %d", len(keys), len(kvs))
+		}
+		for i, kv := range kvs {
+			if kv.Version != i || !bytes.Equal(kv.Key.Bytes(), keys[i].Bytes()) {
+				t.Fatalf("key version %d did not match the stored key", i)
+			}
+			if kv.Created.Before(start) || (i > 0 && kv.Created.Before(kvs[i-1].Created)) {
+				t.Fatalf("unexpected creation time %v of key version %d", kv.Created, i)
+			}
+		}
+
+		// history survives dumps
+		dump, err := kb.DumpKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := kb.ClearKeys(tid); err != nil {
+			t.Fatal(err)
+		}
+		if k, err := version(tid, 0); err != nil || k != nil {
+			t.Fatalf("expected key versions to be cleared, got %v (err: %v)", k, err)
+		}
+		if err := kb.RestoreKeys(dump); err != nil {
+			t.Fatal(err)
+		}
+		check()
+		restored, err := versions(tid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, kv := range restored {
+			if !kv.Created.Equal(kvs[i].Created) {
+				t.Fatalf("creation time of key version %d was not restored", i)
+			}
+		}
+	}
+}
+
+func testKeyBookRevokePubKey(kb core.KeyBook) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		_, pub, _ := pt.RandTestKeyPair(crypto.Ed25519, 0)
+		id, _ := thread.NewLogID(pub)
+		if err := kb.AddPubKey(tid, id, pub); err != nil {
+			t.Fatal(err)
+		}
+
+		if revoked, err := kb.IsRevoked(tid, id); err != nil || revoked {
+			t.Fatalf("expected key not to be revoked, got %v (err: %v)", revoked, err)
+		}
+		if err := kb.RevokePubKey(tid, id); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := kb.IsRevoked(tid, id); err != nil || !revoked {
+			t.Fatalf("expected key to be revoked, got %v (err: %v)", revoked, err)
+		}
+		// revoked keys are retained to verify existing records
+		if pk, err := kb.PubKey(tid, id); err != nil || !pk.Equals(pub) {
+			t.Fatalf("expected revoked key to be retained, err: %v", err)
+		}
+
+		dump, err := kb.DumpKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := kb.ClearLogKeys(tid, id); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := kb.IsRevoked(tid, id); err != nil || revoked {
+			t.Fatalf("expected revocation to be cleared, got %v (err: %v)", revoked, err)
+		}
+		if err := kb.RestoreKeys(dump); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := kb.IsRevoked(tid, id); err != nil || !revoked {
+			t.Fatalf("expected revocation to be restored, got %v (err: %v)", revoked, err)
+		}
+	}
+}
+
+func testKeyBookHasKeys(kb core.KeyBook) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		priv, _, _ := pt.RandTestKeyPair(crypto.Ed25519, 0)
+		id, _ := thread.LogIDFromPrivKey(priv)
+
+		expect := func(priv, read, service bool) {
+			t.Helper()
+			if has, err := kb.HasPrivKey(tid, id); err != nil || has != priv {
+				t.Fatalf("expected private key presence %v, got %v (err: %v)", priv, has, err)
+			}
+			if has, err := kb.HasReadKey(tid); err != nil || has != read {
+				t.Fatalf("expected read key presence %v, got %v (err: %v)", read, has, err)
+			}
+			if has, err := kb.HasServiceKey(tid); err != nil || has != service {
+				t.Fatalf("expected service key presence %v, got %v (err: %v)", service, has, err)
+			}
+		}
+
+		expect(false, false, false)
+		if err := kb.AddServiceKey(tid, sym.New()); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, false, true)
+		if err := kb.AddReadKey(tid, sym.New()); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, true, true)
+		if err := kb.AddPrivKey(tid, id, priv); err != nil {
+			t.Fatal(err)
+		}
+		expect(true, true, true)
+		if err := kb.ClearKeys(tid); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, false, false)
+	}
+}
+
 func testKeyBookClearKeys(kb core.KeyBook) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
@@ -199,7 +385,7 @@ func testKeyBookClearKeys(kb core.KeyBook) func(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		id, err := peer.IDFromPrivateKey(priv)
+		id, err := thread.LogIDFromPrivKey(priv)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -269,7 +455,7 @@ func testKeyBookClearLogKeys(kb core.KeyBook) func(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		id, err := peer.IDFromPrivateKey(priv)
+		id, err := thread.LogIDFromPrivKey(priv)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -309,19 +495,19 @@ func testKeyBookLogs(kb core.KeyBook) func(t *testing.T) {
 			t.Error("expected logs to be empty on init without errors")
 		}
 
-		logs := make(peer.IDSlice, 0)
+		logs := make(thread.LogIDSlice, 0)
 		for i := 0; i < 10; i++ {
 			// Add a public key.
 			_, pub, _ := pt.RandTestKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-			p1, _ := peer.IDFromPublicKey(pub)
+			p1, _ := thread.NewLogID(pub)
 			_ = kb.AddPubKey(tid, p1, pub)
 
 			// Add a private key.
 			priv, _, _ := pt.RandTestKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-			p2, _ := peer.IDFromPrivateKey(priv)
+			p2, _ := thread.LogIDFromPrivKey(priv)
 			_ = kb.AddPrivKey(tid, p2, priv)
 
-			logs = append(logs, []peer.ID{p1, p2}...)
+			logs = append(logs, []thread.LogID{p1, p2}...)
 		}
 
 		kbLogs, err := kb.LogsWithKeys(tid)
@@ -361,12 +547,12 @@ func testKeyBookThreads(kb core.KeyBook) func(t *testing.T) {
 			tid := threads[rand.Intn(len(threads))]
 			// Add a public key.
 			_, pub, _ := pt.RandTestKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-			p1, _ := peer.IDFromPublicKey(pub)
+			p1, _ := thread.NewLogID(pub)
 			_ = kb.AddPubKey(tid, p1, pub)
 
 			// Add a private key.
 			priv, _, _ := pt.RandTestKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-			p2, _ := peer.IDFromPrivateKey(priv)
+			p2, _ := thread.LogIDFromPrivKey(priv)
 			_ = kb.AddPrivKey(tid, p2, priv)
 		}
 
@@ -406,7 +592,7 @@ func testInlinedPubKeyAddedOnRetrieve(kb core.KeyBook) func(t *testing.T) {
 			t.Error(err)
 		}
 
-		id, err := peer.IDFromPublicKey(pub)
+		id, err := thread.NewLogID(pub)
 		if err != nil {
 			t.Error(err)
 		}
@@ -427,8 +613,8 @@ func testKeyBookExport(kb core.KeyBook) func(t *testing.T) {
 			numThreads = 2
 			numLogs    = 3
 
-			public  = make(map[thread.ID]map[peer.ID]crypto.PubKey)
-			private = make(map[thread.ID]map[peer.ID]crypto.PrivKey)
+			public  = make(map[thread.ID]map[thread.LogID]crypto.PubKey)
+			private = make(map[thread.ID]map[thread.LogID]crypto.PrivKey)
 			read    = make(map[thread.ID][]byte)
 			service = make(map[thread.ID][]byte)
 		)
@@ -455,12 +641,12 @@ func testKeyBookExport(kb core.KeyBook) func(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			public[tid] = make(map[peer.ID]crypto.PubKey)
-			private[tid] = make(map[peer.ID]crypto.PrivKey)
+			public[tid] = make(map[thread.LogID]crypto.PubKey)
+			private[tid] = make(map[thread.LogID]crypto.PrivKey)
 
 			for j := 0; j < numLogs; j++ {
 				priv, pub, _ := pt.RandTestKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-				lid, _ := peer.IDFromPublicKey(pub)
+				lid, _ := thread.NewLogID(pub)
 
 				public[tid][lid] = pub
 				private[tid][lid] = priv
@@ -578,7 +764,7 @@ func benchmarkPubKey(kb core.KeyBook) func(*testing.B) {
 			b.Error(err)
 		}
 
-		id, err := peer.IDFromPublicKey(pub)
+		id, err := thread.NewLogID(pub)
 		if err != nil {
 			b.Error(err)
 		}
@@ -604,7 +790,7 @@ func benchmarkAddPubKey(kb core.KeyBook) func(*testing.B) {
 			b.Error(err)
 		}
 
-		id, err := peer.IDFromPublicKey(pub)
+		id, err := thread.NewLogID(pub)
 		if err != nil {
 			b.Error(err)
 		}
@@ -625,7 +811,7 @@ func benchmarkPrivKey(kb core.KeyBook) func(*testing.B) {
 			b.Error(err)
 		}
 
-		id, err := peer.IDFromPrivateKey(priv)
+		id, err := thread.LogIDFromPrivKey(priv)
 		if err != nil {
 			b.Error(err)
 		}
@@ -651,7 +837,7 @@ func benchmarkAddPrivKey(kb core.KeyBook) func(*testing.B) {
 			b.Error(err)
 		}
 
-		id, err := peer.IDFromPrivateKey(priv)
+		id, err := thread.LogIDFromPrivKey(priv)
 		if err != nil {
 			b.Error(err)
 		}
@@ -672,7 +858,7 @@ func benchmarkLogsWithKeys(kb core.KeyBook) func(*testing.B) {
 				b.Error(err)
 			}
 
-			id, err := peer.IDFromPublicKey(pub)
+			id, err := thread.NewLogID(pub)
 			if err != nil {
 				b.Error(err)
 			}
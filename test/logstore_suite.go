@@ -1,16 +1,25 @@
 package test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pstore "github.com/libp2p/go-libp2p-core/peerstore"
 	ma "github.com/multiformats/go-multiaddr"
+	mh "github.com/multiformats/go-multihash"
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
 	sym "github.com/textileio/go-threads/crypto/symmetric"
@@ -20,8 +29,43 @@ var threadstoreSuite = map[string]func(core.Logstore) func(*testing.T){
 	"AddrStream":              testAddrStream,
 	"GetStreamBeforeLogAdded": testGetStreamBeforeLogAdded,
 	"AddStreamDuplicates":     testAddrStreamDuplicates,
+	"PauseAddrStream":         testPauseAddrStream,
+	"ThreadAddrStream":        testThreadAddrStream,
 	"BasicLogstore":           testBasicLogstore,
+	"CreateThread":            testCreateThread,
+	"ArchiveThread":           testArchiveThread,
+	"Archive":                 testArchive,
+	"Batch":                   testBatch,
+	"ExportThread":            testExportThread,
+	"ExportKeys":              testExportKeys,
+	"Capability":              testCapability,
+	"Invite":                  testInvite,
+	"DeleteThread":            testDeleteThread,
+	"DeleteLog":               testDeleteLog,
+	"Subscribe":               testSubscribe,
+	"Events":                  testEvents,
+	"Hooks":                   testHooks,
+	"Snapshot":                testSnapshot,
+	"DumpCanonical":           testDumpCanonical,
+	"LogMetadata":             testLogMetadata,
+	"GetThreadFull":           testGetThreadFull,
+	"ThreadHandles":           testThreadHandles,
+	"LogsToThreads":           testLogsToThreads,
+	"LogsForPeer":             testLogsForPeer,
+	"ReplaceAddr":             testReplaceAddr,
+	"AddLogAddrsBulk":         testAddLogAddrsBulk,
+	"Context":                 testContext,
+	"Txn":                     testTxn,
+	"ThreadsPaged":            testThreadsPaged,
+	"Stats":                   testStats,
+	"ThreadNames":             testThreadNames,
+	"Pins":                    testPins,
+	"Errors":                  testErrors,
+	"Close":                   testClose,
+	"AccessBook":              testAccessBook,
 	"Metadata":                testMetadata,
+	"ReservedMetadata":        testReservedMetadata,
+	"Concurrency":             testConcurrency,
 }
 
 type LogstoreFactory func() (core.Logstore, func())
@@ -45,7 +89,7 @@ func testAddrStream(ls core.Logstore) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		addrs, pid := getAddrs(t, 100), peer.ID("testlog")
+		addrs, pid := getAddrs(t, 100), thread.LogID("testlog")
 		err := ls.AddAddrs(tid, pid, addrs[:10], time.Hour)
 		check(t, err)
 
@@ -131,7 +175,7 @@ func testGetStreamBeforeLogAdded(ls core.Logstore) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		addrs, pid := getAddrs(t, 10), peer.ID("testlog")
+		addrs, pid := getAddrs(t, 10), thread.LogID("testlog")
 
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -186,7 +230,7 @@ func testAddrStreamDuplicates(ls core.Logstore) func(t *testing.T) {
 	return func(t *testing.T) {
 		tid := thread.NewIDV1(thread.Raw, 24)
 
-		addrs, pid := getAddrs(t, 10), peer.ID("testlog")
+		addrs, pid := getAddrs(t, 10), thread.LogID("testlog")
 
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -227,6 +271,115 @@ func testAddrStreamDuplicates(ls core.Logstore) func(t *testing.T) {
 	}
 }
 
+func testPauseAddrStream(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+
+		addrs, pid := getAddrs(t, 10), thread.LogID("testlog")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ach, ctl, err := ls.ControlledAddrStream(ctx, tid, pid)
+		if err != nil {
+			t.Fatalf("error when adding stream: %v", err)
+		}
+
+		ctl.Pause()
+		for _, a := range addrs {
+			err = ls.AddAddr(tid, pid, a, time.Hour)
+			check(t, err)
+		}
+
+		select {
+		case a := <-ach:
+			t.Fatalf("received address %s while paused", a)
+		case <-time.After(time.Millisecond * 100):
+		}
+
+		ctl.Resume()
+		timeout := time.After(time.Second * 10)
+		for i, expected := range addrs {
+			select {
+			case a, ok := <-ach:
+				if !ok {
+					t.Fatal("channel shouldnt be closed yet")
+				}
+				if !a.Equal(expected) {
+					t.Fatalf("address %d out of order: expected %s, got %s", i, expected, a)
+				}
+			case <-timeout:
+				t.Fatal("timed out")
+			}
+		}
+
+		// the subscription should still be alive after resuming
+		extra := getAddrs(t, 11)[10]
+		err = ls.AddAddr(tid, pid, extra, time.Hour)
+		check(t, err)
+		select {
+		case a := <-ach:
+			if !a.Equal(extra) {
+				t.Fatalf("expected %s, got %s", extra, a)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func testThreadAddrStream(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid, other := thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24)
+		addrs, pids := getAddrs(t, 4), GenerateLogIDs(2)
+
+		check(t, ls.AddAddr(tid, pids[0], addrs[0], time.Hour))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ach, err := ls.ThreadAddrStream(ctx, tid)
+		check(t, err)
+
+		check(t, ls.AddAddr(other, pids[0], addrs[3], time.Hour))
+		check(t, ls.AddAddr(tid, pids[0], addrs[1], time.Hour))
+		check(t, ls.AddAddr(tid, pids[1], addrs[2], time.Hour))
+		check(t, ls.AddAddr(tid, pids[1], addrs[2], time.Hour))
+
+		expected := map[string]thread.LogID{
+			addrs[0].String(): pids[0],
+			addrs[1].String(): pids[0],
+			addrs[2].String(): pids[1],
+		}
+		timeout := time.After(time.Second * 10)
+		for len(expected) > 0 {
+			select {
+			case la := <-ach:
+				lid, ok := expected[la.Addr.String()]
+				if !ok {
+					t.Fatalf("received unexpected address %s", la.Addr)
+				}
+				if lid != la.Log {
+					t.Fatalf("address %s delivered for log %s, expected %s", la.Addr, la.Log, lid)
+				}
+				delete(expected, la.Addr.String())
+			case <-timeout:
+				t.Fatal("timed out")
+			}
+		}
+
+		select {
+		case la := <-ach:
+			t.Fatalf("received unexpected address %s", la.Addr)
+		case <-time.After(time.Millisecond * 100):
+		}
+
+		cancel()
+		if _, ok := <-ach; ok {
+			t.Fatal("stream should be closed")
+		}
+	}
+}
+
 func testBasicLogstore(ls core.Logstore) func(t *testing.T) {
 	return func(t *testing.T) {
 		tids := make([]thread.ID, 0)
@@ -240,7 +393,7 @@ func testBasicLogstore(ls core.Logstore) func(t *testing.T) {
 			err = ls.AddReadKey(tid, sym.New())
 			check(t, err)
 			priv, pub, _ := crypto.GenerateKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-			p, _ := peer.IDFromPrivateKey(priv)
+			p, _ := thread.LogIDFromPrivKey(priv)
 			err = ls.AddAddr(tid, p, a, pstore.PermanentAddrTTL)
 			check(t, err)
 			err = ls.AddPubKey(tid, p, pub)
@@ -248,65 +401,1901 @@ func testBasicLogstore(ls core.Logstore) func(t *testing.T) {
 			err = ls.AddPrivKey(tid, p, priv)
 			check(t, err)
 		}
-
-		threads, err := ls.Threads()
+
+		threads, err := ls.Threads()
+		check(t, err)
+		if len(threads) != 10 {
+			t.Fatal("expected ten threads, got", len(threads))
+		}
+
+		info, err := ls.GetThread(tids[0])
+		check(t, err)
+		tsAddrs, err := ls.Addrs(info.ID, info.Logs[0].ID)
+		if err != nil {
+			t.Fatalf("error when getting addresses: %v", err)
+		}
+		if !tsAddrs[0].Equal(addrs[0]) {
+			t.Fatal("stored wrong address")
+		}
+
+		log, err := ls.GetLog(info.ID, info.Logs[0].ID)
+		check(t, err)
+		if !log.Addrs[0].Equal(addrs[0]) {
+			t.Fatal("stored wrong address")
+		}
+
+		// Test add entire log
+		tid := thread.NewIDV1(thread.Raw, 24)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		err = ls.AddLog(tid, thread.LogInfo{
+			ID:      p,
+			PubKey:  pub,
+			PrivKey: priv,
+			Addrs:   getAddrs(t, 1),
+		})
+		check(t, err)
+		log, err = ls.GetLog(tid, p)
+		check(t, err)
+
+		// Test delete log
+		err = ls.DeleteLog(tid, p)
+		check(t, err)
+		if _, err = ls.GetLog(tid, p); err != core.ErrLogNotFound {
+			t.Fatal("log was not deleted")
+		}
+
+		// Test delete thread (add the log back to the store)
+		err = ls.AddLog(tid, thread.LogInfo{
+			ID:      p,
+			PubKey:  pub,
+			PrivKey: priv,
+			Addrs:   getAddrs(t, 1),
+		})
+		check(t, err)
+		log, err = ls.GetLog(tid, p)
+		check(t, err)
+
+		err = ls.DeleteThread(tid)
+		check(t, err)
+		if _, err = ls.GetThread(tid); err != core.ErrThreadNotFound {
+			t.Fatal("thread was not deleted")
+		}
+	}
+}
+
+func testCreateThread(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		before := time.Now().UnixNano()
+		err := ls.CreateThread(tid, core.WithThreadName("foo"), core.WithThreadTags("a", "b"), core.WithThreadProtocol(thread.Protocol))
+		check(t, err)
+
+		created, err := ls.GetInt64(tid, core.MetaThreadCreated)
+		check(t, err)
+		if created == nil || *created < before {
+			t.Fatal("creation time was not recorded")
+		}
+		name, err := ls.GetString(tid, core.MetaThreadName)
+		check(t, err)
+		if name == nil || *name != "foo" {
+			t.Fatal("thread name was not recorded")
+		}
+		tags, err := ls.GetString(tid, core.MetaThreadTags)
+		check(t, err)
+		if tags == nil || *tags != "a,b" {
+			t.Fatal("thread tags were not recorded")
+		}
+		proto, err := ls.GetString(tid, core.MetaThreadProtocol)
+		check(t, err)
+		if proto == nil || *proto != string(thread.Protocol) {
+			t.Fatal("thread protocol was not recorded")
+		}
+
+		if err = ls.CreateThread(tid); err != core.ErrThreadExists {
+			t.Fatalf("expected ErrThreadExists, got %v", err)
+		}
+
+		// created threads are listed before any keys are added
+		listed := func(ids thread.IDSlice) bool {
+			for _, id := range ids {
+				if id.Equals(tid) {
+					return true
+				}
+			}
+			return false
+		}
+		threads, err := ls.Threads()
+		check(t, err)
+		if !listed(threads) {
+			t.Fatal("expected created thread in threads")
+		}
+		paged, err := ls.ThreadsPaged(0, 0)
+		check(t, err)
+		if !listed(paged) {
+			t.Fatal("expected created thread in paged threads")
+		}
+		handles, err := ls.ThreadHandles()
+		check(t, err)
+		var handled thread.IDSlice
+		for _, h := range handles {
+			handled = append(handled, h.ID)
+		}
+		if !listed(handled) {
+			t.Fatal("expected created thread in thread handles")
+		}
+
+		// threads added implicitly also count as existing
+		other := thread.NewIDV1(thread.Raw, 24)
+		err = ls.AddThread(thread.Info{ID: other, Key: thread.NewRandomKey()})
+		check(t, err)
+		if err = ls.CreateThread(other); err != core.ErrThreadExists {
+			t.Fatalf("expected ErrThreadExists, got %v", err)
+		}
+
+		// a deleted thread can be created again
+		err = ls.DeleteThread(tid)
+		check(t, err)
+		err = ls.CreateThread(tid)
+		check(t, err)
+	}
+}
+
+func testArchiveThread(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		err := ls.CreateThread(tid, core.WithThreadName("cold"))
+		check(t, err)
+		err = ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+		check(t, err)
+
+		addrs := getAddrs(t, 2)
+		for i, a := range addrs {
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			lg := thread.LogInfo{ID: p, PubKey: pub, Addrs: []ma.Multiaddr{a}}
+			if i == 0 {
+				lg.PrivKey = priv
+			}
+			err = ls.AddLog(tid, lg)
+			check(t, err)
+			hash, _ := mh.Encode([]byte(p), mh.SHA2_256)
+			err = ls.SetHead(tid, p, cid.NewCidV1(cid.DagCBOR, hash))
+			check(t, err)
+		}
+		err = ls.PutBytes(tid, "data", []byte("foo"))
+		check(t, err)
+
+		expected, err := ls.GetThread(tid)
+		check(t, err)
+
+		cold := ds.NewMapDatastore()
+		err = ls.ArchiveThread(tid, cold)
+		check(t, err)
+
+		// archived thread must leave the store
+		if _, err = ls.GetThread(tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		threads, err := ls.Threads()
+		check(t, err)
+		if len(threads) != 0 {
+			t.Fatalf("expected no threads, got %v", threads)
+		}
+		archived, err := ls.ArchivedThreads(cold)
+		check(t, err)
+		if len(archived) != 1 || !archived[0].Equals(tid) {
+			t.Fatalf("expected %s to be archived, got %v", tid, archived)
+		}
+
+		err = ls.UnarchiveThread(tid, cold)
+		check(t, err)
+		actual, err := ls.GetThread(tid)
+		check(t, err)
+		equalThreads(t, expected, actual)
+
+		name, err := ls.GetString(tid, core.MetaThreadName)
+		check(t, err)
+		if name == nil || *name != "cold" {
+			t.Fatal("thread name was not restored")
+		}
+		data, err := ls.GetBytes(tid, "data")
+		check(t, err)
+		if data == nil || !bytes.Equal(*data, []byte("foo")) {
+			t.Fatal("thread metadata was not restored")
+		}
+		archived, err = ls.ArchivedThreads(cold)
+		check(t, err)
+		if len(archived) != 0 {
+			t.Fatalf("expected archive to be consumed, got %v", archived)
+		}
+		if err = ls.UnarchiveThread(tid, cold); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+	}
+}
+
+func testArchive(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		pb := pins(t, ls)
+		tid := thread.NewIDV1(thread.Raw, 24)
+		err := ls.CreateThread(tid, core.WithThreadName("blob"))
+		check(t, err)
+		err = ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+		check(t, err)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: getAddrs(t, 1)})
+		check(t, err)
+		hash, _ := mh.Encode([]byte(p), mh.SHA2_256)
+		err = ls.SetHead(tid, p, cid.NewCidV1(cid.DagCBOR, hash))
+		check(t, err)
+
+		expected, err := ls.GetThread(tid)
+		check(t, err)
+
+		var blob bytes.Buffer
+		err = ls.Archive(tid, &blob)
+		check(t, err)
+
+		// only the stub is kept
+		if _, err = ls.GetThread(tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		threads, err := ls.Threads()
+		check(t, err)
+		if len(threads) != 0 {
+			t.Fatalf("expected no threads, got %v", threads)
+		}
+		archived, err := ls.IsArchived(tid)
+		check(t, err)
+		if !archived {
+			t.Fatal("expected thread to be archived")
+		}
+
+		id, err := ls.Unarchive(&blob)
+		check(t, err)
+		if !id.Equals(tid) {
+			t.Fatalf("expected thread %s, got %s", tid, id)
+		}
+		actual, err := ls.GetThread(tid)
+		check(t, err)
+		equalThreads(t, expected, actual)
+		name, err := ls.GetString(tid, core.MetaThreadName)
+		check(t, err)
+		if name == nil || *name != "blob" {
+			t.Fatal("thread name was not restored")
+		}
+		archived, err = ls.IsArchived(tid)
+		check(t, err)
+		if archived {
+			t.Fatal("expected stub to be dropped")
+		}
+
+		check(t, pb.Pin(tid, 1))
+		if err = ls.Archive(tid, ioutil.Discard); err != core.ErrThreadPinned {
+			t.Fatalf("expected ErrThreadPinned, got %v", err)
+		}
+		check(t, pb.Unpin(tid))
+		if _, err = ls.Unarchive(bytes.NewReader([]byte("junk"))); err == nil {
+			t.Fatal("expected error reading a malformed archive")
+		}
+	}
+}
+
+func testBatch(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		info := thread.Info{ID: tid, Key: thread.NewRandomKey()}
+		for _, a := range getAddrs(t, 3) {
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			info.Logs = append(info.Logs, thread.LogInfo{ID: p, PubKey: pub, Addrs: []ma.Multiaddr{a}})
+		}
+
+		b := ls.Batch()
+		b.AddThread(info)
+		b.PutString(tid, "name", "foo")
+		if _, err := ls.GetThread(tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound before commit, got %v", err)
+		}
+		err := b.Commit()
+		check(t, err)
+
+		actual, err := ls.GetThread(tid)
+		check(t, err)
+		equalThreads(t, info, actual)
+		name, err := ls.GetString(tid, "name")
+		check(t, err)
+		if name == nil || *name != "foo" {
+			t.Fatal("thread metadata was not committed")
+		}
+
+		// failed batch must not leave anything behind
+		other := thread.NewIDV1(thread.Raw, 24)
+		priv, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		_, wrong, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		b = ls.Batch()
+		b.AddThread(thread.Info{ID: other, Key: thread.NewRandomKey()})
+		b.AddLog(other, info.Logs[0])
+		b.AddLog(tid, thread.LogInfo{ID: p, PubKey: wrong})
+		if err = b.Commit(); err == nil {
+			t.Fatal("expected commit with mismatching public key to fail")
+		}
+		if _, err = ls.GetThread(other); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound after rollback, got %v", err)
+		}
+		actual, err = ls.GetThread(tid)
+		check(t, err)
+		equalThreads(t, info, actual)
+	}
+}
+
+func testExportThread(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		if _, err := ls.ExportThread(tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+
+		key := thread.NewRandomKey()
+		err := ls.AddThread(thread.Info{ID: tid, Key: key})
+		check(t, err)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: getAddrs(t, 2)})
+		check(t, err)
+		hash, _ := mh.Encode([]byte(p), mh.SHA2_256)
+		err = ls.SetHead(tid, p, cid.NewCidV1(cid.DagCBOR, hash))
+		check(t, err)
+		err = ls.PutInt64(tid, "count", 42)
+		check(t, err)
+		_, err = ls.RotateReadKey(tid, sym.New())
+		check(t, err)
+		dialed := getAddrs(t, 1)
+		err = ls.AddAddrsFromSource(tid, p, dialed, time.Hour, core.AddrSourceDial)
+		check(t, err)
+		err = ls.PutMetaWithTTL(tid, "lease", int64(1), time.Millisecond*200)
+		check(t, err)
+
+		expected, err := ls.GetThread(tid)
+		check(t, err)
+		data, err := ls.ExportThread(tid)
+		check(t, err)
+
+		if err = ls.ImportThread(data); err != core.ErrThreadExists {
+			t.Fatalf("expected ErrThreadExists, got %v", err)
+		}
+		err = ls.DeleteThread(tid)
+		check(t, err)
+		err = ls.ImportThread(data)
+		check(t, err)
+
+		actual, err := ls.GetThread(tid)
+		check(t, err)
+		equalThreads(t, expected, actual)
+		count, err := ls.GetInt64(tid, "count")
+		check(t, err)
+		if count == nil || *count != 42 {
+			t.Fatal("thread metadata was not imported")
+		}
+		rk, err := ls.ReadKeyVersion(tid, 0)
+		check(t, err)
+		if rk == nil || !bytes.Equal(rk.Bytes(), key.Read().Bytes()) {
+			t.Fatal("previous read key was not imported")
+		}
+		addrs, err := ls.AddrsWithSource(tid, p)
+		check(t, err)
+		var sources int
+		for _, a := range addrs {
+			if a.Addr.Equal(dialed[0]) {
+				if a.Source != core.AddrSourceDial {
+					t.Fatalf("expected address source %q, got %q", core.AddrSourceDial, a.Source)
+				}
+				sources++
+			}
+		}
+		if sources != 1 {
+			t.Fatal("address with a source was not imported")
+		}
+
+		// values stored with a TTL are imported with their expiration time
+		lease, err := ls.GetInt64(tid, "lease")
+		check(t, err)
+		if lease == nil || *lease != 1 {
+			t.Fatal("thread metadata with a TTL was not imported")
+		}
+		time.Sleep(time.Millisecond * 250)
+		if lease, err = ls.GetInt64(tid, "lease"); err != nil {
+			t.Fatal(err)
+		} else if lease != nil {
+			t.Fatal("imported thread metadata with a TTL should expire")
+		}
+	}
+}
+
+func testExportKeys(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		if _, err := ls.ExportKeys(tid, "secret"); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+
+		key := thread.NewRandomKey()
+		err := ls.AddThread(thread.Info{ID: tid, Key: key})
+		check(t, err)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv})
+		check(t, err)
+		rk := sym.New()
+		_, err = ls.RotateReadKey(tid, rk)
+		check(t, err)
+
+		bundle, err := ls.ExportKeys(tid, "secret")
+		check(t, err)
+		raw, _ := priv.Raw()
+		if bytes.Contains(bundle, raw) {
+			t.Fatal("key bundle is not encrypted")
+		}
+		if err := ls.ImportKeys(bundle, "wrong"); err == nil {
+			t.Fatal("expected import with a wrong passphrase to fail")
+		}
+
+		err = ls.DeleteThread(tid)
+		check(t, err)
+		err = ls.ImportKeys(bundle, "secret")
+		check(t, err)
+
+		sk, err := ls.ServiceKey(tid)
+		check(t, err)
+		if sk == nil || !bytes.Equal(sk.Bytes(), key.Service().Bytes()) {
+			t.Fatal("service key was not imported")
+		}
+		for v, expected := range []*sym.Key{key.Read(), rk} {
+			k, err := ls.ReadKeyVersion(tid, v)
+			check(t, err)
+			if k == nil || !bytes.Equal(k.Bytes(), expected.Bytes()) {
+				t.Fatalf("read key version %d was not imported", v)
+			}
+		}
+		lsk, err := ls.PrivKey(tid, p)
+		check(t, err)
+		if lsk == nil || !lsk.Equals(priv) {
+			t.Fatal("log private key was not imported")
+		}
+
+		// keys of a thread with other keys are rejected
+		other := thread.NewIDV1(thread.Raw, 24)
+		err = ls.AddThread(thread.Info{ID: other, Key: thread.NewRandomKey()})
+		check(t, err)
+		err = ls.AddLog(other, thread.LogInfo{ID: p, PubKey: pub})
+		check(t, err)
+		bundle, err = ls.ExportKeys(other, "secret")
+		check(t, err)
+		err = ls.DeleteThread(other)
+		check(t, err)
+		err = ls.AddThread(thread.Info{ID: other, Key: thread.NewRandomKey()})
+		check(t, err)
+		if err := ls.ImportKeys(bundle, "secret"); err == nil {
+			t.Fatal("expected import of conflicting keys to fail")
+		}
+	}
+}
+
+func testCapability(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		ab := access(t, ls)
+		tid := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		issuer, _ := thread.LogIDFromPrivKey(priv)
+		check(t, ls.AddLog(tid, thread.LogInfo{ID: issuer, PubKey: pub, PrivKey: priv}))
+		subject := GeneratePeerIDs(1)[0]
+
+		// logs can't delegate roles their identity doesn't hold
+		if _, err := ls.IssueCapability(tid, issuer, subject, core.Reader, time.Hour); !errors.Is(err, core.ErrInvalidCapability) {
+			t.Fatalf("expected ErrInvalidCapability, got %v", err)
+		}
+		check(t, ab.SetRole(tid, thread.NewLibp2pPubKey(pub), core.Writer))
+
+		if _, err := ls.IssueCapability(tid, thread.LogIDFromPeer(subject), subject, core.Reader, time.Hour); err == nil {
+			t.Fatal("expected issuing without a private key to fail")
+		}
+		if _, err := ls.IssueCapability(tid, issuer, subject, core.NoRole, time.Hour); err != core.ErrInvalidRole {
+			t.Fatalf("expected ErrInvalidRole, got %v", err)
+		}
+
+		token, err := ls.IssueCapability(tid, issuer, subject, core.Reader, time.Hour)
+		check(t, err)
+		c, err := ls.VerifyCapability(token)
+		check(t, err)
+		if !c.Thread.Equals(tid) || c.Issuer != issuer || c.Subject != subject || c.Role != core.Reader {
+			t.Fatalf("unexpected capability: %+v", c)
+		}
+		if time.Until(c.Expires) <= 0 || time.Until(c.Expires) > time.Hour {
+			t.Fatalf("unexpected expiration: %s", c.Expires)
+		}
+
+		// tampered tokens are rejected
+		forged := append([]byte(nil), token...)
+		forged[len(forged)-1] ^= 0xff
+		if _, err := ls.VerifyCapability(forged); !errors.Is(err, core.ErrInvalidCapability) {
+			t.Fatalf("expected ErrInvalidCapability, got %v", err)
+		}
+
+		expired, err := ls.IssueCapability(tid, issuer, subject, core.Writer, -time.Second)
+		check(t, err)
+		if _, err := ls.VerifyCapability(expired); err != core.ErrCapabilityExpired {
+			t.Fatalf("expected ErrCapabilityExpired, got %v", err)
+		}
+
+		// a reader's log can't grant ownership
+		rpriv, rpub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		reader, _ := thread.LogIDFromPrivKey(rpriv)
+		check(t, ls.AddLog(tid, thread.LogInfo{ID: reader, PubKey: rpub, PrivKey: rpriv}))
+		check(t, ab.SetRole(tid, thread.NewLibp2pPubKey(rpub), core.Reader))
+		if _, err := ls.IssueCapability(tid, reader, subject, core.Owner, time.Hour); !errors.Is(err, core.ErrInvalidCapability) {
+			t.Fatalf("expected ErrInvalidCapability, got %v", err)
+		}
+		// tokens signed while holding a role are rejected once it is lowered
+		check(t, ab.SetRole(tid, thread.NewLibp2pPubKey(rpub), core.Owner))
+		owned, err := ls.IssueCapability(tid, reader, subject, core.Owner, time.Hour)
+		check(t, err)
+		check(t, ab.SetRole(tid, thread.NewLibp2pPubKey(rpub), core.Reader))
+		if _, err := ls.VerifyCapability(owned); !errors.Is(err, core.ErrInvalidCapability) {
+			t.Fatalf("expected ErrInvalidCapability, got %v", err)
+		}
+
+		// tokens of revoked logs are not valid anymore
+		check(t, ls.RevokePubKey(tid, issuer))
+		if _, err := ls.VerifyCapability(token); err != core.ErrLogRevoked {
+			t.Fatalf("expected ErrLogRevoked, got %v", err)
+		}
+	}
+}
+
+func testInvite(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		inv := invites(t, ls)
+		tid := thread.NewIDV1(thread.Raw, 24)
+		if _, err := inv.CreateInvite(tid, true, ""); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+
+		key := thread.NewRandomKey()
+		check(t, ls.AddThread(thread.Info{ID: tid, Key: key}))
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		addrs := GenerateAddrs(2)
+		check(t, ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: addrs}))
+
+		sealed, err := inv.CreateInvite(tid, false, "secret")
+		check(t, err)
+		plain, err := inv.CreateInvite(tid, true, "")
+		check(t, err)
+		check(t, ls.DeleteThread(tid))
+
+		if _, err := inv.AcceptInvite(sealed, ""); err == nil {
+			t.Fatal("expected accepting an encrypted invite without a password to fail")
+		}
+		if _, err := inv.AcceptInvite(sealed, "wrong"); err == nil {
+			t.Fatal("expected accepting an invite with a wrong password to fail")
+		}
+		info, err := inv.AcceptInvite(sealed, "secret")
+		check(t, err)
+		if !info.ID.Equals(tid) || info.Key.CanRead() {
+			t.Fatal("expected a thread without the read key")
+		}
+		if !bytes.Equal(info.Key.Service().Bytes(), key.Service().Bytes()) {
+			t.Fatal("service key mismatch")
+		}
+		if len(info.Logs) != 1 || info.Logs[0].ID != p || !info.Logs[0].PubKey.Equals(pub) {
+			t.Fatalf("unexpected logs: %v", info.Logs)
+		}
+		if info.Logs[0].PrivKey != nil {
+			t.Fatal("invites must not carry private keys")
+		}
+		AssertAddressesEqual(t, addrs, info.Logs[0].Addrs)
+
+		// accepting an invite with the read key upgrades the thread
+		info, err = inv.AcceptInvite(plain, "")
+		check(t, err)
+		if !bytes.Equal(info.Key.Bytes(), key.Bytes()) {
+			t.Fatal("thread key mismatch")
+		}
+	}
+}
+
+func testDeleteThread(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+		check(t, err)
+
+		// one log with addresses and one known by its keys only
+		var logs []thread.LogID
+		for i, addrs := range [][]ma.Multiaddr{getAddrs(t, 2), nil} {
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: addrs})
+			check(t, err)
+			hash, _ := mh.Encode([]byte(fmt.Sprintf("head%d", i)), mh.SHA2_256)
+			err = ls.SetHead(tid, p, cid.NewCidV1(cid.DagCBOR, hash))
+			check(t, err)
+			logs = append(logs, p)
+		}
+		err = ls.PutString(tid, "name", "foo")
+		check(t, err)
+
+		err = ls.DeleteThread(tid)
+		check(t, err)
+
+		if _, err = ls.GetThread(tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		for _, p := range logs {
+			pk, err := ls.PubKey(tid, p)
+			check(t, err)
+			sk, err := ls.PrivKey(tid, p)
+			check(t, err)
+			if pk != nil || sk != nil {
+				t.Fatalf("keys of log %s were not deleted", p)
+			}
+			addrs, err := ls.Addrs(tid, p)
+			check(t, err)
+			if len(addrs) != 0 {
+				t.Fatalf("addresses of log %s were not deleted", p)
+			}
+			heads, err := ls.Heads(tid, p)
+			check(t, err)
+			if len(heads) != 0 {
+				t.Fatalf("heads of log %s were not deleted", p)
+			}
+		}
+		name, err := ls.GetString(tid, "name")
+		check(t, err)
+		if name != nil {
+			t.Fatal("metadata was not deleted")
+		}
+		threads, err := ls.Threads()
+		check(t, err)
+		if len(threads) != 0 {
+			t.Fatalf("expected no threads, got %v", threads)
+		}
+	}
+}
+
+func testDeleteLog(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+		check(t, err)
+
+		var logs []thread.LogInfo
+		for i := 0; i < 2; i++ {
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			lg := thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: getAddrs(t, 2)}
+			err = ls.AddLog(tid, lg)
+			check(t, err)
+			hash, _ := mh.Encode([]byte(p), mh.SHA2_256)
+			err = ls.SetHead(tid, p, cid.NewCidV1(cid.DagCBOR, hash))
+			check(t, err)
+			logs = append(logs, lg)
+		}
+		expected, err := ls.GetLog(tid, logs[1].ID)
+		check(t, err)
+
+		evicted := logs[0].ID
+		err = ls.DeleteLog(tid, evicted)
+		check(t, err)
+
+		if _, err = ls.GetLog(tid, evicted); err != core.ErrLogNotFound {
+			t.Fatalf("expected ErrLogNotFound, got %v", err)
+		}
+		sk, err := ls.PrivKey(tid, evicted)
+		check(t, err)
+		if sk != nil {
+			t.Fatal("private key of deleted log was kept")
+		}
+		addrs, err := ls.Addrs(tid, evicted)
+		check(t, err)
+		heads, err := ls.Heads(tid, evicted)
+		check(t, err)
+		if len(addrs) != 0 || len(heads) != 0 {
+			t.Fatal("addresses or heads of deleted log were kept")
+		}
+		managed, err := ls.GetManagedLogs(tid)
+		check(t, err)
+		if len(managed) != 1 || managed[0].ID != logs[1].ID {
+			t.Fatalf("expected only %s to be managed, got %v", logs[1].ID, managed)
+		}
+
+		// rest of the thread is untouched
+		info, err := ls.GetThread(tid)
+		check(t, err)
+		if len(info.Logs) != 1 {
+			t.Fatalf("expected one log, got %d", len(info.Logs))
+		}
+		equalThreads(t, thread.Info{ID: tid, Key: info.Key, Logs: []thread.LogInfo{expected}}, info)
+		if info.Key.Service() == nil || info.Key.Read() == nil {
+			t.Fatal("thread keys were deleted")
+		}
+
+		// re-added log is not managed anymore unless requested
+		lg := logs[0]
+		lg.PrivKey = nil
+		err = ls.AddLog(tid, lg)
+		check(t, err)
+		readded, err := ls.GetLog(tid, evicted)
+		check(t, err)
+		if readded.Managed {
+			t.Fatal("re-added log should not be managed")
+		}
+	}
+}
+
+func testSubscribe(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		other := thread.NewIDV1(thread.Raw, 24)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := ls.Subscribe(ctx, tid)
+		check(t, err)
+
+		err = ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+		check(t, err)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub})
+		check(t, err)
+		err = ls.PutString(other, "name", "other")
+		check(t, err)
+		addrs := getAddrs(t, 1)
+		err = ls.AddAddr(tid, p, addrs[0], time.Hour)
+		check(t, err)
+		hash, _ := mh.Encode([]byte(p), mh.SHA2_256)
+		err = ls.SetHead(tid, p, cid.NewCidV1(cid.DagCBOR, hash))
+		check(t, err)
+		err = ls.PutString(tid, "name", "foo")
+		check(t, err)
+		err = ls.DeleteThread(tid)
+		check(t, err)
+
+		expected := []core.EventType{core.LogAdded, core.AddrAdded, core.HeadUpdated, core.MetaChanged, core.ThreadDeleted}
+		timeout := time.After(5 * time.Second)
+		for len(expected) > 0 {
+			select {
+			case ev := <-events:
+				if !ev.Thread.Equals(tid) {
+					t.Fatalf("received event of another thread: %v", ev)
+				}
+				if ev.Type == core.MetaChanged && ev.Key != "name" {
+					t.Fatalf("expected change of key name, got %s", ev.Key)
+				}
+				if ev.Type == expected[0] {
+					expected = expected[1:]
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %v", expected)
+			}
+		}
+
+		cancel()
+		select {
+		case _, ok := <-events:
+			if ok {
+				// drain a possibly pending event
+				if _, ok = <-events; ok {
+					t.Fatal("expected channel to be closed")
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("channel was not closed after cancellation")
+		}
+	}
+}
+
+func testHooks(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		var syncEvents []core.Event
+		unregisterSync := ls.RegisterHook(core.Hook{
+			OnPut:    func(ev core.Event) { syncEvents = append(syncEvents, ev) },
+			OnDelete: func(ev core.Event) { syncEvents = append(syncEvents, ev) },
+		})
+		asyncEvents := make(chan core.Event, 16)
+		unregisterAsync := ls.RegisterHook(core.Hook{
+			OnDelete: func(ev core.Event) { asyncEvents <- ev },
+			Async:    true,
+		})
+
+		err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+		check(t, err)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub})
+		check(t, err)
+		err = ls.PutString(tid, "name", "foo")
+		check(t, err)
+		err = ls.DeleteLog(tid, p)
+		check(t, err)
+		err = ls.DeleteThread(tid)
+		check(t, err)
+
+		// synchronous hooks are called before writes return
+		var types []core.EventType
+		for _, ev := range syncEvents {
+			if !ev.Thread.Equals(tid) {
+				t.Fatalf("received event of another thread: %v", ev)
+			}
+			types = append(types, ev.Type)
+		}
+		expected := []core.EventType{core.LogAdded, core.MetaChanged, core.LogDeleted, core.ThreadDeleted}
+		for _, typ := range types {
+			if len(expected) > 0 && typ == expected[0] {
+				expected = expected[1:]
+			}
+		}
+		if len(expected) > 0 {
+			t.Fatalf("expected %v in order, got %v", expected, types)
+		}
+
+		// async hooks are called in order, and only with deletions here
+		for _, typ := range []core.EventType{core.LogDeleted, core.ThreadDeleted} {
+			select {
+			case ev := <-asyncEvents:
+				if ev.Type != typ {
+					t.Fatalf("expected %s, got %s", typ, ev.Type)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %s", typ)
+			}
+		}
+
+		unregisterSync()
+		unregisterAsync()
+		n := len(syncEvents)
+		err = ls.PutString(tid, "name", "bar")
+		check(t, err)
+		if len(syncEvents) != n {
+			t.Fatal("expected unregistered hook not to be called")
+		}
+	}
+}
+
+func testEvents(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := ls.Events(ctx)
+
+		created := thread.NewIDV1(thread.Raw, 24)
+		err := ls.CreateThread(created)
+		check(t, err)
+		added := thread.NewIDV1(thread.Raw, 24)
+		err = ls.AddThread(thread.Info{ID: added, Key: thread.NewRandomKey()})
+		check(t, err)
+		// neither log-level changes nor re-adding threads are reported
+		err = ls.PutString(added, "name", "foo")
+		check(t, err)
+		err = ls.AddThread(thread.Info{ID: created, Key: thread.NewRandomKey()})
+		check(t, err)
+		// nor deleting missing threads
+		err = ls.DeleteThread(thread.NewIDV1(thread.Raw, 24))
+		check(t, err)
+		err = ls.DeleteThread(added)
+		check(t, err)
+
+		expected := []core.Event{
+			{Type: core.ThreadCreated, Thread: created},
+			{Type: core.ThreadCreated, Thread: added},
+			{Type: core.ThreadDeleted, Thread: added},
+		}
+		for _, exp := range expected {
+			select {
+			case ev := <-events:
+				if ev.Type != exp.Type || !ev.Thread.Equals(exp.Thread) {
+					t.Fatalf("expected %s of %s, got %s of %s", exp.Type, exp.Thread, ev.Type, ev.Thread)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %s of %s", exp.Type, exp.Thread)
+			}
+		}
+	}
+}
+
+func testSnapshot(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		sn := snapshots(t, ls)
+		expected := make(map[thread.ID]thread.Info)
+		for i := 0; i < 3; i++ {
+			tid := thread.NewIDV1(thread.Raw, 24)
+			err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+			check(t, err)
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: getAddrs(t, 2)})
+			check(t, err)
+			info, err := ls.GetThread(tid)
+			check(t, err)
+			expected[tid] = info
+		}
+
+		var buf bytes.Buffer
+		err := sn.Snapshot(&buf)
+		check(t, err)
+		data := buf.Bytes()
+
+		if err = sn.Restore(bytes.NewReader(data)); err != core.ErrThreadExists {
+			t.Fatalf("expected ErrThreadExists, got %v", err)
+		}
+		for tid := range expected {
+			err = ls.DeleteThread(tid)
+			check(t, err)
+		}
+		err = sn.Restore(bytes.NewReader(data))
+		check(t, err)
+
+		threads, err := ls.Threads()
+		check(t, err)
+		if len(threads) != len(expected) {
+			t.Fatalf("expected %d threads, got %d", len(expected), len(threads))
+		}
+		for tid, info := range expected {
+			actual, err := ls.GetThread(tid)
+			check(t, err)
+			equalThreads(t, info, actual)
+		}
+
+		if err = sn.Restore(bytes.NewReader([]byte("garbage"))); err == nil {
+			t.Fatal("expected restoring garbage to fail")
+		}
+		huge := append([]byte("lstore\x01"), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)
+		if err = sn.Restore(bytes.NewReader(huge)); err == nil {
+			t.Fatal("expected restoring an oversized thread to fail")
+		}
+
+		// a failed restore leaves no threads behind
+		for tid := range expected {
+			err = ls.DeleteThread(tid)
+			check(t, err)
+		}
+		if err = sn.Restore(bytes.NewReader(data[:len(data)-1])); err == nil {
+			t.Fatal("expected restoring a truncated snapshot to fail")
+		}
+		threads, err = ls.Threads()
+		check(t, err)
+		if len(threads) != 0 {
+			t.Fatalf("expected no threads after a failed restore, got %d", len(threads))
+		}
+	}
+}
+
+func testDumpCanonical(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		sn := snapshots(t, ls)
+		tid := thread.NewIDV1(thread.Raw, 24)
+		key := thread.NewRandomKey()
+		err := ls.AddThread(thread.Info{ID: tid, Key: key})
+		check(t, err)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		addrs := getAddrs(t, 2)
+		err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: addrs})
+		check(t, err)
+		hash, _ := mh.Encode([]byte(p), mh.SHA2_256)
+		head := cid.NewCidV1(cid.DagCBOR, hash)
+		err = ls.SetHead(tid, p, head)
+		check(t, err)
+		err = ls.PutString(tid, "name", "foo bar")
+		check(t, err)
+
+		dump := func() string {
+			var buf bytes.Buffer
+			check(t, ls.DumpCanonical(&buf))
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if lines[0] != "lstore canonical dump v1" {
+				t.Fatalf("unexpected header %q", lines[0])
+			}
+			return strings.Join(lines[1:], "\n")
+		}
+		before := dump()
+		if !sort.StringsAreSorted(strings.Split(before, "\n")) {
+			t.Fatalf("expected sorted lines, got\n%s", before)
+		}
+		for _, expected := range []string{
+			fmt.Sprintf("%s addr %s %s", tid, p, addrs[0]),
+			fmt.Sprintf("%s addr %s %s", tid, p, addrs[1]),
+			fmt.Sprintf("%s head %s %s", tid, p, head),
+			fmt.Sprintf("%s meta \"name\" string \"foo bar\"", tid),
+			fmt.Sprintf("%s privkey %s", tid, p),
+		} {
+			if !strings.Contains("\n"+before+"\n", "\n"+expected+"\n") {
+				t.Fatalf("expected line %q in dump\n%s", expected, before)
+			}
+		}
+		if strings.Contains(before, fmt.Sprintf("%x", key.Read().Bytes())) {
+			t.Fatal("expected read key to be left out of the dump")
+		}
+
+		// dumps don't depend on how threads were stored
+		var buf bytes.Buffer
+		err = sn.Snapshot(&buf)
+		check(t, err)
+		err = ls.DeleteThread(tid)
+		check(t, err)
+		if after := dump(); after != "" {
+			t.Fatalf("expected deleted thread to be left out of the dump, got\n%s", after)
+		}
+		err = sn.Restore(&buf)
+		check(t, err)
+		if after := dump(); after != before {
+			t.Fatalf("expected restored thread to be dumped equally:\n%s\n!=\n%s", after, before)
+		}
+	}
+}
+
+func testLogMetadata(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		logs := GenerateLogIDs(2)
+
+		err := ls.PutLogString(tid, logs[0], "name", "laptop")
+		check(t, err)
+		err = ls.PutLogInt64(tid, logs[0], "seen", 42)
+		check(t, err)
+		err = ls.PutLogBool(tid, logs[0], "trusted", true)
+		check(t, err)
+		err = ls.PutLogBytes(tid, logs[0], "data", []byte("foo"))
+		check(t, err)
+		err = ls.PutLogString(tid, logs[1], "name", "phone")
+		check(t, err)
+
+		name, err := ls.GetLogString(tid, logs[0], "name")
+		check(t, err)
+		if name == nil || *name != "laptop" {
+			t.Fatalf("unexpected name of the first log: %v", name)
+		}
+		name, err = ls.GetLogString(tid, logs[1], "name")
+		check(t, err)
+		if name == nil || *name != "phone" {
+			t.Fatalf("unexpected name of the second log: %v", name)
+		}
+		seen, err := ls.GetLogInt64(tid, logs[0], "seen")
+		check(t, err)
+		if seen == nil || *seen != 42 {
+			t.Fatalf("unexpected int value: %v", seen)
+		}
+		trusted, err := ls.GetLogBool(tid, logs[0], "trusted")
+		check(t, err)
+		if trusted == nil || !*trusted {
+			t.Fatalf("unexpected bool value: %v", trusted)
+		}
+		data, err := ls.GetLogBytes(tid, logs[0], "data")
+		check(t, err)
+		if data == nil || !bytes.Equal(*data, []byte("foo")) {
+			t.Fatalf("unexpected bytes value: %v", data)
+		}
+
+		// log metadata doesn't clash with thread metadata
+		tname, err := ls.GetString(tid, "name")
+		check(t, err)
+		if tname != nil {
+			t.Fatal("log metadata leaked into thread metadata")
+		}
+		missing, err := ls.GetLogString(tid, logs[1], "seen")
+		check(t, err)
+		if missing != nil {
+			t.Fatal("expected missing value to be nil")
+		}
+	}
+}
+
+func testGetThreadFull(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		if _, err := ls.GetThreadFull(tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+
+		err := ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()})
+		check(t, err)
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		err = ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: getAddrs(t, 2)})
+		check(t, err)
+		var heads []cid.Cid
+		for i := 0; i < 2; i++ {
+			hash, _ := mh.Encode([]byte(fmt.Sprintf("head%d", i)), mh.SHA2_256)
+			heads = append(heads, cid.NewCidV1(cid.DagCBOR, hash))
+		}
+		err = ls.SetHead(tid, p, heads[0])
+		check(t, err)
+		err = ls.PutString(tid, "name", "foo")
+		check(t, err)
+		err = ls.PutInt64(tid, "count", 1)
+		check(t, err)
+
+		expected, err := ls.GetThread(tid)
+		check(t, err)
+		info, err := ls.GetThreadFull(tid)
+		check(t, err)
+		equalThreads(t, expected, info.Info)
+
+		// log info exposes only one of the heads
+		err = ls.AddHead(tid, p, heads[1])
+		check(t, err)
+		info, err = ls.GetThreadFull(tid)
+		check(t, err)
+		if !info.Key.CanRead() || info.Logs[0].PrivKey == nil {
+			t.Fatal("expected read and private keys to be present")
+		}
+		if len(info.Heads[p]) != len(heads) {
+			t.Fatalf("expected %d heads, got %d", len(heads), len(info.Heads[p]))
+		}
+		if info.Metadata.String["name"] != "foo" || info.Metadata.Int64["count"] != 1 {
+			t.Fatalf("unexpected metadata: %v", info.Metadata)
+		}
+	}
+}
+
+func testContext(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		cls, ok := ls.(core.ContextLogstore)
+		if !ok {
+			t.Skip("logstore doesn't support contexts")
+		}
+
+		tid := thread.NewIDV1(thread.Raw, 24)
+		info := thread.Info{ID: tid, Key: thread.NewRandomKey()}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := cls.AddThreadContext(ctx, info); err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if _, err := cls.GetThreadContext(context.Background(), tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		check(t, cls.AddThreadContext(ctx, info))
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		check(t, cls.AddLogContext(ctx, tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv}))
+		if _, err := cls.GetLogContext(ctx, tid, p); err != nil {
+			t.Fatal(err)
+		}
+		got, err := cls.GetThreadContext(ctx, tid)
+		check(t, err)
+		if len(got.Logs) != 1 {
+			t.Fatalf("expected 1 log, got %d", len(got.Logs))
+		}
+		threads, err := cls.ThreadsContext(ctx)
+		check(t, err)
+		if len(threads) == 0 {
+			t.Fatal("expected threads to be listed")
+		}
+
+		// views fail operations of the books once the context is done
+		vctx, vcancel := context.WithCancel(context.Background())
+		view := cls.WithContext(vctx)
+		check(t, view.PutString(tid, "name", "foo"))
+		vcancel()
+		if err := view.PutString(tid, "name", "bar"); err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		name, err := ls.GetString(tid, "name")
+		check(t, err)
+		if name == nil || *name != "foo" {
+			t.Fatalf("expected name to be kept, got %v", name)
+		}
+
+		check(t, cls.DeleteLogContext(ctx, tid, p))
+		check(t, cls.DeleteThreadContext(ctx, tid))
+		if _, err := cls.GetThreadContext(ctx, tid); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+	}
+}
+
+func testTxn(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tr := transactions(t, ls)
+		tid := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+		check(t, ls.PutString(tid, "name", "foo"))
+
+		t.Run("readonly", func(t *testing.T) {
+			tx, err := tr.BeginTxn(true)
+			check(t, err)
+			if _, err := tx.GetThread(tid); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.PutString(tid, "name", "bar"); err != core.ErrTxnReadOnly {
+				t.Fatalf("expected ErrTxnReadOnly, got %v", err)
+			}
+			check(t, tx.Commit())
+			if err := tx.Commit(); err != core.ErrTxnDone {
+				t.Fatalf("expected ErrTxnDone, got %v", err)
+			}
+		})
+
+		t.Run("rollback", func(t *testing.T) {
+			created := thread.NewIDV1(thread.Raw, 24)
+			tx, err := tr.BeginTxn(false)
+			check(t, err)
+			check(t, tx.PutString(tid, "name", "bar"))
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			check(t, tx.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv}))
+			check(t, tx.AddThread(thread.Info{ID: created, Key: thread.NewRandomKey()}))
+			if _, err := tx.GetThread(created); err != nil {
+				t.Fatal(err)
+			}
+			check(t, tx.Rollback())
+
+			if _, err := ls.GetThread(created); err != core.ErrThreadNotFound {
+				t.Fatalf("expected ErrThreadNotFound, got %v", err)
+			}
+			info, err := ls.GetThread(tid)
+			check(t, err)
+			if len(info.Logs) != 0 {
+				t.Fatalf("expected no logs, got %d", len(info.Logs))
+			}
+			name, err := ls.GetString(tid, "name")
+			check(t, err)
+			if name == nil || *name != "foo" {
+				t.Fatalf("expected name to be restored, got %v", name)
+			}
+		})
+
+		t.Run("replace", func(t *testing.T) {
+			data, err := ls.ExportThread(tid)
+			check(t, err)
+			tx, err := tr.BeginTxn(false)
+			check(t, err)
+			check(t, tx.DeleteThread(tid))
+			if _, err := tx.GetThread(tid); err != core.ErrThreadNotFound {
+				t.Fatalf("expected ErrThreadNotFound, got %v", err)
+			}
+			check(t, tx.Rollback())
+			name, err := ls.GetString(tid, "name")
+			check(t, err)
+			if name == nil || *name != "foo" {
+				t.Fatalf("expected deleted thread to be restored, got %v", name)
+			}
+
+			tx, err = tr.BeginTxn(false)
+			check(t, err)
+			check(t, tx.DeleteThread(tid))
+			check(t, tx.ImportThread(data))
+			check(t, tx.Commit())
+			name, err = ls.GetString(tid, "name")
+			check(t, err)
+			if name == nil || *name != "foo" {
+				t.Fatalf("expected thread to be imported, got %v", name)
+			}
+		})
+
+		t.Run("events", func(t *testing.T) {
+			var events []core.Event
+			unregister := ls.RegisterHook(core.Hook{
+				OnPut: func(ev core.Event) {
+					if ev.Thread.Equals(tid) {
+						events = append(events, ev)
+					}
+				},
+			})
+			defer unregister()
+
+			tx, err := tr.BeginTxn(false)
+			check(t, err)
+			check(t, tx.PutString(tid, "name", "bar"))
+			if len(events) != 0 {
+				t.Fatalf("expected events to be held until commit, got %v", events)
+			}
+			check(t, tx.Rollback())
+			if len(events) != 0 {
+				t.Fatalf("expected events to be dropped on rollback, got %v", events)
+			}
+
+			tx, err = tr.BeginTxn(false)
+			check(t, err)
+			check(t, tx.PutString(tid, "name", "foo"))
+			check(t, tx.Commit())
+			if len(events) != 1 || events[0].Type != core.MetaChanged || events[0].Key != "name" {
+				t.Fatalf("expected metadata change on commit, got %v", events)
+			}
+		})
+
+		t.Run("buffering", func(t *testing.T) {
+			tx, err := tr.BeginTxn(false)
+			check(t, err)
+			check(t, tx.PutString(tid, "name", "bar"))
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			check(t, tx.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv}))
+			check(t, tx.AddAddrs(tid, p, getAddrs(t, 1), time.Hour))
+
+			// writes are seen by the transaction only
+			lg, err := tx.GetLog(tid, p)
+			check(t, err)
+			if lg.PrivKey == nil || !lg.Managed || len(lg.Addrs) != 1 {
+				t.Fatalf("expected transaction to read its writes, got %v", lg)
+			}
+			// book reads may be blocked by the transaction until it's done,
+			// but never observe its writes
+			read := make(chan error, 1)
+			go func() {
+				name, err := ls.GetString(tid, "name")
+				if err == nil && (name == nil || *name != "foo") {
+					err = fmt.Errorf("expected write to be buffered, got %v", name)
+				}
+				if err == nil {
+					var pk crypto.PubKey
+					if pk, err = ls.PubKey(tid, p); err == nil && pk != nil {
+						err = fmt.Errorf("expected log to be buffered")
+					}
+				}
+				read <- err
+			}()
+			select {
+			case err := <-read:
+				check(t, err)
+				check(t, tx.Rollback())
+			case <-time.After(time.Millisecond * 100):
+				check(t, tx.Rollback())
+				check(t, <-read)
+			}
+		})
+
+		t.Run("failed commit", func(t *testing.T) {
+			created := thread.NewIDV1(thread.Raw, 24)
+			tx, err := tr.BeginTxn(false)
+			check(t, err)
+			check(t, tx.PutString(tid, "name", "bar"))
+			check(t, tx.AddThread(thread.Info{ID: created, Key: thread.NewRandomKey()}))
+			priv, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			_, other, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			check(t, tx.AddLog(tid, thread.LogInfo{ID: p, PubKey: other}))
+			if err := tx.Commit(); err == nil {
+				t.Fatal("expected commit of a mismatching key to fail")
+			}
+
+			if _, err := ls.GetThread(created); err != core.ErrThreadNotFound {
+				t.Fatalf("expected ErrThreadNotFound, got %v", err)
+			}
+			name, err := ls.GetString(tid, "name")
+			check(t, err)
+			if name == nil || *name != "foo" {
+				t.Fatalf("expected name to be reverted, got %v", name)
+			}
+		})
+
+		t.Run("isolation", func(t *testing.T) {
+			tx, err := tr.BeginTxn(false)
+			check(t, err)
+			priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.LogIDFromPrivKey(priv)
+			check(t, tx.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv}))
+
+			read := make(chan thread.Info)
+			go func() {
+				info, _ := ls.GetThread(tid)
+				read <- info
+			}()
+			select {
+			case <-read:
+				t.Fatal("reader wasn't blocked by the transaction")
+			case <-time.After(time.Millisecond * 100):
+			}
+			check(t, tx.AddAddrs(tid, p, getAddrs(t, 1), time.Hour))
+			check(t, tx.Commit())
+			if info := <-read; len(info.Logs) != 1 || len(info.Logs[0].Addrs) != 1 {
+				t.Fatalf("reader observed partial thread: %v", info.Logs)
+			}
+		})
+	}
+}
+
+func testThreadsPaged(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		existing, err := ls.Threads()
+		check(t, err)
+		for i := 0; i < 10; i++ {
+			tid := thread.NewIDV1(thread.Raw, 24)
+			check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+			_, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+			p, _ := thread.NewLogID(pub)
+			lg := thread.LogInfo{ID: p, PubKey: pub}
+			if i%2 == 0 {
+				// listed from both keys and addresses
+				lg.Addrs = getAddrs(t, 1)
+			}
+			check(t, ls.AddLog(tid, lg))
+		}
+		all, err := ls.Threads()
+		check(t, err)
+		if len(all) != len(existing)+10 {
+			t.Fatalf("expected %d threads, got %d", len(existing)+10, len(all))
+		}
+		sort.Sort(all)
+
+		var paged thread.IDSlice
+		for offset := 0; offset < len(all); offset += 3 {
+			page, err := ls.ThreadsPaged(offset, 3)
+			check(t, err)
+			if len(page) > 3 {
+				t.Fatalf("expected at most 3 threads, got %d", len(page))
+			}
+			paged = append(paged, page...)
+		}
+		if len(paged) != len(all) {
+			t.Fatalf("expected %d paged threads, got %d", len(all), len(paged))
+		}
+		for i := range all {
+			if paged[i] != all[i] {
+				t.Fatalf("thread %d mismatch: %s != %s", i, paged[i], all[i])
+			}
+		}
+		rest, err := ls.ThreadsPaged(len(all), 0)
+		check(t, err)
+		if len(rest) != 0 {
+			t.Fatalf("expected empty page, got %d threads", len(rest))
+		}
+		if _, err := ls.ThreadsPaged(-1, 0); err == nil {
+			t.Fatal("expected negative offset to fail")
+		}
+
+		picked := map[thread.ID]bool{all[1]: true, all[4]: true}
+		filtered, err := ls.ThreadsFilter(func(id thread.ID) bool {
+			return picked[id]
+		})
+		check(t, err)
+		if len(filtered) != len(picked) {
+			t.Fatalf("expected %d filtered threads, got %d", len(picked), len(filtered))
+		}
+		for _, id := range filtered {
+			if !picked[id] {
+				t.Fatalf("unexpected thread %s", id)
+			}
+		}
+	}
+}
+
+// LogstoreDiskUsageTest checks that the size of threads is reported by
+// logstores wrapping their books, e.g. with observers, quotas or strict
+// checks.
+func LogstoreDiskUsageTest(t *testing.T, factory LogstoreFactory) {
+	ls, closeFunc := factory()
+	if closeFunc != nil {
+		defer closeFunc()
+	}
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	check(t, ls.CreateThread(tid))
+	check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+	priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	p, _ := thread.LogIDFromPrivKey(priv)
+	check(t, ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: getAddrs(t, 2)}))
+	check(t, ls.PutString(tid, "name", "foo"))
+
+	size, err := ls.ThreadDiskUsage(tid)
+	check(t, err)
+	if size <= 0 {
+		t.Fatalf("expected thread size, got %d", size)
+	}
+	stats, err := ls.Stats()
+	check(t, err)
+	if stats.PerThread[tid].Size != size || stats.Total.Size < size {
+		t.Fatalf("expected thread size %d in stats, got %+v", size, stats)
+	}
+}
+
+func testStats(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		before, err := ls.Stats()
+		check(t, err)
+
+		tid := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+		priv, pub, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p, _ := thread.LogIDFromPrivKey(priv)
+		check(t, ls.AddLog(tid, thread.LogInfo{ID: p, PubKey: pub, PrivKey: priv, Addrs: getAddrs(t, 3)}))
+		_, pub2, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		p2, _ := thread.NewLogID(pub2)
+		check(t, ls.AddLog(tid, thread.LogInfo{ID: p2, PubKey: pub2, Addrs: getAddrs(t, 1)}))
+		check(t, ls.PutString(tid, "name", "foo"))
+
+		stats, err := ls.Stats()
+		check(t, err)
+		ts, ok := stats.PerThread[tid]
+		if !ok {
+			t.Fatal("expected thread stats")
+		}
+		// managed flag of the owned log is stored as metadata too
+		expected := core.ThreadStats{Logs: 2, Addrs: 4, Keys: 5, Meta: 2, Size: ts.Size}
+		if ts != expected {
+			t.Fatalf("expected %+v, got %+v", expected, ts)
+		}
+		if stats.Threads != before.Threads+1 {
+			t.Fatalf("expected %d threads, got %d", before.Threads+1, stats.Threads)
+		}
+		if stats.Total.Logs != before.Total.Logs+2 || stats.Total.Addrs != before.Total.Addrs+4 {
+			t.Fatalf("unexpected totals %+v, before %+v", stats.Total, before.Total)
+		}
+	}
+}
+
+func testThreadNames(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		nb := names(t, ls)
+		t1, t2 := thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24)
+		if err := nb.SetThreadName(t1, "alpha"); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		check(t, ls.CreateThread(t1, core.WithThreadName("alpha")))
+		if err := ls.CreateThread(t2, core.WithThreadName("alpha")); err != core.ErrThreadNameTaken {
+			t.Fatalf("expected ErrThreadNameTaken, got %v", err)
+		}
+		check(t, ls.CreateThread(t2))
+		if err := nb.SetThreadName(t2, "alpha"); err != core.ErrThreadNameTaken {
+			t.Fatalf("expected ErrThreadNameTaken, got %v", err)
+		}
+		check(t, nb.SetThreadName(t2, "beta"))
+		// renaming to the own name is fine
+		check(t, nb.SetThreadName(t2, "beta"))
+
+		id, err := nb.ThreadByName("alpha")
+		check(t, err)
+		if !id.Equals(t1) {
+			t.Fatalf("expected %s, got %s", t1, id)
+		}
+		if _, err := nb.ThreadByName("gamma"); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		names, err := nb.ThreadNames()
+		check(t, err)
+		if len(names) != 2 || !names["alpha"].Equals(t1) || !names["beta"].Equals(t2) {
+			t.Fatalf("unexpected names: %v", names)
+		}
+
+		// unnamed threads free their names
+		check(t, nb.SetThreadName(t1, ""))
+		if _, err := nb.ThreadByName("alpha"); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		check(t, nb.SetThreadName(t2, "alpha"))
+	}
+}
+
+func testPins(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		pb := pins(t, ls)
+		tids := []thread.ID{thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24)}
+		if err := pb.Pin(tids[0], 1); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		for _, tid := range tids {
+			check(t, ls.CreateThread(tid))
+		}
+		check(t, pb.Pin(tids[0], 1))
+		check(t, pb.Pin(tids[1], 5))
+		pins, err := pb.PinnedThreads()
 		check(t, err)
-		if len(threads) != 10 {
-			t.Fatal("expected ten threads, got", len(threads))
+		if len(pins) != 2 || !pins[0].Thread.Equals(tids[1]) || pins[0].Priority != 5 ||
+			!pins[1].Thread.Equals(tids[0]) || pins[1].Priority != 1 {
+			t.Fatalf("unexpected pins: %v", pins)
 		}
 
-		info, err := ls.GetThread(tids[0])
+		// pinning again changes the priority
+		check(t, pb.Pin(tids[0], 10))
+		pins, err = pb.PinnedThreads()
 		check(t, err)
-		tsAddrs, err := ls.Addrs(info.ID, info.Logs[0].ID)
-		if err != nil {
-			t.Fatalf("error when getting addresses: %v", err)
+		if len(pins) != 2 || !pins[0].Thread.Equals(tids[0]) || pins[0].Priority != 10 {
+			t.Fatalf("unexpected pins: %v", pins)
 		}
-		if !tsAddrs[0].Equal(addrs[0]) {
-			t.Fatal("stored wrong address")
+
+		// pinned threads are not evicted
+		cold := ds.NewMapDatastore()
+		if err := ls.ArchiveThread(tids[0], cold); err != core.ErrThreadPinned {
+			t.Fatalf("expected ErrThreadPinned, got %v", err)
 		}
+		check(t, ls.ArchiveThread(tids[2], cold))
 
-		log, err := ls.GetLog(info.ID, info.Logs[0].ID)
+		check(t, pb.Unpin(tids[0]))
+		check(t, ls.ArchiveThread(tids[0], cold))
+		check(t, ls.DeleteThread(tids[1]))
+		pins, err = pb.PinnedThreads()
 		check(t, err)
-		if !log.Addrs[0].Equal(addrs[0]) {
-			t.Fatal("stored wrong address")
+		if len(pins) != 0 {
+			t.Fatalf("expected no pins, got %v", pins)
 		}
+	}
+}
 
-		// Test add entire log
+func testAccessBook(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		ab := access(t, ls)
 		tid := thread.NewIDV1(thread.Raw, 24)
-		priv, pub, _ := crypto.GenerateKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-		p, _ := peer.IDFromPrivateKey(priv)
-		err = ls.AddLog(tid, thread.LogInfo{
-			ID:      p,
-			PubKey:  pub,
-			PrivKey: priv,
-			Addrs:   getAddrs(t, 1),
-		})
+		idents := make([]thread.PubKey, 3)
+		for i := range idents {
+			_, pk, err := crypto.GenerateEd25519Key(rand.New(rand.NewSource(int64(i))))
+			check(t, err)
+			idents[i] = thread.NewLibp2pPubKey(pk)
+		}
+		if err := ab.SetRole(tid, idents[0], core.Owner); err != core.ErrThreadNotFound {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		check(t, ls.CreateThread(tid))
+		if err := ab.SetRole(tid, idents[0], core.Role(42)); err != core.ErrInvalidRole {
+			t.Fatalf("expected ErrInvalidRole, got %v", err)
+		}
+		check(t, ab.SetRole(tid, idents[0], core.Owner))
+		check(t, ab.SetRole(tid, idents[1], core.Reader))
+
+		role, err := ab.Role(tid, idents[1])
 		check(t, err)
-		log, err = ls.GetLog(tid, p)
+		if role != core.Reader {
+			t.Fatalf("expected Reader, got %s", role)
+		}
+		role, err = ab.Role(tid, idents[2])
 		check(t, err)
+		if role != core.NoRole {
+			t.Fatalf("expected NoRole, got %s", role)
+		}
+		for _, c := range []struct {
+			ident    thread.PubKey
+			role     core.Role
+			expected bool
+		}{
+			{idents[0], core.Writer, true},
+			{idents[1], core.Reader, true},
+			{idents[1], core.Writer, false},
+			{idents[2], core.Reader, false},
+		} {
+			ok, err := ab.HasRole(tid, c.ident, c.role)
+			check(t, err)
+			if ok != c.expected {
+				t.Fatalf("expected HasRole(%s) to be %t", c.role, c.expected)
+			}
+		}
 
-		// Test delete log
-		err = ls.DeleteLog(tid, p)
+		members, err := ab.Members(tid)
 		check(t, err)
-		if _, err = ls.GetLog(tid, p); err != core.ErrLogNotFound {
-			t.Fatal("log was not deleted")
+		if len(members) != 2 {
+			t.Fatalf("expected 2 members, got %d", len(members))
+		}
+		for _, m := range members {
+			expected, err := ab.Role(tid, m.Identity)
+			check(t, err)
+			if m.Role != expected {
+				t.Fatalf("expected %s, got %s", expected, m.Role)
+			}
 		}
 
-		// Test delete thread (add the log back to the store)
-		err = ls.AddLog(tid, thread.LogInfo{
-			ID:      p,
-			PubKey:  pub,
-			PrivKey: priv,
-			Addrs:   getAddrs(t, 1),
-		})
-		check(t, err)
-		log, err = ls.GetLog(tid, p)
+		// revoked identities are not members anymore
+		check(t, ab.SetRole(tid, idents[1], core.NoRole))
+		members, err = ab.Members(tid)
 		check(t, err)
+		if len(members) != 1 || !members[0].Identity.Equals(idents[0]) {
+			t.Fatalf("unexpected members: %v", members)
+		}
+	}
+}
 
-		err = ls.DeleteThread(tid)
-		check(t, err)
-		if _, err = ls.GetThread(tid); err != core.ErrThreadNotFound {
-			t.Fatal("thread was not deleted")
+// testConcurrency hammers the logstore with mixed operations on overlapping
+// threads. It is meant to be run with the race detector.
+func testConcurrency(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		const (
+			numThreads = 4
+			numLogs    = 8
+			numWorkers = 32
+			numOps     = 20
+		)
+
+		tids := make([]thread.ID, numThreads)
+		lids := make(map[thread.ID][]thread.LogID, numThreads)
+		for i := range tids {
+			tids[i] = thread.NewIDV1(thread.Raw, 24)
+			check(t, ls.AddThread(thread.Info{ID: tids[i], Key: thread.NewRandomKey()}))
+			for j := 0; j < numLogs; j++ {
+				_, pk, err := crypto.GenerateEd25519Key(nil)
+				check(t, err)
+				lid, err := thread.NewLogID(pk)
+				check(t, err)
+				check(t, ls.AddLog(tids[i], thread.LogInfo{ID: lid, PubKey: pk}))
+				lids[tids[i]] = append(lids[tids[i]], lid)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		streams := make([]<-chan core.LogAddr, numThreads)
+		for i, tid := range tids {
+			var err error
+			streams[i], err = ls.ThreadAddrStream(ctx, tid)
+			check(t, err)
+		}
+
+		// expected addresses of each thread, keyed by log and address
+		expected := make([]map[string]bool, numThreads)
+		for i := range expected {
+			expected[i] = make(map[string]bool)
+		}
+		for w := 0; w < numWorkers; w++ {
+			for j := 0; j < numOps; j++ {
+				i := (w + j) % numThreads
+				lid := lids[tids[i]][j%numLogs]
+				expected[i][string(lid)+concurrencyAddr(w, j).String()] = true
+			}
+		}
+
+		// drain the streams while writing
+		delivered := make([]map[string]bool, numThreads)
+		streamsDone := make(chan error, numThreads)
+		for i := range streams {
+			delivered[i] = make(map[string]bool)
+			go func(i int) {
+				timeout := time.After(time.Minute)
+				for len(delivered[i]) < len(expected[i]) {
+					select {
+					case la, ok := <-streams[i]:
+						if !ok {
+							streamsDone <- fmt.Errorf("stream of thread %s closed early", tids[i])
+							return
+						}
+						key := string(la.Log) + la.Addr.String()
+						if !expected[i][key] {
+							streamsDone <- fmt.Errorf("unexpected address %s of log %s", la.Addr, la.Log)
+							return
+						}
+						if delivered[i][key] {
+							streamsDone <- fmt.Errorf("address %s of log %s delivered twice", la.Addr, la.Log)
+							return
+						}
+						delivered[i][key] = true
+					case <-timeout:
+						streamsDone <- fmt.Errorf("stream of thread %s delivered %d of %d addresses", tids[i], len(delivered[i]), len(expected[i]))
+						return
+					}
+				}
+				streamsDone <- nil
+			}(i)
+		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < numWorkers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for j := 0; j < numOps; j++ {
+					tid := tids[(w+j)%numThreads]
+					lid := lids[tid][j%numLogs]
+					if err := ls.AddAddr(tid, lid, concurrencyAddr(w, j), time.Hour); err != nil {
+						t.Errorf("adding address: %v", err)
+						return
+					}
+					if err := ls.PutString(tid, fmt.Sprintf("%d-%d", w, j), "value"); err != nil {
+						t.Errorf("putting metadata: %v", err)
+						return
+					}
+					if _, err := ls.Addrs(tid, lid); err != nil {
+						t.Errorf("getting addresses: %v", err)
+						return
+					}
+					if pk, err := ls.PubKey(tid, lid); err != nil || pk == nil {
+						t.Errorf("getting public key: %v", err)
+						return
+					}
+					if _, err := ls.GetThread(tid); err != nil {
+						t.Errorf("getting thread: %v", err)
+						return
+					}
+					if _, err := ls.Threads(); err != nil {
+						t.Errorf("listing threads: %v", err)
+						return
+					}
+					if j%5 == 0 {
+						// short-lived streams come and go
+						sctx, scancel := context.WithCancel(ctx)
+						if _, err := ls.ThreadAddrStream(sctx, tid); err != nil {
+							t.Errorf("opening stream: %v", err)
+						}
+						scancel()
+					}
+				}
+			}(w)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Minute):
+			t.Fatal("workers deadlocked")
+		}
+		if t.Failed() {
+			return
+		}
+
+		for range streams {
+			if err := <-streamsDone; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i, tid := range tids {
+			for _, lid := range lids[tid] {
+				addrs, err := ls.Addrs(tid, lid)
+				check(t, err)
+				for _, addr := range addrs {
+					delete(expected[i], string(lid)+addr.String())
+				}
+			}
+			if len(expected[i]) != 0 {
+				t.Fatalf("lost %d addresses of thread %s", len(expected[i]), tid)
+			}
+		}
+		for w := 0; w < numWorkers; w++ {
+			for j := 0; j < numOps; j++ {
+				tid := tids[(w+j)%numThreads]
+				v, err := ls.GetString(tid, fmt.Sprintf("%d-%d", w, j))
+				check(t, err)
+				if v == nil || *v != "value" {
+					t.Fatalf("lost metadata %d-%d of thread %s", w, j, tid)
+				}
+			}
+		}
+	}
+}
+
+func concurrencyAddr(worker, op int) ma.Multiaddr {
+	return Multiaddr(fmt.Sprintf("/ip4/10.0.%d.%d/tcp/4006", worker, op))
+}
+
+func equalThreads(t *testing.T, expected, actual thread.Info) {
+	if !expected.ID.Equals(actual.ID) {
+		t.Fatalf("thread ID mismatch: %s != %s", expected.ID, actual.ID)
+	}
+	if !bytes.Equal(expected.Key.Bytes(), actual.Key.Bytes()) {
+		t.Fatal("thread key mismatch")
+	}
+	if len(expected.Logs) != len(actual.Logs) {
+		t.Fatalf("expected %d logs, got %d", len(expected.Logs), len(actual.Logs))
+	}
+	logs := make(map[thread.LogID]thread.LogInfo, len(actual.Logs))
+	for _, lg := range actual.Logs {
+		logs[lg.ID] = lg
+	}
+	for _, exp := range expected.Logs {
+		act, ok := logs[exp.ID]
+		if !ok {
+			t.Fatalf("log %s is missing", exp.ID)
+		}
+		if !exp.PubKey.Equals(act.PubKey) {
+			t.Fatalf("public key mismatch for log %s", exp.ID)
+		}
+		if (exp.PrivKey == nil) != (act.PrivKey == nil) ||
+			(exp.PrivKey != nil && !exp.PrivKey.Equals(act.PrivKey)) {
+			t.Fatalf("private key mismatch for log %s", exp.ID)
+		}
+		AssertAddressesEqual(t, exp.Addrs, act.Addrs)
+		if !exp.Head.Equals(act.Head) {
+			t.Fatalf("head mismatch for log %s", exp.ID)
+		}
+		if exp.Managed != act.Managed {
+			t.Fatalf("managed flag mismatch for log %s", exp.ID)
 		}
 	}
 }
@@ -320,7 +2309,7 @@ func testLogstoreManaged(ls core.Logstore) func(t *testing.T) {
 		err = ls.AddReadKey(tid, sym.New())
 		check(t, err)
 		priv, pub, _ := crypto.GenerateKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-		p, _ := peer.IDFromPrivateKey(priv)
+		p, _ := thread.LogIDFromPrivKey(priv)
 		err = ls.AddAddr(tid, p, addrs[0], pstore.PermanentAddrTTL)
 		check(t, err)
 		err = ls.AddPubKey(tid, p, pub)
@@ -340,7 +2329,7 @@ func testLogstoreManaged(ls core.Logstore) func(t *testing.T) {
 
 		// Test adding owned log to existing thread
 		priv, pub, _ = crypto.GenerateKeyPair(crypto.RSA, crypto.MinRsaKeyBits)
-		p, _ = peer.IDFromPrivateKey(priv)
+		p, _ = thread.LogIDFromPrivKey(priv)
 		err = ls.AddLog(tid, thread.LogInfo{
 			ID:      p,
 			PubKey:  pub,
@@ -405,6 +2394,76 @@ func testMetadata(ls core.Logstore) func(t *testing.T) {
 	}
 }
 
+func testReservedMetadata(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		nb := names(t, ls)
+		pb := pins(t, ls)
+		ab := access(t, ls)
+		tid := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.CreateThread(tid, core.WithThreadName("reserved")))
+		_, pk, err := crypto.GenerateEd25519Key(rand.New(rand.NewSource(0)))
+		check(t, err)
+		ident := thread.NewLibp2pPubKey(pk)
+		check(t, ab.SetRole(tid, ident, core.Owner))
+		check(t, pb.Pin(tid, 1))
+		check(t, ls.PutString(tid, "app", "value"))
+
+		for name, write := range map[string]func() error{
+			"PutInt64":         func() error { return ls.PutInt64(tid, core.MetaThreadPinned, 0) },
+			"PutString":        func() error { return ls.PutString(tid, core.MetaThreadName, "other") },
+			"PutBool":          func() error { return ls.PutBool(tid, core.MetaThreadArchived, true) },
+			"PutBytes":         func() error { return ls.PutBytes(tid, core.MetaThreadTags, nil) },
+			"PutMetaWithTTL":   func() error { return ls.PutMetaWithTTL(tid, core.MetaThreadCreated, int64(0), time.Hour) },
+			"DeleteMetaPrefix": func() error { return ls.DeleteMetaPrefix(tid, core.MetaThreadAccess) },
+			"DeleteMetaPrefix with slashes": func() error {
+				return ls.DeleteMetaPrefix(tid, "/"+core.MetaThreadName+"/")
+			},
+			"DeleteMetaPrefix with dot segments": func() error {
+				return ls.DeleteMetaPrefix(tid, "app/../"+core.MetaThreadName)
+			},
+		} {
+			if err := write(); err != core.ErrReservedKey {
+				t.Fatalf("expected %s of a reserved key to fail with ErrReservedKey, got %v", name, err)
+			}
+		}
+
+		// prefixes of every key would delete reserved keys too
+		for _, prefix := range []string{"", "/", "//", "."} {
+			if err := ls.DeleteMetaPrefix(tid, prefix); err != core.ErrInvalidMetaKey {
+				t.Fatalf("expected deleting prefix %q to fail with ErrInvalidMetaKey, got %v", prefix, err)
+			}
+		}
+		val, err := ls.GetString(tid, "app")
+		check(t, err)
+		if val == nil || *val != "value" {
+			t.Fatalf("expected metadata to be kept, got %v", val)
+		}
+
+		// clearing metadata keeps reserved keys
+		check(t, ls.ClearMetadata(tid))
+		val, err = ls.GetString(tid, "app")
+		check(t, err)
+		if val != nil {
+			t.Fatal("expected metadata to be cleared")
+		}
+		id, err := nb.ThreadByName("reserved")
+		check(t, err)
+		if !id.Equals(tid) {
+			t.Fatalf("expected thread name to be kept, got %s", id)
+		}
+		role, err := ab.Role(tid, ident)
+		check(t, err)
+		if role != core.Owner {
+			t.Fatalf("expected role to be kept, got %s", role)
+		}
+		pins, err := pb.PinnedThreads()
+		check(t, err)
+		if len(pins) != 1 || !pins[0].Thread.Equals(tid) {
+			t.Fatalf("expected thread to stay pinned, got %v", pins)
+		}
+	}
+}
+
 func getAddrs(t *testing.T, n int) []ma.Multiaddr {
 	var addrs []ma.Multiaddr
 	for i := 0; i < n; i++ {
@@ -417,3 +2476,332 @@ func getAddrs(t *testing.T, n int) []ma.Multiaddr {
 	}
 	return addrs
 }
+
+func testErrors(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		if _, err := ls.GetThread(tid); !errors.Is(err, core.ErrThreadNotFound) {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+		check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+
+		lg, other := randomLog(t), randomLog(t)
+		if _, err := ls.GetLog(tid, lg.ID); !errors.Is(err, core.ErrLogNotFound) {
+			t.Fatalf("expected ErrLogNotFound, got %v", err)
+		}
+
+		otherSk, _, err := crypto.GenerateEd25519Key(nil)
+		check(t, err)
+		for name, err := range map[string]error{
+			"AddPubKey":     ls.AddPubKey(tid, lg.ID, other.PubKey),
+			"AddPrivKey":    ls.AddPrivKey(tid, lg.ID, otherSk),
+			"AddReadKey":    ls.AddReadKey(tid, nil),
+			"AddServiceKey": ls.AddServiceKey(tid, nil),
+		} {
+			if !errors.Is(err, core.ErrInvalidKey) {
+				t.Fatalf("%s: expected ErrInvalidKey, got %v", name, err)
+			}
+		}
+		if _, err := ls.RotateReadKey(tid, nil); !errors.Is(err, core.ErrInvalidKey) {
+			t.Fatalf("RotateReadKey: expected ErrInvalidKey, got %v", err)
+		}
+	}
+}
+
+func testClose(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+		lg := randomLog(t)
+		check(t, ls.AddLog(tid, lg))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		addrs, err := ls.AddrStream(ctx, tid, lg.ID)
+		check(t, err)
+		logAddrs, err := ls.ThreadAddrStream(ctx, tid)
+		check(t, err)
+		events, err := ls.Subscribe(ctx, tid)
+		check(t, err)
+
+		check(t, ls.Close())
+
+		// streams in flight are closed
+		timeout := time.After(5 * time.Second)
+		for addrs != nil || logAddrs != nil || events != nil {
+			select {
+			case _, ok := <-addrs:
+				if !ok {
+					addrs = nil
+				}
+			case _, ok := <-logAddrs:
+				if !ok {
+					logAddrs = nil
+				}
+			case _, ok := <-events:
+				if !ok {
+					events = nil
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for streams to be closed")
+			}
+		}
+
+		if _, err := ls.GetThread(tid); !errors.Is(err, core.ErrClosed) {
+			t.Fatalf("GetThread: expected ErrClosed, got %v", err)
+		}
+		if _, err := ls.Threads(); !errors.Is(err, core.ErrClosed) {
+			t.Fatalf("Threads: expected ErrClosed, got %v", err)
+		}
+		if err := ls.AddThread(thread.Info{ID: thread.NewIDV1(thread.Raw, 24), Key: thread.NewRandomKey()}); !errors.Is(err, core.ErrClosed) {
+			t.Fatalf("AddThread: expected ErrClosed, got %v", err)
+		}
+		if err := ls.PutString(tid, "name", "foo"); !errors.Is(err, core.ErrClosed) {
+			t.Fatalf("PutString: expected ErrClosed, got %v", err)
+		}
+		if _, err := ls.Subscribe(ctx, tid); !errors.Is(err, core.ErrClosed) {
+			t.Fatalf("Subscribe: expected ErrClosed, got %v", err)
+		}
+		if err := ls.Close(); !errors.Is(err, core.ErrClosed) {
+			t.Fatalf("Close: expected ErrClosed, got %v", err)
+		}
+	}
+}
+
+func testThreadHandles(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		if _, err := ls.GetThreadHandle(thread.NewIDV1(thread.Raw, 24)); !errors.Is(err, core.ErrThreadNotFound) {
+			t.Fatalf("expected ErrThreadNotFound, got %v", err)
+		}
+
+		tids := make(map[thread.ID]thread.Key)
+		for i := 0; i < 3; i++ {
+			tid, key := thread.NewIDV1(thread.Raw, 24), thread.NewRandomKey()
+			check(t, ls.AddThread(thread.Info{ID: tid, Key: key}))
+			check(t, ls.AddLog(tid, randomLog(t)))
+			tids[tid] = key
+		}
+
+		handles, err := ls.ThreadHandles()
+		check(t, err)
+		if len(handles) != len(tids) {
+			t.Fatalf("expected %d handles, got %d", len(tids), len(handles))
+		}
+		for _, h := range handles {
+			if h.Loaded() {
+				t.Fatalf("expected thread %s not to be loaded", h.ID)
+			}
+			key, err := h.Key()
+			check(t, err)
+			if !bytes.Equal(key.Bytes(), tids[h.ID].Bytes()) {
+				t.Fatalf("got bad key of thread %s", h.ID)
+			}
+			if h.Loaded() {
+				t.Fatal("expected loading keys not to load logs")
+			}
+		}
+
+		h, err := ls.GetThreadHandle(handles[0].ID)
+		check(t, err)
+		info, err := h.Info()
+		check(t, err)
+		expected, err := ls.GetThread(h.ID)
+		check(t, err)
+		if !h.Loaded() || !info.ID.Equals(expected.ID) || len(info.Logs) != 1 || info.Logs[0].ID != expected.Logs[0].ID {
+			t.Fatalf("expected info %v, got %v", expected, info)
+		}
+
+		// loaded info is kept until the handle is reset
+		check(t, ls.AddLog(h.ID, randomLog(t)))
+		if info, err = h.Info(); err != nil || len(info.Logs) != 1 {
+			t.Fatalf("expected loaded info to be kept, got %d logs (%v)", len(info.Logs), err)
+		}
+		h.Reset()
+		if info, err = h.Info(); err != nil || len(info.Logs) != 2 {
+			t.Fatalf("expected info to be reloaded, got %d logs (%v)", len(info.Logs), err)
+		}
+	}
+}
+
+func testLogsToThreads(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		lg := randomLog(t)
+		t1, t2, t3 := thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddThread(thread.Info{ID: t1, Key: thread.NewRandomKey()}))
+		check(t, ls.AddPubKey(t1, lg.ID, lg.PubKey))
+		check(t, ls.AddAddr(t2, lg.ID, Multiaddr("/ip4/1.2.3.4/tcp/4006"), time.Hour))
+		check(t, ls.AddThread(thread.Info{ID: t3, Key: thread.NewRandomKey()}))
+		check(t, ls.AddLog(t3, lg))
+		check(t, ls.AddLog(t3, randomLog(t)))
+
+		assertLogThreads := func(expected ...thread.ID) {
+			t.Helper()
+			tids, err := ls.LogsToThreads(lg.ID)
+			check(t, err)
+			if len(tids) != len(expected) {
+				t.Fatalf("expected threads %v, got %v", expected, tids)
+			}
+			for _, id := range expected {
+				var found bool
+				for _, tid := range tids {
+					found = found || tid.Equals(id)
+				}
+				if !found {
+					t.Fatalf("expected thread %s in %v", id, tids)
+				}
+			}
+		}
+
+		assertLogThreads(t1, t2, t3)
+		if tids, err := ls.LogsToThreads(randomLog(t).ID); err != nil || len(tids) != 0 {
+			t.Fatalf("expected no threads of unknown log, got %v (%v)", tids, err)
+		}
+
+		check(t, ls.ClearAddrs(t2, lg.ID))
+		assertLogThreads(t1, t3)
+		check(t, ls.DeleteLog(t3, lg.ID))
+		assertLogThreads(t1)
+		check(t, ls.DeleteThread(t1))
+		assertLogThreads()
+	}
+}
+
+func testReplaceAddr(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		var (
+			old, repl, other = Multiaddr("/ip4/1.1.1.1/tcp/4006"), Multiaddr("/ip4/2.2.2.2/tcp/4006"), Multiaddr("/ip4/3.3.3.3/tcp/4006")
+			t1, t2           = thread.NewIDV1(thread.Raw, 24), thread.NewIDV1(thread.Raw, 24)
+			l1, l2, l3       = randomLog(t).ID, randomLog(t).ID, randomLog(t).ID
+		)
+		check(t, ls.AddAddrs(t1, l1, []ma.Multiaddr{old, other}, time.Hour))
+		check(t, ls.AddAddr(t2, l2, old, time.Hour))
+		check(t, ls.AddAddr(t2, l3, other, time.Hour))
+
+		assertLogs := func(addr ma.Multiaddr, expected ...core.ThreadLog) {
+			t.Helper()
+			logs, err := ls.LogsWithAddr(addr)
+			check(t, err)
+			if len(logs) != len(expected) {
+				t.Fatalf("expected logs %v with %s, got %v", expected, addr, logs)
+			}
+			for _, tl := range expected {
+				var found bool
+				for _, l := range logs {
+					found = found || l.Thread.Equals(tl.Thread) && l.Log == tl.Log
+				}
+				if !found {
+					t.Fatalf("expected log %s of thread %s with %s", tl.Log, tl.Thread, addr)
+				}
+			}
+		}
+
+		assertLogs(old, core.ThreadLog{Thread: t1, Log: l1}, core.ThreadLog{Thread: t2, Log: l2})
+		updated, err := ls.ReplaceAddr(old, repl, time.Hour)
+		check(t, err)
+		if len(updated) != 2 {
+			t.Fatalf("expected 2 updated logs, got %v", updated)
+		}
+		assertLogs(old)
+		assertLogs(repl, core.ThreadLog{Thread: t1, Log: l1}, core.ThreadLog{Thread: t2, Log: l2})
+		assertLogs(other, core.ThreadLog{Thread: t1, Log: l1}, core.ThreadLog{Thread: t2, Log: l3})
+		addrs, err := ls.Addrs(t1, l1)
+		check(t, err)
+		AssertAddressesEqual(t, []ma.Multiaddr{repl, other}, addrs)
+
+		check(t, ls.ClearAddrs(t1, l1))
+		assertLogs(repl, core.ThreadLog{Thread: t2, Log: l2})
+	}
+}
+
+func testAddLogAddrsBulk(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		var (
+			addrs   = getAddrs(t, 4)
+			lid     = randomLog(t).ID
+			entries []core.ThreadLogAddrs
+		)
+		for i := 0; i < 3; i++ {
+			entries = append(entries, core.ThreadLogAddrs{Thread: thread.NewIDV1(thread.Raw, 24), Log: lid, Addrs: addrs[i : i+1]})
+		}
+		// entries of the same log are merged
+		entries = append(entries, core.ThreadLogAddrs{Thread: entries[0].Thread, Log: lid, Addrs: addrs[3:]})
+		check(t, ls.AddLogAddrsBulk(entries, time.Hour))
+
+		for i, e := range entries[:3] {
+			got, err := ls.Addrs(e.Thread, lid)
+			check(t, err)
+			expected := addrs[i : i+1]
+			if i == 0 {
+				expected = []ma.Multiaddr{addrs[0], addrs[3]}
+			}
+			AssertAddressesEqual(t, expected, got)
+		}
+		tids, err := ls.LogsToThreads(lid)
+		check(t, err)
+		if len(tids) != 3 {
+			t.Fatalf("expected the log in 3 threads, got %v", tids)
+		}
+
+		// nothing is added with zero ttl
+		other := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddLogAddrsBulk([]core.ThreadLogAddrs{{Thread: other, Log: lid, Addrs: addrs}}, 0))
+		if got, err := ls.Addrs(other, lid); err != nil || len(got) != 0 {
+			t.Fatalf("expected no addresses, got %v (%v)", got, err)
+		}
+	}
+}
+
+func testLogsForPeer(ls core.Logstore) func(t *testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+		peerSk, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		owner, _ := peer.IDFromPrivateKey(peerSk)
+
+		// two logs of the peer, e.g. of different devices, and one unowned
+		var owned thread.LogIDSlice
+		for i := 0; i < 3; i++ {
+			lid, sk, pk, err := thread.NewLogKeys()
+			check(t, err)
+			lg := thread.LogInfo{ID: lid, PubKey: pk, PrivKey: sk}
+			if i < 2 {
+				lg.Peer = owner
+				owned = append(owned, lid)
+			}
+			check(t, ls.AddLog(tid, lg))
+		}
+
+		logs, err := ls.LogsForPeer(tid, owner)
+		check(t, err)
+		sort.Sort(logs)
+		sort.Sort(owned)
+		if len(logs) != len(owned) || logs[0] != owned[0] || logs[1] != owned[1] {
+			t.Fatalf("expected logs %v of the peer, got %v", owned, logs)
+		}
+		lg, err := ls.GetLog(tid, owned[0])
+		check(t, err)
+		if lg.Peer != owner {
+			t.Fatalf("expected log of peer %s, got %s", owner, lg.Peer)
+		}
+
+		check(t, ls.DeleteLog(tid, owned[0]))
+		logs, err = ls.LogsForPeer(tid, owner)
+		check(t, err)
+		if len(logs) != 1 || logs[0] != owned[1] {
+			t.Fatalf("expected log %s of the peer after deletion, got %v", owned[1], logs)
+		}
+		// no tombstones of the deleted log are left in the metadata
+		keys, err := ls.MetaKeys(tid)
+		check(t, err)
+		for _, k := range keys {
+			if strings.HasPrefix(k, owned[0].Pretty()) {
+				t.Fatalf("expected no metadata of the deleted log, got %s", k)
+			}
+		}
+
+		other := thread.NewIDV1(thread.Raw, 24)
+		if logs, err = ls.LogsForPeer(other, owner); err != nil || len(logs) != 0 {
+			t.Fatalf("expected no logs of the peer in another thread, got %v (%v)", logs, err)
+		}
+	}
+}
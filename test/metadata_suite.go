@@ -3,6 +3,7 @@ package test
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	core "github.com/textileio/go-threads/core/logstore"
 	"github.com/textileio/go-threads/core/thread"
@@ -23,7 +24,10 @@ var metadataBookSuite = map[string]func(mb core.ThreadMetadata) func(*testing.T)
 	"Byte":           testMetadataBookBytes,
 	"NotFound":       testMetadataBookNotFound,
 	"ClearMetadata":  testClearMetadata,
+	"MetaKeys":       testMetadataBookKeys,
+	"DeletePrefix":   testMetadataBookDeletePrefix,
 	"ExportMetadata": testMetadataBookExport,
+	"TTL":            testMetadataBookTTL,
 }
 
 type MetadataBookFactory func() (core.ThreadMetadata, func())
@@ -183,6 +187,104 @@ func testClearMetadata(mb core.ThreadMetadata) func(*testing.T) {
 	}
 }
 
+func testMetadataBookKeys(mb core.ThreadMetadata) func(*testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		other := thread.NewIDV1(thread.Raw, 24)
+
+		keys, err := mb.MetaKeys(tid)
+		if err != nil {
+			t.Fatalf("listing keys failed: %v", err)
+		}
+		if len(keys) != 0 {
+			t.Fatalf("expected no keys, got %v", keys)
+		}
+
+		if err := mb.PutInt64(tid, "b", 1); err != nil {
+			t.Fatalf(errStrPut, "b", err)
+		}
+		if err := mb.PutString(tid, "a", "v"); err != nil {
+			t.Fatalf(errStrPut, "a", err)
+		}
+		if err := mb.PutBool(tid, "log/flag", true); err != nil {
+			t.Fatalf(errStrPut, "log/flag", err)
+		}
+		if err := mb.PutBytes(other, "c", []byte("v")); err != nil {
+			t.Fatalf(errStrPut, "c", err)
+		}
+
+		keys, err = mb.MetaKeys(tid)
+		if err != nil {
+			t.Fatalf("listing keys failed: %v", err)
+		}
+		expected := []string{"a", "b", "log/flag"}
+		if len(keys) != len(expected) {
+			t.Fatalf(errStrValueMatch, expected, keys)
+		}
+		for i := range expected {
+			if keys[i] != expected[i] {
+				t.Fatalf(errStrValueMatch, expected, keys)
+			}
+		}
+	}
+}
+
+func testMetadataBookDeletePrefix(mb core.ThreadMetadata) func(*testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+		other := thread.NewIDV1(thread.Raw, 24)
+
+		for _, key := range []string{"app/ui", "app/ui/theme", "app/ui/font/size", "app/uix", "app/db", "core"} {
+			if err := mb.PutString(tid, key, "v"); err != nil {
+				t.Fatalf(errStrPut, key, err)
+			}
+		}
+		if err := mb.PutString(other, "app/ui/theme", "v"); err != nil {
+			t.Fatalf(errStrPut, "app/ui/theme", err)
+		}
+
+		// books take reserved keys, which only reserved prefixes delete
+		reserved := mb.PutString(tid, core.MetaThreadName, "v") == nil
+
+		for _, prefix := range []string{"", "/", "//", "."} {
+			if err := mb.DeleteMetaPrefix(tid, prefix); err != core.ErrInvalidMetaKey {
+				t.Fatalf("expected deleting prefix %q to fail with ErrInvalidMetaKey, got %v", prefix, err)
+			}
+		}
+		if err := mb.DeleteMetaPrefix(tid, "/app/ui/"); err != nil {
+			t.Fatalf("deleting prefix failed: %v", err)
+		}
+
+		for key, exists := range map[string]bool{
+			"app/ui":            false,
+			"app/ui/theme":      false,
+			"app/ui/font/size":  false,
+			"app/uix":           true,
+			"app/db":            true,
+			"core":              true,
+			core.MetaThreadName: reserved,
+		} {
+			v, err := mb.GetString(tid, key)
+			if err != nil {
+				t.Fatalf(errStrGet, key, err)
+			}
+			if exists && v == nil {
+				t.Fatalf("%s: %s", errStrValueShouldExist, key)
+			}
+			if !exists && v != nil {
+				t.Fatalf("%s: %s", errStrValueShouldNotExist, key)
+			}
+		}
+		v, err := mb.GetString(other, "app/ui/theme")
+		if err != nil {
+			t.Fatalf(errStrGet, "app/ui/theme", err)
+		}
+		if v == nil {
+			t.Fatal("metadata of another thread was deleted")
+		}
+	}
+}
+
 func testMetadataBookExport(mb core.ThreadMetadata) func(*testing.T) {
 	return func(t *testing.T) {
 		var (
@@ -276,3 +378,114 @@ func testMetadataBookExport(mb core.ThreadMetadata) func(*testing.T) {
 		}
 	}
 }
+
+func testMetadataBookTTL(mb core.ThreadMetadata) func(*testing.T) {
+	return func(t *testing.T) {
+		tid := thread.NewIDV1(thread.Raw, 24)
+
+		if err := mb.PutMetaWithTTL(tid, "bad", 42, time.Hour); err == nil {
+			t.Fatal("expected unsupported value type to be rejected")
+		}
+		for _, ttl := range []time.Duration{0, -time.Second} {
+			if err := mb.PutMetaWithTTL(tid, "bad", int64(42), ttl); err != core.ErrInvalidTTL {
+				t.Fatalf("expected ErrInvalidTTL for TTL %v, got %v", ttl, err)
+			}
+		}
+		if err := mb.PutMetaWithTTL(tid, "presence", "online", time.Millisecond*50); err != nil {
+			t.Fatalf(errStrPut, "presence", err)
+		}
+		if err := mb.PutMetaWithTTL(tid, "renewed", int64(1), time.Millisecond*50); err != nil {
+			t.Fatalf(errStrPut, "renewed", err)
+		}
+		if err := mb.PutMetaWithTTL(tid, "lasting", true, time.Hour); err != nil {
+			t.Fatalf(errStrPut, "lasting", err)
+		}
+		// storing without a TTL makes the key permanent
+		if err := mb.PutInt64(tid, "renewed", 2); err != nil {
+			t.Fatalf(errStrPut, "renewed", err)
+		}
+		v, err := mb.GetString(tid, "presence")
+		if err != nil {
+			t.Fatalf(errStrGet, "presence", err)
+		}
+		if v == nil || *v != "online" {
+			t.Fatalf(errStrValueMatch, "online", v)
+		}
+
+		time.Sleep(time.Millisecond * 100)
+
+		if v, err = mb.GetString(tid, "presence"); err != nil {
+			t.Fatalf(errStrGet, "presence", err)
+		}
+		if v != nil {
+			t.Fatalf("%s: %s", errStrValueShouldNotExist, "presence")
+		}
+		renewed, err := mb.GetInt64(tid, "renewed")
+		if err != nil {
+			t.Fatalf(errStrGet, "renewed", err)
+		}
+		if renewed == nil || *renewed != 2 {
+			t.Fatalf(errStrValueMatch, 2, renewed)
+		}
+		lasting, err := mb.GetBool(tid, "lasting")
+		if err != nil {
+			t.Fatalf(errStrGet, "lasting", err)
+		}
+		if lasting == nil || !*lasting {
+			t.Fatalf(errStrValueMatch, true, lasting)
+		}
+
+		keys, err := mb.MetaKeys(tid)
+		if err != nil {
+			t.Fatalf("listing keys failed: %v", err)
+		}
+		if len(keys) != 2 || keys[0] != "lasting" || keys[1] != "renewed" {
+			t.Fatalf(errStrValueMatch, []string{"lasting", "renewed"}, keys)
+		}
+		dump, err := mb.DumpMeta()
+		if err != nil {
+			t.Fatalf("dumping metadata failed: %v", err)
+		}
+		if _, ok := dump.Data.String[core.MetadataKey{T: tid, K: "presence"}]; ok {
+			t.Fatal("expired key shouldn't be dumped")
+		}
+
+		// restored values keep expiring
+		if err := mb.PutMetaWithTTL(tid, "leased", "yes", time.Millisecond*100); err != nil {
+			t.Fatalf(errStrPut, "leased", err)
+		}
+		if dump, err = mb.DumpMeta(); err != nil {
+			t.Fatalf("dumping metadata failed: %v", err)
+		}
+		if _, ok := dump.Expires[core.MetadataKey{T: tid, K: "leased"}]; !ok {
+			t.Fatal("expiration time of a key stored with a TTL wasn't dumped")
+		}
+		if _, ok := dump.Expires[core.MetadataKey{T: tid, K: "renewed"}]; ok {
+			t.Fatal("permanent key shouldn't have an expiration time")
+		}
+		if err := mb.RestoreMeta(dump); err != nil {
+			t.Fatalf("restoring metadata failed: %v", err)
+		}
+		if v, err = mb.GetString(tid, "leased"); err != nil {
+			t.Fatalf(errStrGet, "leased", err)
+		}
+		if v == nil || *v != "yes" {
+			t.Fatalf(errStrValueMatch, "yes", v)
+		}
+
+		time.Sleep(time.Millisecond * 150)
+
+		if v, err = mb.GetString(tid, "leased"); err != nil {
+			t.Fatalf(errStrGet, "leased", err)
+		}
+		if v != nil {
+			t.Fatalf("%s: %s", errStrValueShouldNotExist, "leased")
+		}
+		if lasting, err = mb.GetBool(tid, "lasting"); err != nil {
+			t.Fatalf(errStrGet, "lasting", err)
+		}
+		if lasting == nil || !*lasting {
+			t.Fatalf(errStrValueMatch, true, lasting)
+		}
+	}
+}
@@ -0,0 +1,1597 @@
+package test
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	sym "github.com/textileio/go-threads/crypto/symmetric"
+)
+
+// MockLogstore is a logstore test double whose operations can be programmed
+// to fail, be delayed or return canned data, e.g. to test the error handling
+// of services without a real store. Operations are named after the methods
+// of core.Logstore and its optional capabilities, e.g. core.NameBook.
+// Operations that are not programmed to fail or return data
+// are forwarded to the wrapped logstore, or return zero values if there is none.
+type MockLogstore struct {
+	ls core.Logstore
+
+	lk    sync.Mutex
+	ops   map[string]*mockOp
+	calls map[string]int
+}
+
+var (
+	_ core.Logstore    = (*MockLogstore)(nil)
+	_ core.NameBook    = (*MockLogstore)(nil)
+	_ core.PinBook     = (*MockLogstore)(nil)
+	_ core.AccessBook  = (*MockLogstore)(nil)
+	_ core.Inviter     = (*MockLogstore)(nil)
+	_ core.Snapshotter = (*MockLogstore)(nil)
+	_ core.Transactor  = (*MockLogstore)(nil)
+)
+
+type mockOp struct {
+	err     error
+	delay   time.Duration
+	results []interface{}
+}
+
+// NewMockLogstore returns a mock wrapping the logstore, which may be nil.
+func NewMockLogstore(ls core.Logstore) *MockLogstore {
+	return &MockLogstore{
+		ls:    ls,
+		ops:   make(map[string]*mockOp),
+		calls: make(map[string]int),
+	}
+}
+
+// Fail makes the operation return err. Operations without an error result
+// are not affected.
+func (m *MockLogstore) Fail(op string, err error) {
+	m.program(op, func(o *mockOp) { o.err = err })
+}
+
+// Delay makes the operation sleep for d before running.
+func (m *MockLogstore) Delay(op string, d time.Duration) {
+	m.program(op, func(o *mockOp) { o.delay = d })
+}
+
+// Return makes the operation return canned results, in order and excluding
+// the error. Results must have the types of the method results, nil values
+// return zero values.
+func (m *MockLogstore) Return(op string, results ...interface{}) {
+	m.program(op, func(o *mockOp) { o.results = results })
+}
+
+// Reset removes the programmed behavior of the operation, or of all
+// operations if op is empty.
+func (m *MockLogstore) Reset(op string) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if op == "" {
+		m.ops = make(map[string]*mockOp)
+	} else {
+		delete(m.ops, op)
+	}
+}
+
+// Calls returns the number of calls of the operation.
+func (m *MockLogstore) Calls(op string) int {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return m.calls[op]
+}
+
+func (m *MockLogstore) program(op string, fn func(*mockOp)) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	o, ok := m.ops[op]
+	if !ok {
+		o = &mockOp{}
+		m.ops[op] = o
+	}
+	fn(o)
+}
+
+// intercept counts a call of the operation and applies its delay. It returns
+// a copy of the programmed behavior, if any.
+func (m *MockLogstore) intercept(op string) *mockOp {
+	m.lk.Lock()
+	m.calls[op]++
+	o, ok := m.ops[op]
+	var cp mockOp
+	if ok {
+		cp = *o
+	}
+	m.lk.Unlock()
+	if !ok {
+		return nil
+	}
+	if cp.delay > 0 {
+		time.Sleep(cp.delay)
+	}
+	return &cp
+}
+
+// canned returns whether the operation must not be forwarded.
+func (o *mockOp) canned() bool {
+	return o != nil && (o.err != nil || o.results != nil)
+}
+
+// set assigns canned results to the pointers.
+func (o *mockOp) set(ptrs ...interface{}) {
+	for i, p := range ptrs {
+		if i < len(o.results) && o.results[i] != nil {
+			reflect.ValueOf(p).Elem().Set(reflect.ValueOf(o.results[i]))
+		}
+	}
+}
+
+func (m *MockLogstore) AcceptInvite(invite []byte, password string) (r0 thread.Info, err error) {
+	if op := m.intercept("AcceptInvite"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	inv, err := core.Invites(m.ls)
+	if err != nil {
+		return
+	}
+	return inv.AcceptInvite(invite, password)
+}
+
+func (m *MockLogstore) AddAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, d time.Duration) error {
+	if op := m.intercept("AddAddr"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddAddr(t, l, addr, d)
+}
+
+func (m *MockLogstore) AddAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, d time.Duration) error {
+	if op := m.intercept("AddAddrs"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddAddrs(t, l, addrs, d)
+}
+
+func (m *MockLogstore) AddAddrsFromSource(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, d time.Duration, src core.AddrSource) error {
+	if op := m.intercept("AddAddrsFromSource"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddAddrsFromSource(t, l, addrs, d, src)
+}
+
+func (m *MockLogstore) AddHead(t thread.ID, l thread.LogID, c cid.Cid) error {
+	if op := m.intercept("AddHead"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddHead(t, l, c)
+}
+
+func (m *MockLogstore) AddHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	if op := m.intercept("AddHeads"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddHeads(t, l, heads)
+}
+
+func (m *MockLogstore) AddLog(t thread.ID, lg thread.LogInfo) error {
+	if op := m.intercept("AddLog"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddLog(t, lg)
+}
+
+func (m *MockLogstore) AddLogAddrsBulk(entries []core.ThreadLogAddrs, d time.Duration) error {
+	if op := m.intercept("AddLogAddrsBulk"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddLogAddrsBulk(entries, d)
+}
+
+func (m *MockLogstore) AddPrivKey(t thread.ID, l thread.LogID, sk crypto.PrivKey) error {
+	if op := m.intercept("AddPrivKey"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddPrivKey(t, l, sk)
+}
+
+func (m *MockLogstore) AddPubKey(t thread.ID, l thread.LogID, pk crypto.PubKey) error {
+	if op := m.intercept("AddPubKey"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddPubKey(t, l, pk)
+}
+
+func (m *MockLogstore) AddReadKey(t thread.ID, key *sym.Key) error {
+	if op := m.intercept("AddReadKey"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddReadKey(t, key)
+}
+
+func (m *MockLogstore) AddServiceKey(t thread.ID, key *sym.Key) error {
+	if op := m.intercept("AddServiceKey"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddServiceKey(t, key)
+}
+
+func (m *MockLogstore) AddThread(info thread.Info) error {
+	if op := m.intercept("AddThread"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.AddThread(info)
+}
+
+func (m *MockLogstore) AddrStream(ctx context.Context, t thread.ID, l thread.LogID) (r0 <-chan ma.Multiaddr, err error) {
+	if op := m.intercept("AddrStream"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.AddrStream(ctx, t, l)
+}
+
+func (m *MockLogstore) Addrs(t thread.ID, l thread.LogID) (r0 []ma.Multiaddr, err error) {
+	if op := m.intercept("Addrs"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Addrs(t, l)
+}
+
+func (m *MockLogstore) AddrsWithSource(t thread.ID, l thread.LogID) (r0 []core.ExpiredAddress, err error) {
+	if op := m.intercept("AddrsWithSource"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.AddrsWithSource(t, l)
+}
+
+func (m *MockLogstore) Archive(t thread.ID, w io.Writer) error {
+	if op := m.intercept("Archive"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.Archive(t, w)
+}
+
+func (m *MockLogstore) ArchiveThread(t thread.ID, store ds.Datastore) error {
+	if op := m.intercept("ArchiveThread"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ArchiveThread(t, store)
+}
+
+func (m *MockLogstore) ArchivedThreads(store ds.Datastore) (r0 thread.IDSlice, err error) {
+	if op := m.intercept("ArchivedThreads"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ArchivedThreads(store)
+}
+
+func (m *MockLogstore) Batch() (r0 core.Batch) {
+	if op := m.intercept("Batch"); op.canned() {
+		op.set(&r0)
+		return r0
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Batch()
+}
+
+func (m *MockLogstore) BeginTxn(readonly bool) (r0 core.Txn, err error) {
+	if op := m.intercept("BeginTxn"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	tr, err := core.Transactions(m.ls)
+	if err != nil {
+		return
+	}
+	return tr.BeginTxn(readonly)
+}
+
+func (m *MockLogstore) ClearAddrs(t thread.ID, l thread.LogID) error {
+	if op := m.intercept("ClearAddrs"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ClearAddrs(t, l)
+}
+
+func (m *MockLogstore) ClearHeads(t thread.ID, l thread.LogID) error {
+	if op := m.intercept("ClearHeads"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ClearHeads(t, l)
+}
+
+func (m *MockLogstore) ClearKeys(t thread.ID) error {
+	if op := m.intercept("ClearKeys"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ClearKeys(t)
+}
+
+func (m *MockLogstore) ClearLogKeys(t thread.ID, l thread.LogID) error {
+	if op := m.intercept("ClearLogKeys"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ClearLogKeys(t, l)
+}
+
+func (m *MockLogstore) ClearMetadata(t thread.ID) error {
+	if op := m.intercept("ClearMetadata"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ClearMetadata(t)
+}
+
+func (m *MockLogstore) Close() error {
+	if op := m.intercept("Close"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.Close()
+}
+
+func (m *MockLogstore) ConsumeLogRecord(t thread.ID, rec *record.Envelope, d time.Duration) (r0 bool, err error) {
+	if op := m.intercept("ConsumeLogRecord"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ConsumeLogRecord(t, rec, d)
+}
+
+func (m *MockLogstore) ControlledAddrStream(ctx context.Context, t thread.ID, l thread.LogID) (r0 <-chan ma.Multiaddr, r1 core.AddrStreamControl, err error) {
+	if op := m.intercept("ControlledAddrStream"); op.canned() {
+		op.set(&r0, &r1)
+		return r0, r1, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ControlledAddrStream(ctx, t, l)
+}
+
+func (m *MockLogstore) CreateInvite(t thread.ID, withReadKey bool, password string) (r0 []byte, err error) {
+	if op := m.intercept("CreateInvite"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	inv, err := core.Invites(m.ls)
+	if err != nil {
+		return
+	}
+	return inv.CreateInvite(t, withReadKey, password)
+}
+
+func (m *MockLogstore) CreateThread(t thread.ID, opts ...core.ThreadOption) error {
+	if op := m.intercept("CreateThread"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.CreateThread(t, opts...)
+}
+
+func (m *MockLogstore) DeleteLog(t thread.ID, l thread.LogID) error {
+	if op := m.intercept("DeleteLog"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.DeleteLog(t, l)
+}
+
+func (m *MockLogstore) DeleteMetaPrefix(t thread.ID, prefix string) error {
+	if op := m.intercept("DeleteMetaPrefix"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.DeleteMetaPrefix(t, prefix)
+}
+
+func (m *MockLogstore) DeleteThread(t thread.ID) error {
+	if op := m.intercept("DeleteThread"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.DeleteThread(t)
+}
+
+func (m *MockLogstore) DumpAddrs() (r0 core.DumpAddrBook, err error) {
+	if op := m.intercept("DumpAddrs"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.DumpAddrs()
+}
+
+func (m *MockLogstore) DumpCanonical(w io.Writer) error {
+	if op := m.intercept("DumpCanonical"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.DumpCanonical(w)
+}
+
+func (m *MockLogstore) DumpHeads() (r0 core.DumpHeadBook, err error) {
+	if op := m.intercept("DumpHeads"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.DumpHeads()
+}
+
+func (m *MockLogstore) DumpKeys() (r0 core.DumpKeyBook, err error) {
+	if op := m.intercept("DumpKeys"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.DumpKeys()
+}
+
+func (m *MockLogstore) DumpMeta() (r0 core.DumpMetadata, err error) {
+	if op := m.intercept("DumpMeta"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.DumpMeta()
+}
+
+func (m *MockLogstore) Events(ctx context.Context) (r0 <-chan core.Event) {
+	if op := m.intercept("Events"); op.canned() {
+		op.set(&r0)
+		return r0
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Events(ctx)
+}
+
+func (m *MockLogstore) ExportKeys(t thread.ID, passphrase string) (r0 []byte, err error) {
+	if op := m.intercept("ExportKeys"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ExportKeys(t, passphrase)
+}
+
+func (m *MockLogstore) ExportThread(t thread.ID) (r0 []byte, err error) {
+	if op := m.intercept("ExportThread"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ExportThread(t)
+}
+
+func (m *MockLogstore) ForEachLogAddr(t thread.ID, l thread.LogID, fn func(ma.Multiaddr) bool) error {
+	if op := m.intercept("ForEachLogAddr"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ForEachLogAddr(t, l, fn)
+}
+
+func (m *MockLogstore) GetBool(t thread.ID, key string) (r0 *bool, err error) {
+	if op := m.intercept("GetBool"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetBool(t, key)
+}
+
+func (m *MockLogstore) GetBytes(t thread.ID, key string) (r0 *[]byte, err error) {
+	if op := m.intercept("GetBytes"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetBytes(t, key)
+}
+
+func (m *MockLogstore) GetInt64(t thread.ID, key string) (r0 *int64, err error) {
+	if op := m.intercept("GetInt64"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetInt64(t, key)
+}
+
+func (m *MockLogstore) GetLog(t thread.ID, l thread.LogID) (r0 thread.LogInfo, err error) {
+	if op := m.intercept("GetLog"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetLog(t, l)
+}
+
+func (m *MockLogstore) GetLogBool(t thread.ID, l thread.LogID, key string) (r0 *bool, err error) {
+	if op := m.intercept("GetLogBool"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetLogBool(t, l, key)
+}
+
+func (m *MockLogstore) GetLogBytes(t thread.ID, l thread.LogID, key string) (r0 *[]byte, err error) {
+	if op := m.intercept("GetLogBytes"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetLogBytes(t, l, key)
+}
+
+func (m *MockLogstore) GetLogInt64(t thread.ID, l thread.LogID, key string) (r0 *int64, err error) {
+	if op := m.intercept("GetLogInt64"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetLogInt64(t, l, key)
+}
+
+func (m *MockLogstore) GetLogString(t thread.ID, l thread.LogID, key string) (r0 *string, err error) {
+	if op := m.intercept("GetLogString"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetLogString(t, l, key)
+}
+
+func (m *MockLogstore) GetManagedLogs(t thread.ID) (r0 []thread.LogInfo, err error) {
+	if op := m.intercept("GetManagedLogs"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetManagedLogs(t)
+}
+
+func (m *MockLogstore) GetString(t thread.ID, key string) (r0 *string, err error) {
+	if op := m.intercept("GetString"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetString(t, key)
+}
+
+func (m *MockLogstore) GetThread(t thread.ID) (r0 thread.Info, err error) {
+	if op := m.intercept("GetThread"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetThread(t)
+}
+
+func (m *MockLogstore) GetThreadFull(t thread.ID) (r0 core.ThreadInfoFull, err error) {
+	if op := m.intercept("GetThreadFull"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetThreadFull(t)
+}
+
+func (m *MockLogstore) GetThreadHandle(t thread.ID) (r0 *core.ThreadHandle, err error) {
+	if op := m.intercept("GetThreadHandle"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.GetThreadHandle(t)
+}
+
+func (m *MockLogstore) HasPrivKey(t thread.ID, l thread.LogID) (r0 bool, err error) {
+	if op := m.intercept("HasPrivKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.HasPrivKey(t, l)
+}
+
+func (m *MockLogstore) HasReadKey(t thread.ID) (r0 bool, err error) {
+	if op := m.intercept("HasReadKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.HasReadKey(t)
+}
+
+func (m *MockLogstore) HasRole(t thread.ID, id thread.PubKey, role core.Role) (r0 bool, err error) {
+	if op := m.intercept("HasRole"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	ab, err := core.Access(m.ls)
+	if err != nil {
+		return
+	}
+	return ab.HasRole(t, id, role)
+}
+
+func (m *MockLogstore) HasServiceKey(t thread.ID) (r0 bool, err error) {
+	if op := m.intercept("HasServiceKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.HasServiceKey(t)
+}
+
+func (m *MockLogstore) Heads(t thread.ID, l thread.LogID) (r0 []cid.Cid, err error) {
+	if op := m.intercept("Heads"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Heads(t, l)
+}
+
+func (m *MockLogstore) ImportKeys(b []byte, passphrase string) error {
+	if op := m.intercept("ImportKeys"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ImportKeys(b, passphrase)
+}
+
+func (m *MockLogstore) ImportThread(b []byte) error {
+	if op := m.intercept("ImportThread"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.ImportThread(b)
+}
+
+func (m *MockLogstore) IsArchived(t thread.ID) (r0 bool, err error) {
+	if op := m.intercept("IsArchived"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.IsArchived(t)
+}
+
+func (m *MockLogstore) IsRevoked(t thread.ID, l thread.LogID) (r0 bool, err error) {
+	if op := m.intercept("IsRevoked"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.IsRevoked(t, l)
+}
+
+func (m *MockLogstore) IssueCapability(t thread.ID, issuer thread.LogID, subject peer.ID, role core.Role, ttl time.Duration) (r0 []byte, err error) {
+	if op := m.intercept("IssueCapability"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.IssueCapability(t, issuer, subject, role, ttl)
+}
+
+func (m *MockLogstore) LogRecord(t thread.ID, l thread.LogID) (r0 *record.Envelope, err error) {
+	if op := m.intercept("LogRecord"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.LogRecord(t, l)
+}
+
+func (m *MockLogstore) LogsForPeer(t thread.ID, p peer.ID) (r0 thread.LogIDSlice, err error) {
+	if op := m.intercept("LogsForPeer"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.LogsForPeer(t, p)
+}
+
+func (m *MockLogstore) LogsToThreads(l thread.LogID) (r0 thread.IDSlice, err error) {
+	if op := m.intercept("LogsToThreads"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.LogsToThreads(l)
+}
+
+func (m *MockLogstore) LogsWithAddr(addr ma.Multiaddr) (r0 []core.ThreadLog, err error) {
+	if op := m.intercept("LogsWithAddr"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.LogsWithAddr(addr)
+}
+
+func (m *MockLogstore) LogsWithAddrs(t thread.ID) (r0 thread.LogIDSlice, err error) {
+	if op := m.intercept("LogsWithAddrs"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.LogsWithAddrs(t)
+}
+
+func (m *MockLogstore) LogsWithKeys(t thread.ID) (r0 thread.LogIDSlice, err error) {
+	if op := m.intercept("LogsWithKeys"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.LogsWithKeys(t)
+}
+
+func (m *MockLogstore) Members(t thread.ID) (r0 []core.Member, err error) {
+	if op := m.intercept("Members"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	ab, err := core.Access(m.ls)
+	if err != nil {
+		return
+	}
+	return ab.Members(t)
+}
+
+func (m *MockLogstore) MetaKeys(t thread.ID) (r0 []string, err error) {
+	if op := m.intercept("MetaKeys"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.MetaKeys(t)
+}
+
+func (m *MockLogstore) Pin(t thread.ID, priority int) error {
+	if op := m.intercept("Pin"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	pb, err := core.Pins(m.ls)
+	if err != nil {
+		return err
+	}
+	return pb.Pin(t, priority)
+}
+
+func (m *MockLogstore) PinnedThreads() (r0 []core.Pin, err error) {
+	if op := m.intercept("PinnedThreads"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	pb, err := core.Pins(m.ls)
+	if err != nil {
+		return
+	}
+	return pb.PinnedThreads()
+}
+
+func (m *MockLogstore) PrivKey(t thread.ID, l thread.LogID) (r0 crypto.PrivKey, err error) {
+	if op := m.intercept("PrivKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.PrivKey(t, l)
+}
+
+func (m *MockLogstore) PubKey(t thread.ID, l thread.LogID) (r0 crypto.PubKey, err error) {
+	if op := m.intercept("PubKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.PubKey(t, l)
+}
+
+func (m *MockLogstore) PutBool(t thread.ID, key string, val bool) error {
+	if op := m.intercept("PutBool"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutBool(t, key, val)
+}
+
+func (m *MockLogstore) PutBytes(t thread.ID, key string, val []byte) error {
+	if op := m.intercept("PutBytes"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutBytes(t, key, val)
+}
+
+func (m *MockLogstore) PutInt64(t thread.ID, key string, val int64) error {
+	if op := m.intercept("PutInt64"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutInt64(t, key, val)
+}
+
+func (m *MockLogstore) PutLogBool(t thread.ID, l thread.LogID, key string, val bool) error {
+	if op := m.intercept("PutLogBool"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutLogBool(t, l, key, val)
+}
+
+func (m *MockLogstore) PutLogBytes(t thread.ID, l thread.LogID, key string, val []byte) error {
+	if op := m.intercept("PutLogBytes"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutLogBytes(t, l, key, val)
+}
+
+func (m *MockLogstore) PutLogInt64(t thread.ID, l thread.LogID, key string, val int64) error {
+	if op := m.intercept("PutLogInt64"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutLogInt64(t, l, key, val)
+}
+
+func (m *MockLogstore) PutLogString(t thread.ID, l thread.LogID, key string, val string) error {
+	if op := m.intercept("PutLogString"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutLogString(t, l, key, val)
+}
+
+func (m *MockLogstore) PutMetaWithTTL(t thread.ID, key string, val interface{}, ttl time.Duration) error {
+	if op := m.intercept("PutMetaWithTTL"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutMetaWithTTL(t, key, val, ttl)
+}
+
+func (m *MockLogstore) PutString(t thread.ID, key string, val string) error {
+	if op := m.intercept("PutString"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.PutString(t, key, val)
+}
+
+func (m *MockLogstore) ReadKey(t thread.ID) (r0 *sym.Key, err error) {
+	if op := m.intercept("ReadKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ReadKey(t)
+}
+
+func (m *MockLogstore) ReadKeyVersion(t thread.ID, version int) (r0 *sym.Key, err error) {
+	if op := m.intercept("ReadKeyVersion"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ReadKeyVersion(t, version)
+}
+
+func (m *MockLogstore) ReadKeyVersions(t thread.ID) (r0 []core.KeyVersion, err error) {
+	if op := m.intercept("ReadKeyVersions"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ReadKeyVersions(t)
+}
+
+func (m *MockLogstore) RecordDial(t thread.ID, l thread.LogID, addr ma.Multiaddr, d time.Duration) error {
+	if op := m.intercept("RecordDial"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.RecordDial(t, l, addr, d)
+}
+
+func (m *MockLogstore) RegisterHook(h core.Hook) (r0 func()) {
+	if op := m.intercept("RegisterHook"); op.canned() {
+		op.set(&r0)
+		return r0
+	}
+	if m.ls == nil {
+		return func() {}
+	}
+	return m.ls.RegisterHook(h)
+}
+
+func (m *MockLogstore) ReplaceAddr(old, repl ma.Multiaddr, ttl time.Duration) (r0 []core.ThreadLog, err error) {
+	if op := m.intercept("ReplaceAddr"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ReplaceAddr(old, repl, ttl)
+}
+
+func (m *MockLogstore) Restore(r io.Reader) error {
+	if op := m.intercept("Restore"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	sn, err := core.Snapshots(m.ls)
+	if err != nil {
+		return err
+	}
+	return sn.Restore(r)
+}
+
+func (m *MockLogstore) RestoreAddrs(book core.DumpAddrBook) error {
+	if op := m.intercept("RestoreAddrs"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.RestoreAddrs(book)
+}
+
+func (m *MockLogstore) RestoreHeads(dump core.DumpHeadBook) error {
+	if op := m.intercept("RestoreHeads"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.RestoreHeads(dump)
+}
+
+func (m *MockLogstore) RestoreKeys(book core.DumpKeyBook) error {
+	if op := m.intercept("RestoreKeys"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.RestoreKeys(book)
+}
+
+func (m *MockLogstore) RestoreMeta(book core.DumpMetadata) error {
+	if op := m.intercept("RestoreMeta"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.RestoreMeta(book)
+}
+
+func (m *MockLogstore) RevokePubKey(t thread.ID, l thread.LogID) error {
+	if op := m.intercept("RevokePubKey"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.RevokePubKey(t, l)
+}
+
+func (m *MockLogstore) Role(t thread.ID, id thread.PubKey) (r0 core.Role, err error) {
+	if op := m.intercept("Role"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	ab, err := core.Access(m.ls)
+	if err != nil {
+		return
+	}
+	return ab.Role(t, id)
+}
+
+func (m *MockLogstore) RotateReadKey(t thread.ID, key *sym.Key) (r0 int, err error) {
+	if op := m.intercept("RotateReadKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.RotateReadKey(t, key)
+}
+
+func (m *MockLogstore) RotateServiceKey(t thread.ID, key *sym.Key) (r0 int, err error) {
+	if op := m.intercept("RotateServiceKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.RotateServiceKey(t, key)
+}
+
+func (m *MockLogstore) ServiceKey(t thread.ID) (r0 *sym.Key, err error) {
+	if op := m.intercept("ServiceKey"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ServiceKey(t)
+}
+
+func (m *MockLogstore) ServiceKeyVersion(t thread.ID, version int) (r0 *sym.Key, err error) {
+	if op := m.intercept("ServiceKeyVersion"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ServiceKeyVersion(t, version)
+}
+
+func (m *MockLogstore) ServiceKeyVersions(t thread.ID) (r0 []core.KeyVersion, err error) {
+	if op := m.intercept("ServiceKeyVersions"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ServiceKeyVersions(t)
+}
+
+func (m *MockLogstore) SetAddr(t thread.ID, l thread.LogID, addr ma.Multiaddr, d time.Duration) error {
+	if op := m.intercept("SetAddr"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.SetAddr(t, l, addr, d)
+}
+
+func (m *MockLogstore) SetAddrs(t thread.ID, l thread.LogID, addrs []ma.Multiaddr, d time.Duration) error {
+	if op := m.intercept("SetAddrs"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.SetAddrs(t, l, addrs, d)
+}
+
+func (m *MockLogstore) SetHead(t thread.ID, l thread.LogID, c cid.Cid) error {
+	if op := m.intercept("SetHead"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.SetHead(t, l, c)
+}
+
+func (m *MockLogstore) SetHeads(t thread.ID, l thread.LogID, heads []cid.Cid) error {
+	if op := m.intercept("SetHeads"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.SetHeads(t, l, heads)
+}
+
+func (m *MockLogstore) SetRole(t thread.ID, id thread.PubKey, role core.Role) error {
+	if op := m.intercept("SetRole"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	ab, err := core.Access(m.ls)
+	if err != nil {
+		return err
+	}
+	return ab.SetRole(t, id, role)
+}
+
+func (m *MockLogstore) SetThreadName(t thread.ID, name string) error {
+	if op := m.intercept("SetThreadName"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	nb, err := core.Names(m.ls)
+	if err != nil {
+		return err
+	}
+	return nb.SetThreadName(t, name)
+}
+
+func (m *MockLogstore) Snapshot(w io.Writer) error {
+	if op := m.intercept("Snapshot"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	sn, err := core.Snapshots(m.ls)
+	if err != nil {
+		return err
+	}
+	return sn.Snapshot(w)
+}
+
+func (m *MockLogstore) SortedAddrs(t thread.ID, l thread.LogID) (r0 []ma.Multiaddr, err error) {
+	if op := m.intercept("SortedAddrs"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.SortedAddrs(t, l)
+}
+
+func (m *MockLogstore) Stats() (r0 core.Stats, err error) {
+	if op := m.intercept("Stats"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Stats()
+}
+
+func (m *MockLogstore) Subscribe(ctx context.Context, t thread.ID) (r0 <-chan core.Event, err error) {
+	if op := m.intercept("Subscribe"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Subscribe(ctx, t)
+}
+
+func (m *MockLogstore) ThreadAddrStream(ctx context.Context, t thread.ID) (r0 <-chan core.LogAddr, err error) {
+	if op := m.intercept("ThreadAddrStream"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadAddrStream(ctx, t)
+}
+
+func (m *MockLogstore) ThreadByName(name string) (r0 thread.ID, err error) {
+	if op := m.intercept("ThreadByName"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	nb, err := core.Names(m.ls)
+	if err != nil {
+		return
+	}
+	return nb.ThreadByName(name)
+}
+
+func (m *MockLogstore) ThreadDiskUsage(t thread.ID) (r0 int64, err error) {
+	if op := m.intercept("ThreadDiskUsage"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadDiskUsage(t)
+}
+
+func (m *MockLogstore) ThreadHandles() (r0 []*core.ThreadHandle, err error) {
+	if op := m.intercept("ThreadHandles"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadHandles()
+}
+
+func (m *MockLogstore) ThreadNames() (r0 map[string]thread.ID, err error) {
+	if op := m.intercept("ThreadNames"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	nb, err := core.Names(m.ls)
+	if err != nil {
+		return
+	}
+	return nb.ThreadNames()
+}
+
+func (m *MockLogstore) Threads() (r0 thread.IDSlice, err error) {
+	if op := m.intercept("Threads"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Threads()
+}
+
+func (m *MockLogstore) ThreadsFilter(filter func(thread.ID) bool) (r0 thread.IDSlice, err error) {
+	if op := m.intercept("ThreadsFilter"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadsFilter(filter)
+}
+
+func (m *MockLogstore) ThreadsFromAddrs() (r0 thread.IDSlice, err error) {
+	if op := m.intercept("ThreadsFromAddrs"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadsFromAddrs()
+}
+
+func (m *MockLogstore) ThreadsFromKeys() (r0 thread.IDSlice, err error) {
+	if op := m.intercept("ThreadsFromKeys"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadsFromKeys()
+}
+
+func (m *MockLogstore) ThreadsPaged(offset int, limit int) (r0 thread.IDSlice, err error) {
+	if op := m.intercept("ThreadsPaged"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadsPaged(offset, limit)
+}
+
+func (m *MockLogstore) ThreadsWithLogAddrs(l thread.LogID) (r0 thread.IDSlice, err error) {
+	if op := m.intercept("ThreadsWithLogAddrs"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadsWithLogAddrs(l)
+}
+
+func (m *MockLogstore) ThreadsWithLogKeys(l thread.LogID) (r0 thread.IDSlice, err error) {
+	if op := m.intercept("ThreadsWithLogKeys"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.ThreadsWithLogKeys(l)
+}
+
+func (m *MockLogstore) Unarchive(r io.Reader) (r0 thread.ID, err error) {
+	if op := m.intercept("Unarchive"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.Unarchive(r)
+}
+
+func (m *MockLogstore) UnarchiveThread(t thread.ID, store ds.Datastore) error {
+	if op := m.intercept("UnarchiveThread"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.UnarchiveThread(t, store)
+}
+
+func (m *MockLogstore) Unpin(t thread.ID) error {
+	if op := m.intercept("Unpin"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	pb, err := core.Pins(m.ls)
+	if err != nil {
+		return err
+	}
+	return pb.Unpin(t)
+}
+
+func (m *MockLogstore) UpdateAddrs(t thread.ID, id thread.LogID, oldTTL time.Duration, newTTL time.Duration) error {
+	if op := m.intercept("UpdateAddrs"); op.canned() {
+		return op.err
+	}
+	if m.ls == nil {
+		return nil
+	}
+	return m.ls.UpdateAddrs(t, id, oldTTL, newTTL)
+}
+
+func (m *MockLogstore) VerifyCapability(b []byte) (r0 core.Capability, err error) {
+	if op := m.intercept("VerifyCapability"); op.canned() {
+		op.set(&r0)
+		return r0, op.err
+	}
+	if m.ls == nil {
+		return
+	}
+	return m.ls.VerifyCapability(b)
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	"github.com/textileio/go-threads/logstore/lstoremem"
+)
+
+func TestMockLogstore(t *testing.T) {
+	m := NewMockLogstore(lstoremem.NewLogstore())
+	defer m.Close()
+	tid := thread.NewIDV1(thread.Raw, 24)
+	info := thread.Info{ID: tid, Key: thread.NewRandomKey()}
+
+	errFail := errors.New("fail")
+	m.Fail("AddThread", errFail)
+	if err := m.AddThread(info); err != errFail {
+		t.Fatalf("expected programmed error, got %v", err)
+	}
+	m.Reset("AddThread")
+	check(t, m.AddThread(info))
+	if calls := m.Calls("AddThread"); calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+
+	// unprogrammed operations are forwarded
+	key, err := m.ServiceKey(tid)
+	check(t, err)
+	if key == nil {
+		t.Fatal("expected the service key of the wrapped logstore")
+	}
+
+	canned := thread.IDSlice{thread.NewIDV1(thread.Raw, 24)}
+	m.Return("Threads", canned)
+	ids, err := m.Threads()
+	check(t, err)
+	if len(ids) != 1 || !ids[0].Equals(canned[0]) {
+		t.Fatalf("expected canned threads, got %v", ids)
+	}
+
+	m.Delay("GetThread", time.Millisecond*50)
+	start := time.Now()
+	got, err := m.GetThread(tid)
+	check(t, err)
+	if time.Since(start) < time.Millisecond*50 {
+		t.Fatal("expected the operation to be delayed")
+	}
+	if !got.ID.Equals(tid) {
+		t.Fatal("expected delayed operations to be forwarded")
+	}
+
+	m.Reset("")
+	if _, err := m.GetThread(thread.NewIDV1(thread.Raw, 24)); err != core.ErrThreadNotFound {
+		t.Fatalf("expected ErrThreadNotFound, got %v", err)
+	}
+}
+
+func TestMockLogstoreWithoutStore(t *testing.T) {
+	m := NewMockLogstore(nil)
+	ids, err := m.Threads()
+	if err != nil || ids != nil {
+		t.Fatalf("expected zero values, got %v, %v", ids, err)
+	}
+	m.Return("HasServiceKey", true)
+	if ok, err := m.HasServiceKey(thread.NewIDV1(thread.Raw, 24)); err != nil || !ok {
+		t.Fatalf("expected canned result, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,252 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
+	lstore "github.com/textileio/go-threads/logstore"
+)
+
+// QuotaLogstoreFactory creates logstores enforcing the quota.
+type QuotaLogstoreFactory func(lstore.Quota) (core.Logstore, func())
+
+// LogstoreQuotaTest checks that writes exceeding the quota of a thread are
+// rejected, while other threads are not affected.
+func LogstoreQuotaTest(t *testing.T, factory QuotaLogstoreFactory) {
+	ls, closeFunc := factory(lstore.Quota{MaxLogs: 2, MaxAddrs: 2, MaxMetaBytes: 32})
+	if closeFunc != nil {
+		defer closeFunc()
+	}
+
+	tid := thread.NewIDV1(thread.Raw, 24)
+	check(t, ls.AddThread(thread.Info{ID: tid, Key: thread.NewRandomKey()}))
+	logs := make([]thread.LogInfo, 3)
+	for i := range logs {
+		logs[i] = randomLog(t)
+	}
+
+	t.Run("logs", func(t *testing.T) {
+		check(t, ls.AddLog(tid, logs[0]))
+		check(t, ls.AddLog(tid, logs[1]))
+		// re-adding known logs is fine
+		check(t, ls.AddPubKey(tid, logs[1].ID, logs[1].PubKey))
+		assertQuotaError(t, ls.AddLog(tid, logs[2]), tid, core.QuotaLogs)
+		assertQuotaError(t, ls.AddAddr(tid, logs[2].ID, Multiaddr("/ip4/1.2.3.4/tcp/4006"), time.Hour), tid, core.QuotaLogs)
+
+		// other threads have their own quota
+		other := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddLog(other, logs[2]))
+
+		check(t, ls.DeleteLog(tid, logs[1].ID))
+		check(t, ls.AddLog(tid, logs[2]))
+	})
+
+	t.Run("addrs", func(t *testing.T) {
+		lid := logs[0].ID
+		check(t, ls.ClearAddrs(tid, lid))
+		a1, a2, a3 := Multiaddr("/ip4/1.1.1.1/tcp/4006"), Multiaddr("/ip4/2.2.2.2/tcp/4006"), Multiaddr("/ip4/3.3.3.3/tcp/4006")
+		check(t, ls.AddAddr(tid, lid, a1, time.Hour))
+		check(t, ls.SetAddr(tid, lid, a2, time.Hour))
+		// updating known addresses is fine
+		check(t, ls.AddAddrs(tid, lid, []ma.Multiaddr{a1, a2}, time.Hour))
+		assertQuotaError(t, ls.AddAddr(tid, lid, a3, time.Hour), tid, core.QuotaAddrs)
+		assertQuotaError(t, ls.AddAddrsFromSource(tid, lid, []ma.Multiaddr{a3}, time.Hour, core.AddrSourceUnknown), tid, core.QuotaAddrs)
+		addrs, err := ls.Addrs(tid, lid)
+		check(t, err)
+		if len(addrs) != 2 {
+			t.Fatalf("expected 2 addresses, got %v", addrs)
+		}
+
+		// removing addresses makes room
+		check(t, ls.SetAddr(tid, lid, a1, 0))
+		check(t, ls.AddAddr(tid, lid, a3, time.Hour))
+	})
+
+	t.Run("bulk", func(t *testing.T) {
+		bulk := thread.NewIDV1(thread.Raw, 24)
+		entries := make([]core.ThreadLogAddrs, 3)
+		for i := range entries {
+			entries[i] = core.ThreadLogAddrs{Thread: bulk, Log: randomLog(t).ID, Addrs: []ma.Multiaddr{Multiaddr("/ip4/1.2.3.4/tcp/4006")}}
+		}
+		// logs added together count toward the quota
+		assertQuotaError(t, ls.AddLogAddrsBulk(entries, time.Hour), bulk, core.QuotaLogs)
+		if logs, err := ls.LogsWithAddrs(bulk); err != nil || len(logs) != 0 {
+			t.Fatalf("expected rejected bulk to add nothing, got %v (%v)", logs, err)
+		}
+		check(t, ls.AddLogAddrsBulk(entries[:2], time.Hour))
+	})
+
+	t.Run("invites", func(t *testing.T) {
+		inv := invites(t, ls)
+		invited := thread.NewIDV1(thread.Raw, 24)
+		check(t, ls.AddThread(thread.Info{ID: invited, Key: thread.NewRandomKey()}))
+		check(t, ls.AddLog(invited, randomLog(t)))
+		check(t, ls.AddLog(invited, randomLog(t)))
+		invite, err := inv.CreateInvite(invited, true, "")
+		check(t, err)
+		check(t, ls.DeleteThread(invited))
+		known := randomLog(t)
+		check(t, ls.AddLog(invited, known))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := ls.Subscribe(ctx, invited)
+		check(t, err)
+
+		// the second log of the invite exceeds the quota
+		_, err = inv.AcceptInvite(invite, "")
+		assertQuotaError(t, err, invited, core.QuotaLogs)
+		sk, err := ls.ServiceKey(invited)
+		check(t, err)
+		lids, err := ls.LogsWithKeys(invited)
+		check(t, err)
+		if sk != nil || len(lids) != 1 || lids[0] != known.ID {
+			t.Fatalf("expected rejected invite to leave the thread as it was, got logs %v", lids)
+		}
+
+		// events of the rejected invite are not emitted
+		check(t, ls.PutInt64(invited, "done", 1))
+		for {
+			select {
+			case ev := <-events:
+				if ev.Type == core.MetaChanged && ev.Key == "done" {
+					return
+				}
+				t.Fatalf("unexpected event of a rejected invite: %v", ev)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for events")
+			}
+		}
+	})
+
+	t.Run("records", func(t *testing.T) {
+		certified := thread.NewIDV1(thread.Raw, 24)
+		seal := func(t *testing.T, sk crypto.PrivKey, seq uint64, addrs ...ma.Multiaddr) *record.Envelope {
+			lid, err := thread.LogIDFromPrivKey(sk)
+			check(t, err)
+			rec := peer.NewPeerRecord()
+			rec.PeerID = lid.Peer()
+			rec.Seq = seq
+			rec.Addrs = addrs
+			env, err := record.Seal(rec, sk)
+			check(t, err)
+			return env
+		}
+		keys := make([]crypto.PrivKey, 3)
+		for i := range keys {
+			sk, _, err := crypto.GenerateEd25519Key(nil)
+			check(t, err)
+			keys[i] = sk
+		}
+		a1, a2, a3 := Multiaddr("/ip4/1.1.1.1/tcp/4006"), Multiaddr("/ip4/2.2.2.2/tcp/4006"), Multiaddr("/ip4/3.3.3.3/tcp/4006")
+
+		_, err := ls.ConsumeLogRecord(certified, seal(t, keys[0], 1, a1), time.Hour)
+		check(t, err)
+		_, err = ls.ConsumeLogRecord(certified, seal(t, keys[1], 1, a1), time.Hour)
+		check(t, err)
+		// records add logs like addresses do
+		_, err = ls.ConsumeLogRecord(certified, seal(t, keys[2], 1, a1), time.Hour)
+		assertQuotaError(t, err, certified, core.QuotaLogs)
+		_, err = ls.ConsumeLogRecord(certified, seal(t, keys[0], 2, a1, a2, a3), time.Hour)
+		assertQuotaError(t, err, certified, core.QuotaAddrs)
+
+		// records replace addresses, so only their own count
+		accepted, err := ls.ConsumeLogRecord(certified, seal(t, keys[0], 3, a2, a3), time.Hour)
+		check(t, err)
+		if !accepted {
+			t.Fatal("expected record within the quota to be accepted")
+		}
+		lids, err := ls.LogsWithAddrs(certified)
+		check(t, err)
+		if len(lids) != 2 {
+			t.Fatalf("expected rejected records to add no logs, got %v", lids)
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		// sizes of keys and values are counted, e.g. 4 + 8 bytes here
+		check(t, ls.PutInt64(tid, "i/k1", 1))
+		check(t, ls.PutString(tid, "s/k2", "0123456789"))
+		assertQuotaError(t, ls.PutBytes(tid, "b/k3", []byte("0123456789")), tid, core.QuotaMetaBytes)
+		assertQuotaError(t, ls.PutMetaWithTTL(tid, "s/k3", "0123456789", time.Hour), tid, core.QuotaMetaBytes)
+		// overwriting a key only counts the new value
+		check(t, ls.PutString(tid, "s/k2", "0123456789abcdef"))
+		assertQuotaError(t, ls.PutString(tid, "s/k2", "0123456789abcdefg"), tid, core.QuotaMetaBytes)
+
+		check(t, ls.DeleteMetaPrefix(tid, "s"))
+		check(t, ls.PutBytes(tid, "b/k3", []byte("0123456789")))
+		v, err := ls.GetInt64(tid, "i/k1")
+		check(t, err)
+		if v == nil || *v != 1 {
+			t.Fatalf("expected metadata to be kept, got %v", v)
+		}
+	})
+
+	t.Run("restores", func(t *testing.T) {
+		// restores replace books, so dumps are checked instead of the books
+		restored := thread.NewIDV1(thread.Raw, 24)
+		var keys core.DumpKeyBook
+		keys.Data.Public = map[thread.ID]map[thread.LogID]crypto.PubKey{restored: {}}
+		for i := 0; i < 3; i++ {
+			lg := randomLog(t)
+			keys.Data.Public[restored][lg.ID] = lg.PubKey
+		}
+		assertQuotaError(t, ls.RestoreKeys(keys), restored, core.QuotaLogs)
+
+		exp := time.Now().Add(time.Hour)
+		addrs := core.DumpAddrBook{Data: map[thread.ID]map[thread.LogID][]core.ExpiredAddress{
+			restored: {randomLog(t).ID: {
+				{Addr: Multiaddr("/ip4/1.1.1.1/tcp/4006"), Expires: exp},
+				{Addr: Multiaddr("/ip4/2.2.2.2/tcp/4006"), Expires: exp},
+				{Addr: Multiaddr("/ip4/3.3.3.3/tcp/4006"), Expires: exp},
+			}},
+		}}
+		assertQuotaError(t, ls.RestoreAddrs(addrs), restored, core.QuotaAddrs)
+
+		var meta core.DumpMetadata
+		meta.Data.String = map[core.MetadataKey]string{{T: restored, K: "s/k"}: "0123456789abcdef0123456789abcdef"}
+		assertQuotaError(t, ls.RestoreMeta(meta), restored, core.QuotaMetaBytes)
+
+		// rejected restores keep the books
+		lids, err := ls.LogsWithAddrs(tid)
+		check(t, err)
+		if len(lids) == 0 {
+			t.Fatal("expected rejected restore to keep addresses")
+		}
+		v, err := ls.GetInt64(tid, "i/k1")
+		check(t, err)
+		if v == nil || *v != 1 {
+			t.Fatalf("expected rejected restore to keep metadata, got %v", v)
+		}
+	})
+}
+
+func assertQuotaError(t *testing.T, err error, tid thread.ID, limit core.QuotaLimit) {
+	t.Helper()
+	if !errors.Is(err, core.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	var qerr *core.QuotaError
+	if !errors.As(err, &qerr) {
+		t.Fatalf("expected a QuotaError, got %T", err)
+	}
+	if !qerr.Thread.Equals(tid) || qerr.Limit != limit || qerr.Requested <= qerr.Max {
+		t.Fatalf("unexpected quota error: %+v", *qerr)
+	}
+}
+
+func randomLog(t *testing.T) thread.LogInfo {
+	_, pk, err := crypto.GenerateEd25519Key(nil)
+	check(t, err)
+	lid, err := thread.NewLogID(pk)
+	check(t, err)
+	return thread.LogInfo{ID: lid, PubKey: pk}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/libp2p/go-libp2p-core/peer"
 	pt "github.com/libp2p/go-libp2p-core/test"
 	ma "github.com/multiformats/go-multiaddr"
+	core "github.com/textileio/go-threads/core/logstore"
+	"github.com/textileio/go-threads/core/thread"
 )
 
 func Multiaddr(m string) ma.Multiaddr {
@@ -19,20 +21,20 @@ func Multiaddr(m string) ma.Multiaddr {
 }
 
 type logpair struct {
-	ID   peer.ID
+	ID   thread.LogID
 	Addr []ma.Multiaddr
 }
 
 func RandomPeer(b *testing.B, addrCount int) *logpair {
 	var (
-		pid   peer.ID
+		pid   thread.LogID
 		err   error
 		addrs = make([]ma.Multiaddr, addrCount)
 		aFmt  = "/ip4/127.0.0.1/tcp/%d/ipfs/%s"
 	)
 
 	b.Helper()
-	if pid, err = pt.RandPeerID(); err != nil {
+	if pid, err = randLogID(); err != nil {
 		b.Fatal(err)
 	}
 
@@ -73,6 +75,19 @@ func GeneratePeerIDs(count int) []peer.ID {
 	return ids
 }
 
+func randLogID() (thread.LogID, error) {
+	p, err := pt.RandPeerID()
+	return thread.LogIDFromPeer(p), err
+}
+
+func GenerateLogIDs(count int) []thread.LogID {
+	var ids = make([]thread.LogID, count)
+	for i, p := range GeneratePeerIDs(count) {
+		ids[i] = thread.LogIDFromPeer(p)
+	}
+	return ids
+}
+
 func AssertAddressesEqual(t *testing.T, exp, act []ma.Multiaddr) {
 	t.Helper()
 	if len(exp) != len(act) {
@@ -100,3 +115,41 @@ func check(t *testing.T, err error) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+// Optional capabilities of logstores under test.
+
+func names(t *testing.T, ls core.Logstore) core.NameBook {
+	nb, err := core.Names(ls)
+	check(t, err)
+	return nb
+}
+
+func pins(t *testing.T, ls core.Logstore) core.PinBook {
+	pb, err := core.Pins(ls)
+	check(t, err)
+	return pb
+}
+
+func access(t *testing.T, ls core.Logstore) core.AccessBook {
+	ab, err := core.Access(ls)
+	check(t, err)
+	return ab
+}
+
+func invites(t *testing.T, ls core.Logstore) core.Inviter {
+	inv, err := core.Invites(ls)
+	check(t, err)
+	return inv
+}
+
+func snapshots(t *testing.T, ls core.Logstore) core.Snapshotter {
+	sn, err := core.Snapshots(ls)
+	check(t, err)
+	return sn
+}
+
+func transactions(t *testing.T, ls core.Logstore) core.Transactor {
+	tr, err := core.Transactions(ls)
+	check(t, err)
+	return tr
+}